@@ -0,0 +1,291 @@
+// Package actions acts upon duplicates found: deleting them, moving them to trash or replacing them with links to
+// the copy that is kept. The same logic can be driven by the command line tool, GUIs and servers.
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"go.uber.org/multierr"
+)
+
+// Action is what is done to each duplicate that isn't kept
+type Action int
+
+// Supported actions
+const (
+	// Delete removes duplicates
+	Delete Action = iota
+	// Trash moves duplicates to trash
+	Trash
+	// Hardlink replaces duplicates with hard links to the file kept
+	Hardlink
+	// Symlink replaces duplicates with symbolic links to the file kept
+	Symlink
+	// Reflink replaces duplicates with copy-on-write clones of the file kept (on file systems that support it)
+	Reflink
+)
+
+var actionNames = map[Action]string{
+	Delete:   "delete",
+	Trash:    "trash",
+	Hardlink: "hardlink",
+	Symlink:  "symlink",
+	Reflink:  "reflink",
+}
+
+// String returns name of the action
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// isLink checks whether the action replaces duplicates with links of any type
+func (a Action) isLink() bool {
+	return a == Hardlink || a == Symlink || a == Reflink
+}
+
+// ActionNames returns names of all supported actions, sorted
+func ActionNames() []string {
+	names := make([]string, 0, len(actionNames))
+	for _, name := range actionNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActionByName returns the action with the given name
+func ActionByName(name string) (Action, error) {
+	for action, actionName := range actionNames {
+		if actionName == name {
+			return action, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown action %q", name)
+}
+
+// ErrUnsupported is returned for actions that aren't supported on this platform
+var ErrUnsupported = errors.New("action not supported on this platform")
+
+// Options control how duplicates are acted upon
+type Options struct {
+	// Keep chooses the file of each group that is kept as is (defaults to KeepFirst)
+	Keep KeepPolicy
+	// Action is done to every other file of the group
+	Action Action
+	// DryRun, if set, only records what would be done without modifying any file
+	DryRun bool
+	// TrashDir is the directory duplicates are moved to by the Trash action (defaults to the user's trash)
+	TrashDir string
+	// ReadOnly is what is done to duplicates that are read-only (defaults to ReadOnlyFail)
+	ReadOnly ReadOnlyPolicy
+	// UnlinkHardlinks, if set, acts upon duplicates that are hard links of the file kept too, rather than skipping them
+	UnlinkHardlinks bool
+	// MinSize is the size, in bytes, of the smallest duplicates acted upon: smaller ones are skipped, however small
+	// files that scans reported are. Empty duplicates are never replaced with links, which would save no space.
+	MinSize int64
+}
+
+// Record is the outcome of acting upon one duplicate
+type Record struct {
+	Action Action `json:"action"`
+	// Path of the duplicate
+	Path string `json:"path"`
+	// Kept is the path of the file of the group that is kept
+	Kept string `json:"kept"`
+	// Size of the file
+	Size int64 `json:"size"`
+	// Err is the error that occurred, if any
+	Err error `json:"-"`
+	// Skipped is set if the duplicate was left alone as per Options.ReadOnly, Options.UnlinkHardlinks or
+	// Options.MinSize, Err being why
+	Skipped bool `json:"skipped,omitempty"`
+	// Hardlinked is set if the duplicate is a hard link of the file kept (another name of the same file), removing
+	// which reclaims no space
+	Hardlinked bool `json:"hardlinked,omitempty"`
+}
+
+// Report is the outcome of acting upon groups of duplicates
+type Report struct {
+	DryRun  bool     `json:"dryRun"`
+	Records []Record `json:"records"`
+	// Succeeded is the number of duplicates acted upon successfully
+	Succeeded int `json:"succeeded"`
+	// Failed is the number of duplicates that couldn't be acted upon
+	Failed int `json:"failed"`
+	// Skipped is the number of duplicates that were left alone since they're read-only (see ReadOnlySkip), hard links
+	// of the file kept, or too small (see Options.MinSize)
+	Skipped int `json:"skipped"`
+	// ReclaimedSize is the total size of files acted upon successfully
+	ReclaimedSize int64 `json:"reclaimedSize"`
+}
+
+// Err returns all errors that occurred, joined, except those of duplicates that were skipped
+func (r *Report) Err() error {
+	var err error
+	for _, record := range r.Records {
+		if record.Err != nil && !record.Skipped {
+			err = multierr.Append(err, fmt.Errorf("couldn't %s %s: %w", record.Action, record.Path, record.Err))
+		}
+	}
+	return err
+}
+
+func (r *Report) add(record Record) {
+	record.Skipped = errors.Is(record.Err, ErrReadOnly) || errors.Is(record.Err, ErrHardlinked) ||
+		errors.Is(record.Err, ErrTooSmall)
+	if record.Skipped {
+		r.Skipped++
+	} else if record.Err != nil {
+		r.Failed++
+	} else {
+		r.Succeeded++
+		if !record.Hardlinked {
+			r.ReclaimedSize += record.Size
+		}
+	}
+	r.Records = append(r.Records, record)
+}
+
+// Apply acts upon all groups of duplicates: in each group, one file is kept as per opts.Keep and opts.Action is
+// done to the others. Errors don't stop processing; they are recorded in the returned report. Others that are hard
+// links of the file kept are skipped, unless opts.UnlinkHardlinks is set, so that a group of names of the same file
+// isn't left with only one name.
+func Apply(duplicates *entity.DigestToFiles, files entity.FilePathToMeta, opts Options) *Report {
+	if opts.Keep == nil {
+		opts.Keep = KeepFirst
+	}
+	report := &Report{DryRun: opts.DryRun}
+	for digest, paths := range duplicates.All() {
+		if len(paths) < 2 {
+			continue
+		}
+		kept := opts.Keep(paths, files)
+		for _, path := range paths {
+			if path == kept {
+				continue
+			}
+			report.add(act(opts, kept, path, digest.FileSize))
+		}
+	}
+	return report
+}
+
+// ApplySelected is like Apply, except that only selected files are acted upon, in favour of a file of the same group
+// that isn't selected, as per opts.Keep. Selected files of groups all of whose files are selected are recorded as
+// failed, since one of them must be kept.
+func ApplySelected(duplicates *entity.DigestToFiles, files entity.FilePathToMeta, selected func(path string) bool,
+	opts Options) *Report {
+	if opts.Keep == nil {
+		opts.Keep = KeepFirst
+	}
+	report := &Report{DryRun: opts.DryRun}
+	for digest, paths := range duplicates.All() {
+		var unselected, chosen []string
+		for _, path := range paths {
+			if selected(path) {
+				chosen = append(chosen, path)
+			} else {
+				unselected = append(unselected, path)
+			}
+		}
+		if len(chosen) == 0 {
+			continue
+		}
+		var kept string
+		switch len(unselected) {
+		case 0:
+		case 1:
+			kept = unselected[0]
+		default:
+			kept = opts.Keep(unselected, files)
+		}
+		for _, path := range chosen {
+			if kept == "" {
+				report.add(Record{Action: opts.Action, Path: path, Size: digest.FileSize,
+					Err: errors.New("all copies are selected, so none would be kept")})
+			} else {
+				report.add(act(opts, kept, path, digest.FileSize))
+			}
+		}
+	}
+	return report
+}
+
+// ErrHardlinked is recorded for duplicates that are hard links of the file kept, unless Options.UnlinkHardlinks is set:
+// removing them would only remove names of the file kept, which users may rely on, without reclaiming space
+var ErrHardlinked = errors.New("file is a hard link of the file kept")
+
+// ErrTooSmall is recorded for duplicates that are smaller than Options.MinSize, or empty ones that would be replaced
+// with links
+var ErrTooSmall = errors.New("file is too small to be acted upon")
+
+// ErrKeptMissing is recorded for duplicates of which the file kept doesn't exist anymore, or isn't a regular file
+// (e.g. since an earlier action replaced it with a link), so that no duplicate is acted upon in favour of a file that
+// isn't there
+var ErrKeptMissing = errors.New("file kept isn't a regular file anymore")
+
+// act does opts.Action to path, of a group of duplicates of files of size, in favour of kept, and records the outcome
+func act(opts Options, kept, path string, size int64) Record {
+	record := Record{Action: opts.Action, Path: path, Kept: kept, Size: size, Hardlinked: isHardlinked(kept, path)}
+	switch {
+	case !isRegular(kept):
+		record.Err = fmt.Errorf("%w: %s", ErrKeptMissing, kept)
+	case size < opts.MinSize || (size == 0 && opts.Action.isLink()):
+		record.Err = fmt.Errorf("%w (%d bytes)", ErrTooSmall, size)
+	case record.Hardlinked && !opts.UnlinkHardlinks:
+		record.Err = ErrHardlinked
+	default:
+		record.Err = apply(opts, kept, path)
+	}
+	return record
+}
+
+// isRegular checks whether the named file exists, and is a regular file (rather than, say, a symbolic link)
+func isRegular(name string) bool {
+	info, err := os.Lstat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isHardlinked checks whether path is a hard link of kept, i.e. whether both are names of the same file
+func isHardlinked(kept, path string) bool {
+	keptInfo, err := os.Lstat(kept)
+	if err != nil {
+		return false
+	}
+	info, err := os.Lstat(path)
+	return err == nil && os.SameFile(keptInfo, info)
+}
+
+// apply does opts.Action to path, unless it's a dry run (or path is protected, see checkProtected), as per
+// opts.ReadOnly if path is read-only
+func apply(opts Options, kept, path string) error {
+	if err := checkProtected(path); err != nil {
+		return err
+	}
+	if done, err := applyReadOnly(opts, kept, path); done || opts.DryRun {
+		return err
+	}
+	return do(opts, kept, path)
+}
+
+// do does opts.Action to path
+func do(opts Options, kept, path string) error {
+	switch opts.Action {
+	case Delete:
+		return os.Remove(path)
+	case Trash:
+		return moveToTrash(opts.TrashDir, path)
+	case Hardlink:
+		return replaceWith(path, func(tmp string) error { return os.Link(kept, tmp) })
+	case Symlink:
+		return replaceWithSymlink(kept, path)
+	case Reflink:
+		return replaceWith(path, func(tmp string) error { return reflink(kept, tmp) })
+	default:
+		return fmt.Errorf("unknown action %d", opts.Action)
+	}
+}
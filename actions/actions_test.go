@@ -0,0 +1,294 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDuplicates(t *testing.T) (dir string, duplicates *entity.DigestToFiles, files entity.FilePathToMeta) {
+	dir = t.TempDir()
+	duplicates = entity.NewDigestToFiles()
+	files = entity.FilePathToMeta{}
+	digest := entity.FileDigest{FileExtension: ".txt", FileHash: "h", FileSize: 5}
+	for i, name := range []string{"b.txt", "a.txt", "sub/c.txt"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, []byte("hello"), 0o644))
+		duplicates.Set(digest, path)
+		files[path] = entity.FileMeta{Size: 5, Modified: time.Unix(int64(100-i), 0)}
+	}
+	return
+}
+
+func TestApplyDryRun(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	report := Apply(duplicates, files, Options{Action: Delete, DryRun: true, Keep: KeepOldest})
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, int64(10), report.ReclaimedSize)
+	for _, record := range report.Records {
+		assert.Equal(t, filepath.Join(dir, "sub/c.txt"), record.Kept)
+		assert.FileExists(t, record.Path)
+	}
+}
+
+// TestKeepNewest checks whether the newest of files modified within the same second is kept
+func TestKeepNewest(t *testing.T) {
+	files := entity.FilePathToMeta{
+		"a.txt": {Size: 5, Modified: time.Unix(100, 200)},
+		"b.txt": {Size: 5, Modified: time.Unix(100, 900)},
+		"c.txt": {Size: 5, Modified: time.Unix(100, 500)},
+	}
+	paths := []string{"a.txt", "b.txt", "c.txt"}
+	assert.Equal(t, "b.txt", KeepNewest(paths, files))
+	assert.Equal(t, "a.txt", KeepOldest(paths, files))
+}
+
+func TestApplyDelete(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	report := Apply(duplicates, files, Options{Action: Delete})
+	assert.Nil(t, report.Err())
+	assert.Equal(t, 2, report.Succeeded)
+	assert.FileExists(t, filepath.Join(dir, "a.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "sub/c.txt"))
+}
+
+// TestApplyKeptMissing checks whether duplicates aren't acted upon in favour of a file kept that doesn't exist anymore,
+// or has been replaced with a link
+func TestApplyKeptMissing(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	kept := filepath.Join(dir, "sub/c.txt")
+	assert.Nil(t, os.Remove(kept))
+	report := Apply(duplicates, files, Options{Action: Symlink, Keep: KeepOldest})
+	assert.Equal(t, 2, report.Failed)
+	for _, record := range report.Records {
+		assert.ErrorIs(t, record.Err, ErrKeptMissing)
+		info, err := os.Lstat(record.Path)
+		assert.Nil(t, err)
+		assert.True(t, info.Mode().IsRegular())
+	}
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "a.txt"), kept))
+	report = Apply(duplicates, files, Options{Action: Delete, Keep: KeepOldest})
+	assert.Equal(t, 2, report.Failed)
+	assert.FileExists(t, filepath.Join(dir, "a.txt"))
+	assert.FileExists(t, filepath.Join(dir, "b.txt"))
+}
+
+func TestApplySelected(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	selected := func(path string) bool { return path != filepath.Join(dir, "b.txt") }
+	report := ApplySelected(duplicates, files, selected, Options{Action: Delete, Keep: KeepOldest})
+	assert.Nil(t, report.Err())
+	assert.Equal(t, 2, report.Succeeded)
+	assert.FileExists(t, filepath.Join(dir, "b.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "a.txt"))
+	report = ApplySelected(duplicates, files, func(string) bool { return true }, Options{Action: Delete})
+	assert.Equal(t, 3, report.Failed)
+	assert.FileExists(t, filepath.Join(dir, "b.txt"))
+}
+
+func TestApplyLinks(t *testing.T) {
+	for _, action := range []Action{Hardlink, Symlink} {
+		dir, duplicates, files := setupDuplicates(t)
+		report := Apply(duplicates, files, Options{Action: action, Keep: KeepShortestPath})
+		assert.Nil(t, report.Err())
+		kept, _ := os.Stat(filepath.Join(dir, "a.txt"))
+		for _, name := range []string{"b.txt", "sub/c.txt"} {
+			contents, err := os.ReadFile(filepath.Join(dir, name))
+			assert.Nil(t, err)
+			assert.Equal(t, "hello", string(contents))
+			info, _ := os.Stat(filepath.Join(dir, name))
+			assert.True(t, os.SameFile(kept, info), "%s of %s", action, name)
+		}
+	}
+}
+
+func TestApplyTrash(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	trashDir := filepath.Join(dir, "trash")
+	assert.Nil(t, os.Mkdir(trashDir, 0o700))
+	assert.Nil(t, os.WriteFile(filepath.Join(trashDir, "b.txt"), nil, 0o644))
+	report := Apply(duplicates, files, Options{Action: Trash, TrashDir: trashDir})
+	assert.Nil(t, report.Err())
+	assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+	assert.FileExists(t, filepath.Join(trashDir, "b.2.txt"))
+	assert.FileExists(t, filepath.Join(trashDir, "c.txt"))
+}
+
+// TestApplyTrashAcrossDevices checks whether files are copied into a trash on another device, which they can't be
+// renamed into
+func TestApplyTrashAcrossDevices(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	trashDir, err := os.MkdirTemp("/dev/shm", "trash")
+	if err != nil || storage.SameDevice(dir, trashDir) {
+		t.Skip("no other device to move files to")
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(trashDir) })
+	report := Apply(duplicates, files, Options{Action: Trash, TrashDir: trashDir})
+	assert.Nil(t, report.Err())
+	assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "sub", "c.txt"))
+	for _, name := range []string{"b.txt", "c.txt"} {
+		contents, err := os.ReadFile(filepath.Join(trashDir, name))
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(contents))
+	}
+}
+
+// TestCheckTrashSpace checks whether trashes on other devices than duplicates, which duplicates would be copied into,
+// are checked for free space for them
+func TestCheckTrashSpace(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	huge := entity.NewDigestToFiles()
+	for _, paths := range duplicates.All() {
+		for _, path := range paths {
+			huge.Set(entity.FileDigest{FileExtension: ".txt", FileHash: "h", FileSize: 1 << 60}, path)
+		}
+	}
+	// Duplicates of the device of the trash are renamed into it, which takes no space
+	sameDevice := filepath.Join(dir, "trash")
+	assert.Nil(t, CheckTrashSpace(huge, files, Options{Action: Trash, TrashDir: sameDevice}))
+
+	trashDir, err := os.MkdirTemp("/dev/shm", "trash")
+	if err != nil || storage.SameDevice(dir, trashDir) {
+		t.Skip("no other device to move files to")
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(trashDir) })
+	assert.Nil(t, CheckTrashSpace(duplicates, files, Options{Action: Trash, TrashDir: trashDir}))
+	assert.ErrorIs(t, CheckTrashSpace(huge, files, Options{Action: Trash, TrashDir: trashDir}), ErrTrashFull)
+	assert.Nil(t, CheckTrashSpace(huge, files, Options{Action: Trash, TrashDir: trashDir, DryRun: true}))
+	assert.Nil(t, CheckTrashSpace(huge, files, Options{Action: Delete}))
+	assert.Nil(t, CheckTrashSpace(huge, files, Options{Action: Trash, TrashDir: trashDir, MinSize: 1 << 61}))
+}
+
+// TestCopyFile checks whether copies of files have their contents, permissions and modification times, and aren't
+// left half-written when copying fails
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("hello"), 0o640))
+	modTime := time.Unix(1_700_000_000, 0)
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+	info, err := os.Lstat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, copyFile(path, filepath.Join(dir, "b.txt"), info))
+	contents, err := os.ReadFile(filepath.Join(dir, "b.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(contents))
+	copied, err := os.Stat(filepath.Join(dir, "b.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode(), copied.Mode())
+	assert.True(t, copied.ModTime().Equal(modTime))
+	// Files of the name of the copy are left alone
+	assert.NotNil(t, copyFile(path, filepath.Join(dir, "b.txt"), info))
+	assert.FileExists(t, filepath.Join(dir, "b.txt"))
+	assert.NotNil(t, copyFile(filepath.Join(dir, "missing.txt"), filepath.Join(dir, "c.txt"), info))
+	assert.NoFileExists(t, filepath.Join(dir, "c.txt"))
+}
+
+// TestDeviceTrashDir checks whether files of the device of the home trash are moved into it
+func TestDeviceTrashDir(t *testing.T) {
+	dir := t.TempDir()
+	homeTrash := filepath.Join(dir, "home", ".local", "share", "Trash")
+	trashDir, topDir := deviceTrashDir(homeTrash, filepath.Join(dir, "a.txt"))
+	assert.Equal(t, homeTrash, trashDir)
+	assert.Equal(t, "", topDir)
+	assert.DirExists(t, homeTrash)
+
+	// Files of other devices are moved into trashes of their top directories
+	other, err := os.MkdirTemp("/dev/shm", "duplicates")
+	if err != nil || storage.SameDevice(dir, other) {
+		t.Skip("no other device of files")
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(other) })
+	mountPoint, err := storage.MountPoint(other)
+	assert.Nil(t, err)
+	expected := filepath.Join(mountPoint, ".Trash-"+strconv.Itoa(os.Getuid()))
+	if _, err := os.Lstat(expected); err == nil {
+		t.Skipf("%s exists already", expected)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(expected) })
+	trashDir, topDir = deviceTrashDir(homeTrash, filepath.Join(other, "a.txt"))
+	assert.Equal(t, expected, trashDir)
+	assert.Equal(t, mountPoint, topDir)
+	assert.DirExists(t, expected)
+}
+
+func TestApplyProtected(t *testing.T) {
+	protected := protectedDirs()[0]
+	if _, err := os.Stat(protected); err != nil {
+		t.Skipf("%s doesn't exist: %v", protected, err)
+	}
+	dir := t.TempDir()
+	link := filepath.Join(dir, "system")
+	if err := os.Symlink(protected, link); err != nil {
+		t.Skipf("can't create symbolic links: %v", err)
+	}
+	assert.ErrorIs(t, checkProtected(filepath.Join(link, "duplicate.txt")), ErrProtected)
+	assert.Nil(t, checkProtected(filepath.Join(protected, "duplicate.txt")))
+	assert.Nil(t, checkProtected(filepath.Join(dir, "duplicate.txt")))
+
+	duplicates := entity.NewDigestToFiles()
+	digest := entity.FileDigest{FileExtension: ".txt", FileHash: "h", FileSize: 5}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644))
+	duplicates.Set(digest, filepath.Join(dir, "a.txt"))
+	duplicates.Set(digest, filepath.Join(link, "a.txt"))
+	report := Apply(duplicates, entity.FilePathToMeta{}, Options{Action: Delete, DryRun: true})
+	assert.Equal(t, 1, report.Failed)
+	assert.ErrorIs(t, report.Records[0].Err, ErrProtected)
+}
+
+func TestApplyHardlinked(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	for _, name := range []string{"b.txt", "sub/c.txt"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.Remove(path))
+		if err := os.Link(filepath.Join(dir, "a.txt"), path); err != nil {
+			t.Skipf("can't create hard links: %v", err)
+		}
+	}
+	report := Apply(duplicates, files, Options{Action: Delete, Keep: KeepShortestPath})
+	assert.Nil(t, report.Err())
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 0, report.Succeeded)
+	assert.ErrorIs(t, report.Records[0].Err, ErrHardlinked)
+	assert.FileExists(t, filepath.Join(dir, "b.txt"))
+	assert.FileExists(t, filepath.Join(dir, "sub/c.txt"))
+
+	report = Apply(duplicates, files, Options{Action: Delete, Keep: KeepShortestPath, UnlinkHardlinks: true})
+	assert.Nil(t, report.Err())
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, int64(0), report.ReclaimedSize)
+	assert.FileExists(t, filepath.Join(dir, "a.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+}
+
+func TestApplyMinSize(t *testing.T) {
+	dir, duplicates, files := setupDuplicates(t)
+	report := Apply(duplicates, files, Options{Action: Delete, MinSize: 6})
+	assert.Nil(t, report.Err())
+	assert.Equal(t, 2, report.Skipped)
+	assert.ErrorIs(t, report.Records[0].Err, ErrTooSmall)
+	assert.FileExists(t, filepath.Join(dir, "b.txt"))
+
+	empty := entity.NewDigestToFiles()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, "empty", name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, nil, 0o644))
+		empty.Set(entity.FileDigest{FileExtension: ".txt", FileHash: "e"}, path)
+	}
+	report = Apply(empty, files, Options{Action: Hardlink})
+	assert.Equal(t, 1, report.Skipped)
+	assert.ErrorIs(t, report.Records[0].Err, ErrTooSmall)
+	report = Apply(empty, files, Options{Action: Delete})
+	assert.Equal(t, 1, report.Succeeded)
+	assert.NoFileExists(t, filepath.Join(dir, "empty", "b.txt"))
+}
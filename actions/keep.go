@@ -0,0 +1,75 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// KeepPolicy chooses which of a group of duplicate files is kept. paths are sorted and have at least 2 entries.
+type KeepPolicy func(paths []string, files entity.FilePathToMeta) (kept string)
+
+// KeepFirst keeps the file whose path is first in lexicographical order
+func KeepFirst(paths []string, _ entity.FilePathToMeta) string {
+	return paths[0]
+}
+
+// KeepOldest keeps the file that was modified earliest
+func KeepOldest(paths []string, files entity.FilePathToMeta) string {
+	return keepBest(paths, func(a, b string) bool {
+		return files[a].Modified.Before(files[b].Modified)
+	})
+}
+
+// KeepNewest keeps the file that was modified most recently
+func KeepNewest(paths []string, files entity.FilePathToMeta) string {
+	return keepBest(paths, func(a, b string) bool {
+		return files[a].Modified.After(files[b].Modified)
+	})
+}
+
+// KeepShortestPath keeps the file with the shortest path, which usually is the one that's least deeply nested
+func KeepShortestPath(paths []string, _ entity.FilePathToMeta) string {
+	return keepBest(paths, func(a, b string) bool {
+		return len(a) < len(b)
+	})
+}
+
+// keepBest returns the path that is better than all others, picking the first in case of ties
+func keepBest(paths []string, better func(a, b string) bool) string {
+	best := paths[0]
+	for _, path := range paths[1:] {
+		if better(path, best) {
+			best = path
+		}
+	}
+	return best
+}
+
+// KeepPolicies are the built-in keep policies, by name
+var KeepPolicies = map[string]KeepPolicy{
+	"first":    KeepFirst,
+	"oldest":   KeepOldest,
+	"newest":   KeepNewest,
+	"shortest": KeepShortestPath,
+}
+
+// KeepPolicyNames returns names of built-in keep policies, sorted
+func KeepPolicyNames() []string {
+	names := make([]string, 0, len(KeepPolicies))
+	for name := range KeepPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeepPolicyByName returns the built-in keep policy with the given name
+func KeepPolicyByName(name string) (KeepPolicy, error) {
+	policy, exists := KeepPolicies[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown keep policy %q", name)
+	}
+	return policy, nil
+}
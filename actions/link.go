@@ -0,0 +1,31 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// replaceWith replaces the file at path with one created by create at a temporary path in the same directory.
+// Since the replacement is renamed over the original, the original is never lost if creation fails.
+func replaceWith(path string, create func(tmp string) error) error {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.gfd-%d.tmp", filepath.Base(path), os.Getpid()))
+	if err := create(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// replaceWithSymlink replaces the file at path with a symbolic link to the absolute path of kept
+func replaceWithSymlink(kept, path string) error {
+	target, err := filepath.Abs(kept)
+	if err != nil {
+		return err
+	}
+	return replaceWith(path, func(tmp string) error { return os.Symlink(target, tmp) })
+}
@@ -0,0 +1,48 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// ErrProtected is returned for duplicates that are reached through links (symbolic links, or junctions on Windows)
+// that lead into folders of the system, such as C:\Windows or /usr, which are never acted upon that way
+var ErrProtected = errors.New("path leads through a link into a protected folder of the system")
+
+// checkProtected returns ErrProtected if the directory of path goes through a link into a folder of protectedDirs.
+// Paths that are in such folders without going through links are left to permissions of the system.
+func checkProtected(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(abs)
+	realPath, ok := vfs.ResolveLinks(vfs.Local, dir)
+	if !ok || realPath == dir || isProtected(dir) {
+		return nil
+	}
+	if isProtected(realPath) {
+		return fmt.Errorf("%s is in %s: %w", path, realPath, ErrProtected)
+	}
+	return nil
+}
+
+// isProtected checks whether dir is (or is in) a folder of protectedDirs
+func isProtected(dir string) bool {
+	if caseInsensitivePaths {
+		dir = strings.ToLower(dir)
+	}
+	for _, protected := range protectedDirs() {
+		if caseInsensitivePaths {
+			protected = strings.ToLower(protected)
+		}
+		if dir == protected || vfs.IsIn(protected, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package actions
+
+const caseInsensitivePaths = false
+
+// protectedDirs returns folders of the system, which duplicates aren't acted upon in through links (see
+// checkProtected)
+func protectedDirs() []string {
+	return []string{
+		"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/proc", "/sbin", "/sys", "/usr",
+		// macOS
+		"/System", "/Library", "/private/etc", "/private/var/db",
+	}
+}
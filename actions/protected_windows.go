@@ -0,0 +1,23 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const caseInsensitivePaths = true
+
+// protectedDirs returns folders of the system (as per the environment), which duplicates aren't acted upon in
+// through junctions or links (see checkProtected)
+func protectedDirs() []string {
+	var dirs []string
+	for _, name := range []string{"SystemRoot", "ProgramFiles", "ProgramFiles(x86)", "ProgramW6432", "ProgramData"} {
+		if dir := os.Getenv(name); dir != "" {
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+	}
+	if drive := os.Getenv("SystemDrive"); drive != "" {
+		dirs = append(dirs, filepath.Join(drive+`\`, "System Volume Information"), filepath.Join(drive+`\`, "$Recycle.Bin"))
+	}
+	return dirs
+}
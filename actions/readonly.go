@@ -0,0 +1,80 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ReadOnlyPolicy is what is done to duplicates that are read-only, or protected by attributes of the file system (such
+// as immutable files on Linux), which the system doesn't let be removed or replaced as they are
+type ReadOnlyPolicy int
+
+// Supported policies for read-only duplicates
+const (
+	// ReadOnlyFail acts upon them anyway, recording the error of the system as a failure
+	ReadOnlyFail ReadOnlyPolicy = iota
+	// ReadOnlySkip leaves them alone, recording them as skipped rather than failed
+	ReadOnlySkip
+	// ReadOnlyClear clears their attributes and acts upon them, restoring attributes if the action fails still
+	ReadOnlyClear
+)
+
+var readOnlyPolicyNames = map[ReadOnlyPolicy]string{
+	ReadOnlyFail:  "fail",
+	ReadOnlySkip:  "skip",
+	ReadOnlyClear: "clear",
+}
+
+// String returns name of the policy
+func (p ReadOnlyPolicy) String() string {
+	return readOnlyPolicyNames[p]
+}
+
+// ReadOnlyPolicyNames returns names of all supported policies for read-only duplicates, sorted
+func ReadOnlyPolicyNames() []string {
+	names := make([]string, 0, len(readOnlyPolicyNames))
+	for _, name := range readOnlyPolicyNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadOnlyPolicyByName returns the policy for read-only duplicates with the given name
+func ReadOnlyPolicyByName(name string) (ReadOnlyPolicy, error) {
+	for policy, policyName := range readOnlyPolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown policy for read-only files %q", name)
+}
+
+// ErrReadOnly is recorded for duplicates that are skipped by ReadOnlySkip
+var ErrReadOnly = errors.New("file is read-only or protected by attributes")
+
+// applyReadOnly does opts.Action to path as per opts.ReadOnly, if path is read-only (see fileProtection). It returns
+// false, leaving the action to be done as usual, if path isn't, or if opts.ReadOnly is ReadOnlyFail.
+func applyReadOnly(opts Options, kept, path string) (done bool, err error) {
+	if opts.ReadOnly == ReadOnlyFail {
+		return false, nil
+	}
+	p, isProtected := fileProtection(path)
+	switch {
+	case !isProtected:
+		return false, nil
+	case opts.ReadOnly == ReadOnlySkip:
+		return true, fmt.Errorf("%w (%s)", ErrReadOnly, p)
+	case opts.DryRun:
+		return true, nil
+	}
+	if err := p.clear(path); err != nil {
+		return true, fmt.Errorf("couldn't clear attributes (%s): %w", p, err)
+	}
+	if err := do(opts, kept, path); err != nil {
+		_ = p.restore(path)
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// protection is the flags of a file (see chflags(1))
+type protection uint32
+
+const (
+	immutableFlags = unix.UF_IMMUTABLE | unix.SF_IMMUTABLE
+	appendFlags    = unix.UF_APPEND | unix.SF_APPEND
+)
+
+// fileProtection returns flags of the file at path, and checks whether they keep it from being removed or replaced
+func fileProtection(path string) (protection, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return protection(stat.Flags), stat.Flags&(immutableFlags|appendFlags) != 0
+}
+
+func (p protection) clear(path string) error {
+	return unix.Chflags(path, int(uint32(p)&^(immutableFlags|appendFlags)))
+}
+
+func (p protection) restore(path string) error {
+	return unix.Chflags(path, int(p))
+}
+
+func (p protection) String() string {
+	var attrs []string
+	if p&immutableFlags != 0 {
+		attrs = append(attrs, "immutable")
+	}
+	if p&appendFlags != 0 {
+		attrs = append(attrs, "append-only")
+	}
+	return strings.Join(attrs, ", ")
+}
@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Attributes of inodes, of <linux/fs.h>, which keep files from being removed or replaced (see chattr(1))
+const (
+	fsImmutableFlag = 0x00000010
+	fsAppendFlag    = 0x00000020
+)
+
+// protection is the attributes of an inode
+type protection uint32
+
+// fileProtection returns attributes of the file at path, and checks whether they keep it from being removed or
+// replaced. Files of file systems that don't have attributes aren't.
+func fileProtection(path string) (protection, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	flags, err := unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return 0, false
+	}
+	return protection(flags), flags&(fsImmutableFlag|fsAppendFlag) != 0
+}
+
+func (p protection) clear(path string) error {
+	return setFileFlags(path, uint32(p)&^(fsImmutableFlag|fsAppendFlag))
+}
+
+func (p protection) restore(path string) error {
+	return setFileFlags(path, uint32(p))
+}
+
+func (p protection) String() string {
+	var attrs []string
+	if p&fsImmutableFlag != 0 {
+		attrs = append(attrs, "immutable")
+	}
+	if p&fsAppendFlag != 0 {
+		attrs = append(attrs, "append-only")
+	}
+	return strings.Join(attrs, ", ")
+}
+
+// setFileFlags sets attributes of the file at path, which requires the CAP_LINUX_IMMUTABLE capability (as root has)
+func setFileFlags(path string, flags uint32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return unix.IoctlSetPointerInt(int(f.Fd()), unix.FS_IOC_SETFLAGS, int(flags))
+}
@@ -0,0 +1,36 @@
+package actions
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyReadOnly(t *testing.T) {
+	for _, policy := range []ReadOnlyPolicy{ReadOnlyFail, ReadOnlySkip, ReadOnlyClear} {
+		dir, duplicates, files := setupDuplicates(t)
+		immutable := filepath.Join(dir, "b.txt")
+		if err := setFileFlags(immutable, fsImmutableFlag); err != nil {
+			t.Skipf("can't make files immutable: %v", err)
+		}
+		t.Cleanup(func() { _ = setFileFlags(immutable, 0) })
+		report := Apply(duplicates, files, Options{Action: Delete, ReadOnly: policy})
+		switch policy {
+		case ReadOnlyFail:
+			assert.Equal(t, 1, report.Failed)
+			assert.NotNil(t, report.Err())
+			assert.FileExists(t, immutable)
+		case ReadOnlySkip:
+			assert.Equal(t, 1, report.Skipped)
+			assert.Equal(t, 0, report.Failed)
+			assert.Nil(t, report.Err())
+			assert.FileExists(t, immutable)
+		case ReadOnlyClear:
+			assert.Equal(t, 2, report.Succeeded)
+			assert.Nil(t, report.Err())
+			assert.NoFileExists(t, immutable)
+		}
+		assert.NoFileExists(t, filepath.Join(dir, "sub/c.txt"), "%s", policy)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !windows
+
+package actions
+
+// protection is empty, since files aren't known to be protected by attributes on other platforms
+type protection struct{}
+
+func fileProtection(_ string) (protection, bool) {
+	return protection{}, false
+}
+
+func (protection) clear(_ string) error {
+	return ErrUnsupported
+}
+
+func (protection) restore(_ string) error {
+	return ErrUnsupported
+}
+
+func (protection) String() string {
+	return ""
+}
@@ -0,0 +1,28 @@
+package actions
+
+import "os"
+
+// protection is the mode of a file, which has no write permission if the file has the read-only attribute
+type protection os.FileMode
+
+// fileProtection returns the mode of the file at path, and checks whether it's read-only, which keeps it from being
+// removed or replaced
+func fileProtection(path string) (protection, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return protection(info.Mode()), info.Mode().Perm()&0o200 == 0
+}
+
+func (p protection) clear(path string) error {
+	return os.Chmod(path, os.FileMode(p).Perm()|0o200)
+}
+
+func (p protection) restore(path string) error {
+	return os.Chmod(path, os.FileMode(p).Perm())
+}
+
+func (p protection) String() string {
+	return "read-only"
+}
@@ -0,0 +1,8 @@
+package actions
+
+import "golang.org/x/sys/unix"
+
+// reflink creates dst as a copy-on-write clone of src (supported on APFS)
+func reflink(src, dst string) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
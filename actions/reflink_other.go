@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package actions
+
+func reflink(_, _ string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,250 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/storage"
+)
+
+// moveToTrash moves the file at path into trashDir or, if that's empty, into the user's trash: that of the home
+// directory, or that of the top directory of the device of the file if it's on another device (see deviceTrashDir)
+func moveToTrash(trashDir string, path string) error {
+	freedesktop := false
+	topDir := ""
+	if trashDir == "" {
+		var err error
+		trashDir, freedesktop, err = defaultTrashDir()
+		if err != nil {
+			return err
+		}
+		if freedesktop {
+			trashDir, topDir = deviceTrashDir(trashDir, path)
+		}
+	}
+	filesDir := trashDir
+	if freedesktop {
+		filesDir = filepath.Join(trashDir, "files")
+	}
+	if err := os.MkdirAll(filesDir, 0o700); err != nil {
+		return err
+	}
+	name := uniqueName(filesDir, filepath.Base(path))
+	if freedesktop {
+		// See: https://specifications.freedesktop.org/trash-spec/trashspec-latest.html
+		infoDir := filepath.Join(trashDir, "info")
+		if err := os.MkdirAll(infoDir, 0o700); err != nil {
+			return err
+		}
+		originalPath, _ := filepath.Abs(path)
+		if topDir != "" {
+			// Paths of trashes of top directories are relative to them
+			originalPath, _ = filepath.Rel(topDir, originalPath)
+		}
+		info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: originalPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if err := os.WriteFile(filepath.Join(infoDir, name+".trashinfo"), []byte(info), 0o600); err != nil {
+			return err
+		}
+	}
+	if err := moveFile(path, filepath.Join(filesDir, name)); err != nil {
+		if freedesktop {
+			_ = os.Remove(filepath.Join(trashDir, "info", name+".trashinfo"))
+		}
+		return fmt.Errorf("couldn't move to trash %s: %w", trashDir, err)
+	}
+	return nil
+}
+
+// ErrTrashFull is returned by CheckTrashSpace for trashes that don't have enough free space for duplicates that would
+// be copied into them
+var ErrTrashFull = errors.New("not enough free space in trash")
+
+// CheckTrashSpace checks, before Apply moves duplicates to trash as per opts, whether trashes have enough free space
+// for duplicates that would be copied into them: those of devices other than that of their trash (see
+// deviceTrashDir), which can't be renamed into it. Apply would otherwise fail only once a trash is full, having moved
+// some duplicates of groups but not others. It's nil for actions other than Trash, and for dry runs.
+func CheckTrashSpace(duplicates *entity.DigestToFiles, files entity.FilePathToMeta, opts Options) error {
+	if opts.Action != Trash || opts.DryRun {
+		return nil
+	}
+	if opts.Keep == nil {
+		opts.Keep = KeepFirst
+	}
+	homeTrash, freedesktop := opts.TrashDir, false
+	if homeTrash == "" {
+		var err error
+		if homeTrash, freedesktop, err = defaultTrashDir(); err != nil {
+			return err
+		}
+	}
+	// Sizes of duplicates that would be copied, by their trashes
+	copied := map[string]int64{}
+	for digest, paths := range duplicates.All() {
+		if len(paths) < 2 || digest.FileSize < opts.MinSize {
+			continue
+		}
+		kept := opts.Keep(paths, files)
+		for _, path := range paths {
+			if path == kept {
+				continue
+			}
+			trashDir := homeTrash
+			if freedesktop {
+				trashDir, _ = deviceTrashDir(homeTrash, path)
+			}
+			if os.MkdirAll(trashDir, 0o700) == nil && !storage.SameDevice(filepath.Dir(path), trashDir) {
+				copied[trashDir] += digest.FileSize
+			}
+		}
+	}
+	for _, trashDir := range slices.Sorted(maps.Keys(copied)) {
+		if free, err := storage.FreeSpace(trashDir); err == nil && free < copied[trashDir] {
+			return fmt.Errorf("%w: duplicates of other devices, which would be copied into %s, take %s, but it has "+
+				"only %s free", ErrTrashFull, trashDir, bytesutil.BinaryFormat(copied[trashDir]),
+				bytesutil.BinaryFormat(free))
+		}
+	}
+	return nil
+}
+
+// deviceTrashDir returns the trash of the file at path, and the top directory of the device the trash is of (empty
+// if it's homeTrash). Since files can't be renamed across devices, files of devices other than that of homeTrash are
+// moved into the trash of the top directory of their device: $topdir/.Trash/$uid if an administrator made a shared
+// $topdir/.Trash (a directory with the sticky bit set), and $topdir/.Trash-$uid otherwise. If neither can be made
+// (e.g. as the device is read-only to this user), it's homeTrash, into which files are copied.
+func deviceTrashDir(homeTrash, path string) (trashDir, topDir string) {
+	dir := filepath.Dir(path)
+	if os.MkdirAll(homeTrash, 0o700) == nil && storage.SameDevice(dir, homeTrash) {
+		return homeTrash, ""
+	}
+	topDir, err := storage.MountPoint(dir)
+	if err != nil {
+		return homeTrash, ""
+	}
+	uid := strconv.Itoa(os.Getuid())
+	shared := filepath.Join(topDir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		if trashDir := filepath.Join(shared, uid); os.MkdirAll(trashDir, 0o700) == nil {
+			return trashDir, topDir
+		}
+	}
+	trashDir = filepath.Join(topDir, ".Trash-"+uid)
+	if os.MkdirAll(trashDir, 0o700) != nil {
+		return homeTrash, ""
+	}
+	return trashDir, topDir
+}
+
+// moveFile renames the file at path to newPath or, if they're on different devices (which files can't be renamed
+// across), copies it to newPath and removes it once the copy is synced to disk
+func moveFile(path, newPath string) error {
+	err := os.Rename(path, newPath)
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+	info, sErr := os.Lstat(path)
+	if sErr != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	if err := copyFile(path, newPath, info); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		_ = os.Remove(newPath)
+		return err
+	}
+	return nil
+}
+
+// copyFile copies the regular file at path, whose metadata is info, to a new file newPath of the same permissions
+// and modification time, and syncs the copy to disk. The copy is removed if that fails.
+func copyFile(path, newPath string, info os.FileInfo) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(newPath)
+		}
+	}()
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chtimes(newPath, info.ModTime(), info.ModTime())
+	}
+	return err
+}
+
+// TrashFilesDir returns the directory that the Trash action moves files into: that of trashDir or, if that's empty,
+// that of the user's trash
+func TrashFilesDir(trashDir string) (string, error) {
+	freedesktop := false
+	if trashDir == "" {
+		var err error
+		if trashDir, freedesktop, err = defaultTrashDir(); err != nil {
+			return "", err
+		}
+	}
+	if freedesktop {
+		return filepath.Join(trashDir, "files"), nil
+	}
+	return trashDir, nil
+}
+
+// defaultTrashDir returns the user's trash directory, and whether it follows the freedesktop.org specification
+func defaultTrashDir() (dir string, freedesktop bool, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false, err
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, ".Trash"), false, nil
+	case "windows":
+		return "", false, fmt.Errorf("moving to recycle bin: %w", ErrUnsupported)
+	default:
+		if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+			return filepath.Join(dataHome, "Trash"), true, nil
+		}
+		return filepath.Join(home, ".local", "share", "Trash"), true, nil
+	}
+}
+
+// uniqueName returns name, or a variant of it, such that no file of that name exists in dir
+func uniqueName(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, candidate)); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+}
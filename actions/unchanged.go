@@ -0,0 +1,36 @@
+package actions
+
+import (
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// Unchanged returns groups of duplicates (of a scan, or of a manifest) without files whose size or modification time
+// aren't what files has them as anymore, or that don't exist anymore, along with those files. Groups left with fewer
+// than 2 files are left out altogether. Duplicates should be checked so right before they're acted upon, since files
+// may have changed (or been acted upon already) since they were found.
+func Unchanged(fsys vfs.FS, duplicates *entity.DigestToFiles, files entity.FilePathToMeta) (
+	*entity.DigestToFiles, []string,
+) {
+	unchanged := entity.NewDigestToFiles()
+	var changed []string
+	for digest, paths := range duplicates.All() {
+		var left []string
+		for _, path := range paths {
+			info, err := fsys.Stat(path)
+			meta := files[path]
+			if err != nil || info.Size() != meta.Size || !meta.ModifiedAt(info.ModTime()) {
+				changed = append(changed, path)
+				continue
+			}
+			left = append(left, path)
+		}
+		if len(left) < 2 {
+			continue
+		}
+		for _, path := range left {
+			unchanged.Set(digest, path)
+		}
+	}
+	return unchanged, changed
+}
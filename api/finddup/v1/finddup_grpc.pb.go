@@ -0,0 +1,302 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: finddup/v1/finddup.proto
+
+// Package finddup.v1 is the API of go-find-duplicates in server mode ("go-find-duplicates serve"), through which scans
+// are run and acted upon programmatically.
+
+package finddupv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FindDuplicates_Scan_FullMethodName        = "/finddup.v1.FindDuplicates/Scan"
+	FindDuplicates_GetProgress_FullMethodName = "/finddup.v1.FindDuplicates/GetProgress"
+	FindDuplicates_GetReport_FullMethodName   = "/finddup.v1.FindDuplicates/GetReport"
+	FindDuplicates_Act_FullMethodName         = "/finddup.v1.FindDuplicates/Act"
+	FindDuplicates_DeleteScan_FullMethodName  = "/finddup.v1.FindDuplicates/DeleteScan"
+)
+
+// FindDuplicatesClient is the client API for FindDuplicates service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FindDuplicates runs scans for duplicate files on the host of the server
+type FindDuplicatesClient interface {
+	// Scan starts a scan, and streams groups of duplicates as they're confirmed. The first event has the ID of the scan,
+	// and the last one its final progress. The scan goes on even if the stream is cancelled, so that it can be looked up
+	// later by its ID.
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanEvent], error)
+	// GetProgress returns progress of a scan
+	GetProgress(ctx context.Context, in *GetProgressRequest, opts ...grpc.CallOption) (*Progress, error)
+	// GetReport returns all groups of duplicates of a scan that has completed
+	GetReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*Report, error)
+	// Act acts upon duplicates of a scan that has completed: in each group, one file is kept and the others are acted
+	// upon
+	Act(ctx context.Context, in *ActRequest, opts ...grpc.CallOption) (*ActResponse, error)
+	// DeleteScan removes a scan, first cancelling it if it's running. Scans are removed anyway some time after they
+	// finish, as the server is configured to.
+	DeleteScan(ctx context.Context, in *DeleteScanRequest, opts ...grpc.CallOption) (*DeleteScanResponse, error)
+}
+
+type findDuplicatesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFindDuplicatesClient(cc grpc.ClientConnInterface) FindDuplicatesClient {
+	return &findDuplicatesClient{cc}
+}
+
+func (c *findDuplicatesClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FindDuplicates_ServiceDesc.Streams[0], FindDuplicates_Scan_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ScanRequest, ScanEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FindDuplicates_ScanClient = grpc.ServerStreamingClient[ScanEvent]
+
+func (c *findDuplicatesClient) GetProgress(ctx context.Context, in *GetProgressRequest, opts ...grpc.CallOption) (*Progress, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Progress)
+	err := c.cc.Invoke(ctx, FindDuplicates_GetProgress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *findDuplicatesClient) GetReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*Report, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Report)
+	err := c.cc.Invoke(ctx, FindDuplicates_GetReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *findDuplicatesClient) Act(ctx context.Context, in *ActRequest, opts ...grpc.CallOption) (*ActResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ActResponse)
+	err := c.cc.Invoke(ctx, FindDuplicates_Act_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *findDuplicatesClient) DeleteScan(ctx context.Context, in *DeleteScanRequest, opts ...grpc.CallOption) (*DeleteScanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteScanResponse)
+	err := c.cc.Invoke(ctx, FindDuplicates_DeleteScan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FindDuplicatesServer is the server API for FindDuplicates service.
+// All implementations must embed UnimplementedFindDuplicatesServer
+// for forward compatibility.
+//
+// FindDuplicates runs scans for duplicate files on the host of the server
+type FindDuplicatesServer interface {
+	// Scan starts a scan, and streams groups of duplicates as they're confirmed. The first event has the ID of the scan,
+	// and the last one its final progress. The scan goes on even if the stream is cancelled, so that it can be looked up
+	// later by its ID.
+	Scan(*ScanRequest, grpc.ServerStreamingServer[ScanEvent]) error
+	// GetProgress returns progress of a scan
+	GetProgress(context.Context, *GetProgressRequest) (*Progress, error)
+	// GetReport returns all groups of duplicates of a scan that has completed
+	GetReport(context.Context, *GetReportRequest) (*Report, error)
+	// Act acts upon duplicates of a scan that has completed: in each group, one file is kept and the others are acted
+	// upon
+	Act(context.Context, *ActRequest) (*ActResponse, error)
+	// DeleteScan removes a scan, first cancelling it if it's running. Scans are removed anyway some time after they
+	// finish, as the server is configured to.
+	DeleteScan(context.Context, *DeleteScanRequest) (*DeleteScanResponse, error)
+	mustEmbedUnimplementedFindDuplicatesServer()
+}
+
+// UnimplementedFindDuplicatesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFindDuplicatesServer struct{}
+
+func (UnimplementedFindDuplicatesServer) Scan(*ScanRequest, grpc.ServerStreamingServer[ScanEvent]) error {
+	return status.Error(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedFindDuplicatesServer) GetProgress(context.Context, *GetProgressRequest) (*Progress, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetProgress not implemented")
+}
+func (UnimplementedFindDuplicatesServer) GetReport(context.Context, *GetReportRequest) (*Report, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetReport not implemented")
+}
+func (UnimplementedFindDuplicatesServer) Act(context.Context, *ActRequest) (*ActResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Act not implemented")
+}
+func (UnimplementedFindDuplicatesServer) DeleteScan(context.Context, *DeleteScanRequest) (*DeleteScanResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteScan not implemented")
+}
+func (UnimplementedFindDuplicatesServer) mustEmbedUnimplementedFindDuplicatesServer() {}
+func (UnimplementedFindDuplicatesServer) testEmbeddedByValue()                        {}
+
+// UnsafeFindDuplicatesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FindDuplicatesServer will
+// result in compilation errors.
+type UnsafeFindDuplicatesServer interface {
+	mustEmbedUnimplementedFindDuplicatesServer()
+}
+
+func RegisterFindDuplicatesServer(s grpc.ServiceRegistrar, srv FindDuplicatesServer) {
+	// If the following call panics, it indicates UnimplementedFindDuplicatesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FindDuplicates_ServiceDesc, srv)
+}
+
+func _FindDuplicates_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FindDuplicatesServer).Scan(m, &grpc.GenericServerStream[ScanRequest, ScanEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FindDuplicates_ScanServer = grpc.ServerStreamingServer[ScanEvent]
+
+func _FindDuplicates_GetProgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FindDuplicatesServer).GetProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FindDuplicates_GetProgress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FindDuplicatesServer).GetProgress(ctx, req.(*GetProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FindDuplicates_GetReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FindDuplicatesServer).GetReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FindDuplicates_GetReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FindDuplicatesServer).GetReport(ctx, req.(*GetReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FindDuplicates_Act_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ActRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FindDuplicatesServer).Act(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FindDuplicates_Act_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FindDuplicatesServer).Act(ctx, req.(*ActRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FindDuplicates_DeleteScan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FindDuplicatesServer).DeleteScan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FindDuplicates_DeleteScan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FindDuplicatesServer).DeleteScan(ctx, req.(*DeleteScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FindDuplicates_ServiceDesc is the grpc.ServiceDesc for FindDuplicates service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FindDuplicates_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "finddup.v1.FindDuplicates",
+	HandlerType: (*FindDuplicatesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetProgress",
+			Handler:    _FindDuplicates_GetProgress_Handler,
+		},
+		{
+			MethodName: "GetReport",
+			Handler:    _FindDuplicates_GetReport_Handler,
+		},
+		{
+			MethodName: "Act",
+			Handler:    _FindDuplicates_Act_Handler,
+		},
+		{
+			MethodName: "DeleteScan",
+			Handler:    _FindDuplicates_DeleteScan_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _FindDuplicates_Scan_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "finddup/v1/finddup.proto",
+}
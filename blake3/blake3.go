@@ -0,0 +1,243 @@
+// Package blake3 is a pure Go implementation of the BLAKE3 cryptographic hash function (in hashing mode, with
+// 256-bit output), written after the reference implementation.
+//
+// See: https://github.com/BLAKE3-team/BLAKE3-specs
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Size is the size of a BLAKE3 checksum in bytes
+const Size = 32
+
+// BlockSize is the block size of BLAKE3 in bytes
+const BlockSize = 64
+
+const (
+	chunkLen   = 1024
+	chunkStart = 1 << 0
+	chunkEnd   = 1 << 1
+	parent     = 1 << 2
+	root       = 1 << 3
+)
+
+var iv = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func g(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] = s[a] + s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] = s[a] + s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func round(s *[16]uint32, m *[16]uint32) {
+	g(s, 0, 4, 8, 12, m[0], m[1])
+	g(s, 1, 5, 9, 13, m[2], m[3])
+	g(s, 2, 6, 10, 14, m[4], m[5])
+	g(s, 3, 7, 11, 15, m[6], m[7])
+	g(s, 0, 5, 10, 15, m[8], m[9])
+	g(s, 1, 6, 11, 12, m[10], m[11])
+	g(s, 2, 7, 8, 13, m[12], m[13])
+	g(s, 3, 4, 9, 14, m[14], m[15])
+}
+
+func compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen uint32, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := *block
+	for r := 0; r < 7; r++ {
+		round(&s, &m)
+		if r < 6 {
+			var permuted [16]uint32
+			for i, p := range msgPermutation {
+				permuted[i] = m[p]
+			}
+			m = permuted
+		}
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+func first8(words [16]uint32) (cv [8]uint32) {
+	copy(cv[:], words[:8])
+	return cv
+}
+
+func wordsFromBlock(block *[BlockSize]byte) (words [16]uint32) {
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	return words
+}
+
+// output is the state just before the final compression of a node, from which either a chaining value or
+// the root hash can be derived
+type output struct {
+	inputCV  [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *output) chainingValue() [8]uint32 {
+	return first8(compress(&o.inputCV, &o.block, o.counter, o.blockLen, o.flags))
+}
+
+func (o *output) rootBytes(out []byte) {
+	words := compress(&o.inputCV, &o.block, 0, o.blockLen, o.flags|root)
+	for i := 0; i < Size/4; i++ {
+		binary.LittleEndian.PutUint32(out[4*i:], words[i])
+	}
+}
+
+func parentOutput(left, right [8]uint32) output {
+	o := output{inputCV: iv, blockLen: BlockSize, flags: parent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+type chunkState struct {
+	cv               [8]uint32
+	chunkCounter     uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(chunkCounter uint64) chunkState {
+	return chunkState{cv: iv, chunkCounter: chunkCounter}
+}
+
+func (c *chunkState) len() int {
+	return BlockSize*c.blocksCompressed + c.blockLen
+}
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return chunkStart
+	}
+	return 0
+}
+
+func (c *chunkState) update(input []byte) {
+	for len(input) > 0 {
+		if c.blockLen == BlockSize {
+			words := wordsFromBlock(&c.block)
+			c.cv = first8(compress(&c.cv, &words, c.chunkCounter, BlockSize, c.startFlag()))
+			c.blocksCompressed++
+			c.block = [BlockSize]byte{}
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], input)
+		c.blockLen += n
+		input = input[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	return output{
+		inputCV:  c.cv,
+		block:    wordsFromBlock(&c.block),
+		counter:  c.chunkCounter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.startFlag() | chunkEnd,
+	}
+}
+
+// digest is an incremental BLAKE3 hasher that implements hash.Hash
+type digest struct {
+	chunk   chunkState
+	cvStack [][8]uint32
+}
+
+// New returns a new hash.Hash computing the BLAKE3 checksum
+func New() hash.Hash {
+	return &digest{chunk: newChunkState(0)}
+}
+
+// Sum256 returns the BLAKE3 checksum of the data
+func Sum256(data []byte) (sum [Size]byte) {
+	d := New()
+	_, _ = d.Write(data)
+	d.Sum(sum[:0])
+	return sum
+}
+
+func (d *digest) addChunkChainingValue(cv [8]uint32, totalChunks uint64) {
+	// Merge completed subtrees: the number of trailing zero bits of totalChunks is the number of merges due
+	for totalChunks&1 == 0 {
+		left := d.cvStack[len(d.cvStack)-1]
+		d.cvStack = d.cvStack[:len(d.cvStack)-1]
+		o := parentOutput(left, cv)
+		cv = o.chainingValue()
+		totalChunks >>= 1
+	}
+	d.cvStack = append(d.cvStack, cv)
+}
+
+// Write adds more data to the running hash. It never returns an error.
+func (d *digest) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if d.chunk.len() == chunkLen {
+			o := d.chunk.output()
+			totalChunks := d.chunk.chunkCounter + 1
+			d.addChunkChainingValue(o.chainingValue(), totalChunks)
+			d.chunk = newChunkState(totalChunks)
+		}
+		want := chunkLen - d.chunk.len()
+		if want > len(p) {
+			want = len(p)
+		}
+		d.chunk.update(p[:want])
+		p = p[want:]
+	}
+	return n, nil
+}
+
+// Sum appends the current hash to b and returns the resulting slice. It does not change the underlying hash state.
+func (d *digest) Sum(b []byte) []byte {
+	o := d.chunk.output()
+	for i := len(d.cvStack) - 1; i >= 0; i-- {
+		o = parentOutput(d.cvStack[i], o.chainingValue())
+	}
+	var out [Size]byte
+	o.rootBytes(out[:])
+	return append(b, out[:]...)
+}
+
+// Reset resets the hash to its initial state
+func (d *digest) Reset() {
+	d.chunk = newChunkState(0)
+	d.cvStack = d.cvStack[:0]
+}
+
+// Size returns the number of bytes Sum will return
+func (d *digest) Size() int {
+	return Size
+}
+
+// BlockSize returns the hash's underlying block size
+func (d *digest) BlockSize() int {
+	return BlockSize
+}
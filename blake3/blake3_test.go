@@ -0,0 +1,51 @@
+package blake3
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testInput generates input of the given length in the format used by the official BLAKE3 test vectors
+func testInput(n int) []byte {
+	input := make([]byte, n)
+	for i := range input {
+		input[i] = byte(i % 251)
+	}
+	return input
+}
+
+func TestSum256(t *testing.T) {
+	tests := map[int]string{
+		0:    "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+		1:    "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213",
+		1024: "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7",
+		1025: "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444",
+		2048: "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a",
+	}
+	for n, expected := range tests {
+		sum := Sum256(testInput(n))
+		assert.Equal(t, expected, hex.EncodeToString(sum[:]), "input length %d", n)
+	}
+	abc := Sum256([]byte("abc"))
+	assert.Equal(t, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", hex.EncodeToString(abc[:]))
+}
+
+func TestIncrementalWrites(t *testing.T) {
+	input := testInput(100_000)
+	expected := Sum256(input)
+	d := New()
+	for p := input; len(p) > 0; {
+		n := len(p)
+		if n > 777 {
+			n = 777
+		}
+		_, _ = d.Write(p[:n])
+		p = p[n:]
+	}
+	assert.Equal(t, expected[:], d.Sum(nil))
+	d.Reset()
+	_, _ = d.Write(input)
+	assert.Equal(t, expected[:], d.Sum(nil))
+}
@@ -1,10 +1,15 @@
 // Package bytesutil helps you convert byte sizes (such as  file size, data uploaded/downloaded etc.) to
-// human-readable strings. This allows conversion to decimal and binary formats.
+// human-readable strings, and back. This allows conversion to decimal and binary formats.
 //
 // See: https://en.m.wikipedia.org/wiki/Byte#Multiple-byte_units
 package bytesutil
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 // Constants for byte sizes in decimal and binary formats
 const (
@@ -89,3 +94,33 @@ func DecimalFormat(size int64) string {
 
 	return fmt.Sprintf("%.2f EB", float64(size)/float64(EXA))
 }
+
+// units are multiples of bytes by their suffixes (in upper case). Suffixes of single letters are binary.
+var units = map[string]int64{
+	"": 1, "B": 1,
+	"K": KIBI, "KIB": KIBI, "KB": KILO,
+	"M": MEBI, "MIB": MEBI, "MB": MEGA,
+	"G": GIBI, "GIB": GIBI, "GB": GIGA,
+	"T": TEBI, "TIB": TEBI, "TB": TERA,
+	"P": PEBI, "PIB": PEBI, "PB": PETA,
+}
+
+// ParseSize parses a human-readable byte size, such as "2GiB", "512 MiB", "1.5G" (same as "1.5GiB") or "100MB"
+// (decimal), to a number of bytes. Sizes without units are in bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i == -1 {
+		i = len(s)
+	}
+	unit, exists := units[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if !exists || err != nil {
+		return 0, fmt.Errorf("invalid size %q (e.g. 512MiB, 2GiB or 100MB)", s)
+	}
+	size := value * float64(unit)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(size), nil
+}
@@ -20,3 +20,23 @@ func TestFormats(t *testing.T) {
 		assert.Equal(t, expectedValues[1], DecimalFormat(value))
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"2GiB":    2 * GIBI,
+		"512 MiB": 512 * MEBI,
+		"1.5G":    GIBI + GIBI/2,
+		"100MB":   100 * MEGA,
+		"4k":      4 * KIBI,
+		"2048":    2048,
+		"0B":      0,
+	} {
+		size, err := ParseSize(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, size, s)
+	}
+	for _, s := range []string{"", "GiB", "2 GiBs", "-1G", "1..5G", "99999999PiB"} {
+		_, err := ParseSize(s)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+// runApply runs the "apply" subcommand, which acts upon duplicates of a report in json (of -o json), once they're
+// verified to still be what the report has them as
+func runApply(args []string) {
+	fs := flag.NewFlagSet(applyCommand, flag.ContinueOnError)
+	remove := fs.BoolP("remove", "X", false, "delete duplicates (all files of each group except the one kept)")
+	trash := fs.Bool("trash", false, "move duplicates to trash instead of deleting them (with --remove)")
+	linkType := fs.String("link", "",
+		fmt.Sprintf("replace duplicates with links of the type to the file kept, one of: %s, %s, %s",
+			actions.Hardlink, actions.Symlink, actions.Reflink))
+	hash := fs.StringP("hash", "a", service.DefaultHasher.Name(),
+		"hashing algorithm of the scan of reports that don't have it (of earlier versions), one of: "+
+			strings.Join(service.HasherNames(), ", "))
+	getOptions, getNaming := setupActOnManifestOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s deletes duplicates of a report of a scan in json (of -o json), or replaces them
+with links, without scanning again. Every file of the report is verified first, by the hashing algorithm
+of the report: files that don't exist anymore, or whose size or hashes aren't those of the report, are
+left alone, and so are groups left with fewer than 2 files. Reports can then be reviewed, and applied
+safely later.
+
+Usage:
+  go-find-duplicates %s --remove|--link <type> [flags] <report.json>
+`, applyCommand, applyCommand))
+	if fs.NArg() != 1 {
+		fmte.PrintfErr("error: exactly one report should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	var action actions.Action
+	switch {
+	case *remove && *linkType != "":
+		fmte.PrintfErr("error: only one of --remove and --link should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidAction)
+	case *remove && *trash:
+		action = actions.Trash
+	case *remove:
+		action = actions.Delete
+	case *linkType != "":
+		var err error
+		action, err = actions.ActionByName(strings.ToLower(strings.TrimSpace(*linkType)))
+		if err != nil || (action != actions.Hardlink && action != actions.Symlink && action != actions.Reflink) {
+			fmte.PrintfErr("error: unknown type of links %q\n", *linkType)
+			fs.Usage()
+			os.Exit(exitCodeInvalidAction)
+		}
+	default:
+		fmte.PrintfErr("error: one of --remove and --link should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidAction)
+	}
+	opts := getOptions(action)
+	groups := loadReport(fs.Arg(0))
+	name, err := reportAlgorithm(groups, strings.ToLower(strings.TrimSpace(*hash)), fs.Changed("hash"))
+	var hasher service.Hasher
+	if err == nil {
+		hasher, err = service.HasherByName(name)
+	}
+	if err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		os.Exit(exitCodeInvalidHashAlgorithm)
+	}
+	fmte.Printf("Verifying %d groups of duplicates of the report (using %s hash)...\n", len(groups), hasher.Name())
+	duplicates, files := verifiedDuplicates(context.Background(), vfs.Local, groups, hasher)
+	applyToDuplicates(duplicates, files, opts, getNaming)
+}
+
+// loadReport loads groups of duplicates of a report in json, exiting if it can't be
+func loadReport(path string) []reportGroup {
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		var groups []reportGroup
+		if err = json.NewDecoder(f).Decode(&groups); err == nil {
+			return groups
+		}
+	}
+	fmte.PrintfErr("error: couldn't load report: %+v\n", err)
+	os.Exit(exitCodeInvalidReport)
+	return nil
+}
+
+// reportAlgorithm returns the hashing algorithm of groups of a report, or hash for reports that don't have it (of
+// earlier versions). Reports hashed by algorithms other than hash, if it's explicitly set, are refused, and so are
+// reports of groups hashed by different algorithms.
+func reportAlgorithm(groups []reportGroup, hash string, isHashSet bool) (string, error) {
+	var algorithm string
+	for i, group := range groups {
+		if i == 0 {
+			algorithm = group.Algorithm
+		} else if group.Algorithm != algorithm {
+			return "", fmt.Errorf("groups of the report are hashed by both %q and %q", algorithm, group.Algorithm)
+		}
+	}
+	switch {
+	case algorithm == "":
+		return hash, nil
+	case isHashSet && hash != algorithm:
+		return "", fmt.Errorf("the report is hashed by %s, rather than by %s", algorithm, hash)
+	default:
+		return algorithm, nil
+	}
+}
+
+// verifiedDuplicates returns groups of duplicates of a report without files that aren't as the report has them
+// anymore (see verifyFile), which are logged, along with metadata of files left. Files of groups of sampled hashes
+// (without strong hashes) whose modification times the report doesn't have, say of reports of earlier versions, could
+// have been changed since outside the bytes that were sampled, so they're hashed entirely (see verifyEntirely) too.
+func verifiedDuplicates(ctx context.Context, fsys vfs.FS, groups []reportGroup, hasher service.Hasher,
+) (*entity.DigestToFiles, entity.FilePathToMeta) {
+	duplicates := entity.NewDigestToFiles()
+	files := entity.FilePathToMeta{}
+	for _, group := range groups {
+		var verified []string
+		isTimed := true
+		for _, path := range group.Paths {
+			meta, err := verifyFile(ctx, fsys, path, group.FileDigest, group.Modified[path], hasher)
+			if err != nil {
+				fmte.PrintfErr("skipping %s, which changed since the report: %v\n", path, err)
+				continue
+			}
+			verified = append(verified, path)
+			files[path] = meta
+			isTimed = isTimed && !group.Modified[path].IsZero()
+		}
+		if len(verified) < 2 {
+			continue
+		}
+		if group.IsStrong() || isTimed || !service.IsSampled(hasher.Name()) {
+			for _, path := range verified {
+				duplicates.Set(group.FileDigest, path)
+			}
+			continue
+		}
+		for digest, paths := range verifyEntirely(ctx, fsys, group.FileDigest, verified) {
+			if len(paths) < 2 {
+				continue
+			}
+			for _, path := range paths {
+				duplicates.Set(digest, path)
+			}
+		}
+	}
+	return duplicates, files
+}
+
+// verifyEntirely hashes files of a group of the digest entirely, by sha256, and returns them by their digests of the
+// hashes, so that only files of the same contents are grouped together. Files that can't be read are logged and left
+// out.
+func verifyEntirely(ctx context.Context, fsys vfs.FS, digest entity.FileDigest, paths []string,
+) map[entity.FileDigest][]string {
+	byDigest := map[entity.FileDigest][]string{}
+	for _, path := range paths {
+		strong, err := service.UpgradeDigest(ctx, fsys, path, digest, service.SHA256Hasher{})
+		if err != nil {
+			fmte.PrintfErr("skipping %s, which couldn't be hashed entirely: %v\n", path, err)
+			continue
+		}
+		byDigest[strong] = append(byDigest[strong], path)
+	}
+	return byDigest
+}
+
+// verifyFile checks whether the file still exists, and is of the size, modification time (unless modified is the
+// zero time) and hashes of digest (of the report), by hashing it again by hasher (and by the strong algorithm of
+// digest, if it has a strong hash). It returns metadata of the file, or why it isn't as the report has it.
+func verifyFile(ctx context.Context, fsys vfs.FS, path string, digest entity.FileDigest, modified time.Time,
+	hasher service.Hasher,
+) (entity.FileMeta, error) {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return entity.FileMeta{}, err
+	}
+	if info.Size() != digest.FileSize {
+		return entity.FileMeta{}, fmt.Errorf("its size is %d bytes, rather than %d", info.Size(), digest.FileSize)
+	}
+	if !modified.IsZero() && !(entity.FileMeta{Modified: modified}).ModifiedAt(info.ModTime()) {
+		return entity.FileMeta{}, fmt.Errorf("it was last modified at %v, rather than at %v", info.ModTime(),
+			modified)
+	}
+	actual, err := service.GetDigest(ctx, fsys, path, hasher)
+	if err != nil {
+		return entity.FileMeta{}, err
+	}
+	if actual.FileHash != digest.FileHash {
+		return entity.FileMeta{}, fmt.Errorf("its %s hash is %s, rather than %s", hasher.Name(), actual.FileHash,
+			digest.FileHash)
+	}
+	if digest.IsStrong() {
+		strong, err := service.HasherByName(digest.StrongAlgorithm)
+		if err != nil {
+			return entity.FileMeta{}, err
+		}
+		if actual, err = service.UpgradeDigest(ctx, fsys, path, actual, strong); err != nil {
+			return entity.FileMeta{}, err
+		}
+		if actual.StrongHash != digest.StrongHash {
+			return entity.FileMeta{}, fmt.Errorf("its %s hash is %s, rather than %s", strong.Name(),
+				actual.StrongHash, digest.StrongHash)
+		}
+	}
+	return entity.FileMeta{Size: info.Size(), Modified: info.ModTime()}, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVerifiedDuplicates checks whether files that changed or vanished since the report are left out of groups, and
+// groups left with fewer than 2 files are left out altogether
+func TestVerifiedDuplicates(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	other := bytes.Repeat([]byte("different "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+		// Of the same size, but of other contents than when it was reported
+		"a/3.txt": {Data: other},
+		"b/4.txt": {Data: other},
+	})
+	digest, err := service.GetDigest(context.Background(), fsys, "a/1.txt", service.SHA256Hasher{})
+	assert.Nil(t, err)
+	otherDigest, err := service.GetDigest(context.Background(), fsys, "b/4.txt", service.SHA256Hasher{})
+	assert.Nil(t, err)
+	fmte.Off()
+	duplicates, files := verifiedDuplicates(context.Background(), fsys, []reportGroup{
+		{FileDigest: digest, Paths: []string{"a/1.txt", "a/2.txt", "a/3.txt", "a/vanished.txt"}},
+		{FileDigest: otherDigest, Paths: []string{"b/4.txt", "b/vanished.txt"}},
+	}, service.SHA256Hasher{})
+	assert.Equal(t, 1, duplicates.Size())
+	for d, paths := range duplicates.All() {
+		assert.Equal(t, digest, d)
+		assert.True(t, set.NewThreadUnsafeSet("a/1.txt", "a/2.txt").Equal(set.NewThreadUnsafeSet(paths...)))
+	}
+	assert.Len(t, files, 3)
+	assert.Equal(t, int64(len(content)), files["a/1.txt"].Size)
+	assert.Contains(t, files, "b/4.txt")
+}
+
+// TestVerifiedDuplicatesEntirely checks whether files of groups without strong hashes, whose modification times the
+// report doesn't have, are grouped by their entire contents
+func TestVerifiedDuplicatesEntirely(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	// Of the same crucial bytes (see service.SampledHasher), but not of the same contents
+	changed := bytes.Clone(content)
+	copy(changed[10_000:], bytes.Repeat([]byte("changed!! "), 200))
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":       {Data: content, ModTime: modified},
+		"a/2.txt":       {Data: content, ModTime: modified},
+		"a/changed.txt": {Data: changed, ModTime: modified},
+	})
+	ctx := context.Background()
+	hasher := service.SampledHasher{}
+	digest, err := service.GetDigest(ctx, fsys, "a/1.txt", hasher)
+	assert.Nil(t, err)
+	paths := []string{"a/1.txt", "a/2.txt", "a/changed.txt"}
+	fmte.Off()
+	duplicates, _ := verifiedDuplicates(ctx, fsys, []reportGroup{{FileDigest: digest, Paths: paths}}, hasher)
+	assert.Equal(t, 1, duplicates.Size())
+	for d, paths := range duplicates.All() {
+		assert.Equal(t, "sha256", d.StrongAlgorithm)
+		assert.True(t, set.NewThreadUnsafeSet("a/1.txt", "a/2.txt").Equal(set.NewThreadUnsafeSet(paths...)))
+	}
+
+	// Files of reports that have their modification times are verified by them instead
+	duplicates, _ = verifiedDuplicates(ctx, fsys, []reportGroup{{FileDigest: digest, Paths: paths,
+		Modified: map[string]time.Time{"a/1.txt": modified, "a/2.txt": modified, "a/changed.txt": modified}}}, hasher)
+	assert.Equal(t, 1, duplicates.Size())
+	for d, paths := range duplicates.All() {
+		assert.Equal(t, digest, d)
+		assert.Len(t, paths, 3)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	// Of the same crucial bytes (see service.SampledHasher), but not of the same contents
+	changed := bytes.Clone(content)
+	copy(changed[10_000:], bytes.Repeat([]byte("changed!! "), 200))
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":       {Data: content, ModTime: modified},
+		"a/short.txt":   {Data: content[:100]},
+		"a/changed.txt": {Data: changed},
+	})
+	ctx := context.Background()
+	hasher := service.SampledHasher{}
+	digest, err := service.GetDigest(ctx, fsys, "a/1.txt", hasher)
+	assert.Nil(t, err)
+	meta, err := verifyFile(ctx, fsys, "a/1.txt", digest, modified, hasher)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.FileMeta{Size: int64(len(content)), Modified: modified}, meta)
+
+	_, err = verifyFile(ctx, fsys, "a/missing.txt", digest, time.Time{}, hasher)
+	assert.NotNil(t, err)
+	_, err = verifyFile(ctx, fsys, "a/short.txt", digest, time.Time{}, hasher)
+	assert.ErrorContains(t, err, "its size is 100 bytes")
+	_, err = verifyFile(ctx, fsys, "a/1.txt", digest, time.Time{}, service.CRC32Hasher{})
+	assert.ErrorContains(t, err, "its crc32 hash is")
+	_, err = verifyFile(ctx, fsys, "a/1.txt", digest, modified.Add(time.Second), hasher)
+	assert.ErrorContains(t, err, "it was last modified at")
+
+	// Files of strong digests are verified by their full hashes too
+	strong, err := service.UpgradeDigest(ctx, fsys, "a/1.txt", digest, service.SHA256Hasher{})
+	assert.Nil(t, err)
+	_, err = verifyFile(ctx, fsys, "a/1.txt", strong, time.Time{}, hasher)
+	assert.Nil(t, err)
+	changedDigest, err := service.GetDigest(ctx, fsys, "a/changed.txt", hasher)
+	assert.Nil(t, err)
+	assert.Equal(t, digest.FileHash, changedDigest.FileHash)
+	_, err = verifyFile(ctx, fsys, "a/changed.txt", strong, time.Time{}, hasher)
+	assert.ErrorContains(t, err, "its sha256 hash is")
+	_, err = verifyFile(ctx, fsys, "a/changed.txt", digest, time.Time{}, hasher)
+	assert.Nil(t, err)
+}
+
+func TestReportAlgorithm(t *testing.T) {
+	sampled := reportGroup{Algorithm: "sampled"}
+	algorithm, err := reportAlgorithm([]reportGroup{sampled, sampled}, "sampled-crc32c", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "sampled", algorithm)
+	// Reports of earlier versions have no algorithm
+	algorithm, err = reportAlgorithm([]reportGroup{{}, {}}, "sha256", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256", algorithm)
+	_, err = reportAlgorithm([]reportGroup{sampled}, "sha256", true)
+	assert.ErrorContains(t, err, "hashed by sampled")
+	_, err = reportAlgorithm([]reportGroup{sampled, {Algorithm: "sha256"}}, "sampled", false)
+	assert.NotNil(t, err)
+}
+
+// TestReportWriterAlgorithm checks whether reports in json have the hashing algorithm of their groups, and
+// modification times of their files
+func TestReportWriterAlgorithm(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "report.json")
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	report, err := newReportWriter(entity.OutputModeJSON, name, "sampled-crc32c", "run", nil, timeFormat{},
+		func(path string) time.Time {
+			if path == "a/1.txt" {
+				return modified
+			}
+			return time.Time{}
+		})
+	assert.Nil(t, err)
+	digest := entity.FileDigest{FileExtension: "txt", FileHash: "fabcd", FileSize: 42}
+	report.writeGroup(digest, []string{"a/1.txt", "a/2.txt"})
+	assert.Nil(t, report.close())
+	fmte.Off()
+	// Files whose modification times aren't known have none in the report
+	assert.Equal(t, []reportGroup{{FileDigest: digest, Algorithm: "sampled-crc32c", Paths: []string{"a/1.txt",
+		"a/2.txt"}, Modified: map[string]time.Time{"a/1.txt": modified}}}, loadReport(name))
+}
@@ -0,0 +1,15 @@
+package main
+
+// Backends of remote storage that input directories can be URLs of
+import (
+	_ "github.com/m-manu/go-find-duplicates/vfs/azblob"
+	_ "github.com/m-manu/go-find-duplicates/vfs/dropbox"
+	_ "github.com/m-manu/go-find-duplicates/vfs/ftp"
+	_ "github.com/m-manu/go-find-duplicates/vfs/gcs"
+	_ "github.com/m-manu/go-find-duplicates/vfs/gdrive"
+	_ "github.com/m-manu/go-find-duplicates/vfs/onedrive"
+	_ "github.com/m-manu/go-find-duplicates/vfs/rclone"
+	_ "github.com/m-manu/go-find-duplicates/vfs/s3"
+	_ "github.com/m-manu/go-find-duplicates/vfs/smb"
+	_ "github.com/m-manu/go-find-duplicates/vfs/webdav"
+)
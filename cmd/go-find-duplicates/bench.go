@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/service"
+	flag "github.com/spf13/pflag"
+)
+
+const benchCommand = "bench"
+
+// runBench runs the "bench" subcommand, which measures how fast the storage of a directory can be scanned and
+// recommends settings for scanning it
+func runBench(args []string) {
+	fs := flag.NewFlagSet(benchCommand, flag.ContinueOnError)
+	sampleMiB := fs.Uint64("sample", uint64(service.DefaultBenchSampleSize/bytesutil.MEBI),
+		"amount of file data in MiB to read per hashing trial")
+	minSize := fs.Uint64P("minsize", "m", 4, "minimum size of file in KiB to consider")
+	isHelp := fs.BoolP("help", "h", false, "display help")
+	fs.Usage = func() {
+		fmte.PrintfErr("Run \"go-find-duplicates %s --help\" for usage\n", benchCommand)
+	}
+	if err := fs.Parse(args); err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *isHelp {
+		fs.SetOutput(os.Stdout)
+		fmte.Printf(`go-find-duplicates %s measures walk rate, stat rate and hash throughput on storage of a directory,
+and recommends settings for scanning it
+
+Usage:
+  go-find-duplicates %s [flags] <dir>
+
+Flags (all optional):
+`, benchCommand, benchCommand)
+		fs.PrintDefaults()
+		os.Exit(exitCodeSuccess)
+	}
+	if fs.NArg() != 1 {
+		fmte.PrintfErr("error: exactly one input directory should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	dir := fs.Arg(0)
+	if !utils.IsReadableDirectory(dir) {
+		fmte.PrintfErr("error: input \"%v\" isn't a readable directory\n", dir)
+		fs.Usage()
+		os.Exit(exitCodeInputDirectoryNotReadable)
+	}
+	dir, _ = filepath.Abs(dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defaultExclusions, _ := utils.LineSeparatedStrToMap(defaultExclusionsStr)
+	fmte.Printf("Benchmarking storage of \"%s\"...\n", dir)
+	result, err := service.Bench(ctx, service.NewOptions([]string{dir},
+		service.WithExcludedFiles(defaultExclusions),
+		service.WithFileSizeThreshold(int64(*minSize)*bytesutil.KIBI),
+	), int64(*sampleMiB)*bytesutil.MEBI)
+	if err != nil {
+		fmte.PrintfErr("error while benchmarking: %+v\n", err)
+		os.Exit(exitCodeBenchmarkFailed)
+	}
+	fmte.Printf("Walk: %d entries in %v (%.0f entries/s)\n", result.Entries, result.WalkTime,
+		result.EntriesPerSecond())
+	fmte.Printf("Stat: %d files in %v (%.0f files/s)\n", result.Files, result.StatTime, result.StatsPerSecond())
+	if len(result.Parallelism) == 0 {
+		fmte.Printf("No files large enough to measure hash throughput\n")
+		return
+	}
+	fmte.Printf("Hash throughput of %s by parallelism:\n", service.DefaultHasher.Name())
+	for _, t := range result.Parallelism {
+		fmte.Printf("%4d: %8.0f files/s\n", t.Parallelism, t.FilesPerSecond())
+	}
+	fmte.Printf("Hash throughput by algorithm, at parallelism %d:\n", result.RecommendedParallelism())
+	for _, t := range result.Algorithms {
+		fmte.Printf("%14s: %8.0f files/s, %s/s\n", t.Algorithm, t.FilesPerSecond(),
+			bytesutil.BinaryFormat(int64(t.BytesPerSecond())))
+	}
+	fmte.Printf("Recommended settings: --parallelism %d", result.RecommendedParallelism())
+	if sampled := result.FastestSampledHasher(); sampled != service.DefaultHasher.Name() {
+		fmte.Printf(" --hash %s", sampled)
+	}
+	if fastest := result.FastestFullHasher(); fastest != "" {
+		fmte.Printf(" (and --hash %s, if entire file contents are to be compared)", fastest)
+	}
+	fmte.Printf("\n")
+}
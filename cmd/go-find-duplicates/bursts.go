@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/bursts"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+const burstsCommand = "bursts"
+
+// runBursts runs the "bursts" subcommand, which finds bursts of photos, to be reviewed together rather than removed as
+// duplicates
+func runBursts(args []string) {
+	fs := flag.NewFlagSet(burstsCommand, flag.ContinueOnError)
+	window := fs.Duration("window", 2*time.Second,
+		"maximum time between photos of a burst, each taken after the previous one (as EXIF metadata has it)")
+	maxDistance := fs.Int("max-distance", 10,
+		"maximum number of bits (of 64) by which perceptual hashes of photos of a burst differ, each from that of\n"+
+			"the previous one: the lower, the more alike photos of bursts are")
+	outputMode := fs.StringP("output", "o", entity.OutputModeTextFile,
+		fmt.Sprintf("output mode, one of: %s, %s, %s, %s", entity.OutputModeTextFile, entity.OutputModeCsvFile,
+			entity.OutputModeJSON, entity.OutputModeStdOut))
+	workers := fs.IntP("parallelism", "p", service.DefaultParallelism(), "number of photos read concurrently")
+	getNaming := setupReportNamingOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s finds bursts of photos: photos (JPEGs) taken within moments of each other, as EXIF
+metadata has them, that look alike, as their perceptual hashes tell. Photos of a burst aren't duplicates,
+and aren't acted upon: they're grouped to be reviewed together, so that the best of them are kept.
+
+Usage:
+  go-find-duplicates %s [flags] <dir-1> <dir-2> ... <dir-n>
+`, burstsCommand, burstsCommand))
+	if fs.NArg() < 1 {
+		fmte.PrintfErr("error: no directories passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *window <= 0 || *maxDistance < 0 || *maxDistance > 64 {
+		fmte.PrintfErr("error: --window should be positive, and --max-distance between 0 and 64\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidBurstOpts)
+	}
+	switch *outputMode {
+	case entity.OutputModeTextFile, entity.OutputModeCsvFile, entity.OutputModeJSON, entity.OutputModeStdOut:
+	default:
+		fmte.PrintfErr("error: invalid output mode '%s'\n", *outputMode)
+		fs.Usage()
+		os.Exit(exitCodeInvalidOutputMode)
+	}
+	naming := getNaming()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmte.Printf("Reading photos of %d directories...\n", fs.NArg())
+	skipped := 0
+	photos, err := bursts.Collect(ctx, vfs.Local, fs.Args(), *workers, func(path string, err error) {
+		skipped++
+		fmte.PrintfErr("skipping %s: %v\n", path, err)
+	})
+	if errors.Is(err, context.Canceled) {
+		fmte.Printf("Scan cancelled.\n")
+		os.Exit(exitCodeScanInterrupted)
+	} else if err != nil {
+		fmte.PrintfErr("error: couldn't read directories: %+v\n", err)
+		os.Exit(exitCodeInputDirectoryNotReadable)
+	}
+	fmte.Printf("Read %d photos, %d skipped.\n", len(photos), skipped)
+	found := bursts.Find(photos, *window, *maxDistance)
+	if len(found) == 0 {
+		fmte.Printf("No bursts found!\n")
+		return
+	}
+	inBursts := 0
+	for _, burst := range found {
+		inBursts += len(burst)
+	}
+	fmte.Printf("Found %d bursts of %d photos in all.\n", len(found), inBursts)
+	if err := reportBursts(found, *outputMode, naming, generateRunID()); err != nil {
+		fmte.PrintfErr("error while reporting bursts: %+v\n", err)
+		os.Exit(exitCodeWritingToReportFileFailed)
+	}
+}
+
+// reportBursts reports bursts of photos in the output mode, in a report file of the run (unless in mode stdout)
+func reportBursts(found []bursts.Burst, outputMode string, naming reportNaming, runID string) error {
+	var bb bytes.Buffer
+	reportFileName := naming.fileName(reportKindBursts, runID, ".txt")
+	switch outputMode {
+	case entity.OutputModeCsvFile:
+		reportFileName = naming.fileName(reportKindBursts, runID, ".csv")
+		cf := csv.NewWriter(&bb)
+		cf.Write([]string{"burst", "file path", "taken at"})
+		for i, burst := range found {
+			for _, photo := range burst {
+				cf.Write([]string{strconv.Itoa(i + 1), photo.Path, photo.TakenAt.Format(time.RFC3339Nano)})
+			}
+		}
+		cf.Flush()
+	case entity.OutputModeJSON:
+		reportFileName = naming.fileName(reportKindBursts, runID, ".json")
+		jsonBytes, _ := json.Marshal(found)
+		bb.Write(jsonBytes)
+	default:
+		for _, burst := range found {
+			bb.WriteString(fmt.Sprintf("Burst of %d photos taken within %s, from %s:\n", len(burst), burst.Span(),
+				burst[0].TakenAt.Format(time.DateTime)))
+			for _, photo := range burst {
+				bb.WriteString(fmt.Sprintf("\t%s\n", photo.Path))
+			}
+		}
+	}
+	if outputMode == entity.OutputModeStdOut {
+		fmt.Print(bb.String())
+		return nil
+	}
+	if err := writeReportFile(reportFileName, bb.Bytes()); err != nil {
+		return err
+	}
+	fmte.Printf("View report of bursts here: %s\n", reportFileName)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+const cacheCommand = "cache"
+
+// runCache runs the "cache" subcommand, which maintains files of hashes cached by --cache
+func runCache(args []string) {
+	fs := flag.NewFlagSet(cacheCommand, flag.ContinueOnError)
+	isDryRun := setupDryRunOpt(fs)
+	getNaming := setupReportNamingOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s maintains a file of hashes cached by --cache
+
+Usage:
+  go-find-duplicates %s stats <cache>  # counts cached hashes, by hashing algorithm
+  go-find-duplicates %s prune <cache>  # removes hashes of local files that were deleted or modified since
+  go-find-duplicates %s clear <cache>  # removes all hashes
+`, cacheCommand, cacheCommand, cacheCommand, cacheCommand))
+	if fs.NArg() != 2 {
+		fmte.PrintfErr("error: an operation and a cache should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	operation, path := fs.Arg(0), fs.Arg(1)
+	if operation != "stats" && operation != "prune" && operation != "clear" {
+		fmte.PrintfErr("error: unknown operation %q\n", operation)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if _, err := os.Stat(path); err != nil {
+		// Opening the cache would create it otherwise
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeInvalidCache)
+	}
+	store, err := digestcache.OpenBolt(path)
+	if err != nil {
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeInvalidCache)
+	}
+	defer store.Close()
+	switch operation {
+	case "stats":
+		counts, err := digestcache.Count(store)
+		if err != nil {
+			fmte.PrintfErr("error: couldn't read cache: %+v\n", err)
+			os.Exit(exitCodeInvalidCache)
+		}
+		algorithms := make([]string, 0, len(counts))
+		total := 0
+		for algorithm, count := range counts {
+			algorithms = append(algorithms, algorithm)
+			total += count
+		}
+		sort.Strings(algorithms)
+		for _, algorithm := range algorithms {
+			fmte.Printf("%s: %d hashes\n", algorithm, counts[algorithm])
+		}
+		fmte.Printf("Total: %d hashes\n", total)
+	case "prune":
+		removed := pruneCache(store, func(key digestcache.Key, entry digestcache.Entry) bool {
+			if vfs.IsURL(key.Path) || key.FS != "" && !key.IsCohort() {
+				// Files of remote storage (or of file systems of programs using the cache) can't be checked from here
+				return true
+			}
+			info, statErr := os.Stat(key.Path)
+			return statErr == nil && entry.Matches(info)
+		}, isDryRun(), getNaming)
+		fmte.Printf("%s %d hashes of files that were deleted or modified.\n", removedOrWouldBe(isDryRun()), removed)
+	case "clear":
+		removed := pruneCache(store, func(digestcache.Key, digestcache.Entry) bool { return false }, isDryRun(),
+			getNaming)
+		fmte.Printf("%s %d hashes.\n", removedOrWouldBe(isDryRun()), removed)
+	}
+}
+
+// pruneCache removes hashes of store that keep doesn't keep, returning how many were removed, or (if it's a dry run)
+// would be, which is saved to a report named by getNaming
+func pruneCache(store digestcache.Store, keep func(digestcache.Key, digestcache.Entry) bool, dryRun bool,
+	getNaming func() reportNaming) int {
+	if !dryRun {
+		removed, err := store.Prune(keep)
+		if err != nil {
+			fmte.PrintfErr("error: couldn't prune cache: %+v\n", err)
+			os.Exit(exitCodeInvalidCache)
+		}
+		return removed
+	}
+	p := &plan{}
+	_, err := store.Prune(func(key digestcache.Key, entry digestcache.Entry) bool {
+		if !keep(key, entry) {
+			p.add("remove %s hash of %s", key.Algorithm, key.Path)
+		}
+		return true
+	})
+	if err != nil {
+		fmte.PrintfErr("error: couldn't read cache: %+v\n", err)
+		os.Exit(exitCodeInvalidCache)
+	}
+	savePlan(p, getNaming(), generateRunID())
+	return len(p.actions)
+}
+
+func removedOrWouldBe(dryRun bool) string {
+	if dryRun {
+		return "Would remove"
+	}
+	return "Removed"
+}
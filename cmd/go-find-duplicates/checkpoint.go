@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// saveCheckpoint saves hashes of files that an interrupted scan computed to a checkpoint of the run, which is a cache
+// of hashes as those of --cache are: the scan is resumed by running it again with the checkpoint as --cache, which
+// doesn't read files hashed already again (unless they changed since). It returns the name of the checkpoint, which
+// is empty if no file was hashed.
+func saveCheckpoint(naming reportNaming, runID string, algorithm string, result service.Result) (string, error) {
+	entries := make(map[digestcache.Key]digestcache.Entry, len(result.Digests))
+	for path, digest := range result.Digests {
+		meta, ok := result.AllFiles[path]
+		if !ok {
+			continue
+		}
+		entry := digestcache.Entry{Size: meta.Size, ModifiedTimestamp: meta.Modified.UnixNano(), Hash: digest.FileHash}
+		entries[digestcache.Key{Algorithm: algorithm, Path: path}] = entry
+		if digest.IsStrong() {
+			entry.Hash = digest.StrongHash
+			entries[digestcache.Key{Algorithm: digest.StrongAlgorithm, Path: path}] = entry
+		}
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	// As report files are, the checkpoint is written to a temporary file that's renamed once it's complete
+	fileName := naming.fileName(reportKindCheckpoint, runID, ".db")
+	tempName := reportTempName(fileName)
+	err := digestcache.WriteBolt(tempName, entries)
+	if err == nil {
+		err = os.Rename(tempName, fileName)
+	}
+	if err != nil {
+		_ = os.Remove(tempName)
+		return "", err
+	}
+	return fileName, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+// Subcommands of scans, and of acting upon and analysing scans that were saved by --manifest (or reported in json)
+const (
+	scanCommand   = "scan"
+	reportCommand = "report"
+	removeCommand = "remove"
+	linkCommand   = "link"
+	diffCommand   = "diff"
+	applyCommand  = "apply"
+	mergeCommand  = "merge"
+)
+
+// parseCommand parses arguments of a subcommand by fs (adding --help to its flags), and prints help, which
+// precedes descriptions of the flags, and exits if that's asked for
+func parseCommand(fs *flag.FlagSet, args []string, help string) {
+	isHelp := fs.BoolP("help", "h", false, "display help")
+	fs.Usage = func() {
+		fmte.PrintfErr("Run \"go-find-duplicates %s --help\" for usage\n", fs.Name())
+	}
+	if err := fs.Parse(args); err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *isHelp {
+		fs.SetOutput(os.Stdout)
+		fmte.Printf("%s", help)
+		fmte.Printf("\nFlags (all optional):\n")
+		fs.PrintDefaults()
+		os.Exit(exitCodeSuccess)
+	}
+}
+
+// loadManifest loads a manifest saved by --manifest, exiting if it can't be
+func loadManifest(path string) *entity.Manifest {
+	m, err := entity.LoadManifest(path)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't load manifest: %+v\n", err)
+		os.Exit(exitCodeInvalidManifest)
+	}
+	return m
+}
+
+// runReport runs the "report" subcommand, which reports duplicates of a saved scan again, e.g. in another output mode
+func runReport(args []string) {
+	fs := flag.NewFlagSet(reportCommand, flag.ContinueOnError)
+	output := fs.StringP("output", "o", entity.OutputModeTextFile,
+		"output mode of the report, one of: "+strings.Join(outputModeNames(), ", "))
+	getNaming := setupReportNamingOpts(fs)
+	getTimeFormat := setupTimeFormatOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s reports duplicates of a scan saved by --manifest again (e.g. in another
+output mode), without scanning again
+
+Usage:
+  go-find-duplicates %s [flags] <manifest>
+`, reportCommand, reportCommand))
+	if fs.NArg() != 1 {
+		fmte.PrintfErr("error: exactly one manifest should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	outputMode := strings.ToLower(strings.TrimSpace(*output))
+	if _, exists := entity.OutputModes[outputMode]; !exists {
+		fmte.PrintfErr("error: invalid output mode '%s'\n", outputMode)
+		os.Exit(exitCodeInvalidOutputMode)
+	}
+	m := loadManifest(fs.Arg(0))
+	runID := m.Run.RunID
+	if runID == "" {
+		runID = generateRunID()
+	}
+	if outputMode == entity.OutputModeSHA256Sum && m.Run.Algorithm != (service.SHA256Hasher{}).Name() {
+		fmte.PrintfErr("error: output mode %s needs a scan by %s, not %s\n", outputMode,
+			service.SHA256Hasher{}.Name(), m.Run.Algorithm)
+		os.Exit(exitCodeInvalidOutputMode)
+	}
+	reportFileName, err := checkReportFileIfApplicable(getNaming(), runID, outputMode)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't create report file: %+v\n", err)
+		os.Exit(exitCodeReportFileCreationFailed)
+	}
+	if outputMode == entity.OutputModeSHA256Sum {
+		if err := writeChecksums(reportFileName, m.Digests); err != nil {
+			fmte.PrintfErr("error while writing checksums: %+v\n", err)
+			os.Exit(exitCodeWritingToReportFileFailed)
+		}
+		fmte.Printf("Checksums of %d files saved here: %s\n", len(m.Digests), reportFileName)
+		return
+	}
+	duplicates := m.Duplicates()
+	if duplicates.Size() == 0 {
+		fmte.Printf("No duplicates found!\n")
+		return
+	}
+	count, savings := 0, int64(0)
+	for _, group := range m.Groups {
+		count += len(group.Paths) - 1
+		savings += int64(len(group.Paths)-1) * group.Digest.FileSize
+	}
+	fmte.Printf("Found %d duplicates. A total of %s can be saved by removing them.\n", count,
+		bytesutil.BinaryFormat(savings))
+	if err := reportDuplicates(duplicates, outputMode, m.Files, m.Run.Algorithm, runID, m.Run.Labels,
+		getTimeFormat(), reportFileName); err != nil {
+		fmte.PrintfErr("error while reporting to file: %+v\n", err)
+		os.Exit(exitCodeWritingToReportFileFailed)
+	}
+}
+
+// outputModeNames returns names of output modes, sorted
+func outputModeNames() []string {
+	names := make([]string, 0, len(entity.OutputModes))
+	for outputMode := range entity.OutputModes {
+		names = append(names, outputMode)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runRemove runs the "remove" subcommand, which deletes (or trashes) duplicates of a saved scan
+func runRemove(args []string) {
+	fs := flag.NewFlagSet(removeCommand, flag.ContinueOnError)
+	trash := fs.Bool("trash", false, "move duplicates to trash instead of deleting them")
+	getOptions, getNaming := setupActOnManifestOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s deletes duplicates of a scan saved by --manifest (all files of each
+group except the one kept), without scanning again. Files that changed since the scan are left alone.
+
+Usage:
+  go-find-duplicates %s [flags] <manifest>
+`, removeCommand, removeCommand))
+	action := actions.Delete
+	if *trash {
+		action = actions.Trash
+	}
+	actOnManifest(fs, getOptions(action), getNaming)
+}
+
+// runLink runs the "link" subcommand, which replaces duplicates of a saved scan with links to the copy kept
+func runLink(args []string) {
+	fs := flag.NewFlagSet(linkCommand, flag.ContinueOnError)
+	linkType := fs.String("type", actions.Hardlink.String(),
+		fmt.Sprintf("type of links, one of: %s, %s, %s", actions.Hardlink, actions.Symlink, actions.Reflink))
+	getOptions, getNaming := setupActOnManifestOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s replaces duplicates of a scan saved by --manifest with links to the file
+kept of each group, without scanning again. Files that changed since the scan are left alone.
+
+Usage:
+  go-find-duplicates %s [flags] <manifest>
+`, linkCommand, linkCommand))
+	action, err := actions.ActionByName(strings.ToLower(strings.TrimSpace(*linkType)))
+	if err != nil || (action != actions.Hardlink && action != actions.Symlink && action != actions.Reflink) {
+		fmte.PrintfErr("error: unknown type of links %q\n", *linkType)
+		fs.Usage()
+		os.Exit(exitCodeInvalidAction)
+	}
+	actOnManifest(fs, getOptions(action), getNaming)
+}
+
+// setupActOnManifestOpts adds flags common to subcommands that act upon duplicates of saved scans. getOptions returns
+// options for action as per the flags, exiting if any is invalid.
+func setupActOnManifestOpts(fs *flag.FlagSet,
+) (getOptions func(action actions.Action) actions.Options, getNaming func() reportNaming) {
+	keep := fs.String("keep", "first",
+		"which file of a group of duplicates is kept, one of: "+strings.Join(actions.KeepPolicyNames(), ", "))
+	readOnly := fs.String("read-only", actions.ReadOnlyFail.String(), readOnlyUsage)
+	unlinkHardlinks := fs.Bool("unlink-hardlinks", false, unlinkHardlinksUsage)
+	minSize := fs.Uint64(actionMinSizeFlag, 1, actionMinSizeUsage)
+	isDryRun := setupDryRunOpt(fs)
+	getOptions = func(action actions.Action) actions.Options {
+		return actions.Options{Keep: parseKeepPolicy(fs, *keep), Action: action, DryRun: isDryRun(),
+			ReadOnly: parseReadOnlyPolicy(fs, *readOnly), UnlinkHardlinks: *unlinkHardlinks, MinSize: int64(*minSize)}
+	}
+	return getOptions, setupReportNamingOpts(fs)
+}
+
+// actOnManifest does opts.Action to duplicates of the manifest that fs has as its argument (or, if it's a dry run,
+// saves what would be done to a report named by getNaming)
+func actOnManifest(fs *flag.FlagSet, opts actions.Options, getNaming func() reportNaming) {
+	if fs.NArg() != 1 {
+		fmte.PrintfErr("error: exactly one manifest should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	m := loadManifest(fs.Arg(0))
+	duplicates := unchangedDuplicates(vfs.Local, m.Duplicates(), m.Files)
+	applyToDuplicates(duplicates, m.Files, opts, getNaming)
+}
+
+// parseKeepPolicy parses the keep policy of --keep of fs, exiting if it's invalid
+func parseKeepPolicy(fs *flag.FlagSet, keep string) actions.KeepPolicy {
+	policy, err := actions.KeepPolicyByName(strings.ToLower(strings.TrimSpace(keep)))
+	if err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidAction)
+	}
+	return policy
+}
+
+// readOnlyUsage is the usage of --read-only, of the root command and of subcommands alike
+var readOnlyUsage = "what is done to duplicates that are read-only, or protected by attributes (such as immutable\n" +
+	"files on Linux), one of: " + strings.Join(actions.ReadOnlyPolicyNames(), ", ")
+
+// unlinkHardlinksUsage is the usage of --unlink-hardlinks, of the root command and of subcommands alike
+const unlinkHardlinksUsage = "also act upon duplicates that are hard links of the file kept (other names of the\n" +
+	"same file, removing which reclaims no space), which are skipped otherwise"
+
+const (
+	actionMinSizeFlag = "action-min-size"
+	// actionMinSizeUsage is the usage of --action-min-size, of the root command and of subcommands alike
+	actionMinSizeUsage = "minimum size in bytes (rather than KiB, as of --minsize) of duplicates acted upon, however\n" +
+		"small those reported are: empty ones aren't by default (they're often placeholders), and are\n" +
+		"never replaced with links"
+)
+
+// parseReadOnlyPolicy parses the policy of --read-only of fs, exiting if it's invalid
+func parseReadOnlyPolicy(fs *flag.FlagSet, name string) actions.ReadOnlyPolicy {
+	policy, err := actions.ReadOnlyPolicyByName(strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidAction)
+	}
+	return policy
+}
+
+// applyToDuplicates does opts.Action to duplicates (of a saved scan or report), or, if it's a dry run, saves what
+// would be done to a report named by getNaming
+func applyToDuplicates(duplicates *entity.DigestToFiles, files entity.FilePathToMeta, opts actions.Options,
+	getNaming func() reportNaming,
+) {
+	if !checkTrashSpace(duplicates, files, opts) {
+		os.Exit(exitCodeInvalidAction)
+	}
+	report := actions.Apply(duplicates, files, opts)
+	printSkipped(report)
+	if opts.DryRun {
+		p := &plan{}
+		p.addReport(report)
+		fmte.Printf("Would apply %s on %d duplicates (%s).\n", opts.Action, report.Succeeded,
+			bytesutil.BinaryFormat(report.ReclaimedSize))
+		savePlan(p, getNaming(), generateRunID())
+		return
+	}
+	if err := report.Err(); err != nil {
+		fmte.PrintfErr("%s duplicates: %+v\n", opts.Action, err)
+	}
+	fmte.Printf("Applied %s on %d duplicates (%s), %d failed, %d skipped.\n", opts.Action, report.Succeeded,
+		bytesutil.BinaryFormat(report.ReclaimedSize), report.Failed, report.Skipped)
+	if report.Failed > 0 {
+		os.Exit(exitCodeActionFailed)
+	}
+}
+
+// printSkipped logs duplicates of report that were skipped, since they're read-only or hard links of files kept
+func printSkipped(report *actions.Report) {
+	for _, record := range report.Records {
+		if record.Skipped {
+			fmte.Printf("skipping %s: %v\n", record.Path, record.Err)
+		}
+	}
+}
+
+// unchangedDuplicates returns groups of duplicates (of a scan, or of a manifest), without files whose size or
+// modification time on fsys aren't those of the scan anymore (which are logged)
+func unchangedDuplicates(fsys vfs.FS, groups *entity.DigestToFiles, files entity.FilePathToMeta,
+) *entity.DigestToFiles {
+	duplicates, changed := actions.Unchanged(fsys, groups, files)
+	for _, path := range changed {
+		fmte.PrintfErr("skipping %s, which changed since the scan\n", path)
+	}
+	return duplicates
+}
+
+// runDiff runs the "diff" subcommand, which compares two saved scans
+func runDiff(args []string) {
+	fs := flag.NewFlagSet(diffCommand, flag.ContinueOnError)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s compares two scans saved by --manifest: which files were added,
+removed or modified, and which groups of duplicates are new or resolved
+
+Usage:
+  go-find-duplicates %s [flags] <older-manifest> <newer-manifest>
+`, diffCommand, diffCommand))
+	if fs.NArg() != 2 {
+		fmte.PrintfErr("error: exactly two manifests should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	diff, err := entity.DiffManifests(loadManifest(fs.Arg(0)), loadManifest(fs.Arg(1)))
+	if err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		os.Exit(exitCodeInvalidManifest)
+	}
+	// Titles are formats of the number of files or groups, so that they're translated
+	printPaths := func(title string, paths []string) {
+		fmte.Printf(title, len(paths))
+		for _, path := range paths {
+			fmte.Printf("\t%s\n", path)
+		}
+	}
+	printGroups := func(title string, groups []entity.DuplicateGroup) {
+		fmte.Printf(title, len(groups))
+		for _, group := range groups {
+			fmte.Printf("%s: %d duplicate(s)\n", group.Digest, len(group.Paths)-1)
+			for _, path := range group.Paths {
+				fmte.Printf("\t%s\n", path)
+			}
+		}
+	}
+	printPaths("Files added (%d):\n", diff.AddedFiles)
+	printPaths("Files removed (%d):\n", diff.RemovedFiles)
+	printPaths("Files modified (%d):\n", diff.ModifiedFiles)
+	printGroups("New groups of duplicates (%d):\n", diff.NewGroups)
+	printGroups("Resolved groups of duplicates (%d):\n", diff.ResolvedGroups)
+}
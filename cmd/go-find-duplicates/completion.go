@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/completion"
+	"github.com/m-manu/go-find-duplicates/internal/config"
+	"github.com/m-manu/go-find-duplicates/service"
+	flag "github.com/spf13/pflag"
+)
+
+const completionCommand = "completion"
+
+// profilesArg is the argument of the "completion" subcommand that lists profiles of the configuration file, for
+// scripts of completion to complete --profile with
+const profilesArg = "profiles"
+
+// runCompletion runs the "completion" subcommand, which generates scripts of completion of arguments for shells
+func runCompletion(args []string) {
+	fs := flag.NewFlagSet(completionCommand, flag.ContinueOnError)
+	isHelp := fs.BoolP("help", "h", false, "display help")
+	fs.Usage = func() {
+		fmte.PrintfErr("Run \"go-find-duplicates %s --help\" for usage\n", completionCommand)
+	}
+	if err := fs.Parse(args); err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *isHelp {
+		fs.SetOutput(os.Stdout)
+		fmte.Printf(`go-find-duplicates %s generates a script of completion of flags, output modes, profiles etc.
+for a shell
+
+Usage:
+  go-find-duplicates %s bash|zsh|fish|powershell
+
+e.g.:
+  source <(go-find-duplicates %s bash)                               # in ~/.bashrc
+  source <(go-find-duplicates %s zsh)                                # in ~/.zshrc
+  go-find-duplicates %s fish | source                                # in ~/.config/fish/config.fish
+  go-find-duplicates %s powershell | Out-String | Invoke-Expression  # in $PROFILE
+`, completionCommand, completionCommand, completionCommand, completionCommand, completionCommand,
+			completionCommand)
+		os.Exit(exitCodeSuccess)
+	}
+	if fs.NArg() != 1 {
+		fmte.PrintfErr("error: exactly one shell should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if fs.Arg(0) == profilesArg {
+		printProfiles()
+		return
+	}
+	if err := completion.Write(os.Stdout, fs.Arg(0), completionSpec()); err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+}
+
+// completionSpec returns what's completed for go-find-duplicates: its subcommands, and flags of scans
+func completionSpec() completion.Spec {
+	setupFlags()
+	outputModes := make([]string, 0, len(entity.OutputModes))
+	for outputMode := range entity.OutputModes {
+		outputModes = append(outputModes, outputMode)
+	}
+	sort.Strings(outputModes)
+	values := map[string][]string{
+		"output": outputModes,
+		"hash":   service.HasherNames(),
+		"verify": verifierNames(),
+		"action": actions.ActionNames(),
+		"keep":   actions.KeepPolicyNames(),
+		"preset": config.PresetNames(),
+	}
+	completed := completion.FromFlagSet(flag.CommandLine)
+	for i, f := range completed {
+		completed[i].Values = values[f.Name]
+		if f.Name == "profile" {
+			completed[i].ValuesCommand = "go-find-duplicates " + completionCommand + " " + profilesArg
+		}
+	}
+	return completion.Spec{
+		Program: "go-find-duplicates",
+		Commands: []string{applyCommand, benchCommand, burstsCommand, cacheCommand, completionCommand, configCommand,
+			diffCommand, layersCommand, linkCommand, mergeCommand, musicCommand, removeCommand, reportCommand,
+			scanCommand, selfUpdateCommand, serveCommand, wizardCommand},
+		Flags: completed,
+	}
+}
+
+// printProfiles prints names of profiles of the default configuration file, one per line (nothing if there's
+// no such file)
+func printProfiles() {
+	path, err := config.DefaultPath()
+	if err != nil {
+		return
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		return
+	}
+	for _, name := range c.ProfileNames() {
+		fmt.Println(name)
+	}
+}
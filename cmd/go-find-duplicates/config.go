@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	configCommand = "config"
+	// envPrefix is the prefix of environment variables that settings are read from
+	envPrefix = "FINDDUP_"
+)
+
+// runConfig runs the "config" subcommand, whose "show" prints settings of scans with the flags given (after "show"),
+// as resolved from defaults of flags, the preset, the configuration file (and profile) and the command line
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmte.PrintfErr("error: unknown operation of %s (only \"show\" is supported)\n", configCommand)
+		fmte.PrintfErr("Usage:\n  go-find-duplicates %s show [flags of scan]\n", configCommand)
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	setupFlags()
+	_ = flag.CommandLine.Parse(args[1:])
+	if flags.isHelp() {
+		fmte.Printf(`go-find-duplicates %s show prints settings that a scan with the same flags would have, as resolved
+from defaults of flags, the preset, the configuration file (and profile) and the command line, along with the
+exclusions and hashing algorithm they amount to
+
+Usage:
+  go-find-duplicates %s show [flags of scan]      # see "go-find-duplicates --help" for flags of scan
+`, configCommand, configCommand)
+		os.Exit(exitCodeSuccess)
+	}
+	onCommandLine := map[string]bool{}
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		onCommandLine[f.Name] = true
+	})
+	configPath := flags.applyConfig()
+	if configPath == "" {
+		fmte.Printf("Configuration file: none\n")
+	} else if profile := flag.Lookup("profile").Value.String(); profile != "" {
+		fmte.Printf("Configuration file: %s (profile %s)\n", configPath, profile)
+	} else {
+		fmte.Printf("Configuration file: %s\n", configPath)
+	}
+	inConfig := map[string]bool{}
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		inConfig[f.Name] = !onCommandLine[f.Name]
+	})
+	preset := flags.applyPreset()
+	if preset != "" {
+		fmte.Printf("Preset: %s\n", preset)
+	}
+
+	fmte.Printf("\nFlags:\n")
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if f.Name == "help" || f.Name == "version" {
+			return
+		}
+		// Sources are of formats of their own, so that they're translated
+		switch {
+		case onCommandLine[f.Name]:
+			fmte.Printf("  %-24s %-40s (command line)\n", f.Name, f.Value.String())
+		case inConfig[f.Name]:
+			fmte.Printf("  %-24s %-40s (configuration file)\n", f.Name, f.Value.String())
+		case f.Changed:
+			fmte.Printf("  %-24s %-40s (preset %s)\n", f.Name, f.Value.String(), preset)
+		default:
+			fmte.Printf("  %-24s %-40s (default)\n", f.Name, f.Value.String())
+		}
+	})
+
+	fmte.Printf("\nEnvironment:\n")
+	for _, name := range settingsOfEnv() {
+		value := os.Getenv(name)
+		if strings.HasSuffix(name, "PASSWORD") || strings.HasSuffix(name, "KEY") {
+			value = "(set)"
+		}
+		fmte.Printf("  %s=%s\n", name, value)
+	}
+
+	hasher := flags.getHasher()
+	if verifier := flags.getVerifier(); verifier != nil {
+		fmte.Printf("\nHashing algorithm: %s (verified by %s)\n", hasher.Name(), verifier.Name())
+	} else {
+		fmte.Printf("\nHashing algorithm: %s\n", hasher.Name())
+	}
+	exclusions := flags.getExcludedFiles().ToSlice()
+	sort.Strings(exclusions)
+	fmte.Printf("\nExclusions (%d):\n", len(exclusions))
+	for _, exclusion := range exclusions {
+		fmte.Printf("  %s\n", exclusion)
+	}
+}
+
+// settingsOfEnv returns names of environment variables that are set and are settings of this program (or of where
+// its configuration file is), sorted
+func settingsOfEnv() []string {
+	var names []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, envPrefix) || name == "XDG_CONFIG_HOME" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/finddup"
+	flag "github.com/spf13/pflag"
+)
+
+// redactedPath replaces paths (and URLs) in crash reports
+const redactedPath = "<path>"
+
+// crashReport is what's saved of a crash, for bug reports. Paths (and URLs, which may have credentials) are redacted
+// from it.
+type crashReport struct {
+	Version   string            `json:"version"`
+	GoVersion string            `json:"goVersion"`
+	OS        string            `json:"os"`
+	Arch      string            `json:"arch"`
+	Time      time.Time         `json:"time"`
+	Flags     map[string]string `json:"flags"`
+	Args      []string          `json:"args"`
+	Error     string            `json:"error"`
+	Stack     string            `json:"stack"`
+}
+
+func setupCrashReportOpt() {
+	p := flag.String("crash-report-dir", "",
+		"directory to save a report of a crash to, if the program crashes (defaults to the directory of\n"+
+			"temporary files)")
+	flags.getCrashDir = func() string {
+		if *p == "" {
+			return os.TempDir()
+		}
+		return *p
+	}
+}
+
+// handlePanic saves a crash report if the program panics, and prints where it is (or the crash itself, if it
+// couldn't be saved)
+func handlePanic() {
+	err := recover()
+	if err == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	path, saveErr := saveCrashReport(newCrashReport(err, stack))
+	if saveErr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Program exited unexpectedly. "+
+			"Please report the below error to the author:\n"+
+			"%+v\n", err)
+		_, _ = fmt.Fprintln(os.Stderr, stack)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "Program exited unexpectedly. "+
+			"Please report it to the author, attaching the crash report saved here (paths of files are redacted\n"+
+			"from it): %s\n", path)
+	}
+	os.Exit(exitCodeCrashed)
+}
+
+// newCrashReport creates a report of a crash by err (recovered from a panic) with its stack, redacting paths of
+// flags and arguments from it
+func newCrashReport(err any, stack string) crashReport {
+	var paths []string
+	redact := func(value string) string {
+		if filepath.IsAbs(value) || strings.ContainsAny(value, `/\`) || strings.HasPrefix(value, "~") {
+			paths = append(paths, value)
+			return redactedPath
+		}
+		if _, statErr := os.Lstat(value); statErr == nil {
+			paths = append(paths, value)
+			return redactedPath
+		}
+		return value
+	}
+	report := crashReport{
+		Version:   finddup.Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Time:      time.Now(),
+		Flags:     map[string]string{},
+		Args:      []string{},
+	}
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		if sv, ok := f.Value.(flag.SliceValue); ok {
+			values := sv.GetSlice()
+			for i, value := range values {
+				values[i] = redact(value)
+			}
+			report.Flags[f.Name] = "[" + strings.Join(values, ",") + "]"
+		} else {
+			report.Flags[f.Name] = redact(f.Value.String())
+		}
+	})
+	for _, arg := range flag.Args() {
+		report.Args = append(report.Args, redact(arg))
+	}
+	// Longer paths first, so that none of them is left partly as a part of a longer one
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+	report.Error, report.Stack = fmt.Sprintf("%+v", err), stack
+	for _, path := range paths {
+		report.Error = strings.ReplaceAll(report.Error, path, redactedPath)
+		report.Stack = strings.ReplaceAll(report.Stack, path, redactedPath)
+	}
+	return report
+}
+
+// saveCrashReport saves the crash report in the directory of --crash-report-dir, returning its path
+func saveCrashReport(report crashReport) (string, error) {
+	dir := os.TempDir()
+	if flags.getCrashDir != nil {
+		dir = flags.getCrashDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "go-find-duplicates-crash-"+report.Time.Format("060102_150405")+"-*.json")
+	if err != nil {
+		return "", err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(report); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
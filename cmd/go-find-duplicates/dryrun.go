@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	flag "github.com/spf13/pflag"
+)
+
+const dryRunFlag = "dry-run"
+
+// isGlobalDryRun is whether --dry-run precedes the subcommand (e.g. "go-find-duplicates --dry-run remove ..."), which
+// every subcommand that changes files honors as if it were passed to it
+var isGlobalDryRun bool
+
+// parseGlobalOpts parses flags that precede the subcommand (--dry-run, and --lang, which all subcommands honor),
+// returning the arguments that follow them
+func parseGlobalOpts(args []string) []string {
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--"+dryRunFlag || args[0] == "-n":
+			isGlobalDryRun = true
+			args = args[1:]
+		case strings.HasPrefix(args[0], "--"+langFlag+"="):
+			selectLanguage(strings.TrimPrefix(args[0], "--"+langFlag+"="))
+			args = args[1:]
+		case args[0] == "--"+langFlag && len(args) > 1:
+			selectLanguage(args[1])
+			args = args[2:]
+		default:
+			return args
+		}
+	}
+	return args
+}
+
+// setupDryRunOpt adds --dry-run to fs, of a scan or of a subcommand that changes files. The function returned tells
+// whether it's set, there or before the subcommand.
+func setupDryRunOpt(fs *flag.FlagSet) func() bool {
+	p := fs.BoolP(dryRunFlag, "n", false,
+		"only print what would be done, without changing any file, and save it\nto a report of planned actions")
+	return func() bool {
+		return *p || isGlobalDryRun
+	}
+}
+
+// plan is the actions of a dry run, which are printed as they're planned
+type plan struct {
+	actions []string
+}
+
+func (p *plan) add(format string, args ...any) {
+	action := fmt.Sprintf(format, args...)
+	fmte.Printf("would %s\n", action)
+	p.actions = append(p.actions, action)
+}
+
+// addReport plans actions of report, of a dry run of actions
+func (p *plan) addReport(report *actions.Report) {
+	for _, record := range report.Records {
+		if record.Err == nil {
+			p.add("%s %s (keeping %s)", record.Action, record.Path, record.Kept)
+		}
+	}
+}
+
+// save writes the planned actions to the report file of planned actions of the run, returning its name
+func (p *plan) save(naming reportNaming, runID string) (string, error) {
+	var bb bytes.Buffer
+	for _, action := range p.actions {
+		bb.WriteString(action)
+		bb.WriteByte('\n')
+	}
+	fileName := naming.fileName(reportKindPlanned, runID, ".txt")
+	if err := writeReportFile(fileName, bb.Bytes()); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+// savePlan saves p as save does, exiting if it can't be
+func savePlan(p *plan, naming reportNaming, runID string) {
+	fileName, err := p.save(naming, runID)
+	if err != nil {
+		fmte.PrintfErr("error while writing planned actions: %+v\n", err)
+		os.Exit(exitCodeWritingToReportFileFailed)
+	}
+	fmte.Printf("Planned actions saved here: %s\n", fileName)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/i18n"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+const langFlag = "lang"
+
+// printer prints messages that aren't printed through package fmte (such as help), in the language of messages
+var printer = message.NewPrinter(language.English)
+
+// setLanguage sets the language of messages
+func setLanguage(lang language.Tag) {
+	printer = message.NewPrinter(lang)
+	fmte.SetLogger(fmte.NewLocalizedLogger(lang, os.Stdout, os.Stderr))
+}
+
+// selectLanguage sets the language of messages to that of name, as given by --lang, exiting if messages aren't in it
+func selectLanguage(name string) {
+	lang, err := i18n.Parse(name)
+	if err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		os.Exit(exitCodeInvalidLanguage)
+	}
+	setLanguage(lang)
+}
+
+// setupLanguageOpt adds --lang to flags of scans, which (unless it's empty) overrides the language of messages that
+// the environment sets
+func setupLanguageOpt() {
+	p := flag.String(langFlag, "", "language of messages, one of: "+strings.Join(i18n.Names(), ", ")+
+		" (defaults to that of $"+i18n.EnvVar+" or of the locale)")
+	flags.applyLanguage = func() {
+		if *p != "" {
+			selectLanguage(*p)
+		}
+	}
+}
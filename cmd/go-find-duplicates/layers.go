@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/layers"
+	"github.com/m-manu/go-find-duplicates/service"
+	flag "github.com/spf13/pflag"
+)
+
+const layersCommand = "layers"
+
+// runLayers runs the "layers" subcommand, which finds files duplicated across layers of container images
+func runLayers(args []string) {
+	fs := flag.NewFlagSet(layersCommand, flag.ContinueOnError)
+	minSize := fs.Uint64P("minsize", "m", 4, "minimum size of file in KiB to consider")
+	isHelp := fs.BoolP("help", "h", false, "display help")
+	fs.Usage = func() {
+		fmte.PrintfErr("Run \"go-find-duplicates %s --help\" for usage\n", layersCommand)
+	}
+	if err := fs.Parse(args); err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *isHelp {
+		fs.SetOutput(os.Stdout)
+		fmte.Printf(`go-find-duplicates %s finds files duplicated across layers of container images (e.g. to slim
+images down, or to find what's worth moving to a shared base layer)
+
+Usage:
+  go-find-duplicates %s [flags] <images-1> <images-2> ... <images-n>
+
+where arguments are tarballs of "docker save" or of OCI image layouts (optionally compressed with gzip), those
+extracted to directories, or storage directories of the Docker daemon (e.g. /var/lib/docker, with the overlay2
+driver). Layers shared by images are scanned once.
+
+Flags (all optional):
+`, layersCommand, layersCommand)
+		fs.PrintDefaults()
+		os.Exit(exitCodeSuccess)
+	}
+	if fs.NArg() < 1 {
+		fmte.PrintfErr("error: no images passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	set, err := layers.Open(fs.Args()...)
+	if err != nil {
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeReadingImagesFailed)
+	}
+	defer set.Close()
+	fmte.Printf("Read %d layers of %d images.\n", len(set.Layers()), set.Images())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	dirs := make([]string, 0, len(set.Layers()))
+	for _, l := range set.Layers() {
+		dirs = append(dirs, l.ID)
+	}
+	result, err := service.FindDuplicates(ctx, service.NewOptions(dirs,
+		service.WithFS(set),
+		service.WithFileSizeThreshold(int64(*minSize)*bytesutil.KIBI),
+	))
+	if err != nil {
+		fmte.PrintfErr("error while finding duplicates: %+v\n", err)
+		os.Exit(exitCodeErrorFindingDuplicates)
+	}
+	if result.Duplicates == nil || result.Duplicates.Size() == 0 {
+		fmte.Printf("No duplicates found!\n")
+		return
+	}
+
+	type group struct {
+		size  int64
+		paths []string
+	}
+	var groups []group
+	for digest, paths := range result.Duplicates.All() {
+		sortedPaths := append([]string(nil), paths...)
+		sort.Strings(sortedPaths)
+		groups = append(groups, group{size: digest.FileSize, paths: sortedPaths})
+	}
+	// Groups that waste the most space come first
+	sort.Slice(groups, func(i, j int) bool {
+		wi, wj := groups[i].size*int64(len(groups[i].paths)-1), groups[j].size*int64(len(groups[j].paths)-1)
+		if wi != wj {
+			return wi > wj
+		}
+		return groups[i].paths[0] < groups[j].paths[0]
+	})
+	fmte.Printf("Layers:\n")
+	for _, l := range set.Layers() {
+		fmte.Printf("  %s  %s (of %s)\n", l.ID, l.Digest, strings.Join(l.Images, ", "))
+	}
+	fmte.Printf("Files duplicated across layers:\n")
+	for _, g := range groups {
+		fmte.Printf("%s × %d copies (%s wasted):\n", bytesutil.BinaryFormat(g.size), len(g.paths),
+			bytesutil.BinaryFormat(g.size*int64(len(g.paths)-1)))
+		for _, p := range g.paths {
+			l, name := set.Locate(p)
+			fmte.Printf("  %s  in layer %s (of %s)\n", name, l.ID, strings.Join(l.Images, ", "))
+		}
+	}
+	fmte.Printf("Found %d duplicates. A total of %s can be saved by removing them.\n",
+		result.DuplicateTotalCount, bytesutil.BinaryFormat(result.SavingsSize))
+}
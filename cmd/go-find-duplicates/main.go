@@ -0,0 +1,1074 @@
+/*
+A blazingly-fast simple-to-use tool to find duplicate files (photos, videos, music, documents etc.) on your computer,
+portable hard drives etc.
+*/
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/finddup"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/config"
+	"github.com/m-manu/go-find-duplicates/internal/cron"
+	"github.com/m-manu/go-find-duplicates/internal/gitrepo"
+	"github.com/m-manu/go-find-duplicates/internal/i18n"
+	"github.com/m-manu/go-find-duplicates/internal/notify"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+// Exit codes for this program
+const (
+	exitCodeSuccess = iota
+	exitCodeInvalidNumArgs
+	exitCodeInvalidExclusions
+	exitCodeInputDirectoryNotReadable
+	exitCodeExclusionFilesError
+	exitCodeErrorFindingDuplicates
+	exitCodeErrorCreatingReport
+	exitCodeInvalidOutputMode
+	exitCodeReportFileCreationFailed
+	exitCodeWritingToReportFileFailed
+	exitCodeInvalidHashAlgorithm
+	exitCodeInvalidCache
+	exitCodeWritingManifestFailed
+	exitCodeInvalidAction
+	exitCodeBenchmarkFailed
+	exitCodeMetricsServerFailed
+	exitCodeInvalidDigests
+	exitCodeWritingDigestsFailed
+	exitCodeServerFailed
+	exitCodeInvalidNotification
+	exitCodeInvalidLogTarget
+	exitCodeInvalidSchedule
+	exitCodeReadingImagesFailed
+	exitCodeReadingBackupsFailed
+	exitCodeInvalidConfig
+	exitCodeInvalidManifest
+	exitCodeActionFailed
+	exitCodeInvalidReportName
+	exitCodeInvalidRunMetadata
+	exitCodeInvalidTimeFormat
+	exitCodeInvalidParallelism
+	exitCodeInvalidCIMode
+	exitCodeScanInterrupted
+	exitCodeDuplicatesFound // of scans in CI mode only (see setupCIOpt)
+	exitCodeSelfUpdateFailed
+	exitCodeInvalidLanguage
+	exitCodeWizardCancelled
+	exitCodeCrashed
+	exitCodeInvalidMemoryLimit
+	exitCodeProfilingFailed
+	exitCodeInvalidSymlinkPolicy
+	exitCodeInvalidReport
+	exitCodeInvalidBurstOpts
+	exitCodeInvalidMusicOpts
+	exitCodeMissingAPIKey
+)
+
+const runIDFlag = "run-id"
+
+// runIDPattern matches run IDs given by --run-id, which are parts of names of report files
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+//go:embed default_exclusions.txt
+var defaultExclusionsStr string
+
+var flags struct {
+	isHelp           func() bool
+	getOutputMode    func() string
+	getExcludedFiles func() set.Set[string]
+	getMinSize       func() int64
+	getParallelism   func() int
+	getIOWorkers     func() int
+	getWalkWorkers   func() int
+	isIOURing        func() bool
+	getHasher        func() service.Hasher
+	getVerifier      func() service.Hasher
+	getCache         func() digestcache.Store
+	getManifestFile  func() string
+	getMetricsAddr   func() string
+	getVersion       func() bool
+	getAction        func() (action actions.Action, enabled bool)
+	getKeepPolicy    func() actions.KeepPolicy
+	getReadOnly      func() actions.ReadOnlyPolicy
+	isUnlinkingLinks func() bool
+	getActionMinSize func() int64
+	isDryRun         func() bool
+	isCI             func() bool
+	getExportFile    func() string
+	getImported      func() *entity.DigestIndex
+	getImportedFrom  func() string
+	getWebAddr       func() string
+	getNotifiers     func() []notify.Notifier
+	getSchedule      func() (schedule cron.Schedule, enabled bool)
+	getKeepReports   func() int
+	getGitPolicy     func(fsys vfs.FS) *gitrepo.Policy
+	getSymlinkPolicy func() string
+	getBackup        func() string
+	getReportNaming  func() reportNaming
+	getRunID         func() string
+	getLabels        func() entity.Labels
+	getTimeFormat    func() timeFormat
+	applyConfig      func() string
+	applyPreset      func() string
+	getExtensions    func() []string
+	getCrashDir      func() string
+	applyLimits      func()
+	getSpillAfter    func() int
+	getMaxOpenFiles  func() int
+	startProfiling   func() (stop func())
+	applyLanguage    func()
+}
+
+func setupExclusionsOpt() {
+	const exclusionsFlag = "exclusions"
+	defaultExclusions, defaultExclusionsExamples := utils.LineSeparatedStrToMap(defaultExclusionsStr)
+	p := flag.StringArrayP(exclusionsFlag, "x", nil,
+		fmt.Sprintf("name or glob pattern of names (e.g. '*.tmp') of files and directories to be excluded,\n"+
+			"or path to a file containing a newline-separated list of them (can be repeated, and adds to\n"+
+			"those excluded by default: %s etc.)",
+			strings.Join(defaultExclusionsExamples, ", ")))
+	noDefaults := flag.Bool("no-default-exclusions", false,
+		"don't exclude files and directories excluded by default (only those of --"+exclusionsFlag+"), e.g. for\n"+
+			"a complete inventory")
+	flags.getExcludedFiles = func() set.Set[string] {
+		exclusions := defaultExclusions.Clone()
+		if *noDefaults {
+			exclusions.Clear()
+		}
+		for _, value := range *p {
+			value = strings.TrimSpace(value)
+			// Names can't have separators, so such values are paths of files, as are those of existing files
+			if !strings.ContainsAny(value, `/\`) && !utils.IsReadableFile(value) {
+				exclusions.Add(value)
+				continue
+			}
+			if !utils.IsReadableFile(value) {
+				fmte.PrintfErr("error: argument \"%s\" to flag --%s should be a readable file\n", value, exclusionsFlag)
+				flag.Usage()
+				os.Exit(exitCodeInvalidExclusions)
+			}
+			rawContents, err := os.ReadFile(value)
+			if err != nil {
+				fmte.PrintfErr("error: unable to read exclusions file: %+v\n", err)
+				flag.Usage()
+				os.Exit(exitCodeExclusionFilesError)
+			}
+			contents := strings.ReplaceAll(string(rawContents), "\r\n", "\n") // Windows
+			fileExclusions, _ := utils.LineSeparatedStrToMap(contents)
+			exclusions = exclusions.Union(fileExclusions)
+		}
+		return exclusions
+	}
+}
+
+func setupBackupOpt() {
+	p := flag.String("backup", "",
+		"repository of backups of restic or borg (restic:<repository>, or borg:<repository>[::<archive>],\n"+
+			"of the latest archive by default) to find which files and directories are fully backed up in")
+	flags.getBackup = func() string { return *p }
+}
+
+func setupCacheOpt() {
+	p := flag.String("cache", "",
+		"path to a file in which hashes are cached, so that unchanged files aren't read again\n"+
+			"in subsequent scans (created if it doesn't exist)")
+	xattr := flag.Bool("xattr-cache", false,
+		"cache hashes in extended attributes ("+digestcache.XattrPrefix+"*) of files themselves, where file\n"+
+			"systems support them, so that unchanged files aren't read again in subsequent scans, even if\n"+
+			"they're moved (along with --cache, if that's set too)")
+	flags.getCache = func() digestcache.Store {
+		var stores []digestcache.Store
+		if *xattr {
+			store, err := digestcache.NewXattr()
+			if err != nil {
+				fmte.PrintfErr("error: %+v\n", err)
+				os.Exit(exitCodeInvalidCache)
+			}
+			stores = append(stores, store)
+		}
+		if *p != "" {
+			store, err := digestcache.OpenBolt(*p)
+			if err != nil {
+				fmte.PrintfErr("error: %+v\n", err)
+				os.Exit(exitCodeInvalidCache)
+			}
+			stores = append(stores, store)
+		}
+		switch len(stores) {
+		case 0:
+			return nil
+		case 1:
+			return stores[0]
+		default:
+			return digestcache.NewTiered(stores...)
+		}
+	}
+}
+
+func setupManifestOpt() {
+	p := flag.String("manifest", "",
+		"path to a file to save full results of the scan to, for later use\n"+
+			"(JSON if file name ends with .json, compact binary otherwise)")
+	flags.getManifestFile = func() string { return *p }
+}
+
+func setupMetricsOpt() {
+	p := flag.String("metrics-addr", "",
+		"address (e.g. localhost:9100) at which to serve metrics of the scan while it runs,\n"+
+			"for Prometheus at /metrics and through expvar at /debug/vars")
+	flags.getMetricsAddr = func() string { return *p }
+}
+
+func setupConfigOpts() {
+	const configFlag, profileFlag = "config", "profile"
+	path := flag.String(configFlag, "",
+		"path to a configuration file (in YAML) of defaults of flags, and of profiles of them (defaults to\n"+
+			"go-find-duplicates/config.yaml in $XDG_CONFIG_HOME or ~/.config, if it exists)")
+	profile := flag.String(profileFlag, "",
+		"profile of the configuration file to apply, whose flags override defaults of the file (flags on\n"+
+			"the command line override both)")
+	flags.applyConfig = func() string {
+		configPath := *path
+		if configPath == "" {
+			if defaultPath, err := config.DefaultPath(); err == nil {
+				if _, statErr := os.Stat(defaultPath); statErr == nil {
+					configPath = defaultPath
+				}
+			}
+		}
+		if configPath == "" {
+			if *profile != "" {
+				fmte.PrintfErr("error: no configuration file to find profile %q in\n", *profile)
+				os.Exit(exitCodeInvalidConfig)
+			}
+			return ""
+		}
+		c, err := config.Load(configPath)
+		if err != nil {
+			fmte.PrintfErr("error: couldn't load configuration: %+v\n", err)
+			os.Exit(exitCodeInvalidConfig)
+		}
+		if err := c.Apply(flag.CommandLine, *profile, configFlag, profileFlag, "help", "version"); err != nil {
+			fmte.PrintfErr("error: %s: %v\n", configPath, err)
+			os.Exit(exitCodeInvalidConfig)
+		}
+		return configPath
+	}
+}
+
+func setupPresetOpt() {
+	p := flag.String("preset", "",
+		"preset of flags for a kind of content, one of: "+strings.Join(config.PresetNames(), ", ")+" (flags set on\n"+
+			"the command line or by the configuration file override those of the preset)")
+	flags.applyPreset = func() string {
+		if *p == "" {
+			return ""
+		}
+		name := strings.ToLower(strings.TrimSpace(*p))
+		preset, err := config.PresetByName(name)
+		if err == nil {
+			err = preset.Apply(flag.CommandLine, "")
+		}
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			os.Exit(exitCodeInvalidConfig)
+		}
+		return name
+	}
+}
+
+func setupExtensionsOpt() {
+	p := flag.StringSlice("ext", nil,
+		"only consider files with these extensions (e.g. jpg,png), case-insensitively (can be repeated)")
+	flags.getExtensions = func() []string { return *p }
+}
+
+func setupDigestsOpts() {
+	export := flag.String("export-digests", "",
+		"path to a file to export digests of all files to, so that a scan on another host can find\n"+
+			"which of its files exist here (JSON if file name ends with .json, compact binary otherwise;\n"+
+			"the hashing algorithm defaults to "+service.SampledHasher{}.Name()+" on every host)")
+	flags.getExportFile = func() string { return *export }
+	p := flag.String("import-digests", "",
+		"path to a file of digests exported on another host (by --export-digests), to find which files\n"+
+			"exist there too (the hashing algorithm defaults to the one of the digests)")
+	known := flag.String("known-hashes", "",
+		"path to a checksum manifest (of sha256sum or md5sum, e.g. of an archive), to find which files\n"+
+			"are in it too (the hashing algorithm defaults to that of the manifest)")
+	var imported *entity.DigestIndex
+	flags.getImported = func() *entity.DigestIndex {
+		if (*p == "" && *known == "") || imported != nil {
+			return imported
+		}
+		if *p != "" && *known != "" {
+			fmte.PrintfErr("error: digests and checksum manifests can't be imported together\n")
+			os.Exit(exitCodeInvalidDigests)
+		}
+		var index *entity.DigestIndex
+		var err error
+		if *p != "" {
+			index, err = entity.LoadDigestIndex(*p)
+		} else {
+			index, err = entity.LoadChecksums(*known)
+		}
+		if err != nil {
+			fmte.PrintfErr("error: couldn't load digests: %+v\n", err)
+			os.Exit(exitCodeInvalidDigests)
+		}
+		imported = index
+		return imported
+	}
+	flags.getImportedFrom = func() string {
+		if *known != "" {
+			return "in " + filepath.Base(*known)
+		}
+		return "on " + flags.getImported().Host
+	}
+}
+
+func setupNotifyOpts() {
+	webhooks := flag.StringSlice("notify-webhook", nil,
+		"URL to post a summary of the scan to (as JSON) once it finishes (can be repeated)")
+	slack := flag.StringSlice("notify-slack", nil,
+		"URL of an incoming webhook of Slack to post a summary of the scan to once it finishes (can be repeated)")
+	discord := flag.StringSlice("notify-discord", nil,
+		"URL of a webhook of a Discord channel to post a summary of the scan to once it finishes (can be repeated)")
+	emails := flag.StringSlice("notify-email", nil,
+		"email address to send a summary of the scan to once it finishes (can be repeated), through\n"+
+			"the SMTP server set in environment variables "+notify.SMTPAddrEnv+" (host:port),\n"+
+			notify.SMTPUsernameEnv+", "+notify.SMTPPasswordEnv+" and "+notify.SMTPFromEnv)
+	var notifiers []notify.Notifier
+	flags.getNotifiers = func() []notify.Notifier {
+		if notifiers != nil {
+			return notifiers
+		}
+		notifiers = []notify.Notifier{}
+		for _, url := range *webhooks {
+			notifiers = append(notifiers, notify.Webhook{URL: url})
+		}
+		for _, url := range *slack {
+			notifiers = append(notifiers, notify.Slack{URL: url})
+		}
+		for _, url := range *discord {
+			notifiers = append(notifiers, notify.Discord{URL: url})
+		}
+		if len(*emails) > 0 {
+			email, err := notify.EmailFromEnv(*emails)
+			if err != nil {
+				fmte.PrintfErr("error: can't send emails: %+v\n", err)
+				os.Exit(exitCodeInvalidNotification)
+			}
+			notifiers = append(notifiers, email)
+		}
+		return notifiers
+	}
+}
+
+func setupGitOpts() {
+	scanInternals := flag.Bool("git-internals", false,
+		"also scan internals of Git repositories (their "+gitrepo.DirName+" directories), which are skipped\n"+
+			"otherwise")
+	respectGitignore := flag.Bool("respect-gitignore", false,
+		"skip files and directories ignored by .gitignore files of their Git repositories")
+	flags.getGitPolicy = func(fsys vfs.FS) *gitrepo.Policy {
+		return gitrepo.NewPolicy(fsys, *scanInternals, *respectGitignore)
+	}
+}
+
+// Policies of --symlinks, of links found while scanning
+const (
+	symlinksSkip   = "skip"
+	symlinksFollow = "follow"
+	symlinksReport = "report"
+)
+
+func setupSymlinksOpt() {
+	follow := flag.Bool("follow-symlinks", false, "follow links found while scanning, same as --symlinks "+symlinksFollow)
+	p := flag.String("symlinks", symlinksSkip,
+		"what to do with symbolic links (and junctions and other reparse points, such as those of OneDrive, on\n"+
+			"Windows) found while scanning, one of: "+symlinksSkip+", "+symlinksFollow+" (files that links lead to are\n"+
+			"found once, and not at all if they're in directories scanned anyway) or "+symlinksReport+" (skip them,\n"+
+			"listing each). Other files that aren't regular files (FIFOs, sockets and devices) are always skipped.")
+	flags.getSymlinkPolicy = func() string {
+		if *follow && !flag.CommandLine.Changed("symlinks") {
+			return symlinksFollow
+		}
+		policy := strings.ToLower(strings.TrimSpace(*p))
+		if policy != symlinksSkip && policy != symlinksFollow && policy != symlinksReport {
+			fmte.PrintfErr("error: policy of links \"%s\" isn't one of %s, %s and %s\n", policy, symlinksSkip,
+				symlinksFollow, symlinksReport)
+			os.Exit(exitCodeInvalidSymlinkPolicy)
+		}
+		return policy
+	}
+}
+
+func setupHelpOpt() {
+	p := flag.BoolP("help", "h", false, "display help")
+	flags.isHelp = func() bool { return *p }
+}
+
+func setupHashOpt() {
+	const hashFlag = "hash"
+	isThorough := flag.BoolP("thorough", "t", false,
+		"apply thorough check of uniqueness of files, same as --"+hashFlag+" "+service.SHA256Hasher{}.Name()+
+			"\n(caution: this makes the scan very slow!)",
+	)
+	p := flag.StringP(hashFlag, "a", service.DefaultHasher.Name(),
+		fmt.Sprintf("hashing algorithm to identify duplicates, one of: %s\n"+
+			"(all except %s and %s read entire file contents; the default is whichever of them is faster\n"+
+			"on this machine, or the former with --export-digests)",
+			strings.Join(service.HasherNames(), ", "), service.SampledHasher{}.Name(),
+			service.SampledCRC32CHasher{}.Name()))
+	flags.getHasher = func() service.Hasher {
+		if *isThorough && !flag.CommandLine.Changed(hashFlag) {
+			return service.SHA256Hasher{}
+		}
+		name := *p
+		if imported := flags.getImported(); imported != nil && !flag.CommandLine.Changed(hashFlag) {
+			name = imported.Algorithm
+		} else if flags.getExportFile() != "" && !flag.CommandLine.Changed(hashFlag) {
+			// Digests exported are hashed the same whatever the CPU of the host, so that those of all hosts can be
+			// merged (see runMerge)
+			name = service.SampledHasher{}.Name()
+		}
+		if sha256 := (service.SHA256Hasher{}).Name(); flags.getOutputMode() == entity.OutputModeSHA256Sum {
+			if flag.CommandLine.Changed(hashFlag) && name != sha256 {
+				fmte.PrintfErr("error: output mode %s needs --%s %s\n", entity.OutputModeSHA256Sum, hashFlag, sha256)
+				os.Exit(exitCodeInvalidHashAlgorithm)
+			}
+			name = sha256
+		}
+		hasher, err := service.HasherByName(strings.ToLower(strings.TrimSpace(name)))
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			flag.Usage()
+			os.Exit(exitCodeInvalidHashAlgorithm)
+		}
+		return hasher
+	}
+}
+
+// verifierNames returns names of hashing algorithms that can verify duplicates
+func verifierNames() []string {
+	var names []string
+	for _, name := range service.HasherNames() {
+		if !service.IsSampled(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func setupVerifyOpt() {
+	p := flag.String("verify", "",
+		fmt.Sprintf("verify duplicates found by hashing entire file contents, using one of: %s\n"+
+			"(only potential duplicates are read again, so this is much faster than --thorough)",
+			strings.Join(verifierNames(), ", ")))
+	flags.getVerifier = func() service.Hasher {
+		if *p == "" {
+			return nil
+		}
+		name := strings.ToLower(strings.TrimSpace(*p))
+		verifier, err := service.HasherByName(name)
+		if err == nil && service.IsSampled(name) {
+			err = fmt.Errorf("hashing algorithm %s can't verify duplicates", name)
+		}
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			flag.Usage()
+			os.Exit(exitCodeInvalidHashAlgorithm)
+		}
+		return verifier
+	}
+}
+
+func setupActionOpts() {
+	const actionFlag = "action"
+	isRemove := flag.BoolP("remove", "X", false,
+		"remove duplicate files from input directory, same as --"+actionFlag+" "+actions.Delete.String())
+	p := flag.String(actionFlag, "",
+		fmt.Sprintf("action on duplicates (all files of a group except the one kept), one of:\n%s",
+			strings.Join(actions.ActionNames(), ", ")))
+	flags.getAction = func() (actions.Action, bool) {
+		if *p == "" {
+			return actions.Delete, *isRemove
+		}
+		action, err := actions.ActionByName(strings.ToLower(strings.TrimSpace(*p)))
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			flag.Usage()
+			os.Exit(exitCodeInvalidAction)
+		}
+		return action, true
+	}
+	k := flag.String("keep", "first",
+		fmt.Sprintf("which file of a group of duplicates is kept when acting on duplicates, one of:\n%s",
+			strings.Join(actions.KeepPolicyNames(), ", ")))
+	flags.getKeepPolicy = func() actions.KeepPolicy {
+		policy, err := actions.KeepPolicyByName(strings.ToLower(strings.TrimSpace(*k)))
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			flag.Usage()
+			os.Exit(exitCodeInvalidAction)
+		}
+		return policy
+	}
+	r := flag.String("read-only", actions.ReadOnlyFail.String(), readOnlyUsage)
+	flags.getReadOnly = func() actions.ReadOnlyPolicy {
+		policy, err := actions.ReadOnlyPolicyByName(strings.ToLower(strings.TrimSpace(*r)))
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			flag.Usage()
+			os.Exit(exitCodeInvalidAction)
+		}
+		return policy
+	}
+	u := flag.Bool("unlink-hardlinks", false, unlinkHardlinksUsage)
+	flags.isUnlinkingLinks = func() bool {
+		return *u
+	}
+	m := flag.Uint64(actionMinSizeFlag, 1, actionMinSizeUsage)
+	flags.getActionMinSize = func() int64 {
+		return int64(*m)
+	}
+	flags.isDryRun = setupDryRunOpt(flag.CommandLine)
+}
+
+func setupMinSizeOpt() {
+	p := flag.Uint64P("minsize", "m", 4,
+		"minimum size of file in KiB to consider",
+	)
+	flags.getMinSize = func() int64 { return int64(*p) * bytesutil.KIBI }
+}
+
+func setupParallelismOpts() {
+	const (
+		defaultParallelismValue = 0
+		hashWorkersFlag         = "hash-workers"
+		ioWorkersFlag           = "io-workers"
+	)
+	p := flag.IntP("parallelism", "p", defaultParallelismValue,
+		"extent of parallelism, same as --"+hashWorkersFlag+" (unless that's set too)")
+	hashWorkers := flag.Int(hashWorkersFlag, defaultParallelismValue,
+		"number of files hashed concurrently (defaults to number of cores minus 1, as limited by --max-procs)")
+	ioWorkers := flag.Int(ioWorkersFlag, defaultParallelismValue,
+		"number of files read concurrently, independently of --"+hashWorkersFlag+": e.g. fewer for slow disks,\n"+
+			"more for network storage (defaults to as many as suit the storage of each directory, where it's\n"+
+			"detected: 2 for rotational disks, 8 for SSDs, 32 for NVMe drives and 16 for network storage)")
+	flags.getParallelism = func() int {
+		workers := *hashWorkers
+		if workers == defaultParallelismValue {
+			workers = *p
+		}
+		if workers < 0 {
+			fmte.PrintfErr("error: number of workers can't be negative\n")
+			os.Exit(exitCodeInvalidParallelism)
+		}
+		if workers == defaultParallelismValue {
+			return service.DefaultParallelism()
+		}
+		return workers
+	}
+	flags.getIOWorkers = func() int {
+		if *ioWorkers < 0 {
+			fmte.PrintfErr("error: number of workers can't be negative\n")
+			os.Exit(exitCodeInvalidParallelism)
+		}
+		return *ioWorkers
+	}
+	walkWorkers := flag.Int("walk-workers", service.DefaultWalkWorkers,
+		"number of directories read concurrently while walking, ahead of files being scanned: e.g. more for\n"+
+			"trees of very many small directories (such as of node_modules), or 1 to read one at a time")
+	flags.getWalkWorkers = func() int {
+		if *walkWorkers < 1 {
+			fmte.PrintfErr("error: number of workers can't be less than 1\n")
+			os.Exit(exitCodeInvalidParallelism)
+		}
+		return *walkWorkers
+	}
+	ioURing := flag.Bool("io-uring", false,
+		"read local files through io_uring (on Linux 5.6 onwards), which submits reads of crucial bytes of a\n"+
+			"file at once, rather than by a system call each: faster when hashing very many files")
+	flags.isIOURing = func() bool { return *ioURing }
+}
+
+func setupLimitOpts() {
+	maxMemory := flag.String("max-memory", "",
+		"soft limit of memory this may use (e.g. 2GiB), above which it collects garbage more often rather\n"+
+			"than grow, e.g. on shared servers and small NAS (defaults to that of $GOMEMLIMIT, or none)")
+	maxProcs := flag.Int("max-procs", 0,
+		"maximum number of cores used at once, which --hash-workers defaults to one less than (defaults to\n"+
+			"that of $GOMAXPROCS, or all cores)")
+	spillAfter := flag.Int("spill-after", 0,
+		"most files kept in memory while scanning, beyond which they're moved to a temporary database on\n"+
+			"disk, so that scans of very many files need less memory (defaults to keeping all files in memory)")
+	flags.getSpillAfter = func() int {
+		if *spillAfter < 0 {
+			fmte.PrintfErr("error: number of files can't be negative\n")
+			os.Exit(exitCodeInvalidMemoryLimit)
+		}
+		if *spillAfter > 0 && (flags.getManifestFile() != "" || flags.getBackup() != "") {
+			fmte.PrintfErr("error: --spill-after can't be used with --manifest or --backup, which need all files\n")
+			os.Exit(exitCodeInvalidMemoryLimit)
+		}
+		return *spillAfter
+	}
+	maxOpenFiles := flag.Int("max-open-files", 0,
+		"most files (and directories being read) open at once while scanning, so that many workers don't\n"+
+			"fail by \"too many open files\" (defaults to the limit of open files of the process, less 64 kept\n"+
+			"for others, by RLIMIT_NOFILE on Unix, or none on Windows)")
+	flags.getMaxOpenFiles = func() int {
+		if *maxOpenFiles < 0 {
+			fmte.PrintfErr("error: number of files can't be negative\n")
+			os.Exit(exitCodeInvalidMemoryLimit)
+		}
+		return *maxOpenFiles
+	}
+	flags.applyLimits = func() {
+		if *maxMemory != "" {
+			limit, err := bytesutil.ParseSize(*maxMemory)
+			if err == nil && limit == 0 {
+				err = fmt.Errorf("memory limit can't be 0")
+			}
+			if err != nil {
+				fmte.PrintfErr("error: %v\n", err)
+				os.Exit(exitCodeInvalidMemoryLimit)
+			}
+			debug.SetMemoryLimit(limit)
+		}
+		if *maxProcs < 0 {
+			fmte.PrintfErr("error: number of cores can't be negative\n")
+			os.Exit(exitCodeInvalidParallelism)
+		}
+		if *maxProcs > 0 {
+			runtime.GOMAXPROCS(*maxProcs)
+		}
+	}
+}
+
+const outputFlag = "output"
+
+func setupOutputModeOpt() {
+	var sb strings.Builder
+	sb.WriteString("following modes are accepted:\n")
+	for outputMode, description := range entity.OutputModes {
+		sb.WriteString(fmt.Sprintf("%9s = %s\n", outputMode, description))
+	}
+	p := flag.StringP(outputFlag, "o", entity.OutputModeTextFile, sb.String())
+	flags.getOutputMode = func() string {
+		outputModeStr := strings.ToLower(strings.TrimSpace(*p))
+		if _, exists := entity.OutputModes[outputModeStr]; !exists {
+			fmt.Printf("error: invalid output mode '%s'\n", outputModeStr)
+			os.Exit(exitCodeInvalidOutputMode)
+		}
+		if flags.isCI() {
+			if !flag.CommandLine.Changed(outputFlag) {
+				return entity.OutputModeJSON
+			}
+			if outputModeStr == entity.OutputModeTextFile || outputModeStr == entity.OutputModeStdOut {
+				fmte.PrintfErr("error: output mode %s isn't machine-readable, as --%s needs\n", outputModeStr, ciFlag)
+				os.Exit(exitCodeInvalidOutputMode)
+			}
+		}
+		return outputModeStr
+	}
+}
+
+const ciFlag = "ci"
+
+// setupCIOpt sets up CI mode, in which scans run as suits pipelines: without progress messages, reporting in a
+// machine-readable output mode, and exiting with a code of their own if they found duplicates (which they fail on,
+// unless actions on them resolved them)
+func setupCIOpt() {
+	p := flag.Bool(ciFlag, false,
+		fmt.Sprintf("run non-interactively, as in pipelines: print no progress, report in %s (unless --%s is\n"+
+			"another machine-readable mode) and exit with %d if duplicates are found and not acted upon",
+			entity.OutputModeJSON, outputFlag, exitCodeDuplicatesFound))
+	flags.isCI = func() bool {
+		if !*p {
+			return false
+		}
+		if flags.getWebAddr() != "" {
+			fmte.PrintfErr("error: --%s can't serve a web interface\n", ciFlag)
+			os.Exit(exitCodeInvalidCIMode)
+		}
+		return true
+	}
+}
+
+func setupWebOpt() {
+	const webFlag = "web"
+	p := flag.String(webFlag, "",
+		"after the scan, serve a web interface at this address (any free port of localhost if\n"+
+			"none is given, as in --"+webFlag+") to review duplicates with previews, and to trash or link\n"+
+			"selected copies")
+	flag.Lookup(webFlag).NoOptDefVal = defaultWebAddr
+	flags.getWebAddr = func() string { return *p }
+}
+
+func setupReportOpts() {
+	flags.getReportNaming = setupReportNamingOpts(flag.CommandLine)
+	flags.getTimeFormat = setupTimeFormatOpts(flag.CommandLine)
+}
+
+func setupRunOpts() {
+	p := flag.String(runIDFlag, "",
+		"ID of the run, in names and headers of reports, manifests and notifications (defaults to the\n"+
+			"time the scan starts, as in 241231_235959)")
+	labels := flag.StringToString("label", nil,
+		"label of the run, as key=value (e.g. ticket=OPS-123), in headers of reports, manifests and\n"+
+			"notifications (can be repeated)")
+	flags.getRunID = func() string {
+		if *p == "" {
+			return generateRunID()
+		}
+		if !runIDPattern.MatchString(*p) {
+			fmte.PrintfErr("error: run ID %q should have letters, digits, '.', '_' and '-' only\n", *p)
+			os.Exit(exitCodeInvalidRunMetadata)
+		}
+		return *p
+	}
+	flags.getLabels = func() entity.Labels {
+		if len(*labels) == 0 {
+			return nil
+		}
+		for key := range *labels {
+			if strings.TrimSpace(key) == "" {
+				fmte.PrintfErr("error: labels should have keys\n")
+				os.Exit(exitCodeInvalidRunMetadata)
+			}
+		}
+		return *labels
+	}
+}
+
+func setupScheduleOpts() {
+	p := flag.String("schedule", "",
+		"keep running, and scan on this schedule of crontab (e.g. \"0 3 * * 0\" for 3 AM every Sunday,\n"+
+			"or @daily) instead of once (only actions that don't lose contents of files are applied)")
+	keepReports := flag.Uint("keep-reports", 10,
+		"number of report files of each kind of scheduled scans to keep in the directory of reports\n"+
+			"(0 keeps all)")
+	flags.getKeepReports = func() int { return int(*keepReports) }
+	flags.getSchedule = func() (cron.Schedule, bool) {
+		if *p == "" {
+			return cron.Schedule{}, false
+		}
+		schedule, err := cron.Parse(*p)
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			os.Exit(exitCodeInvalidSchedule)
+		}
+		if action, enabled := flags.getAction(); enabled && action == actions.Delete && !flags.isDryRun() {
+			fmte.PrintfErr("error: scheduled scans can't %s duplicates (%s them instead)\n", action, actions.Trash)
+			os.Exit(exitCodeInvalidSchedule)
+		}
+		if flags.getWebAddr() != "" {
+			fmte.PrintfErr("error: scheduled scans can't serve a web interface\n")
+			os.Exit(exitCodeInvalidSchedule)
+		}
+		if flags.isCI() {
+			fmte.PrintfErr("error: scheduled scans can't run in --%s mode\n", ciFlag)
+			os.Exit(exitCodeInvalidCIMode)
+		}
+		return schedule, true
+	}
+}
+
+func setupVersionOpt() {
+	p := flag.Bool("version", false,
+		"Display version ("+finddup.Version+") and exit (useful for incorporating this in scripts)")
+	flags.getVersion = func() bool { return *p }
+}
+
+func setupUsage() {
+	flag.Usage = func() {
+		fmte.PrintfErr("Run \"go-find-duplicates --help\" for usage\n")
+	}
+}
+
+func readDirectories() (directories []string, fsys vfs.FS) {
+	if flag.NArg() < 1 {
+		fmte.PrintfErr("error: no input directories passed\n")
+		flag.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	local := vfs.Local
+	if flags.isIOURing() {
+		if uringFS, err := vfs.NewIOURingFS(); err != nil {
+			fmte.PrintfErr("warning: reading files as usual, since io_uring isn't available: %v\n", err)
+		} else {
+			local = uringFS
+		}
+	}
+	mux := vfs.NewMux(local)
+	for i, p := range flag.Args() {
+		if vfs.IsURL(p) {
+			name, err := mux.OpenURL(p)
+			if err == nil {
+				var info fs.FileInfo
+				if info, err = mux.Stat(name); err == nil && !info.IsDir() {
+					err = errors.New("not a directory")
+				}
+			}
+			if err != nil {
+				fmte.PrintfErr("error: input #%d \"%v\" isn't a readable directory: %v\n", i+1, p, err)
+				flag.Usage()
+				os.Exit(exitCodeInputDirectoryNotReadable)
+			}
+			directories = append(directories, name)
+			continue
+		}
+		if !utils.IsReadableDirectory(p) {
+			fmte.PrintfErr("error: input #%d \"%v\" isn't a readable directory\n", i+1, p)
+			flag.Usage()
+			os.Exit(exitCodeInputDirectoryNotReadable)
+		}
+		abs, _ := filepath.Abs(p)
+		directories = append(directories, abs)
+	}
+	return directories, mux
+}
+
+func showHelpAndExit() {
+	flag.CommandLine.SetOutput(os.Stdout)
+	printer.Printf("go-find-duplicates is a tool to find duplicate files and directories\n")
+	fmt.Print(`
+Usage:
+  go-find-duplicates [scan] [flags] <dir-1> <dir-2> ... <dir-n>
+  go-find-duplicates report [flags] <manifest>
+  go-find-duplicates remove [flags] <manifest>
+  go-find-duplicates link [flags] <manifest>
+  go-find-duplicates apply [flags] <report.json>
+  go-find-duplicates diff <older-manifest> <newer-manifest>
+  go-find-duplicates merge [flags] <host-1.digests> <host-2.digests> ... <host-n.digests>
+  go-find-duplicates cache stats|prune|clear <cache>
+  go-find-duplicates serve [flags]
+  go-find-duplicates bench [flags] <dir>
+  go-find-duplicates layers [flags] <images-1> <images-2> ... <images-n>
+  go-find-duplicates bursts [flags] <dir-1> <dir-2> ... <dir-n>
+  go-find-duplicates music [flags] <dir-1> <dir-2> ... <dir-n>
+  go-find-duplicates completion bash|zsh|fish|powershell
+  go-find-duplicates config show [flags]
+  go-find-duplicates self-update [flags]
+  go-find-duplicates wizard
+
+`)
+	printer.Printf(`where,
+  arguments of scan are readable directories that need to be scanned for duplicates
+  (these may also be URLs of remote storage, such as s3://bucket/prefix)
+  (report, remove and link report duplicates of a scan saved by --manifest again, delete them and replace them
+  with links, respectively, without scanning again)
+  (apply deletes duplicates of a report of -o json, or replaces them with links, verifying their hashes first)
+  (diff compares two scans saved by --manifest)
+  (merge reports duplicates across hosts of digests exported on each by --export-digests)
+  (cache maintains a file of hashes of --cache)
+  (serve serves an API through which scans are run programmatically)
+  (bench measures how fast a directory can be scanned and recommends flags for it)
+  (layers finds files duplicated across layers of container images)
+  (bursts finds bursts of photos taken within moments of each other that look alike, to be reviewed together)
+  (music finds copies of the same recordings across formats and bitrates, marking the best of them)
+  (completion generates a script of completion of arguments for a shell)
+  (config show prints settings of scans with flags given, as resolved from defaults, the configuration file
+  and the command line)
+  (self-update replaces this binary with that of the latest release)
+  (wizard asks what to scan and what to do with duplicates, then prints and runs the equivalent scan)
+  (run "go-find-duplicates <subcommand> --help" for flags of subcommands, and "scan" explicitly to scan
+  a directory named like a subcommand)
+`)
+	printer.Printf("\nFlags of scan (all optional):\n")
+	flag.PrintDefaults()
+	printer.Printf("\nFor more details: https://github.com/m-manu/go-find-duplicates\n")
+	os.Exit(exitCodeSuccess)
+}
+
+func setupFlags() {
+	setupBackupOpt()
+	setupCacheOpt()
+	setupConfigOpts()
+	setupCrashReportOpt()
+	setupDigestsOpts()
+	setupExclusionsOpt()
+	setupExtensionsOpt()
+	setupGitOpts()
+	setupSymlinksOpt()
+	setupHashOpt()
+	setupHelpOpt()
+	setupActionOpts()
+	setupLimitOpts()
+	setupLanguageOpt()
+	setupCIOpt()
+	setupManifestOpt()
+	setupMetricsOpt()
+	setupMinSizeOpt()
+	setupNotifyOpts()
+	setupOutputModeOpt()
+	setupParallelismOpts()
+	setupPresetOpt()
+	setupProfileOpts()
+	setupReportOpts()
+	setupRunOpts()
+	setupScheduleOpts()
+	setupUsage()
+	setupVerifyOpt()
+	setupVersionOpt()
+	setupWebOpt()
+}
+
+func generateRunID() string {
+	return time.Now().Format("060102_150405")
+}
+
+// checkReportFileIfApplicable returns the name of the report file of the output mode (none in mode stdout), checking
+// that it can be created
+func checkReportFileIfApplicable(naming reportNaming, runID string, outputMode string,
+) (reportFileName string, err error) {
+	switch outputMode {
+	case entity.OutputModeStdOut:
+		return
+	case entity.OutputModeCsvFile:
+		reportFileName = naming.fileName(reportKindDuplicates, runID, ".csv")
+	case entity.OutputModeTextFile:
+		reportFileName = naming.fileName(reportKindDuplicates, runID, ".txt")
+	case entity.OutputModeJSON:
+		reportFileName = naming.fileName(reportKindDuplicates, runID, ".json")
+	case entity.OutputModeSHA256Sum:
+		reportFileName = naming.fileName(reportKindChecksums, runID, ".txt")
+	default:
+		panic("Bug in code")
+	}
+	// The report file itself is created only once the report is written entirely (see reportFile), so that a scan
+	// that fails leaves no empty report behind: only that it can be created is checked here
+	if err := checkWritable(filepath.Dir(reportFileName)); err != nil {
+		return "", err
+	}
+	return reportFileName, nil
+}
+
+// exportDigests saves digests of all files of the scan, for --import-digests on another host
+func exportDigests(exportFile string, directories []string, hasher service.Hasher,
+	digests map[string]entity.FileDigest,
+) error {
+	host, _ := os.Hostname()
+	index := &entity.DigestIndex{
+		Version:     entity.DigestIndexVersion,
+		Host:        host,
+		Directories: directories,
+		Algorithm:   hasher.Name(),
+		CreatedAt:   time.Now(),
+		Digests:     digests,
+	}
+	if err := entity.SaveDigestIndex(exportFile, index); err != nil {
+		return err
+	}
+	fmte.Printf("Digests of %d files exported here: %s\n", len(digests), exportFile)
+	return nil
+}
+
+func main() {
+	commands := map[string]func(args []string){
+		benchCommand:      runBench,
+		burstsCommand:     runBursts,
+		cacheCommand:      runCache,
+		completionCommand: runCompletion,
+		configCommand:     runConfig,
+		applyCommand:      runApply,
+		diffCommand:       runDiff,
+		layersCommand:     runLayers,
+		linkCommand:       runLink,
+		mergeCommand:      runMerge,
+		musicCommand:      runMusic,
+		removeCommand:     runRemove,
+		reportCommand:     runReport,
+		selfUpdateCommand: runSelfUpdate,
+		serveCommand:      runServe,
+		wizardCommand:     runWizard,
+	}
+	setLanguage(i18n.FromEnv())
+	args := parseGlobalOpts(os.Args[1:])
+	if len(args) > 0 {
+		if run, exists := commands[args[0]]; exists {
+			run(args[1:])
+			return
+		}
+		// Scans are run without a subcommand too
+		if args[0] == scanCommand {
+			args = args[1:]
+		}
+	}
+	setupFlags()
+	_ = flag.CommandLine.Parse(args)
+	flags.applyLanguage()
+	if flags.isHelp() {
+		showHelpAndExit()
+		return
+	}
+	if flags.getVersion() {
+		fmt.Println(finddup.Version)
+		os.Exit(exitCodeSuccess)
+	}
+	flags.applyConfig()
+	flags.applyPreset()
+	flags.applyLimits()
+	// The configuration file may set the language too
+	flags.applyLanguage()
+
+	defer handlePanic()
+
+	directories, fsys := readDirectories()
+	stopProfiling := flags.startProfiling()
+	defer stopProfiling()
+	schedule, isScheduled := flags.getSchedule()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s := &scanner{directories: directories, fsys: fsys, notifiers: flags.getNotifiers(), cache: flags.getCache(),
+		stop: stop}
+	if s.cache != nil {
+		defer s.cache.Close()
+	}
+	if addr := flags.getMetricsAddr(); addr != "" {
+		s.metrics = service.NewScanMetrics(serveMetrics(addr))
+	}
+	if isScheduled {
+		if flag.CommandLine.Changed(runIDFlag) {
+			fmte.PrintfErr("error: --%s can't be used with --schedule, as every scheduled scan needs an ID of its own\n",
+				runIDFlag)
+			os.Exit(exitCodeInvalidRunMetadata)
+		}
+		runScheduled(ctx, schedule, s, flags.getReportNaming(), flags.getKeepReports())
+		return
+	}
+	result, exitCode := s.run(ctx)
+	// Profiles are of the scan alone, and are saved before exiting (which skips deferred calls)
+	stopProfiling()
+	if exitCode != exitCodeSuccess {
+		os.Exit(exitCode)
+	}
+	if addr := flags.getWebAddr(); addr != "" {
+		serveWeb(addr, result, fsys)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	flag "github.com/spf13/pflag"
+)
+
+// runMerge runs the "merge" subcommand, which reports duplicates across hosts of digests exported on each (by
+// --export-digests)
+func runMerge(args []string) {
+	fs := flag.NewFlagSet(mergeCommand, flag.ContinueOnError)
+	output := fs.StringP("output", "o", entity.OutputModeTextFile,
+		"output mode of the report, one of: "+strings.Join(outputModeNames(), ", "))
+	includeLocal := fs.Bool("include-local", false,
+		"also report groups of duplicates of files on one host alone, rather than only those across hosts")
+	getNaming := setupReportNamingOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s combines digests exported on several hosts (by --export-digests) into one report of
+duplicates across them, e.g. to find data duplicated across a fleet of file servers, without contents
+being transferred. Paths of the report are prefixed by their hosts (as host:path), and digests must be
+by the same hashing algorithm.
+
+Usage:
+  go-find-duplicates %s [flags] <host-1.digests> <host-2.digests> ... <host-n.digests>
+`, mergeCommand, mergeCommand))
+	if fs.NArg() < 2 {
+		fmte.PrintfErr("error: at least two digest files should be passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	outputMode := strings.ToLower(strings.TrimSpace(*output))
+	if _, exists := entity.OutputModes[outputMode]; !exists || outputMode == entity.OutputModeSHA256Sum {
+		fmte.PrintfErr("error: invalid output mode '%s'\n", outputMode)
+		os.Exit(exitCodeInvalidOutputMode)
+	}
+	indexes := make([]*entity.DigestIndex, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		index, err := entity.LoadDigestIndex(path)
+		if err != nil {
+			fmte.PrintfErr("error: couldn't load digests: %+v\n", err)
+			os.Exit(exitCodeInvalidDigests)
+		}
+		// Digests exported without host names are told apart by their files
+		if index.Host == "" {
+			index.Host = filepath.Base(path)
+		}
+		fmte.Printf("Loaded digests of %d files of %s (using %s hash).\n", len(index.Digests), index.Host,
+			index.Algorithm)
+		indexes = append(indexes, index)
+	}
+	duplicates, files, err := entity.MergeDigestIndexes(indexes, !*includeLocal)
+	if err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		os.Exit(exitCodeInvalidDigests)
+	}
+	if duplicates.Size() == 0 {
+		fmte.Printf("No duplicates found!\n")
+		return
+	}
+	count, savings := 0, int64(0)
+	for digest, paths := range duplicates.All() {
+		count += len(paths) - 1
+		savings += int64(len(paths)-1) * digest.FileSize
+	}
+	fmte.Printf("Found %d duplicates. A total of %s can be saved by removing them.\n", count,
+		bytesutil.BinaryFormat(savings))
+	runID := generateRunID()
+	reportFileName, err := checkReportFileIfApplicable(getNaming(), runID, outputMode)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't create report file: %+v\n", err)
+		os.Exit(exitCodeReportFileCreationFailed)
+	}
+	// Digests have no modification times of files
+	times := timeFormat{layout: time.RFC3339Nano, location: time.Local}
+	if err := reportDuplicates(duplicates, outputMode, files, indexes[0].Algorithm, runID, nil, times,
+		reportFileName); err != nil {
+		fmte.PrintfErr("error while reporting to file: %+v\n", err)
+		os.Exit(exitCodeWritingToReportFileFailed)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/pkg/metrics"
+)
+
+// serveMetrics serves metrics registered in the returned registry at addr, in the text format of Prometheus at
+// /metrics and through expvar at /debug/vars, until the program exits
+func serveMetrics(addr string) *metrics.Registry {
+	registry := metrics.NewRegistry()
+	registry.PublishExpvar("finddup")
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	mux.Handle("/debug/vars", expvar.Handler())
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't serve metrics: %+v\n", err)
+		os.Exit(exitCodeMetricsServerFailed)
+	}
+	fmte.Printf("Serving metrics at http://%s/metrics\n", listener.Addr())
+	go func() {
+		_ = http.Serve(listener, mux)
+	}()
+	return registry
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/music"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+const musicCommand = "music"
+
+// runMusic runs the "music" subcommand, which finds copies of the same recordings across formats and bitrates
+func runMusic(args []string) {
+	fs := flag.NewFlagSet(musicCommand, flag.ContinueOnError)
+	tolerance := fs.Duration("duration-tolerance", 2*time.Second,
+		"maximum difference between durations of copies of a recording, which differ a little by how they\n"+
+			"were encoded")
+	outputMode := fs.StringP("output", "o", entity.OutputModeTextFile,
+		fmt.Sprintf("output mode, one of: %s, %s, %s, %s", entity.OutputModeTextFile, entity.OutputModeCsvFile,
+			entity.OutputModeJSON, entity.OutputModeStdOut))
+	workers := fs.IntP("parallelism", "p", service.DefaultParallelism(), "number of tracks read concurrently")
+	getNaming := setupReportNamingOpts(fs)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s finds copies of the same recordings across formats and bitrates (FLAC and MP3),
+such as FLAC masters and MP3s transcoded from them: tracks of the same artist and title, as their tags
+have them, of durations that match. Copies of each recording are reported best first (lossless ones,
+then those of the highest bitrates), the best marked, so that rules of which copies to keep can prefer it.
+
+Usage:
+  go-find-duplicates %s [flags] <dir-1> <dir-2> ... <dir-n>
+`, musicCommand, musicCommand))
+	if fs.NArg() < 1 {
+		fmte.PrintfErr("error: no directories passed\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *tolerance < 0 {
+		fmte.PrintfErr("error: --duration-tolerance shouldn't be negative\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidMusicOpts)
+	}
+	switch *outputMode {
+	case entity.OutputModeTextFile, entity.OutputModeCsvFile, entity.OutputModeJSON, entity.OutputModeStdOut:
+	default:
+		fmte.PrintfErr("error: invalid output mode '%s'\n", *outputMode)
+		fs.Usage()
+		os.Exit(exitCodeInvalidOutputMode)
+	}
+	naming := getNaming()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmte.Printf("Reading tracks of %d directories...\n", fs.NArg())
+	skipped := 0
+	tracks, err := music.Collect(ctx, vfs.Local, fs.Args(), *workers, func(path string, err error) {
+		skipped++
+		fmte.PrintfErr("skipping %s: %v\n", path, err)
+	})
+	if errors.Is(err, context.Canceled) {
+		fmte.Printf("Scan cancelled.\n")
+		os.Exit(exitCodeScanInterrupted)
+	} else if err != nil {
+		fmte.PrintfErr("error: couldn't read directories: %+v\n", err)
+		os.Exit(exitCodeInputDirectoryNotReadable)
+	}
+	fmte.Printf("Read %d tracks, %d skipped.\n", len(tracks), skipped)
+	recordings := music.Find(tracks, *tolerance)
+	if len(recordings) == 0 {
+		fmte.Printf("No recordings of several copies found!\n")
+		return
+	}
+	copies := 0
+	for _, recording := range recordings {
+		copies += len(recording)
+	}
+	fmte.Printf("Found %d recordings of %d copies in all.\n", len(recordings), copies)
+	if err := reportRecordings(recordings, *outputMode, naming, generateRunID()); err != nil {
+		fmte.PrintfErr("error while reporting recordings: %+v\n", err)
+		os.Exit(exitCodeWritingToReportFileFailed)
+	}
+}
+
+// reportRecordings reports copies of recordings in the output mode, in a report file of the run (unless in mode
+// stdout)
+func reportRecordings(recordings []music.Recording, outputMode string, naming reportNaming, runID string) error {
+	var bb bytes.Buffer
+	reportFileName := naming.fileName(reportKindMusic, runID, ".txt")
+	switch outputMode {
+	case entity.OutputModeCsvFile:
+		reportFileName = naming.fileName(reportKindMusic, runID, ".csv")
+		cf := csv.NewWriter(&bb)
+		cf.Write([]string{"recording", "file path", "artist", "title", "duration", "format", "bitrate", "sample rate",
+			"bit depth", "lossless", "best"})
+		for i, recording := range recordings {
+			for _, track := range recording {
+				cf.Write([]string{strconv.Itoa(i + 1), track.Path, track.Artist, track.Title,
+					strconv.FormatFloat(track.Duration.Seconds(), 'f', 3, 64), track.Format,
+					strconv.Itoa(track.Bitrate), strconv.Itoa(track.SampleRate), strconv.Itoa(track.BitDepth),
+					strconv.FormatBool(track.Lossless), strconv.FormatBool(track.Best)})
+			}
+		}
+		cf.Flush()
+	case entity.OutputModeJSON:
+		reportFileName = naming.fileName(reportKindMusic, runID, ".json")
+		jsonBytes, _ := json.Marshal(recordings)
+		bb.Write(jsonBytes)
+	default:
+		for _, recording := range recordings {
+			bb.WriteString(fmt.Sprintf("%q by %s, %d copies of %s:\n", recording[0].Title, recording[0].Artist,
+				len(recording), recording[0].Duration.Round(time.Second)))
+			for _, track := range recording {
+				best := ""
+				if track.Best {
+					best = " [best]"
+				}
+				bb.WriteString(fmt.Sprintf("\t%s (%s)%s\n", track.Path, track.Quality(), best))
+			}
+		}
+	}
+	if outputMode == entity.OutputModeStdOut {
+		fmt.Print(bb.String())
+		return nil
+	}
+	if err := writeReportFile(reportFileName, bb.Bytes()); err != nil {
+		return err
+	}
+	fmte.Printf("View report of copies of recordings here: %s\n", reportFileName)
+	return nil
+}
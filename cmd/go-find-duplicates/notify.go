@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/notify"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+const (
+	// notifyTimeout is how long sending all notifications of a scan may take
+	notifyTimeout = time.Minute
+	// notifyTopGroups is the number of groups of duplicates listed in notifications
+	notifyTopGroups = 5
+)
+
+// newSummary summarizes the scan (of the run with labels) of directories that started at startedAt, and either
+// produced result (reported to reportFileName, unless that's empty) or failed with err
+func newSummary(runID string, labels entity.Labels, directories []string, startedAt time.Time, result service.Result,
+	reportFileName string, err error) notify.Summary {
+	host, _ := os.Hostname()
+	s := notify.Summary{
+		RunID:          runID,
+		Labels:         labels,
+		Host:           host,
+		Directories:    directories,
+		StartedAt:      startedAt,
+		FinishedAt:     time.Now(),
+		Files:          result.FileCount,
+		DuplicateCount: result.DuplicateTotalCount,
+		SavingsSize:    result.SavingsSize,
+	}
+	if result.Duplicates != nil {
+		s.Groups = result.Duplicates.Size()
+		s.TopGroups = notify.TopGroups(result.Duplicates, notifyTopGroups)
+	}
+	if reportFileName != "" {
+		if abs, absErr := filepath.Abs(reportFileName); absErr == nil {
+			reportFileName = abs
+		}
+		s.ReportFile = reportFileName
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s
+}
+
+// sendNotifications sends s through notifiers. Failing to do so is reported, but doesn't fail the program.
+func sendNotifications(notifiers []notify.Notifier, s notify.Summary) {
+	if len(notifiers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := notify.All(ctx, notifiers, s); err != nil {
+		fmte.PrintfErr("error while sending notifications: %+v\n", err)
+	}
+}
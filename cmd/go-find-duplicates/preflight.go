@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/storage"
+)
+
+// minFreeSpace is how much free space directories that reports are saved to should have, so that reports of large
+// scans fit
+const minFreeSpace = 16 * bytesutil.MEBI
+
+// preflight checks, before a scan starts, whatever would make it fail once it finishes (which may be hours later):
+// that reports, the manifest and exported digests can be saved, and that duplicates can be moved to trash, if they're
+// to be. It returns the code this program should exit with if a check fails.
+func preflight() int {
+	dirs := []string{flags.getReportNaming().dir}
+	for _, path := range []string{flags.getManifestFile(), flags.getExportFile()} {
+		if path != "" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+	for _, dir := range dirs {
+		if err := checkWritable(dir); err != nil {
+			fmte.PrintfErr("error: can't save reports in %s: %+v\n", dir, err)
+			return exitCodeReportFileCreationFailed
+		}
+		if free, err := storage.FreeSpace(dir); err == nil && free < minFreeSpace {
+			fmte.PrintfErr("error: can't save reports in %s, which has only %s free\n", dir,
+				bytesutil.BinaryFormat(free))
+			return exitCodeReportFileCreationFailed
+		}
+	}
+	if action, enabled := flags.getAction(); enabled && action == actions.Trash && !flags.isDryRun() {
+		trash, err := actions.TrashFilesDir("")
+		if err == nil {
+			err = checkWritable(trash)
+		}
+		if err != nil {
+			fmte.PrintfErr("error: can't move duplicates to trash: %+v\n", err)
+			return exitCodeInvalidAction
+		}
+	}
+	return exitCodeSuccess
+}
+
+// checkTrashSpace checks, right before duplicates are moved to trash as per opts, whether trashes have enough free
+// space for those that would be copied into them (see actions.CheckTrashSpace), which preflight can't know of before
+// the scan. It logs why if they don't.
+func checkTrashSpace(duplicates *entity.DigestToFiles, files entity.FilePathToMeta, opts actions.Options) bool {
+	if err := actions.CheckTrashSpace(duplicates, files, opts); err != nil {
+		fmte.PrintfErr("error: can't move duplicates to trash: %+v\n", err)
+		return false
+	}
+	return true
+}
+
+// checkWritable checks whether files can be created in dir, creating it if it doesn't exist
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".go-find-duplicates-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	flag "github.com/spf13/pflag"
+)
+
+// Kinds of profiles of --pprof
+const (
+	profileCPU   = "cpu"
+	profileMem   = "mem"
+	profileTrace = "trace"
+)
+
+// profile is a profile of --pprof: of which kind, and where it's saved
+type profile struct {
+	kind, path string
+}
+
+// parseProfiles parses values of --pprof, which are as kind=path
+func parseProfiles(specs []string) ([]profile, error) {
+	profiles := make([]profile, 0, len(specs))
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		kind, path, found := strings.Cut(spec, "=")
+		if !found || path == "" {
+			return nil, fmt.Errorf("profile \"%s\" isn't as kind=path (e.g. cpu=scan.pprof)", spec)
+		}
+		if kind != profileCPU && kind != profileMem && kind != profileTrace {
+			return nil, fmt.Errorf("kind of profile \"%s\" isn't one of %s, %s and %s", kind, profileCPU, profileMem,
+				profileTrace)
+		}
+		if seen[kind] {
+			return nil, fmt.Errorf("%s profile is set more than once", kind)
+		}
+		seen[kind] = true
+		profiles = append(profiles, profile{kind: kind, path: path})
+	}
+	return profiles, nil
+}
+
+func setupProfileOpts() {
+	specs := flag.StringArray("pprof", nil,
+		"profile to capture during the scan, as kind=path, where kind is cpu, mem (of the heap, at the end\n"+
+			"of the scan) or trace (an execution trace), e.g. cpu=scan.pprof (may be repeated)")
+	listen := flag.String("pprof-listen", "",
+		"address (e.g. localhost:6060) at which to serve profiles of pprof at /debug/pprof/ while the\n"+
+			"program runs")
+	flags.startProfiling = func() (stop func()) {
+		profiles, err := parseProfiles(*specs)
+		if err != nil {
+			fmte.PrintfErr("error: %v\n", err)
+			os.Exit(exitCodeProfilingFailed)
+		}
+		if *listen != "" {
+			servePprof(*listen)
+		}
+		return startProfiles(profiles)
+	}
+}
+
+// servePprof serves profiles of pprof at /debug/pprof/ at addr, until the program exits
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't serve profiles: %+v\n", err)
+		os.Exit(exitCodeProfilingFailed)
+	}
+	fmte.Printf("Serving profiles at http://%s/debug/pprof/\n", listener.Addr())
+	go func() {
+		_ = http.Serve(listener, mux)
+	}()
+}
+
+// startProfiles starts capturing profiles, returning a function that stops capturing them and saves them (which may
+// be called more than once). Files of profiles are created right away, so that unwritable paths fail before a scan
+// rather than after.
+func startProfiles(profiles []profile) (stop func()) {
+	files := make([]*os.File, len(profiles))
+	for i, p := range profiles {
+		f, err := os.Create(p.path)
+		if err == nil {
+			switch p.kind {
+			case profileCPU:
+				err = pprof.StartCPUProfile(f)
+			case profileTrace:
+				err = trace.Start(f)
+			}
+		}
+		if err != nil {
+			fmte.PrintfErr("error: couldn't capture %s profile: %+v\n", p.kind, err)
+			os.Exit(exitCodeProfilingFailed)
+		}
+		files[i] = f
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for i, p := range profiles {
+				var err error
+				switch p.kind {
+				case profileCPU:
+					pprof.StopCPUProfile()
+				case profileTrace:
+					trace.Stop()
+				case profileMem:
+					// Garbage is collected first, so that the profile is of memory that's still in use
+					runtime.GC()
+					err = pprof.WriteHeapProfile(files[i])
+				}
+				if closeErr := files[i].Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					fmte.PrintfErr("warning: couldn't save %s profile: %+v\n", p.kind, err)
+					continue
+				}
+				fmte.Printf("Profile (%s) saved here: %s\n", p.kind, p.path)
+			}
+		})
+	}
+}
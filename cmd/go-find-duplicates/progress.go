@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// scanProgress is a service.ProgressListener that periodically prints the number of files found so far.
+// Without this, there's no output at all while large directory trees are being scanned.
+type scanProgress struct {
+	service.NoOpProgressListener
+	discovered atomic.Int64
+	done       chan struct{}
+}
+
+func newScanProgress() *scanProgress {
+	return &scanProgress{done: make(chan struct{})}
+}
+
+// OnFileDiscovered counts the file found
+func (s *scanProgress) OnFileDiscovered(string, entity.FileMeta) {
+	s.discovered.Add(1)
+}
+
+// start prints progress every few seconds, as long as new files are being found, until stop is called
+func (s *scanProgress) start() {
+	go func() {
+		ticker := time.NewTicker(3 * time.Second)
+		defer ticker.Stop()
+		var reported int64
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if n := s.discovered.Load(); n > reported {
+					fmte.Printf("%d files found so far...\n", n)
+					reported = n
+				}
+			}
+		}
+	}()
+}
+
+// stop stops printing the progress
+func (s *scanProgress) stop() {
+	close(s.done)
+}
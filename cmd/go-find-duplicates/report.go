@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/backup"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+const bytesPerLineGuess = 500
+
+// reportDuplicates reports duplicates found (all at once, e.g. of a manifest) by the hashing algorithm in the output
+// mode
+func reportDuplicates(duplicates *entity.DigestToFiles, outputMode string, allFiles entity.FilePathToMeta,
+	algorithm string, runID string, labels entity.Labels, times timeFormat, reportFileName string,
+) error {
+	report, err := newReportWriter(outputMode, reportFileName, algorithm, runID, labels, times,
+		func(path string) time.Time {
+			return allFiles[path].Modified
+		})
+	if err != nil {
+		return err
+	}
+	for digest, paths := range duplicates.All() {
+		report.writeGroup(digest, paths)
+	}
+	return report.close()
+}
+
+// reportGroup is a group of duplicates as it's in reports in json
+type reportGroup struct {
+	entity.FileDigest
+	// Algorithm is the hashing algorithm of the hash of the group (empty in reports of earlier versions), which apply
+	// verifies files by
+	Algorithm string   `json:"algorithm,omitempty"`
+	Paths     []string `json:"paths"`
+	// Modified is when files of the group were last modified (empty in reports of earlier versions, and of files
+	// whose modification times aren't known), which apply verifies files by too
+	Modified map[string]time.Time `json:"modified,omitempty"`
+}
+
+// reportWriter writes groups of duplicates to a report one after another, as they're found, rather than the whole
+// report at once: reports of very many duplicates then don't need memory for all of them, and groups found before a
+// crash are in the temporary file of the report (see reportFile) already. It may be used by multiple goroutines at
+// once.
+type reportWriter struct {
+	mx         sync.Mutex
+	outputMode string
+	fileName   string
+	// algorithm is the hashing algorithm of hashes of groups, for reports in json
+	algorithm string
+	// f is the report file (nil if the report is printed to standard output)
+	f   *reportFile
+	w   *bufio.Writer
+	csv *csv.Writer
+	// modified returns when a file was last modified (or the zero time, if it isn't known), for reports in csv and
+	// in json
+	modified func(path string) time.Time
+	times    timeFormat
+	// footnote is written at the end of reports in text
+	footnote string
+	// partial is whether the report is of a scan that was interrupted (see markPartial)
+	partial bool
+	groups  int
+	err     error
+}
+
+// newReportWriter creates the report file of the output mode (or prints the report to standard output, in mode
+// stdout) of groups hashed by the algorithm, and writes its header
+func newReportWriter(outputMode, fileName string, algorithm string, runID string, labels entity.Labels,
+	times timeFormat, modified func(path string) time.Time,
+) (*reportWriter, error) {
+	r := &reportWriter{outputMode: outputMode, fileName: fileName, algorithm: algorithm, modified: modified,
+		times: times}
+	if outputMode == entity.OutputModeStdOut {
+		r.w = bufio.NewWriter(os.Stdout)
+	} else {
+		f, err := createReportFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		r.f, r.w = f, bufio.NewWriterSize(f, 64*1024)
+	}
+	switch outputMode {
+	case entity.OutputModeStdOut:
+		r.w.WriteString("\n" + reportHeader(runID, labels))
+	case entity.OutputModeTextFile:
+		r.w.WriteString(reportHeader(runID, labels))
+	case entity.OutputModeCsvFile:
+		r.csv = csv.NewWriter(r.w)
+		r.err = r.csv.Write([]string{"file hash", "file size", "last modified", "file path", "strong hash"})
+	case entity.OutputModeJSON:
+		r.w.WriteString("[")
+	}
+	return r, nil
+}
+
+// writeGroup writes a group of duplicates to the report. Errors are returned by close.
+func (r *reportWriter) writeGroup(digest entity.FileDigest, paths []string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.err != nil {
+		return
+	}
+	switch r.outputMode {
+	case entity.OutputModeCsvFile:
+		for _, path := range paths {
+			if r.err = r.csv.Write([]string{
+				digest.FileHash,
+				strconv.FormatInt(digest.FileSize, 10),
+				r.times.format(r.modified(path)),
+				path,
+				digest.StrongHash,
+			}); r.err != nil {
+				return
+			}
+		}
+	case entity.OutputModeJSON:
+		group := reportGroup{FileDigest: digest, Algorithm: r.algorithm, Paths: paths}
+		for _, path := range paths {
+			if modified := r.modified(path); !modified.IsZero() {
+				if group.Modified == nil {
+					group.Modified = map[string]time.Time{}
+				}
+				group.Modified[path] = modified
+			}
+		}
+		var jsonBytes []byte
+		if jsonBytes, r.err = json.Marshal(group); r.err != nil {
+			return
+		}
+		if r.groups > 0 {
+			r.w.WriteString(",")
+		}
+		_, r.err = r.w.Write(jsonBytes)
+	default:
+		fmt.Fprintf(r.w, "%s: %d duplicate(s)\n", digest, len(paths)-1)
+		for _, path := range paths {
+			_, r.err = fmt.Fprintf(r.w, "\t%s\n", path)
+		}
+	}
+	r.groups++
+}
+
+// note adds a footnote to the report, if it's in text
+func (r *reportWriter) note(footnote string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.footnote = footnote
+}
+
+// markPartial marks the report as being of a scan that was interrupted, which is saved as the report file of the
+// name rather than as that of newReportWriter, and notes so if it's in text
+func (r *reportWriter) markPartial(fileName string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.partial = true
+	if r.f != nil {
+		r.fileName, r.f.name = fileName, fileName
+	}
+}
+
+// close writes the end of the report, and saves its file. It returns the first error writing the report, in which
+// case the report file isn't saved at all.
+func (r *reportWriter) close() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	switch r.outputMode {
+	case entity.OutputModeCsvFile:
+		r.csv.Flush()
+		if err := r.csv.Error(); r.err == nil {
+			r.err = err
+		}
+	case entity.OutputModeJSON:
+		r.w.WriteString("]")
+	default:
+		if r.partial {
+			r.w.WriteString("\nPARTIAL REPORT: the scan was interrupted, so this is of duplicates found until then only\n")
+		}
+		if r.footnote != "" {
+			fmt.Fprintf(r.w, "\n%s\n", r.footnote)
+		}
+	}
+	if err := r.w.Flush(); r.err == nil {
+		r.err = err
+	}
+	if r.f == nil {
+		return r.err
+	}
+	if r.err != nil {
+		r.f.discard()
+		return r.err
+	}
+	if r.err = r.f.commit(); r.err == nil && r.groups > 0 {
+		fmte.Printf("View duplicates report here: %s\n", r.fileName)
+	}
+	return r.err
+}
+
+// reportingListener writes every group of duplicates found by a scan to a report as soon as it's found, and forwards
+// all notifications to the wrapped listener
+type reportingListener struct {
+	service.ProgressListener
+	report *reportWriter
+}
+
+func (l reportingListener) OnGroupFound(digest entity.FileDigest, paths []string) {
+	l.ProgressListener.OnGroupFound(digest, paths)
+	sortedPaths := append([]string(nil), paths...)
+	sort.Strings(sortedPaths)
+	l.report.writeGroup(digest, sortedPaths)
+}
+
+// reportHeader is the header of reports in text, of the run and its labels
+func reportHeader(runID string, labels entity.Labels) string {
+	var sb strings.Builder
+	sb.WriteString("==========================\n")
+	fmt.Fprintf(&sb, "Report (run id %s)\n", runID)
+	if len(labels) > 0 {
+		fmt.Fprintf(&sb, "Labels: %s\n", labels)
+	}
+	sb.WriteString("==========================\n")
+	return sb.String()
+}
+
+// reportExternalMatches reports files of the scan that exist elsewhere too (as where says, e.g. "on nas"), according to
+// digests of --import-digests or --known-hashes, in a report of its own (named like that of duplicates)
+func reportExternalMatches(where string, matches map[string][]string, allFiles entity.FilePathToMeta,
+	outputMode string, runID string,
+) {
+	var totalSize int64
+	paths := make([]string, 0, len(matches))
+	for path, external := range matches {
+		paths = append(paths, path)
+		totalSize += allFiles[path].Size
+		sort.Strings(external)
+	}
+	sort.Strings(paths)
+	fmte.Printf("Found %d files (%s) that exist %s too.\n", len(paths), bytesutil.BinaryFormat(totalSize), where)
+	if len(paths) == 0 {
+		return
+	}
+	var bb bytes.Buffer
+	bb.Grow(len(paths) * bytesPerLineGuess)
+	naming := flags.getReportNaming()
+	reportFileName := naming.fileName(reportKindExisting, runID, ".txt")
+	switch outputMode {
+	case entity.OutputModeCsvFile:
+		reportFileName = naming.fileName(reportKindExisting, runID, ".csv")
+		cf := csv.NewWriter(&bb)
+		cf.Write([]string{"file path", "file size", "path " + where})
+		for _, path := range paths {
+			for _, external := range matches[path] {
+				cf.Write([]string{path, strconv.FormatInt(allFiles[path].Size, 10), external})
+			}
+		}
+		cf.Flush()
+	case entity.OutputModeJSON:
+		reportFileName = naming.fileName(reportKindExisting, runID, ".json")
+		jsonBytes, _ := json.Marshal(matches)
+		bb.Write(jsonBytes)
+	default:
+		for _, path := range paths {
+			bb.WriteString(fmt.Sprintf("%s exists %s as:\n", path, where))
+			for _, external := range matches[path] {
+				bb.WriteString(fmt.Sprintf("\t%s\n", external))
+			}
+		}
+	}
+	if outputMode == entity.OutputModeStdOut {
+		fmt.Print(bb.String())
+		return
+	}
+	if err := writeReportFile(reportFileName, bb.Bytes()); err != nil {
+		fmte.PrintfErr("error while creating report file %s: %+v\n", reportFileName, err)
+		os.Exit(exitCodeErrorCreatingReport)
+	}
+	fmte.Printf("View report of files that exist %s here: %s\n", where, reportFileName)
+}
+
+// reportUnstable reports files that changed while the scan hashed them (and so aren't in groups of duplicates), in a
+// report of its own (named like that of duplicates)
+func reportUnstable(paths []string, outputMode string, runID string) error {
+	fmte.Printf("Found %d files that changed during the scan, left out of groups.\n", len(paths))
+	var bb bytes.Buffer
+	naming := flags.getReportNaming()
+	reportFileName := naming.fileName(reportKindUnstable, runID, ".txt")
+	switch outputMode {
+	case entity.OutputModeCsvFile:
+		reportFileName = naming.fileName(reportKindUnstable, runID, ".csv")
+		cf := csv.NewWriter(&bb)
+		cf.Write([]string{"file path"})
+		for _, path := range paths {
+			cf.Write([]string{path})
+		}
+		cf.Flush()
+	case entity.OutputModeJSON:
+		reportFileName = naming.fileName(reportKindUnstable, runID, ".json")
+		jsonBytes, _ := json.Marshal(paths)
+		bb.Write(jsonBytes)
+	default:
+		bb.WriteString("Files that changed during the scan:\n")
+		for _, path := range paths {
+			bb.WriteString(fmt.Sprintf("\t%s\n", path))
+		}
+	}
+	if outputMode == entity.OutputModeStdOut {
+		fmt.Print(bb.String())
+		return nil
+	}
+	if err := writeReportFile(reportFileName, bb.Bytes()); err != nil {
+		return err
+	}
+	fmte.Printf("View report of files that changed during the scan here: %s\n", reportFileName)
+	return nil
+}
+
+// writeChecksums writes hashes of digests of files (which must be by sha256) as a manifest that sha256sum can verify
+func writeChecksums(fileName string, digests map[string]entity.FileDigest) error {
+	checksums := make(map[string]string, len(digests))
+	for path, digest := range digests {
+		checksums[path] = digest.FileHash
+	}
+	f, err := createReportFile(fileName)
+	if err != nil {
+		return err
+	}
+	if err := entity.WriteChecksums(f, checksums); err != nil {
+		f.discard()
+		return err
+	}
+	return f.commit()
+}
+
+// reportBackedUp reports which files of the scan are fully contained in backups of repo, and which directories
+// that makes safe to delete, in a report of its own (named like that of duplicates)
+func reportBackedUp(ctx context.Context, repo backup.Repository, directories []string, fsys vfs.FS,
+	allFiles entity.FilePathToMeta, outputMode string, runID string,
+) error {
+	fmte.Printf("Checking which files are in %s...\n", repo)
+	contained, err := backup.Check(ctx, repo, fsys, allFiles, flags.getParallelism(), fmte.Global)
+	if err != nil {
+		return err
+	}
+	var containedSize int64
+	var missing []string
+	for path, meta := range allFiles {
+		if contained[path] {
+			containedSize += meta.Size
+		} else {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	dirs := backup.ContainedDirs(directories, allFiles, contained)
+	fmte.Printf("Found %d files (%s) that are fully contained in %s, and %d that aren't.\n",
+		len(allFiles)-len(missing), bytesutil.BinaryFormat(containedSize), repo, len(missing))
+	var bb bytes.Buffer
+	bb.WriteString(fmt.Sprintf("Directories whose files are all in %s:\n", repo))
+	for _, dir := range dirs {
+		bb.WriteString(fmt.Sprintf("\t%s\n", dir))
+	}
+	bb.WriteString(fmt.Sprintf("Files that aren't in %s:\n", repo))
+	for _, path := range missing {
+		bb.WriteString(fmt.Sprintf("\t%s\n", path))
+	}
+	if outputMode == entity.OutputModeStdOut {
+		fmt.Print(bb.String())
+		return nil
+	}
+	reportFileName := flags.getReportNaming().fileName(reportKindBackedUp, runID, ".txt")
+	if err := writeReportFile(reportFileName, bb.Bytes()); err != nil {
+		return err
+	}
+	fmte.Printf("View report of files in backups here: %s\n", reportFileName)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// reportFile is a report file being written. It's written to a temporary file next to it, which is synced and then
+// renamed to it once it's written entirely: a report is then either complete or not there at all, rather than empty
+// or cut short (say, when the disk fills up while it's written).
+type reportFile struct {
+	*os.File
+	name string
+}
+
+// reportTempName is the name of the temporary file of a report file of the name
+func reportTempName(name string) string {
+	return filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+}
+
+// reportFileExists checks whether a report file of the name exists, or is being written (by its temporary file)
+func reportFileExists(name string) bool {
+	for _, path := range []string{name, reportTempName(name)} {
+		if _, err := os.Lstat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// createReportFile creates the temporary file of a report file of the name. The temporary file is of a name of its
+// own if that of reportTempName is taken (say, of a run that crashed, or of another run of the same report file with
+// --overwrite).
+func createReportFile(name string) (*reportFile, error) {
+	f, err := os.OpenFile(reportTempName(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		if f, err = os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*"); err == nil {
+			// Temporary files are created readable by their owner only, unlike report files
+			if err = f.Chmod(0o644); err != nil {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reportFile{File: f, name: name}, nil
+}
+
+// commit syncs and closes the temporary file, and renames it to the report file. The temporary file is removed if any
+// of that fails.
+func (f *reportFile) commit() error {
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// discard closes and removes the temporary file, leaving the report file as it was
+func (f *reportFile) discard() {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+// writeReportFile writes a report file of the name, as createReportFile and commit do
+func writeReportFile(name string, data []byte) error {
+	f, err := createReportFile(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.discard()
+		return err
+	}
+	return f.commit()
+}
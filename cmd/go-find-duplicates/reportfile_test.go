@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReportFileCommit checks whether a report file is only there once committed, replacing any report of its name
+func TestReportFileCommit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "report.txt")
+	assert.Nil(t, os.WriteFile(name, []byte("previous"), 0o644))
+	f, err := createReportFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, reportTempName(name), f.Name())
+	_, err = f.WriteString("report")
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "previous", string(data))
+	assert.Nil(t, f.commit())
+	data, _ = os.ReadFile(name)
+	assert.Equal(t, "report", string(data))
+	assert.NoFileExists(t, reportTempName(name))
+}
+
+// TestReportFileLeftoverTemp checks whether a temporary file left over (say, by a run that crashed) is left alone,
+// and a report file written by one of a name of its own
+func TestReportFileLeftoverTemp(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "report.txt")
+	assert.False(t, reportFileExists(name))
+	assert.Nil(t, os.WriteFile(reportTempName(name), []byte("leftover"), 0o644))
+	assert.True(t, reportFileExists(name))
+	f, err := createReportFile(name)
+	assert.Nil(t, err)
+	assert.NotEqual(t, reportTempName(name), f.Name())
+	info, err := f.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+	_, err = f.WriteString("report")
+	assert.Nil(t, err)
+	assert.Nil(t, f.commit())
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "report", string(data))
+	data, _ = os.ReadFile(reportTempName(name))
+	assert.Equal(t, "leftover", string(data))
+}
+
+// TestReportFileFailure checks whether report files are left as they were, and temporary files removed, when writing
+// them or renaming them fails
+func TestReportFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "report.txt")
+	assert.Nil(t, os.WriteFile(name, []byte("previous"), 0o644))
+
+	// A write that fails
+	f, err := createReportFile(name)
+	assert.Nil(t, err)
+	assert.Nil(t, f.File.Close())
+	_, err = f.WriteString("report")
+	assert.NotNil(t, err)
+	f.discard()
+	assert.NoFileExists(t, reportTempName(name))
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "previous", string(data))
+
+	// A rename that fails, as the report file is a directory
+	taken := filepath.Join(dir, "taken")
+	assert.Nil(t, os.MkdirAll(filepath.Join(taken, "entry"), 0o755))
+	f, err = createReportFile(taken)
+	assert.Nil(t, err)
+	assert.NotNil(t, f.commit())
+	assert.NoFileExists(t, reportTempName(taken))
+	assert.DirExists(t, filepath.Join(taken, "entry"))
+
+	// A report file of a directory that doesn't exist
+	assert.NotNil(t, writeReportFile(filepath.Join(dir, "missing", "report.txt"), []byte("report")))
+}
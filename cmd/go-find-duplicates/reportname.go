@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	flag "github.com/spf13/pflag"
+)
+
+// Kinds of reports, which are what {mode} of templates of names of report files is replaced by
+const (
+	reportKindDuplicates = "duplicates"
+	reportKindChecksums  = "sha256sums"
+	reportKindExisting   = "existing"
+	reportKindBackedUp   = "backedup"
+	reportKindPlanned    = "planned"
+	reportKindUnstable   = "unstable"
+	reportKindPartial    = "partial"    // of duplicates found by scans until they were interrupted
+	reportKindCheckpoint = "checkpoint" // of hashes computed by scans until they were interrupted (see saveCheckpoint)
+	reportKindBursts     = "bursts"     // of bursts of photos (see runBursts)
+	reportKindMusic      = "music"      // of copies of recordings across formats (see runMusic)
+)
+
+const (
+	defaultReportNameTemplate = "{mode}_{runid}"
+	reportKindPlaceholder     = "{mode}"
+	runIDPlaceholder          = "{runid}"
+)
+
+// reportNaming is where report files are created, and how they're named
+type reportNaming struct {
+	dir      string
+	template string
+	// overwrite is whether report files of the same names as existing ones replace them, rather than being suffixed
+	overwrite bool
+}
+
+// setupReportNamingOpts adds flags of where report files are created, and how they're named, to fs. The function
+// returned validates them, and creates the directory if it doesn't exist.
+func setupReportNamingOpts(fs *flag.FlagSet) func() reportNaming {
+	dir := fs.String("report-dir", ".", "directory to create report files in (created if it doesn't exist)")
+	template := fs.String("report-name-template", defaultReportNameTemplate,
+		"template of names of report files (without extensions), in which "+reportKindPlaceholder+" is replaced by\n"+
+			"the kind of report (e.g. "+reportKindDuplicates+") and "+runIDPlaceholder+" by the ID of the run")
+	overwrite := fs.Bool("overwrite", false,
+		"overwrite report files of the same names as new ones (e.g. of runs of the same ID), rather than\n"+
+			"suffixing names of new ones with -1, -2 and so on")
+	return func() reportNaming {
+		if strings.TrimSpace(*template) == "" || strings.ContainsAny(*template, `/\`) {
+			fmte.PrintfErr("error: template of names of report files %q should be a file name, without separators\n",
+				*template)
+			os.Exit(exitCodeInvalidReportName)
+		}
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			fmte.PrintfErr("error: couldn't create directory of reports: %+v\n", err)
+			os.Exit(exitCodeReportFileCreationFailed)
+		}
+		return reportNaming{dir: *dir, template: *template, overwrite: *overwrite}
+	}
+}
+
+// fileName returns the path of the report file of kind of the run, with extension ext. Unless files are to be
+// overwritten, the name is suffixed with -1, -2 and so on if a report file of it exists already (or is being written,
+// say, by a run in the same second), so that no report is replaced by another.
+func (n reportNaming) fileName(kind, runID, ext string) string {
+	name := filepath.Join(n.dir, strings.NewReplacer(reportKindPlaceholder, kind, runIDPlaceholder, runID).Replace(
+		n.template))
+	if n.overwrite {
+		return name + ext
+	}
+	fileName := name + ext
+	for i := 1; reportFileExists(fileName); i++ {
+		fileName = fmt.Sprintf("%s-%d%s", name, i, ext)
+	}
+	return fileName
+}
+
+// pattern matches names of report files of runs, whose submatch "runid" is the run ID (which is missing if the
+// template has none), and "suffix" that of names that were taken (see fileName)
+func (n reportNaming) pattern() *regexp.Regexp {
+	kinds := strings.Join([]string{reportKindDuplicates, reportKindChecksums, reportKindExisting,
+		reportKindBackedUp, reportKindPlanned, reportKindUnstable, reportKindPartial}, "|")
+	name := strings.NewReplacer(
+		regexp.QuoteMeta(reportKindPlaceholder), fmt.Sprintf("(?:%s)", kinds),
+		regexp.QuoteMeta(runIDPlaceholder), `(?P<runid>\d{6}_\d{6})`,
+	).Replace(regexp.QuoteMeta(n.template))
+	return regexp.MustCompile(`^` + name + `(?P<suffix>-\d+)?\.(?:txt|csv|json)$`)
+}
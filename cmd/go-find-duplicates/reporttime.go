@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	defaultTimeFormat = "rfc3339nano"
+	// unixTimeFormat formats times as seconds since the Unix epoch
+	unixTimeFormat = "unix"
+)
+
+// namedTimeFormats are layouts of times that --time-format accepts by name
+var namedTimeFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"datetime":    time.DateTime,
+	"rfc1123":     time.RFC1123,
+}
+
+// timeFormat is how times are written in reports
+type timeFormat struct {
+	// layout is a layout of package time, or unixTimeFormat
+	layout   string
+	location *time.Location
+}
+
+// setupTimeFormatOpts adds flags of how times are written in reports to fs. The function returned validates them.
+func setupTimeFormatOpts(fs *flag.FlagSet) func() timeFormat {
+	names := make([]string, 0, len(namedTimeFormats)+1)
+	for name := range namedTimeFormats {
+		names = append(names, name)
+	}
+	names = append(names, unixTimeFormat)
+	sort.Strings(names)
+	layout := fs.String("time-format", defaultTimeFormat,
+		"format of times in reports, as a layout of Go (e.g. \"2006-01-02 15:04:05\") or one of:\n"+
+			strings.Join(names, ", "))
+	timezone := fs.String("timezone", "Local",
+		"timezone of times in reports, e.g. UTC or America/New_York (defaults to that of the system)")
+	return func() timeFormat {
+		location, err := time.LoadLocation(*timezone)
+		if err != nil {
+			fmte.PrintfErr("error: invalid timezone %q: %v\n", *timezone, err)
+			os.Exit(exitCodeInvalidTimeFormat)
+		}
+		name := strings.ToLower(strings.TrimSpace(*layout))
+		if named, exists := namedTimeFormats[name]; exists {
+			return timeFormat{layout: named, location: location}
+		}
+		if name == unixTimeFormat {
+			return timeFormat{layout: unixTimeFormat, location: location}
+		}
+		// Layouts without elements of times format all times the same
+		first := time.Date(2001, time.February, 3, 4, 5, 6, 7_000_000, time.UTC)
+		second := time.Date(2012, time.November, 11, 16, 17, 18, 900_000_000, time.FixedZone("IST", 19_800))
+		if first.Format(*layout) == second.Format(*layout) {
+			fmte.PrintfErr("error: format of times %q has no elements of times, such as 2006 or 15\n", *layout)
+			os.Exit(exitCodeInvalidTimeFormat)
+		}
+		return timeFormat{layout: *layout, location: location}
+	}
+}
+
+// format formats t. Times that aren't known (such as of files of digest indexes, which don't have them) are empty.
+func (f timeFormat) format(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	if f.layout == unixTimeFormat {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.In(f.location).Format(f.layout)
+}
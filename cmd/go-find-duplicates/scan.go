@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/backup"
+	"github.com/m-manu/go-find-duplicates/internal/ignorefile"
+	"github.com/m-manu/go-find-duplicates/internal/notify"
+	"github.com/m-manu/go-find-duplicates/internal/storage"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// scanner runs scans of directories as set by flags, and reports and acts upon their duplicates
+type scanner struct {
+	directories []string
+	fsys        vfs.FS
+	notifiers   []notify.Notifier
+	cache       digestcache.Store
+	metrics     *service.ScanMetrics
+	// stop restores default behaviour of signals, once a scan has been interrupted
+	stop func()
+}
+
+// ioWorkersByDevice returns the device that dir is on, and as many workers to read files from it as suit its kind
+// of storage (unless --io-workers is set)
+func ioWorkersByDevice(dir string) (string, int) {
+	device := storage.Detect(dir)
+	workers := device.Kind.ReadWorkers()
+	if workers > 0 {
+		fmte.Printf("Reading %s (on %s storage) with %d workers\n", dir, device.Kind, workers)
+	}
+	return device.ID, workers
+}
+
+// modified returns when a file was last modified, or the zero time if it can't be statted
+func (s *scanner) modified(path string) time.Time {
+	info, err := s.fsys.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// checkpoint saves a checkpoint of a scan that was interrupted (see saveCheckpoint), unless hashes of the scan are
+// cached already, so that the scan can be resumed without hashing files again
+func (s *scanner) checkpoint(runID string, hasher service.Hasher, result service.Result) {
+	if s.cache != nil {
+		fmte.PrintfErr("Hashes computed so far are cached, so running the scan again resumes it.\n")
+		return
+	}
+	fileName, err := saveCheckpoint(flags.getReportNaming(), runID, hasher.Name(), result)
+	if err != nil {
+		fmte.PrintfErr("error while saving checkpoint of the scan: %+v\n", err)
+	} else if fileName != "" {
+		fmte.PrintfErr("Checkpoint of the scan saved here, which resumes it when passed as --cache: %s\n", fileName)
+	}
+}
+
+// run runs a scan, returning its result and the code this program should exit with
+func (s *scanner) run(ctx context.Context) (service.Result, int) {
+	runID := flags.getRunID()
+	labels := flags.getLabels()
+	times := flags.getTimeFormat()
+	outputMode := flags.getOutputMode()
+	if code := preflight(); code != exitCodeSuccess {
+		return service.Result{}, code
+	}
+	var repo backup.Repository
+	if spec := flags.getBackup(); spec != "" {
+		var err error
+		if repo, err = backup.Open(ctx, spec); err != nil {
+			fmte.PrintfErr("error: couldn't read backups: %+v\n", err)
+			return service.Result{}, exitCodeReadingBackupsFailed
+		}
+	}
+	reportFileName, err := checkReportFileIfApplicable(flags.getReportNaming(), runID, outputMode)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't create report file: %+v\n", err)
+		return service.Result{}, exitCodeReportFileCreationFailed
+	}
+	hasher := flags.getHasher()
+	imported := flags.getImported()
+	exportFile := flags.getExportFile()
+	progress := newScanProgress()
+	var listener service.ProgressListener = progress
+	var report *reportWriter
+	if outputMode != entity.OutputModeStdOut && outputMode != entity.OutputModeSHA256Sum {
+		// Groups are written to the report file as soon as they're found, rather than once the scan is done
+		report, err = newReportWriter(outputMode, reportFileName, hasher.Name(), runID, labels, times, s.modified)
+		if err != nil {
+			fmte.PrintfErr("error: couldn't create report file: %+v\n", err)
+			return service.Result{}, exitCodeReportFileCreationFailed
+		}
+		listener = reportingListener{ProgressListener: progress, report: report}
+	}
+	if !flags.isCI() {
+		progress.start()
+	}
+	// Policies are created afresh for every scan, so that scheduled scans see changes of .gitignore and .dupignore
+	// files
+	git := flags.getGitPolicy(s.fsys)
+	dupignore := ignorefile.NewTree(s.fsys, ignorefile.DupignoreFileName)
+	metrics := s.metrics
+	if metrics == nil {
+		metrics = service.NewScanMetrics(nil)
+	}
+	statsBefore := takeStats(metrics)
+	scanOpts := []service.Option{
+		service.WithFS(s.fsys),
+		service.WithExcludedFiles(flags.getExcludedFiles()),
+		service.WithFileSizeThreshold(flags.getMinSize()),
+		service.WithParallelism(flags.getParallelism()),
+		service.WithIOWorkers(flags.getIOWorkers()),
+		service.WithWalkWorkers(flags.getWalkWorkers()),
+		service.WithIOWorkersByDevice(ioWorkersByDevice),
+		service.WithHasher(hasher),
+		service.WithVerifier(flags.getVerifier()),
+		service.WithListener(listener),
+		service.WithCache(s.cache),
+		service.WithMetrics(metrics),
+		service.WithHashAllFiles(exportFile != "" || outputMode == entity.OutputModeSHA256Sum),
+		service.WithExternalDigests(imported),
+		service.WithFollowSymlinks(flags.getSymlinkPolicy() == symlinksFollow),
+		service.WithReportSymlinks(flags.getSymlinkPolicy() == symlinksReport),
+		service.WithSpillAfter(flags.getSpillAfter()),
+		service.WithMaxOpenFiles(flags.getMaxOpenFiles()),
+		service.WithFileFilter(git.FileFilter),
+		service.WithFileFilter(dupignore.FileFilter(s.directories)),
+		service.WithGroupFilter(git.GroupFilter),
+	}
+	if extensions := flags.getExtensions(); len(extensions) > 0 {
+		scanOpts = append(scanOpts, service.WithFileFilter(service.ExtensionFilter(extensions...)))
+	}
+	startedAt := time.Now()
+	result, fdErr := service.FindDuplicates(ctx, service.NewOptions(s.directories, scanOpts...))
+	progress.stop()
+	reportStartedAt := time.Now()
+	interrupted := errors.Is(fdErr, context.Canceled)
+	if interrupted {
+		// Restore default signal behaviour, so that a second interrupt kills the program right away
+		s.stop()
+		fmte.PrintfErr("scan interrupted: reporting duplicates found so far, in a partial report\n")
+		if reportFileName != "" {
+			reportFileName = flags.getReportNaming().fileName(reportKindPartial, runID, filepath.Ext(reportFileName))
+		}
+		if report != nil {
+			report.markPartial(reportFileName)
+		}
+		s.checkpoint(runID, hasher, result)
+	} else if errors.Is(fdErr, service.ErrNotReadable) {
+		fmte.PrintfErr("error: %+v\n", fdErr)
+		if report != nil {
+			_ = report.close()
+		}
+		sendNotifications(s.notifiers, newSummary(runID, labels, s.directories, startedAt, result, "", fdErr))
+		return result, exitCodeInputDirectoryNotReadable
+	} else if fdErr != nil {
+		fmte.PrintfErr("error while finding duplicates: %+v\n", fdErr)
+		if report != nil {
+			_ = report.close()
+		}
+		sendNotifications(s.notifiers, newSummary(runID, labels, s.directories, startedAt, result, "", fdErr))
+		return result, exitCodeErrorFindingDuplicates
+	}
+	if manifestFile := flags.getManifestFile(); manifestFile != "" {
+		run := entity.RunMetadata{
+			RunID:       runID,
+			Directories: s.directories,
+			Algorithm:   hasher.Name(),
+			StartedAt:   startedAt,
+			FinishedAt:  time.Now(),
+			Labels:      labels,
+		}
+		manifest := entity.NewManifest(run, result.AllFiles, result.Digests, result.Duplicates)
+		if err := entity.SaveManifest(manifestFile, manifest); err != nil {
+			fmte.PrintfErr("error while saving manifest: %+v\n", err)
+			return result, exitCodeWritingManifestFailed
+		}
+		fmte.Printf("Manifest of the scan saved here: %s\n", manifestFile)
+	}
+	if exportFile != "" {
+		if err := exportDigests(exportFile, s.directories, hasher, result.Digests); err != nil {
+			fmte.PrintfErr("error while exporting digests: %+v\n", err)
+			return result, exitCodeWritingDigestsFailed
+		}
+	}
+	if imported != nil {
+		reportExternalMatches(flags.getImportedFrom(), result.ExternalMatches, result.AllFiles, outputMode, runID)
+	}
+	if outputMode == entity.OutputModeSHA256Sum {
+		// Checksums are of all files, so they're written even if there are no duplicates
+		if err := writeChecksums(reportFileName, result.Digests); err != nil {
+			fmte.PrintfErr("error while writing checksums: %+v\n", err)
+			return result, exitCodeWritingToReportFileFailed
+		}
+		fmte.Printf("Checksums of %d files saved here: %s\n", len(result.Digests), reportFileName)
+	}
+	if len(result.Unstable) > 0 {
+		if err := reportUnstable(result.Unstable, outputMode, runID); err != nil {
+			fmte.PrintfErr("error while reporting files that changed: %+v\n", err)
+			return result, exitCodeWritingToReportFileFailed
+		}
+	}
+	if repo != nil && !interrupted {
+		if err := reportBackedUp(ctx, repo, s.directories, s.fsys, result.AllFiles, outputMode, runID); err != nil {
+			fmte.PrintfErr("error while checking backups: %+v\n", err)
+			return result, exitCodeReadingBackupsFailed
+		}
+	}
+	if result.Vanished > 0 {
+		// Files deleted while the scan ran (as files of live directories are) aren't errors, but they're noted
+		fmte.Printf("Skipped %d files that were deleted during the scan.\n", result.Vanished)
+		if report != nil {
+			report.note(fmt.Sprintf("Skipped %d files that were deleted during the scan.", result.Vanished))
+		}
+	}
+	if result.Duplicates == nil || result.Duplicates.Size() == 0 {
+		if report != nil {
+			if err := report.close(); err != nil {
+				fmte.PrintfErr("error while reporting to file: %+v\n", err)
+				return result, exitCodeWritingToReportFileFailed
+			}
+		}
+		if result.FileCount == 0 {
+			fmte.Printf("No actions performed!\n")
+		} else {
+			fmte.Printf("No duplicates found!\n")
+		}
+		printStats(statsBefore, takeStats(metrics), result.Phases, time.Since(reportStartedAt))
+		sendNotifications(s.notifiers, newSummary(runID, labels, s.directories, startedAt, result, "", nil))
+		return result, ciExitCode(interrupted, 0, 0)
+	}
+	fmte.Printf("Found %d duplicates. A total of %s can be saved by removing them.\n",
+		result.DuplicateTotalCount, bytesutil.BinaryFormat(result.SavingsSize))
+
+	if report != nil {
+		err = report.close()
+	} else {
+		err = reportDuplicates(result.Duplicates, outputMode, result.AllFiles, hasher.Name(), runID, labels, times,
+			reportFileName)
+	}
+	if err != nil {
+		fmte.PrintfErr("error while reporting to file: %+v\n", err)
+		return result, exitCodeWritingToReportFileFailed
+	}
+
+	unresolved, failed := result.DuplicateTotalCount, 0
+	if action, enabled := flags.getAction(); enabled && interrupted {
+		fmte.PrintfErr("not applying %s on duplicates, since the scan was interrupted\n", action)
+	} else if enabled {
+		// Files are checked again right before they're acted upon, since reporting may have taken a while
+		duplicates := unchangedDuplicates(s.fsys, result.Duplicates, result.AllFiles)
+		opts := actions.Options{
+			Keep:            flags.getKeepPolicy(),
+			Action:          action,
+			DryRun:          flags.isDryRun(),
+			ReadOnly:        flags.getReadOnly(),
+			UnlinkHardlinks: flags.isUnlinkingLinks(),
+			MinSize:         flags.getActionMinSize(),
+		}
+		if !checkTrashSpace(duplicates, result.AllFiles, opts) {
+			return result, exitCodeInvalidAction
+		}
+		report := actions.Apply(duplicates, result.AllFiles, opts)
+		printSkipped(report)
+		if report.DryRun {
+			p := &plan{}
+			p.addReport(report)
+			fmte.Printf("Would apply %s on %d duplicates (%s).\n", action, report.Succeeded,
+				bytesutil.BinaryFormat(report.ReclaimedSize))
+			planFileName, err := p.save(flags.getReportNaming(), runID)
+			if err != nil {
+				fmte.PrintfErr("error while writing planned actions: %+v\n", err)
+				return result, exitCodeWritingToReportFileFailed
+			}
+			fmte.Printf("Planned actions saved here: %s\n", planFileName)
+		} else {
+			if err := report.Err(); err != nil {
+				fmte.PrintfErr("%s duplicates: %+v\n", action, err)
+			}
+			fmte.Printf("Applied %s on %d duplicates (%s), %d failed, %d skipped.\n", action, report.Succeeded,
+				bytesutil.BinaryFormat(report.ReclaimedSize), report.Failed, report.Skipped)
+			unresolved, failed = unresolved-int64(report.Succeeded), report.Failed
+		}
+	}
+	printStats(statsBefore, takeStats(metrics), result.Phases, time.Since(reportStartedAt))
+	sendNotifications(s.notifiers, newSummary(runID, labels, s.directories, startedAt, result, reportFileName, nil))
+	return result, ciExitCode(interrupted, failed, unresolved)
+}
+
+// ciExitCode returns the code a scan that has been reported exits with: it fails if it was interrupted and, in CI mode,
+// if actions on duplicates failed, or if duplicates weren't resolved by them, in that order
+func ciExitCode(interrupted bool, failedActions int, unresolved int64) int {
+	switch {
+	case interrupted:
+		return exitCodeScanInterrupted
+	case !flags.isCI():
+		return exitCodeSuccess
+	case failedActions > 0:
+		return exitCodeActionFailed
+	case unresolved > 0:
+		return exitCodeDuplicatesFound
+	default:
+		return exitCodeSuccess
+	}
+}
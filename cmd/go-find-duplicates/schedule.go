@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/cron"
+)
+
+// maxScheduleWait is the longest time waited for before the clock is checked again for a scheduled scan, so that
+// scans are run on time even if the system was suspended in between
+const maxScheduleWait = time.Minute
+
+// runScheduled runs scans on schedule until ctx is done, keeping only the latest keepReports report files of each
+// kind (all, if that's 0). Scans that fail don't stop later ones.
+func runScheduled(ctx context.Context, schedule cron.Schedule, s *scanner, naming reportNaming, keepReports int) {
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			fmte.PrintfErr("error: schedule %q is never due\n", schedule)
+			os.Exit(exitCodeInvalidSchedule)
+		}
+		fmte.Printf("Next scan at %s\n", next.Format(time.RFC1123))
+		for now := time.Now(); now.Before(next); now = time.Now() {
+			timer := time.NewTimer(min(next.Sub(now), maxScheduleWait))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		// Scans that are interrupted are reported as such, rather than as failed, as the program is stopping anyway
+		if _, exitCode := s.run(ctx); exitCode != exitCodeSuccess && exitCode != exitCodeScanInterrupted {
+			fmte.PrintfErr("scheduled scan failed (with exit code %d)\n", exitCode)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if keepReports > 0 {
+			if err := rotateReports(naming, keepReports); err != nil {
+				fmte.PrintfErr("error while removing old report files: %+v\n", err)
+			}
+		}
+	}
+}
+
+// rotateReports removes report files of scans named by naming, except the latest keep ones of each kind
+func rotateReports(naming reportNaming, keep int) error {
+	entries, err := os.ReadDir(naming.dir)
+	if err != nil {
+		return err
+	}
+	pattern := naming.pattern()
+	runID, suffix := 2*pattern.SubexpIndex("runid"), 2*pattern.SubexpIndex("suffix")
+	byKind := map[string][]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		m := pattern.FindStringSubmatchIndex(name)
+		// Names without run IDs are of reports that scans can't be told apart by, which are left alone
+		if m == nil || runID < 0 || !entry.Type().IsRegular() {
+			continue
+		}
+		// Names of reports of the same kind differ by their run IDs (and suffixes, see reportNaming.fileName) only
+		kind := name[:m[runID]] + name[m[runID+1]:]
+		if m[suffix] >= 0 {
+			kind = name[:m[runID]] + name[m[runID+1]:m[suffix]] + name[m[suffix+1]:]
+		}
+		byKind[kind] = append(byKind[kind], name)
+	}
+	for _, names := range byKind {
+		// Names sort by their run IDs, which are times of the scans
+		sort.Strings(names)
+		for len(names) > keep {
+			if err := os.Remove(filepath.Join(naming.dir, names[0])); err != nil {
+				return err
+			}
+			names = names[1:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/finddup"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/selfupdate"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	selfUpdateCommand = "self-update"
+	// selfUpdateTimeout is how long finding and downloading the latest release may take
+	selfUpdateTimeout = 5 * time.Minute
+)
+
+// runSelfUpdate runs the "self-update" subcommand, which replaces the binary of this program with that of the latest
+// release, if it's newer
+func runSelfUpdate(args []string) {
+	fs := flag.NewFlagSet(selfUpdateCommand, flag.ContinueOnError)
+	isCheck := fs.Bool("check", false, "only print whether there's a newer release, without installing it")
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s replaces this binary with that of the latest release on GitHub, if it's newer,
+once it's verified against checksums of the release. This is meant for binaries installed outside of package
+managers (which update them otherwise).
+
+Usage:
+  go-find-duplicates %s [flags]
+`, selfUpdateCommand, selfUpdateCommand))
+	ctx, cancel := context.WithTimeout(context.Background(), selfUpdateTimeout)
+	defer cancel()
+	u := selfupdate.Updater{}
+	release, err := u.Latest(ctx)
+	if err != nil {
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeSelfUpdateFailed)
+	}
+	if !selfupdate.IsNewer(release.Version(), finddup.Version) {
+		fmte.Printf("This is the latest version (%s).\n", finddup.Version)
+		return
+	}
+	if *isCheck {
+		fmte.Printf("Version %s is available (this is %s).\n", release.Version(), finddup.Version)
+		return
+	}
+	path, err := os.Executable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		fmte.PrintfErr("error: couldn't find this binary: %+v\n", err)
+		os.Exit(exitCodeSelfUpdateFailed)
+	}
+	fmte.Printf("Downloading version %s...\n", release.Version())
+	binary, err := u.Download(ctx, release, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		fmte.PrintfErr("error: %+v\n", err)
+		os.Exit(exitCodeSelfUpdateFailed)
+	}
+	if err := selfupdate.Replace(path, binary); err != nil {
+		fmte.PrintfErr("error: couldn't replace %s: %+v\n", path, err)
+		os.Exit(exitCodeSelfUpdateFailed)
+	}
+	fmte.Printf("Updated %s from version %s to %s.\n", path, finddup.Version, release.Version())
+}
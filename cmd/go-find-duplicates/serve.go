@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/grpcapi"
+	"github.com/m-manu/go-find-duplicates/internal/restapi"
+	"github.com/m-manu/go-find-duplicates/internal/scans"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
+)
+
+const serveCommand = "serve"
+
+// Targets of logs of the server
+const (
+	logTargetTerminal = "terminal"
+	logTargetSyslog   = "syslog"
+)
+
+// apiKeyEnv is the environment variable of the API key that clients of the server must present
+const apiKeyEnv = "FINDDUP_API_KEY"
+
+// runServe runs the "serve" subcommand, which serves an API through which scans are run and acted upon
+func runServe(args []string) {
+	fs := flag.NewFlagSet(serveCommand, flag.ContinueOnError)
+	grpcAddr := fs.String("grpc", "", "address (e.g. :9090) at which to serve the gRPC API")
+	httpAddr := fs.String("http", "", "address (e.g. :8080) at which to serve the REST API")
+	metricsAddr := fs.String("metrics-addr", "",
+		"address (e.g. :9100) at which to serve metrics of scans and actions,\n"+
+			"for Prometheus at /metrics and through expvar at /debug/vars")
+	logTarget := fs.String("log-target", logTargetTerminal,
+		"where to log lifecycle of scans and actions on their duplicates, one of: "+logTargetTerminal+", "+
+			logTargetSyslog+"\n(syslog is also read by the journal on systems running systemd)")
+	minSize := fs.Uint64P("minsize", "m", 4, "minimum size of file in KiB to consider, unless a scan asks otherwise")
+	roots := fs.StringArray("root", nil,
+		"directory (a local path or a URL of remote storage) that scans are limited to, along with those within it;\n"+
+			"can be repeated (any directory can be scanned if there are none)")
+	retention := fs.Duration("retention", 24*time.Hour,
+		"how long scans are kept once they finish, for their reports to be fetched and acted upon (0 for ever)")
+	maxScans := fs.Int("max-scans", 100,
+		"maximum number of scans kept once they finish, after which the oldest are removed (0 for no maximum)")
+	isHelp := fs.BoolP("help", "h", false, "display help")
+	fs.Usage = func() {
+		fmte.PrintfErr("Run \"go-find-duplicates %s --help\" for usage\n", serveCommand)
+	}
+	if err := fs.Parse(args); err != nil {
+		fmte.PrintfErr("error: %v\n", err)
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *isHelp {
+		fs.SetOutput(os.Stdout)
+		fmte.Printf(`go-find-duplicates %s serves an API through which scans are run on this host, and their duplicates
+acted upon, programmatically: through gRPC (see api/finddup/v1/finddup.proto) and through a REST API
+(at /api/v1/scans)
+
+Usage:
+  go-find-duplicates %s [flags]
+
+Clients must present the API key in environment variable %s as a bearer token. It's required, unless the
+API is served at loopback addresses (such as localhost:8080) only, in which case a key is generated for
+the run (and printed) if it isn't set.
+
+Flags:
+`, serveCommand, serveCommand, apiKeyEnv)
+		fs.PrintDefaults()
+		os.Exit(exitCodeSuccess)
+	}
+	if fs.NArg() != 0 || (*grpcAddr == "" && *httpAddr == "") {
+		fmte.PrintfErr("error: an address to serve at should be passed (and nothing else)\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	if *retention < 0 || *maxScans < 0 {
+		fmte.PrintfErr("error: --retention and --max-scans shouldn't be negative\n")
+		fs.Usage()
+		os.Exit(exitCodeInvalidNumArgs)
+	}
+	for _, root := range *roots {
+		if !vfs.IsURL(root) && !utils.IsReadableDirectory(root) {
+			fmte.PrintfErr("error: root \"%v\" isn't a readable directory\n", root)
+			os.Exit(exitCodeInputDirectoryNotReadable)
+		}
+	}
+	apiKey := os.Getenv(apiKeyEnv)
+	isKeyGenerated := apiKey == ""
+	var listeners []net.Listener
+	for _, addr := range []string{*grpcAddr, *httpAddr} {
+		if addr == "" {
+			listeners = append(listeners, nil)
+			continue
+		}
+		listener := listen(addr)
+		if tcpAddr, isTCP := listener.Addr().(*net.TCPAddr); isKeyGenerated && (!isTCP || !tcpAddr.IP.IsLoopback()) {
+			fmte.PrintfErr("error: %s should be set to serve the API at %s, since anyone who can connect could run "+
+				"scans and remove files otherwise\n", apiKeyEnv, listener.Addr())
+			os.Exit(exitCodeMissingAPIKey)
+		}
+		listeners = append(listeners, listener)
+	}
+	if isKeyGenerated {
+		// Even at loopback addresses, other users of the host, and websites open in its browsers, could reach the API
+		apiKey = newAPIKey()
+		// It's printed before logs go to their target, so that it isn't kept in logs of the system
+		fmte.Printf("Clients must present this API key (generated for this run, as %s isn't set) as a bearer "+
+			"token: %s\n", apiKeyEnv, apiKey)
+	}
+	setLogTarget(*logTarget)
+
+	defaultExclusions, _ := utils.LineSeparatedStrToMap(defaultExclusionsStr)
+	// Progress of concurrent scans isn't printed, since it's served instead
+	var scanMetrics *scans.Metrics
+	if *metricsAddr != "" {
+		scanMetrics = scans.NewMetrics(serveMetrics(*metricsAddr))
+	}
+	limits := scans.Limits{Roots: *roots, Retention: *retention, MaxFinished: *maxScans}
+	manager := scans.NewManager(vfs.NewMux(vfs.Local), scanMetrics, limits,
+		service.WithLogger(fmte.Discard),
+		service.WithExcludedFiles(defaultExclusions),
+		service.WithFileSizeThreshold(int64(*minSize)*bytesutil.KIBI),
+	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 2)
+	var grpcServer *grpc.Server
+	if listener := listeners[0]; listener != nil {
+		grpcServer = grpcapi.NewServer(manager, apiKey)
+		fmte.Printf("Serving gRPC API at %s\n", listener.Addr())
+		go func() {
+			errs <- grpcServer.Serve(listener)
+		}()
+	}
+	var httpServer *http.Server
+	if listener := listeners[1]; listener != nil {
+		httpServer = &http.Server{Handler: restapi.NewHandler(manager, apiKey), ReadHeaderTimeout: 10 * time.Second}
+		fmte.Printf("Serving REST API at http://%s/api/v1/scans\n", listener.Addr())
+		go func() {
+			errs <- httpServer.Serve(listener)
+		}()
+	}
+	select {
+	case err := <-errs:
+		fmte.PrintfErr("error: couldn't serve API: %+v\n", err)
+		os.Exit(exitCodeServerFailed)
+	case <-ctx.Done():
+	}
+	// Scans are cancelled first, so that streams of their groups end
+	manager.Close()
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	if httpServer != nil {
+		_ = httpServer.Shutdown(context.Background())
+	}
+}
+
+// newAPIKey generates a random API key
+func newAPIKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// setLogTarget sends messages (that would otherwise be printed) to target
+func setLogTarget(target string) {
+	switch target {
+	case logTargetTerminal:
+	case logTargetSyslog:
+		logger, err := fmte.NewSyslogLogger("go-find-duplicates")
+		if err != nil {
+			fmte.PrintfErr("error: couldn't log to syslog: %+v\n", err)
+			os.Exit(exitCodeInvalidLogTarget)
+		}
+		fmte.SetLogger(logger)
+	default:
+		fmte.PrintfErr("error: invalid log target %q (should be %s or %s)\n", target, logTargetTerminal,
+			logTargetSyslog)
+		os.Exit(exitCodeInvalidLogTarget)
+	}
+}
+
+func listen(addr string) net.Listener {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't serve API: %+v\n", err)
+		os.Exit(exitCodeServerFailed)
+	}
+	return listener
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// scanStats are values of counters of ScanMetrics at a point of time. Since ScanMetrics accumulate across scans (such
+// as scheduled ones), statistics of a scan are the differences of those before and after it.
+type scanStats struct {
+	filesWalked, filesHashed, bytesHashed, cacheHits, cacheMisses int64
+}
+
+func takeStats(m *service.ScanMetrics) scanStats {
+	return scanStats{
+		filesWalked: m.FilesWalked.Value(),
+		filesHashed: m.FilesHashed.Value(),
+		bytesHashed: m.BytesHashed.Value(),
+		cacheHits:   m.CacheHits.Value(),
+		cacheMisses: m.CacheMisses.Value(),
+	}
+}
+
+// perSecond is the rate of n over d (0 if d is)
+func perSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// printStats prints throughput of a scan and the time taken by each of its phases, so that users can see where time
+// went (and tune flags accordingly)
+func printStats(before, after scanStats, phases service.Phases, reported time.Duration) {
+	walked, hashed, size := after.filesWalked-before.filesWalked, after.filesHashed-before.filesHashed,
+		after.bytesHashed-before.bytesHashed
+	fmte.Printf("Walked %d files in %v (%.0f files/s).\n", walked, phases.Walk.Round(time.Millisecond),
+		perSecond(walked, phases.Walk))
+	fmte.Printf("Hashed %d files (%s) in %v (%s/s).\n", hashed, bytesutil.BinaryFormat(size),
+		phases.Hash.Round(time.Millisecond), bytesutil.BinaryFormat(int64(perSecond(size, phases.Hash))))
+	fmte.Printf("Grouped files in %v, and reported in %v.\n", phases.Group.Round(time.Millisecond),
+		reported.Round(time.Millisecond))
+	hits, misses := after.cacheHits-before.cacheHits, after.cacheMisses-before.cacheMisses
+	if hits+misses > 0 {
+		fmte.Printf("Found %d hashes in the cache, and missed %d (%.0f%% hit rate).\n", hits, misses,
+			100*float64(hits)/float64(hits+misses))
+	}
+}
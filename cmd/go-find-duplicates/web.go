@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/webui"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// defaultWebAddr is the address of the web interface when --web is passed without one (any free port of localhost)
+const defaultWebAddr = "127.0.0.1:0"
+
+// serveWeb serves the web interface for reviewing duplicates of result at addr, until the program is interrupted
+func serveWeb(addr string, result service.Result, fsys vfs.FS) {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmte.PrintfErr("error: couldn't serve web interface: %+v\n", err)
+		os.Exit(exitCodeServerFailed)
+	}
+	server := &http.Server{Handler: webui.NewHandler(result, fsys, token), ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	fmte.Printf("Review duplicates at http://%s/?token=%s (press Ctrl+C to stop)\n", listener.Addr(), token)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		fmte.PrintfErr("error: couldn't serve web interface: %+v\n", err)
+		os.Exit(exitCodeServerFailed)
+	}
+}
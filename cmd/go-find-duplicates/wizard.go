@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	wizardCommand = "wizard"
+	// reportOnly is the choice of the wizard to only report duplicates, rather than act on them
+	reportOnly = "report"
+	// wizardVerifier is the hashing algorithm that the wizard verifies duplicates with
+	wizardVerifier = "sha256"
+	// shellSafeChars are characters of arguments that needn't be quoted in command lines of shells
+	shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%"
+)
+
+// runWizard runs the "wizard" subcommand, which asks what to scan, what to do with duplicates found and how
+// safely, then prints the equivalent command line and runs it if asked to
+func runWizard(args []string) {
+	fs := flag.NewFlagSet(wizardCommand, flag.ContinueOnError)
+	parseCommand(fs, args, fmt.Sprintf(
+		`go-find-duplicates %s asks what to scan, what to do with duplicates found and how safely, then prints
+the command line of such a scan (to run it again, e.g. from scripts) and runs it if asked to
+
+Usage:
+  go-find-duplicates %s
+`, wizardCommand, wizardCommand))
+	w := wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	scanArgs := w.askScan()
+	_, _ = fmt.Fprintf(w.out, "\nThe command line of this scan is:\n\n  %s\n\n",
+		shellJoin(append([]string{"go-find-duplicates"}, scanArgs...)))
+	if !w.confirm("Run it now?", false) {
+		return
+	}
+	path, err := os.Executable()
+	if err != nil {
+		fmte.PrintfErr("error: couldn't find this binary: %+v\n", err)
+		os.Exit(exitCodeWizardCancelled)
+	}
+	scan := exec.Command(path, scanArgs...)
+	scan.Stdin, scan.Stdout, scan.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := scan.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmte.PrintfErr("error: couldn't run the scan: %+v\n", err)
+		os.Exit(exitCodeErrorFindingDuplicates)
+	}
+}
+
+// wizard asks questions on in, and prints them on out
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// askScan asks what to scan, what to do with duplicates found and how safely, and returns arguments of such a scan
+func (w wizard) askScan() []string {
+	var dirs []string
+	for {
+		prompt, def := "Directory to scan", "."
+		if len(dirs) > 0 {
+			prompt, def = "Another directory to scan (nothing if that's all)", ""
+		}
+		dir := w.ask(prompt, def)
+		if dir == "" {
+			break
+		}
+		if strings.HasPrefix(dir, "~"+string(filepath.Separator)) || strings.HasPrefix(dir, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = filepath.Join(home, dir[2:])
+			}
+		}
+		if info, err := os.Stat(dir); !vfs.IsURL(dir) && (err != nil || !info.IsDir()) {
+			_, _ = fmt.Fprintf(w.out, "%s isn't a readable directory\n", dir)
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+
+	action := w.choose("What should be done with duplicates found?", []choice{
+		{reportOnly, "only report them"},
+		{actions.Trash.String(), "move them to trash, from which they can be restored"},
+		{actions.Hardlink.String(), "replace them with hard links to the copy kept"},
+		{actions.Symlink.String(), "replace them with symbolic links to the copy kept"},
+		{actions.Reflink.String(), "replace them with copy-on-write clones of the copy kept (if supported)"},
+		{actions.Delete.String(), "delete them permanently"},
+	})
+	var global, scanArgs []string
+	if action != reportOnly {
+		var keeps []choice
+		for _, name := range actions.KeepPolicyNames() {
+			keeps = append(keeps, choice{name, ""})
+		}
+		keep := w.choose("Which copy of each group of duplicates should be kept?", keeps)
+		scanArgs = append(scanArgs, "--action", action, "--keep", keep)
+		if w.confirm("Only plan what would be done, without changing any file (a dry run)?", true) {
+			global = append(global, "--"+dryRunFlag)
+		}
+	}
+	if w.confirm("Verify duplicates by hashing entire contents of files (slower, but safest)?",
+		action != reportOnly) {
+		scanArgs = append(scanArgs, "--verify", wizardVerifier)
+	}
+	if w.confirm("Follow symbolic links (and junctions, on Windows)?", false) {
+		scanArgs = append(scanArgs, "--symlinks", symlinksFollow)
+	}
+	for {
+		minSize := w.ask("Minimum size of files to consider, in KiB", "4")
+		if _, err := strconv.ParseUint(minSize, 10, 64); err != nil {
+			_, _ = fmt.Fprintf(w.out, "%s isn't a number of KiB\n", minSize)
+			continue
+		}
+		if minSize != "4" {
+			scanArgs = append(scanArgs, "--minsize", minSize)
+		}
+		break
+	}
+	if action == reportOnly && w.confirm("Review duplicates in a browser, once they're found?", false) {
+		scanArgs = append(scanArgs, "--web")
+	}
+	// Subcommand scan is explicit, in case a directory is named like another subcommand
+	return append(append(append(global, scanCommand), scanArgs...), dirs...)
+}
+
+// choice is an answer to a question of the wizard
+type choice struct {
+	value       string
+	description string
+}
+
+// ask asks a question, whose answer is def if nothing is answered. It exits if there are no more answers.
+func (w wizard) ask(prompt, def string) string {
+	if def != "" {
+		prompt += " [" + def + "]"
+	}
+	_, _ = fmt.Fprintf(w.out, "%s: ", prompt)
+	answer, err := w.in.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if err != nil && answer == "" {
+		_, _ = fmt.Fprintln(w.out)
+		fmte.PrintfErr("error: no answer, so the wizard stopped\n")
+		os.Exit(exitCodeWizardCancelled)
+	}
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+// choose asks to choose one of choices (by number or by value), the first of which is the default
+func (w wizard) choose(prompt string, choices []choice) string {
+	_, _ = fmt.Fprintln(w.out, prompt)
+	for i, c := range choices {
+		if c.description == "" {
+			_, _ = fmt.Fprintf(w.out, "  %d) %s\n", i+1, c.value)
+		} else {
+			_, _ = fmt.Fprintf(w.out, "  %d) %-10s %s\n", i+1, c.value, c.description)
+		}
+	}
+	for {
+		answer := w.ask("Choice", "1")
+		for i, c := range choices {
+			if answer == strconv.Itoa(i+1) || strings.EqualFold(answer, c.value) {
+				return c.value
+			}
+		}
+		_, _ = fmt.Fprintf(w.out, "%s isn't one of the choices\n", answer)
+	}
+}
+
+// confirm asks a yes or no question, whose answer is def if nothing is answered
+func (w wizard) confirm(prompt string, def bool) bool {
+	options := "y/N"
+	if def {
+		options = "Y/n"
+	}
+	for {
+		switch strings.ToLower(w.ask(prompt+" ("+options+")", "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// shellJoin joins args into a command line of a POSIX shell, quoting those that need to be
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, shellSafeChars) == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,114 @@
+package entity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// UnknownFileSize is the size of files in digests that don't carry sizes, such as those of checksum manifests.
+// Such digests match files by their hashes alone.
+const UnknownFileSize = -1
+
+var (
+	// checksumLinePattern matches lines of checksum manifests as written by sha256sum and md5sum, with an asterisk
+	// before names of files hashed in binary mode
+	checksumLinePattern = regexp.MustCompile(`^\\?([0-9a-fA-F]+) [ *](.+)$`)
+	// taggedChecksumLinePattern matches lines of checksum manifests as written by sha256sum --tag (in BSD style)
+	taggedChecksumLinePattern = regexp.MustCompile(`^\\?(SHA256|MD5) \((.+)\) = ([0-9a-fA-F]+)$`)
+)
+
+// checksumAlgorithms are names of algorithms of checksum manifests supported, by lengths of their hex hashes
+var checksumAlgorithms = map[int]string{64: "sha256", 32: "md5"}
+
+// ReadChecksums reads a checksum manifest, as written by sha256sum or md5sum, as a digest index. Its digests have
+// UnknownFileSize, and its paths are as in the manifest.
+func ReadChecksums(r io.Reader) (*DigestIndex, error) {
+	index := &DigestIndex{Version: DigestIndexVersion, Digests: map[string]FileDigest{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var hash, name, algorithm string
+		if m := taggedChecksumLinePattern.FindStringSubmatch(line); m != nil {
+			algorithm, name, hash = strings.ToLower(m[1]), m[2], m[3]
+			if checksumAlgorithms[len(hash)] != algorithm {
+				return nil, fmt.Errorf("line %d of checksums: %s hash of unexpected length", lineNum, m[1])
+			}
+		} else if m := checksumLinePattern.FindStringSubmatch(line); m != nil {
+			hash, name = m[1], m[2]
+			algorithm = checksumAlgorithms[len(hash)]
+			if algorithm == "" {
+				return nil, fmt.Errorf("line %d of checksums: hashes of %d hex digits aren't supported (only "+
+					"those of sha256 and md5 are)", lineNum, len(hash))
+			}
+		} else {
+			return nil, fmt.Errorf("line %d of checksums is improperly formatted", lineNum)
+		}
+		if index.Algorithm == "" {
+			index.Algorithm = algorithm
+		} else if index.Algorithm != algorithm {
+			return nil, fmt.Errorf("line %d of checksums: %s hash in a manifest of %s hashes", lineNum, algorithm,
+				index.Algorithm)
+		}
+		if strings.HasPrefix(line, `\`) {
+			// Names with backslashes or newlines are escaped, as marked by a leading backslash
+			name = unescapeChecksumName(name)
+		}
+		index.Digests[name] = FileDigest{FileHash: strings.ToLower(hash), FileSize: UnknownFileSize}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if index.Algorithm == "" {
+		return nil, fmt.Errorf("no checksums found")
+	}
+	return index, nil
+}
+
+// LoadChecksums reads a checksum manifest from a file (see ReadChecksums)
+func LoadChecksums(path string) (*DigestIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadChecksums(f)
+}
+
+// WriteChecksums writes checksums, which are hex hashes of files by their paths, as a checksum manifest in the
+// format of sha256sum and md5sum, sorted by paths
+func WriteChecksums(w io.Writer, checksums map[string]string) error {
+	paths := make([]string, 0, len(checksums))
+	for path := range checksums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	bw := bufio.NewWriter(w)
+	for _, path := range paths {
+		name := path
+		if strings.ContainsAny(name, "\\\n\r") {
+			// As with sha256sum, names with backslashes or newlines are escaped, as marked by a leading backslash
+			bw.WriteString(`\`)
+			name = checksumNameEscaper.Replace(name)
+		}
+		bw.WriteString(checksums[path] + "  " + name + "\n")
+	}
+	return bw.Flush()
+}
+
+var (
+	checksumNameEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+	checksumNameUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+)
+
+func unescapeChecksumName(name string) string {
+	return checksumNameUnescaper.Replace(name)
+}
@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadChecksums(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	index, err := ReadChecksums(strings.NewReader(sha + "  photos/a.jpg\n" +
+		strings.ToUpper(sha) + " *photos/b c.jpg\r\n" +
+		"\n" +
+		`\` + sha + `  odd\\name\nwith newline` + "\n" +
+		"SHA256 (tagged.txt) = " + sha + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256", index.Algorithm)
+	digest := FileDigest{FileHash: sha, FileSize: UnknownFileSize}
+	assert.Equal(t, map[string]FileDigest{
+		"photos/a.jpg":            digest,
+		"photos/b c.jpg":          digest,
+		"odd\\name\nwith newline": digest,
+		"tagged.txt":              digest,
+	}, index.Digests)
+
+	index, err = ReadChecksums(strings.NewReader(strings.Repeat("0f", 16) + "  a.txt\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "md5", index.Algorithm)
+
+	for manifest, expectedErr := range map[string]string{
+		"":                                     "no checksums found",
+		"not a checksum\n":                     "line 1 of checksums is improperly formatted",
+		strings.Repeat("ab", 20) + "  a.txt\n": "hashes of 40 hex digits aren't supported",
+		sha + "  a.txt\n" + strings.Repeat("ab", 16) + "  b\n": "line 2 of checksums: md5 hash in a manifest of sha256",
+		"MD5 (a.txt) = " + sha + "\n":                          "MD5 hash of unexpected length",
+	} {
+		_, err := ReadChecksums(strings.NewReader(manifest))
+		assert.ErrorContains(t, err, expectedErr, manifest)
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	sha := strings.Repeat("cd", 32)
+	checksums := map[string]string{"/b/2.jpg": sha, "/a/1.jpg": sha, "/a/odd\\name\n.jpg": sha}
+	var sb strings.Builder
+	assert.Nil(t, WriteChecksums(&sb, checksums))
+	assert.Equal(t, sha+"  /a/1.jpg\n"+`\`+sha+`  /a/odd\\name\n.jpg`+"\n"+sha+"  /b/2.jpg\n", sb.String())
+	index, err := ReadChecksums(strings.NewReader(sb.String()))
+	assert.Nil(t, err)
+	for path, hash := range checksums {
+		assert.Equal(t, FileDigest{FileHash: hash, FileSize: UnknownFileSize}, index.Digests[path])
+	}
+}
@@ -0,0 +1,157 @@
+package entity
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DigestIndexVersion is the version of the digest index format written by this package
+const DigestIndexVersion = 1
+
+// DigestIndex is an export of digests of all files of a scan, so that a scan on another host can find which of its
+// files have same contents as these, without the contents being transferred. Digests are comparable only if they
+// were computed by the same algorithm.
+type DigestIndex struct {
+	Version     int       `json:"version"`
+	Host        string    `json:"host"`
+	Directories []string  `json:"directories"`
+	Algorithm   string    `json:"algorithm"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Digests are digests of files, by their paths
+	Digests map[string]FileDigest `json:"digests"`
+}
+
+// WriteDigestIndex serializes the index to w in the given format
+func WriteDigestIndex(w io.Writer, index *DigestIndex, format ManifestFormat) error {
+	switch format {
+	case ManifestFormatJSON:
+		return json.NewEncoder(w).Encode(index)
+	case ManifestFormatBinary:
+		zw := gzip.NewWriter(w)
+		if err := gob.NewEncoder(zw).Encode(index); err != nil {
+			return err
+		}
+		return zw.Close()
+	default:
+		return fmt.Errorf("unknown digest index format %d", format)
+	}
+}
+
+// ReadDigestIndex deserializes a digest index from r, detecting its format
+func ReadDigestIndex(r io.Reader) (*DigestIndex, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var index DigestIndex
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		if err := gob.NewDecoder(zr).Decode(&index); err != nil {
+			return nil, fmt.Errorf("couldn't decode digest index: %w", err)
+		}
+	} else if err := json.NewDecoder(br).Decode(&index); err != nil {
+		return nil, fmt.Errorf("couldn't decode digest index: %w", err)
+	}
+	if index.Version > DigestIndexVersion {
+		return nil, fmt.Errorf("digest index version %d is newer than supported version %d", index.Version,
+			DigestIndexVersion)
+	}
+	return &index, nil
+}
+
+// SaveDigestIndex writes the index to a file, in the format corresponding to its name (see ManifestFormatOf)
+func SaveDigestIndex(path string, index *DigestIndex) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteDigestIndex(f, index, ManifestFormatOf(path)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadDigestIndex reads a digest index from a file
+func LoadDigestIndex(path string) (*DigestIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDigestIndex(f)
+}
+
+// HostPath is the path of a file of a host, as in digest indexes merged by MergeDigestIndexes
+func HostPath(host, path string) string {
+	return host + ":" + path
+}
+
+// MergeDigestIndexes combines digest indexes of several hosts (by the same algorithm) into groups of duplicates of
+// files of the same digests, whose paths are of their hosts (see HostPath), along with sizes of files of the groups.
+// Since only some scans verify duplicates, files are grouped by their strong hashes only if all files of the same
+// digests have them. Files whose strong hashes differ (or are by different algorithms, which can't be compared) are
+// never grouped together, though: each of their strong hashes is a group, and files of the digests without strong
+// hashes are another. If crossHostOnly, groups are only those of files on at least 2 hosts, rather than of files on
+// one host alone too.
+func MergeDigestIndexes(indexes []*DigestIndex, crossHostOnly bool) (*DigestToFiles, FilePathToMeta, error) {
+	type file struct{ host, path string }
+	// Files are of digests without their strong hashes first, and of their strong hashes within those
+	byDigest := map[FileDigest]map[FileDigest][]file{}
+	for _, index := range indexes {
+		if index.Algorithm != indexes[0].Algorithm {
+			return nil, nil, fmt.Errorf("digests of %s and of %s are by different hashing algorithms (%s and %s), "+
+				"and can't be merged", indexes[0].Host, index.Host, indexes[0].Algorithm, index.Algorithm)
+		}
+		for path, digest := range index.Digests {
+			fast := digest.Fast()
+			if byDigest[fast] == nil {
+				byDigest[fast] = map[FileDigest][]file{}
+			}
+			byDigest[fast][digest] = append(byDigest[fast][digest], file{host: index.Host, path: path})
+		}
+	}
+	duplicates := NewDigestToFiles()
+	files := FilePathToMeta{}
+	add := func(digest FileDigest, group []file) {
+		hosts := map[string]bool{}
+		paths := map[string]bool{}
+		for _, f := range group {
+			hosts[f.host] = true
+			paths[HostPath(f.host, f.path)] = true
+		}
+		// Indexes of the same host may be of the same files, too
+		if len(paths) < 2 || (crossHostOnly && len(hosts) < 2) {
+			return
+		}
+		for path := range paths {
+			duplicates.Set(digest, path)
+			files[path] = FileMeta{Size: digest.FileSize}
+		}
+	}
+	for fast, byStrong := range byDigest {
+		if unverified, found := byStrong[fast]; found && len(byStrong) == 2 {
+			// Files without strong hashes are of the only strong hash, as far as is known
+			all := append([]file{}, unverified...)
+			for digest, group := range byStrong {
+				if digest != fast {
+					all = append(all, group...)
+				}
+			}
+			add(fast, all)
+			continue
+		}
+		for digest, group := range byStrong {
+			add(digest, group)
+		}
+	}
+	return duplicates, files, nil
+}
@@ -1,18 +1,34 @@
 package entity
 
 import (
+	"iter"
+	"sort"
 	"sync"
 
 	"github.com/emirpasic/gods/maps/treemap"
+	"github.com/emirpasic/gods/utils"
 )
 
 // DigestToFiles is a multi-map with FileDigest keys and string values.
-// Writes to this is goroutine-safe.
+// Iteration order is deterministic: keys are in the order chosen at creation and values of a key are sorted.
+// Writes to this is goroutine-safe, but iterating while there are concurrent writes isn't.
 type DigestToFiles struct {
-	mx   *sync.Mutex
-	data *treemap.Map
+	mx         *sync.Mutex
+	data       *treemap.Map
+	comparator utils.Comparator
 }
 
+// Order is the order of iteration of DigestToFiles
+type Order int
+
+// Orders of iteration of DigestToFiles
+const (
+	// OrderBySizeDesc orders by file size (largest first), then by extension and then by hash
+	OrderBySizeDesc Order = iota
+	// OrderByDigest orders by hash, then by extension and then by file size
+	OrderByDigest
+)
+
 // FileDigestComparator is a comparator for FileDigest that compares FileSize, FileExtension and FileHash in that order
 func FileDigestComparator(a, b any) int {
 	fa := a.(FileDigest)
@@ -41,25 +57,63 @@ func FileDigestComparator(a, b any) int {
 		return -1
 	}
 
-	return 0
+	return compareStrongHashes(fa, fb)
+}
+
+// FileDigestHashComparator is a comparator for FileDigest that compares FileHash, FileExtension and FileSize
+// in that order
+func FileDigestHashComparator(a, b any) int {
+	fa := a.(FileDigest)
+	fb := b.(FileDigest)
+	if fa.FileHash != fb.FileHash {
+		return utils.StringComparator(fa.FileHash, fb.FileHash)
+	}
+	if fa.FileExtension != fb.FileExtension {
+		return utils.StringComparator(fa.FileExtension, fb.FileExtension)
+	}
+	if fa.FileSize != fb.FileSize {
+		return utils.Int64Comparator(fa.FileSize, fb.FileSize)
+	}
+	return compareStrongHashes(fa, fb)
+}
+
+// compareStrongHashes compares strong hashes of digests that are otherwise equal
+func compareStrongHashes(fa, fb FileDigest) int {
+	if fa.StrongAlgorithm != fb.StrongAlgorithm {
+		return utils.StringComparator(fa.StrongAlgorithm, fb.StrongAlgorithm)
+	}
+	return utils.StringComparator(fa.StrongHash, fb.StrongHash)
 }
 
-// NewDigestToFiles creates new DigestToFiles
+// NewDigestToFiles creates new DigestToFiles, iterated in OrderBySizeDesc
 func NewDigestToFiles() (m *DigestToFiles) {
+	return NewDigestToFilesOrdered(OrderBySizeDesc)
+}
+
+// NewDigestToFilesOrdered creates new DigestToFiles, iterated in the given order
+func NewDigestToFilesOrdered(order Order) (m *DigestToFiles) {
+	comparator := FileDigestComparator
+	if order == OrderByDigest {
+		comparator = FileDigestHashComparator
+	}
 	return &DigestToFiles{
-		data: treemap.NewWith(FileDigestComparator),
-		mx:   &sync.Mutex{},
+		data:       treemap.NewWith(comparator),
+		mx:         &sync.Mutex{},
+		comparator: comparator,
 	}
 }
 
-// Set sets a value for the key
+// Set sets a value for the key, keeping values of the key sorted
 func (m *DigestToFiles) Set(key FileDigest, value string) {
 	m.mx.Lock()
 	valuesRaw, found := m.data.Get(key)
 	var values []string
 	if found {
 		values = valuesRaw.([]string)
-		values = append(values, value)
+		i := sort.SearchStrings(values, value)
+		values = append(values, "")
+		copy(values[i+1:], values[i:])
+		values[i] = value
 	} else {
 		values = []string{value}
 	}
@@ -69,11 +123,15 @@ func (m *DigestToFiles) Set(key FileDigest, value string) {
 
 // Remove removes entry in the map
 func (m *DigestToFiles) Remove(fd FileDigest) {
+	m.mx.Lock()
 	m.data.Remove(fd)
+	m.mx.Unlock()
 }
 
 // Size returns size of map
 func (m *DigestToFiles) Size() int {
+	m.mx.Lock()
+	defer m.mx.Unlock()
 	return m.data.Size()
 }
 
@@ -97,3 +155,31 @@ func (m *digestToFilesIterator) Next() (digest *FileDigest, paths []string) {
 	filePaths := m.iter.Value().([]string)
 	return &fd, filePaths
 }
+
+// All returns an iterator over all entries of the map
+func (m *DigestToFiles) All() iter.Seq2[FileDigest, []string] {
+	return func(yield func(FileDigest, []string) bool) {
+		it := m.data.Iterator()
+		for it.Next() {
+			if !yield(it.Key().(FileDigest), it.Value().([]string)) {
+				return
+			}
+		}
+	}
+}
+
+// AllFrom returns an iterator over entries of the map, starting from the first key that is same as or after
+// the given key in the order of iteration. This allows resuming an iteration from a known position.
+func (m *DigestToFiles) AllFrom(from FileDigest) iter.Seq2[FileDigest, []string] {
+	return func(yield func(FileDigest, []string) bool) {
+		it := m.data.Iterator()
+		found := it.NextTo(func(key, _ any) bool {
+			return m.comparator(key, from) >= 0
+		})
+		for ok := found; ok; ok = it.Next() {
+			if !yield(it.Key().(FileDigest), it.Value().([]string)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDigestToFiles(order Order) *DigestToFiles {
+	m := NewDigestToFilesOrdered(order)
+	m.Set(FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}, "/z/1.jpg")
+	m.Set(FileDigest{FileExtension: ".mp4", FileHash: "a", FileSize: 1000}, "/y/2.mp4")
+	m.Set(FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}, "/a/3.jpg")
+	m.Set(FileDigest{FileExtension: ".txt", FileHash: "c", FileSize: 100}, "/x/4.txt")
+	m.Set(FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}, "/m/5.jpg")
+	return m
+}
+
+func TestDigestToFilesOrder(t *testing.T) {
+	var sizes []int64
+	for digest, paths := range newTestDigestToFiles(OrderBySizeDesc).All() {
+		sizes = append(sizes, digest.FileSize)
+		if digest.FileHash == "b" {
+			assert.Equal(t, []string{"/a/3.jpg", "/m/5.jpg", "/z/1.jpg"}, paths)
+		}
+	}
+	assert.Equal(t, []int64{1000, 100, 10}, sizes)
+
+	var hashes []string
+	for digest := range newTestDigestToFiles(OrderByDigest).All() {
+		hashes = append(hashes, digest.FileHash)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, hashes)
+}
+
+func TestDigestToFilesAllFrom(t *testing.T) {
+	m := newTestDigestToFiles(OrderByDigest)
+	var hashes []string
+	for digest := range m.AllFrom(FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}) {
+		hashes = append(hashes, digest.FileHash)
+	}
+	assert.Equal(t, []string{"b", "c"}, hashes)
+	hashes = nil
+	for digest := range m.AllFrom(FileDigest{FileHash: "bb"}) {
+		hashes = append(hashes, digest.FileHash)
+	}
+	assert.Equal(t, []string{"c"}, hashes)
+	for range m.AllFrom(FileDigest{FileHash: "d"}) {
+		assert.Fail(t, "no entries are expected after the last key")
+	}
+}
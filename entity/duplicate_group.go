@@ -0,0 +1,14 @@
+package entity
+
+import "fmt"
+
+// DuplicateGroup is a set of files that are duplicates of each other
+type DuplicateGroup struct {
+	Digest FileDigest `json:"digest"`
+	Paths  []string   `json:"paths"`
+}
+
+// String returns a string representation of DuplicateGroup
+func (g DuplicateGroup) String() string {
+	return fmt.Sprintf("%v: %v", g.Digest, g.Paths)
+}
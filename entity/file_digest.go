@@ -6,14 +6,49 @@ import (
 	"github.com/m-manu/go-find-duplicates/bytesutil"
 )
 
-// FileDigest contains properties of a file that makes the file unique to a very high degree of confidence
+// FileDigest contains properties of a file that makes the file unique to a very high degree of confidence.
+// FileHash is that of a fast (possibly sampled) hash. A digest can be upgraded to also carry a strong hash of entire
+// contents of the file, so that verifying it later doesn't need the fast pass again.
 type FileDigest struct {
 	FileExtension string `json:"ext"`
 	FileHash      string `json:"hash"`
 	FileSize      int64  `json:"size"`
+	// StrongAlgorithm is the name of the algorithm of StrongHash (empty if digest isn't upgraded)
+	StrongAlgorithm string `json:"strongAlgorithm,omitempty"`
+	// StrongHash is the hash of entire contents of the file (empty if digest isn't upgraded)
+	StrongHash string `json:"strongHash,omitempty"`
 }
 
 // String returns a string representation of FileDigest
 func (f FileDigest) String() string {
+	if f.IsStrong() {
+		return fmt.Sprintf("%v/%v/%v/%v:%v", f.FileExtension, f.FileHash, bytesutil.BinaryFormat(f.FileSize),
+			f.StrongAlgorithm, f.StrongHash)
+	}
 	return fmt.Sprintf("%v/%v/%v", f.FileExtension, f.FileHash, bytesutil.BinaryFormat(f.FileSize))
 }
+
+// IsStrong checks whether the digest has been upgraded with a strong hash
+func (f FileDigest) IsStrong() bool {
+	return f.StrongHash != ""
+}
+
+// Upgrade returns the digest with strong hash by given algorithm. The hash is computed by calling compute, only if
+// the digest doesn't already have it.
+func (f FileDigest) Upgrade(algorithm string, compute func() (string, error)) (FileDigest, error) {
+	if f.IsStrong() && f.StrongAlgorithm == algorithm {
+		return f, nil
+	}
+	hash, err := compute()
+	if err != nil {
+		return f, err
+	}
+	f.StrongAlgorithm, f.StrongHash = algorithm, hash
+	return f, nil
+}
+
+// Fast returns the digest without its strong hash
+func (f FileDigest) Fast() FileDigest {
+	f.StrongAlgorithm, f.StrongHash = "", ""
+	return f
+}
@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFileDigestUpgrade checks whether a strong hash is computed only when the digest doesn't already have it
+func TestFileDigestUpgrade(t *testing.T) {
+	fast := FileDigest{FileExtension: ".txt", FileHash: "f1234", FileSize: 100}
+	computed := 0
+	compute := func() (string, error) {
+		computed++
+		return "abcd", nil
+	}
+	strong, err := fast.Upgrade("sha256", compute)
+	assert.Nil(t, err)
+	assert.True(t, strong.IsStrong())
+	assert.Equal(t, "sha256", strong.StrongAlgorithm)
+	assert.Equal(t, "abcd", strong.StrongHash)
+	assert.Equal(t, fast, strong.Fast())
+	assert.Equal(t, ".txt/f1234/100 B/sha256:abcd", strong.String())
+
+	again, err := strong.Upgrade("sha256", compute)
+	assert.Nil(t, err)
+	assert.Equal(t, strong, again)
+	assert.Equal(t, 1, computed)
+
+	other, err := strong.Upgrade("blake3", compute)
+	assert.Nil(t, err)
+	assert.Equal(t, "blake3", other.StrongAlgorithm)
+	assert.Equal(t, 2, computed)
+
+	failed, err := fast.Upgrade("sha256", func() (string, error) { return "", errors.New("unreadable") })
+	assert.NotNil(t, err)
+	assert.False(t, failed.IsStrong())
+}
@@ -5,15 +5,23 @@ import (
 	"time"
 )
 
-// FileMeta is a combination of file size and its modification timestamp
+// FileMeta is a combination of file size and its modification time
 type FileMeta struct {
-	Size              int64
-	ModifiedTimestamp int64
+	Size int64 `json:"size"`
+	// Modified is the modification time of the file, as precise as the file system keeps it (to the nanosecond, on
+	// most), and of the timezone of the host that scanned it. Manifests have it in RFC 3339, with offsets.
+	Modified time.Time `json:"modified"`
+}
+
+// ModifiedAt checks whether the file was last modified at t, as precisely as Modified is known: modification times of
+// manifests of version 1 are of whole seconds, so times that are whole seconds are compared by seconds only
+func (f FileMeta) ModifiedAt(t time.Time) bool {
+	return t.Equal(f.Modified) || (f.Modified.Nanosecond() == 0 && t.Unix() == f.Modified.Unix())
 }
 
 // String returns a string representation of FileMeta
 func (f FileMeta) String() string {
-	return fmt.Sprintf("{size: %d, modified: %v}", f.Size, time.Unix(f.ModifiedTimestamp, 0))
+	return fmt.Sprintf("{size: %d, modified: %v}", f.Size, f.Modified)
 }
 
 // FilePathToMeta is a map of file path to its FileMeta
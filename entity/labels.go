@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"sort"
+	"strings"
+)
+
+// Labels are key-value pairs given to a run, to correlate its reports with what it was run for (e.g. a ticket)
+type Labels map[string]string
+
+// String returns labels as comma-separated key=value pairs, sorted by key
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(l))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+l[key])
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,243 @@
+package entity
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the version of the manifest format written by this package. Manifests of version 1 have
+// modification times of files as seconds since the Unix epoch, which manifests of later versions are read as.
+const ManifestVersion = 2
+
+// ManifestFormat is a format in which a Manifest is serialized
+type ManifestFormat int
+
+// Manifest formats
+const (
+	// ManifestFormatJSON is human-readable JSON
+	ManifestFormatJSON ManifestFormat = iota
+	// ManifestFormatBinary is gzip-compressed gob, which is much more compact
+	ManifestFormatBinary
+)
+
+// RunMetadata describes a scan for duplicates
+type RunMetadata struct {
+	RunID       string    `json:"runId"`
+	Directories []string  `json:"directories"`
+	Algorithm   string    `json:"algorithm"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Labels      Labels    `json:"labels,omitempty"`
+}
+
+// Manifest is the full result of a scan: all files considered, digests of the files that were hashed and the groups
+// of duplicates found. A manifest can be saved and loaded back later, to act upon or compare with another scan.
+type Manifest struct {
+	Version int                   `json:"version"`
+	Run     RunMetadata           `json:"run"`
+	Files   FilePathToMeta        `json:"files"`
+	Digests map[string]FileDigest `json:"digests"`
+	Groups  []DuplicateGroup      `json:"groups"`
+}
+
+// NewManifest creates a Manifest from results of a scan
+func NewManifest(run RunMetadata, files FilePathToMeta, digests map[string]FileDigest,
+	duplicates *DigestToFiles,
+) *Manifest {
+	m := &Manifest{Version: ManifestVersion, Run: run, Files: files, Digests: digests}
+	if duplicates != nil {
+		for digest, paths := range duplicates.All() {
+			m.Groups = append(m.Groups, DuplicateGroup{Digest: digest, Paths: paths})
+		}
+	}
+	return m
+}
+
+// Duplicates returns groups of duplicates in the manifest as a DigestToFiles
+func (m *Manifest) Duplicates() *DigestToFiles {
+	duplicates := NewDigestToFiles()
+	for _, group := range m.Groups {
+		for _, path := range group.Paths {
+			duplicates.Set(group.Digest, path)
+		}
+	}
+	return duplicates
+}
+
+// WriteManifest serializes the manifest to w in the given format
+func WriteManifest(w io.Writer, m *Manifest, format ManifestFormat) error {
+	switch format {
+	case ManifestFormatJSON:
+		return json.NewEncoder(w).Encode(m)
+	case ManifestFormatBinary:
+		zw := gzip.NewWriter(w)
+		if err := gob.NewEncoder(zw).Encode(m); err != nil {
+			return err
+		}
+		return zw.Close()
+	default:
+		return fmt.Errorf("unknown manifest format %d", format)
+	}
+}
+
+// manifestFile is a Manifest as it's read, of any version
+type manifestFile struct {
+	Version int                   `json:"version"`
+	Run     RunMetadata           `json:"run"`
+	Files   map[string]fileOfAny  `json:"files"`
+	Digests map[string]FileDigest `json:"digests"`
+	Groups  []DuplicateGroup      `json:"groups"`
+}
+
+// fileOfAny is a FileMeta as it's read, of a manifest of any version
+type fileOfAny struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	// ModifiedTimestamp is the modification time of files of manifests of version 1, in seconds, and ModifiedNanos
+	// nanoseconds past it (of binary ones only)
+	ModifiedTimestamp int64 `json:"mtime"`
+	ModifiedNanos     int32 `json:"-"`
+}
+
+// manifest converts m to the Manifest of the current version
+func (m *manifestFile) manifest() *Manifest {
+	files := make(FilePathToMeta, len(m.Files))
+	for path, file := range m.Files {
+		meta := FileMeta{Size: file.Size, Modified: file.Modified}
+		if m.Version < 2 {
+			meta.Modified = time.Unix(file.ModifiedTimestamp, int64(file.ModifiedNanos))
+		}
+		files[path] = meta
+	}
+	return &Manifest{Version: m.Version, Run: m.Run, Files: files, Digests: m.Digests, Groups: m.Groups}
+}
+
+// ReadManifest deserializes a manifest from r, detecting its format. Manifests of earlier versions are converted to
+// the current one, but for their Version.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var m manifestFile
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		if err := gob.NewDecoder(zr).Decode(&m); err != nil {
+			return nil, fmt.Errorf("couldn't decode manifest: %w", err)
+		}
+	} else if err := json.NewDecoder(br).Decode(&m); err != nil {
+		return nil, fmt.Errorf("couldn't decode manifest: %w", err)
+	}
+	if m.Version > ManifestVersion {
+		return nil, fmt.Errorf("manifest version %d is newer than supported version %d", m.Version, ManifestVersion)
+	}
+	return m.manifest(), nil
+}
+
+// ManifestFormatOf returns the format for a manifest file, based on its name: JSON for ".json" files and binary
+// for others
+func ManifestFormatOf(path string) ManifestFormat {
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		return ManifestFormatJSON
+	}
+	return ManifestFormatBinary
+}
+
+// SaveManifest writes the manifest to a file, in the format corresponding to its name
+func SaveManifest(path string, m *Manifest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteManifest(f, m, ManifestFormatOf(path)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadManifest reads a manifest from a file
+func LoadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadManifest(f)
+}
+
+// ManifestDiff is how a scan differs from an earlier one
+type ManifestDiff struct {
+	// AddedFiles are files of the newer scan that weren't in the older one
+	AddedFiles []string `json:"addedFiles"`
+	// RemovedFiles are files of the older scan that aren't in the newer one
+	RemovedFiles []string `json:"removedFiles"`
+	// ModifiedFiles are files of both scans whose size or modification time differ
+	ModifiedFiles []string `json:"modifiedFiles"`
+	// NewGroups are groups of duplicates of the newer scan whose contents weren't duplicated in the older one
+	NewGroups []DuplicateGroup `json:"newGroups"`
+	// ResolvedGroups are groups of duplicates of the older scan whose contents aren't duplicated in the newer one
+	ResolvedGroups []DuplicateGroup `json:"resolvedGroups"`
+}
+
+// DiffManifests compares manifests of two scans, which must be by the same hashing algorithm
+func DiffManifests(older, newer *Manifest) (*ManifestDiff, error) {
+	if older.Run.Algorithm != newer.Run.Algorithm {
+		return nil, fmt.Errorf("scans by different hashing algorithms (%s and %s) can't be compared",
+			older.Run.Algorithm, newer.Run.Algorithm)
+	}
+	diff := &ManifestDiff{}
+	for path, meta := range newer.Files {
+		olderMeta, exists := older.Files[path]
+		if !exists {
+			diff.AddedFiles = append(diff.AddedFiles, path)
+		} else if olderMeta.Size != meta.Size ||
+			// Either may be of a manifest of version 1, of modification times of whole seconds (see ModifiedAt)
+			!(olderMeta.ModifiedAt(meta.Modified) || meta.ModifiedAt(olderMeta.Modified)) {
+			diff.ModifiedFiles = append(diff.ModifiedFiles, path)
+		}
+	}
+	for path := range older.Files {
+		if _, exists := newer.Files[path]; !exists {
+			diff.RemovedFiles = append(diff.RemovedFiles, path)
+		}
+	}
+	sort.Strings(diff.AddedFiles)
+	sort.Strings(diff.RemovedFiles)
+	sort.Strings(diff.ModifiedFiles)
+	diff.NewGroups = groupsNotIn(newer.Groups, older.Groups)
+	diff.ResolvedGroups = groupsNotIn(older.Groups, newer.Groups)
+	return diff, nil
+}
+
+// groupsNotIn returns groups whose contents aren't those of any of others, sorted by their first paths. Digests are
+// compared without their strong hashes, since only some scans verify duplicates.
+func groupsNotIn(groups, others []DuplicateGroup) []DuplicateGroup {
+	contents := func(d FileDigest) FileDigest {
+		return FileDigest{FileExtension: d.FileExtension, FileHash: d.FileHash, FileSize: d.FileSize}
+	}
+	exists := make(map[FileDigest]bool, len(others))
+	for _, g := range others {
+		exists[contents(g.Digest)] = true
+	}
+	var notIn []DuplicateGroup
+	for _, g := range groups {
+		if !exists[contents(g.Digest)] {
+			paths := append([]string(nil), g.Paths...)
+			sort.Strings(paths)
+			notIn = append(notIn, DuplicateGroup{Digest: g.Digest, Paths: paths})
+		}
+	}
+	sort.Slice(notIn, func(i, j int) bool { return notIn[i].Paths[0] < notIn[j].Paths[0] })
+	return notIn
+}
@@ -0,0 +1,206 @@
+package entity
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	digest := FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}
+	duplicates := NewDigestToFiles()
+	duplicates.Set(digest, "/a/1.jpg")
+	duplicates.Set(digest, "/b/1.jpg")
+	m := NewManifest(
+		RunMetadata{RunID: "run", Directories: []string{"/a", "/b"}, Algorithm: "sampled",
+			StartedAt: time.Unix(1_700_000_000, 0).UTC(), FinishedAt: time.Unix(1_700_000_100, 0).UTC(),
+			Labels: Labels{"ticket": "OPS-1"}},
+		FilePathToMeta{
+			"/a/1.jpg": {Size: 10, Modified: time.Unix(1, 0).UTC()},
+			"/b/1.jpg": {Size: 10, Modified: time.Unix(2, 0).UTC()},
+			"/b/2.jpg": {Size: 10, Modified: time.Unix(3, 123_456_789).UTC()},
+		},
+		map[string]FileDigest{"/a/1.jpg": digest, "/b/1.jpg": digest, "/b/2.jpg": {
+			FileExtension: ".jpg", FileHash: "c", FileSize: 10, StrongAlgorithm: "sha256", StrongHash: "cc",
+		}},
+		duplicates,
+	)
+	for _, format := range []ManifestFormat{ManifestFormatJSON, ManifestFormatBinary} {
+		var bb bytes.Buffer
+		assert.Nil(t, WriteManifest(&bb, m, format))
+		loaded, err := ReadManifest(&bb)
+		assert.Nil(t, err)
+		assert.Equal(t, m, loaded)
+		assert.Equal(t, 1, loaded.Duplicates().Size())
+	}
+}
+
+// TestReadManifestVersion1 checks whether modification times of manifests of version 1, in seconds, are read
+func TestReadManifestVersion1(t *testing.T) {
+	m, err := ReadManifest(bytes.NewBufferString(`{"version": 1, "run": {"algorithm": "sampled"},
+		"files": {"/a/1.jpg": {"size": 10, "mtime": 1700000000}}}`))
+	assert.Nil(t, err)
+	meta := m.Files["/a/1.jpg"]
+	assert.True(t, meta.Modified.Equal(time.Unix(1_700_000_000, 0)))
+	assert.True(t, meta.ModifiedAt(time.Unix(1_700_000_000, 500_000_000)))
+	assert.False(t, meta.ModifiedAt(time.Unix(1_700_000_001, 0)))
+	precise := FileMeta{Size: 10, Modified: time.Unix(1_700_000_000, 500_000_000)}
+	assert.False(t, precise.ModifiedAt(time.Unix(1_700_000_000, 0)))
+	assert.True(t, precise.ModifiedAt(time.Unix(1_700_000_000, 500_000_000).UTC()))
+}
+
+func TestDigestIndexRoundTrip(t *testing.T) {
+	index := &DigestIndex{
+		Version:     DigestIndexVersion,
+		Host:        "nas",
+		Directories: []string{"/photos"},
+		Algorithm:   "sampled",
+		CreatedAt:   time.Unix(1_700_000_000, 0).UTC(),
+		Digests: map[string]FileDigest{
+			"/photos/1.jpg": {FileExtension: ".jpg", FileHash: "b", FileSize: 10},
+			"/photos/2.jpg": {FileExtension: ".jpg", FileHash: "c", FileSize: 10, StrongAlgorithm: "sha256",
+				StrongHash: "cc"},
+		},
+	}
+	for _, format := range []ManifestFormat{ManifestFormatJSON, ManifestFormatBinary} {
+		var bb bytes.Buffer
+		assert.Nil(t, WriteDigestIndex(&bb, index, format))
+		loaded, err := ReadDigestIndex(&bb)
+		assert.Nil(t, err)
+		assert.Equal(t, index, loaded)
+	}
+	_, err := ReadDigestIndex(bytes.NewBufferString(`{"version": 2}`))
+	assert.NotNil(t, err)
+}
+
+func TestDiffManifests(t *testing.T) {
+	photo := FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}
+	song := FileDigest{FileExtension: ".mp3", FileHash: "c", FileSize: 20}
+	older := &Manifest{
+		Run: RunMetadata{Algorithm: "sampled"},
+		Files: FilePathToMeta{
+			"/a/1.jpg": {Size: 10, Modified: time.Unix(1, 0).UTC()},
+			"/b/1.jpg": {Size: 10, Modified: time.Unix(1, 0).UTC()},
+			"/a/1.mp3": {Size: 20, Modified: time.Unix(1, 0).UTC()},
+			"/b/1.mp3": {Size: 20, Modified: time.Unix(1, 0).UTC()},
+		},
+		Groups: []DuplicateGroup{
+			{Digest: photo, Paths: []string{"/b/1.jpg", "/a/1.jpg"}},
+			{Digest: song, Paths: []string{"/a/1.mp3", "/b/1.mp3"}},
+		},
+	}
+	verifiedPhoto := photo
+	verifiedPhoto.StrongAlgorithm, verifiedPhoto.StrongHash = "sha256", "bb"
+	other := FileDigest{FileExtension: ".txt", FileHash: "d", FileSize: 30}
+	newer := &Manifest{
+		Run: RunMetadata{Algorithm: "sampled"},
+		Files: FilePathToMeta{
+			"/a/1.jpg": {Size: 10, Modified: time.Unix(1, 0).UTC()},
+			"/b/1.jpg": {Size: 10, Modified: time.Unix(1, 0).UTC()},
+			"/a/1.mp3": {Size: 20, Modified: time.Unix(2, 0).UTC()},
+			"/a/2.txt": {Size: 30, Modified: time.Unix(1, 0).UTC()},
+			"/c/2.txt": {Size: 30, Modified: time.Unix(1, 0).UTC()},
+		},
+		Groups: []DuplicateGroup{
+			{Digest: verifiedPhoto, Paths: []string{"/a/1.jpg", "/b/1.jpg"}},
+			{Digest: other, Paths: []string{"/c/2.txt", "/a/2.txt"}},
+		},
+	}
+	diff, err := DiffManifests(older, newer)
+	assert.Nil(t, err)
+	assert.Equal(t, &ManifestDiff{
+		AddedFiles:     []string{"/a/2.txt", "/c/2.txt"},
+		RemovedFiles:   []string{"/b/1.mp3"},
+		ModifiedFiles:  []string{"/a/1.mp3"},
+		NewGroups:      []DuplicateGroup{{Digest: other, Paths: []string{"/a/2.txt", "/c/2.txt"}}},
+		ResolvedGroups: []DuplicateGroup{{Digest: song, Paths: []string{"/a/1.mp3", "/b/1.mp3"}}},
+	}, diff)
+
+	newer.Run.Algorithm = "sha256"
+	_, err = DiffManifests(older, newer)
+	assert.ErrorContains(t, err, "different hashing algorithms")
+}
+
+func TestMergeDigestIndexes(t *testing.T) {
+	photo := FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}
+	song := FileDigest{FileExtension: ".mp3", FileHash: "c", FileSize: 20}
+	nas := &DigestIndex{Host: "nas", Algorithm: "sampled", Digests: map[string]FileDigest{
+		"/photos/1.jpg": photo,
+		"/photos/2.jpg": photo,
+		"/music/1.mp3":  song,
+	}}
+	laptop := &DigestIndex{Host: "laptop", Algorithm: "sampled", Digests: map[string]FileDigest{
+		// Of a verified scan, whose strong hash is the only one of files of its digest
+		"/home/a.jpg": {FileExtension: ".jpg", FileHash: "b", FileSize: 10, StrongAlgorithm: "sha256", StrongHash: "bb"},
+		"/home/b.txt": {FileExtension: ".txt", FileHash: "d", FileSize: 30},
+	}}
+	// Another export of the same host, of some of the same files
+	music := &DigestIndex{Host: "nas", Algorithm: "sampled", Digests: map[string]FileDigest{
+		"/music/1.mp3": song,
+	}}
+	duplicates, files, err := MergeDigestIndexes([]*DigestIndex{nas, laptop, music}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, duplicates.Size())
+	for digest, paths := range duplicates.All() {
+		assert.Equal(t, photo, digest)
+		assert.Equal(t, []string{"laptop:/home/a.jpg", "nas:/photos/1.jpg", "nas:/photos/2.jpg"}, paths)
+	}
+	assert.Equal(t, FileMeta{Size: 10}, files["laptop:/home/a.jpg"])
+	assert.Len(t, files, 3)
+
+	duplicates, _, err = MergeDigestIndexes([]*DigestIndex{nas, laptop, music}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, duplicates.Size())
+	nas.Digests["/photos/3.mp3"] = song
+	duplicates, _, err = MergeDigestIndexes([]*DigestIndex{nas, laptop, music}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, duplicates.Size())
+
+	_, _, err = MergeDigestIndexes([]*DigestIndex{nas, {Host: "other", Algorithm: "sha256"}}, true)
+	assert.NotNil(t, err)
+}
+
+// TestMergeDigestIndexesStrongHashes checks whether files are grouped by strong hashes when all of their digests have
+// them, and files of different strong hashes never together
+func TestMergeDigestIndexesStrongHashes(t *testing.T) {
+	photo := FileDigest{FileExtension: ".jpg", FileHash: "b", FileSize: 10}
+	strong := func(algorithm, hash string) FileDigest {
+		digest := photo
+		digest.StrongAlgorithm, digest.StrongHash = algorithm, hash
+		return digest
+	}
+	groups := func(indexes ...*DigestIndex) map[FileDigest][]string {
+		duplicates, _, err := MergeDigestIndexes(indexes, false)
+		assert.Nil(t, err)
+		m := map[FileDigest][]string{}
+		for digest, paths := range duplicates.All() {
+			m[digest] = paths
+		}
+		return m
+	}
+	nas := &DigestIndex{Host: "nas", Algorithm: "sampled", Digests: map[string]FileDigest{
+		"/1.jpg": strong("sha256", "bb"),
+		"/2.jpg": strong("sha256", "bb"),
+	}}
+	laptop := &DigestIndex{Host: "laptop", Algorithm: "sampled", Digests: map[string]FileDigest{
+		"/a.jpg": strong("sha256", "bb"),
+	}}
+	assert.Equal(t, map[FileDigest][]string{
+		strong("sha256", "bb"): {"laptop:/a.jpg", "nas:/1.jpg", "nas:/2.jpg"},
+	}, groups(nas, laptop))
+
+	// Files of the same sampled hash but of different contents
+	laptop.Digests["/b.jpg"] = strong("sha256", "cc")
+	laptop.Digests["/c.jpg"] = strong("sha256", "cc")
+	// And of contents that can't be compared with those of the others
+	laptop.Digests["/d.jpg"] = strong("blake3", "dd")
+	laptop.Digests["/e.jpg"] = photo
+	laptop.Digests["/f.jpg"] = photo
+	assert.Equal(t, map[FileDigest][]string{
+		strong("sha256", "bb"): {"laptop:/a.jpg", "nas:/1.jpg", "nas:/2.jpg"},
+		strong("sha256", "cc"): {"laptop:/b.jpg", "laptop:/c.jpg"},
+		photo:                  {"laptop:/e.jpg", "laptop:/f.jpg"},
+	}, groups(nas, laptop))
+}
@@ -6,12 +6,15 @@ const (
 	OutputModeCsvFile  = "csv"
 	OutputModeStdOut   = "print"
 	OutputModeJSON     = "json"
+	// OutputModeSHA256Sum writes checksums of all files scanned rather than a report of duplicates
+	OutputModeSHA256Sum = "sha256sum"
 )
 
 // OutputModes and their brief descriptions
 var OutputModes = map[string]string{
-	OutputModeTextFile: "creates a text file in current directory with basic information",
-	OutputModeCsvFile:  "creates a csv file in current directory with detailed information",
-	OutputModeStdOut:   "just prints the report without creating any file",
-	OutputModeJSON:     "creates a JSON file in the current directory with basic information",
+	OutputModeTextFile:  "creates a text file in current directory with basic information",
+	OutputModeCsvFile:   "creates a csv file in current directory with detailed information",
+	OutputModeStdOut:    "just prints the report without creating any file",
+	OutputModeJSON:      "creates a JSON file in the current directory with basic information",
+	OutputModeSHA256Sum: "creates a sha256sum-compatible manifest of all files (not just duplicates) in current directory",
 }
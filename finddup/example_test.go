@@ -0,0 +1,30 @@
+package finddup_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing/fstest"
+
+	"github.com/m-manu/go-find-duplicates/finddup"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func ExampleFind() {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"photos/a.jpg":        {Data: content},
+		"backup/photos/a.jpg": {Data: content},
+		"backup/b.jpg":        {Data: bytes.Repeat([]byte("different "), 1_000)},
+	})
+	result, err := finddup.Find(context.Background(), []string{"photos", "backup"}, finddup.WithFS(fsys),
+		finddup.WithLogger(fmte.Discard))
+	if err != nil {
+		panic(err)
+	}
+	for _, group := range finddup.Groups(result) {
+		fmt.Println(group.Paths)
+	}
+	// Output: [backup/photos/a.jpg photos/a.jpg]
+}
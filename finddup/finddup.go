@@ -0,0 +1,87 @@
+// Package finddup is the entry point for programs that use this module as a library to find duplicate files.
+//
+// This package, along with packages service, entity and bytesutil (and those types of packages fmte, vfs and
+// pkg/digestcache that they expose), follows semantic versioning: exported identifiers are neither removed nor
+// changed incompatibly within a major version. Packages under cmd and internal aren't part of the library.
+package finddup
+
+import (
+	"context"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// Version of this module
+const Version = "1.7.0"
+
+// Aliases of types that are part of the API of this package
+type (
+	// Options are the criteria for finding duplicates
+	Options = service.Options
+	// Option customizes Options
+	Option = service.Option
+	// Result is the outcome of finding duplicates
+	Result = service.Result
+	// Group is a group of files with identical contents
+	Group = entity.DuplicateGroup
+	// Hasher hashes contents of files
+	Hasher = service.Hasher
+	// ProgressListener is notified of progress of a scan
+	ProgressListener = service.ProgressListener
+	// FileFilter decides which files and directories are considered
+	FileFilter = service.FileFilter
+	// GroupFilter decides which groups of duplicates are reported
+	GroupFilter = service.GroupFilter
+)
+
+// Options that customize a scan
+var (
+	WithFS                = service.WithFS
+	WithExcludedFiles     = service.WithExcludedFiles
+	WithFileSizeThreshold = service.WithFileSizeThreshold
+	WithParallelism       = service.WithParallelism
+	WithIOWorkers         = service.WithIOWorkers
+	WithIOWorkersByDevice = service.WithIOWorkersByDevice
+	WithWalkWorkers       = service.WithWalkWorkers
+	WithMaxOpenFiles      = service.WithMaxOpenFiles
+	WithHasher            = service.WithHasher
+	WithVerifier          = service.WithVerifier
+	WithListener          = service.WithListener
+	WithCache             = service.WithCache
+	WithLogger            = service.WithLogger
+	WithMetrics           = service.WithMetrics
+	WithFileFilter        = service.WithFileFilter
+	WithGroupFilter       = service.WithGroupFilter
+	WithFollowSymlinks    = service.WithFollowSymlinks
+	WithReportSymlinks    = service.WithReportSymlinks
+	WithSpillAfter        = service.WithSpillAfter
+)
+
+// Errors that scans may fail with (matched using errors.Is)
+var (
+	ErrNotReadable = service.ErrNotReadable
+)
+
+// Find finds duplicate files in given directories
+func Find(ctx context.Context, directories []string, opts ...Option) (Result, error) {
+	return service.FindDuplicates(ctx, service.NewOptions(directories, opts...))
+}
+
+// Stream is like Find, except that every group of duplicates is sent on the returned channel as soon as it's
+// confirmed. See service.FindDuplicatesStream.
+func Stream(ctx context.Context, directories []string, opts ...Option) (<-chan Group, <-chan error) {
+	return service.FindDuplicatesStream(ctx, service.NewOptions(directories, opts...))
+}
+
+// Groups lists groups of duplicates of result, in the order of their iteration
+func Groups(result Result) []Group {
+	var groups []Group
+	if result.Duplicates == nil {
+		return groups
+	}
+	for digest, paths := range result.Duplicates.All() {
+		groups = append(groups, Group{Digest: digest, Paths: paths})
+	}
+	return groups
+}
@@ -1,43 +1,97 @@
 package fmte
 
 import (
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
-var p *message.Printer
+// Logger is a sink for output meant for users: messages about progress go to Printf and errors and warnings go to
+// PrintfErr. Implementations must be goroutine-safe.
+type Logger interface {
+	Printf(format string, a ...any)
+	PrintfErr(format string, a ...any)
+}
+
+// writerLogger is a Logger that formats messages in a language (English, unless it's localized) and writes them to
+// out and err
+type writerLogger struct {
+	mx  sync.Mutex
+	p   *message.Printer
+	out io.Writer
+	err io.Writer
+}
+
+// NewLogger creates a Logger that formats messages in English (e.g. with thousands separators) and writes them to
+// given writers
+func NewLogger(out, err io.Writer) Logger {
+	return NewLocalizedLogger(language.English, out, err)
+}
+
+// NewLocalizedLogger is like NewLogger, except that messages are translated to lang (by their formats, as keys of
+// translations in catalog.DefaultCatalog), and formatted for it. Messages without translations are in English.
+func NewLocalizedLogger(lang language.Tag, out, err io.Writer) Logger {
+	return &writerLogger{p: message.NewPrinter(lang), out: out, err: err}
+}
+
+func (l *writerLogger) Printf(format string, a ...any) {
+	l.mx.Lock()
+	_, _ = l.p.Fprintf(l.out, format, a...)
+	l.mx.Unlock()
+}
+
+func (l *writerLogger) PrintfErr(format string, a ...any) {
+	l.mx.Lock()
+	_, _ = l.p.Fprintf(l.err, format, a...)
+	l.mx.Unlock()
+}
 
-var mx sync.Mutex
+type discard struct{}
+
+func (discard) Printf(string, ...any)    {}
+func (discard) PrintfErr(string, ...any) {}
+
+// Discard is a Logger that discards all messages
+var Discard Logger = discard{}
+
+type global struct{}
+
+func (global) Printf(format string, a ...any)    { Printf(format, a...) }
+func (global) PrintfErr(format string, a ...any) { PrintfErr(format, a...) }
+
+// Global is a Logger that writes to whichever Logger is set through SetLogger at the time of writing
+var Global Logger = global{}
+
+var current atomic.Pointer[Logger]
 
 func init() {
-	p = message.NewPrinter(language.English)
+	SetLogger(NewLogger(os.Stdout, os.Stderr))
 }
 
-var normalPrint = true
+// SetLogger replaces the Logger that Printf and PrintfErr write to (by default, StdOut and StdErr).
+// It's safe to call this while other goroutines are printing.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = Discard
+	}
+	current.Store(&l)
+}
 
+// Off turns off all printing by this package. It's safe to call this while other goroutines are printing.
 func Off() {
-	normalPrint = false
+	SetLogger(Discard)
 }
 
 // Printf is goroutine-safe fmt.Printf for English
 func Printf(format string, a ...any) {
-	if !normalPrint {
-		return
-	}
-	mx.Lock()
-	_, _ = p.Printf(format, a...)
-	mx.Unlock()
+	(*current.Load()).Printf(format, a...)
 }
 
 // PrintfErr is goroutine-safe fmt.Printf to StdErr for English
 func PrintfErr(format string, a ...any) {
-	if !normalPrint {
-		return
-	}
-	mx.Lock()
-	_, _ = p.Fprintf(os.Stderr, format, a...)
-	mx.Unlock()
+	(*current.Load()).PrintfErr(format, a...)
 }
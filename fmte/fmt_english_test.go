@@ -0,0 +1,23 @@
+package fmte
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSetLogger checks whether Printf and PrintfErr write to the Logger set, in English
+func TestSetLogger(t *testing.T) {
+	var out, err bytes.Buffer
+	SetLogger(NewLogger(&out, &err))
+	defer Off()
+	Printf("found %d files\n", 12345)
+	PrintfErr("couldn't read %s\n", "a.txt")
+	assert.Equal(t, "found 12,345 files\n", out.String())
+	assert.Equal(t, "couldn't read a.txt\n", err.String())
+
+	Off()
+	Global.Printf("ignored\n")
+	assert.Equal(t, "found 12,345 files\n", out.String())
+}
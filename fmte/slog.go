@@ -0,0 +1,24 @@
+package fmte
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// SlogLogger adapts l to a Logger: messages of Printf are logged at info level and those of PrintfErr at warning level
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Printf(format string, a ...any) {
+	s.l.Info(strings.TrimSpace(fmt.Sprintf(format, a...)))
+}
+
+func (s slogLogger) PrintfErr(format string, a ...any) {
+	s.l.Warn(strings.TrimSpace(fmt.Sprintf(format, a...)))
+}
@@ -0,0 +1,32 @@
+//go:build !windows && !plan9
+
+package fmte
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+type syslogLogger struct {
+	w *syslog.Writer
+}
+
+// NewSyslogLogger creates a Logger that logs messages to the local syslog daemon (and so, on systems running
+// systemd, to the journal), with given tag: messages of Printf are logged at info level and those of PrintfErr at
+// warning level
+func NewSyslogLogger(tag string) (Logger, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogLogger{w: w}, nil
+}
+
+func (s syslogLogger) Printf(format string, a ...any) {
+	_ = s.w.Info(strings.TrimSpace(fmt.Sprintf(format, a...)))
+}
+
+func (s syslogLogger) PrintfErr(format string, a ...any) {
+	_ = s.w.Warning(strings.TrimSpace(fmt.Sprintf(format, a...)))
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package fmte
+
+import "errors"
+
+// NewSyslogLogger fails, since syslog isn't available on this system
+func NewSyslogLogger(string) (Logger, error) {
+	return nil, errors.New("syslog isn't supported on this system")
+}
@@ -0,0 +1,136 @@
+// Package backup finds which files are fully contained in repositories of backups of restic or borg, e.g. to know
+// whether a directory can be deleted safely
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// Repository is a repository of backups
+type Repository interface {
+	// String describes the repository, e.g. in reports
+	String() string
+	// Contains checks whether contents of a file are fully contained in backups of the repository
+	Contains(ctx context.Context, fsys vfs.FS, path string, size int64) (bool, error)
+}
+
+// runCommand runs a command, returning its standard output (tests replace it)
+var runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("%s %s failed: %w", name, strings.Join(args, " "), err)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// Open opens a repository of backups, as given by spec: "restic:<repository>" or
+// "borg:<repository>[::<archive>]" (the latest archive, if none is given). Repositories are read by commands
+// restic and borg, with their usual environment variables (e.g. for passwords).
+func Open(ctx context.Context, spec string) (Repository, error) {
+	kind, repo, found := strings.Cut(spec, ":")
+	if !found || repo == "" {
+		return nil, fmt.Errorf("invalid repository %q (expected restic:<repository> or borg:<repository>)", spec)
+	}
+	switch kind {
+	case "restic":
+		return openRestic(ctx, repo)
+	case "borg":
+		return openBorg(ctx, repo)
+	default:
+		return nil, fmt.Errorf("unsupported kind of repository %q (expected restic or borg)", kind)
+	}
+}
+
+// Check checks which of files are fully contained in repo, with parallelism of its own. Files that can't be read
+// are logged, and left out of those contained.
+func Check(ctx context.Context, repo Repository, fsys vfs.FS, files entity.FilePathToMeta, parallelism int,
+	logger fmte.Logger,
+) (contained map[string]bool, err error) {
+	contained = make(map[string]bool, len(files))
+	paths := make(chan string)
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	for range max(parallelism, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				isContained, cErr := repo.Contains(ctx, fsys, path, files[path].Size)
+				if cErr != nil {
+					if ctx.Err() == nil {
+						logger.PrintfErr("couldn't check whether %s is in backups: %+v\n", path, cErr)
+					}
+					continue
+				}
+				mx.Lock()
+				contained[path] = isContained
+				mx.Unlock()
+			}
+		}()
+	}
+	for path := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		paths <- path
+	}
+	close(paths)
+	wg.Wait()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return contained, ctxErr
+	}
+	return contained, nil
+}
+
+// ContainedDirs returns the topmost directories in roots (roots included) whose files are all contained in
+// backups, according to contained. Only files given are considered, so with files that weren't scanned (e.g. for
+// being too small), directories may have more files than these.
+func ContainedDirs(roots []string, files entity.FilePathToMeta, contained map[string]bool) []string {
+	isRoot := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		isRoot[root] = true
+	}
+	// notContained is whether directories have any file that's not contained
+	notContained := map[string]bool{}
+	for path := range files {
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			notContained[dir] = notContained[dir] || !contained[path]
+			if isRoot[dir] || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	var dirs []string
+	for dir, hasUncontained := range notContained {
+		if hasUncontained {
+			continue
+		}
+		if parent := filepath.Dir(dir); isRoot[dir] || parent == dir || notContained[parent] {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// errMissing stops reading a file once some part of it is found to be missing from backups
+var errMissing = errors.New("missing from backups")
@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPol is the polynomial of tests of github.com/restic/chunker
+const testPol = pol(0x3DA3358B4DC173)
+
+// random returns pseudo-random contents, as tests of github.com/restic/chunker do
+func random(seed int64, count int) []byte {
+	buf := make([]byte, count)
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 0; i < count; i += 4 {
+		r := rnd.Uint32()
+		buf[i], buf[i+1], buf[i+2], buf[i+3] = byte(r), byte(r>>8), byte(r>>16), byte(r>>24)
+	}
+	return buf
+}
+
+func chunks(t *testing.T, p pol, data []byte) (lengths []int, ids []string) {
+	assert.Nil(t, newChunker(p).split(bytes.NewReader(data), func(chunk []byte) error {
+		sum := sha256.Sum256(chunk)
+		lengths = append(lengths, len(chunk))
+		ids = append(ids, hex.EncodeToString(sum[:]))
+		return nil
+	}))
+	return lengths, ids
+}
+
+func TestChunker(t *testing.T) {
+	data := random(23, 32*1024*1024)
+	lengths, ids := chunks(t, testPol, data)
+	// These are the first chunks expected by tests of github.com/restic/chunker
+	assert.Equal(t, []int{2163460, 643703, 1528956}, lengths[:3])
+	assert.Equal(t, []string{
+		"4b94cb2cf293855ea43bf766731c74969b91aa6bf3c078719aabdd19860d590d",
+		"5727a63c0964f365ab8ed2ccf604912f2ea7be29759a2b53ede4d6841e397407",
+	}, ids[:2])
+	total := 0
+	for _, length := range lengths {
+		total += length
+		assert.LessOrEqual(t, length, maxChunkSize)
+	}
+	assert.Equal(t, len(data), total)
+
+	// Chunks after a change resynchronize with those before it
+	changed := append([]byte("inserted"), data...)
+	_, changedIDs := chunks(t, testPol, changed)
+	assert.NotEqual(t, ids[0], changedIDs[0])
+	assert.Equal(t, ids[1:], changedIDs[1:])
+
+	lengths, _ = chunks(t, testPol, data[:1000])
+	assert.Equal(t, []int{1000}, lengths)
+	lengths, _ = chunks(t, testPol, nil)
+	assert.Empty(t, lengths)
+}
+
+// fakeCommands makes commands run return outputs by their arguments
+func fakeCommands(t *testing.T, outputs map[string]string) func() {
+	old := runCommand
+	runCommand = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		command := name + " " + strings.Join(args, " ")
+		out, exists := outputs[command]
+		if !exists {
+			return nil, fmt.Errorf("unexpected command %q", command)
+		}
+		return []byte(out), nil
+	}
+	return func() { runCommand = old }
+}
+
+func writeFiles(t *testing.T, files map[string][]byte) (string, entity.FilePathToMeta) {
+	dir := t.TempDir()
+	metas := entity.FilePathToMeta{}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, content, 0o644))
+		metas[path] = entity.FileMeta{Size: int64(len(content))}
+	}
+	return dir, metas
+}
+
+// check checks which files are contained in the repository of spec, returning its name, and files and directories
+// contained, relative to dir
+func check(t *testing.T, spec, dir string, files entity.FilePathToMeta) (string, []string, []string) {
+	repo, err := Open(context.Background(), spec)
+	assert.Nil(t, err)
+	contained, err := Check(context.Background(), repo, vfs.Local, files, 2, fmte.Discard)
+	assert.Nil(t, err)
+	var containedFiles []string
+	for path, isContained := range contained {
+		if isContained {
+			rel, _ := filepath.Rel(dir, path)
+			containedFiles = append(containedFiles, filepath.ToSlash(rel))
+		}
+	}
+	var dirs []string
+	for _, d := range ContainedDirs([]string{dir}, files, contained) {
+		rel, _ := filepath.Rel(dir, d)
+		dirs = append(dirs, filepath.ToSlash(rel))
+	}
+	sort.Strings(containedFiles)
+	return repo.String(), containedFiles, dirs
+}
+
+var (
+	big     = random(1, 3*1024*1024)
+	changed = append(append([]byte(nil), big[:2*1024*1024]...), []byte("changed")...)
+	small   = []byte("small file")
+)
+
+func TestRestic(t *testing.T) {
+	// The repository has blobs of big and small, but not of the end of changed
+	_, bigIDs := chunks(t, testPol, big)
+	_, smallIDs := chunks(t, testPol, small)
+	var blobs strings.Builder
+	for _, id := range append(bigIDs, smallIDs...) {
+		blobs.WriteString("data " + id + "\n")
+	}
+	blobs.WriteString("tree " + strings.Repeat("0", 64) + "\n")
+	defer fakeCommands(t, map[string]string{
+		"restic --repo /srv/restic --no-lock cat config": `{"version":2,"chunker_polynomial":"3da3358b4dc173"}`,
+		"restic --repo /srv/restic --no-lock list blobs": blobs.String(),
+	})()
+	dir, files := writeFiles(t, map[string][]byte{
+		"photos/a.jpg":       big,
+		"photos/2020/b.txt":  small,
+		"photos/2020/c.jpg":  big,
+		"music/changed.flac": changed,
+		"music/a.txt":        small,
+		"empty/empty.txt":    nil,
+	})
+	name, contained, dirs := check(t, "restic:/srv/restic", dir, files)
+	assert.Equal(t, "restic repository /srv/restic", name)
+	assert.Equal(t, []string{"empty/empty.txt", "music/a.txt", "photos/2020/b.txt", "photos/2020/c.jpg",
+		"photos/a.jpg"}, contained)
+	assert.Equal(t, []string{"empty", "photos"}, dirs)
+}
+
+func TestBorg(t *testing.T) {
+	hash := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	listing := fmt.Sprintf("d 0  home/photos\x00- %d %s home/photos/a.jpg\x00- %d %s home/odd name\nwith newline\x00"+
+		"l 0  home/link\x00", len(big), hash(big), len(small), hash(small))
+	defer fakeCommands(t, map[string]string{
+		"borg list --last 1 --format {archive}{NL} /srv/borg":              "host-2024-06-01\n",
+		"borg list --format " + borgFormat + " /srv/borg::host-2024-06-01": listing,
+		"borg list --format " + borgFormat + " /srv/borg::old":             "",
+	})()
+	dir, files := writeFiles(t, map[string][]byte{
+		"photos/a.jpg":       big,
+		"photos/b.txt":       small,
+		"music/changed.flac": changed,
+	})
+	name, contained, dirs := check(t, "borg:/srv/borg", dir, files)
+	assert.Equal(t, "borg archive /srv/borg::host-2024-06-01", name)
+	assert.Equal(t, []string{"photos/a.jpg", "photos/b.txt"}, contained)
+	assert.Equal(t, []string{"photos"}, dirs)
+
+	name, contained, dirs = check(t, "borg:/srv/borg::old", dir, files)
+	assert.Equal(t, "borg archive /srv/borg::old", name)
+	assert.Empty(t, contained)
+	assert.Empty(t, dirs)
+}
+
+func TestOpen(t *testing.T) {
+	defer fakeCommands(t, map[string]string{
+		"restic --repo bad --no-lock cat config":          `{"chunker_polynomial":"xyz"}`,
+		"borg list --last 1 --format {archive}{NL} empty": "",
+	})()
+	for spec, expectedErr := range map[string]string{
+		"/srv/restic":   "invalid repository",
+		"restic:":       "invalid repository",
+		"tarsnap:/srv":  "unsupported kind of repository",
+		"restic:bad":    "invalid chunker polynomial",
+		"restic:absent": "unexpected command",
+		"borg:empty":    "has no archives",
+	} {
+		_, err := Open(context.Background(), spec)
+		assert.ErrorContains(t, err, expectedErr, spec)
+	}
+}
+
+func TestContainedDirs(t *testing.T) {
+	root := filepath.Join("/", "data")
+	files := entity.FilePathToMeta{}
+	contained := map[string]bool{}
+	for name, isContained := range map[string]bool{
+		"a/1": true, "a/b/2": true, "a/b/c/3": true,
+		"d/4": true, "d/e/5": false, "d/f/6": true,
+		"7": true,
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		files[path] = entity.FileMeta{}
+		contained[path] = isContained
+	}
+	assert.Equal(t, []string{filepath.Join(root, "a"), filepath.Join(root, "d", "f")},
+		ContainedDirs([]string{root}, files, contained))
+
+	contained[filepath.Join(root, "d", "e", "5")] = true
+	assert.Equal(t, []string{root}, ContainedDirs([]string{root}, files, contained))
+}
@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// borgFile identifies contents of a file in an archive of borg
+type borgFile struct {
+	size int64
+	hash string
+}
+
+// borg is an archive of a repository of borg, whose files are contained if a file of same size and SHA-256 hash
+// is in the archive. Unlike with restic, chunks of borg can't be matched with, since they're split by a secret
+// of the repository.
+type borg struct {
+	archive string
+	files   map[borgFile]bool
+	sizes   map[int64]bool
+}
+
+// borgFormat is the format of files listed by borg, separated by NUL bytes since paths may have newlines
+const borgFormat = "{type} {size} {sha256} {path}{NUL}"
+
+func openBorg(ctx context.Context, repo string) (*borg, error) {
+	location, archive, _ := strings.Cut(repo, "::")
+	if archive == "" {
+		out, err := runCommand(ctx, "borg", "list", "--last", "1", "--format", "{archive}{NL}", location)
+		if err != nil {
+			return nil, err
+		}
+		if archive = strings.TrimSpace(string(out)); archive == "" {
+			return nil, fmt.Errorf("borg repository %s has no archives", location)
+		}
+	}
+	b := &borg{archive: location + "::" + archive, files: map[borgFile]bool{}, sizes: map[int64]bool{}}
+	// Listing hashes makes borg read contents of all files of the archive, which takes a while
+	out, err := runCommand(ctx, "borg", "list", "--format", borgFormat, b.archive)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range bytes.Split(out, []byte{0}) {
+		fields := strings.SplitN(string(record), " ", 4)
+		if len(fields) < 4 || fields[0] != "-" {
+			// Only regular files have hashes
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size of %s listed by borg: %q", fields[3], fields[1])
+		}
+		b.files[borgFile{size: size, hash: fields[2]}] = true
+		b.sizes[size] = true
+	}
+	return b, nil
+}
+
+func (b *borg) String() string {
+	return "borg archive " + b.archive
+}
+
+func (b *borg) Contains(ctx context.Context, fsys vfs.FS, path string, size int64) (bool, error) {
+	if !b.sizes[size] {
+		return false, nil
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, &contextReader{ctx: ctx, r: f}); err != nil {
+		return false, err
+	}
+	return b.files[borgFile{size: size, hash: hex.EncodeToString(h.Sum(nil))}], nil
+}
+
+// contextReader is an io.Reader that stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
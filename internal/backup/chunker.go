@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Parameters of content-defined chunking of restic (as of github.com/restic/chunker), which splits contents of
+// files into blobs where a rolling Rabin fingerprint of the last windowSize bytes has its lowest splitBits bits
+// unset, so that blobs of unchanged parts of files are shared across files and snapshots
+const (
+	windowSize   = 64
+	minChunkSize = 512 * 1024
+	maxChunkSize = 8 * 1024 * 1024
+	splitMask    = 1<<20 - 1
+)
+
+// pol is a polynomial over GF(2), with bits as its coefficients
+type pol uint64
+
+func (x pol) deg() int {
+	return bits.Len64(uint64(x)) - 1
+}
+
+func (x pol) mod(d pol) pol {
+	for x.deg() >= d.deg() {
+		x ^= d << uint(x.deg()-d.deg())
+	}
+	return x
+}
+
+func appendByte(h pol, b byte, p pol) pol {
+	return (h<<8 | pol(b)).mod(p)
+}
+
+// chunker splits contents into chunks as restic does, for the polynomial of a repository
+type chunker struct {
+	polShift uint
+	// out has fingerprints of each byte followed by windowSize-1 zero bytes, to slide bytes out of the window
+	out [256]pol
+	// mod has, by the top byte of a fingerprint shifted by a byte, what reduces it modulo the polynomial
+	mod [256]pol
+}
+
+func newChunker(p pol) *chunker {
+	c := &chunker{polShift: uint(p.deg() - 8)}
+	for b := 0; b < 256; b++ {
+		h := appendByte(0, byte(b), p)
+		for i := 0; i < windowSize-1; i++ {
+			h = appendByte(h, 0, p)
+		}
+		c.out[b] = h
+	}
+	k := uint(p.deg())
+	for b := 0; b < 256; b++ {
+		c.mod[b] = (pol(b) << k).mod(p) | pol(b)<<k
+	}
+	return c
+}
+
+// split calls fn with each chunk of contents read from r, in order. Chunks passed to fn are valid only during
+// the call.
+func (c *chunker) split(r io.Reader, fn func(chunk []byte) error) error {
+	br := bufio.NewReaderSize(r, 1024*1024)
+	chunk := make([]byte, minChunkSize, maxChunkSize)
+	for {
+		// No chunk ends before its minimum size, so bytes up to where the window starts are just read
+		n, err := io.ReadFull(br, chunk[:minChunkSize-windowSize])
+		chunk = chunk[:n]
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if n == 0 {
+				return nil
+			}
+			return fn(chunk)
+		}
+		if err != nil {
+			return err
+		}
+		var window [windowSize]byte
+		wpos := 0
+		var digest uint64
+		slide := func(b byte) {
+			out := window[wpos]
+			window[wpos] = b
+			digest ^= uint64(c.out[out])
+			wpos = (wpos + 1) % windowSize
+			index := byte(digest >> c.polShift)
+			digest = (digest<<8 | uint64(b)) ^ uint64(c.mod[index])
+		}
+		// As with restic, fingerprints of chunks start with a byte of 1 slid in
+		slide(1)
+		for {
+			b, err := br.ReadByte()
+			if errors.Is(err, io.EOF) {
+				return fn(chunk)
+			}
+			if err != nil {
+				return err
+			}
+			chunk = append(chunk, b)
+			slide(b)
+			if len(chunk) >= minChunkSize && (digest&splitMask == 0 || len(chunk) >= maxChunkSize) {
+				break
+			}
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// restic is a repository of restic, whose files are contained if all of their blobs are in its index. Blobs are
+// chunks of contents of files as split by the polynomial of the repository, identified by their SHA-256 hashes.
+type restic struct {
+	repo    string
+	chunker *chunker
+	blobs   map[[sha256.Size]byte]struct{}
+}
+
+func openRestic(ctx context.Context, repo string) (*restic, error) {
+	out, err := runCommand(ctx, "restic", "--repo", repo, "--no-lock", "cat", "config")
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		ChunkerPolynomial string `json:"chunker_polynomial"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, fmt.Errorf("invalid config of restic repository: %w", err)
+	}
+	p, err := strconv.ParseUint(config.ChunkerPolynomial, 16, 64)
+	if err != nil || pol(p).deg() < 8 {
+		return nil, fmt.Errorf("invalid chunker polynomial %q of restic repository", config.ChunkerPolynomial)
+	}
+	out, err = runCommand(ctx, "restic", "--repo", repo, "--no-lock", "list", "blobs")
+	if err != nil {
+		return nil, err
+	}
+	r := &restic{repo: repo, chunker: newChunker(pol(p)), blobs: map[[sha256.Size]byte]struct{}{}}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// Lines are of types of blobs (data or tree) and their IDs
+		kind, id, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if kind != "data" {
+			continue
+		}
+		var blob [sha256.Size]byte
+		if n, err := hex.Decode(blob[:], []byte(id)); err != nil || n != sha256.Size {
+			return nil, fmt.Errorf("invalid ID of blob %q listed by restic", id)
+		}
+		r.blobs[blob] = struct{}{}
+	}
+	return r, nil
+}
+
+func (r *restic) String() string {
+	return "restic repository " + r.repo
+}
+
+func (r *restic) Contains(ctx context.Context, fsys vfs.FS, path string, _ int64) (bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	err = r.chunker.split(&contextReader{ctx: ctx, r: f}, func(chunk []byte) error {
+		if _, exists := r.blobs[sha256.Sum256(chunk)]; !exists {
+			return errMissing
+		}
+		return nil
+	})
+	if errors.Is(err, errMissing) {
+		return false, nil
+	}
+	return err == nil, err
+}
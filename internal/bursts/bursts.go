@@ -0,0 +1,148 @@
+// Package bursts finds bursts of photos: photos taken within moments of each other (as EXIF metadata has it) that
+// look alike, as cameras take in burst mode, or as photographers do holding the shutter button down. Photos of a burst
+// aren't duplicates, since they differ a little, but usually only the best of them are worth keeping, so they're
+// found to be reviewed together.
+package bursts
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Photos are JPEGs, of which EXIF metadata is read
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// Extensions of files that are read as photos
+var Extensions = []string{".jpg", ".jpeg"}
+
+// Photo is a photo, as told apart from others of bursts
+type Photo struct {
+	Path string `json:"path"`
+	// TakenAt is when the photo was taken, as EXIF metadata of it has it
+	TakenAt time.Time `json:"takenAt"`
+	// Hash is a perceptual hash of the photo, which photos that look alike have alike (see dHash)
+	Hash uint64 `json:"-"`
+}
+
+// Read reads when the photo at path of fsys was taken, and hashes it
+func Read(fsys vfs.FS, path string) (Photo, error) {
+	f, err := vfs.OpenFile(fsys, path)
+	if err != nil {
+		return Photo{}, err
+	}
+	defer f.Close()
+	t, err := takenAt(io.NewSectionReader(f, 0, 1<<63-1))
+	if err != nil {
+		return Photo{}, err
+	}
+	img, _, err := image.Decode(io.NewSectionReader(f, 0, 1<<63-1))
+	if err != nil {
+		return Photo{}, fmt.Errorf("couldn't decode photo: %w", err)
+	}
+	return Photo{Path: path, TakenAt: t, Hash: dHash(img)}, nil
+}
+
+// Collect reads photos (files of Extensions) of directories of fsys with workers reading them concurrently. Photos that
+// can't be read, such as those without EXIF metadata of when they were taken, are passed to skipped, and left out.
+func Collect(ctx context.Context, fsys vfs.FS, directories []string, workers int,
+	skipped func(path string, err error),
+) ([]Photo, error) {
+	paths := make(chan string)
+	var (
+		mx     sync.Mutex
+		photos []Photo
+		wg     sync.WaitGroup
+	)
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				photo, err := Read(fsys, path)
+				mx.Lock()
+				if err != nil {
+					skipped(path, err)
+				} else {
+					photos = append(photos, photo)
+				}
+				mx.Unlock()
+			}
+		}()
+	}
+	var err error
+	for _, dir := range directories {
+		if err = vfs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if d.Type().IsRegular() && isPhoto(path) {
+				paths <- path
+			}
+			return nil
+		}); err != nil {
+			break
+		}
+	}
+	close(paths)
+	wg.Wait()
+	return photos, err
+}
+
+func isPhoto(path string) bool {
+	ext := utils.GetFileExt(path)
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Burst is photos taken one after another, in order of when they were taken
+type Burst []Photo
+
+// Span is the time from when the first photo of the burst was taken to when the last one was
+func (b Burst) Span() time.Duration {
+	return b[len(b)-1].TakenAt.Sub(b[0].TakenAt)
+}
+
+// Find finds bursts of photos: runs of at least 2 photos, each of which was taken within window of the previous one,
+// and whose hash differs from that of the previous one by maxDistance bits at most (of 64). Bursts are in order of
+// when they were taken.
+func Find(photos []Photo, window time.Duration, maxDistance int) []Burst {
+	sorted := append([]Photo(nil), photos...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].TakenAt.Equal(sorted[j].TakenAt) {
+			return sorted[i].TakenAt.Before(sorted[j].TakenAt)
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	var bursts []Burst
+	var current Burst
+	for _, photo := range sorted {
+		if len(current) > 0 {
+			previous := current[len(current)-1]
+			if photo.TakenAt.Sub(previous.TakenAt) > window || distance(photo.Hash, previous.Hash) > maxDistance {
+				if len(current) > 1 {
+					bursts = append(bursts, current)
+				}
+				current = nil
+			}
+		}
+		current = append(current, photo)
+	}
+	if len(current) > 1 {
+		bursts = append(bursts, current)
+	}
+	return bursts
+}
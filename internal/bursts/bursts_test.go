@@ -0,0 +1,137 @@
+package bursts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// scene is an image of blobs, brightened by brightness, as photos of a burst are of the same scene with exposures that
+// differ a little
+func scene(brightness int, phase float64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 160, 120))
+	for y := range 120 {
+		for x := range 160 {
+			v := 128 + 90*math.Sin(float64(x)/17+phase)*math.Cos(float64(y)/13-phase) + float64(brightness)
+			img.SetGray(x, y, color.Gray{Y: uint8(max(0, min(255, v)))})
+		}
+	}
+	return img
+}
+
+// photo encodes img as a JPEG, with EXIF metadata of it being taken at dateTime (and subSec) if dateTime isn't empty
+func photo(t *testing.T, img image.Image, dateTime, subSec string) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, img, nil))
+	if dateTime == "" {
+		return buf.Bytes()
+	}
+	le := binary.LittleEndian
+	tiff := []byte("II")
+	tiff = le.AppendUint16(tiff, 42)
+	tiff = le.AppendUint32(tiff, 8)
+	// IFD0, of a pointer to the Exif IFD (at 26)
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, tagExifIFD)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 26)
+	tiff = le.AppendUint32(tiff, 0)
+	// Exif IFD, of DateTimeOriginal (at 56) and SubSecTimeOriginal (within its entry)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, tagDateTimeOriginal)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint32(tiff, uint32(len(dateTime)+1))
+	tiff = le.AppendUint32(tiff, 56)
+	tiff = le.AppendUint16(tiff, tagSubSecTimeOriginal)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint32(tiff, uint32(len(subSec)+1))
+	tiff = append(tiff, []byte(subSec + "\x00\x00\x00\x00")[:4]...)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, dateTime+"\x00"...)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(len(segment)+2))
+	jpg := buf.Bytes()
+	return append(append(append([]byte{}, jpg[:2]...), append(app1, segment...)...), jpg[2:]...)
+}
+
+func TestTakenAt(t *testing.T) {
+	taken, err := takenAt(bytes.NewReader(photo(t, scene(0, 0), "2024:05:17 09:30:12", "25")))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 5, 17, 9, 30, 12, 250_000_000, time.UTC), taken)
+	_, err = takenAt(bytes.NewReader(photo(t, scene(0, 0), "", "")))
+	assert.ErrorIs(t, err, errNoExif)
+	_, err = takenAt(strings.NewReader("not a photo"))
+	assert.NotNil(t, err)
+}
+
+func TestDHash(t *testing.T) {
+	hash := dHash(scene(0, 0))
+	assert.LessOrEqual(t, distance(hash, dHash(scene(6, 0))), 4)
+	assert.Greater(t, distance(hash, dHash(scene(0, 2))), 16)
+	// Hashes of JPEGs (of luma) are those of the images they were encoded from, give or take compression
+	decoded, err := jpeg.Decode(bytes.NewReader(photo(t, scene(0, 0), "", "")))
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, distance(hash, dHash(decoded)), 4)
+}
+
+func TestFind(t *testing.T) {
+	start := time.Date(2024, 5, 17, 9, 30, 12, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	photos := []Photo{
+		{Path: "c.jpg", TakenAt: at(600 * time.Millisecond), Hash: 0b0110},
+		{Path: "a.jpg", TakenAt: at(0), Hash: 0b1111},
+		{Path: "b.jpg", TakenAt: at(300 * time.Millisecond), Hash: 0b1110},
+		// Taken long after the others
+		{Path: "d.jpg", TakenAt: at(time.Minute), Hash: 0b0111},
+		// Taken right after, but of something else
+		{Path: "e.jpg", TakenAt: at(time.Minute + time.Second), Hash: ^uint64(0)},
+		{Path: "f.jpg", TakenAt: at(time.Minute + 2*time.Second), Hash: ^uint64(1)},
+	}
+	bursts := Find(photos, 2*time.Second, 1)
+	assert.Len(t, bursts, 2)
+	assert.Equal(t, []string{"a.jpg", "b.jpg", "c.jpg"}, paths(bursts[0]))
+	assert.Equal(t, 600*time.Millisecond, bursts[0].Span())
+	assert.Equal(t, []string{"e.jpg", "f.jpg"}, paths(bursts[1]))
+	assert.Empty(t, Find(photos, 100*time.Millisecond, 64))
+}
+
+func TestCollect(t *testing.T) {
+	fsys := fstest.MapFS{
+		"p/a.jpg":       {Data: photo(t, scene(0, 0), "2024:05:17 09:30:12", "1")},
+		"p/b.JPEG":      {Data: photo(t, scene(4, 0), "2024:05:17 09:30:12", "6")},
+		"p/c.jpg":       {Data: photo(t, scene(0, 2), "2024:05:17 09:30:13", "")},
+		"p/no-exif.jpg": {Data: photo(t, scene(0, 0), "", "")},
+		"p/notes.txt":   {Data: []byte("not a photo")},
+	}
+	var skipped []string
+	photos, err := Collect(context.Background(), vfs.FromFS(fsys), []string{"p"}, 2, func(path string, err error) {
+		assert.ErrorIs(t, err, errNoExif)
+		skipped = append(skipped, path)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"p/no-exif.jpg"}, skipped)
+	assert.Len(t, photos, 3)
+	bursts := Find(photos, 2*time.Second, 10)
+	assert.Len(t, bursts, 1)
+	assert.Equal(t, []string{"p/a.jpg", "p/b.JPEG"}, paths(bursts[0]))
+}
+
+func paths(burst Burst) []string {
+	var paths []string
+	for _, photo := range burst {
+		paths = append(paths, photo.Path)
+	}
+	return paths
+}
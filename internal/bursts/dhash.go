@@ -0,0 +1,61 @@
+package bursts
+
+import (
+	"image"
+	"math/bits"
+)
+
+const (
+	// dHashWidth and dHashHeight are of the grid of cells of dHash, which is one cell wider than bits of a row
+	dHashWidth  = 9
+	dHashHeight = 8
+	// samplesPerCell is the number of pixels of each side of a cell that are sampled, rather than all of its pixels,
+	// so that hashing photos of tens of megapixels takes as long as hashing thumbnails
+	samplesPerCell = 8
+)
+
+// dHash is a difference hash of the image: it's scaled down to a grid of 9×8 cells of their average brightness, and
+// bit i of the hash (of row i/8 and column i%8) is whether the cell is brighter than that right of it. Hashes of
+// images that look alike, such as photos of a burst, differ by a few bits only (see distance), however they were
+// compressed or scaled.
+func dHash(img image.Image) uint64 {
+	var cells [dHashHeight][dHashWidth]uint32
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	const columns, rows = dHashWidth * samplesPerCell, dHashHeight * samplesPerCell
+	for row := range rows {
+		y := bounds.Min.Y + (2*row+1)*h/(2*rows)
+		for column := range columns {
+			x := bounds.Min.X + (2*column+1)*w/(2*columns)
+			cells[row/samplesPerCell][column/samplesPerCell] += brightness(img, x, y)
+		}
+	}
+	var hash uint64
+	for y := range dHashHeight {
+		for x := range dHashWidth - 1 {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// brightness is the brightness of the pixel of img at (x, y). Pixels of JPEGs are read from their luma directly.
+func brightness(img image.Image, x, y int) uint32 {
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		return uint32(ycbcr.Y[ycbcr.YOffset(x, y)])
+	}
+	r, g, b, _ := img.At(x, y).RGBA()
+	// As of color.GrayModel, to 8 bits
+	return (19595*r + 38470*g + 7471*b + 1<<15) >> 24
+}
+
+// distance is the number of bits that hashes differ by
+func distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,143 @@
+package bursts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Tags of EXIF (see https://www.cipa.jp/std/documents/e/DC-X008-Translation-2019-E.pdf)
+const (
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagSubSecTimeOriginal = 0x9291
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// errNoExif is returned for images without EXIF metadata of when they were taken
+var errNoExif = errors.New("no EXIF date and time of when the photo was taken")
+
+// takenAt reads when a photo was taken from EXIF metadata of the JPEG of r: DateTimeOriginal, to the fraction of the
+// second of SubSecTimeOriginal, as cameras record for bursts (or DateTime, of photos that don't have it). Times
+// without offsets (OffsetTimeOriginal) are taken to be in UTC, which is all the same for comparing photos of a camera.
+func takenAt(r io.Reader) (time.Time, error) {
+	tiff, err := readExif(bufio.NewReader(r))
+	if err != nil {
+		return time.Time{}, err
+	}
+	order, ifd0, ok := tiffHeader(tiff)
+	if !ok {
+		return time.Time{}, errNoExif
+	}
+	tags := readIFD(tiff, order, ifd0)
+	dateTime, subSec, offset := tags[tagDateTime], "", ""
+	if exifIFD, ok := tags[tagExifIFD]; ok && len(exifIFD) == 4 {
+		exif := readIFD(tiff, order, order.Uint32([]byte(exifIFD)))
+		if original, ok := exif[tagDateTimeOriginal]; ok {
+			dateTime, subSec, offset = original, exif[tagSubSecTimeOriginal], exif[tagOffsetTimeOriginal]
+		}
+	}
+	location := time.UTC
+	if offset != "" {
+		if t, err := time.Parse("-07:00", offset); err == nil {
+			location = t.Location()
+		}
+	}
+	t, err := time.ParseInLocation(exifTimeLayout, dateTime, location)
+	if err != nil {
+		return time.Time{}, errNoExif
+	}
+	if subSec = strings.TrimSpace(subSec); subSec != "" {
+		if fraction, err := time.ParseDuration("0." + subSec + "s"); err == nil {
+			t = t.Add(fraction)
+		}
+	}
+	return t, nil
+}
+
+// readExif reads segments of the JPEG of r up to its APP1 segment of EXIF metadata, returning the TIFF structure of
+// the segment
+func readExif(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return nil, errors.New("not a JPEG")
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xff {
+			return nil, errNoExif
+		}
+		// Segments of image data (from start of scan on) come after those of metadata
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return nil, errNoExif
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, errNoExif
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, errNoExif
+		}
+		if tiff, isExif := bytes.CutPrefix(segment, []byte("Exif\x00\x00")); marker[1] == 0xe1 && isExif {
+			return tiff, nil
+		}
+	}
+}
+
+// tiffHeader returns the byte order of the TIFF structure, and the offset of its first IFD
+func tiffHeader(tiff []byte) (binary.ByteOrder, uint32, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, 0, false
+	}
+	return order, order.Uint32(tiff[4:]), true
+}
+
+// readIFD reads values of ASCII tags of the IFD at offset of the TIFF structure, by their tags, and the (4 bytes of)
+// values of pointers to other IFDs
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]string {
+	tags := map[uint16]string{}
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return tags
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := range count {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(tiff)) {
+			break
+		}
+		entry := tiff[start : start+12]
+		tag, typ, n, value := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:]), entry[8:12]
+		switch {
+		case tag == tagExifIFD:
+			tags[tag] = string(value)
+		case typ == 2 && n <= 4:
+			tags[tag] = strings.TrimRight(string(value[:n]), "\x00 ")
+		case typ == 2:
+			at := uint64(order.Uint32(value))
+			if at+uint64(n) <= uint64(len(tiff)) {
+				tags[tag] = strings.TrimRight(string(tiff[at:at+uint64(n)]), "\x00 ")
+			}
+		}
+	}
+	return tags
+}
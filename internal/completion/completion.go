@@ -0,0 +1,286 @@
+// Package completion generates scripts of completion of arguments for shells (bash, zsh, fish and PowerShell), from
+// flags and subcommands of a program
+package completion
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Shells that scripts of completion are generated for
+var Shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// Flag is a flag to complete
+type Flag struct {
+	// Name is the name of the flag, without dashes
+	Name string
+	// Shorthand is the single-letter name of the flag, if it has one
+	Shorthand string
+	// Usage describes the flag
+	Usage string
+	// TakesValue is whether the flag must be followed by a value
+	TakesValue bool
+	// Values are values of the flag to complete (files are completed if there are none, nor ValuesCommand)
+	Values []string
+	// ValuesCommand is a command whose output, one value per line, are values to complete (e.g. of profiles of a
+	// configuration file, which can't be known when the script is generated)
+	ValuesCommand string
+}
+
+// Spec is what's completed for a program
+type Spec struct {
+	// Program is the name of the program
+	Program string
+	// Commands are subcommands of the program, completed in place of its first argument (along with directories)
+	Commands []string
+	// Flags are flags of the program
+	Flags []Flag
+}
+
+// FromFlagSet returns flags of fs to complete, except hidden ones
+func FromFlagSet(fs *flag.FlagSet) []Flag {
+	var flags []Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Hidden {
+			return
+		}
+		usage, _, _ := strings.Cut(f.Usage, "\n")
+		flags = append(flags, Flag{
+			Name:       f.Name,
+			Shorthand:  f.Shorthand,
+			Usage:      usage,
+			TakesValue: f.Value.Type() != "bool" && f.NoOptDefVal == "",
+		})
+	})
+	return flags
+}
+
+// Write writes the script of completion of spec for shell
+func Write(w io.Writer, shell string, spec Spec) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bash(spec)
+	case "zsh":
+		script = zsh(spec)
+	case "fish":
+		script = fish(spec)
+	case "powershell":
+		script = powershell(spec)
+	default:
+		return fmt.Errorf("unsupported shell %q (expected one of: %s)", shell, strings.Join(Shells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// names returns names of f on the command line ("--name" and "-n")
+func (f Flag) names() []string {
+	names := []string{"--" + f.Name}
+	if f.Shorthand != "" {
+		names = append(names, "-"+f.Shorthand)
+	}
+	return names
+}
+
+var nonIdentifierRegex = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// function returns the name of the shell function completing program
+func function(program string) string {
+	return "_" + nonIdentifierRegex.ReplaceAllString(program, "_")
+}
+
+func bash(spec Spec) string {
+	var sb strings.Builder
+	var allNames, fileNames []string
+	fn := function(spec.Program)
+	fmt.Fprintf(&sb, "# bash completion of %s, e.g. by: source <(%s completion bash)\n", spec.Program, spec.Program)
+	fmt.Fprintf(&sb, "%s() {\n", fn)
+	sb.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	sb.WriteString("    case \"$prev\" in\n")
+	for _, f := range spec.Flags {
+		allNames = append(allNames, f.names()...)
+		if !f.TakesValue {
+			continue
+		}
+		var values string
+		switch {
+		case f.ValuesCommand != "":
+			values = "\"$(" + f.ValuesCommand + " 2>/dev/null)\""
+		case len(f.Values) > 0:
+			values = "\"" + strings.Join(f.Values, " ") + "\""
+		default:
+			fileNames = append(fileNames, f.names()...)
+			continue
+		}
+		fmt.Fprintf(&sb, "        %s)\n", strings.Join(f.names(), "|"))
+		fmt.Fprintf(&sb, "            COMPREPLY=($(compgen -W %s -- \"$cur\"))\n            return\n            ;;\n", values)
+	}
+	if len(fileNames) > 0 {
+		fmt.Fprintf(&sb, "        %s)\n", strings.Join(fileNames, "|"))
+		sb.WriteString("            COMPREPLY=($(compgen -f -- \"$cur\"))\n            return\n            ;;\n")
+	}
+	sb.WriteString("    esac\n")
+	sb.WriteString("    if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(&sb, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(allNames, " "))
+	sb.WriteString("        return\n    fi\n")
+	sb.WriteString("    COMPREPLY=()\n")
+	if len(spec.Commands) > 0 {
+		sb.WriteString("    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+		fmt.Fprintf(&sb, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(spec.Commands, " "))
+		sb.WriteString("    fi\n")
+	}
+	sb.WriteString("    COMPREPLY+=($(compgen -d -- \"$cur\"))\n")
+	sb.WriteString("}\n")
+	fmt.Fprintf(&sb, "complete -o filenames -F %s %s\n", fn, spec.Program)
+	return sb.String()
+}
+
+// zshQuote quotes s in single quotes for zsh
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshDescription makes s fit in brackets of descriptions of options of _arguments of zsh
+var zshDescription = strings.NewReplacer("[", "(", "]", ")", `\`, `\\`)
+
+func zsh(spec Spec) string {
+	var sb strings.Builder
+	fn := function(spec.Program)
+	fmt.Fprintf(&sb, "#compdef %s\n", spec.Program)
+	fmt.Fprintf(&sb, "# zsh completion of %s, e.g. by: source <(%s completion zsh)\n", spec.Program, spec.Program)
+	fmt.Fprintf(&sb, "%s() {\n", fn)
+	sb.WriteString("    local state\n")
+	sb.WriteString("    _arguments -s \\\n")
+	for _, f := range spec.Flags {
+		// option is the specification of the option, after its names
+		option := "[" + zshDescription.Replace(f.Usage) + "]"
+		if f.TakesValue {
+			var action string
+			switch {
+			case f.ValuesCommand != "":
+				action = "($(" + f.ValuesCommand + " 2>/dev/null))"
+			case len(f.Values) > 0:
+				action = "(" + strings.Join(f.Values, " ") + ")"
+			default:
+				action = "_files"
+			}
+			option += ":" + f.Name + ":" + action
+		}
+		if f.Shorthand != "" {
+			fmt.Fprintf(&sb, "        '(-%s --%s)'{-%s,--%s}%s \\\n", f.Shorthand, f.Name, f.Shorthand, f.Name,
+				zshQuote(option))
+		} else {
+			fmt.Fprintf(&sb, "        %s \\\n", zshQuote("--"+f.Name+option))
+		}
+	}
+	sb.WriteString("        '1: :->first' \\\n")
+	sb.WriteString("        '*: :_directories'\n")
+	sb.WriteString("    if [[ $state == first ]]; then\n")
+	if len(spec.Commands) > 0 {
+		fmt.Fprintf(&sb, "        _alternative 'commands:command:(%s)' 'directories:directory:_directories'\n",
+			strings.Join(spec.Commands, " "))
+	} else {
+		sb.WriteString("        _directories\n")
+	}
+	sb.WriteString("    fi\n")
+	sb.WriteString("}\n")
+	fmt.Fprintf(&sb, "if [[ \"$funcstack[1]\" == %q ]]; then\n    %s \"$@\"\nelse\n    compdef %s %s\nfi\n",
+		fn, fn, fn, spec.Program)
+	return sb.String()
+}
+
+// fishQuote quotes s in single quotes for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func fish(spec Spec) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# fish completion of %s, e.g. by: %s completion fish | source\n", spec.Program, spec.Program)
+	fmt.Fprintf(&sb, "complete -c %s -f -a '(__fish_complete_directories)'\n", spec.Program)
+	if len(spec.Commands) > 0 {
+		fmt.Fprintf(&sb, "complete -c %s -f -n '__fish_use_subcommand' -a %s\n", spec.Program,
+			fishQuote(strings.Join(spec.Commands, " ")))
+	}
+	for _, f := range spec.Flags {
+		fmt.Fprintf(&sb, "complete -c %s -l %s", spec.Program, f.Name)
+		if f.Shorthand != "" {
+			fmt.Fprintf(&sb, " -s %s", f.Shorthand)
+		}
+		if f.TakesValue {
+			switch {
+			case f.ValuesCommand != "":
+				fmt.Fprintf(&sb, " -x -a %s", fishQuote("("+f.ValuesCommand+" 2>/dev/null)"))
+			case len(f.Values) > 0:
+				fmt.Fprintf(&sb, " -x -a %s", fishQuote(strings.Join(f.Values, " ")))
+			default:
+				sb.WriteString(" -r -F")
+			}
+		}
+		fmt.Fprintf(&sb, " -d %s\n", fishQuote(f.Usage))
+	}
+	return sb.String()
+}
+
+// powershellQuote quotes s in single quotes for PowerShell
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// powershellList returns a list of values of PowerShell
+func powershellList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, powershellQuote(v))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func powershell(spec Spec) string {
+	var sb strings.Builder
+	var allNames []string
+	fmt.Fprintf(&sb, "# PowerShell completion of %s, e.g. by: %s completion powershell | Out-String | Invoke-Expression\n",
+		spec.Program, spec.Program)
+	fmt.Fprintf(&sb, "Register-ArgumentCompleter -Native -CommandName %s -ScriptBlock {\n",
+		powershellQuote(spec.Program))
+	sb.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	sb.WriteString("    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })\n")
+	sb.WriteString("    $prev = if ($wordToComplete) { $words[-2] } else { $words[-1] }\n")
+	sb.WriteString("    $values = switch -CaseSensitive ($prev) {\n")
+	for _, f := range spec.Flags {
+		allNames = append(allNames, f.names()...)
+		if !f.TakesValue {
+			continue
+		}
+		fmt.Fprintf(&sb, "        { $_ -cin %s } { ", powershellList(f.names()))
+		switch {
+		case f.ValuesCommand != "":
+			fmt.Fprintf(&sb, "& %s 2>$null; break }\n", f.ValuesCommand)
+		case len(f.Values) > 0:
+			fmt.Fprintf(&sb, "%s; break }\n", powershellList(f.Values))
+		default:
+			// Completing nothing makes PowerShell complete files
+			sb.WriteString("return }\n")
+		}
+	}
+	sb.WriteString("        default {\n")
+	sb.WriteString("            if ($wordToComplete -like '-*') {\n")
+	fmt.Fprintf(&sb, "                %s\n", powershellList(allNames))
+	if len(spec.Commands) > 0 {
+		sb.WriteString("            } elseif ($words.Count -le 2) {\n")
+		fmt.Fprintf(&sb, "                %s\n", powershellList(spec.Commands))
+	}
+	sb.WriteString("            }\n")
+	sb.WriteString("        }\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("    $values | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	sb.WriteString("        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("}\n")
+	return sb.String()
+}
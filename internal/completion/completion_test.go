@@ -0,0 +1,122 @@
+package completion
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSpec() Spec {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringP("output", "o", "text", "following modes are accepted:\n  csv = …")
+	fs.String("profile", "", "profile of the configuration file to apply")
+	fs.Uint64P("minsize", "m", 4, "minimum size of file in KiB to consider")
+	fs.Bool("respect-gitignore", false, "skip files ignored by [.gitignore] files, of 'Git' repositories")
+	fs.String("web", "", "serve a web interface")
+	fs.Lookup("web").NoOptDefVal = "localhost:0"
+	fs.String("secret", "", "")
+	_ = fs.MarkHidden("secret")
+	flags := FromFlagSet(fs)
+	for i, f := range flags {
+		switch f.Name {
+		case "output":
+			flags[i].Values = []string{"csv", "json", "text"}
+		case "profile":
+			flags[i].ValuesCommand = "echo code photos"
+		}
+	}
+	return Spec{Program: "go-find-duplicates", Commands: []string{"bench", "serve"}, Flags: flags}
+}
+
+func TestFromFlagSet(t *testing.T) {
+	flags := testSpec().Flags
+	assert.Equal(t, []Flag{
+		{Name: "minsize", Shorthand: "m", Usage: "minimum size of file in KiB to consider", TakesValue: true},
+		{Name: "output", Shorthand: "o", Usage: "following modes are accepted:", TakesValue: true,
+			Values: []string{"csv", "json", "text"}},
+		{Name: "profile", Usage: "profile of the configuration file to apply", TakesValue: true,
+			ValuesCommand: "echo code photos"},
+		{Name: "respect-gitignore", Usage: "skip files ignored by [.gitignore] files, of 'Git' repositories"},
+		{Name: "web", Usage: "serve a web interface"},
+	}, flags)
+}
+
+func TestBash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash isn't installed")
+	}
+	dir := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "photos"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644))
+	script := filepath.Join(dir, "completion.bash")
+	f, err := os.Create(script)
+	assert.Nil(t, err)
+	assert.Nil(t, Write(f, "bash", testSpec()))
+	assert.Nil(t, f.Close())
+	complete := func(words ...string) []string {
+		cmd := exec.Command(bash, "-c", `source "$0"; COMP_WORDS=("$@"); COMP_CWORD=$(($# - 1)); `+
+			`_go_find_duplicates; printf '%s\n' "${COMPREPLY[@]}"`, script, "go-find-duplicates")
+		cmd.Args = append(cmd.Args, words...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		assert.Nil(t, err, words)
+		return strings.Fields(string(out))
+	}
+	assert.Equal(t, []string{"--minsize"}, complete("--mi"))
+	assert.Equal(t, []string{"--output"}, complete("--ou"))
+	assert.Equal(t, []string{"csv"}, complete("--output", "c"))
+	assert.Equal(t, []string{"json"}, complete("-o", "j"))
+	assert.Equal(t, []string{"photos"}, complete("--profile", "p"))
+	assert.Equal(t, []string{"notes.txt"}, complete("--minsize", "n"))
+	assert.Equal(t, []string{"bench"}, complete("b"))
+	assert.Equal(t, []string{"serve"}, complete("s"))
+	assert.Equal(t, []string{"photos"}, complete("p"))
+	assert.Empty(t, complete("photos", "s"))
+	assert.Equal(t, []string{"--web"}, complete("--w"))
+	assert.Empty(t, complete("--secret"))
+}
+
+func TestWrite(t *testing.T) {
+	var sb strings.Builder
+	assert.Nil(t, Write(&sb, "zsh", testSpec()))
+	zsh := sb.String()
+	assert.Contains(t, zsh, "#compdef go-find-duplicates\n")
+	assert.Contains(t, zsh, `'(-o --output)'{-o,--output}'[following modes are accepted:]:output:(csv json text)'`)
+	assert.Contains(t, zsh, `'--profile[profile of the configuration file to apply]`+
+		`:profile:($(echo code photos 2>/dev/null))'`)
+	assert.Contains(t, zsh, `'(-m --minsize)'{-m,--minsize}'[minimum size of file in KiB to consider]:minsize:_files'`)
+	assert.Contains(t, zsh, `'--respect-gitignore[skip files ignored by (.gitignore) files, of '\''Git'\''`+
+		` repositories]'`)
+	assert.Contains(t, zsh, "_alternative 'commands:command:(bench serve)' 'directories:directory:_directories'")
+	assert.Contains(t, zsh, "compdef _go_find_duplicates go-find-duplicates\n")
+
+	sb.Reset()
+	assert.Nil(t, Write(&sb, "fish", testSpec()))
+	fish := sb.String()
+	assert.Contains(t, fish, "complete -c go-find-duplicates -f -n '__fish_use_subcommand' -a 'bench serve'\n")
+	assert.Contains(t, fish, "complete -c go-find-duplicates -l output -s o -x -a 'csv json text' "+
+		"-d 'following modes are accepted:'\n")
+	assert.Contains(t, fish, "complete -c go-find-duplicates -l profile -x -a '(echo code photos 2>/dev/null)'")
+	assert.Contains(t, fish, "complete -c go-find-duplicates -l minsize -s m -r -F")
+	assert.Contains(t, fish,
+		`-l respect-gitignore -d 'skip files ignored by [.gitignore] files, of \'Git\' repositories'`)
+
+	sb.Reset()
+	assert.Nil(t, Write(&sb, "powershell", testSpec()))
+	powershell := sb.String()
+	assert.Contains(t, powershell, "Register-ArgumentCompleter -Native -CommandName 'go-find-duplicates'")
+	assert.Contains(t, powershell, "{ $_ -cin '--output', '-o' } { 'csv', 'json', 'text'; break }")
+	assert.Contains(t, powershell, "{ $_ -cin '--profile' } { & echo code photos 2>$null; break }")
+	assert.Contains(t, powershell, "{ $_ -cin '--minsize', '-m' } { return }")
+	assert.Contains(t, powershell,
+		"'--minsize', '-m', '--output', '-o', '--profile', '--respect-gitignore', '--web'")
+	assert.Contains(t, powershell, "'bench', 'serve'")
+
+	assert.ErrorContains(t, Write(&sb, "tcsh", testSpec()), `unsupported shell "tcsh"`)
+}
@@ -0,0 +1,181 @@
+// Package config reads configuration files of defaults of flags, along with named profiles of them (e.g. one for
+// photos and another for code), such as:
+//
+//	minsize: 16
+//	exclusions: /etc/go-find-duplicates/exclusions.txt
+//	profiles:
+//	  photos:
+//	    minsize: 1024
+//	    keep: oldest
+//	  code:
+//	    respect-gitignore: true
+//
+// Keys are names of flags, and values are what they'd be set to on the command line, with a list for a flag that
+// can be repeated.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// profilesKey is the key of named profiles in a configuration file
+const profilesKey = "profiles"
+
+// Config is a configuration of defaults of flags, and of named profiles that override them
+type Config struct {
+	// Defaults are values of flags, by their names
+	Defaults map[string]any
+	// Profiles are values of flags of profiles, by names of profiles and of flags
+	Profiles map[string]map[string]any
+}
+
+// DefaultPath returns where the configuration file is by default: config.yaml in directory go-find-duplicates of
+// $XDG_CONFIG_HOME, or of ~/.config, if that's not set
+func DefaultPath() (string, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "go-find-duplicates", "config.yaml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "go-find-duplicates", "config.yaml"), nil
+}
+
+// Read reads a configuration in YAML
+func Read(r io.Reader) (*Config, error) {
+	var values map[string]any
+	if err := yaml.NewDecoder(r).Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	c := &Config{Defaults: values, Profiles: map[string]map[string]any{}}
+	profiles, exists := values[profilesKey]
+	if !exists {
+		return c, nil
+	}
+	delete(values, profilesKey)
+	byName, ok := profiles.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid configuration: %s must be a map of profiles by their names", profilesKey)
+	}
+	for name, profile := range byName {
+		if profile == nil {
+			c.Profiles[name] = map[string]any{}
+			continue
+		}
+		values, ok := profile.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid configuration: profile %q must be a map of flags", name)
+		}
+		c.Profiles[name] = values
+	}
+	return c, nil
+}
+
+// Load reads a configuration from a file
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// ProfileNames returns names of profiles of the configuration, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply sets flags of fs to values of the configuration, except those set on the command line already. Values of
+// the profile, unless that's empty, override defaults of the configuration. Flags in reserved can't be set.
+func (c *Config) Apply(fs *flag.FlagSet, profile string, reserved ...string) error {
+	values := make(map[string]any, len(c.Defaults))
+	for name, value := range c.Defaults {
+		values[name] = value
+	}
+	if profile != "" {
+		profileValues, exists := c.Profiles[profile]
+		if !exists {
+			return fmt.Errorf("no profile %q in configuration (profiles are: %s)", profile,
+				strings.Join(c.ProfileNames(), ", "))
+		}
+		for name, value := range profileValues {
+			values[name] = value
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || slices.Contains(reserved, name) {
+			return fmt.Errorf("unknown flag %q in configuration", name)
+		}
+		if f.Changed {
+			continue
+		}
+		args, err := toArgs(values[name])
+		if err != nil {
+			return fmt.Errorf("invalid value of %q in configuration: %w", name, err)
+		}
+		for _, arg := range args {
+			if err := fs.Set(name, arg); err != nil {
+				return fmt.Errorf("invalid value of %q in configuration: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// toArgs converts a value of a flag to the arguments it would have on the command line
+func toArgs(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, errors.New("no value")
+	case []any:
+		args := make([]string, 0, len(v))
+		for _, item := range v {
+			arg, err := toArg(item)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	default:
+		arg, err := toArg(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{arg}, nil
+	}
+}
+
+func toArg(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
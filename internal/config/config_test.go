@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+minsize: 16
+output: csv
+notify-webhook:
+  - https://example.com/a
+  - https://example.com/b
+profiles:
+  photos:
+    minsize: 1024
+    keep: oldest
+  code:
+    respect-gitignore: true
+    output: json
+  empty:
+`
+
+// testFlags returns flags like those of go-find-duplicates, parsed from args
+func testFlags(t *testing.T, args ...string) (*flag.FlagSet, *uint64, *string, *string, *[]string, *bool) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	minSize := fs.Uint64P("minsize", "m", 4, "")
+	output := fs.StringP("output", "o", "text", "")
+	keep := fs.String("keep", "first", "")
+	webhooks := fs.StringSlice("notify-webhook", nil, "")
+	respectGitignore := fs.Bool("respect-gitignore", false, "")
+	fs.String("profile", "", "")
+	assert.Nil(t, fs.Parse(args))
+	return fs, minSize, output, keep, webhooks, respectGitignore
+}
+
+func TestApply(t *testing.T) {
+	c, err := Read(strings.NewReader(testConfig))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"code", "empty", "photos"}, c.ProfileNames())
+
+	fs, minSize, output, keep, webhooks, respectGitignore := testFlags(t)
+	assert.Nil(t, c.Apply(fs, ""))
+	assert.Equal(t, uint64(16), *minSize)
+	assert.Equal(t, "csv", *output)
+	assert.Equal(t, "first", *keep)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, *webhooks)
+	assert.False(t, *respectGitignore)
+
+	// Profiles override defaults of the file, and flags on the command line override both
+	fs, minSize, output, keep, _, _ = testFlags(t, "-m", "1", "--profile", "photos")
+	assert.Nil(t, c.Apply(fs, "photos"))
+	assert.Equal(t, uint64(1), *minSize)
+	assert.Equal(t, "csv", *output)
+	assert.Equal(t, "oldest", *keep)
+
+	fs, minSize, output, _, webhooks, respectGitignore = testFlags(t, "--notify-webhook", "https://example.com/c")
+	assert.Nil(t, c.Apply(fs, "code"))
+	assert.Equal(t, uint64(16), *minSize)
+	assert.Equal(t, "json", *output)
+	assert.Equal(t, []string{"https://example.com/c"}, *webhooks)
+	assert.True(t, *respectGitignore)
+
+	fs, _, output, _, _, _ = testFlags(t)
+	assert.Nil(t, c.Apply(fs, "empty"))
+	assert.Equal(t, "csv", *output)
+
+	fs, _, _, _, _, _ = testFlags(t)
+	assert.ErrorContains(t, c.Apply(fs, "music"), `no profile "music" in configuration (profiles are: code, empty, photos)`)
+}
+
+func TestApplyErrors(t *testing.T) {
+	for content, expectedErr := range map[string]string{
+		"unknown: 1\n":                   `unknown flag "unknown"`,
+		"profile: photos\n":              `unknown flag "profile"`,
+		"minsize: -1\n":                  `invalid value of "minsize"`,
+		"minsize:\n":                     `invalid value of "minsize" in configuration: no value`,
+		"output: {mode: csv}\n":          `invalid value of "output" in configuration: unsupported value`,
+		"profiles: {code: {unknown: 1}}": `unknown flag "unknown"`,
+	} {
+		c, err := Read(strings.NewReader(content))
+		assert.Nil(t, err, content)
+		fs, _, _, _, _, _ := testFlags(t)
+		profile := ""
+		if strings.HasPrefix(content, "profiles") {
+			profile = "code"
+		}
+		assert.ErrorContains(t, c.Apply(fs, profile, "profile"), expectedErr, content)
+	}
+	for content, expectedErr := range map[string]string{
+		"minsize: [1":             "invalid configuration",
+		"profiles: [photos]\n":    "profiles must be a map",
+		"profiles: {photos: 1}\n": `profile "photos" must be a map`,
+	} {
+		_, err := Read(strings.NewReader(content))
+		assert.ErrorContains(t, err, expectedErr, content)
+	}
+	c, err := Read(strings.NewReader(""))
+	assert.Nil(t, err)
+	fs, _, _, _, _, _ := testFlags(t)
+	assert.Nil(t, c.Apply(fs, ""))
+}
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	path, err := DefaultPath()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(home, "go-find-duplicates", "config.yaml"), path)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.Nil(t, os.WriteFile(path, []byte(testConfig), 0o644))
+	c, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, c.Defaults["minsize"])
+	_, err = Load(filepath.Join(home, "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestPresets(t *testing.T) {
+	assert.Equal(t, []string{"code", "music", "photos", "videos"}, PresetNames())
+	for _, name := range PresetNames() {
+		preset, err := PresetByName(name)
+		assert.Nil(t, err)
+		fs, minSize, _, keep, _, _ := testFlags(t, "--keep", "newest")
+		ext := fs.StringSlice("ext", nil, "")
+		fs.StringArrayP("exclusions", "x", nil, "")
+		assert.Nil(t, preset.Apply(fs, ""), name)
+		assert.Greater(t, *minSize, uint64(0), name)
+		assert.Equal(t, "newest", *keep, name)
+		if name != "code" {
+			assert.Contains(t, *ext, map[string]string{"photos": "jpg", "videos": "mp4", "music": "mp3"}[name])
+		}
+	}
+	_, err := PresetByName("books")
+	assert.ErrorContains(t, err, `unknown preset "books" (presets are: code, music, photos, videos)`)
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Presets are built-in configurations (without profiles) for common kinds of content, by their names. They're
+// applied like configuration files, after them, so that flags set on the command line or by configuration files
+// override those of presets.
+var Presets = map[string]*Config{
+	"photos": {Defaults: map[string]any{
+		"minsize": 16,
+		"ext": []any{"jpg", "jpeg", "png", "gif", "heic", "heif", "webp", "tif", "tiff", "bmp", "dng", "raw", "cr2",
+			"cr3", "nef", "arw", "orf", "rw2", "raf"},
+		"keep": "oldest",
+	}},
+	"videos": {Defaults: map[string]any{
+		"minsize": 1024,
+		"ext":     []any{"mp4", "m4v", "mov", "avi", "mkv", "wmv", "webm", "mpg", "mpeg", "3gp", "mts", "m2ts"},
+		"keep":    "oldest",
+	}},
+	"music": {Defaults: map[string]any{
+		"minsize": 256,
+		"ext":     []any{"mp3", "flac", "m4a", "aac", "ogg", "opus", "wav", "aiff", "aif", "wma", "alac", "ape"},
+		"keep":    "oldest",
+	}},
+	"code": {Defaults: map[string]any{
+		"minsize":           1,
+		"respect-gitignore": true,
+		"exclusions":        []any{"node_modules", "vendor", "target", "__pycache__", ".venv"},
+		"keep":              "shortest",
+	}},
+}
+
+// PresetNames returns names of Presets, sorted
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetByName returns the preset of the name
+func PresetByName(name string) (*Config, error) {
+	preset, exists := Presets[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown preset %q (presets are: %s)", name, strings.Join(PresetNames(), ", "))
+	}
+	return preset, nil
+}
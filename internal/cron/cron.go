@@ -0,0 +1,172 @@
+// Package cron parses schedules in the format of crontab, and finds when they're due
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch is how far ahead Next looks for a time that matches a schedule, beyond which it gives up (e.g. for
+// 30th of February)
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// field is a field of a schedule, with its range of values and names of its values (if any)
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun",
+		"jul", "aug", "sep", "oct", "nov", "dec"}}
+	// Sunday is both 0 and 7
+	dowField = field{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri",
+		"sat"}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule is a parsed schedule: a set of allowed values of each field, as bits
+type Schedule struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are whether days of month and of week are "*", since a day matches if it matches either of
+	// them when both are restricted
+	domAny, dowAny bool
+}
+
+// Parse parses expr, which is either five fields (minute, hour, day of month, month and day of week, as in crontab)
+// or one of macros @yearly, @monthly, @weekly, @daily and @hourly
+func Parse(expr string) (Schedule, error) {
+	s := Schedule{expr: expr}
+	spec := strings.TrimSpace(expr)
+	if macro, isMacro := macros[strings.ToLower(spec)]; isMacro {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("invalid schedule %q: expected 5 fields (minute, hour, day of month, month, day of "+
+			"week), found %d", expr, len(fields))
+	}
+	var err error
+	parsers := []struct {
+		f    field
+		bits *uint64
+	}{{minuteField, &s.minute}, {hourField, &s.hour}, {domField, &s.dom}, {monthField, &s.month}, {dowField, &s.dow}}
+	for i, p := range parsers {
+		if *p.bits, err = p.f.parse(fields[i]); err != nil {
+			return s, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny, s.dowAny = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// parse parses a field, which is a comma-separated list of values, ranges (a-b) or "*", each optionally with a step
+// (/n)
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q of %s", stepStr, f.name)
+			}
+		}
+		var lo, hi int
+		if rng == "*" {
+			lo, hi = f.min, f.max
+		} else {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loStr); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(hiStr); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "a/n" is from a onwards
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q of %s", rng, f.name)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q of %s (should be from %d to %d)", s, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression s was parsed from
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the earliest time after t (in its location, to the minute) that matches s, or zero time if there's
+// none in the next few years
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,61 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "x * * * *", "@every"} {
+		_, err := Parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+	s, err := Parse("0 3 * * 0")
+	assert.Nil(t, err)
+	assert.Equal(t, "0 3 * * 0", s.String())
+}
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, 1, 15, 10, 30, 45, 0, time.UTC)
+	for expr, expected := range map[string]time.Time{
+		"0 3 * * 0":         time.Date(2025, 1, 19, 3, 0, 0, 0, time.UTC),
+		"0 3 * * 7":         time.Date(2025, 1, 19, 3, 0, 0, 0, time.UTC),
+		"0 3 * * sun":       time.Date(2025, 1, 19, 3, 0, 0, 0, time.UTC),
+		"* * * * *":         time.Date(2025, 1, 15, 10, 31, 0, 0, time.UTC),
+		"*/15 * * * *":      time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC),
+		"5,50 9-17/2 * * *": time.Date(2025, 1, 15, 11, 5, 0, 0, time.UTC),
+		"30 10 * * *":       time.Date(2025, 1, 16, 10, 30, 0, 0, time.UTC),
+		"0 0 1 * *":         time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 feb *":      time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 12 1 * mon":      time.Date(2025, 1, 20, 12, 0, 0, 0, time.UTC),
+		"0 0 1 Jun-Aug *":   time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		"@weekly":           time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC),
+		"@hourly":           time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC),
+		"0 0 30 2 *":        {},
+		"45/5 10 15 1 wed":  time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC),
+		"59 23 31 12 *":     time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC),
+		"0 0 * * 1-5":       time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC),
+		"0 0 13 * 5":        time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC),
+	} {
+		s, err := Parse(expr)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, expected, s.Next(from), expr)
+	}
+}
+
+// TestNextDST checks whether times skipped or repeated when daylight saving time starts or ends are handled
+func TestNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database isn't available")
+	}
+	s, _ := Parse("30 2 * * *")
+	// 02:30 doesn't exist on 30th of March 2025
+	assert.Equal(t, time.Date(2025, 3, 31, 2, 30, 0, 0, loc), s.Next(time.Date(2025, 3, 30, 1, 0, 0, 0, loc)))
+	s, _ = Parse("0 3 * * *")
+	assert.Equal(t, time.Date(2025, 10, 26, 3, 0, 0, 0, loc), s.Next(time.Date(2025, 10, 26, 1, 0, 0, 0, loc)))
+}
@@ -0,0 +1,107 @@
+// Package gitrepo makes scans aware of Git repositories: it skips their internals, optionally leaves out files
+// that are ignored by them, and keeps checked-out copies of the same files in sibling clones from being reported
+// as duplicates.
+package gitrepo
+
+import (
+	"io/fs"
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/ignorefile"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// DirName is the name of the directory of internals of a Git repository, at the root of its working tree. In
+// linked worktrees and submodules, it's a file instead, that points to the actual directory.
+const DirName = ".git"
+
+// ignoreFileName is the name of files of patterns of files to be ignored, in any directory of a working tree
+const ignoreFileName = ".gitignore"
+
+// Policy decides how files of working trees of Git repositories are scanned
+type Policy struct {
+	fsys vfs.FS
+	// ScanInternals makes scans include internals of repositories, such as their object databases
+	ScanInternals bool
+	// RespectGitignore makes scans leave out files ignored by .gitignore files of their repositories
+	RespectGitignore bool
+
+	mx sync.Mutex
+	// roots maps directories to roots of working trees they're in, or to "" if they aren't in any
+	roots map[string]string
+	// gitignore has patterns of .gitignore files, and of .git/info/exclude files
+	gitignore *ignorefile.Tree
+}
+
+// NewPolicy creates a policy for repositories in fsys
+func NewPolicy(fsys vfs.FS, scanInternals, respectGitignore bool) *Policy {
+	return &Policy{
+		fsys:             fsys,
+		ScanInternals:    scanInternals,
+		RespectGitignore: respectGitignore,
+		roots:            map[string]string{},
+		gitignore:        ignorefile.NewTree(fsys, ignoreFileName),
+	}
+}
+
+// FileFilter is a service.FileFilter that skips internals of repositories (unless ScanInternals is set) and files
+// ignored by repositories (if RespectGitignore is set)
+func (p *Policy) FileFilter(name string, info fs.FileInfo) bool {
+	if info.Name() == DirName && !p.ScanInternals {
+		return false
+	}
+	if !p.RespectGitignore {
+		return true
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return !p.ignored(name, info.IsDir())
+}
+
+// GroupFilter is a service.GroupFilter that leaves out groups of duplicates that are all at the same path in
+// working trees of different repositories, since those are just copies checked out in sibling clones
+func (p *Policy) GroupFilter(group entity.DuplicateGroup) bool {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	var first string
+	for i, name := range group.Paths {
+		root := p.root(vfs.Dir(name))
+		if root == "" {
+			return true
+		}
+		rel := vfs.Rel(root, name)
+		if i == 0 {
+			first = rel
+		} else if rel != first {
+			return true
+		}
+	}
+	return false
+}
+
+// root returns the root of the working tree dir is in, or "" if it isn't in any
+func (p *Policy) root(dir string) string {
+	if root, exists := p.roots[dir]; exists {
+		return root
+	}
+	root := ""
+	if _, err := p.fsys.Lstat(vfs.Join(dir, DirName)); err == nil {
+		root = dir
+	} else if up := vfs.Dir(dir); up != dir {
+		root = p.root(up)
+	}
+	p.roots[dir] = root
+	return root
+}
+
+// ignored checks whether name is ignored by its repository
+func (p *Policy) ignored(name string, isDir bool) bool {
+	root := p.root(vfs.Dir(name))
+	if root == "" {
+		return false
+	}
+	// Patterns of .git/info/exclude have the lowest precedence
+	ignored := p.gitignore.Match(vfs.Join(vfs.Join(root, DirName), "info/exclude"), vfs.Rel(root, name), isDir, false)
+	return p.gitignore.Ignored(root, name, isDir, ignored)
+}
@@ -0,0 +1,89 @@
+package gitrepo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+var content = strings.Repeat("checked out ", 1_000)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, c := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		assert.Nil(t, os.WriteFile(name, []byte(c), 0o644))
+	}
+}
+
+// findDuplicates scans dir with policy, returning groups of duplicates as paths relative to dir
+func findDuplicates(t *testing.T, dir string, policy *Policy) [][]string {
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions([]string{dir},
+		service.WithFileSizeThreshold(1), service.WithLogger(fmte.Discard),
+		service.WithFileFilter(policy.FileFilter), service.WithGroupFilter(policy.GroupFilter)))
+	assert.Nil(t, err)
+	var groups [][]string
+	for _, paths := range result.Duplicates.All() {
+		var group []string
+		for _, p := range paths {
+			rel, _ := filepath.Rel(dir, p)
+			group = append(group, filepath.ToSlash(rel))
+		}
+		sort.Strings(group)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		// Two clones of the same repository, and a copy of one of its files outside of them
+		"clone1/.git/HEAD":         "ref: refs/heads/main\n" + content,
+		"clone1/.git/info/exclude": "*.tmp.md\n",
+		"clone1/.gitignore":        "build/\n*.log\n!keep.log\n",
+		"clone1/src/main.go":       content + "main",
+		"clone1/README.md":         content + "readme",
+		"clone1/build/main":        content + "binary",
+		"clone1/src/debug.log":     content + "log",
+		"clone1/src/keep.log":      content + "log",
+		"clone1/src/.gitignore":    "!debug.log\n",
+		"clone1/scratch.tmp.md":    content + "readme",
+		"clone2/.git/HEAD":         "ref: refs/heads/main\n" + content,
+		"clone2/src/main.go":       content + "main",
+		"clone2/README.md":         content + "readme",
+		"clone2/build/main":        content + "binary",
+		"backup/README.md":         content + "readme",
+		"backup/objects.pack":      content + "objects",
+		"clone1/.git/objects.pack": content + "objects",
+		"backup/old/build/main":    content + "binary",
+	})
+
+	assert.Equal(t, [][]string{
+		{"backup/README.md", "clone1/README.md", "clone1/scratch.tmp.md", "clone2/README.md"},
+		{"backup/old/build/main", "clone1/build/main", "clone2/build/main"},
+		{"clone1/src/debug.log", "clone1/src/keep.log"},
+	}, findDuplicates(t, dir, NewPolicy(vfs.Local, false, false)))
+
+	assert.Equal(t, [][]string{
+		{"backup/README.md", "clone1/README.md", "clone2/README.md"},
+		{"backup/old/build/main", "clone2/build/main"},
+		{"clone1/src/debug.log", "clone1/src/keep.log"},
+	}, findDuplicates(t, dir, NewPolicy(vfs.Local, false, true)))
+
+	assert.Equal(t, [][]string{
+		{"backup/README.md", "clone1/README.md", "clone1/scratch.tmp.md", "clone2/README.md"},
+		{"backup/objects.pack", "clone1/.git/objects.pack"},
+		{"backup/old/build/main", "clone1/build/main", "clone2/build/main"},
+		{"clone1/src/debug.log", "clone1/src/keep.log"},
+	}, findDuplicates(t, dir, NewPolicy(vfs.Local, true, false)))
+}
@@ -0,0 +1,232 @@
+// Package googleauth gets OAuth 2.0 access tokens for Google APIs from credentials found the way Google Cloud SDKs
+// find them (Application Default Credentials), without depending on those SDKs.
+//
+// See: https://cloud.google.com/docs/authentication/application-default-credentials
+package googleauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenURL is the endpoint that access tokens are got from
+const DefaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// TokenSource gets access tokens, which are sent in header "Authorization: Bearer <token>"
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// FromEnv creates a TokenSource for given scopes from (in order of preference):
+//  1. an access token in environment variable GOOGLE_OAUTH_ACCESS_TOKEN
+//  2. the credentials file named by environment variable GOOGLE_APPLICATION_CREDENTIALS
+//  3. the credentials file created by "gcloud auth application-default login"
+//
+// It returns nil (i.e. requests are to be anonymous) if there are no credentials.
+func FromEnv(client *http.Client, scopes ...string) (TokenSource, error) {
+	if token := getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return StaticToken(token), nil
+	}
+	path := getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		path = defaultCredentialsFile()
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read Google credentials: %w", err)
+	}
+	return FromJSON(data, client, scopes...)
+}
+
+// defaultCredentialsFile is where gcloud keeps application default credentials
+func defaultCredentialsFile() string {
+	if dir := getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Join(dir, "application_default_credentials.json")
+	}
+	if dir := getenv("APPDATA"); dir != "" {
+		return filepath.Join(dir, "gcloud", "application_default_credentials.json")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+}
+
+// StaticToken is a TokenSource of an access token that was got elsewhere (e.g. "gcloud auth print-access-token")
+type StaticToken string
+
+// Token returns the access token
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+type credentialsFile struct {
+	Type string `json:"type"`
+	// Fields of service accounts
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	// Fields of users
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// FromJSON creates a TokenSource for given scopes from a credentials file of type "service_account" (a key of a
+// service account) or "authorized_user" (as created by gcloud). client is used to get tokens.
+func FromJSON(data []byte, client *http.Client, scopes ...string) (TokenSource, error) {
+	var f credentialsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("couldn't parse Google credentials: %w", err)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	tokenURL := f.TokenURI
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	switch f.Type {
+	case "service_account":
+		key, err := parsePrivateKey(f.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return &refreshingToken{fetch: func(ctx context.Context) (tokenResponse, error) {
+			assertion, err := signJWT(key, f.PrivateKeyID, f.ClientEmail, tokenURL, strings.Join(scopes, " "),
+				time.Now())
+			if err != nil {
+				return tokenResponse{}, err
+			}
+			return fetchToken(ctx, client, tokenURL, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+		}}, nil
+	case "authorized_user":
+		return &refreshingToken{fetch: func(ctx context.Context) (tokenResponse, error) {
+			return fetchToken(ctx, client, tokenURL, url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {f.ClientID},
+				"client_secret": {f.ClientSecret},
+				"refresh_token": {f.RefreshToken},
+			})
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type of Google credentials %q", f.Type)
+	}
+}
+
+func parsePrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, errors.New("private key of service account isn't in PEM format")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("couldn't parse private key of service account: %w", err)
+		}
+	}
+	rsaKey, isRSA := key.(*rsa.PrivateKey)
+	if !isRSA {
+		return nil, errors.New("private key of service account isn't an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// signJWT creates the assertion by which a service account asks for an access token
+//
+// See: https://developers.google.com/identity/protocols/oauth2/service-account#authorizingrequests
+func signJWT(key *rsa.PrivateKey, keyID, email, audience, scope string, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("couldn't sign token request: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func fetchToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (tokenResponse, error) {
+	var tr tokenResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tr, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return tr, fmt.Errorf("couldn't get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&tr)
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return tr, fmt.Errorf("couldn't get access token: %s %s %s", resp.Status, tr.Error, tr.ErrorDescription)
+	}
+	return tr, nil
+}
+
+// refreshingToken is a TokenSource that gets a new access token shortly before the current one expires
+type refreshingToken struct {
+	fetch   func(ctx context.Context) (tokenResponse, error)
+	mx      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (r *refreshingToken) Token(ctx context.Context) (string, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.token != "" && time.Now().Before(r.expires) {
+		return r.token, nil
+	}
+	tr, err := r.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+	r.token, r.expires = tr.AccessToken, time.Now().Add(lifetime-time.Minute)
+	return r.token, nil
+}
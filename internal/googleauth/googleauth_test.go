@@ -0,0 +1,94 @@
+package googleauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		assert.Len(t, parts, 3)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		assert.Nil(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		assert.Contains(t, string(claims), `"scope":"a b"`)
+		_, _ = w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+	}))
+	defer server.Close()
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "sa@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL,
+	})
+	ts, err := FromJSON(credentials, server.Client(), "a", "b")
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		token, tErr := ts.Token(context.Background())
+		assert.Nil(t, tErr)
+		assert.Equal(t, "tok", token)
+	}
+	assert.Equal(t, 1, requests, "token should be reused until it expires")
+}
+
+func TestAuthorizedUser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"user-token","expires_in":3600}`))
+	}))
+	defer server.Close()
+	ts, err := FromJSON([]byte(`{"type":"authorized_user","client_id":"c","client_secret":"s",
+		"refresh_token":"refresh","token_uri":"`+server.URL+`"}`), server.Client())
+	assert.Nil(t, err)
+	token, err := ts.Token(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "user-token", token)
+
+	ts, _ = FromJSON([]byte(`{"type":"authorized_user","refresh_token":"revoked","token_uri":"`+server.URL+`"}`),
+		server.Client())
+	_, err = ts.Token(context.Background())
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	_, err = FromJSON([]byte(`{"type":"external_account"}`), nil)
+	assert.NotNil(t, err)
+}
+
+func TestFromEnv(t *testing.T) {
+	defer func(old func(string) string) { getenv = old }(getenv)
+	env := map[string]string{"GOOGLE_OAUTH_ACCESS_TOKEN": "static", "CLOUDSDK_CONFIG": t.TempDir()}
+	getenv = func(name string) string { return env[name] }
+	ts, err := FromEnv(nil)
+	assert.Nil(t, err)
+	token, _ := ts.Token(context.Background())
+	assert.Equal(t, "static", token)
+
+	delete(env, "GOOGLE_OAUTH_ACCESS_TOKEN")
+	ts, err = FromEnv(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ts, "no credentials should mean anonymous requests")
+}
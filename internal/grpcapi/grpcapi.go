@@ -0,0 +1,219 @@
+// Package grpcapi serves the FindDuplicates gRPC service (see api/finddup/v1), through which scans are run and
+// acted upon programmatically
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	finddupv1 "github.com/m-manu/go-find-duplicates/api/finddup/v1"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/scans"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NewServer creates a gRPC server of the FindDuplicates service, which runs scans through m. If apiKey isn't empty,
+// calls must carry it as a bearer token in their "authorization" metadata.
+func NewServer(m *scans.Manager, apiKey string) *grpc.Server {
+	var opts []grpc.ServerOption
+	if apiKey != "" {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo,
+				handler grpc.UnaryHandler) (any, error) {
+				if err := authenticate(ctx, apiKey); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo,
+				handler grpc.StreamHandler) error {
+				if err := authenticate(ss.Context(), apiKey); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	s := grpc.NewServer(opts...)
+	finddupv1.RegisterFindDuplicatesServer(s, &server{scans: m})
+	return s
+}
+
+func authenticate(ctx context.Context, apiKey string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, isBearer := strings.CutPrefix(value, "Bearer ")
+		if isBearer && subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid API key")
+}
+
+type server struct {
+	finddupv1.UnimplementedFindDuplicatesServer
+	scans *scans.Manager
+}
+
+func (s *server) Scan(req *finddupv1.ScanRequest, stream grpc.ServerStreamingServer[finddupv1.ScanEvent]) error {
+	scan, err := s.scans.StartRequest(scans.Request{
+		Directories: req.GetDirectories(),
+		Hash:        req.GetHash(),
+		Verify:      req.GetVerify(),
+		MinSize:     req.MinSize,
+		Exclusions:  req.GetExclusions(),
+		Parallelism: int(req.GetParallelism()),
+	})
+	if errors.Is(err, scans.ErrNotAllowed) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	} else if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = stream.Send(&finddupv1.ScanEvent{Event: &finddupv1.ScanEvent_Started{
+		Started: &finddupv1.ScanStarted{ScanId: scan.ID}}})
+	if err != nil {
+		return err
+	}
+	for from := 0; ; {
+		groups, more := scan.Groups(from)
+		for _, group := range groups {
+			err = stream.Send(&finddupv1.ScanEvent{Event: &finddupv1.ScanEvent_Group{Group: toProtoGroup(group)}})
+			if err != nil {
+				return err
+			}
+		}
+		from += len(groups)
+		if more == nil {
+			break
+		}
+		select {
+		case <-more:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+	return stream.Send(&finddupv1.ScanEvent{Event: &finddupv1.ScanEvent_Finished{Finished: toProtoProgress(scan)}})
+}
+
+func (s *server) GetProgress(_ context.Context, req *finddupv1.GetProgressRequest) (*finddupv1.Progress, error) {
+	scan, err := s.scans.Get(req.GetScanId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProtoProgress(scan), nil
+}
+
+func (s *server) GetReport(_ context.Context, req *finddupv1.GetReportRequest) (*finddupv1.Report, error) {
+	scan, err := s.scans.Get(req.GetScanId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	result, err := scan.Result()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	report := &finddupv1.Report{Progress: toProtoProgress(scan)}
+	if result.Duplicates != nil {
+		for digest, paths := range result.Duplicates.All() {
+			sortedPaths := append([]string(nil), paths...)
+			sort.Strings(sortedPaths)
+			report.Groups = append(report.Groups, toProtoGroup(entity.DuplicateGroup{Digest: digest,
+				Paths: sortedPaths}))
+		}
+	}
+	return report, nil
+}
+
+func (s *server) Act(_ context.Context, req *finddupv1.ActRequest) (*finddupv1.ActResponse, error) {
+	action, err := actions.ActionByName(strings.ToLower(req.GetAction()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var keep actions.KeepPolicy = actions.KeepFirst
+	if req.GetKeep() != "" {
+		if keep, err = actions.KeepPolicyByName(strings.ToLower(req.GetKeep())); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	scan, err := s.scans.Get(req.GetScanId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	report, err := scan.Act(actions.Options{Keep: keep, Action: action, DryRun: req.GetDryRun()})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &finddupv1.ActResponse{DryRun: report.DryRun, Succeeded: int32(report.Succeeded),
+		Failed: int32(report.Failed), ReclaimedSize: report.ReclaimedSize}
+	for _, record := range report.Records {
+		r := &finddupv1.ActRecord{Path: record.Path, Kept: record.Kept, Size: record.Size}
+		if record.Err != nil {
+			r.Error = record.Err.Error()
+		}
+		resp.Records = append(resp.Records, r)
+	}
+	return resp, nil
+}
+
+func (s *server) DeleteScan(_ context.Context, req *finddupv1.DeleteScanRequest) (*finddupv1.DeleteScanResponse,
+	error) {
+	if err := s.scans.Delete(req.GetScanId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &finddupv1.DeleteScanResponse{}, nil
+}
+
+func toStatus(err error) error {
+	if errors.Is(err, scans.ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+func toProtoGroup(group entity.DuplicateGroup) *finddupv1.DuplicateGroup {
+	return &finddupv1.DuplicateGroup{
+		Extension:       group.Digest.FileExtension,
+		Hash:            group.Digest.FileHash,
+		Size:            group.Digest.FileSize,
+		StrongAlgorithm: group.Digest.StrongAlgorithm,
+		StrongHash:      group.Digest.StrongHash,
+		Paths:           group.Paths,
+	}
+}
+
+var protoStates = map[scans.State]finddupv1.Progress_State{
+	scans.Running:   finddupv1.Progress_STATE_RUNNING,
+	scans.Completed: finddupv1.Progress_STATE_COMPLETED,
+	scans.Failed:    finddupv1.Progress_STATE_FAILED,
+}
+
+func toProtoProgress(scan *scans.Scan) *finddupv1.Progress {
+	progress := scan.Progress()
+	p := &finddupv1.Progress{
+		ScanId:          scan.ID,
+		State:           protoStates[progress.State],
+		Directories:     scan.Directories,
+		StartedAt:       timestamppb.New(scan.StartedAt),
+		FilesDiscovered: progress.FilesDiscovered,
+		FilesHashed:     progress.FilesHashed,
+		GroupsFound:     progress.GroupsFound,
+		Errors:          progress.Errors,
+		DuplicateCount:  progress.DuplicateCount,
+		SavingsSize:     progress.SavingsSize,
+	}
+	if !progress.FinishedAt.IsZero() {
+		p.FinishedAt = timestamppb.New(progress.FinishedAt)
+	}
+	if progress.Err != nil {
+		p.Error = progress.Err.Error()
+	}
+	return p
+}
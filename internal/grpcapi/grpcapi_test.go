@@ -0,0 +1,110 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	finddupv1 "github.com/m-manu/go-find-duplicates/api/finddup/v1"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/scans"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, apiKey string) finddupv1.FindDuplicatesClient {
+	m := scans.NewManager(vfs.NewMux(vfs.Local), nil, scans.Limits{}, service.WithFileSizeThreshold(1))
+	t.Cleanup(m.Close)
+	server := NewServer(m, apiKey)
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return finddupv1.NewFindDuplicatesClient(conn)
+}
+
+// TestServer checks whether a scan is run, its groups streamed and reported, and its duplicates acted upon
+func TestServer(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "a.jpg"), content, 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "b.jpg"), content, 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "c.jpg"), []byte("unique"), 0o644))
+	fmte.Off()
+	client := newTestClient(t, "key")
+	_, err := client.GetProgress(context.Background(), &finddupv1.GetProgressRequest{ScanId: "missing"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer key")
+	_, err = client.GetProgress(ctx, &finddupv1.GetProgressRequest{ScanId: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err := client.Scan(ctx, &finddupv1.ScanRequest{Directories: []string{dir}, Verify: "sha256"})
+	assert.Nil(t, err)
+	var events []*finddupv1.ScanEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		events = append(events, event)
+	}
+	assert.Len(t, events, 3)
+	scanID := events[0].GetStarted().GetScanId()
+	assert.NotEmpty(t, scanID)
+	group := events[1].GetGroup()
+	assert.Equal(t, []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")}, group.GetPaths())
+	assert.Equal(t, "sha256", group.GetStrongAlgorithm())
+	assert.Equal(t, finddupv1.Progress_STATE_COMPLETED, events[2].GetFinished().GetState())
+
+	progress, err := client.GetProgress(ctx, &finddupv1.GetProgressRequest{ScanId: scanID})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), progress.GetFilesDiscovered())
+	assert.Equal(t, int64(1), progress.GetDuplicateCount())
+	report, err := client.GetReport(ctx, &finddupv1.GetReportRequest{ScanId: scanID})
+	assert.Nil(t, err)
+	assert.Len(t, report.GetGroups(), 1)
+
+	_, err = client.Act(ctx, &finddupv1.ActRequest{ScanId: scanID, Action: "shred"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	resp, err := client.Act(ctx, &finddupv1.ActRequest{ScanId: scanID, Action: "delete", Keep: "first"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), resp.GetSucceeded())
+	assert.Equal(t, filepath.Join(dir, "b.jpg"), resp.GetRecords()[0].GetPath())
+	assert.NoFileExists(t, filepath.Join(dir, "b.jpg"))
+
+	stream, err = client.Scan(ctx, &finddupv1.ScanRequest{Directories: []string{filepath.Join(dir, "missing")}})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	stream, err = client.Scan(ctx, &finddupv1.ScanRequest{Directories: []string{dir}, Verify: "sampled"})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DeleteScan(ctx, &finddupv1.DeleteScanRequest{ScanId: scanID})
+	assert.Nil(t, err)
+	_, err = client.GetProgress(ctx, &finddupv1.GetProgressRequest{ScanId: scanID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.DeleteScan(ctx, &finddupv1.DeleteScanRequest{ScanId: scanID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,179 @@
+package i18n
+
+// chinese are translations of messages to Simplified Chinese, by their formats in English
+var chinese = map[string]string{
+	// Help
+	"go-find-duplicates is a tool to find duplicate files and directories\n": "go-find-duplicates 是一个查找重复文件和目录的工具\n",
+	`where,
+  arguments of scan are readable directories that need to be scanned for duplicates
+  (these may also be URLs of remote storage, such as s3://bucket/prefix)
+  (report, remove and link report duplicates of a scan saved by --manifest again, delete them and replace them
+  with links, respectively, without scanning again)
+  (apply deletes duplicates of a report of -o json, or replaces them with links, verifying their hashes first)
+  (diff compares two scans saved by --manifest)
+  (merge reports duplicates across hosts of digests exported on each by --export-digests)
+  (cache maintains a file of hashes of --cache)
+  (serve serves an API through which scans are run programmatically)
+  (bench measures how fast a directory can be scanned and recommends flags for it)
+  (layers finds files duplicated across layers of container images)
+  (bursts finds bursts of photos taken within moments of each other that look alike, to be reviewed together)
+  (music finds copies of the same recordings across formats and bitrates, marking the best of them)
+  (completion generates a script of completion of arguments for a shell)
+  (config show prints settings of scans with flags given, as resolved from defaults, the configuration file
+  and the command line)
+  (self-update replaces this binary with that of the latest release)
+  (wizard asks what to scan and what to do with duplicates, then prints and runs the equivalent scan)
+  (run "go-find-duplicates <subcommand> --help" for flags of subcommands, and "scan" explicitly to scan
+  a directory named like a subcommand)
+`: `其中，
+  scan 的参数是要查找重复文件的可读目录
+  （也可以是远程存储的 URL，例如 s3://bucket/prefix）
+  （report、remove 和 link 分别重新报告、删除由 --manifest 保存的扫描中的重复文件，或将其替换为链接，
+  无需重新扫描）
+  （apply 删除 -o json 报告中的重复文件或将其替换为链接，操作前先校验它们的哈希）
+  （diff 比较由 --manifest 保存的两次扫描）
+  （merge 根据各主机由 --export-digests 导出的摘要，报告跨主机的重复文件）
+  （cache 维护 --cache 的哈希文件）
+  （serve 提供以编程方式运行扫描的 API）
+  （bench 测量扫描一个目录的速度，并推荐适合它的参数）
+  （layers 查找在容器镜像各层之间重复的文件）
+  （bursts 查找相隔片刻拍摄且看起来相似的连拍照片，以便一起查看）
+  （music 查找同一录音在不同格式和码率下的副本，并标出其中质量最好的一份）
+  （completion 生成 shell 的参数补全脚本）
+  （config show 打印给定参数的扫描设置，即由默认值、配置文件和命令行共同决定的设置）
+  （self-update 将此程序替换为最新发布的版本）
+  （wizard 询问要扫描什么以及如何处理重复文件，然后打印并运行相应的扫描命令）
+  （运行 "go-find-duplicates <子命令> --help" 查看子命令的参数；要扫描与子命令同名的目录，
+  请明确使用 "scan"）
+`,
+	"\nFlags of scan (all optional):\n":                                  "\n扫描的参数（均为可选）：\n",
+	"\nFor more details: https://github.com/m-manu/go-find-duplicates\n": "\n更多详情：https://github.com/m-manu/go-find-duplicates\n",
+
+	// Progress of scans
+	"Scanning %d directories...\n":                                      "正在扫描 %d 个目录……\n",
+	"Done. Found %d files of total size %s.\n":                          "完成。共找到 %d 个文件，总大小为 %s。\n",
+	"Skipping %s, which is in %s, scanned anyway\n":                     "跳过 %s，它位于 %s 中，该目录已在扫描范围内\n",
+	"Skipping %s, which is %s, scanned anyway\n":                        "跳过 %s，它就是 %s，该目录已在扫描范围内\n",
+	"Skipped %d links and %d FIFOs, sockets and devices.\n":             "跳过了 %d 个链接，以及 %d 个 FIFO、套接字和设备文件。\n",
+	"Finding potential duplicates... \n":                                "正在查找可能重复的文件……\n",
+	"Completed. Found %d files that may have one or more duplicates!\n": "完成。找到 %d 个可能存在重复的文件！\n",
+	"Finding them in %d shards of files by their sizes...\n":            "按文件大小分为 %d 个分片查找……\n",
+	"Scanning for duplicates (using %s hash)... \n":                     "正在查找重复文件（使用 %s 哈希）……\n",
+	"%2.0f%% processed so far\n":                                        "已处理 %2.0f%%\n",
+	"%2.0f%% processed so far, about %s left\n":                         "已处理 %2.0f%%，大约还需 %s\n",
+	"%d files found so far...\n":                                        "目前已找到 %d 个文件……\n",
+	"Reading %s (on %s storage) with %d workers\n":                      "读取 %s（%s 存储），使用 %d 个工作线程\n",
+	"Scan cancelled.\n":                                                 "扫描已取消。\n",
+	"Scan completed.\n":                                                 "扫描完成。\n",
+	"Next scan at %s\n":                                                 "下次扫描时间：%s\n",
+
+	// Summaries of scans, and of actions on their duplicates
+	"Found %d duplicates. A total of %s can be saved by removing them.\n": "找到 %d 个重复文件。删除它们共可节省 %s。\n",
+	"No duplicates found!\n":                                     "未找到重复文件！\n",
+	"No actions performed!\n":                                    "未执行任何操作！\n",
+	"View duplicates report here: %s\n":                          "重复文件报告：%s\n",
+	"Manifest of the scan saved here: %s\n":                      "扫描清单已保存到：%s\n",
+	"Checksums of %d files saved here: %s\n":                     "%d 个文件的校验和已保存到：%s\n",
+	"Profile (%s) saved here: %s\n":                              "性能分析（%s）已保存到：%s\n",
+	"Applied %s on %d duplicates (%s), %d failed, %d skipped.\n": "已执行 %s：%d 个重复文件（%s），%d 个失败，%d 个跳过。\n",
+	"Would apply %s on %d duplicates (%s).\n":                    "将执行 %s：%d 个重复文件（%s）。\n",
+	"would %s\n":                                                                "将会 %s\n",
+	"Planned actions saved here: %s\n":                                          "计划的操作已保存到：%s\n",
+	"Found %d files (%s) that exist %s too.\n":                                  "找到 %d 个文件（%s）同样存在于 %s。\n",
+	"View report of files that exist %s here: %s\n":                             "同样存在于 %s 的文件报告：%s\n",
+	"View report of files in backups here: %s\n":                                "备份中的文件报告：%s\n",
+	"Skipped %d files that were deleted during the scan.\n":                     "跳过了 %d 个在扫描期间被删除的文件。\n",
+	"Found %d files that changed during the scan, left out of groups.\n":        "找到 %d 个在扫描期间被修改的文件，未将其分组。\n",
+	"View report of files that changed during the scan here: %s\n":              "扫描期间被修改的文件报告：%s\n",
+	"This is the latest version (%s).\n":                                        "当前已是最新版本（%s）。\n",
+	"Version %s is available (this is %s).\n":                                   "有新版本 %s 可用（当前为 %s）。\n",
+	"Updated %s from version %s to %s.\n":                                       "已将 %s 从版本 %s 更新到 %s。\n",
+	"skipping %s, which changed since the scan\n":                               "跳过 %s，它在扫描后已被修改\n",
+	"skipping \"%s\", which changed during the scan\n":                          "跳过 \"%s\"，它在扫描期间被修改\n",
+	"error while reporting to file: %+v\n":                                      "写入报告文件时出错：%+v\n",
+	"error while finding duplicates: %+v\n":                                     "查找重复文件时出错：%+v\n",
+	"error: couldn't create report file: %+v\n":                                 "错误：无法创建报告文件：%+v\n",
+	"error: exactly one manifest should be passed\n":                            "错误：必须且只能传入一个清单\n",
+	"Run \"go-find-duplicates --help\" for usage\n":                             "运行 \"go-find-duplicates --help\" 查看用法\n",
+	"Run \"go-find-duplicates %s --help\" for usage\n":                          "运行 \"go-find-duplicates %s --help\" 查看用法\n",
+	"Found %d files (%s) that are fully contained in %s, and %d that aren't.\n": "找到 %d 个文件（%s）完整地包含在 %s 中，另有 %d 个不在其中。\n",
+	"Walked %d files in %v (%.0f files/s).\n":                                   "遍历了 %d 个文件，用时 %v（每秒 %.0f 个文件）。\n",
+	"Hashed %d files (%s) in %v (%s/s).\n":                                      "计算了 %d 个文件（%s）的哈希，用时 %v（每秒 %s）。\n",
+	"Grouped files in %v, and reported in %v.\n":                                "分组用时 %v，报告用时 %v。\n",
+	"Found %d hashes in the cache, and missed %d (%.0f%% hit rate).\n":          "在缓存中找到 %d 个哈希，未命中 %d 个（命中率 %.0f%%）。\n",
+	"Verifying %d groups of duplicates of the report (using %s hash)...\n":      "正在校验报告中的 %d 组重复文件（使用 %s 哈希）……\n",
+	"skipping %s, which changed since the report: %v\n":                         "跳过 %s，它在报告后已被修改：%v\n",
+	"error: exactly one report should be passed\n":                              "错误：必须且只能传入一个报告\n",
+	"error: one of --remove and --link should be passed\n":                      "错误：必须传入 --remove 或 --link 之一\n",
+	"error: only one of --remove and --link should be passed\n":                 "错误：--remove 和 --link 只能传入其中之一\n",
+	"error: couldn't load report: %+v\n":                                        "错误：无法加载报告：%+v\n",
+	"skipping %s: %v\n":                                                         "跳过 %s：%v\n",
+
+	// Scans that are interrupted
+	"scan interrupted: reporting duplicates found so far, in a partial report\n":       "扫描被中断：在部分报告中报告目前已找到的重复文件\n",
+	"not applying %s on duplicates, since the scan was interrupted\n":                  "扫描被中断，因此不对重复文件执行 %s\n",
+	"Hashes computed so far are cached, so running the scan again resumes it.\n":       "目前已计算的哈希已被缓存，再次运行扫描即可继续。\n",
+	"error while saving checkpoint of the scan: %+v\n":                                 "保存扫描检查点时出错：%+v\n",
+	"Checkpoint of the scan saved here, which resumes it when passed as --cache: %s\n": "扫描检查点已保存于此（作为 --cache 传入即可继续扫描）：%s\n",
+
+	// Bursts of photos
+	"Reading photos of %d directories...\n":                                     "正在读取 %d 个目录中的照片……\n",
+	"Read %d photos, %d skipped.\n":                                             "读取了 %d 张照片，跳过了 %d 张。\n",
+	"No bursts found!\n":                                                        "未找到连拍照片！\n",
+	"Found %d bursts of %d photos in all.\n":                                    "找到 %d 组连拍，共 %d 张照片。\n",
+	"View report of bursts here: %s\n":                                          "在此查看连拍照片报告：%s\n",
+	"error: no directories passed\n":                                            "错误：未传入任何目录\n",
+	"error: --window should be positive, and --max-distance between 0 and 64\n": "错误：--window 必须为正数，--max-distance 必须在 0 到 64 之间\n",
+	"error: couldn't read directories: %+v\n":                                   "错误：无法读取目录：%+v\n",
+	"error while reporting bursts: %+v\n":                                       "报告连拍照片时出错：%+v\n",
+
+	// Copies of recordings
+	"Reading tracks of %d directories...\n":               "正在读取 %d 个目录中的音轨……\n",
+	"Read %d tracks, %d skipped.\n":                       "读取了 %d 个音轨，跳过了 %d 个。\n",
+	"No recordings of several copies found!\n":            "未找到有多个副本的录音！\n",
+	"Found %d recordings of %d copies in all.\n":          "找到 %d 个录音，共 %d 个副本。\n",
+	"View report of copies of recordings here: %s\n":      "在此查看录音副本报告：%s\n",
+	"error: --duration-tolerance shouldn't be negative\n": "错误：--duration-tolerance 不能为负数\n",
+	"error while reporting recordings: %+v\n":             "报告录音时出错：%+v\n",
+
+	// Digests merged across hosts
+	"Loaded digests of %d files of %s (using %s hash).\n": "已加载 %d 个文件的摘要，来自 %s（使用 %s 哈希）。\n",
+	"error: at least two digest files should be passed\n": "错误：至少需要传入两个摘要文件\n",
+
+	// Scans of the server
+	"Scan %s removed\n": "扫描 %s 已移除\n",
+	"error: --retention and --max-scans shouldn't be negative\n": "错误：--retention 和 --max-scans 不能为负数\n",
+	"error: root \"%v\" isn't a readable directory\n":            "错误：根目录 \"%v\" 不是可读目录\n",
+
+	"error: %s should be set to serve the API at %s, since anyone who can connect could run scans and remove files otherwise\n": "错误：必须设置 %s 才能在 %s 提供 API，否则任何能连接的人都可以运行扫描并删除文件\n",
+
+	// Help and diffs of subcommands
+	"\nFlags (all optional):\n":             "\n参数（均为可选）：\n",
+	"Files added (%d):\n":                   "新增的文件（%d）：\n",
+	"Files removed (%d):\n":                 "移除的文件（%d）：\n",
+	"Files modified (%d):\n":                "修改的文件（%d）：\n",
+	"New groups of duplicates (%d):\n":      "新的重复文件组（%d）：\n",
+	"Resolved groups of duplicates (%d):\n": "已解决的重复文件组（%d）：\n",
+	"%s: %d duplicate(s)\n":                 "%s：%d 个重复文件\n",
+
+	// API keys of the server
+	"Clients must present this API key (generated for this run, as %s isn't set) as a bearer token: %s\n": "客户端必须以 bearer 令牌的形式提供此 API 密钥（由于未设置 %s，已为本次运行生成）：%s\n",
+
+	// Verifying reports entirely
+	"skipping %s, which couldn't be hashed entirely: %v\n": "跳过 %s，无法对其完整计算哈希：%v\n",
+
+	// Settings of config show
+	"Configuration file: none\n":                 "配置文件：无\n",
+	"Configuration file: %s (profile %s)\n":      "配置文件：%s（配置档 %s）\n",
+	"Configuration file: %s\n":                   "配置文件：%s\n",
+	"Preset: %s\n":                               "预设：%s\n",
+	"\nFlags:\n":                                 "\n参数：\n",
+	"  %-24s %-40s (command line)\n":             "  %-24s %-40s（命令行）\n",
+	"  %-24s %-40s (configuration file)\n":       "  %-24s %-40s（配置文件）\n",
+	"  %-24s %-40s (preset %s)\n":                "  %-24s %-40s（预设 %s）\n",
+	"  %-24s %-40s (default)\n":                  "  %-24s %-40s（默认）\n",
+	"\nEnvironment:\n":                           "\n环境变量：\n",
+	"\nHashing algorithm: %s (verified by %s)\n": "\n哈希算法：%s（由 %s 验证）\n",
+	"\nHashing algorithm: %s\n":                  "\n哈希算法：%s\n",
+	"\nExclusions (%d):\n":                       "\n排除项（%d）：\n",
+}
@@ -0,0 +1,69 @@
+// Package i18n selects the language of messages meant for users, and has catalogs of their translations. Messages
+// are keyed by their formats in English (as they're printed through package fmte), so that those without a
+// translation remain in English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// EnvVar is the environment variable of the language of messages, which overrides those of the locale
+const EnvVar = "FINDDUP_LANG"
+
+// Languages are those that messages are in, the first of which is the default
+var Languages = []language.Tag{language.English, language.SimplifiedChinese}
+
+var matcher = language.NewMatcher(Languages)
+
+func init() {
+	for key, msg := range chinese {
+		_ = message.SetString(language.SimplifiedChinese, key, msg)
+	}
+}
+
+// Parse returns the language of messages that name (such as "zh", "zh-CN" or "en_US.UTF-8", as in locales) is of
+func Parse(name string) (language.Tag, error) {
+	// Locales such as zh_CN.UTF-8 have encodings (and modifiers), and underscores rather than hyphens
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	name = strings.ReplaceAll(strings.TrimSpace(name), "_", "-")
+	if name == "C" || name == "POSIX" {
+		return language.English, nil
+	}
+	tag, err := language.Parse(name)
+	if err != nil {
+		return language.English, fmt.Errorf("invalid language %q", name)
+	}
+	_, index, confidence := matcher.Match(tag)
+	if confidence == language.No {
+		return language.English, fmt.Errorf("messages aren't in %s (only in %s)", tag, strings.Join(Names(), ", "))
+	}
+	return Languages[index], nil
+}
+
+// FromEnv returns the language of messages set by EnvVar, or by the locale (LC_ALL, LC_MESSAGES or LANG, in that
+// order). Messages are in English if none of them is set, or if they're of languages that messages aren't in.
+func FromEnv() language.Tag {
+	for _, name := range []string{EnvVar, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			tag, _ := Parse(value)
+			return tag
+		}
+	}
+	return language.English
+}
+
+// Names returns names of Languages, such as "zh"
+func Names() []string {
+	names := make([]string, len(Languages))
+	for i, tag := range Languages {
+		base, _ := tag.Base()
+		names[i] = base.String()
+	}
+	return names
+}
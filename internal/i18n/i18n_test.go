@@ -0,0 +1,90 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+func TestParse(t *testing.T) {
+	for name, expected := range map[string]language.Tag{
+		"zh":          language.SimplifiedChinese,
+		"zh_CN.UTF-8": language.SimplifiedChinese,
+		"zh-Hans":     language.SimplifiedChinese,
+		"en_US.UTF-8": language.English,
+		"en-GB":       language.English,
+		"C":           language.English,
+		"POSIX":       language.English,
+	} {
+		lang, err := Parse(name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, lang, name)
+	}
+	_, err := Parse("fr_FR.UTF-8")
+	assert.ErrorContains(t, err, "en, zh")
+	_, err = Parse("not a language")
+	assert.NotNil(t, err)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "zh_CN.UTF-8")
+	assert.Equal(t, language.SimplifiedChinese, FromEnv())
+	t.Setenv(EnvVar, "en")
+	assert.Equal(t, language.English, FromEnv())
+	t.Setenv(EnvVar, "")
+	t.Setenv("LANG", "")
+	assert.Equal(t, language.English, FromEnv())
+}
+
+func TestTranslation(t *testing.T) {
+	p := message.NewPrinter(language.SimplifiedChinese)
+	assert.Equal(t, "未找到重复文件！\n", p.Sprintf("No duplicates found!\n"))
+	assert.Equal(t, "找到 1,234 个重复文件。删除它们共可节省 5 MiB。\n",
+		p.Sprintf("Found %d duplicates. A total of %s can be saved by removing them.\n", 1234, "5 MiB"))
+	assert.Equal(t, "Untranslated 1\n", p.Sprintf("Untranslated %d\n", 1))
+}
+
+// verbPattern matches verbs of formats
+var verbPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+
+// TestCatalogs checks whether translations are of formats that are printed, and have the same verbs as them
+func TestCatalogs(t *testing.T) {
+	formats := map[string]bool{}
+	root := filepath.Join("..", "..")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if value, err := strconv.Unquote(lit.Value); err == nil {
+					formats[value] = true
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	assert.Nil(t, err)
+	for key, msg := range chinese {
+		assert.True(t, formats[key], "no message is printed with format %q", key)
+		assert.Equal(t, verbPattern.FindAllString(key, -1), verbPattern.FindAllString(msg, -1), key)
+	}
+}
@@ -0,0 +1,99 @@
+// Package ignorefile parses files of patterns of files to be ignored, in the format of .gitignore files, and applies
+// those found in directories to files and directories under them
+package ignorefile
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+)
+
+// Pattern is a pattern of a file of patterns
+type Pattern struct {
+	// segments are parts of the pattern between slashes, where "**" matches any number of directories
+	segments []string
+	// Negate is whether the pattern re-includes files that earlier patterns ignore
+	Negate  bool
+	dirOnly bool
+}
+
+// Parse parses patterns of a file of patterns, as documented by gitignore(5)
+func Parse(r io.Reader) ([]Pattern, error) {
+	var patterns []Pattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if p, ok := ParsePattern(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// ParsePattern parses a line of a file of patterns, returning whether it's a pattern (rather than, e.g., a comment)
+func ParsePattern(line string) (p Pattern, ok bool) {
+	line = utils.NormalizeName(strings.TrimSuffix(line, "\r"))
+	// Trailing spaces are left out, unless they're escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+	// Patterns with a slash anywhere but at their end are relative to the directory of the file of patterns, and
+	// others match names at any depth
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	p.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return p, true
+}
+
+// Matches checks whether the pattern matches rel, a slash-separated path relative to the directory of the file of
+// the pattern. Patterns and paths are compared as normalized (see utils.NormalizeName).
+func (p Pattern) Matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(utils.NormalizeName(rel), "/"))
+}
+
+func matchSegments(segments, names []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			if len(segments) == 1 {
+				// A trailing "**" matches everything inside a directory, but not the directory itself
+				return len(names) > 0
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(segments[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if matched, err := path.Match(segments[0], names[0]); err != nil || !matched {
+			return false
+		}
+		segments, names = segments[1:], names[1:]
+	}
+	return len(names) == 0
+}
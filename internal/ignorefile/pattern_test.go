@@ -0,0 +1,48 @@
+package ignorefile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatterns(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		matches bool
+	}{
+		{"*.o", "main.o", false, true},
+		{"*.o", "src/lib/main.o", false, true},
+		{"*.o", "main.c", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "src/build", true, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/server/notes.txt", false, false},
+		{"doc/*.txt", "src/doc/notes.txt", false, false},
+		{"**/logs", "a/b/logs", true, true},
+		{"logs/**", "logs", true, false},
+		{"logs/**", "logs/a/b.log", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{`\#notes`, "#notes", false, true},
+		{"trailing.txt  ", "trailing.txt", false, true},
+		{"file[0-9].bin", "file7.bin", false, true},
+		{"r\u00e9sum\u00e9s/", "docs/re\u0301sume\u0301s", true, true},
+		{"re\u0301sume\u0301.pdf", "r\u00e9sum\u00e9.pdf", false, true},
+	} {
+		p, ok := ParsePattern(tc.pattern)
+		assert.True(t, ok, tc.pattern)
+		assert.Equal(t, tc.matches, p.Matches(tc.rel, tc.isDir), "%q on %q", tc.pattern, tc.rel)
+	}
+	for _, line := range []string{"", "# comment", "   ", "/"} {
+		_, ok := ParsePattern(line)
+		assert.False(t, ok, line)
+	}
+	p, ok := ParsePattern("!keep.o")
+	assert.True(t, ok)
+	assert.True(t, p.Negate)
+}
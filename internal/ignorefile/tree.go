@@ -0,0 +1,90 @@
+package ignorefile
+
+import (
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// DupignoreFileName is the name of files of patterns of files that scans leave out, in any directory scanned
+const DupignoreFileName = ".dupignore"
+
+// Tree applies files of patterns of the same name (such as .gitignore) in directories to files and directories
+// under them
+type Tree struct {
+	fsys     vfs.FS
+	fileName string
+
+	mx sync.Mutex
+	// patterns maps files of patterns to their patterns
+	patterns map[string][]Pattern
+}
+
+// NewTree creates a tree of files of patterns named fileName in fsys
+func NewTree(fsys vfs.FS, fileName string) *Tree {
+	return &Tree{fsys: fsys, fileName: fileName, patterns: map[string][]Pattern{}}
+}
+
+// Ignored checks whether name is ignored by files of patterns of root, a directory it's in, and of directories
+// under root down to that of name. As with Git, patterns of files in deeper directories take precedence over those
+// in shallower ones, and later patterns of a file over earlier ones. ignored is whether name is ignored before any
+// of them apply.
+func (t *Tree) Ignored(root, name string, isDir bool, ignored bool) bool {
+	rel := vfs.Rel(root, name)
+	dir, dirRel := root, ""
+	for {
+		ignored = t.Match(vfs.Join(dir, t.fileName), strings.TrimPrefix(rel, dirRel), isDir, ignored)
+		i := strings.IndexByte(rel[len(dirRel):], '/')
+		if i < 0 {
+			return ignored
+		}
+		next := rel[len(dirRel) : len(dirRel)+i]
+		dir, dirRel = vfs.Join(dir, next), dirRel+next+"/"
+	}
+}
+
+// Match applies patterns of patternsFile to rel, a path relative to the directory of that file, returning
+// whether the file is ignored, given whether it's ignored by patterns applied before. Files that can't be read are
+// treated as having no patterns, as Git does.
+func (t *Tree) Match(patternsFile, rel string, isDir bool, ignored bool) bool {
+	t.mx.Lock()
+	patterns, exists := t.patterns[patternsFile]
+	if !exists {
+		patterns = t.read(patternsFile)
+		t.patterns[patternsFile] = patterns
+	}
+	t.mx.Unlock()
+	for _, p := range patterns {
+		if p.Matches(rel, isDir) {
+			ignored = !p.Negate
+		}
+	}
+	return ignored
+}
+
+func (t *Tree) read(name string) []Pattern {
+	f, err := t.fsys.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	patterns, _ := Parse(f)
+	return patterns
+}
+
+// FileFilter returns a service.FileFilter that skips files and directories ignored by files of patterns of the
+// tree in roots (directories that are scanned) and in directories under them
+func (t *Tree) FileFilter(roots []string) func(name string, info fs.FileInfo) bool {
+	return func(name string, info fs.FileInfo) bool {
+		root := ""
+		for _, r := range roots {
+			// Of roots that are in others, the deepest one is the root of name
+			if len(r) > len(root) && vfs.IsIn(r, name) {
+				root = r
+			}
+		}
+		return root == "" || !t.Ignored(root, name, info.IsDir(), false)
+	}
+}
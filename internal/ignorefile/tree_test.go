@@ -0,0 +1,55 @@
+package ignorefile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDupignore(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("duplicate ", 1_000)
+	for name, c := range map[string]string{
+		"photos/.dupignore":          "*.tmp\nbuild/\n/exports/*.txt\n",
+		"photos/1.txt":               content,
+		"photos/2.tmp":               content,
+		"photos/build/3.txt":         content,
+		"photos/exports/4.txt":       content,
+		"photos/2020/.dupignore":     "!keep.tmp\n",
+		"photos/2020/keep.tmp":       content,
+		"photos/2020/5.tmp":          content,
+		"photos/2020/exports/6.txt":  content,
+		"music/7.tmp":                content,
+		"music/8.txt":                content,
+		"music/.dupignore.bak/9.txt": content,
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		assert.Nil(t, os.WriteFile(name, []byte(c), 0o644))
+	}
+	roots := []string{filepath.Join(dir, "photos"), filepath.Join(dir, "music")}
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(roots,
+		service.WithFileSizeThreshold(1_000), service.WithLogger(fmte.Discard),
+		service.WithFileFilter(NewTree(vfs.Local, DupignoreFileName).FileFilter(roots))))
+	assert.Nil(t, err)
+	var paths []string
+	for _, group := range result.Duplicates.All() {
+		for _, p := range group {
+			rel, _ := filepath.Rel(dir, p)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"music/.dupignore.bak/9.txt", "music/7.tmp", "music/8.txt", "photos/1.txt",
+		"photos/2020/exports/6.txt", "photos/2020/keep.tmp"}, paths)
+	// Digests include extensions of files, so .tmp files are a group apart
+	assert.Equal(t, 2, result.Duplicates.Size())
+}
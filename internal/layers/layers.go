@@ -0,0 +1,496 @@
+// Package layers reads layers of container images as a file system, so that files duplicated across layers and
+// images can be found. Images are read from tarballs of "docker save", OCI image layouts (as directories or
+// tarballs) and storage of the Docker daemon (with the overlay2 driver).
+package layers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// shortIDLength is the length of IDs of layers, and of images without names, as shown by Docker
+const shortIDLength = 12
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Layer is a layer of one or more images
+type Layer struct {
+	// Digest identifies the layer by its uncompressed contents (its diff ID), if known, or by its blob otherwise
+	Digest string
+	// ID is the name of the directory of the layer in the file system of the Set
+	ID string
+	// Images are names of images that have the layer (their tags, or their short IDs if they're untagged), sorted
+	Images []string
+
+	// dir is the local directory of contents of the layer, for extracted layers
+	dir string
+	// tree indexes files of the layer, for layers read from tarballs
+	tree *tree
+}
+
+// Set is a set of layers of images. Its file system has a directory per layer named by its ID, so that layers
+// shared by images are scanned once.
+type Set struct {
+	layers   []*Layer
+	byDigest map[string]*Layer
+	byID     map[string]*Layer
+	images   int
+	tmpDir   string
+	closers  []io.Closer
+}
+
+// Open reads images from sources, each of which is a tarball (optionally compressed with gzip) of "docker save" or
+// an OCI image layout, a directory of either of those extracted, or a storage directory of the Docker daemon (such
+// as /var/lib/docker). Compressed layers are decompressed to temporary files (removed on Close).
+func Open(sources ...string) (*Set, error) {
+	s := &Set{byDigest: map[string]*Layer{}, byID: map[string]*Layer{}}
+	for _, source := range sources {
+		if err := s.open(source); err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("couldn't read images in %s: %w", source, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Set) open(source string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if isDockerStorage(source) {
+			return s.readDockerStorage(source)
+		}
+		return s.readArchive(dirArchive{dir: source, s: s})
+	}
+	r, err := s.openFile(source)
+	if err != nil {
+		return err
+	}
+	if r, err = s.decompress(r); err != nil {
+		return err
+	}
+	a, err := indexTarArchive(r)
+	if err != nil {
+		return err
+	}
+	return s.readArchive(a)
+}
+
+// Layers returns the layers, in the order they were read
+func (s *Set) Layers() []*Layer {
+	return s.layers
+}
+
+// Images returns the number of images read
+func (s *Set) Images() int {
+	return s.images
+}
+
+// Locate returns the layer that name (of the file system) is in, and the absolute path of the file within it
+func (s *Set) Locate(name string) (*Layer, string) {
+	id, rest, _ := strings.Cut(filepath.ToSlash(name), "/")
+	return s.byID[id], "/" + rest
+}
+
+// Close releases files opened, and removes temporary files
+func (s *Set) Close() error {
+	var errs []error
+	for _, c := range s.closers {
+		errs = append(errs, c.Close())
+	}
+	if s.tmpDir != "" {
+		errs = append(errs, os.RemoveAll(s.tmpDir))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Set) openFile(name string) (*io.SectionReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	s.closers = append(s.closers, f)
+	return io.NewSectionReader(f, 0, info.Size()), nil
+}
+
+// decompress returns contents of r, decompressed to a temporary file if they're compressed with gzip
+func (s *Set) decompress(r *io.SectionReader) (*io.SectionReader, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, _ := r.ReadAt(magic, 0)
+	magic = magic[:n]
+	if bytes.HasPrefix(magic, zstdMagic) {
+		return nil, errors.New("layers compressed with zstd aren't supported")
+	}
+	if !bytes.HasPrefix(magic, gzipMagic) {
+		return r, nil
+	}
+	if s.tmpDir == "" {
+		dir, err := os.MkdirTemp("", "go-find-duplicates-layers-")
+		if err != nil {
+			return nil, err
+		}
+		s.tmpDir = dir
+	}
+	zr, err := gzip.NewReader(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(s.tmpDir, "layer-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	s.closers = append(s.closers, f)
+	size, err := io.Copy(f, zr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decompress: %w", err)
+	}
+	return io.NewSectionReader(f, 0, size), nil
+}
+
+// addLayer adds the layer of digest to image, reading it through read unless it's known already
+func (s *Set) addLayer(digest, image string, read func(l *Layer) error) error {
+	l, exists := s.byDigest[digest]
+	if !exists {
+		_, hexDigest, _ := strings.Cut(digest, ":")
+		l = &Layer{Digest: digest, ID: hexDigest[:min(shortIDLength, len(hexDigest))]}
+		if _, clashes := s.byID[l.ID]; clashes || l.ID == "" {
+			l.ID = strings.ReplaceAll(digest, ":", "_")
+		}
+		if err := read(l); err != nil {
+			return fmt.Errorf("couldn't read layer %s: %w", digest, err)
+		}
+		s.layers = append(s.layers, l)
+		s.byDigest[digest] = l
+		s.byID[l.ID] = l
+	}
+	for _, img := range l.Images {
+		if img == image {
+			return nil
+		}
+	}
+	l.Images = append(l.Images, image)
+	sort.Strings(l.Images)
+	return nil
+}
+
+// addTarLayer adds the layer of digest in blob (a tarball, optionally compressed) to image
+func (s *Set) addTarLayer(digest, image string, blob *io.SectionReader) error {
+	return s.addLayer(digest, image, func(l *Layer) error {
+		r, err := s.decompress(blob)
+		if err != nil {
+			return err
+		}
+		l.tree, err = indexTree(r)
+		return err
+	})
+}
+
+// imageConfig is the part of the configuration of an image that identifies its layers
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// archive is where files of images (their manifests, configurations and layers) are read from
+type archive interface {
+	open(name string) (*io.SectionReader, error)
+}
+
+func readJSON(a archive, name string, v any) error {
+	r, err := a.open(name)
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+// readArchive reads images of a "docker save" tarball (by its manifest.json) or of an OCI image layout (by its
+// index.json)
+func (s *Set) readArchive(a archive) error {
+	var manifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := readJSON(a, "manifest.json", &manifest); err == nil {
+		for _, m := range manifest {
+			var config imageConfig
+			if err := readJSON(a, m.Config, &config); err != nil {
+				return err
+			}
+			image := imageName(m.RepoTags, m.Config)
+			for i, layer := range m.Layers {
+				blob, err := a.open(layer)
+				if err != nil {
+					return err
+				}
+				// Names of layers are derived from their digests, so they identify layers without diff IDs
+				sum := sha256.Sum256([]byte(layer))
+				digest := "sha256:" + hex.EncodeToString(sum[:])
+				if i < len(config.RootFS.DiffIDs) {
+					digest = config.RootFS.DiffIDs[i]
+				}
+				if err := s.addTarLayer(digest, image, blob); err != nil {
+					return err
+				}
+			}
+			s.images++
+		}
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var index ociIndex
+	if err := readJSON(a, "index.json", &index); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("neither manifest.json (of docker save) nor index.json (of an OCI image layout) found")
+		}
+		return err
+	}
+	return s.readOCIIndex(a, index, "")
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// readOCIIndex reads images of index, which are named name unless they're annotated with names of their own
+func (s *Set) readOCIIndex(a archive, index ociIndex, name string) error {
+	for _, desc := range index.Manifests {
+		descName := name
+		if ref := desc.Annotations["org.opencontainers.image.ref.name"]; ref != "" {
+			descName = ref
+		}
+		if strings.HasSuffix(desc.MediaType, "index.v1+json") || strings.HasSuffix(desc.MediaType, "list.v2+json") {
+			var nested ociIndex
+			if err := readJSON(a, blobName(desc.Digest), &nested); err != nil {
+				return err
+			}
+			if err := s.readOCIIndex(a, nested, descName); err != nil {
+				return err
+			}
+			continue
+		}
+		var manifest ociManifest
+		if err := readJSON(a, blobName(desc.Digest), &manifest); err != nil {
+			return err
+		}
+		var config imageConfig
+		if err := readJSON(a, blobName(manifest.Config.Digest), &config); err != nil {
+			return err
+		}
+		var tags []string
+		if descName != "" {
+			tags = []string{descName}
+		}
+		image := imageName(tags, manifest.Config.Digest)
+		for i, layer := range manifest.Layers {
+			blob, err := a.open(blobName(layer.Digest))
+			if err != nil {
+				return err
+			}
+			digest := layer.Digest
+			if i < len(config.RootFS.DiffIDs) {
+				digest = config.RootFS.DiffIDs[i]
+			}
+			if err := s.addTarLayer(digest, image, blob); err != nil {
+				return err
+			}
+		}
+		s.images++
+	}
+	return nil
+}
+
+// blobName is the name of the blob of digest in an OCI image layout
+func blobName(digest string) string {
+	algorithm, hexDigest, _ := strings.Cut(digest, ":")
+	return "blobs/" + algorithm + "/" + hexDigest
+}
+
+// imageName names an image by its tags, or by the short ID of its configuration if it has none
+func imageName(tags []string, config string) string {
+	if len(tags) > 0 {
+		return strings.Join(tags, ", ")
+	}
+	id := strings.TrimSuffix(path.Base(config), ".json")
+	return id[:min(shortIDLength, len(id))]
+}
+
+// dirArchive is a directory of a "docker save" tarball or an OCI image layout, extracted. Files opened in it are
+// closed along with s.
+type dirArchive struct {
+	dir string
+	s   *Set
+}
+
+func (d dirArchive) open(name string) (*io.SectionReader, error) {
+	return d.s.openFile(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
+
+// tarArchive is a tarball of "docker save" or an OCI image layout, whose entries are read in place
+type tarArchive struct {
+	*tree
+}
+
+func indexTarArchive(r *io.SectionReader) (tarArchive, error) {
+	t, err := indexTree(r)
+	return tarArchive{t}, err
+}
+
+// maxSymlinks is the most symbolic links followed to open an entry of a tarball
+const maxSymlinks = 8
+
+func (a tarArchive) open(name string) (*io.SectionReader, error) {
+	entry := cleanName(name)
+	for i := 0; i <= maxSymlinks; i++ {
+		n, exists := a.nodes[entry]
+		if !exists {
+			break
+		}
+		if n.info.Mode().IsRegular() {
+			return io.NewSectionReader(a.r, n.offset, n.info.Size()), nil
+		}
+		hdr, isHeader := n.info.Sys().(*tar.Header)
+		if !isHeader || hdr.Typeflag != tar.TypeSymlink {
+			break
+		}
+		// Layers of "docker save" may be links to identical layers of other images
+		entry = cleanName(path.Join(path.Dir(entry), hdr.Linkname))
+	}
+	return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+}
+
+// isDockerStorage checks whether dir is a storage directory of the Docker daemon, with the overlay2 driver
+func isDockerStorage(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "image", "overlay2", "imagedb"))
+	return err == nil && info.IsDir()
+}
+
+// readDockerStorage reads images in the storage directory of the Docker daemon, whose layers are extracted already
+func (s *Set) readDockerStorage(dir string) error {
+	imageDir := filepath.Join(dir, "image", "overlay2")
+	var repositories struct {
+		Repositories map[string]map[string]string
+	}
+	if data, err := os.ReadFile(filepath.Join(imageDir, "repositories.json")); err == nil {
+		if err := json.Unmarshal(data, &repositories); err != nil {
+			return fmt.Errorf("invalid repositories.json: %w", err)
+		}
+	}
+	tags := map[string][]string{}
+	for _, refs := range repositories.Repositories {
+		for ref, id := range refs {
+			if !strings.Contains(ref, "@") {
+				tags[id] = append(tags[id], ref)
+			}
+		}
+	}
+	contentDir := filepath.Join(imageDir, "imagedb", "content", "sha256")
+	entries, err := os.ReadDir(contentDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(contentDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var config imageConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("invalid configuration of image %s: %w", entry.Name(), err)
+		}
+		imageTags := tags["sha256:"+entry.Name()]
+		sort.Strings(imageTags)
+		image := imageName(imageTags, entry.Name())
+		var chainID string
+		for _, diffID := range config.RootFS.DiffIDs {
+			if chainID == "" {
+				chainID = diffID
+			} else {
+				sum := sha256.Sum256([]byte(chainID + " " + diffID))
+				chainID = "sha256:" + hex.EncodeToString(sum[:])
+			}
+			layerDir := filepath.Join(imageDir, "layerdb", blobName(chainID)[len("blobs/"):])
+			err := s.addLayer(diffID, image, func(l *Layer) error {
+				cacheID, err := os.ReadFile(filepath.Join(layerDir, "cache-id"))
+				if err != nil {
+					return err
+				}
+				l.dir = filepath.Join(dir, "overlay2", strings.TrimSpace(string(cacheID)), "diff")
+				_, err = os.Stat(l.dir)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		s.images++
+	}
+	return nil
+}
+
+// Ensure Set's file system is a vfs.FS
+var _ vfs.FS = (*Set)(nil)
+
+// splitName splits name of the file system into the layer it's in, and its name within the layer
+func (s *Set) splitName(name string) (*Layer, string, error) {
+	id, rest, _ := strings.Cut(filepath.ToSlash(name), "/")
+	l, exists := s.byID[id]
+	if !exists {
+		return nil, "", fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return l, cleanName(rest), nil
+}
+
+// cleanName normalizes a name of an entry of a tarball, to be relative to its root without "./"
+func cleanName(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func dirName(l *Layer, name string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(name))
+}
@@ -0,0 +1,284 @@
+package layers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	libContent  = strings.Repeat("shared library ", 1_000)
+	dataContent = strings.Repeat("data ", 1_000)
+)
+
+// tarball creates a tarball of files, in order of their names
+func tarball(t *testing.T, files map[string]string) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			hdr = &tar.Header{Name: name, Mode: 0o755, Typeflag: tar.TypeDir}
+		} else if target, isLink := strings.CutPrefix(files[name], "->"); isLink {
+			hdr = &tar.Header{Name: name, Linkname: target, Typeflag: tar.TypeSymlink}
+		}
+		assert.Nil(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(files[name]))
+			assert.Nil(t, err)
+		}
+	}
+	assert.Nil(t, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, zw.Close())
+	return buf.Bytes()
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func toJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func config(diffIDs ...string) map[string]any {
+	return map[string]any{"rootfs": map[string]any{"type": "layers", "diff_ids": diffIDs}}
+}
+
+// base, app and tool are layers of test images: base is shared by both images, and app and tool have copies of a
+// file of base
+var (
+	base = map[string]string{"usr/": "", "usr/lib/libc.so": libContent, "etc/os-release": "test"}
+	app  = map[string]string{"./app/lib/libc.so": libContent, "app/data.bin": dataContent,
+		"usr/lib/.wh.old.so": "", "app/link": "->data.bin"}
+	tool = map[string]string{"opt/tool/libc.so": libContent, "opt/tool/data.bin": dataContent}
+)
+
+// writeDockerSave writes a tarball of "docker save" of images "app:1" (of layers base and app) and "tool:1" (of
+// layers base and tool)
+func writeDockerSave(t *testing.T, name string) string {
+	baseTar, appTar, toolTar := tarball(t, base), tarball(t, app), tarball(t, tool)
+	appConfig := toJSON(t, config(digest(baseTar), digest(appTar)))
+	toolConfig := toJSON(t, config(digest(baseTar), digest(toolTar)))
+	manifest := toJSON(t, []map[string]any{
+		{"Config": "app.json", "RepoTags": []string{"app:1"}, "Layers": []string{"1/layer.tar", "2/layer.tar"}},
+		{"Config": "tool.json", "RepoTags": []string{"tool:1"}, "Layers": []string{"3/layer.tar", "4/layer.tar"}},
+	})
+	data := tarball(t, map[string]string{
+		"manifest.json": manifest, "app.json": appConfig, "tool.json": toolConfig,
+		"1/layer.tar": string(baseTar), "2/layer.tar": string(appTar),
+		"3/layer.tar": "->../1/layer.tar", "4/layer.tar": string(toolTar),
+	})
+	file := filepath.Join(t.TempDir(), name)
+	if strings.HasSuffix(name, ".gz") {
+		data = gzipped(t, data)
+	}
+	assert.Nil(t, os.WriteFile(file, data, 0o644))
+	return file
+}
+
+// writeOCILayout writes an OCI image layout, with layers compressed with gzip, of the same images as
+// writeDockerSave
+func writeOCILayout(t *testing.T) string {
+	dir := t.TempDir()
+	writeBlob := func(data []byte) string {
+		d := digest(data)
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, filepath.FromSlash(blobName(d))), data, 0o644))
+		return d
+	}
+	var manifests []map[string]any
+	for _, img := range []struct {
+		name   string
+		layers []map[string]string
+	}{{"app:1", []map[string]string{base, app}}, {"tool:1", []map[string]string{base, tool}}} {
+		var diffIDs []string
+		var layers []map[string]any
+		for _, files := range img.layers {
+			data := tarball(t, files)
+			diffIDs = append(diffIDs, digest(data))
+			layers = append(layers, map[string]any{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+				"digest": writeBlob(gzipped(t, data))})
+		}
+		manifest := writeBlob([]byte(toJSON(t, map[string]any{
+			"config": map[string]any{"digest": writeBlob([]byte(toJSON(t, config(diffIDs...))))},
+			"layers": layers,
+		})))
+		manifests = append(manifests, map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"digest": manifest, "annotations": map[string]string{"org.opencontainers.image.ref.name": img.name}})
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "index.json"),
+		[]byte(toJSON(t, map[string]any{"manifests": manifests})), 0o644))
+	return dir
+}
+
+// writeDockerStorage writes a storage directory of the Docker daemon, with the same images as writeDockerSave
+func writeDockerStorage(t *testing.T) string {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	repositories := map[string]map[string]string{}
+	layerDirs := map[string]bool{}
+	for i, img := range []struct {
+		name   string
+		layers []map[string]string
+	}{{"app:1", []map[string]string{base, app}}, {"tool:1", []map[string]string{base, tool}}} {
+		var diffIDs []string
+		var chainID string
+		for _, files := range img.layers {
+			diffID := digest(tarball(t, files))
+			diffIDs = append(diffIDs, diffID)
+			if chainID == "" {
+				chainID = diffID
+			} else {
+				chainID = digest([]byte(chainID + " " + diffID))
+			}
+			cacheID := strings.TrimPrefix(diffID, "sha256:")[:16]
+			write(filepath.Join("image/overlay2/layerdb/sha256", strings.TrimPrefix(chainID, "sha256:"), "cache-id"),
+				cacheID)
+			if layerDirs[cacheID] {
+				continue
+			}
+			layerDirs[cacheID] = true
+			for name, content := range files {
+				if !strings.HasSuffix(name, "/") && !strings.Contains(name, ".wh.") &&
+					!strings.HasPrefix(content, "->") {
+					write(filepath.Join("overlay2", cacheID, "diff", name), content)
+				}
+			}
+		}
+		configJSON := toJSON(t, config(diffIDs...))
+		id := digest([]byte(configJSON))
+		write(filepath.Join("image/overlay2/imagedb/content/sha256", strings.TrimPrefix(id, "sha256:")), configJSON)
+		repositories[strings.Split(img.name, ":")[0]] = map[string]string{img.name: id,
+			img.name[:1] + "@sha256:" + strings.Repeat("0", 63) + string(rune('0'+i)): id}
+	}
+	write("image/overlay2/repositories.json", toJSON(t, map[string]any{"Repositories": repositories}))
+	return dir
+}
+
+// findDuplicates scans all layers of s, returning groups of duplicates as locations of files, in layers of images
+func findDuplicates(t *testing.T, s *Set) [][]string {
+	var dirs []string
+	for _, l := range s.Layers() {
+		dirs = append(dirs, l.ID)
+	}
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(dirs, service.WithFS(s),
+		service.WithFileSizeThreshold(1), service.WithLogger(fmte.Discard)))
+	assert.Nil(t, err)
+	var groups [][]string
+	for _, paths := range result.Duplicates.All() {
+		var group []string
+		for _, p := range paths {
+			l, name := s.Locate(p)
+			group = append(group, strings.Join(l.Images, "+")+":"+name)
+		}
+		sort.Strings(group)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+var expectedGroups = [][]string{
+	{"app:1+tool:1:/usr/lib/libc.so", "app:1:/app/lib/libc.so", "tool:1:/opt/tool/libc.so"},
+	{"app:1:/app/data.bin", "tool:1:/opt/tool/data.bin"},
+}
+
+func TestDockerSave(t *testing.T) {
+	for _, name := range []string{"images.tar", "images.tar.gz"} {
+		s, err := Open(writeDockerSave(t, name))
+		assert.Nil(t, err, name)
+		assert.Equal(t, 2, s.Images())
+		assert.Len(t, s.Layers(), 3)
+		assert.Equal(t, []string{"app:1", "tool:1"}, s.Layers()[0].Images)
+		assert.Equal(t, expectedGroups, findDuplicates(t, s), name)
+		assert.Nil(t, s.Close())
+	}
+}
+
+func TestOCILayout(t *testing.T) {
+	s, err := Open(writeOCILayout(t))
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.Equal(t, 2, s.Images())
+	assert.Len(t, s.Layers(), 3)
+	assert.Equal(t, expectedGroups, findDuplicates(t, s))
+	assert.DirExists(t, s.tmpDir)
+	assert.Nil(t, s.Close())
+	assert.NoDirExists(t, s.tmpDir)
+}
+
+func TestDockerStorage(t *testing.T) {
+	s, err := Open(writeDockerStorage(t))
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.Equal(t, 2, s.Images())
+	assert.Len(t, s.Layers(), 3)
+	assert.Equal(t, expectedGroups, findDuplicates(t, s))
+}
+
+func TestFS(t *testing.T) {
+	s, err := Open(writeDockerSave(t, "images.tar"))
+	assert.Nil(t, err)
+	defer s.Close()
+	appLayer := s.Layers()[1]
+	entries, err := s.ReadDir(appLayer.ID)
+	assert.Nil(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// Whiteouts are left out
+	assert.Equal(t, []string{"app"}, names)
+	info, err := s.Lstat(filepath.Join(appLayer.ID, "app", "link"))
+	assert.Nil(t, err)
+	assert.Equal(t, fs.ModeSymlink, info.Mode().Type())
+	f, err := s.Open(filepath.Join(appLayer.ID, "app", "data.bin"))
+	assert.Nil(t, err)
+	content, err := io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, dataContent, string(content))
+	assert.Nil(t, f.Close())
+	_, err = s.Stat(filepath.Join(appLayer.ID, "missing"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = s.Stat("unknown/app")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = Open(t.TempDir())
+	assert.ErrorContains(t, err, "neither manifest.json")
+}
@@ -0,0 +1,188 @@
+package layers
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// whiteoutPrefix starts names of entries of layers that mark files of lower layers as deleted
+const whiteoutPrefix = ".wh."
+
+// node is an entry of a tarball
+type node struct {
+	info fs.FileInfo
+	// offset is where contents of the entry start in the tarball
+	offset int64
+}
+
+// tree indexes entries of a tarball, so that they can be read in place
+type tree struct {
+	r        io.ReaderAt
+	nodes    map[string]*node
+	children map[string]map[string]bool
+}
+
+// countingReader counts bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// indexTree indexes directories, regular files and symbolic links of the tarball r. Whiteouts and hard links are
+// left out, since they don't take up space of their own.
+func indexTree(r *io.SectionReader) (*tree, error) {
+	t := &tree{r: r, nodes: map[string]*node{}, children: map[string]map[string]bool{}}
+	t.add(".", dirInfo("."), 0)
+	cr := &countingReader{r: io.NewSectionReader(r, 0, r.Size())}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tarball: %w", err)
+		}
+		name := cleanName(hdr.Name)
+		if name == "." || strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink:
+			// Archive/tar reads headers and contents of entries without reading ahead, so contents start here
+			t.add(name, hdr.FileInfo(), cr.n)
+		}
+	}
+}
+
+// add adds an entry, along with its parent directories if they have no entries of their own
+func (t *tree) add(name string, info fs.FileInfo, offset int64) {
+	if existing, exists := t.nodes[name]; exists && existing.info.IsDir() && info.IsDir() {
+		// Entries of directories may come after those of their contents
+		existing.info = info
+		return
+	}
+	t.nodes[name] = &node{info: info, offset: offset}
+	for name != "." {
+		parent := path.Dir(name)
+		if t.children[parent] == nil {
+			t.children[parent] = map[string]bool{}
+		}
+		t.children[parent][path.Base(name)] = true
+		if _, exists := t.nodes[parent]; exists {
+			return
+		}
+		t.nodes[parent] = &node{info: dirInfo(path.Base(parent))}
+		name = parent
+	}
+}
+
+func (t *tree) lookup(name string) (*node, error) {
+	n, exists := t.nodes[name]
+	if !exists {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+// dirInfo is information about a directory that has no entry of its own in a tarball
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o755 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() any           { return nil }
+
+// file is an open entry of a tarball
+type file struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+func (s *Set) Open(name string) (fs.File, error) {
+	l, rel, err := s.splitName(name)
+	if err != nil {
+		return nil, err
+	}
+	if l.tree == nil {
+		return os.Open(dirName(l, rel))
+	}
+	n, err := l.tree.lookup(rel)
+	if err != nil {
+		return nil, err
+	}
+	return &file{SectionReader: io.NewSectionReader(l.tree.r, n.offset, n.info.Size()), info: n.info}, nil
+}
+
+func (s *Set) Stat(name string) (fs.FileInfo, error) {
+	l, rel, err := s.splitName(name)
+	if err != nil {
+		return nil, err
+	}
+	if l.tree == nil {
+		return os.Stat(dirName(l, rel))
+	}
+	// Symbolic links aren't followed within tarballs, since they may point anywhere in the merged file system
+	return s.Lstat(name)
+}
+
+func (s *Set) Lstat(name string) (fs.FileInfo, error) {
+	l, rel, err := s.splitName(name)
+	if err != nil {
+		return nil, err
+	}
+	if l.tree == nil {
+		return os.Lstat(dirName(l, rel))
+	}
+	n, err := l.tree.lookup(rel)
+	if err != nil {
+		return nil, err
+	}
+	return n.info, nil
+}
+
+func (s *Set) ReadDir(name string) ([]fs.DirEntry, error) {
+	l, rel, err := s.splitName(name)
+	if err != nil {
+		return nil, err
+	}
+	if l.tree == nil {
+		return os.ReadDir(dirName(l, rel))
+	}
+	n, err := l.tree.lookup(rel)
+	if err != nil {
+		return nil, err
+	}
+	if !n.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	names := make([]string, 0, len(l.tree.children[rel]))
+	for child := range l.tree.children[rel] {
+		names = append(names, child)
+	}
+	sort.Strings(names)
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, child := range names {
+		entries = append(entries, fs.FileInfoToDirEntry(l.tree.nodes[path.Join(rel, child)].info))
+	}
+	return entries, nil
+}
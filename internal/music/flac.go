@@ -0,0 +1,108 @@
+package music
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Types of metadata blocks of FLAC (see https://www.rfc-editor.org/rfc/rfc9639.html#name-metadata-block-header)
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+)
+
+// readFLAC reads tags (of the Vorbis comment) and properties of the stream (of STREAMINFO) of the FLAC of r, which is
+// of size bytes
+func readFLAC(r io.ReaderAt, size int64) (Track, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil || string(magic[:]) != "fLaC" {
+		return Track{}, errors.New("not a FLAC")
+	}
+	track := Track{Format: FLAC, Lossless: true}
+	var hasStreamInfo bool
+	for offset, last := int64(4), false; !last; {
+		var header [4]byte
+		if _, err := r.ReadAt(header[:], offset); err != nil {
+			return Track{}, err
+		}
+		last = header[0]&0x80 != 0
+		typ, length := header[0]&0x7f, int64(header[1])<<16|int64(header[2])<<8|int64(header[3])
+		offset += 4
+		switch typ {
+		case flacStreamInfo, flacVorbisComment:
+			block := make([]byte, length)
+			if _, err := r.ReadAt(block, offset); err != nil {
+				return Track{}, err
+			}
+			if typ == flacVorbisComment {
+				track.setTags(vorbisComments(block))
+			} else if hasStreamInfo = readStreamInfo(block, &track); !hasStreamInfo {
+				return Track{}, errors.New("invalid STREAMINFO of FLAC")
+			}
+		}
+		offset += length
+	}
+	if !hasStreamInfo {
+		return Track{}, errors.New("no STREAMINFO of FLAC")
+	}
+	if track.Duration > 0 {
+		track.Bitrate = int(float64(size*8) / track.Duration.Seconds())
+	}
+	return track, nil
+}
+
+// readStreamInfo reads the sample rate, bit depth and duration of the STREAMINFO block into track
+func readStreamInfo(block []byte, track *Track) bool {
+	if len(block) < 18 {
+		return false
+	}
+	track.SampleRate = int(block[10])<<12 | int(block[11])<<4 | int(block[12])>>4
+	track.BitDepth = (int(block[12])&1)<<4 | int(block[13])>>4 + 1
+	samples := uint64(block[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(block[14:]))
+	if track.SampleRate > 0 {
+		track.Duration = time.Duration(samples * uint64(time.Second) / uint64(track.SampleRate))
+	}
+	return true
+}
+
+// vorbisComments returns fields of a Vorbis comment, by their names in upper case (see
+// https://www.xiph.org/vorbis/doc/v-comment.html), whose lengths are little-endian, unlike the rest of FLAC
+func vorbisComments(block []byte) map[string]string {
+	comments := map[string]string{}
+	next := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(block)
+		if uint64(n) > uint64(len(block)-4) {
+			return "", false
+		}
+		s := string(block[4 : 4+n])
+		block = block[4+n:]
+		return s, true
+	}
+	if _, ok := next(); !ok { // The vendor string
+		return comments
+	}
+	if len(block) < 4 {
+		return comments
+	}
+	count := binary.LittleEndian.Uint32(block)
+	block = block[4:]
+	for range count {
+		field, ok := next()
+		if !ok {
+			break
+		}
+		if name, value, ok := strings.Cut(field, "="); ok {
+			// The first of fields of the same name (such as of several artists) is that of the track
+			if name = strings.ToUpper(name); comments[name] == "" {
+				comments[name] = value
+			}
+		}
+	}
+	return comments
+}
@@ -0,0 +1,200 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// id3Tags are names of tags, as of Vorbis comments, by IDs of text frames of ID3v2.3 and ID3v2.4, and of ID3v2.2
+var id3Tags = map[string]string{
+	"TPE1": "ARTIST", "TIT2": "TITLE", "TALB": "ALBUM",
+	"TP1": "ARTIST", "TT2": "TITLE", "TAL": "ALBUM",
+}
+
+// Bitrates (in kbit/s) of MPEG audio layer III by index of headers of frames, of MPEG-1 and of MPEG-2 and 2.5
+var (
+	mpeg1Bitrates = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mpeg2Bitrates = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mpeg1Rates    = [4]int{44100, 48000, 32000, 0}
+)
+
+// maxFrameSearch is how far past tags the first frame of MP3s is looked for
+const maxFrameSearch = 64 * 1024
+
+// readMP3 reads tags (of ID3v2, or else of ID3v1) and properties of the stream (of its first frame, and of its
+// Xing header, of VBR) of the MP3 of r, which is of size bytes
+func readMP3(r io.ReaderAt, size int64) (Track, error) {
+	track := Track{Format: MP3}
+	start := int64(0)
+	var header [10]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return Track{}, errors.New("not an MP3")
+	}
+	if string(header[:3]) == "ID3" {
+		length := int64(syncsafe(header[6:]))
+		tag := make([]byte, length)
+		if _, err := r.ReadAt(tag, 10); err != nil {
+			return Track{}, err
+		}
+		track.setTags(id3v2Frames(header[3], header[5], tag))
+		start = 10 + length
+		if header[5]&0x10 != 0 { // A footer
+			start += 10
+		}
+	}
+	// ID3v1 tags, of the last 128 bytes, aren't audio either
+	if size-start >= 128 {
+		v1 := make([]byte, 128)
+		if _, err := r.ReadAt(v1, size-128); err == nil && string(v1[:3]) == "TAG" {
+			field := func(b []byte) string { return latin1(strings.TrimRight(string(b), "\x00 ")) }
+			track.setTags(map[string]string{"TITLE": field(v1[3:33]), "ARTIST": field(v1[33:63]),
+				"ALBUM": field(v1[63:93])})
+			size -= 128
+		}
+	}
+	buf := make([]byte, min(maxFrameSearch, max(size-start, 0)))
+	n, _ := r.ReadAt(buf, start)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		if readFrame(buf[i:], size-start-int64(i), &track) {
+			return track, nil
+		}
+	}
+	return Track{}, errors.New("no frames of MPEG audio layer III")
+}
+
+// readFrame reads the sample rate, bitrate and duration of the stream, of audio bytes, whose first frame is that of
+// frame, into track. Durations of VBR streams are of frames of their Xing headers (or Info headers, of LAME), and
+// those of CBR streams are of their bitrate.
+func readFrame(frame []byte, audio int64, track *Track) bool {
+	version, layer := frame[1]>>3&3, frame[1]>>1&3
+	bitrateIndex, rateIndex, mono := frame[2]>>4, frame[2]>>2&3, frame[3]>>6 == 3
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return false
+	}
+	// Of versions 2.5 (0), 2 (2) and 1 (3)
+	var rate, bitrate, samplesPerFrame int
+	switch version {
+	case 3:
+		rate, bitrate, samplesPerFrame = mpeg1Rates[rateIndex], mpeg1Bitrates[bitrateIndex], 1152
+	case 2:
+		rate, bitrate, samplesPerFrame = mpeg1Rates[rateIndex]/2, mpeg2Bitrates[bitrateIndex], 576
+	default:
+		rate, bitrate, samplesPerFrame = mpeg1Rates[rateIndex]/4, mpeg2Bitrates[bitrateIndex], 576
+	}
+	track.SampleRate, track.Bitrate = rate, bitrate*1000
+	track.Duration = time.Duration(audio * 8 * int64(time.Second) / int64(track.Bitrate))
+	// Xing headers are past side information, whose size depends on the version and channels
+	sideInfo := 17 // Of MPEG-1 mono, and of MPEG-2 and 2.5 stereo
+	switch {
+	case version == 3 && !mono:
+		sideInfo = 32
+	case version != 3 && mono:
+		sideInfo = 9
+	}
+	if xing := 4 + sideInfo; len(frame) >= xing+12 {
+		if id := string(frame[xing : xing+4]); (id == "Xing" || id == "Info") && frame[xing+7]&1 != 0 {
+			frames := int64(binary.BigEndian.Uint32(frame[xing+8:]))
+			if frames > 0 {
+				track.Duration = time.Duration(frames * int64(samplesPerFrame) * int64(time.Second) / int64(rate))
+				track.Bitrate = int(float64(audio*8) / track.Duration.Seconds())
+			}
+		}
+	}
+	return true
+}
+
+// id3v2Frames returns values of text frames of interest (of id3Tags) of the ID3v2 tag of the major version, by their
+// names as of Vorbis comments
+func id3v2Frames(version, flags byte, tag []byte) map[string]string {
+	tags := map[string]string{}
+	if flags&0x80 != 0 { // Unsynchronisation (of the whole tag, as of ID3v2.3)
+		tag = bytes.ReplaceAll(tag, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	} else if flags&0x40 != 0 && len(tag) >= 4 { // An extended header
+		n := int(binary.BigEndian.Uint32(tag))
+		if version == 4 {
+			n = int(syncsafe(tag)) - 4
+		}
+		if n < 0 || n+4 > len(tag) {
+			return tags
+		}
+		tag = tag[4+n:]
+	}
+	for len(tag) >= headerLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+		var n int
+		switch version {
+		case 2:
+			n = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			n = int(binary.BigEndian.Uint32(tag[4:]))
+		default:
+			n = int(syncsafe(tag[4:]))
+		}
+		if n < 0 || headerLen+n > len(tag) {
+			break
+		}
+		if name, ok := id3Tags[id]; ok && n > 0 && tags[name] == "" {
+			tags[name] = id3Text(tag[headerLen : headerLen+n])
+		}
+		tag = tag[headerLen+n:]
+	}
+	return tags
+}
+
+// id3Text decodes the value of a text frame, of the encoding of its first byte. Values of several strings (such as of
+// several artists, in ID3v2.4) are of the first of them.
+func id3Text(b []byte) string {
+	encoding, b := b[0], b[1:]
+	switch encoding {
+	case 1, 2: // UTF-16 (with a byte order mark), and UTF-16BE
+		order := binary.ByteOrder(binary.BigEndian)
+		if encoding == 1 && len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			b = b[2:]
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		s, _, _ := strings.Cut(string(b), "\x00")
+		return s
+	default:
+		s, _, _ := strings.Cut(string(b), "\x00")
+		return latin1(s)
+	}
+}
+
+// latin1 decodes a string of ISO-8859-1, of which every byte is the code point of a character
+func latin1(s string) string {
+	runes := make([]rune, len(s))
+	for i := range len(s) {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// syncsafe decodes a synchsafe integer of ID3v2, of 7 bits of each of 4 bytes
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
@@ -0,0 +1,226 @@
+// Package music finds copies of the same recordings across formats and bitrates, such as FLAC masters and MP3s
+// transcoded from them. Copies like those aren't duplicates, since their contents differ, so they're told by their
+// tags (of artists and titles) and durations instead, and the copy of the highest quality of each is told apart, as that
+// which is best kept.
+package music
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// Formats of tracks
+const (
+	FLAC = "flac"
+	MP3  = "mp3"
+)
+
+// Extensions of files that are read as tracks, and their formats
+var Extensions = map[string]string{".flac": FLAC, ".mp3": MP3}
+
+// errNoTags is returned for tracks without tags of their artists and titles
+var errNoTags = errors.New("no tags of the artist and title of the track")
+
+// Track is a copy of a recording, and what tells its quality
+type Track struct {
+	Path     string        `json:"path"`
+	Format   string        `json:"format"`
+	Artist   string        `json:"artist"`
+	Title    string        `json:"title"`
+	Album    string        `json:"album,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Bitrate is the average bitrate, in bits per second, of the whole file (of lossless formats too)
+	Bitrate    int `json:"bitrate"`
+	SampleRate int `json:"sampleRate"`
+	// BitDepth is the number of bits per sample, of lossless formats only
+	BitDepth int  `json:"bitDepth,omitempty"`
+	Lossless bool `json:"lossless"`
+	// Best is whether this is the copy of the highest quality of the recording (see Find)
+	Best bool `json:"best"`
+}
+
+// setTags sets the artist, title and album of the track that aren't set yet, from tags by names of Vorbis comments
+func (t *Track) setTags(tags map[string]string) {
+	for name, field := range map[string]*string{"ARTIST": &t.Artist, "TITLE": &t.Title, "ALBUM": &t.Album} {
+		if *field == "" {
+			*field = strings.TrimSpace(tags[name])
+		}
+	}
+}
+
+// Quality describes the quality of the track, e.g. "FLAC, 16-bit/44.1 kHz" or "MP3, 320 kbps"
+func (t Track) Quality() string {
+	if t.Lossless {
+		return fmt.Sprintf("%s, %d-bit/%.1f kHz", strings.ToUpper(t.Format), t.BitDepth, float64(t.SampleRate)/1000)
+	}
+	return fmt.Sprintf("%s, %d kbps", strings.ToUpper(t.Format), (t.Bitrate+500)/1000)
+}
+
+// better tells whether the quality of track a is higher than that of b: lossless tracks are better than lossy ones,
+// of which those of more bits per sample (of lossless ones) or of higher bitrates (of lossy ones) are better, and then
+// those of higher sample rates
+func better(a, b Track) bool {
+	if a.Lossless != b.Lossless {
+		return a.Lossless
+	}
+	if a.Lossless && a.BitDepth != b.BitDepth {
+		return a.BitDepth > b.BitDepth
+	}
+	if !a.Lossless && a.Bitrate != b.Bitrate {
+		return a.Bitrate > b.Bitrate
+	}
+	return a.SampleRate > b.SampleRate
+}
+
+// Read reads tags and properties of the stream of the track at path of fsys
+func Read(fsys vfs.FS, path string) (Track, error) {
+	format, ok := Extensions[utils.GetFileExt(path)]
+	if !ok {
+		return Track{}, fmt.Errorf("unknown format of track %q", path)
+	}
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return Track{}, err
+	}
+	f, err := vfs.OpenFile(fsys, path)
+	if err != nil {
+		return Track{}, err
+	}
+	defer f.Close()
+	var track Track
+	if format == FLAC {
+		track, err = readFLAC(f, info.Size())
+	} else {
+		track, err = readMP3(f, info.Size())
+	}
+	if err != nil {
+		return Track{}, err
+	}
+	if track.Artist == "" || track.Title == "" {
+		return Track{}, errNoTags
+	}
+	track.Path = path
+	return track, nil
+}
+
+// Collect reads tracks (files of Extensions) of directories of fsys with workers reading them concurrently. Tracks that
+// can't be read, such as those without tags of their artists and titles, are passed to skipped, and left out.
+func Collect(ctx context.Context, fsys vfs.FS, directories []string, workers int,
+	skipped func(path string, err error),
+) ([]Track, error) {
+	fsys = vfs.WithContext(fsys, ctx)
+	paths := make(chan string)
+	var (
+		mx     sync.Mutex
+		tracks []Track
+		wg     sync.WaitGroup
+	)
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				track, err := Read(fsys, path)
+				mx.Lock()
+				if err != nil {
+					skipped(path, err)
+				} else {
+					tracks = append(tracks, track)
+				}
+				mx.Unlock()
+			}
+		}()
+	}
+	var err error
+	for _, dir := range directories {
+		if err = vfs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if _, isTrack := Extensions[utils.GetFileExt(path)]; d.Type().IsRegular() && isTrack {
+				paths <- path
+			}
+			return nil
+		}); err != nil {
+			break
+		}
+	}
+	close(paths)
+	wg.Wait()
+	return tracks, err
+}
+
+// Recording is copies of the same recording, the copy of the highest quality first
+type Recording []Track
+
+// Find finds recordings of which there are at least 2 copies: tracks of the same artist and title (whatever their
+// case, Unicode normalization and spacing), each of a duration within tolerance of the next shortest one, as durations
+// of copies differ a little by how they were encoded. The best of the copies of each is marked as Best. Recordings are
+// in order of their artists and titles.
+func Find(tracks []Track, tolerance time.Duration) []Recording {
+	byTags := map[string][]Track{}
+	for _, track := range tracks {
+		key := fold(track.Artist) + "\x00" + fold(track.Title)
+		byTags[key] = append(byTags[key], track)
+	}
+	var recordings []Recording
+	for _, copies := range byTags {
+		sort.Slice(copies, func(i, j int) bool {
+			if copies[i].Duration != copies[j].Duration {
+				return copies[i].Duration < copies[j].Duration
+			}
+			return copies[i].Path < copies[j].Path
+		})
+		start := 0
+		for i := 1; i <= len(copies); i++ {
+			if i < len(copies) && copies[i].Duration-copies[i-1].Duration <= tolerance {
+				continue
+			}
+			if i-start > 1 {
+				recordings = append(recordings, newRecording(copies[start:i]))
+			}
+			start = i
+		}
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		a, b := recordings[i][0], recordings[j][0]
+		if fa, fb := fold(a.Artist), fold(b.Artist); fa != fb {
+			return fa < fb
+		}
+		if fa, fb := fold(a.Title), fold(b.Title); fa != fb {
+			return fa < fb
+		}
+		return a.Path < b.Path
+	})
+	return recordings
+}
+
+// newRecording returns a recording of copies, sorted by their quality (and then by their paths), the best one marked
+func newRecording(copies []Track) Recording {
+	recording := append(Recording(nil), copies...)
+	sort.Slice(recording, func(i, j int) bool {
+		if better(recording[i], recording[j]) || better(recording[j], recording[i]) {
+			return better(recording[i], recording[j])
+		}
+		return recording[i].Path < recording[j].Path
+	})
+	recording[0].Best = true
+	return recording
+}
+
+// fold folds a tag for comparisons, so that tags that only differ by case, normalization or spacing are the same
+func fold(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(utils.NormalizeName(tag)), " "))
+}
@@ -0,0 +1,170 @@
+package music
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// flac returns a FLAC of a Vorbis comment of fields, and of samples of rate and of bits per sample, whose frames are
+// of audio bytes (of zeros)
+func flac(fields []string, rate, bits int, samples uint64, audio int) []byte {
+	b := []byte("fLaC")
+	// STREAMINFO, of 2 channels
+	b = append(b, flacStreamInfo, 0, 0, 34)
+	info := make([]byte, 34)
+	info[10], info[11] = byte(rate>>12), byte(rate>>4)
+	info[12] = byte(rate&0x0f)<<4 | 1<<1 | byte((bits-1)>>4)
+	info[13] = byte((bits-1)&0x0f)<<4 | byte(samples>>32&0x0f)
+	binary.BigEndian.PutUint32(info[14:], uint32(samples))
+	b = append(b, info...)
+	comment := binary.LittleEndian.AppendUint32(nil, 6)
+	comment = append(comment, "tester"...)
+	comment = binary.LittleEndian.AppendUint32(comment, uint32(len(fields)))
+	for _, field := range fields {
+		comment = binary.LittleEndian.AppendUint32(comment, uint32(len(field)))
+		comment = append(comment, field...)
+	}
+	b = append(b, 0x80|flacVorbisComment, byte(len(comment)>>16), byte(len(comment)>>8), byte(len(comment)))
+	b = append(append(b, comment...), make([]byte, audio)...)
+	return b
+}
+
+// id3v2 returns an ID3v2 tag of the major version (3 or 4) of text frames, whose values are of their encodings
+func id3v2(version byte, frames ...string) []byte {
+	var body []byte
+	for i := 0; i < len(frames); i += 2 {
+		body = append(body, frames[i]...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(frames[i+1])))
+		body = append(append(body, 0, 0), frames[i+1]...)
+	}
+	n := len(body)
+	return append([]byte{'I', 'D', '3', version, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f),
+		byte(n >> 7 & 0x7f), byte(n & 0x7f)}, body...)
+}
+
+// mp3 returns frames of MPEG-1 layer III, of 44.1 kHz stereo of bitrateIndex (of mpeg1Bitrates), preceded by tag. The
+// first frame is of a Xing header of frames if xingFrames isn't 0.
+func mp3(tag []byte, bitrateIndex byte, frames, xingFrames int) []byte {
+	size := 144 * mpeg1Bitrates[bitrateIndex] * 1000 / 44100
+	b := append([]byte{}, tag...)
+	for i := range frames {
+		frame := make([]byte, size)
+		copy(frame, []byte{0xff, 0xfb, bitrateIndex << 4, 0})
+		if i == 0 && xingFrames != 0 {
+			copy(frame[36:], "Xing\x00\x00\x00\x01")
+			binary.BigEndian.PutUint32(frame[44:], uint32(xingFrames))
+		}
+		b = append(b, frame...)
+	}
+	return b
+}
+
+func TestReadFLAC(t *testing.T) {
+	b := flac([]string{"artist=The Band", "TITLE=Song", "ARTIST=Someone Else", "Album=Album"}, 96000, 24,
+		96000*180, 1000)
+	track, err := readFLAC(bytes.NewReader(b), int64(len(b)))
+	assert.Nil(t, err)
+	assert.Equal(t, Track{Format: FLAC, Artist: "The Band", Title: "Song", Album: "Album", Duration: 180 * time.Second,
+		Bitrate: len(b) * 8 / 180, SampleRate: 96000, BitDepth: 24, Lossless: true}, track)
+	assert.Equal(t, "FLAC, 24-bit/96.0 kHz", track.Quality())
+	_, err = readFLAC(bytes.NewReader([]byte("not a flac")), 10)
+	assert.NotNil(t, err)
+}
+
+func TestReadMP3(t *testing.T) {
+	// A CBR stream, of ID3v2.3 of ISO-8859-1
+	b := mp3(id3v2(3, "TPE1", "\x00The Band", "TIT2", "\x00Caf\xe9"), 9, 100, 0)
+	track, err := readMP3(bytes.NewReader(b), int64(len(b)))
+	assert.Nil(t, err)
+	assert.Equal(t, "The Band", track.Artist)
+	assert.Equal(t, "Café", track.Title)
+	assert.Equal(t, 128000, track.Bitrate)
+	assert.Equal(t, 44100, track.SampleRate)
+	assert.Equal(t, time.Duration(100*417*8)*time.Second/128000, track.Duration)
+	assert.False(t, track.Lossless)
+	assert.Equal(t, "MP3, 128 kbps", track.Quality())
+
+	// A VBR stream, of ID3v2.4 of UTF-8, whose duration is of frames of its Xing header
+	b = mp3(id3v2(4, "TPE1", "\x03The Band\x00Someone Else", "TIT2", "\x03Café"), 9, 10, 1000)
+	track, err = readMP3(bytes.NewReader(b), int64(len(b)))
+	assert.Nil(t, err)
+	assert.Equal(t, "The Band", track.Artist)
+	assert.Equal(t, "Café", track.Title)
+	assert.Equal(t, 1000*1152*time.Second/44100, track.Duration)
+
+	// ID3v1 only, which isn't audio
+	v1 := make([]byte, 128)
+	copy(v1, "TAG")
+	copy(v1[3:], "Song")
+	copy(v1[33:], "The Band")
+	b = append(mp3(nil, 14, 10, 0), v1...)
+	track, err = readMP3(bytes.NewReader(b), int64(len(b)))
+	assert.Nil(t, err)
+	assert.Equal(t, "The Band", track.Artist)
+	assert.Equal(t, "Song", track.Title)
+	assert.Equal(t, time.Duration(10*1044*8)*time.Second/320000, track.Duration)
+
+	_, err = readMP3(bytes.NewReader(make([]byte, 1000)), 1000)
+	assert.NotNil(t, err)
+}
+
+func TestFind(t *testing.T) {
+	tracks := []Track{
+		{Path: "mp3/128/song.mp3", Artist: "the band", Title: "Song ", Duration: 179900 * time.Millisecond,
+			Bitrate: 128000, SampleRate: 44100},
+		{Path: "flac/song.flac", Artist: "The Band", Title: "Song", Duration: 180 * time.Second, Bitrate: 900000,
+			SampleRate: 44100, BitDepth: 16, Lossless: true},
+		{Path: "mp3/320/song.mp3", Artist: "The  Band", Title: "song", Duration: 180500 * time.Millisecond,
+			Bitrate: 320000, SampleRate: 44100},
+		// An extended mix, of the same tags
+		{Path: "mp3/320/song-extended.mp3", Artist: "The Band", Title: "Song", Duration: 6 * time.Minute,
+			Bitrate: 320000, SampleRate: 44100},
+		{Path: "b/another.mp3", Artist: "Another", Title: "Tune", Duration: time.Minute, Bitrate: 192000,
+			SampleRate: 44100},
+		{Path: "a/another.mp3", Artist: "Another", Title: "Tune", Duration: time.Minute, Bitrate: 192000,
+			SampleRate: 44100},
+	}
+	recordings := Find(tracks, 2*time.Second)
+	assert.Len(t, recordings, 2)
+	assert.Equal(t, []string{"a/another.mp3", "b/another.mp3"}, paths(recordings[0]))
+	assert.Equal(t, []bool{true, false}, []bool{recordings[0][0].Best, recordings[0][1].Best})
+	assert.Equal(t, []string{"flac/song.flac", "mp3/320/song.mp3", "mp3/128/song.mp3"}, paths(recordings[1]))
+	assert.True(t, recordings[1][0].Best)
+	assert.False(t, recordings[1][1].Best)
+	assert.Len(t, Find(tracks, 50*time.Millisecond), 1)
+}
+
+func TestCollect(t *testing.T) {
+	tag := id3v2(3, "TPE1", "\x00The Band", "TIT2", "\x00Song")
+	fsys := fstest.MapFS{
+		"m/flac/song.flac":   {Data: flac([]string{"ARTIST=The Band", "TITLE=Song"}, 44100, 16, 44100*2, 1000)},
+		"m/mp3/song.MP3":     {Data: mp3(tag, 9, 77, 0)},
+		"m/mp3/untagged.mp3": {Data: mp3(nil, 9, 77, 0)},
+		"m/notes.txt":        {Data: []byte("not a track")},
+	}
+	var skipped []string
+	tracks, err := Collect(context.Background(), vfs.FromFS(fsys), []string{"m"}, 2, func(path string, err error) {
+		assert.ErrorIs(t, err, errNoTags)
+		skipped = append(skipped, path)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"m/mp3/untagged.mp3"}, skipped)
+	recordings := Find(tracks, time.Second)
+	assert.Len(t, recordings, 1)
+	assert.Equal(t, []string{"m/flac/song.flac", "m/mp3/song.MP3"}, paths(recordings[0]))
+}
+
+func paths(recording Recording) []string {
+	var paths []string
+	for _, track := range recording {
+		paths = append(paths, track.Path)
+	}
+	return paths
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+)
+
+// Limits of lengths of text in messages of chat services
+const (
+	slackSectionLimit       = 3000
+	discordDescriptionLimit = 4096
+)
+
+// Colors of embeds in Discord messages
+const (
+	discordColorCompleted = 0x2eb67d
+	discordColorFailed    = 0xe01e5a
+)
+
+// Slack posts summaries to an incoming webhook of Slack
+type Slack struct {
+	URL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts s as a message to the webhook
+func (sl Slack) Notify(ctx context.Context, s Summary) error {
+	type text struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type block struct {
+		Type string `json:"type"`
+		Text text   `json:"text"`
+	}
+	body, err := json.Marshal(struct {
+		Text   string  `json:"text"`
+		Blocks []block `json:"blocks"`
+	}{
+		Text: s.Title(),
+		Blocks: []block{
+			{Type: "header", Text: text{Type: "plain_text", Text: s.Title()}},
+			{Type: "section", Text: text{Type: "mrkdwn", Text: truncate(s.markdown("*", "•"), slackSectionLimit)}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, sl.Client, sl.URL, body)
+}
+
+// Discord posts summaries to a webhook of a Discord channel
+type Discord struct {
+	URL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts s as a message to the webhook
+func (d Discord) Notify(ctx context.Context, s Summary) error {
+	type embed struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Color       int    `json:"color"`
+		Timestamp   string `json:"timestamp"`
+	}
+	color := discordColorCompleted
+	if s.Error != "" {
+		color = discordColorFailed
+	}
+	body, err := json.Marshal(struct {
+		Username string  `json:"username"`
+		Embeds   []embed `json:"embeds"`
+	}{
+		Username: "go-find-duplicates",
+		Embeds: []embed{{Title: s.Title(), Description: truncate(s.markdown("**", "-"), discordDescriptionLimit),
+			Color: color, Timestamp: s.FinishedAt.Format(time.RFC3339)}},
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, d.Client, d.URL, body)
+}
+
+// markdown is a summary in the markdown of chat services, in which text is made bold by enclosing it in bold, and
+// items of lists start with bullet
+func (s Summary) markdown(bold, bullet string) string {
+	var sb strings.Builder
+	dirs := make([]string, 0, len(s.Directories))
+	for _, dir := range s.Directories {
+		dirs = append(dirs, code(dir))
+	}
+	fmt.Fprintf(&sb, "Scan %s of %s on %s ", code(s.RunID), strings.Join(dirs, ", "), s.Host)
+	if s.Error != "" {
+		fmt.Fprintf(&sb, "failed after %v: %s\n", s.FinishedAt.Sub(s.StartedAt).Round(time.Second), s.Error)
+	} else {
+		fmt.Fprintf(&sb, "completed in %v.\n", s.FinishedAt.Sub(s.StartedAt).Round(time.Second))
+	}
+	if len(s.Labels) > 0 {
+		fmt.Fprintf(&sb, "Labels: %s\n", code(s.Labels.String()))
+	}
+	if s.Error != "" {
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Found %d duplicates (in %d groups) among %d files. A total of %s%s%s can be saved by removing "+
+		"them.\n", s.DuplicateCount, s.Groups, s.Files, bold, bytesutil.BinaryFormat(s.SavingsSize), bold)
+	if len(s.TopGroups) > 0 {
+		fmt.Fprintf(&sb, "%sTop groups:%s\n", bold, bold)
+		for _, g := range s.TopGroups {
+			fmt.Fprintf(&sb, "%s %d copies of %s (%s wasted): %s\n", bullet, len(g.Paths),
+				bytesutil.BinaryFormat(g.Size), bytesutil.BinaryFormat(g.Wasted), code(g.Paths[0]))
+		}
+	}
+	if s.ReportFile != "" {
+		fmt.Fprintf(&sb, "Report: %s\n", code(s.ReportFile))
+	}
+	return sb.String()
+}
+
+// code formats text as inline code (backticks in it, which can't be escaped, are replaced)
+func code(text string) string {
+	return "`" + strings.ReplaceAll(text, "`", "'") + "`"
+}
+
+// truncate shortens text to at most limit characters
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
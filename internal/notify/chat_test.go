@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receive serves a webhook that decodes messages posted to it into v
+func receive(t *testing.T, v any) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(v))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestSlack(t *testing.T) {
+	var msg struct {
+		Text   string
+		Blocks []struct {
+			Type string
+			Text struct{ Type, Text string }
+		}
+	}
+	server := receive(t, &msg)
+	defer server.Close()
+	assert.Nil(t, Slack{URL: server.URL}.Notify(context.Background(), summary))
+	assert.Equal(t, summary.Title(), msg.Text)
+	assert.Len(t, msg.Blocks, 2)
+	assert.Equal(t, "header", msg.Blocks[0].Type)
+	assert.Equal(t, "mrkdwn", msg.Blocks[1].Text.Type)
+	assert.Equal(t, "Scan `241231_235959` of `/photos`, `/backup` on nas completed in 1h0m0s.\n"+
+		"Found 12 duplicates (in 10 groups) among 1000 files. A total of *3.00 MiB* can be saved by removing them.\n"+
+		"*Top groups:*\n"+
+		"• 3 copies of 1.00 MiB (2.00 MiB wasted): `/backup/a.jpg`\n"+
+		"• 2 copies of 512.00 KiB (512.00 KiB wasted): `/backup/c.mp4`\n"+
+		"Report: `/reports/duplicates_241231_235959.txt`\n", msg.Blocks[1].Text.Text)
+}
+
+func TestDiscord(t *testing.T) {
+	var msg struct {
+		Username string
+		Embeds   []struct {
+			Title, Description, Timestamp string
+			Color                         int
+		}
+	}
+	server := receive(t, &msg)
+	defer server.Close()
+	assert.Nil(t, Discord{URL: server.URL}.Notify(context.Background(), summary))
+	assert.Equal(t, "go-find-duplicates", msg.Username)
+	assert.Len(t, msg.Embeds, 1)
+	assert.Equal(t, summary.Title(), msg.Embeds[0].Title)
+	assert.Equal(t, "2025-01-01T00:59:59Z", msg.Embeds[0].Timestamp)
+	assert.Equal(t, discordColorCompleted, msg.Embeds[0].Color)
+	assert.Contains(t, msg.Embeds[0].Description, "A total of **3.00 MiB** can be saved")
+	assert.Contains(t, msg.Embeds[0].Description, "- 3 copies of 1.00 MiB (2.00 MiB wasted): `/backup/a.jpg`\n")
+
+	failed := summary
+	failed.Error = "disk unplugged"
+	assert.Nil(t, Discord{URL: server.URL}.Notify(context.Background(), failed))
+	assert.Equal(t, discordColorFailed, msg.Embeds[0].Color)
+	assert.Contains(t, msg.Embeds[0].Description, "failed after 1h0m0s: disk unplugged")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 5))
+	assert.Equal(t, "äb…", truncate("äbcd", 3))
+	assert.Equal(t, 3000, len([]rune(truncate(strings.Repeat("x", 5000), 3000))))
+	assert.Equal(t, "`a'b`", code("a`b"))
+}
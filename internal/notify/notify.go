@@ -0,0 +1,234 @@
+// Package notify sends summaries of scans once they finish, so that long scans (e.g. scheduled ones on headless
+// machines) needn't be watched
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"go.uber.org/multierr"
+)
+
+// Summary is the outcome of a scan
+type Summary struct {
+	RunID       string    `json:"runId"`
+	Host        string    `json:"host"`
+	Directories []string  `json:"directories"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	// Labels are those given to the run by --label
+	Labels entity.Labels `json:"labels,omitempty"`
+	// Files is the number of files scanned
+	Files          int   `json:"files"`
+	Groups         int   `json:"groups"`
+	DuplicateCount int64 `json:"duplicateCount"`
+	SavingsSize    int64 `json:"savingsSize"`
+	// TopGroups are the groups of duplicates that waste the most space
+	TopGroups []Group `json:"topGroups,omitempty"`
+	// ReportFile is where the report of duplicates was saved (empty if it wasn't saved to a file)
+	ReportFile string `json:"reportFile,omitempty"`
+	// Error is why the scan failed (empty if it didn't)
+	Error string `json:"error,omitempty"`
+}
+
+// Group is a group of duplicates in a Summary
+type Group struct {
+	Size int64 `json:"size"`
+	// Wasted is the space taken by all copies except one
+	Wasted int64    `json:"wasted"`
+	Paths  []string `json:"paths"`
+}
+
+// TopGroups returns at most n groups of duplicates, those that waste the most space
+func TopGroups(duplicates *entity.DigestToFiles, n int) []Group {
+	if duplicates == nil {
+		return nil
+	}
+	var groups []Group
+	for digest, paths := range duplicates.All() {
+		sortedPaths := append([]string(nil), paths...)
+		sort.Strings(sortedPaths)
+		groups = append(groups, Group{Size: digest.FileSize, Wasted: digest.FileSize * int64(len(paths)-1),
+			Paths: sortedPaths})
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Wasted != groups[j].Wasted {
+			return groups[i].Wasted > groups[j].Wasted
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	if len(groups) > n {
+		groups = groups[:n]
+	}
+	return groups
+}
+
+// Title is a one-line summary
+func (s Summary) Title() string {
+	if s.Error != "" {
+		return fmt.Sprintf("go-find-duplicates on %s: scan failed", s.Host)
+	}
+	return fmt.Sprintf("go-find-duplicates on %s: %d duplicates found (%s can be saved)", s.Host,
+		s.DuplicateCount, bytesutil.BinaryFormat(s.SavingsSize))
+}
+
+// Text is a summary in plain text, of multiple lines
+func (s Summary) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Scan %s of %s on %s ", s.RunID, strings.Join(s.Directories, ", "), s.Host)
+	if s.Error != "" {
+		fmt.Fprintf(&sb, "failed after %v: %s\n", s.FinishedAt.Sub(s.StartedAt).Round(time.Second), s.Error)
+	} else {
+		fmt.Fprintf(&sb, "completed in %v.\n", s.FinishedAt.Sub(s.StartedAt).Round(time.Second))
+	}
+	if len(s.Labels) > 0 {
+		fmt.Fprintf(&sb, "Labels: %s\n", s.Labels)
+	}
+	if s.Error != "" {
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Found %d duplicates (in %d groups) among %d files. A total of %s can be saved by removing them.\n",
+		s.DuplicateCount, s.Groups, s.Files, bytesutil.BinaryFormat(s.SavingsSize))
+	if len(s.TopGroups) > 0 {
+		sb.WriteString("Top groups:\n")
+		for _, g := range s.TopGroups {
+			fmt.Fprintf(&sb, "  %d copies of %s (%s wasted): %s\n", len(g.Paths), bytesutil.BinaryFormat(g.Size),
+				bytesutil.BinaryFormat(g.Wasted), g.Paths[0])
+		}
+	}
+	if s.ReportFile != "" {
+		fmt.Fprintf(&sb, "Report: %s\n", s.ReportFile)
+	}
+	return sb.String()
+}
+
+// Notifier sends summaries of scans
+type Notifier interface {
+	Notify(ctx context.Context, s Summary) error
+}
+
+// All sends s through all notifiers, returning all errors that occurred
+func All(ctx context.Context, notifiers []Notifier, s Summary) error {
+	var err error
+	for _, n := range notifiers {
+		err = multierr.Append(err, n.Notify(ctx, s))
+	}
+	return err
+}
+
+// Webhook posts summaries as JSON to a URL
+type Webhook struct {
+	URL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts s to the URL of the webhook
+func (w Webhook) Notify(ctx context.Context, s Summary) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Client, w.URL, body)
+}
+
+// post posts JSON body to url, failing unless the response is successful
+func post(ctx context.Context, client *http.Client, url string, body []byte) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Environment variables of settings of the SMTP server that emails are sent through
+const (
+	SMTPAddrEnv     = "FINDDUP_SMTP_ADDR"
+	SMTPUsernameEnv = "FINDDUP_SMTP_USERNAME"
+	SMTPPasswordEnv = "FINDDUP_SMTP_PASSWORD"
+	SMTPFromEnv     = "FINDDUP_SMTP_FROM"
+)
+
+// defaultSMTPPort is the port of the SMTP server if its address has none (that of submission, with STARTTLS)
+const defaultSMTPPort = "587"
+
+var (
+	getenv   = os.Getenv
+	sendMail = smtp.SendMail
+)
+
+// Email sends summaries by email, through an SMTP server (which is switched to TLS if it supports STARTTLS)
+type Email struct {
+	// Addr is the host and port of the SMTP server
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailFromEnv configures emails to be sent to recipients in to, through the SMTP server of the environment
+func EmailFromEnv(to []string) (Email, error) {
+	e := Email{Addr: getenv(SMTPAddrEnv), Username: getenv(SMTPUsernameEnv), Password: getenv(SMTPPasswordEnv),
+		From: getenv(SMTPFromEnv), To: to}
+	if e.Addr == "" {
+		return e, fmt.Errorf("address of the SMTP server to send emails through should be set in %s", SMTPAddrEnv)
+	}
+	if _, _, err := net.SplitHostPort(e.Addr); err != nil {
+		e.Addr = net.JoinHostPort(e.Addr, defaultSMTPPort)
+	}
+	if e.From == "" {
+		e.From = e.Username
+	}
+	if !strings.Contains(e.From, "@") {
+		return e, fmt.Errorf("sender of emails should be set in %s", SMTPFromEnv)
+	}
+	return e, nil
+}
+
+// Notify emails s to the recipients
+func (e Email) Notify(_ context.Context, s Summary) error {
+	if len(e.To) == 0 {
+		return errors.New("no recipients of email")
+	}
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.Addr)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", e.From, strings.Join(e.To, ", "),
+		s.Title(), s.FinishedAt.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(s.Text(), "\n", "\r\n"))
+	if err := sendMail(e.Addr, auth, e.From, e.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("couldn't send email: %w", err)
+	}
+	return nil
+}
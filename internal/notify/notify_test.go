@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+var summary = Summary{
+	RunID:          "241231_235959",
+	Host:           "nas",
+	Directories:    []string{"/photos", "/backup"},
+	StartedAt:      time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+	FinishedAt:     time.Date(2025, 1, 1, 0, 59, 59, 0, time.UTC),
+	Files:          1000,
+	Groups:         10,
+	DuplicateCount: 12,
+	SavingsSize:    3 * 1024 * 1024,
+	TopGroups: []Group{
+		{Size: 1024 * 1024, Wasted: 2 * 1024 * 1024, Paths: []string{"/backup/a.jpg", "/photos/a.jpg", "/photos/b.jpg"}},
+		{Size: 512 * 1024, Wasted: 512 * 1024, Paths: []string{"/backup/c.mp4", "/photos/c.mp4"}},
+	},
+	ReportFile: "/reports/duplicates_241231_235959.txt",
+}
+
+func TestSummary(t *testing.T) {
+	assert.Equal(t, "go-find-duplicates on nas: 12 duplicates found (3.00 MiB can be saved)", summary.Title())
+	assert.Equal(t, "Scan 241231_235959 of /photos, /backup on nas completed in 1h0m0s.\n"+
+		"Found 12 duplicates (in 10 groups) among 1000 files. A total of 3.00 MiB can be saved by removing them.\n"+
+		"Top groups:\n"+
+		"  3 copies of 1.00 MiB (2.00 MiB wasted): /backup/a.jpg\n"+
+		"  2 copies of 512.00 KiB (512.00 KiB wasted): /backup/c.mp4\n"+
+		"Report: /reports/duplicates_241231_235959.txt\n", summary.Text())
+	failed := Summary{RunID: "r", Host: "nas", Directories: []string{"/photos"}, StartedAt: summary.StartedAt,
+		FinishedAt: summary.StartedAt.Add(time.Minute), Error: "disk unplugged",
+		Labels: entity.Labels{"ticket": "OPS-1", "batch": "2"}}
+	assert.Equal(t, "go-find-duplicates on nas: scan failed", failed.Title())
+	assert.Equal(t, "Scan r of /photos on nas failed after 1m0s: disk unplugged\n"+
+		"Labels: batch=2, ticket=OPS-1\n", failed.Text())
+}
+
+func TestTopGroups(t *testing.T) {
+	duplicates := entity.NewDigestToFiles()
+	small := entity.FileDigest{FileExtension: ".txt", FileSize: 10, FileHash: "1"}
+	large := entity.FileDigest{FileExtension: ".jpg", FileSize: 100, FileHash: "2"}
+	many := entity.FileDigest{FileExtension: ".png", FileSize: 40, FileHash: "3"}
+	duplicates.Set(small, "/s2")
+	duplicates.Set(small, "/s1")
+	duplicates.Set(large, "/l1")
+	duplicates.Set(large, "/l2")
+	for _, path := range []string{"/m1", "/m2", "/m3", "/m4"} {
+		duplicates.Set(many, path)
+	}
+	assert.Equal(t, []Group{
+		{Size: 40, Wasted: 120, Paths: []string{"/m1", "/m2", "/m3", "/m4"}},
+		{Size: 100, Wasted: 100, Paths: []string{"/l1", "/l2"}},
+	}, TopGroups(duplicates, 2))
+	assert.Len(t, TopGroups(duplicates, 5), 3)
+	assert.Nil(t, TopGroups(nil, 5))
+}
+
+func TestWebhook(t *testing.T) {
+	var received Summary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	assert.Nil(t, Webhook{URL: server.URL}.Notify(context.Background(), summary))
+	assert.Equal(t, summary, received)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	err := All(context.Background(), []Notifier{Webhook{URL: failing.URL}, Webhook{URL: server.URL}}, summary)
+	assert.ErrorContains(t, err, "404 Not Found: no such hook")
+}
+
+func TestEmail(t *testing.T) {
+	defer func(old func(string) string) { getenv = old }(getenv)
+	env := map[string]string{}
+	getenv = func(name string) string { return env[name] }
+	_, err := EmailFromEnv([]string{"admin@example.com"})
+	assert.ErrorContains(t, err, SMTPAddrEnv)
+	env[SMTPAddrEnv] = "smtp.example.com"
+	_, err = EmailFromEnv([]string{"admin@example.com"})
+	assert.ErrorContains(t, err, SMTPFromEnv)
+	env[SMTPUsernameEnv] = "nas@example.com"
+	env[SMTPPasswordEnv] = "secret"
+	email, err := EmailFromEnv([]string{"admin@example.com", "ops@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, Email{Addr: "smtp.example.com:587", Username: "nas@example.com", Password: "secret",
+		From: "nas@example.com", To: []string{"admin@example.com", "ops@example.com"}}, email)
+
+	defer func(old func(string, smtp.Auth, string, []string, []byte) error) { sendMail = old }(sendMail)
+	var sent struct {
+		addr, from string
+		to         []string
+		msg        string
+		auth       smtp.Auth
+	}
+	sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent.addr, sent.auth, sent.from, sent.to, sent.msg = addr, auth, from, to, string(msg)
+		return nil
+	}
+	assert.Nil(t, email.Notify(context.Background(), summary))
+	assert.Equal(t, "smtp.example.com:587", sent.addr)
+	assert.NotNil(t, sent.auth)
+	assert.Equal(t, "nas@example.com", sent.from)
+	assert.Equal(t, email.To, sent.to)
+	assert.Contains(t, sent.msg, "To: admin@example.com, ops@example.com\r\n")
+	assert.Contains(t, sent.msg, "Subject: "+summary.Title()+"\r\n")
+	assert.Contains(t, sent.msg, "\r\n\r\nScan 241231_235959 of /photos, /backup on nas completed in 1h0m0s.\r\n")
+}
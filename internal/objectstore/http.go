@@ -0,0 +1,83 @@
+package objectstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPClient makes requests of backends not configured with clients of their own. Unlike http.DefaultClient, it
+// gives up on servers that don't respond: of connecting (and of TLS handshakes), and of headers of responses. Entire
+// requests aren't limited, since reading large objects in full takes as long as they're large, but are cancelled
+// along with scans (see vfs.ContextFS).
+var DefaultHTTPClient = newDefaultHTTPClient()
+
+func newDefaultHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Minute
+	return &http.Client{Transport: transport}
+}
+
+// maxErrorSize is the maximum size of bodies of unsuccessful responses that are read for their messages
+const maxErrorSize = 64 * 1024
+
+// StatusError returns the error of the status of an unsuccessful response, which fs.ErrNotExist matches for 404 Not
+// Found, and fs.ErrPermission for 401 Unauthorized and 403 Forbidden
+func StatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fs.ErrNotExist
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return fs.ErrPermission
+	default:
+		return errors.New(resp.Status)
+	}
+}
+
+// ResponseError returns the error of an unsuccessful response (see StatusError), after the message that describe
+// parses from its body (such as of an error document of an API), if there's any. The body is closed.
+func ResponseError(resp *http.Response, describe func(body []byte) string) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	err := StatusError(resp)
+	if message := strings.TrimSpace(describe(body)); message != "" {
+		err = fmt.Errorf("%s: %w", message, err)
+	}
+	return err
+}
+
+// RangeHeader is the value of HTTP header Range to read length bytes from offset (or all bytes from offset, if
+// length is negative). It's empty if the entire object is to be read.
+func RangeHeader(offset, length int64) string {
+	switch {
+	case length >= 0:
+		return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	case offset > 0:
+		return fmt.Sprintf("bytes=%d-", offset)
+	default:
+		return ""
+	}
+}
+
+// RangeBody returns the body of a successful response to a request with RangeHeader. Servers that don't support
+// ranges send the entire object, which is then skipped to offset and limited to length.
+func RangeBody(resp *http.Response, offset, length int64) (io.ReadCloser, error) {
+	if resp.StatusCode != http.StatusOK || RangeHeader(offset, length) == "" {
+		return resp.Body, nil
+	}
+	if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return resp.Body, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, length), resp.Body}, nil
+}
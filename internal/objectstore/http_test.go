@@ -0,0 +1,52 @@
+package objectstore
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeBody(t *testing.T) {
+	assert.Equal(t, "", RangeHeader(0, -1))
+	assert.Equal(t, "bytes=5-", RangeHeader(5, -1))
+	assert.Equal(t, "bytes=2-4", RangeHeader(2, 3))
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{{0, -1, "0123456789"}, {2, 3, "234"}, {7, -1, "789"}} {
+		// Servers that don't support ranges respond with the entire object
+		resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("0123456789"))}
+		body, err := RangeBody(resp, tc.offset, tc.length)
+		assert.Nil(t, err)
+		data, _ := io.ReadAll(body)
+		assert.Equal(t, tc.expected, string(data))
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	describe := func(body []byte) string { return string(body) }
+	for _, tc := range []struct {
+		status   int
+		body     string
+		expected error
+		message  string
+	}{
+		{http.StatusNotFound, "", fs.ErrNotExist, "file does not exist"},
+		{http.StatusForbidden, " AccessDenied \n", fs.ErrPermission, "AccessDenied: permission denied"},
+		{http.StatusUnauthorized, "expired token", fs.ErrPermission, "expired token: permission denied"},
+		{http.StatusInternalServerError, "", nil, "500 Internal Server Error"},
+	} {
+		resp := &http.Response{StatusCode: tc.status, Status: fmt.Sprintf("%d %s", tc.status,
+			http.StatusText(tc.status)), Body: io.NopCloser(strings.NewReader(tc.body))}
+		err := ResponseError(resp, describe)
+		if tc.expected != nil {
+			assert.ErrorIs(t, err, tc.expected)
+		}
+		assert.EqualError(t, err, tc.message)
+	}
+}
@@ -0,0 +1,284 @@
+// Package objectstore implements vfs.FS on top of object storage (such as buckets of cloud storage), in which
+// "directories" are common prefixes of keys of objects separated by "/". Backends only need to implement Client.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// Object is metadata of an object
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	// Checksums of contents of the object, by names of algorithms (same as names of hashers of package service)
+	Checksums map[string]string
+	// IsDir is set by clients of storage that has actual directories (such as WebDAV servers), when Head is of a
+	// directory
+	IsDir bool
+}
+
+// Client is a client of object storage. Errors for objects that don't exist must match fs.ErrNotExist. Requests are
+// cancelled once ctx is done, and bodies that Read returns stop being read then.
+type Client interface {
+	// List lists objects whose keys start with prefix and have no "/" after it, and common prefixes of keys that
+	// do (up to and including the "/"). fn is called for every page of results, until it returns false. At most
+	// limit results are listed, unless limit is 0.
+	List(ctx context.Context, prefix string, limit int, fn func(objects []Object, prefixes []string) bool) error
+	// Head gets metadata of an object
+	Head(ctx context.Context, key string) (Object, error)
+	// Read reads length bytes of an object starting at offset, or all bytes from offset if length is negative
+	Read(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// FS is a read-only file system of objects. Metadata of objects is remembered from listings, so that files found
+// while walking needn't be looked up again.
+type FS struct {
+	client Client
+	ctx    context.Context
+	// objects are shared by file systems of the same client bound to other contexts (see WithContext)
+	objects *objects
+}
+
+type objects struct {
+	mx sync.RWMutex
+	m  map[string]Object
+}
+
+// New creates FS of objects accessed through client
+func New(client Client) *FS {
+	return &FS{client: client, ctx: context.Background(), objects: &objects{m: map[string]Object{}}}
+}
+
+// WithContext returns f of requests cancelled once ctx is done (see vfs.ContextFS), such as once a scan is
+// cancelled, so that requests to storage that stopped responding don't hold the scan up
+func (f *FS) WithContext(ctx context.Context) vfs.FS {
+	return &FS{client: f.client, ctx: ctx, objects: f.objects}
+}
+
+// ID returns the identifier of the storage (see vfs.Identifier), which is that of the client, if it has one, and the
+// name of the type of the client otherwise
+func (f *FS) ID() string {
+	if i, ok := f.client.(vfs.Identifier); ok {
+		return i.ID()
+	}
+	return fmt.Sprintf("%T", f.client)
+}
+
+// key converts a name to the key of an object
+func key(name string) string {
+	if name == "." {
+		return ""
+	}
+	return strings.Trim(name, "/")
+}
+
+// ReadDir lists objects and "directories" in the named directory
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix := key(name)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var entries []fs.DirEntry
+	err := f.client.List(f.ctx, prefix, 0, func(objects []Object, prefixes []string) bool {
+		for _, p := range prefixes {
+			if dirName := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"); dirName != "" {
+				entries = append(entries, fs.FileInfoToDirEntry(&fileInfo{name: dirName, isDir: true}))
+			}
+		}
+		f.objects.mx.Lock()
+		defer f.objects.mx.Unlock()
+		for _, o := range objects {
+			fileName := strings.TrimPrefix(o.Key, prefix)
+			// Keys ending with "/" are placeholders of directories created by consoles of cloud providers
+			if fileName == "" || strings.HasSuffix(fileName, "/") {
+				continue
+			}
+			f.objects.m[o.Key] = o
+			entries = append(entries, fs.FileInfoToDirEntry(newFileInfo(o)))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// head gets metadata of an object, from the listings if it was listed
+func (f *FS) head(k string) (Object, error) {
+	f.objects.mx.RLock()
+	o, known := f.objects.m[k]
+	f.objects.mx.RUnlock()
+	if known {
+		return o, nil
+	}
+	if k == "" {
+		return Object{}, fs.ErrNotExist
+	}
+	o, err := f.client.Head(f.ctx, k)
+	if err != nil {
+		return Object{}, err
+	}
+	f.objects.mx.Lock()
+	f.objects.m[k] = o
+	f.objects.mx.Unlock()
+	return o, nil
+}
+
+// Stat gets metadata of an object, or of a "directory" if there are objects with keys prefixed by name and "/"
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	k := key(name)
+	o, err := f.head(k)
+	if err == nil {
+		if o.IsDir {
+			return &fileInfo{name: path.Base(k), isDir: true}, nil
+		}
+		return newFileInfo(o), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if k == "" {
+		return &fileInfo{name: ".", isDir: true}, nil
+	}
+	isDir := false
+	err = f.client.List(f.ctx, k+"/", 1, func(objects []Object, prefixes []string) bool {
+		isDir = len(objects) > 0 || len(prefixes) > 0
+		return false
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if !isDir {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return &fileInfo{name: path.Base(k), isDir: true}, nil
+}
+
+// Lstat is the same as Stat, since there are no symbolic links in object storage
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	return f.Stat(name)
+}
+
+// Open opens an object for reading. Reads at arbitrary offsets are done through range requests, so that reading
+// only a few parts of an object doesn't download all of it.
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{client: f.client, ctx: f.ctx, name: name, info: info.(*fileInfo)}, nil
+}
+
+// Checksum returns the checksum of an object by the algorithm, if the object storage has it
+func (f *FS) Checksum(name, algorithm string) (string, bool) {
+	o, err := f.head(key(name))
+	if err != nil || o.IsDir {
+		return "", false
+	}
+	checksum, known := o.Checksums[algorithm]
+	return checksum, known && checksum != ""
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func newFileInfo(o Object) *fileInfo {
+	return &fileInfo{name: path.Base(o.Key), size: o.Size, modTime: o.ModTime}
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.isDir }
+func (i *fileInfo) Sys() any           { return nil }
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// file is an open object. Sequential reads stream the object in a single request.
+type file struct {
+	client Client
+	ctx    context.Context
+	name   string
+	info   *fileInfo
+	body   io.ReadCloser
+	closed bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if f.info.isDir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.body == nil {
+		body, err := f.client.Read(f.ctx, key(f.name), 0, -1)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.body = body
+	}
+	return f.body.Read(p)
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	length := min(int64(len(p)), f.info.size-off)
+	body, err := f.client.Read(f.ctx, key(f.name), off, length)
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:length])
+	if err != nil {
+		return n, fmt.Errorf("couldn't read %s: %w", f.name, err)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+// Package restapi serves a REST API through which scans are run, their progress polled, their reports fetched and
+// their duplicates acted upon
+package restapi
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/scans"
+)
+
+// maxRequestSize is the maximum size of bodies of requests
+const maxRequestSize = bytesutil.MEBI
+
+// NewHandler creates a handler of the REST API, which runs scans through m. If apiKey isn't empty, requests must
+// carry it as a bearer token in their Authorization header. Otherwise, requests must be of loopback hosts (see
+// isLoopbackHost), so that websites of other hosts open in browsers can't reach the API by rebinding their names to
+// loopback addresses. Bodies of requests must be JSON, as their Content-Type header must say, so that websites can't
+// post them from forms (or by requests of other types that browsers send without asking the API first).
+//
+// Endpoints are:
+//
+//	POST   /api/v1/scans                  starts a scan (body is a scans.Request)
+//	GET    /api/v1/scans                  lists scans
+//	GET    /api/v1/scans/{id}             returns progress of a scan
+//	DELETE /api/v1/scans/{id}             removes a scan, first cancelling it if it's running
+//	GET    /api/v1/scans/{id}/report      returns groups of duplicates of a completed scan (?format=csv for CSV)
+//	POST   /api/v1/scans/{id}/actions     acts upon duplicates of a completed scan (body is an ActRequest)
+func NewHandler(m *scans.Manager, apiKey string) http.Handler {
+	h := &handler{scans: m}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/scans", h.startScan)
+	mux.HandleFunc("GET /api/v1/scans", h.listScans)
+	mux.HandleFunc("GET /api/v1/scans/{id}", h.getScan)
+	mux.HandleFunc("DELETE /api/v1/scans/{id}", h.deleteScan)
+	mux.HandleFunc("GET /api/v1/scans/{id}/report", h.getReport)
+	mux.HandleFunc("POST /api/v1/scans/{id}/actions", h.act)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" && !isLoopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host %q isn't a loopback host", r.Host))
+			return
+		}
+		if apiKey != "" {
+			token, isBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !isBearer || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid API key"))
+				return
+			}
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); r.Method == http.MethodPost &&
+			mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("bodies of requests should be application/json"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost checks whether host (of a request, with or without a port) is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return strings.EqualFold(host, "localhost")
+}
+
+// ActRequest is an action on duplicates of a scan. Deleting isn't allowed through the API, so that files
+// acted upon can be recovered.
+type ActRequest struct {
+	// Action is one of trash, hardlink, symlink and reflink
+	Action string `json:"action"`
+	// Keep is the policy that chooses which file of a group is kept (defaults to first)
+	Keep string `json:"keep,omitempty"`
+	// DryRun reports what would be done, without doing it
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// ActResponse is the outcome of an action on duplicates of a scan
+type ActResponse struct {
+	Action        string      `json:"action"`
+	DryRun        bool        `json:"dryRun"`
+	Records       []ActRecord `json:"records"`
+	Succeeded     int         `json:"succeeded"`
+	Failed        int         `json:"failed"`
+	ReclaimedSize int64       `json:"reclaimedSize"`
+}
+
+// ActRecord is the outcome of an action on a file
+type ActRecord struct {
+	Path string `json:"path"`
+	Kept string `json:"kept"`
+	Size int64  `json:"size"`
+	// Error is why the action failed on this file
+	Error string `json:"error,omitempty"`
+}
+
+// Scan is progress of a scan, as served by the API
+type Scan struct {
+	ID              string     `json:"id"`
+	State           string     `json:"state"`
+	Directories     []string   `json:"directories"`
+	StartedAt       time.Time  `json:"startedAt"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	FilesDiscovered int64      `json:"filesDiscovered"`
+	FilesHashed     int64      `json:"filesHashed"`
+	GroupsFound     int64      `json:"groupsFound"`
+	Errors          int64      `json:"errors"`
+	Error           string     `json:"error,omitempty"`
+	DuplicateCount  int64      `json:"duplicateCount"`
+	SavingsSize     int64      `json:"savingsSize"`
+}
+
+// Report is a report of a completed scan, as served by the API
+type Report struct {
+	Scan   Scan                    `json:"scan"`
+	Groups []entity.DuplicateGroup `json:"groups"`
+}
+
+type handler struct {
+	scans *scans.Manager
+}
+
+func (h *handler) startScan(w http.ResponseWriter, r *http.Request) {
+	var req scans.Request
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	scan, err := h.scans.StartRequest(req)
+	if errors.Is(err, scans.ErrNotAllowed) {
+		writeError(w, http.StatusForbidden, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/scans/"+scan.ID)
+	writeJSON(w, http.StatusAccepted, toScan(scan))
+}
+
+func (h *handler) listScans(w http.ResponseWriter, _ *http.Request) {
+	list := []Scan{}
+	for _, scan := range h.scans.List() {
+		list = append(list, toScan(scan))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *handler) getScan(w http.ResponseWriter, r *http.Request) {
+	scan, err := h.scans.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toScan(scan))
+}
+
+func (h *handler) deleteScan(w http.ResponseWriter, r *http.Request) {
+	if err := h.scans.Delete(r.PathValue("id")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) getReport(w http.ResponseWriter, r *http.Request) {
+	scan, err := h.scans.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	result, err := scan.Result()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	groups := []entity.DuplicateGroup{}
+	if result.Duplicates != nil {
+		for digest, paths := range result.Duplicates.All() {
+			sortedPaths := append([]string(nil), paths...)
+			sort.Strings(sortedPaths)
+			groups = append(groups, entity.DuplicateGroup{Digest: digest, Paths: sortedPaths})
+		}
+	}
+	if r.URL.Query().Get("format") != "csv" && !strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeJSON(w, http.StatusOK, Report{Scan: toScan(scan), Groups: groups})
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=duplicates_%s.csv", scan.ID))
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"file hash", "file size", "last modified", "file path", "strong hash"})
+	for _, group := range groups {
+		for _, path := range group.Paths {
+			_ = cw.Write([]string{
+				group.Digest.FileHash,
+				strconv.FormatInt(group.Digest.FileSize, 10),
+				result.AllFiles[path].Modified.Format(time.RFC3339Nano),
+				path,
+				group.Digest.StrongHash,
+			})
+		}
+	}
+	cw.Flush()
+}
+
+func (h *handler) act(w http.ResponseWriter, r *http.Request) {
+	var req ActRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	action, err := actions.ActionByName(strings.ToLower(req.Action))
+	if err == nil && action == actions.Delete {
+		err = fmt.Errorf("action %s isn't allowed through the API (%s duplicates instead)", action, actions.Trash)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var keep actions.KeepPolicy = actions.KeepFirst
+	if req.Keep != "" {
+		if keep, err = actions.KeepPolicyByName(strings.ToLower(req.Keep)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	scan, err := h.scans.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	report, err := scan.Act(actions.Options{Keep: keep, Action: action, DryRun: req.DryRun})
+	if errors.Is(err, actions.ErrTrashFull) {
+		writeError(w, http.StatusInsufficientStorage, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	resp := ActResponse{Action: action.String(), DryRun: report.DryRun, Records: []ActRecord{},
+		Succeeded: report.Succeeded, Failed: report.Failed, ReclaimedSize: report.ReclaimedSize}
+	for _, record := range report.Records {
+		r := ActRecord{Path: record.Path, Kept: record.Kept, Size: record.Size}
+		if record.Err != nil {
+			r.Error = record.Err.Error()
+		}
+		resp.Records = append(resp.Records, r)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	return nil
+}
+
+func toScan(scan *scans.Scan) Scan {
+	progress := scan.Progress()
+	s := Scan{
+		ID:              scan.ID,
+		State:           progress.State.String(),
+		Directories:     scan.Directories,
+		StartedAt:       scan.StartedAt,
+		FilesDiscovered: progress.FilesDiscovered,
+		FilesHashed:     progress.FilesHashed,
+		GroupsFound:     progress.GroupsFound,
+		Errors:          progress.Errors,
+		DuplicateCount:  progress.DuplicateCount,
+		SavingsSize:     progress.SavingsSize,
+	}
+	if !progress.FinishedAt.IsZero() {
+		s.FinishedAt = &progress.FinishedAt
+	}
+	if progress.Err != nil {
+		s.Error = progress.Err.Error()
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,138 @@
+package restapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/scans"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func call(t *testing.T, server *httptest.Server, method, path, body string, v any) *http.Response {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer key")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp
+}
+
+// TestHandler checks whether a scan is started and polled, its report fetched and its duplicates acted upon
+func TestHandler(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "a.jpg"), content, 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "b.jpg"), content, 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "c.jpg"), []byte("unique"), 0o644))
+	fmte.Off()
+	m := scans.NewManager(vfs.NewMux(vfs.Local), nil, scans.Limits{}, service.WithFileSizeThreshold(1))
+	defer m.Close()
+	server := httptest.NewServer(NewHandler(m, "key"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/scans")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	var errResp map[string]string
+	resp = call(t, server, "POST", "/api/v1/scans", `{"directories":["`+dir+`/missing"]}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, errResp["error"], "isn't a readable directory")
+	resp = call(t, server, "GET", "/api/v1/scans/missing", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var scan Scan
+	resp = call(t, server, "POST", "/api/v1/scans", `{"directories":["`+dir+`"],"verify":"sha256"}`, &scan)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "/api/v1/scans/"+scan.ID, resp.Header.Get("Location"))
+	found, err := m.Get(scan.ID)
+	assert.Nil(t, err)
+	<-found.Done()
+	call(t, server, "GET", "/api/v1/scans/"+scan.ID, "", &scan)
+	assert.Equal(t, "completed", scan.State)
+	assert.Equal(t, int64(3), scan.FilesDiscovered)
+	assert.Equal(t, int64(1), scan.DuplicateCount)
+	var list []Scan
+	call(t, server, "GET", "/api/v1/scans", "", &list)
+	assert.Len(t, list, 1)
+
+	var report Report
+	call(t, server, "GET", "/api/v1/scans/"+scan.ID+"/report", "", &report)
+	assert.Len(t, report.Groups, 1)
+	assert.Equal(t, []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")}, report.Groups[0].Paths)
+	assert.Equal(t, "sha256", report.Groups[0].Digest.StrongAlgorithm)
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/scans/"+scan.ID+"/report?format=csv", nil)
+	req.Header.Set("Authorization", "Bearer key")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	_ = resp.Body.Close()
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, filepath.Join(dir, "b.jpg"), records[2][3])
+
+	resp = call(t, server, "POST", "/api/v1/scans/"+scan.ID+"/actions", `{"action":"delete"}`, &errResp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, errResp["error"], "isn't allowed")
+	var actResp ActResponse
+	resp = call(t, server, "POST", "/api/v1/scans/"+scan.ID+"/actions", `{"action":"hardlink","keep":"first"}`,
+		&actResp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, actResp.Succeeded)
+	assert.Equal(t, filepath.Join(dir, "b.jpg"), actResp.Records[0].Path)
+	a, _ := os.Stat(filepath.Join(dir, "a.jpg"))
+	b, _ := os.Stat(filepath.Join(dir, "b.jpg"))
+	assert.True(t, os.SameFile(a, b))
+
+	resp = call(t, server, "DELETE", "/api/v1/scans/"+scan.ID, "", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = call(t, server, "GET", "/api/v1/scans/"+scan.ID, "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = call(t, server, "DELETE", "/api/v1/scans/"+scan.ID, "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// TestHandlerOfBrowsers checks whether requests that websites open in browsers could send are refused: of other hosts
+// (whose names are rebound to loopback addresses) if there's no API key, and of bodies other than JSON
+func TestHandlerOfBrowsers(t *testing.T) {
+	fmte.Off()
+	m := scans.NewManager(vfs.NewMux(vfs.Local), nil, scans.Limits{}, service.WithFileSizeThreshold(1))
+	defer m.Close()
+	server := httptest.NewServer(NewHandler(m, ""))
+	defer server.Close()
+	request := func(host, contentType string) int {
+		req, err := http.NewRequest("POST", server.URL+"/api/v1/scans", strings.NewReader(`{"directories":[]}`))
+		assert.Nil(t, err)
+		req.Host = host
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, request("attacker.example:8080", "application/json"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, request("localhost:8080", "text/plain"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, request("127.0.0.1", ""))
+	assert.Equal(t, http.StatusBadRequest, request("[::1]:8080", "application/json; charset=utf-8"))
+	assert.Equal(t, http.StatusBadRequest, request("LOCALHOST", "application/json"))
+
+	assert.True(t, isLoopbackHost("127.0.0.2:80"))
+	assert.False(t, isLoopbackHost("10.0.0.1:80"))
+	assert.False(t, isLoopbackHost("localhost.attacker.example"))
+}
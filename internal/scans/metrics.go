@@ -0,0 +1,43 @@
+package scans
+
+import (
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/pkg/metrics"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// Metrics are counters of scans and actions of a Manager, along with metrics of the scans themselves (which
+// accumulate across scans)
+type Metrics struct {
+	Scan             *service.ScanMetrics
+	ScansStarted     *metrics.Counter
+	ScansFailed      *metrics.Counter
+	ActionsSucceeded *metrics.Counter
+	ActionsFailed    *metrics.Counter
+	BytesReclaimed   *metrics.Counter
+}
+
+// NewMetrics creates Metrics registered in registry (which may be nil, if they needn't be exposed)
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		Scan:         service.NewScanMetrics(registry),
+		ScansStarted: registry.NewCounter("finddup_scans_started_total", "Number of scans started"),
+		ScansFailed: registry.NewCounter("finddup_scans_failed_total",
+			"Number of scans that failed or were cancelled"),
+		ActionsSucceeded: registry.NewCounter("finddup_actions_succeeded_total",
+			"Number of duplicates acted upon (e.g. trashed or replaced with links), excluding dry runs"),
+		ActionsFailed: registry.NewCounter("finddup_actions_failed_total",
+			"Number of duplicates that couldn't be acted upon"),
+		BytesReclaimed: registry.NewCounter("finddup_bytes_reclaimed_total",
+			"Total size of duplicates acted upon, in bytes"),
+	}
+}
+
+func (m *Metrics) observeActions(report *actions.Report) {
+	if report.DryRun {
+		return
+	}
+	m.ActionsSucceeded.Add(int64(report.Succeeded))
+	m.ActionsFailed.Add(int64(report.Failed))
+	m.BytesReclaimed.Add(report.ReclaimedSize)
+}
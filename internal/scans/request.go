@@ -0,0 +1,72 @@
+package scans
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/service"
+)
+
+// Request is a scan that a client asks for. Fields that are zero leave the defaults of the manager.
+type Request struct {
+	// Directories are local paths or URLs of remote storage
+	Directories []string `json:"directories"`
+	// Hash is the hashing algorithm to identify duplicates
+	Hash string `json:"hash,omitempty"`
+	// Verify is the hashing algorithm to verify duplicates with
+	Verify string `json:"verify,omitempty"`
+	// MinSize is the minimum size of files to consider, in bytes
+	MinSize *int64 `json:"minSize,omitempty"`
+	// Exclusions are names of files and directories to exclude
+	Exclusions  []string `json:"exclusions,omitempty"`
+	Parallelism int      `json:"parallelism,omitempty"`
+}
+
+// Options returns options of a scan as per r
+func (r Request) Options() ([]service.Option, error) {
+	var opts []service.Option
+	if r.Hash != "" {
+		hasher, err := service.HasherByName(strings.ToLower(r.Hash))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, service.WithHasher(hasher))
+	}
+	if r.Verify != "" {
+		name := strings.ToLower(r.Verify)
+		verifier, err := service.HasherByName(name)
+		if err == nil && service.IsSampled(name) {
+			err = fmt.Errorf("hashing algorithm %s can't verify duplicates", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, service.WithVerifier(verifier))
+	}
+	if r.MinSize != nil {
+		if *r.MinSize < 0 {
+			return nil, errors.New("minimum size can't be negative")
+		}
+		opts = append(opts, service.WithFileSizeThreshold(*r.MinSize))
+	}
+	if len(r.Exclusions) > 0 {
+		opts = append(opts, service.WithExcludedFiles(set.NewSet(r.Exclusions...)))
+	}
+	if r.Parallelism < 0 {
+		return nil, errors.New("parallelism can't be negative")
+	} else if r.Parallelism > 0 {
+		opts = append(opts, service.WithParallelism(r.Parallelism))
+	}
+	return opts, nil
+}
+
+// StartRequest starts a scan as per req (see Start)
+func (m *Manager) StartRequest(req Request) (*Scan, error) {
+	opts, err := req.Options()
+	if err != nil {
+		return nil, err
+	}
+	return m.Start(req.Directories, opts...)
+}
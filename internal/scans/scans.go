@@ -0,0 +1,485 @@
+// Package scans runs scans on behalf of servers, and keeps track of them so that their progress and results can be
+// looked up by their IDs
+package scans
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/ignorefile"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// State of a scan
+type State int
+
+const (
+	// Running scans are finding duplicates
+	Running State = iota
+	// Completed scans have found all duplicates
+	Completed
+	// Failed scans stopped because of an error (which includes being cancelled)
+	Failed
+)
+
+var stateNames = map[State]string{
+	Running:   "running",
+	Completed: "completed",
+	Failed:    "failed",
+}
+
+// String returns name of the state
+func (s State) String() string {
+	return stateNames[s]
+}
+
+var (
+	// ErrNotFound is the error for IDs of scans that aren't known
+	ErrNotFound = errors.New("no such scan")
+	// ErrNotCompleted is the error when results of a scan that hasn't completed are asked for
+	ErrNotCompleted = errors.New("scan hasn't completed")
+	// ErrNotAllowed is the error for directories that aren't within any of the roots of a Manager
+	ErrNotAllowed = errors.New("not within any of the directories that scans are limited to")
+)
+
+// Limits are limits of what scans a Manager runs, and of how long it keeps them
+type Limits struct {
+	// Roots are directories (local paths or URLs of remote storage) that scans are limited to, along with those
+	// within them. Any directory can be scanned if there are none.
+	Roots []string
+	// Retention is how long scans are kept once they finish (for their results to be fetched and acted upon), or
+	// forever if it's 0
+	Retention time.Duration
+	// MaxFinished is the maximum number of scans kept once they finish, the oldest of which are removed first, or no
+	// maximum if it's 0
+	MaxFinished int
+}
+
+// Manager starts scans and keeps track of them
+type Manager struct {
+	fsys     *vfs.Mux
+	metrics  *Metrics
+	limits   Limits
+	defaults []service.Option
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mx       sync.RWMutex
+	scans    map[string]*Scan
+}
+
+// NewManager creates a Manager that scans directories on fsys (to which URLs of remote storage are mounted as
+// needed) within limits, with options defaults unless a scan overrides them. Scans and actions update metrics, if
+// that isn't nil.
+func NewManager(fsys *vfs.Mux, metrics *Metrics, limits Limits, defaults ...service.Option) *Manager {
+	if metrics == nil {
+		metrics = NewMetrics(nil)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{fsys: fsys, metrics: metrics, limits: limits, defaults: defaults, ctx: ctx, cancel: cancel,
+		scans: map[string]*Scan{}}
+}
+
+// Start checks that directories (which are local paths or URLs of remote storage) are readable, and starts scanning
+// them in background. opts are applied after the default options of m.
+func (m *Manager) Start(directories []string, opts ...service.Option) (*Scan, error) {
+	if len(directories) == 0 {
+		return nil, errors.New("no directories to scan")
+	}
+	resolved := make([]string, 0, len(directories))
+	for _, dir := range directories {
+		if !m.isAllowed(dir) {
+			return nil, fmt.Errorf("%q can't be scanned: %w", dir, ErrNotAllowed)
+		}
+		name, err := m.resolve(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a readable directory: %w", dir, err)
+		}
+		resolved = append(resolved, name)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	s := &Scan{ID: id, Directories: resolved, StartedAt: time.Now(), metrics: m.metrics, cancel: cancel,
+		changed: make(chan struct{}), done: make(chan struct{}), fsys: m.fsys, acted: map[string]bool{}}
+	allOpts := append(append(append([]service.Option(nil), m.defaults...), opts...),
+		service.WithFS(m.fsys), service.WithListener(listener{s}), service.WithMetrics(m.metrics.Scan),
+		service.WithFileFilter(ignorefile.NewTree(m.fsys, ignorefile.DupignoreFileName).FileFilter(resolved)))
+	m.metrics.ScansStarted.Add(1)
+	fmte.Printf("Scan %s of %s started\n", id, strings.Join(resolved, ", "))
+	m.mx.Lock()
+	m.scans[id] = s
+	m.mx.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		s.finish(service.FindDuplicates(ctx, service.NewOptions(resolved, allOpts...)))
+		m.retain(s)
+	}()
+	return s, nil
+}
+
+// isAllowed checks whether dir is one of the roots of m, or within one of them. Local directories are compared by
+// their real paths, so that links don't lead out of roots, and URLs by their schemes, hosts and paths.
+func (m *Manager) isAllowed(dir string) bool {
+	if len(m.limits.Roots) == 0 {
+		return true
+	}
+	for _, root := range m.limits.Roots {
+		if vfs.IsURL(dir) != vfs.IsURL(root) {
+			continue
+		}
+		if vfs.IsURL(dir) {
+			u, err := url.Parse(dir)
+			r, rootErr := url.Parse(root)
+			if err == nil && rootErr == nil && u.Scheme == r.Scheme && u.Host == r.Host &&
+				isWithin(path.Clean("/"+u.Path), path.Clean("/"+r.Path), "/") {
+				return true
+			}
+			continue
+		}
+		realDir, err := realPath(dir)
+		realRoot, rootErr := realPath(root)
+		if err == nil && rootErr == nil && isWithin(realDir, realRoot, string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin checks whether the clean path p is root, or within it (of the separator sep)
+func isWithin(p, root, sep string) bool {
+	return p == root || strings.HasPrefix(p, strings.TrimSuffix(root, sep)+sep)
+}
+
+// realPath returns the absolute path of dir, of links resolved
+func realPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+func (m *Manager) resolve(dir string) (string, error) {
+	if !vfs.IsURL(dir) {
+		if !utils.IsReadableDirectory(dir) {
+			return "", errors.New("no such directory, or it can't be read")
+		}
+		return filepath.Abs(dir)
+	}
+	name, err := m.fsys.OpenURL(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := m.fsys.Stat(name)
+	if err == nil && !info.IsDir() {
+		err = errors.New("not a directory")
+	}
+	return name, err
+}
+
+// Get returns the scan of the given ID
+func (m *Manager) Get(id string) (*Scan, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	s, exists := m.scans[id]
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrNotFound, id)
+	}
+	return s, nil
+}
+
+// List returns all scans, in the order they were started
+func (m *Manager) List() []*Scan {
+	m.mx.RLock()
+	scans := make([]*Scan, 0, len(m.scans))
+	for _, s := range m.scans {
+		scans = append(scans, s)
+	}
+	m.mx.RUnlock()
+	sort.Slice(scans, func(i, j int) bool { return scans[i].StartedAt.Before(scans[j].StartedAt) })
+	return scans
+}
+
+// Delete removes the scan of the given ID, first cancelling it if it's running
+func (m *Manager) Delete(id string) error {
+	m.mx.Lock()
+	s, exists := m.scans[id]
+	delete(m.scans, id)
+	m.mx.Unlock()
+	if !exists {
+		return fmt.Errorf("%w %q", ErrNotFound, id)
+	}
+	s.cancel()
+	fmte.Printf("Scan %s removed\n", id)
+	return nil
+}
+
+// retain keeps s, which has finished, as long as the limits of m allow, and removes the oldest of the scans that
+// have finished if there are more of them than allowed
+func (m *Manager) retain(s *Scan) {
+	if m.limits.Retention > 0 {
+		time.AfterFunc(m.limits.Retention, func() {
+			m.remove(s)
+		})
+	}
+	if m.limits.MaxFinished <= 0 {
+		return
+	}
+	var finished []*Scan
+	m.mx.RLock()
+	for _, scan := range m.scans {
+		if scan.Progress().State != Running {
+			finished = append(finished, scan)
+		}
+	}
+	m.mx.RUnlock()
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Progress().FinishedAt.Before(finished[j].Progress().FinishedAt)
+	})
+	for _, scan := range finished[:max(len(finished)-m.limits.MaxFinished, 0)] {
+		m.remove(scan)
+	}
+}
+
+// remove removes s, unless it was removed already
+func (m *Manager) remove(s *Scan) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.scans[s.ID] == s {
+		delete(m.scans, s.ID)
+		fmte.Printf("Scan %s removed\n", s.ID)
+	}
+}
+
+// Close cancels scans that are running, and waits for them to stop
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Scan is a scan started by a Manager
+type Scan struct {
+	ID          string
+	Directories []string
+	StartedAt   time.Time
+
+	metrics         *Metrics
+	cancel          context.CancelFunc
+	filesDiscovered atomic.Int64
+	filesHashed     atomic.Int64
+	errors          atomic.Int64
+
+	mx         sync.Mutex
+	state      State
+	groups     []entity.DuplicateGroup
+	changed    chan struct{}
+	done       chan struct{}
+	finishedAt time.Time
+	result     service.Result
+	err        error
+
+	// fsys is what files of the scan are read from
+	fsys vfs.FS
+	// actMx serializes actions, and acted are files acted upon already, which are left alone by later actions
+	actMx sync.Mutex
+	acted map[string]bool
+}
+
+// Progress is a snapshot of progress of a scan
+type Progress struct {
+	State           State
+	FilesDiscovered int64
+	FilesHashed     int64
+	GroupsFound     int64
+	// Errors is the number of files skipped because of errors
+	Errors int64
+	// FinishedAt is zero while the scan is running
+	FinishedAt time.Time
+	// Err is why the scan failed
+	Err error
+	// DuplicateCount and SavingsSize are known once the scan has completed
+	DuplicateCount int64
+	SavingsSize    int64
+}
+
+// Progress returns progress of s
+func (s *Scan) Progress() Progress {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return Progress{
+		State:           s.state,
+		FilesDiscovered: s.filesDiscovered.Load(),
+		FilesHashed:     s.filesHashed.Load(),
+		GroupsFound:     int64(len(s.groups)),
+		Errors:          s.errors.Load(),
+		FinishedAt:      s.finishedAt,
+		Err:             s.err,
+		DuplicateCount:  s.result.DuplicateTotalCount,
+		SavingsSize:     s.result.SavingsSize,
+	}
+}
+
+// Groups returns groups of duplicates confirmed so far, from the one at index from onwards. While the scan is
+// running, more is a channel that's closed once more groups are confirmed or the scan finishes; it's nil after
+// that.
+func (s *Scan) Groups(from int) (groups []entity.DuplicateGroup, more <-chan struct{}) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if from < len(s.groups) {
+		groups = s.groups[from:len(s.groups):len(s.groups)]
+	}
+	if s.state == Running {
+		more = s.changed
+	}
+	return groups, more
+}
+
+// Done returns a channel that's closed once s finishes
+func (s *Scan) Done() <-chan struct{} {
+	return s.done
+}
+
+// Result returns the result of s, once it has completed
+func (s *Scan) Result() (service.Result, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	switch s.state {
+	case Running:
+		return service.Result{}, ErrNotCompleted
+	case Failed:
+		return service.Result{}, fmt.Errorf("scan failed: %w", s.err)
+	default:
+		return s.result, nil
+	}
+}
+
+// Act acts upon duplicates found by s, once it has completed (see actions.Apply). Actions on a scan are done one
+// at a time. Files acted upon by earlier actions, and those that changed since the scan (see actions.Unchanged), are
+// left alone, so that no file is kept in place of others once it's gone. Duplicates aren't moved to trash at all if
+// trashes don't have enough free space for them (see actions.CheckTrashSpace).
+func (s *Scan) Act(opts actions.Options) (*actions.Report, error) {
+	result, err := s.Result()
+	if err != nil {
+		return nil, err
+	}
+	s.actMx.Lock()
+	defer s.actMx.Unlock()
+	if result.Duplicates == nil {
+		return &actions.Report{DryRun: opts.DryRun}, nil
+	}
+	remaining := entity.NewDigestToFiles()
+	for digest, paths := range result.Duplicates.All() {
+		for _, path := range paths {
+			if !s.acted[path] {
+				remaining.Set(digest, path)
+			}
+		}
+	}
+	duplicates, changed := actions.Unchanged(s.fsys, remaining, result.AllFiles)
+	for _, path := range changed {
+		fmte.PrintfErr("Scan %s: skipping %s, which changed since the scan\n", s.ID, path)
+	}
+	if err := actions.CheckTrashSpace(duplicates, result.AllFiles, opts); err != nil {
+		return nil, err
+	}
+	report := actions.Apply(duplicates, result.AllFiles, opts)
+	s.metrics.observeActions(report)
+	if !report.DryRun {
+		for _, record := range report.Records {
+			if record.Err == nil {
+				s.acted[record.Path] = true
+			}
+		}
+		s.logActions(opts.Action, report)
+	}
+	return report, nil
+}
+
+// logActions logs what was done to each file by an action on duplicates of s
+func (s *Scan) logActions(action actions.Action, report *actions.Report) {
+	for _, record := range report.Records {
+		if record.Err != nil {
+			fmte.PrintfErr("Scan %s: couldn't %s %s: %v\n", s.ID, action, record.Path, record.Err)
+		} else {
+			fmte.Printf("Scan %s: applied %s on %s (kept %s)\n", s.ID, action, record.Path, record.Kept)
+		}
+	}
+	fmte.Printf("Scan %s: applied %s on %d duplicates (%s), %d failed\n", s.ID, action, report.Succeeded,
+		bytesutil.BinaryFormat(report.ReclaimedSize), report.Failed)
+}
+
+func (s *Scan) finish(result service.Result, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.finishedAt = time.Now()
+	if err != nil {
+		s.state, s.err = Failed, err
+		s.metrics.ScansFailed.Add(1)
+		fmte.PrintfErr("Scan %s failed after %v: %v\n", s.ID, s.finishedAt.Sub(s.StartedAt).Round(time.Millisecond),
+			err)
+	} else {
+		s.state, s.result = Completed, result
+		fmte.Printf("Scan %s completed in %v: found %d duplicates, a total of %s can be saved\n", s.ID,
+			s.finishedAt.Sub(s.StartedAt).Round(time.Millisecond), result.DuplicateTotalCount,
+			bytesutil.BinaryFormat(result.SavingsSize))
+	}
+	close(s.changed)
+	close(s.done)
+}
+
+// listener tracks progress of a scan
+type listener struct {
+	s *Scan
+}
+
+func (l listener) OnFileDiscovered(string, entity.FileMeta) {
+	l.s.filesDiscovered.Add(1)
+}
+
+func (l listener) OnFileHashed(string, entity.FileDigest) {
+	l.s.filesHashed.Add(1)
+}
+
+func (l listener) OnGroupFound(digest entity.FileDigest, paths []string) {
+	sortedPaths := append([]string(nil), paths...)
+	sort.Strings(sortedPaths)
+	l.s.mx.Lock()
+	defer l.s.mx.Unlock()
+	l.s.groups = append(l.s.groups, entity.DuplicateGroup{Digest: digest, Paths: sortedPaths})
+	close(l.s.changed)
+	l.s.changed = make(chan struct{})
+}
+
+func (l listener) OnError(string, error) {
+	l.s.errors.Add(1)
+}
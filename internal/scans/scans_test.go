@@ -0,0 +1,222 @@
+package scans
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, files map[string][]byte) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+	return dir
+}
+
+// TestManager checks whether scans are started, tracked and acted upon
+func TestManager(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	dir := writeFiles(t, map[string][]byte{
+		"a.jpg":        content,
+		"nested/b.jpg": content,
+		"c.jpg":        bytes.Repeat([]byte("different "), 1_000),
+	})
+	var out, errOut bytes.Buffer
+	fmte.SetLogger(fmte.NewLogger(&out, &errOut))
+	defer fmte.Off()
+	metrics := NewMetrics(nil)
+	m := NewManager(vfs.NewMux(vfs.Local), metrics, Limits{}, service.WithFileSizeThreshold(1))
+	defer m.Close()
+
+	_, err := m.Start(nil)
+	assert.NotNil(t, err)
+	_, err = m.Start([]string{filepath.Join(dir, "missing")})
+	assert.ErrorContains(t, err, "isn't a readable directory")
+	_, err = m.Get("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	scan, err := m.Start([]string{dir})
+	assert.Nil(t, err)
+	found, err := m.Get(scan.ID)
+	assert.Nil(t, err)
+	assert.Same(t, scan, found)
+	assert.Equal(t, []*Scan{scan}, m.List())
+	var paths []string
+	for from := 0; ; {
+		groups, more := scan.Groups(from)
+		for _, group := range groups {
+			paths = append(paths, group.Paths...)
+		}
+		from += len(groups)
+		if more == nil {
+			break
+		}
+		<-more
+	}
+	<-scan.Done()
+	assert.Equal(t, []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "nested/b.jpg")}, paths)
+	progress := scan.Progress()
+	assert.Equal(t, Completed, progress.State)
+	assert.Equal(t, int64(3), progress.FilesDiscovered)
+	assert.Equal(t, int64(1), progress.GroupsFound)
+	assert.Equal(t, int64(1), progress.DuplicateCount)
+	assert.False(t, progress.FinishedAt.IsZero())
+
+	report, err := scan.Act(actions.Options{Action: actions.Delete, DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Succeeded)
+	assert.FileExists(t, filepath.Join(dir, "nested/b.jpg"))
+	report, err = scan.Act(actions.Options{Action: actions.Delete})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), report.ReclaimedSize)
+	assert.NoFileExists(t, filepath.Join(dir, "nested/b.jpg"))
+	assert.Equal(t, int64(1), metrics.ScansStarted.Value())
+	assert.Equal(t, int64(1), metrics.Scan.DuplicatesFound.Value())
+	assert.Equal(t, int64(1), metrics.ActionsSucceeded.Value())
+	assert.Equal(t, int64(len(content)), metrics.BytesReclaimed.Value())
+	assert.Contains(t, out.String(), "Scan "+scan.ID+" of "+dir+" started\n")
+	assert.Contains(t, out.String(), "found 1 duplicates, a total of 9.77 KiB can be saved\n")
+	assert.Contains(t, out.String(), "Scan "+scan.ID+": applied delete on "+filepath.Join(dir, "nested/b.jpg")+
+		" (kept "+filepath.Join(dir, "a.jpg")+")\n")
+	assert.Contains(t, out.String(), "Scan "+scan.ID+": applied delete on 1 duplicates (9.77 KiB), 0 failed\n")
+	assert.Empty(t, errOut.String())
+}
+
+// TestActAgain checks whether files acted upon by an action, and files that changed since the scan, are left alone
+// by later actions, so that no file is kept in place of another once it's gone
+func TestActAgain(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	dir := writeFiles(t, map[string][]byte{"a.jpg": content, "b.jpg": content, "c.jpg": content, "d.jpg": content})
+	fmte.Off()
+	m := NewManager(vfs.NewMux(vfs.Local), nil, Limits{}, service.WithFileSizeThreshold(1))
+	defer m.Close()
+	scan, err := m.Start([]string{dir})
+	assert.Nil(t, err)
+	<-scan.Done()
+	// Of the same size and contents, but modified since the scan
+	later := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "d.jpg"), later, later))
+
+	report, err := scan.Act(actions.Options{Action: actions.Trash, TrashDir: t.TempDir(), Keep: actions.KeepFirst})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.FileExists(t, filepath.Join(dir, "a.jpg"))
+	assert.NoFileExists(t, filepath.Join(dir, "b.jpg"))
+	assert.FileExists(t, filepath.Join(dir, "d.jpg"))
+	// Only a.jpg is left of the group, so there's nothing to link
+	report, err = scan.Act(actions.Options{Action: actions.Symlink, Keep: actions.KeepNewest})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Records)
+	info, err := os.Lstat(filepath.Join(dir, "a.jpg"))
+	assert.Nil(t, err)
+	assert.True(t, info.Mode().IsRegular())
+}
+
+// TestClose checks whether scans that are running are cancelled on closing the manager
+func TestClose(t *testing.T) {
+	dir := writeFiles(t, map[string][]byte{"a": []byte("a"), "b": []byte("a")})
+	release := make(chan struct{})
+	fmte.Off()
+	m := NewManager(vfs.NewMux(vfs.Local), nil, Limits{}, service.WithFileSizeThreshold(1),
+		service.WithFileFilter(func(string, os.FileInfo) bool {
+			<-release
+			return true
+		}))
+	scan, err := m.Start([]string{dir})
+	assert.Nil(t, err)
+	_, err = scan.Result()
+	assert.ErrorIs(t, err, ErrNotCompleted)
+	_, err = scan.Act(actions.Options{Action: actions.Delete})
+	assert.ErrorIs(t, err, ErrNotCompleted)
+	m.cancel()
+	close(release)
+	m.Close()
+	assert.Equal(t, Failed, scan.Progress().State)
+	assert.Equal(t, int64(1), m.metrics.ScansFailed.Value())
+	_, err = scan.Result()
+	assert.NotNil(t, err)
+}
+
+// TestRoots checks whether only directories within roots (of links resolved) can be scanned
+func TestRoots(t *testing.T) {
+	root := writeFiles(t, map[string][]byte{"photos/a": []byte("a")})
+	outside := t.TempDir()
+	assert.Nil(t, os.Symlink(outside, filepath.Join(root, "link")))
+	fmte.Off()
+	m := NewManager(vfs.NewMux(vfs.Local), nil, Limits{Roots: []string{root, "s3://bucket/photos"}})
+	defer m.Close()
+	for dir, allowed := range map[string]bool{
+		root:                               true,
+		filepath.Join(root, "photos"):      true,
+		filepath.Join(root, "photos/.."):   true,
+		filepath.Join(root, ".."):          false,
+		filepath.Join(root, "link"):        false,
+		root + "-other":                    false,
+		outside:                            false,
+		"s3://bucket/photos/2024":          true,
+		"s3://bucket/photos/../videos":     false,
+		"s3://bucket/photos-2024":          false,
+		"s3://other/photos":                false,
+		"gs://bucket/photos":               false,
+		"s3://bucket/photos?region=eu-1":   true,
+		"s3://bucket/photos/2024/../2023/": true,
+	} {
+		assert.Equal(t, allowed, m.isAllowed(dir), dir)
+	}
+	_, err := m.Start([]string{outside})
+	assert.ErrorIs(t, err, ErrNotAllowed)
+	scan, err := m.Start([]string{filepath.Join(root, "photos")})
+	assert.Nil(t, err)
+	<-scan.Done()
+}
+
+// TestRetention checks whether scans are deleted, and removed once they're kept for longer than limits allow
+func TestRetention(t *testing.T) {
+	dir := writeFiles(t, map[string][]byte{"a": []byte("a"), "b": []byte("a")})
+	fmte.Off()
+	m := NewManager(vfs.NewMux(vfs.Local), nil, Limits{MaxFinished: 2}, service.WithFileSizeThreshold(1))
+	defer m.Close()
+	var started []*Scan
+	for range 3 {
+		scan, err := m.Start([]string{dir})
+		assert.Nil(t, err)
+		<-scan.Done()
+		started = append(started, scan)
+	}
+	// Scans are removed only after they're done, so the last one may still be kept for a moment
+	assert.Eventually(t, func() bool { return len(m.List()) == 2 }, time.Second, time.Millisecond)
+	_, err := m.Get(started[0].ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, m.Delete(started[1].ID))
+	assert.ErrorIs(t, m.Delete(started[1].ID), ErrNotFound)
+	assert.Equal(t, []*Scan{started[2]}, m.List())
+
+	// Scans that are running are cancelled once deleted
+	release := make(chan struct{})
+	m = NewManager(vfs.NewMux(vfs.Local), nil, Limits{Retention: time.Millisecond}, service.WithFileSizeThreshold(1),
+		service.WithFileFilter(func(string, os.FileInfo) bool {
+			<-release
+			return true
+		}))
+	defer m.Close()
+	scan, err := m.Start([]string{dir})
+	assert.Nil(t, err)
+	assert.Nil(t, m.Delete(scan.ID))
+	close(release)
+	<-scan.Done()
+	assert.Equal(t, Failed, scan.Progress().State)
+	scan, err = m.Start([]string{dir})
+	assert.Nil(t, err)
+	<-scan.Done()
+	assert.Eventually(t, func() bool { return len(m.List()) == 0 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,291 @@
+// Package selfupdate updates the binary of this program to that of the latest release on GitHub, for standalone
+// binaries that no package manager updates (as on many NAS)
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+const (
+	// DefaultAPIURL is the URL of the API of GitHub
+	DefaultAPIURL = "https://api.github.com"
+	// DefaultRepository is the repository on GitHub whose releases are installed
+	DefaultRepository = "m-manu/go-find-duplicates"
+	// ChecksumsAssetName is the name of the asset of releases that has sha256 checksums of their other assets, as
+	// written by sha256sum
+	ChecksumsAssetName = "checksums.txt"
+	// SignatureAssetName is the name of the asset of releases that has the ed25519 signature of their checksums (see
+	// ChecksumsAssetName) by the key of releases, in base64, e.g. as written by
+	// "openssl pkeyutl -sign -inkey key.pem -rawin -in checksums.txt | base64"
+	SignatureAssetName = ChecksumsAssetName + ".sig"
+	// maxBinarySize is the size of binaries downloaded at most
+	maxBinarySize = 256 << 20
+)
+
+// ErrNoBinary is returned for releases that have no binary for this platform
+var ErrNoBinary = errors.New("release has no binary for this platform")
+
+// ErrUnsigned is returned for releases whose checksums aren't signed by the key of releases, which binaries of
+// aren't installed: since checksums are downloaded the same way as binaries, anyone who could replace binaries of a
+// release could replace their checksums too, but not sign them
+var ErrUnsigned = errors.New("checksums of release aren't signed by the key of releases")
+
+// ReleaseKey is the public key that checksums of releases are signed by the private key of, which only maintainers
+// have
+var ReleaseKey = ed25519.PublicKey(mustDecodeHex("aec8ba745f80c7785c906199e843e0169617c3cf0ffe757e69976dd41319e210"))
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Release is a release on GitHub
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file of a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Version is the version of the release, i.e. its tag without the leading "v"
+func (r Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+func (r Release) asset(name string) (Asset, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return Asset{}, false
+}
+
+// BinaryName is the name of the asset of releases that is the binary for goos and goarch, e.g.
+// go-find-duplicates_linux_amd64 (with ".exe" on Windows)
+func BinaryName(goos, goarch string) string {
+	name := fmt.Sprintf("go-find-duplicates_%s_%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Updater downloads binaries of releases
+type Updater struct {
+	// APIURL defaults to DefaultAPIURL
+	APIURL string
+	// Repository defaults to DefaultRepository
+	Repository string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// PublicKey is the key that checksums of releases must be signed by (defaults to ReleaseKey)
+	PublicKey ed25519.PublicKey
+}
+
+// Latest returns the latest release
+func (u Updater) Latest(ctx context.Context) (Release, error) {
+	apiURL, repository := u.APIURL, u.Repository
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	if repository == "" {
+		repository = DefaultRepository
+	}
+	body, err := u.get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimSuffix(apiURL, "/"), repository))
+	if err != nil {
+		return Release{}, fmt.Errorf("couldn't find the latest release: %w", err)
+	}
+	var r Release
+	if err := json.Unmarshal(body, &r); err != nil {
+		return Release{}, fmt.Errorf("couldn't read the latest release: %w", err)
+	}
+	return r, nil
+}
+
+// Download downloads the binary of the release for goos and goarch (see BinaryName), and verifies it against the
+// checksums of the release, once their signature is verified (see ErrUnsigned)
+func (u Updater) Download(ctx context.Context, r Release, goos, goarch string) ([]byte, error) {
+	name := BinaryName(goos, goarch)
+	binary, found := r.asset(name)
+	if !found {
+		return nil, fmt.Errorf("%s: %w (%s)", r.Tag, ErrNoBinary, name)
+	}
+	checksums, found := r.asset(ChecksumsAssetName)
+	if !found {
+		return nil, fmt.Errorf("%s has no checksums to verify its binary with", r.Tag)
+	}
+	body, err := u.get(ctx, checksums.URL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download checksums: %w", err)
+	}
+	if err := u.verifySignature(ctx, r, body); err != nil {
+		return nil, err
+	}
+	index, err := entity.ReadChecksums(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read checksums: %w", err)
+	}
+	digest, found := index.Digests[name]
+	if !found || index.Algorithm != "sha256" {
+		return nil, fmt.Errorf("checksums of %s have no sha256 checksum of %s", r.Tag, name)
+	}
+	content, err := u.get(ctx, binary.URL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download %s: %w", name, err)
+	}
+	if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != digest.FileHash {
+		return nil, fmt.Errorf("checksum of %s isn't that of the release, so it isn't installed", name)
+	}
+	return content, nil
+}
+
+// verifySignature verifies the signature of checksums of the release (see SignatureAssetName)
+func (u Updater) verifySignature(ctx context.Context, r Release, checksums []byte) error {
+	key := u.PublicKey
+	if key == nil {
+		key = ReleaseKey
+	}
+	asset, found := r.asset(SignatureAssetName)
+	if !found {
+		return fmt.Errorf("%s: %w (it has no %s)", r.Tag, ErrUnsigned, SignatureAssetName)
+	}
+	body, err := u.get(ctx, asset.URL)
+	if err != nil {
+		return fmt.Errorf("couldn't download signature of checksums: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil || !ed25519.Verify(key, checksums, signature) {
+		return fmt.Errorf("%s: %w", r.Tag, ErrUnsigned)
+	}
+	return nil
+}
+
+// get gets the body of url, failing unless the response is successful
+func (u Updater) get(ctx context.Context, url string) ([]byte, error) {
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBinarySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxBinarySize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxBinarySize)
+	}
+	return body, nil
+}
+
+// Replace replaces the executable at path with binary, keeping its permissions. The executable is moved aside
+// first, since running executables can't be overwritten on some platforms (such as Windows).
+func Replace(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	// The new binary is written next to the executable, so that it can be renamed to it
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return err
+	}
+	newPath := f.Name()
+	_, err = f.Write(binary)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(newPath, info.Mode().Perm())
+	}
+	if err != nil {
+		_ = os.Remove(newPath)
+		return err
+	}
+	oldPath := path + ".old"
+	if err := os.Rename(path, oldPath); err != nil {
+		_ = os.Remove(newPath)
+		return err
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		_ = os.Rename(oldPath, path)
+		_ = os.Remove(newPath)
+		return err
+	}
+	// On Windows, the running executable can't be removed, so it's left for the next update to replace
+	_ = os.Remove(oldPath)
+	return nil
+}
+
+// IsNewer returns whether version is newer than current, comparing them as dot-separated numbers. Versions that
+// aren't (such as those of development builds) are older than all others.
+func IsNewer(version, current string) bool {
+	v, isNumbered := parseVersion(version)
+	if !isNumbered {
+		return false
+	}
+	c, isCurrentNumbered := parseVersion(current)
+	if !isCurrentNumbered {
+		return true
+	}
+	for i := 0; i < max(len(v), len(c)); i++ {
+		var vi, ci int
+		if i < len(v) {
+			vi = v[i]
+		}
+		if i < len(c) {
+			ci = c[i]
+		}
+		if vi != ci {
+			return vi > ci
+		}
+	}
+	return false
+}
+
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
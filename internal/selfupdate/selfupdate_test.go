@@ -0,0 +1,116 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newReleaseServer serves a latest release with a binary for linux/amd64, checksums (as checksums says) and their
+// signature (unless it's empty)
+func newReleaseServer(t *testing.T, binary []byte, checksums, signature string) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/repos/m-manu/go-find-duplicates/releases/latest", func(w http.ResponseWriter, _ *http.Request) {
+		assets := []Asset{
+			{Name: BinaryName("linux", "amd64"), URL: server.URL + "/binary"},
+			{Name: ChecksumsAssetName, URL: server.URL + "/checksums"},
+		}
+		if signature != "" {
+			assets = append(assets, Asset{Name: SignatureAssetName, URL: server.URL + "/signature"})
+		}
+		_ = json.NewEncoder(w).Encode(Release{Tag: "v1.8.0", Assets: assets})
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(binary) })
+	mux.HandleFunc("/checksums", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(checksums)) })
+	mux.HandleFunc("/signature", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(signature)) })
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sign signs checksums by key, as SignatureAssetName has signatures
+func sign(key ed25519.PrivateKey, checksums string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(checksums))) + "\n"
+}
+
+func TestDownload(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	checksums := hex.EncodeToString(sum[:]) + "  " + BinaryName("linux", "amd64") + "\n"
+	u := Updater{APIURL: newReleaseServer(t, binary, checksums, sign(private, checksums)).URL, PublicKey: public}
+	r, err := u.Latest(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "1.8.0", r.Version())
+	downloaded, err := u.Download(context.Background(), r, "linux", "amd64")
+	assert.Nil(t, err)
+	assert.Equal(t, binary, downloaded)
+	_, err = u.Download(context.Background(), r, "windows", "arm64")
+	assert.True(t, errors.Is(err, ErrNoBinary))
+
+	tampered := Updater{APIURL: newReleaseServer(t, []byte("tampered binary"), checksums,
+		sign(private, checksums)).URL, PublicKey: public}
+	r, err = tampered.Latest(context.Background())
+	assert.Nil(t, err)
+	_, err = tampered.Download(context.Background(), r, "linux", "amd64")
+	assert.ErrorContains(t, err, "checksum")
+}
+
+// TestDownloadUnsigned checks whether binaries of releases whose checksums aren't signed, or are signed by other keys
+// (even if they're of the binaries), aren't installed
+func TestDownloadUnsigned(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	_, other, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	binary := []byte("tampered binary")
+	sum := sha256.Sum256(binary)
+	checksums := hex.EncodeToString(sum[:]) + "  " + BinaryName("linux", "amd64") + "\n"
+	for _, signature := range []string{"", sign(other, checksums), "not a signature"} {
+		u := Updater{APIURL: newReleaseServer(t, binary, checksums, signature).URL, PublicKey: public}
+		r, err := u.Latest(context.Background())
+		assert.Nil(t, err)
+		_, err = u.Download(context.Background(), r, "linux", "amd64")
+		assert.ErrorIs(t, err, ErrUnsigned)
+	}
+	assert.Len(t, ReleaseKey, ed25519.PublicKeySize)
+}
+
+func TestReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-find-duplicates")
+	assert.Nil(t, os.WriteFile(path, []byte("old binary"), 0o750))
+	assert.Nil(t, Replace(path, []byte("new binary")))
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "new binary", string(content))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1, "nothing but the new binary should be left")
+}
+
+func TestIsNewer(t *testing.T) {
+	assert.True(t, IsNewer("1.8.0", "1.7.0"))
+	assert.True(t, IsNewer("v1.10.0", "1.9.3"))
+	assert.True(t, IsNewer("1.7.1", "1.7"))
+	assert.False(t, IsNewer("1.7.0", "1.7.0"))
+	assert.False(t, IsNewer("1.7", "1.7.0"))
+	assert.False(t, IsNewer("1.6.9", "1.7.0"))
+	assert.False(t, IsNewer("nightly", "1.7.0"))
+	assert.True(t, IsNewer("1.7.0", "devel"))
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// ErrUnsupported is returned for what can't be found out about storage on this platform
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// FreeSpace returns how many bytes can be written to the device that the local directory dir is on (by this user)
+func FreeSpace(dir string) (int64, error) {
+	return freeSpace(dir)
+}
+
+// SameDevice checks whether local paths a and b (which must exist) are on the same device, so that files can be
+// renamed from one to the other. It's true if that can't be found out.
+func SameDevice(a, b string) bool {
+	return sameDevice(a, b)
+}
+
+// MountPoint returns the directory that the device of the local path (which must exist) is mounted on, i.e. the top
+// directory of the file system of path
+func MountPoint(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return mountPoint(abs)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package storage
+
+func freeSpace(_ string) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+func sameDevice(_, _ string) bool {
+	return true
+}
+
+func mountPoint(_ string) (string, error) {
+	return "", ErrUnsupported
+}
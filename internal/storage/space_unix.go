@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+func freeSpace(dir string) (int64, error) {
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(dir, &sfs); err != nil {
+		return 0, err
+	}
+	return int64(sfs.Bavail) * int64(sfs.Bsize), nil
+}
+
+func sameDevice(a, b string) bool {
+	var stA, stB unix.Stat_t
+	if unix.Stat(a, &stA) != nil || unix.Stat(b, &stB) != nil {
+		return true
+	}
+	return stA.Dev == stB.Dev
+}
+
+// mountPoint walks up from path for as long as parents are on its device
+func mountPoint(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+	for {
+		parent := filepath.Dir(path)
+		var parentSt unix.Stat_t
+		if parent == path || unix.Stat(parent, &parentSt) != nil || parentSt.Dev != st.Dev {
+			return path, nil
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,78 @@
+// Package storage detects kinds of storage that directories are on, so that files are read from each with as much
+// concurrency as suits it
+package storage
+
+import (
+	"net/url"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// Kind is a kind of storage
+type Kind int
+
+// Kinds of storage
+const (
+	// Unknown is storage whose kind couldn't be detected
+	Unknown Kind = iota
+	// Rotational is a hard disk drive, which is slow to seek
+	Rotational
+	// SSD is a solid-state drive (other than NVMe)
+	SSD
+	// NVMe is a solid-state drive attached by NVMe, which serves many reads in parallel
+	NVMe
+	// Network is storage on another host, such as NFS or SMB shares and cloud storage, which is slow to respond
+	Network
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Rotational:
+		return "rotational"
+	case SSD:
+		return "ssd"
+	case NVMe:
+		return "nvme"
+	case Network:
+		return "network"
+	default:
+		return "unknown"
+	}
+}
+
+// ReadWorkers is the number of files to read concurrently from storage of the kind (0 if it's unknown)
+func (k Kind) ReadWorkers() int {
+	switch k {
+	case Rotational:
+		// Reading more files at a time makes heads of the disk seek back and forth between them
+		return 2
+	case SSD:
+		return 8
+	case NVMe:
+		return 32
+	case Network:
+		// Reads wait for the network far more than for the storage behind it
+		return 16
+	default:
+		return 0
+	}
+}
+
+// Device is storage that directories are on
+type Device struct {
+	// ID identifies the device among those of other directories (such as major and minor numbers of a block device)
+	ID   string
+	Kind Kind
+}
+
+// Detect detects the device that the directory dir (a local path, or a URL of remote storage) is on. Directories of
+// remote storage are on the network, on a device per host.
+func Detect(dir string) Device {
+	if vfs.IsURL(dir) {
+		if u, err := url.Parse(dir); err == nil {
+			return Device{ID: u.Scheme + "://" + u.Host, Kind: Network}
+		}
+		return Device{ID: dir, Kind: Network}
+	}
+	return detect(dir)
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// networkFileSystems are magic numbers (as in statfs(2)) of file systems of storage on other hosts
+var networkFileSystems = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xff534d42: true, // CIFS
+	0xfe534d42: true, // SMB2
+	0x01021997: true, // 9P
+	0x5346414f: true, // AFS
+	0x00c36400: true, // Ceph
+}
+
+// sysfs is where sysfs is mounted
+var sysfs = "/sys"
+
+func detect(dir string) Device {
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return Device{ID: dir, Kind: Unknown}
+	}
+	id := fmt.Sprintf("%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(dir, &sfs); err == nil && networkFileSystems[uint32(sfs.Type)] {
+		return Device{ID: id, Kind: Network}
+	}
+	return Device{ID: id, Kind: blockDeviceKind(id)}
+}
+
+// blockDeviceKind detects the kind of the block device of major and minor numbers id, by what sysfs says of it
+func blockDeviceKind(id string) Kind {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysfs, "dev", "block", id))
+	if err != nil {
+		return Unknown
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		// Queues are of disks, not of their partitions
+		dir = filepath.Dir(dir)
+	}
+	rotational, err := os.ReadFile(filepath.Join(dir, "queue", "rotational"))
+	if err != nil {
+		return Unknown
+	}
+	switch {
+	case strings.TrimSpace(string(rotational)) == "1":
+		return Rotational
+	case strings.HasPrefix(filepath.Base(dir), "nvme"):
+		return NVMe
+	default:
+		return SSD
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockDeviceKind(t *testing.T) {
+	defer func(old string) { sysfs = old }(sysfs)
+	sysfs = t.TempDir()
+	for dev, disk := range map[string]struct {
+		path       string
+		rotational string
+	}{
+		"8:1":   {"devices/pci0000:00/ata1/block/sda/sda1", "1\n"},
+		"8:16":  {"devices/pci0000:00/ata2/block/sdb", "0\n"},
+		"259:1": {"devices/pci0000:00/nvme/nvme0/nvme0n1/nvme0n1p1", "0\n"},
+	} {
+		dir := filepath.Join(sysfs, disk.path)
+		queue := filepath.Join(dir, "queue")
+		if filepath.Base(filepath.Dir(dir)) != "block" {
+			assert.Nil(t, os.MkdirAll(dir, 0o755))
+			assert.Nil(t, os.WriteFile(filepath.Join(dir, "partition"), []byte("1\n"), 0o644))
+			queue = filepath.Join(filepath.Dir(dir), "queue")
+		}
+		assert.Nil(t, os.MkdirAll(queue, 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(queue, "rotational"), []byte(disk.rotational), 0o644))
+		assert.Nil(t, os.MkdirAll(filepath.Join(sysfs, "dev", "block"), 0o755))
+		assert.Nil(t, os.Symlink(dir, filepath.Join(sysfs, "dev", "block", dev)))
+	}
+	assert.Equal(t, Rotational, blockDeviceKind("8:1"))
+	assert.Equal(t, SSD, blockDeviceKind("8:16"))
+	assert.Equal(t, NVMe, blockDeviceKind("259:1"))
+	assert.Equal(t, Unknown, blockDeviceKind("7:0"))
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	device := Detect(dir)
+	assert.NotEmpty(t, device.ID)
+	assert.Equal(t, device, Detect(filepath.Join(dir, ".")))
+	assert.Equal(t, Unknown, Detect(filepath.Join(dir, "missing")).Kind)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package storage
+
+func detect(dir string) Device {
+	return Device{ID: dir, Kind: Unknown}
+}
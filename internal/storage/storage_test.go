@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectURL(t *testing.T) {
+	assert.Equal(t, Device{ID: "s3://bucket", Kind: Network}, Detect("s3://bucket/photos"))
+	assert.Equal(t, Device{ID: "smb://nas", Kind: Network}, Detect("smb://nas/share/photos"))
+	assert.Equal(t, 16, Detect("s3://bucket/photos").Kind.ReadWorkers())
+	assert.Equal(t, 0, Unknown.ReadWorkers())
+}
+
+func TestFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	free, err := FreeSpace(dir)
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	assert.Greater(t, free, int64(0))
+	assert.True(t, SameDevice(dir, t.TempDir()))
+}
+
+func TestMountPoint(t *testing.T) {
+	dir := t.TempDir()
+	mountPoint, err := MountPoint(dir)
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(dir, mountPoint), "%s of %s", mountPoint, dir)
+	assert.True(t, SameDevice(dir, mountPoint))
+	if parent := filepath.Dir(mountPoint); parent != mountPoint {
+		assert.False(t, SameDevice(parent, mountPoint))
+	}
+}
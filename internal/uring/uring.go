@@ -0,0 +1,77 @@
+// Package uring reads files through io_uring on Linux, submitting many reads to the kernel at once rather than by a
+// system call each
+package uring
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnsupported is returned where io_uring isn't available: on other operating systems, on kernels older than 5.6
+// and where it's disabled (such as by seccomp profiles of containers)
+var ErrUnsupported = errors.New("io_uring isn't supported")
+
+// Pool is a pool of rings, so that every concurrent reader has a ring of its own (rings aren't safe for concurrent
+// use). Rings are created as they are needed.
+type Pool struct {
+	entries uint32
+	mx      sync.Mutex
+	idle    []*Ring
+	all     []*Ring
+}
+
+// NewPool creates a pool of rings of as many entries as entries (which is the most reads a ring submits at once). It
+// checks that io_uring is supported by creating the first ring.
+func NewPool(entries uint32) (*Pool, error) {
+	r, err := New(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{entries: entries, idle: []*Ring{r}, all: []*Ring{r}}, nil
+}
+
+// Get takes an idle ring of the pool, creating one if there's none
+func (p *Pool) Get() (*Ring, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if n := len(p.idle); n > 0 {
+		r := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		return r, nil
+	}
+	r, err := New(p.entries)
+	if err != nil {
+		return nil, err
+	}
+	p.all = append(p.all, r)
+	return r, nil
+}
+
+// Put gives a ring taken by Get back to the pool, or closes it if it's broken
+func (p *Pool) Put(r *Ring) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if !r.broken {
+		p.idle = append(p.idle, r)
+		return
+	}
+	_ = r.Close()
+	for i, ring := range p.all {
+		if ring == r {
+			p.all = append(p.all[:i], p.all[i+1:]...)
+			break
+		}
+	}
+}
+
+// Close closes all rings of the pool, which mustn't be used after
+func (p *Pool) Close() error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	var errs []error
+	for _, r := range p.all {
+		errs = append(errs, r.Close())
+	}
+	p.idle, p.all = nil, nil
+	return errors.Join(errs...)
+}
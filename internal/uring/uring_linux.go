@@ -0,0 +1,215 @@
+//go:build linux
+
+package uring
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants of io_uring, as in linux/io_uring.h
+const (
+	// opRead is IORING_OP_READ, since Linux 5.6
+	opRead = 22
+	// enterGetEvents is IORING_ENTER_GETEVENTS
+	enterGetEvents = 1
+	// featRWCurPos is IORING_FEAT_RW_CUR_POS, which is of kernels with IORING_OP_READ (Linux 5.6 onwards)
+	featRWCurPos = 1 << 3
+	offSQRing    = 0
+	offCQRing    = 0x8000000
+	offSQEs      = 0x10000000
+)
+
+// sqringOffsets is struct io_sqring_offsets
+type sqringOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// cqringOffsets is struct io_cqring_offsets
+type cqringOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// params is struct io_uring_params
+type params struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  sqringOffsets
+	cqOff                                                                  cqringOffsets
+}
+
+// sqe is struct io_uring_sqe, of which only fields of reads are named
+type sqe struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	rwFlags  uint32
+	userData uint64
+	_        [3]uint64
+}
+
+// cqe is struct io_uring_cqe
+type cqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// Ring is an io_uring instance: a queue of submissions of reads to the kernel, and a queue of their completions. It's
+// not safe for concurrent use.
+type Ring struct {
+	fd                     int
+	sqRing, cqRing, sqeMem []byte
+	sqHead, sqTail         *uint32
+	sqMask                 uint32
+	sqArray                []uint32
+	sqes                   []sqe
+	cqHead, cqTail         *uint32
+	cqMask                 uint32
+	cqes                   []cqe
+	// broken is whether the ring is left in an unknown state by a failure to submit reads, and so can't be reused
+	broken bool
+}
+
+// New creates a ring of as many entries as entries, rounded up to a power of 2
+func New(entries uint32) (*Ring, error) {
+	var p params
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		if errno == unix.ENOSYS || errno == unix.EPERM {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, errno)
+		}
+		return nil, fmt.Errorf("couldn't set io_uring up: %w", errno)
+	}
+	r := &Ring{fd: int(fd)}
+	if p.features&featRWCurPos == 0 {
+		_ = r.Close()
+		return nil, fmt.Errorf("%w: kernel is older than 5.6", ErrUnsupported)
+	}
+	var err error
+	mmap := func(offset int64, size uint32) []byte {
+		if err != nil {
+			return nil
+		}
+		var mem []byte
+		mem, err = unix.Mmap(r.fd, offset, int(size), unix.PROT_READ|unix.PROT_WRITE,
+			unix.MAP_SHARED|unix.MAP_POPULATE)
+		return mem
+	}
+	r.sqRing = mmap(offSQRing, p.sqOff.array+p.sqEntries*4)
+	r.cqRing = mmap(offCQRing, p.cqOff.cqes+p.cqEntries*uint32(unsafe.Sizeof(cqe{})))
+	r.sqeMem = mmap(offSQEs, p.sqEntries*uint32(unsafe.Sizeof(sqe{})))
+	if err != nil {
+		_ = r.Close()
+		return nil, fmt.Errorf("couldn't map io_uring: %w", err)
+	}
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*sqe)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*cqe)(unsafe.Pointer(&r.cqRing[p.cqOff.cqes])), p.cqEntries)
+	return r, nil
+}
+
+// ReadAt reads into each of bufs from the file of descriptor fd at the offset of the same index, submitting all reads
+// at once. It returns the number of bytes of every read, which (like those of read(2)) may be fewer than asked for.
+func (r *Ring) ReadAt(fd uintptr, bufs [][]byte, offsets []int64) ([]int, error) {
+	if r.broken {
+		return nil, errors.New("io_uring is broken by an earlier failure")
+	}
+	if len(bufs) > len(r.sqes) {
+		return nil, fmt.Errorf("%d reads are more than the %d entries of io_uring", len(bufs), len(r.sqes))
+	}
+	tail := atomic.LoadUint32(r.sqTail)
+	for i, buf := range bufs {
+		index := (tail + uint32(i)) & r.sqMask
+		r.sqes[index] = sqe{opcode: opRead, fd: int32(fd), off: uint64(offsets[i]), len: uint32(len(buf)),
+			userData: uint64(i)}
+		if len(buf) > 0 {
+			r.sqes[index].addr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+		}
+		r.sqArray[index] = index
+	}
+	atomic.StoreUint32(r.sqTail, tail+uint32(len(bufs)))
+
+	counts := make([]int, len(bufs))
+	errs := make([]error, len(bufs))
+	submitted, completed := 0, 0
+	reap := func() {
+		head := atomic.LoadUint32(r.cqHead)
+		for ; head != atomic.LoadUint32(r.cqTail); head++ {
+			c := r.cqes[head&r.cqMask]
+			if c.res < 0 {
+				errs[c.userData] = unix.Errno(-c.res)
+			} else {
+				counts[c.userData] = int(c.res)
+			}
+			completed++
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+	for completed < len(bufs) {
+		errno := r.enter(len(bufs)-submitted, 1, &submitted)
+		if errno != 0 {
+			r.broken = true
+			// Reads submitted already write into bufs until they complete, so they're waited for before bufs are
+			// given back (to be reused)
+			for completed < submitted && r.enter(0, submitted-completed, nil) == 0 {
+				reap()
+			}
+			return nil, fmt.Errorf("couldn't submit reads to io_uring: %w", errno)
+		}
+		reap()
+	}
+	runtime.KeepAlive(bufs)
+	return counts, errors.Join(errs...)
+}
+
+// syscall6 is unix.Syscall6, replaceable in tests
+var syscall6 = unix.Syscall6
+
+// enter submits as many reads as toSubmit (adding how many were to submitted, unless it's nil) and waits for at
+// least minComplete completions. Errors that are retryable (EINTR and EAGAIN, and EBUSY of completion queues that are
+// full, which are retried once their completions are reaped) are returned as 0.
+func (r *Ring) enter(toSubmit, minComplete int, submitted *int) unix.Errno {
+	n, _, errno := syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), uintptr(minComplete),
+		enterGetEvents, 0, 0)
+	switch errno {
+	case 0:
+		if submitted != nil {
+			*submitted += int(n)
+		}
+		return 0
+	case unix.EINTR, unix.EAGAIN, unix.EBUSY:
+		return 0
+	default:
+		return errno
+	}
+}
+
+// Close releases the ring
+func (r *Ring) Close() error {
+	var errs []error
+	for _, mem := range [][]byte{r.sqRing, r.cqRing, r.sqeMem} {
+		if mem != nil {
+			errs = append(errs, unix.Munmap(mem))
+		}
+	}
+	errs = append(errs, unix.Close(r.fd))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package uring
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// TestReadAtFailure checks whether reads submitted before a submission fails are completed before ReadAt
+// returns, since buffers are reused once it has, and whether submissions that are busy are retried
+func TestReadAtFailure(t *testing.T) {
+	r, err := New(4)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	defer r.Close()
+	path := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(path, []byte("0123456789"), 0o644))
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	calls := 0
+	syscall6 = func(trap, fd, toSubmit, minComplete, flags, a5, a6 uintptr) (uintptr, uintptr, syscall.Errno) {
+		calls++
+		switch {
+		case calls == 1:
+			return 0, 0, unix.EBUSY
+		case calls == 2:
+			// One read is submitted, and not waited for
+			return unix.Syscall6(trap, fd, 1, 0, flags, a5, a6)
+		case toSubmit > 0:
+			return 0, 0, unix.EBADF
+		default:
+			return unix.Syscall6(trap, fd, toSubmit, minComplete, flags, a5, a6)
+		}
+	}
+	t.Cleanup(func() { syscall6 = unix.Syscall6 })
+	bufs := [][]byte{make([]byte, 4), make([]byte, 4)}
+	_, err = r.ReadAt(f.Fd(), bufs, []int64{0, 4})
+	assert.ErrorIs(t, err, unix.EBADF)
+	assert.Equal(t, "0123", string(bufs[0]))
+	assert.True(t, r.broken)
+}
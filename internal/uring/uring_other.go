@@ -0,0 +1,23 @@
+//go:build !linux
+
+package uring
+
+// Ring is an io_uring instance, which isn't supported on this operating system
+type Ring struct {
+	broken bool
+}
+
+// New returns ErrUnsupported, since io_uring is only on Linux
+func New(uint32) (*Ring, error) {
+	return nil, ErrUnsupported
+}
+
+// ReadAt returns ErrUnsupported
+func (*Ring) ReadAt(uintptr, [][]byte, []int64) ([]int, error) {
+	return nil, ErrUnsupported
+}
+
+// Close does nothing
+func (*Ring) Close() error {
+	return nil
+}
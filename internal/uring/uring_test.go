@@ -0,0 +1,42 @@
+package uring
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolReadAt(t *testing.T) {
+	pool, err := NewPool(4)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	defer pool.Close()
+	content := bytes.Repeat([]byte("0123456789"), 1_000)
+	path := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(path, content, 0o644))
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	for range 3 {
+		r, err := pool.Get()
+		assert.Nil(t, err)
+		bufs := [][]byte{make([]byte, 10), make([]byte, 5), make([]byte, 20)}
+		counts, err := r.ReadAt(f.Fd(), bufs, []int64{0, 5_003, 9_990})
+		assert.Nil(t, err)
+		assert.Equal(t, []int{10, 5, 10}, counts)
+		assert.Equal(t, "0123456789", string(bufs[0]))
+		assert.Equal(t, "34567", string(bufs[1]))
+		assert.Equal(t, "0123456789", string(bufs[2][:counts[2]]))
+		pool.Put(r)
+	}
+	assert.Len(t, pool.all, 1)
+	_, err = pool.all[0].ReadAt(f.Fd(), make([][]byte, 5), make([]int64, 5))
+	assert.NotNil(t, err)
+}
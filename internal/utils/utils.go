@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	set "github.com/deckarep/golang-set/v2"
+	"golang.org/x/text/unicode/norm"
 )
 
 // IsReadableDirectory checks whether argument is a readable directory
@@ -46,8 +47,15 @@ func LineSeparatedStrToMap(lineSeparatedString string) (entries set.Set[string],
 	return
 }
 
-// GetFileExt gets extension of file, in lower case
+// GetFileExt gets extension of file, in lower case (and normalized, see NormalizeName)
 func GetFileExt(path string) string {
-	ext := filepath.Ext(path)
+	ext := NormalizeName(filepath.Ext(path))
 	return strings.ToLower(ext)
 }
+
+// NormalizeName normalizes a name (or path) of a file to NFC, the form of Unicode that most file systems keep names
+// in. Names on volumes of macOS (HFS+) are decomposed (NFD) instead, where, e.g., "é" is "e" followed by a combining
+// accent: names are normalized before they're compared, so that the same name is the same on either.
+func NormalizeName(name string) string {
+	return norm.NFC.String(name)
+}
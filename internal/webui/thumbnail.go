@@ -0,0 +1,72 @@
+package webui
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // decoders of formats that thumbnails are made of
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// thumbnailSize is the maximum width and height of thumbnails, in pixels
+const thumbnailSize = 240
+
+// maxImagePixels is the maximum number of pixels of images that thumbnails are made of, so that huge images don't
+// take up lots of memory
+const maxImagePixels = 100_000_000
+
+// makeThumbnail makes a JPEG thumbnail of the image in f
+func makeThumbnail(f vfs.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, errors.New("image is too large")
+	}
+	src, _, err := image.Decode(io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	var bb bytes.Buffer
+	if err := jpeg.Encode(&bb, scaleDown(src, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
+
+// scaleDown scales src down to fit in a square of side size (if it's larger), averaging 4 samples per pixel
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var r, g, b, a uint32
+			for _, s := range [][2]int{{1, 1}, {3, 1}, {1, 3}, {3, 3}} {
+				sr, sg, sb, sa := src.At(bounds.Min.X+(4*x+s[0])*w/(4*dw), bounds.Min.Y+(4*y+s[1])*h/(4*dh)).RGBA()
+				r, g, b, a = r+sr, g+sg, b+sb, a+sa
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r>>10), uint8(g>>10), uint8(b>>10),
+				uint8(a>>10)
+		}
+	}
+	return dst
+}
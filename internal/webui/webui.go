@@ -0,0 +1,257 @@
+// Package webui serves a web interface on which duplicates found by a scan are reviewed, with previews of images and
+// videos, and selected copies are trashed or replaced with links
+package webui
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/actions"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// maxRequestSize is the maximum size of bodies of requests
+const maxRequestSize = 16 * bytesutil.MEBI
+
+// allowedActions are what can be done to selected copies. Deleting isn't allowed, so that they can be recovered.
+var allowedActions = []actions.Action{actions.Trash, actions.Hardlink, actions.Symlink, actions.Reflink}
+
+var (
+	imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+		".bmp": true, ".svg": true, ".avif": true}
+	videoExtensions = map[string]bool{".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".ogv": true}
+)
+
+// Group is a group of duplicates, as served to the interface
+type Group struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+	// Wasted is the space taken by all copies except one
+	Wasted int64 `json:"wasted"`
+	// Kind is "image" or "video" if copies can be previewed as such, and "other" otherwise
+	Kind  string `json:"kind"`
+	Files []File `json:"files"`
+}
+
+// File is a copy in a group of duplicates
+type File struct {
+	Path     string    `json:"path"`
+	Modified time.Time `json:"modified"`
+	// Done is the action that was done to the file, if any
+	Done string `json:"done,omitempty"`
+}
+
+// ActRequest is an action on copies selected on the interface
+type ActRequest struct {
+	Action string   `json:"action"`
+	Paths  []string `json:"paths"`
+}
+
+// ActResponse is the outcome of an action on selected copies
+type ActResponse struct {
+	Succeeded     int   `json:"succeeded"`
+	Failed        int   `json:"failed"`
+	ReclaimedSize int64 `json:"reclaimedSize"`
+	// Errors are why the action failed, by paths of copies
+	Errors map[string]string `json:"errors"`
+}
+
+type handler struct {
+	result  service.Result
+	fsys    vfs.FS
+	grouped map[string]bool
+	mx      sync.Mutex
+	done    map[string]actions.Action
+}
+
+// NewHandler creates a handler of the interface for duplicates of result, whose files are read from fsys. Requests
+// must carry token (as query parameter "token"), so that other websites open in the browser can't act on files.
+func NewHandler(result service.Result, fsys vfs.FS, token string) http.Handler {
+	if result.Duplicates == nil {
+		result.Duplicates = entity.NewDigestToFiles()
+	}
+	h := &handler{result: result, fsys: fsys, grouped: map[string]bool{}, done: map[string]actions.Action{}}
+	for _, paths := range result.Duplicates.All() {
+		for _, path := range paths {
+			h.grouped[path] = true
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.index)
+	mux.HandleFunc("GET /api/groups", h.groups)
+	mux.HandleFunc("GET /api/file", h.file)
+	mux.HandleFunc("GET /api/thumbnail", h.thumbnail)
+	mux.HandleFunc("POST /api/act", h.act)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+			http.Error(w, "missing or invalid token (open the URL printed on the console)", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) index(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(indexHTML)
+}
+
+func (h *handler) groups(w http.ResponseWriter, _ *http.Request) {
+	groups := []Group{}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	for digest, paths := range h.result.Duplicates.All() {
+		group := Group{Hash: digest.FileHash, Size: digest.FileSize, Wasted: digest.FileSize * int64(len(paths)-1),
+			Kind: kindOf(digest.FileExtension)}
+		sortedPaths := append([]string(nil), paths...)
+		sort.Strings(sortedPaths)
+		for _, path := range sortedPaths {
+			file := File{Path: path, Modified: h.result.AllFiles[path].Modified}
+			if action, isDone := h.done[path]; isDone {
+				file.Done = action.String()
+			}
+			group.Files = append(group.Files, file)
+		}
+		groups = append(groups, group)
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func kindOf(extension string) string {
+	switch ext := strings.ToLower(extension); {
+	case imageExtensions[ext]:
+		return "image"
+	case videoExtensions[ext]:
+		return "video"
+	default:
+		return "other"
+	}
+}
+
+// open opens the file at path of the query, if it's one of the duplicates
+func (h *handler) open(r *http.Request) (vfs.File, string, error) {
+	path := r.URL.Query().Get("path")
+	if !h.grouped[path] {
+		return nil, path, errors.New("not a duplicate found by the scan")
+	}
+	f, err := vfs.OpenFile(h.fsys, path)
+	return f, path, err
+}
+
+func (h *handler) file(w http.ResponseWriter, r *http.Request) {
+	f, path, err := h.open(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	serveFile(w, r, f, path)
+}
+
+func (h *handler) thumbnail(w http.ResponseWriter, r *http.Request) {
+	f, path, err := h.open(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	thumbnail, err := makeThumbnail(f)
+	if err != nil {
+		// Formats that can't be decoded here are left to the browser
+		serveFile(w, r, f, path)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	_, _ = w.Write(thumbnail)
+}
+
+// serveFile serves a scanned file. Files are served on the origin of the interface, so they're sandboxed (as of a
+// unique origin, without scripts) and their types aren't sniffed, and those that aren't previewed as images or videos
+// are downloaded rather than opened, whatever the content type of their extensions.
+func serveFile(w http.ResponseWriter, r *http.Request, f vfs.File, path string) {
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if kindOf(filepath.Ext(path)) == "other" {
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(path)}))
+	}
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), io.NewSectionReader(f, 0, info.Size()))
+}
+
+func (h *handler) act(w http.ResponseWriter, r *http.Request) {
+	var req ActRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	action, err := actions.ActionByName(req.Action)
+	if err != nil || !isAllowed(action) {
+		http.Error(w, fmt.Sprintf("action %q isn't allowed", req.Action), http.StatusBadRequest)
+		return
+	}
+	selected := map[string]bool{}
+	for _, path := range req.Paths {
+		selected[path] = true
+	}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	// Copies acted upon already can't be kept in place of others, nor acted upon again
+	remaining := entity.NewDigestToFiles()
+	for digest, paths := range h.result.Duplicates.All() {
+		for _, path := range paths {
+			if _, isDone := h.done[path]; !isDone {
+				remaining.Set(digest, path)
+			}
+		}
+	}
+	report := actions.ApplySelected(remaining, h.result.AllFiles, func(path string) bool { return selected[path] },
+		actions.Options{Action: action})
+	resp := ActResponse{Succeeded: report.Succeeded, Failed: report.Failed, ReclaimedSize: report.ReclaimedSize,
+		Errors: map[string]string{}}
+	for _, record := range report.Records {
+		if record.Err != nil {
+			resp.Errors[record.Path] = record.Err.Error()
+		} else {
+			h.done[record.Path] = action
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func isAllowed(action actions.Action) bool {
+	for _, a := range allowedActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,116 @@
+package webui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+// TestHandler checks whether groups are listed, previews served and selected copies acted upon
+func TestHandler(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 960, 480))
+	for x := 0; x < 960; x++ {
+		for y := 0; y < 480; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var bb bytes.Buffer
+	assert.Nil(t, png.Encode(&bb, img))
+	dir := t.TempDir()
+	text := bytes.Repeat([]byte("duplicate "), 1_000)
+	for name, content := range map[string][]byte{"a.png": bb.Bytes(), "b.png": bb.Bytes(), "c.txt": text,
+		"d.txt": text, "e.txt": text, "unique.txt": []byte("unique")} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+	}
+	fmte.Off()
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions([]string{dir},
+		service.WithFileSizeThreshold(1)))
+	assert.Nil(t, err)
+	server := httptest.NewServer(NewHandler(result, vfs.Local, "token"))
+	defer server.Close()
+
+	resp, _ := get(t, server.URL+"/?token=wrong")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, body := get(t, server.URL+"/?token=token")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "<title>")
+	_, body = get(t, server.URL+"/api/groups?token=token")
+	var groups []Group
+	assert.Nil(t, json.Unmarshal(body, &groups))
+	assert.Len(t, groups, 2)
+	kinds := map[string]Group{}
+	for _, group := range groups {
+		kinds[group.Kind] = group
+	}
+	assert.Equal(t, int64(2*len(text)), kinds["other"].Wasted)
+	assert.Equal(t, filepath.Join(dir, "a.png"), kinds["image"].Files[0].Path)
+
+	resp, body = get(t, server.URL+"/api/thumbnail?token=token&path="+filepath.Join(dir, "a.png"))
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	thumbnail, err := jpeg.Decode(bytes.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, image.Rect(0, 0, 240, 120), thumbnail.Bounds())
+	req, _ := http.NewRequest("GET", server.URL+"/api/file?token=token&path="+filepath.Join(dir, "c.txt"), nil)
+	req.Header.Set("Range", "bytes=0-8")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "duplicate", string(body))
+	assert.Equal(t, "sandbox", resp.Header.Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "attachment; filename=c.txt", resp.Header.Get("Content-Disposition"))
+	resp, _ = get(t, server.URL+"/api/file?token=token&path="+filepath.Join(dir, "a.png"))
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "sandbox", resp.Header.Get("Content-Security-Policy"))
+	assert.Empty(t, resp.Header.Get("Content-Disposition"))
+	resp, _ = get(t, server.URL+"/api/file?token=token&path="+filepath.Join(dir, "unique.txt"))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	act := func(action string, paths ...string) (int, ActResponse) {
+		reqBody, _ := json.Marshal(ActRequest{Action: action, Paths: paths})
+		resp, err := http.Post(server.URL+"/api/act?token=token", "application/json", bytes.NewReader(reqBody))
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		var actResp ActResponse
+		_ = json.NewDecoder(resp.Body).Decode(&actResp)
+		return resp.StatusCode, actResp
+	}
+	status, _ := act("delete", filepath.Join(dir, "d.txt"))
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, actResp := act("hardlink", filepath.Join(dir, "c.txt"), filepath.Join(dir, "d.txt"))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, actResp.Succeeded)
+	e, _ := os.Stat(filepath.Join(dir, "e.txt"))
+	c, _ := os.Stat(filepath.Join(dir, "c.txt"))
+	assert.True(t, os.SameFile(e, c))
+	// The only copy that's left can't be acted upon
+	_, actResp = act("hardlink", filepath.Join(dir, "e.txt"))
+	assert.Equal(t, 1, actResp.Failed)
+	assert.Contains(t, actResp.Errors[filepath.Join(dir, "e.txt")], "none would be kept")
+	_, body = get(t, server.URL+"/api/groups?token=token")
+	assert.Contains(t, string(body), `"done":"hardlink"`)
+}
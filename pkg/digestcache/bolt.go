@@ -0,0 +1,130 @@
+package digestcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore is a Store backed by a bbolt database file, with one bucket per hashing algorithm and file system (see
+// bucketName)
+type boltStore struct {
+	db *bolt.DB
+}
+
+// bucketName is the name of the bucket of key: the name of the algorithm for files of the local file system, and that
+// followed by a NUL and the identifier of the file system (see Key.FS) for files of other file systems
+func bucketName(key Key) []byte {
+	if key.FS == "" {
+		return []byte(key.Algorithm)
+	}
+	return []byte(key.Algorithm + "\x00" + key.FS)
+}
+
+// bucketKey is the key of path in the bucket named name (see bucketName)
+func bucketKey(name, path []byte) Key {
+	algorithm, fsID, _ := strings.Cut(string(name), "\x00")
+	return Key{Algorithm: algorithm, Path: string(path), FS: fsID}
+}
+
+// OpenBolt opens (creating, if required) a Store backed by the bbolt database file at path.
+// Only one process can have the file open at a time.
+func OpenBolt(path string) (Store, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open digest cache %s: %w", path, err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (b *boltStore) Get(key Key) (entry Entry, found bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName(key))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(key.Path))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &entry)
+	})
+	return entry, found, err
+}
+
+func (b *boltStore) Put(key Key, entry Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, bErr := tx.CreateBucketIfNotExists(bucketName(key))
+		if bErr != nil {
+			return bErr
+		}
+		return bucket.Put([]byte(key.Path), value)
+	})
+}
+
+func (b *boltStore) Prune(keep func(key Key, entry Entry) bool) (removed int, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			var stale [][]byte
+			if fErr := bucket.ForEach(func(path, value []byte) error {
+				var entry Entry
+				if json.Unmarshal(value, &entry) != nil || !keep(bucketKey(name, path), entry) {
+					stale = append(stale, path)
+				}
+				return nil
+			}); fErr != nil {
+				return fErr
+			}
+			for _, path := range stale {
+				if dErr := bucket.Delete(path); dErr != nil {
+					return dErr
+				}
+			}
+			removed += len(stale)
+			return nil
+		})
+	})
+	return removed, err
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+// WriteBolt writes entries to the bbolt database file at path (creating it, if required) in one transaction, which is
+// much faster for many entries than putting them one by one, as every Put is synced to disk
+func WriteBolt(path string, entries map[Key]Entry) error {
+	store, err := OpenBolt(path)
+	if err != nil {
+		return err
+	}
+	b := store.(*boltStore)
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		for key, entry := range entries {
+			value, mErr := json.Marshal(entry)
+			if mErr != nil {
+				return mErr
+			}
+			bucket, bErr := tx.CreateBucketIfNotExists(bucketName(key))
+			if bErr != nil {
+				return bErr
+			}
+			if pErr := bucket.Put([]byte(key.Path), value); pErr != nil {
+				return pErr
+			}
+		}
+		return nil
+	})
+	if cErr := b.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
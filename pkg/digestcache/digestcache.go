@@ -0,0 +1,101 @@
+// Package digestcache is a persistent store of file hashes, so that files that haven't changed since they were last
+// hashed don't need to be read again. A cached hash is valid only as long as the size and modification time of
+// the file remain the same.
+package digestcache
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// Key identifies a file's contents, as hashed by a particular algorithm
+type Key struct {
+	// Algorithm is the name of the hashing algorithm
+	Algorithm string
+	// Path of the file
+	Path string
+	// FS identifies the file system of the file (see vfs.ID), so that files of the same paths of other file systems
+	// (such as objects of buckets passed to WithFS of package service) don't get each other's hashes. It's empty
+	// for the local file system, whose keys are the same as those of versions before it was added.
+	FS string
+}
+
+// cohortAlgorithm is the algorithm of keys of cohorts (see CohortKey)
+const cohortAlgorithm = "unique-cohort"
+
+// CohortKey is the key of the marker of a cohort of files of the same extension and size, all of which a scan told
+// apart from each other, so that later scans don't hash them again until the cohort changes. Hash of the entry of a
+// marker is a fingerprint of files of the cohort (their paths, sizes and modification times), and its modification
+// time is when they were told apart.
+func CohortKey(extension string, size int64) Key {
+	return Key{Algorithm: cohortAlgorithm, Path: fmt.Sprintf("%s/%d", extension, size)}
+}
+
+// IsCohort checks whether the key is of the marker of a cohort (see CohortKey), rather than of a file
+func (k Key) IsCohort() bool {
+	return k.Algorithm == cohortAlgorithm
+}
+
+// Entry is a cached hash along with metadata of the file at the time it was hashed
+type Entry struct {
+	// Size of the file, in bytes
+	Size int64 `json:"size"`
+	// ModifiedTimestamp is the modification time of the file, in nanoseconds since the Unix epoch
+	ModifiedTimestamp int64 `json:"mtime"`
+	// Hash of the file's contents
+	Hash string `json:"hash"`
+}
+
+// Matches checks whether the entry is still valid for a file with the given metadata
+func (e Entry) Matches(info fs.FileInfo) bool {
+	return e.Size == info.Size() && e.ModifiedTimestamp == info.ModTime().UnixNano()
+}
+
+// NewEntry creates an Entry for a file with the given metadata
+func NewEntry(info fs.FileInfo, hash string) Entry {
+	return Entry{Size: info.Size(), ModifiedTimestamp: info.ModTime().UnixNano(), Hash: hash}
+}
+
+// Store is a store of cached hashes. Implementations must be goroutine-safe.
+type Store interface {
+	// Get gets the entry for the key, if one exists
+	Get(key Key) (entry Entry, found bool, err error)
+	// Put sets the entry for the key, replacing any existing one
+	Put(key Key, entry Entry) error
+	// Prune removes all entries for which keep returns false, and returns the number of entries removed
+	Prune(keep func(key Key, entry Entry) bool) (removed int, err error)
+	// Close releases resources held by the store
+	Close() error
+}
+
+// Lookup gets the cached hash for a file with the given metadata, if the cached hash is still valid
+func Lookup(store Store, key Key, info fs.FileInfo) (hash string, found bool, err error) {
+	entry, found, err := store.Get(key)
+	if err != nil || !found || !entry.Matches(info) {
+		return "", false, err
+	}
+	return entry.Hash, true, nil
+}
+
+// PruneStale removes entries of files of the file system identified by fsID (see Key.FS) that no longer exist or that
+// have changed since they were hashed, by stat of that file system. Entries of other file systems are kept.
+func PruneStale(store Store, fsID string, stat func(path string) (fs.FileInfo, error)) (removed int, err error) {
+	return store.Prune(func(key Key, entry Entry) bool {
+		if key.FS != fsID {
+			return true
+		}
+		info, statErr := stat(key.Path)
+		return statErr == nil && entry.Matches(info)
+	})
+}
+
+// Count counts entries of store, by names of their hashing algorithms
+func Count(store Store) (counts map[string]int, err error) {
+	counts = map[string]int{}
+	// Pruning nothing visits all entries
+	_, err = store.Prune(func(key Key, _ Entry) bool {
+		counts[key.Algorithm]++
+		return true
+	})
+	return counts, err
+}
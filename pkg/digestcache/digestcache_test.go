@@ -0,0 +1,206 @@
+package digestcache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+type fakeInfo struct {
+	fs.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) ModTime() time.Time { return f.modTime }
+
+func testStore(t *testing.T, store Store) {
+	info := fakeInfo{size: 42, modTime: time.Unix(1_700_000_000, 5)}
+	key := Key{Algorithm: "sha256", Path: "/photos/1.jpg"}
+	_, found, err := Lookup(store, key, info)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, store.Put(key, NewEntry(info, "abcd")))
+	assert.Nil(t, store.Put(Key{Algorithm: "crc32", Path: "/photos/1.jpg"}, NewEntry(info, "12")))
+	hash, found, err := Lookup(store, key, info)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "abcd", hash)
+	// Files of the same path of another file system are told apart
+	remote := Key{Algorithm: "sha256", Path: "/photos/1.jpg", FS: "s3://photos"}
+	_, found, err = Lookup(store, remote, info)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, store.Put(remote, NewEntry(info, "efgh")))
+	hash, _, _ = Lookup(store, remote, info)
+	assert.Equal(t, "efgh", hash)
+	hash, _, _ = Lookup(store, key, info)
+	assert.Equal(t, "abcd", hash)
+	counts, err := Count(store)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"sha256": 2, "crc32": 1}, counts)
+	var keys []Key
+	_, err = store.Prune(func(key Key, _ Entry) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []Key{key, remote, {Algorithm: "crc32", Path: "/photos/1.jpg"}}, keys)
+	_, found, _ = Lookup(store, key, fakeInfo{size: 42, modTime: time.Unix(1_700_000_001, 0)})
+	assert.False(t, found, "entry of a modified file shouldn't be used")
+	removed, err := store.Prune(func(key Key, _ Entry) bool { return key.Algorithm != "crc32" })
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	_, found, _ = store.Get(Key{Algorithm: "crc32", Path: "/photos/1.jpg"})
+	assert.False(t, found)
+	_, found, _ = store.Get(key)
+	assert.True(t, found)
+	assert.Nil(t, store.Close())
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestBoltStore(t *testing.T) {
+	store, err := OpenBolt(filepath.Join(t.TempDir(), "cache.db"))
+	assert.Nil(t, err)
+	testStore(t, store)
+}
+
+// TestBoltStoreLocalBuckets checks whether entries of the local file system are in buckets named by algorithms only,
+// as they were before keys had file systems, so that caches of earlier versions are still used
+func TestBoltStoreLocalBuckets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := bolt.Open(path, 0o644, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		bucket, bErr := tx.CreateBucket([]byte("sha256"))
+		if bErr != nil {
+			return bErr
+		}
+		return bucket.Put([]byte("/photos/1.jpg"), []byte(`{"size":42,"mtime":1700000000000000005,"hash":"abcd"}`))
+	}))
+	assert.Nil(t, db.Close())
+	store, err := OpenBolt(path)
+	assert.Nil(t, err)
+	info := fakeInfo{size: 42, modTime: time.Unix(1_700_000_000, 5)}
+	hash, found, err := Lookup(store, Key{Algorithm: "sha256", Path: "/photos/1.jpg"}, info)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "abcd", hash)
+	assert.Nil(t, store.Close())
+}
+
+// TestPruneStale checks whether entries of files of the file system that were deleted or modified are removed, and
+// those of other file systems kept
+func TestPruneStale(t *testing.T) {
+	info := fakeInfo{size: 42, modTime: time.Unix(1_700_000_000, 5)}
+	store := NewMemory()
+	for _, key := range []Key{{Algorithm: "sha256", Path: "/photos/1.jpg"}, {Algorithm: "sha256", Path: "/photos/2.jpg"},
+		{Algorithm: "sha256", Path: "/photos/3.jpg"}, {Algorithm: "sha256", Path: "/photos/2.jpg", FS: "s3://photos"}} {
+		assert.Nil(t, store.Put(key, NewEntry(info, "abcd")))
+	}
+	removed, err := PruneStale(store, "", func(path string) (fs.FileInfo, error) {
+		switch path {
+		case "/photos/1.jpg":
+			return info, nil
+		case "/photos/3.jpg":
+			return fakeInfo{size: 43, modTime: info.modTime}, nil
+		default:
+			return nil, fs.ErrNotExist
+		}
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	counts, _ := Count(store)
+	assert.Equal(t, map[string]int{"sha256": 2}, counts)
+	_, found, _ := store.Get(Key{Algorithm: "sha256", Path: "/photos/2.jpg", FS: "s3://photos"})
+	assert.True(t, found)
+}
+
+func TestWriteBolt(t *testing.T) {
+	info := fakeInfo{size: 42, modTime: time.Unix(1_700_000_000, 5)}
+	path := filepath.Join(t.TempDir(), "checkpoint.db")
+	key := Key{Algorithm: "sha256", Path: "/photos/1.jpg"}
+	assert.Nil(t, WriteBolt(path, map[Key]Entry{key: NewEntry(info, "abcd"),
+		{Algorithm: "crc32", Path: "/photos/1.jpg"}: NewEntry(info, "12")}))
+	store, err := OpenBolt(path)
+	assert.Nil(t, err)
+	hash, found, err := Lookup(store, key, info)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "abcd", hash)
+	counts, err := Count(store)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"sha256": 1, "crc32": 1}, counts)
+	assert.Nil(t, store.Close())
+}
+
+func TestTieredStore(t *testing.T) {
+	info := fakeInfo{size: 42, modTime: time.Unix(1_700_000_000, 5)}
+	key := Key{Algorithm: "sha256", Path: "/photos/1.jpg"}
+	first, second := NewMemory(), NewMemory()
+	assert.Nil(t, second.Put(key, NewEntry(info, "abcd")))
+	store := NewTiered(first, second)
+	hash, found, err := Lookup(store, key, info)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "abcd", hash)
+	assert.Nil(t, store.Put(key, NewEntry(info, "efgh")))
+	hash, _, _ = Lookup(first, key, info)
+	assert.Equal(t, "efgh", hash)
+	hash, _, _ = Lookup(store, key, info)
+	assert.Equal(t, "efgh", hash)
+	assert.Nil(t, store.Close())
+}
+
+// TestXattrStore checks whether entries are kept in extended attributes of files, where they're supported
+func TestXattrStore(t *testing.T) {
+	store, err := NewXattr()
+	if err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(t.TempDir(), "1.jpg")
+	assert.Nil(t, os.WriteFile(path, []byte("photo"), 0o644))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	key := Key{Algorithm: "sha256", Path: path}
+	_, found, err := Lookup(store, key, info)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, store.Put(key, NewEntry(info, "abcd")))
+	hash, found, err := Lookup(store, key, info)
+	assert.Nil(t, err)
+	if !found {
+		t.Skip("file system of temporary files doesn't support extended attributes")
+	}
+	assert.Equal(t, "abcd", hash)
+	_, found, _ = Lookup(store, Key{Algorithm: "crc32", Path: path}, info)
+	assert.False(t, found)
+	_, found, _ = Lookup(store, key, fakeInfo{size: 5, modTime: time.Unix(1_700_000_001, 0)})
+	assert.False(t, found, "entry of a modified file shouldn't be used")
+	// Files that don't exist are skipped
+	assert.Nil(t, store.Put(Key{Algorithm: "sha256", Path: path + ".missing"}, NewEntry(info, "abcd")))
+	// As are files of other file systems
+	remote := Key{Algorithm: "sha256", Path: path, FS: "s3://photos"}
+	assert.Nil(t, store.Put(remote, NewEntry(info, "efgh")))
+	hash, _, _ = Lookup(store, key, info)
+	assert.Equal(t, "abcd", hash)
+	_, found, _ = Lookup(store, remote, info)
+	assert.False(t, found)
+	// And markers of cohorts, which aren't of files
+	cohort := CohortKey(".jpg", 5)
+	assert.True(t, cohort.IsCohort())
+	assert.Nil(t, store.Put(cohort, NewEntry(info, "abcd")))
+	_, found, err = store.Get(cohort)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, store.Close())
+}
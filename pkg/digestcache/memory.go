@@ -0,0 +1,46 @@
+package digestcache
+
+import "sync"
+
+// memoryStore is a Store that holds entries in memory
+type memoryStore struct {
+	mx      sync.RWMutex
+	entries map[Key]Entry
+}
+
+// NewMemory creates a Store that holds entries in memory only. This is useful for pre-seeding a scan with hashes
+// known from elsewhere, and for tests.
+func NewMemory() Store {
+	return &memoryStore{entries: make(map[Key]Entry)}
+}
+
+func (m *memoryStore) Get(key Key) (Entry, bool, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	entry, found := m.entries[key]
+	return entry, found, nil
+}
+
+func (m *memoryStore) Put(key Key, entry Entry) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.entries[key] = entry
+	return nil
+}
+
+func (m *memoryStore) Prune(keep func(key Key, entry Entry) bool) (int, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	removed := 0
+	for key, entry := range m.entries {
+		if !keep(key, entry) {
+			delete(m.entries, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
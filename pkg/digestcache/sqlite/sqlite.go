@@ -0,0 +1,114 @@
+// Package sqlite is a digestcache.Store backed by a SQLite database file, which (unlike files of digestcache.OpenBolt)
+// other programs can query and seed with SQL, and open while this has it open. It's a package of its own so that
+// only programs that use it link SQLite (a port of it to Go, which needs no cgo).
+//
+// Entries are rows of table digests, of columns fs (see digestcache.Key.FS), algorithm, path, size, mtime (in
+// nanoseconds since the Unix epoch) and hash.
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS digests (
+	fs TEXT NOT NULL,
+	algorithm TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mtime INTEGER NOT NULL,
+	hash TEXT NOT NULL,
+	PRIMARY KEY (fs, algorithm, path)
+) WITHOUT ROWID`
+
+// store is a Store backed by a SQLite database
+type store struct {
+	db *sql.DB
+}
+
+// Open opens (creating, if required) a Store backed by the SQLite database file at path. Other processes may have the
+// file open too, as they wait for each other's writes (for up to 5 seconds).
+func Open(path string) (digestcache.Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err == nil {
+		// Writes of SQLite are serialized anyway, and one connection spares them waiting for each other
+		db.SetMaxOpenConns(1)
+		_, err = db.Exec(schema)
+		if err != nil {
+			_ = db.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open digest cache %s: %w", path, err)
+	}
+	return &store{db: db}, nil
+}
+
+func (s *store) Get(key digestcache.Key) (entry digestcache.Entry, found bool, err error) {
+	err = s.db.QueryRow("SELECT size, mtime, hash FROM digests WHERE fs = ? AND algorithm = ? AND path = ?",
+		key.FS, key.Algorithm, key.Path).Scan(&entry.Size, &entry.ModifiedTimestamp, &entry.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return digestcache.Entry{}, false, nil
+	}
+	return entry, err == nil, err
+}
+
+func (s *store) Put(key digestcache.Key, entry digestcache.Entry) error {
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO digests (fs, algorithm, path, size, mtime, hash) VALUES (?, ?, ?, ?, ?, ?)",
+		key.FS, key.Algorithm, key.Path, entry.Size, entry.ModifiedTimestamp, entry.Hash)
+	return err
+}
+
+func (s *store) Prune(keep func(key digestcache.Key, entry digestcache.Entry) bool) (removed int, err error) {
+	// Stale entries are found first, and deleted once rows are read, as the only connection reads them
+	stale, err := s.stale(keep)
+	if err != nil || len(stale) == 0 {
+		return 0, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, key := range stale {
+		if _, err := tx.Exec("DELETE FROM digests WHERE fs = ? AND algorithm = ? AND path = ?",
+			key.FS, key.Algorithm, key.Path); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// stale returns keys of entries for which keep returns false
+func (s *store) stale(keep func(key digestcache.Key, entry digestcache.Entry) bool) ([]digestcache.Key, error) {
+	rows, err := s.db.Query("SELECT fs, algorithm, path, size, mtime, hash FROM digests")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stale []digestcache.Key
+	for rows.Next() {
+		var key digestcache.Key
+		var entry digestcache.Entry
+		if err := rows.Scan(&key.FS, &key.Algorithm, &key.Path, &entry.Size, &entry.ModifiedTimestamp,
+			&entry.Hash); err != nil {
+			return nil, err
+		}
+		if !keep(key, entry) {
+			stale = append(stale, key)
+		}
+	}
+	return stale, rows.Err()
+}
+
+func (s *store) Close() error {
+	return s.db.Close()
+}
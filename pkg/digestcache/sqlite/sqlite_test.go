@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.sqlite")
+	store, err := Open(path)
+	assert.Nil(t, err)
+	key := digestcache.Key{Algorithm: "sha256", Path: "/photos/1.jpg"}
+	entry := digestcache.Entry{Size: 42, ModifiedTimestamp: 1_700_000_000_000_000_005, Hash: "abcd"}
+	_, found, err := store.Get(key)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, store.Put(key, entry))
+	assert.Nil(t, store.Put(digestcache.Key{Algorithm: "crc32", Path: "/photos/1.jpg"}, entry))
+	// Files of the same path of another file system are told apart
+	remote := digestcache.Key{Algorithm: "sha256", Path: "/photos/1.jpg", FS: "s3://photos"}
+	assert.Nil(t, store.Put(remote, digestcache.Entry{Size: 42, Hash: "efgh"}))
+	got, found, err := store.Get(key)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, entry, got)
+	got, _, _ = store.Get(remote)
+	assert.Equal(t, "efgh", got.Hash)
+	// Entries are replaced
+	entry.Hash = "dcba"
+	assert.Nil(t, store.Put(key, entry))
+	counts, err := digestcache.Count(store)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"sha256": 2, "crc32": 1}, counts)
+	removed, err := store.Prune(func(key digestcache.Key, _ digestcache.Entry) bool { return key.Algorithm != "crc32" })
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Nil(t, store.Close())
+
+	// Entries persist
+	store, err = Open(path)
+	assert.Nil(t, err)
+	got, found, err = store.Get(key)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "dcba", got.Hash)
+	_, found, _ = store.Get(digestcache.Key{Algorithm: "crc32", Path: "/photos/1.jpg"})
+	assert.False(t, found)
+	assert.Nil(t, store.Close())
+}
+
+// TestOpenInvalid checks whether files that aren't SQLite databases, and databases that can't be created, are refused
+func TestOpenInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.db")
+	assert.Nil(t, os.WriteFile(path, bytes.Repeat([]byte("not a database "), 100), 0o644))
+	_, err := Open(path)
+	assert.NotNil(t, err)
+	_, err = Open(filepath.Join(dir, "missing", "cache.sqlite"))
+	assert.NotNil(t, err)
+}
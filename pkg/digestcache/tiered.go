@@ -0,0 +1,54 @@
+package digestcache
+
+import "errors"
+
+// tieredStore is a Store of stores, which are consulted in their order
+type tieredStore []Store
+
+// NewTiered creates a Store of stores (such as extended attributes of files, and a database file), of which Get gets
+// the entry of the first store that has one, and Put puts entries into all
+func NewTiered(stores ...Store) Store {
+	return tieredStore(stores)
+}
+
+func (t tieredStore) Get(key Key) (Entry, bool, error) {
+	var errs []error
+	for _, store := range t {
+		entry, found, err := store.Get(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if found {
+			return entry, true, nil
+		}
+	}
+	return Entry{}, false, errors.Join(errs...)
+}
+
+func (t tieredStore) Put(key Key, entry Entry) error {
+	var errs []error
+	for _, store := range t {
+		errs = append(errs, store.Put(key, entry))
+	}
+	return errors.Join(errs...)
+}
+
+func (t tieredStore) Prune(keep func(key Key, entry Entry) bool) (int, error) {
+	var errs []error
+	removed := 0
+	for _, store := range t {
+		n, err := store.Prune(keep)
+		removed += n
+		errs = append(errs, err)
+	}
+	return removed, errors.Join(errs...)
+}
+
+func (t tieredStore) Close() error {
+	var errs []error
+	for _, store := range t {
+		errs = append(errs, store.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package digestcache
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// XattrPrefix is the prefix of names of extended attributes that NewXattr caches hashes in, which is followed by the
+// name of the hashing algorithm (e.g. "user.gfd.sha256")
+const XattrPrefix = "user.gfd."
+
+// ErrXattrUnsupported is returned by NewXattr on operating systems without extended attributes (that this supports)
+var ErrXattrUnsupported = errors.New("extended attributes aren't supported on this operating system")
+
+// xattrStore is a Store that keeps entries in extended attributes of the files they're of
+type xattrStore struct{}
+
+// NewXattr creates a Store that keeps the entry of a file in an extended attribute of the file itself, so that it
+// moves (and is copied, by tools that keep extended attributes) along with the file, and needs no database. Paths of
+// keys are those of the local file system.
+//
+// Files whose extended attributes can't be set (on file systems that don't support them, and files that are
+// read-only to this process) are skipped silently, as are files that no longer exist, files of file systems other than
+// the local one (see Key.FS), and markers of cohorts (see CohortKey), which aren't of files. Since entries can't be
+// listed, Prune removes none.
+func NewXattr() (Store, error) {
+	if !xattrsSupported {
+		return nil, ErrXattrUnsupported
+	}
+	return xattrStore{}, nil
+}
+
+func (xattrStore) Get(key Key) (Entry, bool, error) {
+	if key.IsCohort() || key.FS != "" {
+		return Entry{}, false, nil
+	}
+	value, found, err := getXattr(key.Path, XattrPrefix+key.Algorithm)
+	if err != nil || !found {
+		return Entry{}, false, err
+	}
+	var entry Entry
+	if json.Unmarshal(value, &entry) != nil {
+		// Not set by this, or by an incompatible version of it
+		return Entry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+func (xattrStore) Put(key Key, entry Entry) error {
+	if key.IsCohort() || key.FS != "" {
+		return nil
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return setXattr(key.Path, XattrPrefix+key.Algorithm, value)
+}
+
+func (xattrStore) Prune(func(key Key, entry Entry) bool) (int, error) {
+	return 0, nil
+}
+
+func (xattrStore) Close() error {
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build darwin || freebsd
+
+package digestcache
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is the error of getting an extended attribute that a file doesn't have
+const errNoXattr = unix.ENOATTR
@@ -0,0 +1,6 @@
+package digestcache
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is the error of getting an extended attribute that a file doesn't have
+const errNoXattr = unix.ENODATA
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package digestcache
+
+const xattrsSupported = false
+
+func getXattr(string, string) ([]byte, bool, error) {
+	return nil, false, ErrXattrUnsupported
+}
+
+func setXattr(string, string, []byte) error {
+	return ErrXattrUnsupported
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd
+
+package digestcache
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+const xattrsSupported = true
+
+// xattrMaxSize is the most bytes an entry takes in an extended attribute, which is enough for the longest hashes
+const xattrMaxSize = 512
+
+// getXattr gets the named extended attribute of the file at path, if it has one
+func getXattr(path, name string) ([]byte, bool, error) {
+	buf := make([]byte, xattrMaxSize)
+	n, err := unix.Getxattr(path, name, buf)
+	if err != nil {
+		if isSkipped(err) || errors.Is(err, errNoXattr) || errors.Is(err, unix.ERANGE) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("couldn't get extended attribute %s of %s: %w", name, path, err)
+	}
+	return buf[:n], true, nil
+}
+
+// setXattr sets the named extended attribute of the file at path, unless it can't have one
+func setXattr(path, name string, value []byte) error {
+	if err := unix.Setxattr(path, name, value, 0); err != nil && !isSkipped(err) {
+		return fmt.Errorf("couldn't set extended attribute %s of %s: %w", name, path, err)
+	}
+	return nil
+}
+
+// isSkipped checks whether err is of a file whose extended attributes are skipped
+func isSkipped(err error) bool {
+	for _, skipped := range []error{unix.ENOTSUP, unix.EOPNOTSUPP, unix.EPERM, unix.EACCES, unix.EROFS, unix.ENOENT} {
+		if errors.Is(err, skipped) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+// Package metrics has counters, gauges and histograms that can be exposed through expvar and in the text format of
+// Prometheus, without depending on a Prometheus client library.
+//
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a goroutine-safe value that only goes up
+type Counter struct {
+	name string
+	help string
+	v    atomic.Int64
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+// Value returns current value of the counter
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Gauge is a goroutine-safe value that can go up and down
+type Gauge struct {
+	name string
+	help string
+	v    atomic.Int64
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v int64) {
+	g.v.Store(v)
+}
+
+// Add adds n (which may be negative) to the gauge
+func (g *Gauge) Add(n int64) {
+	g.v.Add(n)
+}
+
+// Value returns current value of the gauge
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+// Histogram is a goroutine-safe distribution of observed values, counted in buckets of upper bounds
+type Histogram struct {
+	name    string
+	help    string
+	mx      sync.Mutex
+	bounds  []float64
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+// Observe records the value v
+func (h *Histogram) Observe(v float64) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	i := sort.SearchFloat64s(h.bounds, v)
+	if i < len(h.buckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramSnapshot is the state of a Histogram at a point in time
+type HistogramSnapshot struct {
+	// Buckets are cumulative counts of values less than or equal to each of Bounds
+	Buckets []int64   `json:"buckets"`
+	Bounds  []float64 `json:"bounds"`
+	Count   int64     `json:"count"`
+	Sum     float64   `json:"sum"`
+}
+
+// Snapshot returns current state of the histogram
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	s := HistogramSnapshot{Bounds: h.bounds, Count: h.count, Sum: h.sum, Buckets: make([]int64, len(h.buckets))}
+	var cumulative int64
+	for i, n := range h.buckets {
+		cumulative += n
+		s.Buckets[i] = cumulative
+	}
+	return s
+}
+
+// Registry is a set of named metrics. A nil *Registry is valid: metrics created through it just aren't exposed.
+type Registry struct {
+	mx         sync.Mutex
+	counters   []*Counter
+	gauges     []*Gauge
+	histograms []*Histogram
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounter creates a Counter and registers it by name (which should follow Prometheus naming conventions)
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	if r != nil {
+		r.mx.Lock()
+		r.counters = append(r.counters, c)
+		r.mx.Unlock()
+	}
+	return c
+}
+
+// NewGauge creates a Gauge and registers it by name
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	if r != nil {
+		r.mx.Lock()
+		r.gauges = append(r.gauges, g)
+		r.mx.Unlock()
+	}
+	return g
+}
+
+// NewHistogram creates a Histogram with given upper bounds of buckets, and registers it by name
+func (r *Registry) NewHistogram(name, help string, bounds []float64) *Histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	h := &Histogram{name: name, help: help, bounds: bounds, buckets: make([]int64, len(bounds))}
+	if r != nil {
+		r.mx.Lock()
+		r.histograms = append(r.histograms, h)
+		r.mx.Unlock()
+	}
+	return h
+}
+
+// WritePrometheus writes all metrics in the text format of Prometheus
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mx.Lock()
+	counters := append([]*Counter(nil), r.counters...)
+	gauges := append([]*Gauge(nil), r.gauges...)
+	histograms := append([]*Histogram(nil), r.histograms...)
+	r.mx.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, escapeHelp(c.help), c.name, c.name,
+			c.Value())
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, escapeHelp(g.help), g.name, g.name,
+			g.Value())
+	}
+	for _, h := range histograms {
+		s := h.Snapshot()
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", h.name, escapeHelp(h.help), h.name)
+		for i, bound := range s.Bounds {
+			fmt.Fprintf(bw, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(bound), s.Buckets[i])
+		}
+		fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n", h.name, s.Count, h.name,
+			formatFloat(s.Sum), h.name, s.Count)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves all metrics in the text format of Prometheus, so that a Registry can be mounted at /metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WritePrometheus(w)
+}
+
+// PublishExpvar exposes all metrics (including those registered later) as a single expvar variable of given name,
+// which appears at /debug/vars. Like expvar.Publish, this panics if the name is already in use.
+func (r *Registry) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		vars := make(map[string]any, len(r.counters)+len(r.gauges)+len(r.histograms))
+		for _, c := range r.counters {
+			vars[c.name] = c.Value()
+		}
+		for _, g := range r.gauges {
+			vars[g.name] = g.Value()
+		}
+		for _, h := range r.histograms {
+			vars[h.name] = h.Snapshot()
+		}
+		return vars
+	}))
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return fmt.Sprintf("%g", f)
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWritePrometheus checks whether counters, gauges and histograms are written in text format of Prometheus
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("files_total", "Number of files")
+	h := r.NewHistogram("latency_seconds", "Latency", []float64{1, 0.1})
+	g := r.NewGauge("waste_bytes", "Wasted space")
+	c.Add(3)
+	g.Set(10)
+	g.Add(-4)
+	for _, v := range []float64{0.05, 0.5, 0.1, 7} {
+		h.Observe(v)
+	}
+	var bb bytes.Buffer
+	assert.Nil(t, r.WritePrometheus(&bb))
+	assert.Equal(t, `# HELP files_total Number of files
+# TYPE files_total counter
+files_total 3
+# HELP waste_bytes Wasted space
+# TYPE waste_bytes gauge
+waste_bytes 6
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 7.65
+latency_seconds_count 4
+`, bb.String())
+}
+
+// TestPublishExpvar checks whether metrics are exposed through expvar, and that a nil Registry works
+func TestPublishExpvar(t *testing.T) {
+	r := NewRegistry()
+	r.PublishExpvar("test_metrics")
+	r.NewCounter("files_total", "Number of files").Add(2)
+	var vars map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get("test_metrics").String()), &vars))
+	assert.Equal(t, float64(2), vars["files_total"])
+
+	var unregistered *Registry
+	c := unregistered.NewCounter("files_total", "Number of files")
+	c.Add(1)
+	assert.Equal(t, int64(1), c.Value())
+}
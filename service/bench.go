@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// DefaultBenchSampleSize is the default amount of file data each hashing trial of Bench reads
+const DefaultBenchSampleSize = 64 * 1024 * 1024
+
+// BenchResult is the outcome of Bench
+type BenchResult struct {
+	// Entries is the number of files and directories walked
+	Entries int
+	// WalkTime is the time taken to walk through directories (without reading metadata of files)
+	WalkTime time.Duration
+	// Files is the number of regular files whose metadata was read
+	Files int
+	// StatTime is the time taken to read metadata of files
+	StatTime time.Duration
+	// Parallelism has results of hashing at increasing parallelism, using the default hasher
+	Parallelism []HashTrial
+	// Algorithms has results of hashing with each of the hashers, at the parallelism recommended
+	Algorithms []HashTrial
+}
+
+// HashTrial is the outcome of hashing a sample of files
+type HashTrial struct {
+	Algorithm   string
+	Parallelism int
+	// Files is the number of files hashed successfully
+	Files int
+	// Bytes is the total size of files hashed successfully
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// FilesPerSecond is the rate at which files were hashed
+func (t HashTrial) FilesPerSecond() float64 {
+	return perSecond(float64(t.Files), t.Elapsed)
+}
+
+// BytesPerSecond is the rate at which file data was hashed
+func (t HashTrial) BytesPerSecond() float64 {
+	return perSecond(float64(t.Bytes), t.Elapsed)
+}
+
+// EntriesPerSecond is the rate at which directories were walked
+func (r BenchResult) EntriesPerSecond() float64 {
+	return perSecond(float64(r.Entries), r.WalkTime)
+}
+
+// StatsPerSecond is the rate at which metadata of files was read
+func (r BenchResult) StatsPerSecond() float64 {
+	return perSecond(float64(r.Files), r.StatTime)
+}
+
+// RecommendedParallelism is the parallelism at which files were hashed fastest
+func (r BenchResult) RecommendedParallelism() int {
+	best := HashTrial{Parallelism: DefaultParallelism()}
+	for _, t := range r.Parallelism {
+		if t.FilesPerSecond() > best.FilesPerSecond() {
+			best = t
+		}
+	}
+	return best.Parallelism
+}
+
+// FastestFullHasher is the fastest of hashers that read entire file contents (empty if none were tried)
+func (r BenchResult) FastestFullHasher() string {
+	var best HashTrial
+	for _, t := range r.Algorithms {
+		if !IsSampled(t.Algorithm) && t.BytesPerSecond() > best.BytesPerSecond() {
+			best = t
+		}
+	}
+	return best.Algorithm
+}
+
+// FastestSampledHasher is the fastest of hashers that hash crucial bytes of files only (empty if none were tried)
+func (r BenchResult) FastestSampledHasher() string {
+	var best HashTrial
+	for _, t := range r.Algorithms {
+		if IsSampled(t.Algorithm) && t.FilesPerSecond() > best.FilesPerSecond() {
+			best = t
+		}
+	}
+	return best.Algorithm
+}
+
+// Bench measures how fast directories given in opts can be walked, how fast metadata of files can be read and how
+// fast files can be hashed, at various parallelism and with each of the hashers. Every hashing trial reads a
+// different set of files of total size about sampleSize, so that trials aren't skewed by OS's file cache
+// (unless there aren't enough files).
+func Bench(ctx context.Context, opts Options, sampleSize int64) (result BenchResult, err error) {
+	opts = opts.withDefaults()
+	opts.FS = vfs.WithContext(opts.FS, ctx)
+	if sampleSize <= 0 {
+		sampleSize = DefaultBenchSampleSize
+	}
+	var paths []string
+	start := time.Now()
+	for _, dir := range opts.Directories {
+		wErr := vfs.WalkDir(opts.FS, dir, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				if path == dir {
+					return &FileError{Path: path, Kind: ErrNotReadable, Err: err}
+				}
+				return nil
+			}
+			if opts.isExcluded(d.Name()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			result.Entries++
+			if d.Type().IsRegular() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if wErr != nil {
+			return result, wErr
+		}
+	}
+	result.WalkTime = time.Since(start)
+
+	var samples []sample
+	start = time.Now()
+	for _, path := range paths {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		info, sErr := opts.FS.Lstat(path)
+		if sErr != nil {
+			continue
+		}
+		result.Files++
+		if info.Mode().IsRegular() && info.Size() >= opts.FileSizeThreshold {
+			samples = append(samples, sample{path: path, info: info})
+		}
+	}
+	result.StatTime = time.Since(start)
+	if len(samples) == 0 {
+		return result, nil
+	}
+
+	next := 0
+	trial := func(hasher Hasher, parallelism int) (HashTrial, error) {
+		var batch []sample
+		var size int64
+		for i := 0; i < len(samples) && size < sampleSize; i++ {
+			s := samples[(next+i)%len(samples)]
+			batch = append(batch, s)
+			size += s.info.Size()
+		}
+		next = (next + len(batch)) % len(samples)
+		return hashSamples(ctx, opts.FS, hasher, parallelism, batch)
+	}
+	for _, parallelism := range benchParallelisms() {
+		t, tErr := trial(DefaultHasher, parallelism)
+		if tErr != nil {
+			return result, tErr
+		}
+		result.Parallelism = append(result.Parallelism, t)
+	}
+	parallelism := result.RecommendedParallelism()
+	for _, name := range HasherNames() {
+		t, tErr := trial(Hashers[name], parallelism)
+		if tErr != nil {
+			return result, tErr
+		}
+		result.Algorithms = append(result.Algorithms, t)
+	}
+	return result, nil
+}
+
+type sample struct {
+	path string
+	info fs.FileInfo
+}
+
+// hashSamples hashes given files using as many goroutines as parallelism
+func hashSamples(ctx context.Context, fsys vfs.FS, hasher Hasher, parallelism int, samples []sample) (HashTrial,
+	error,
+) {
+	t := HashTrial{Algorithm: hasher.Name(), Parallelism: parallelism}
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan sample)
+	start := time.Now()
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range work {
+				if _, err := hasher.HashFile(ctx, fsys, s.path, s.info); err != nil {
+					continue
+				}
+				mx.Lock()
+				t.Files++
+				t.Bytes += s.info.Size()
+				mx.Unlock()
+			}
+		}()
+	}
+	for _, s := range samples {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- s
+	}
+	close(work)
+	wg.Wait()
+	t.Elapsed = time.Since(start)
+	return t, ctx.Err()
+}
+
+// benchParallelisms are powers of 2 up to twice the number of cores (storage such as network drives benefits from
+// more concurrent reads than there are cores)
+func benchParallelisms() []int {
+	var ps []int
+	for p := 1; p <= 2*runtime.NumCPU(); p *= 2 {
+		ps = append(ps, p)
+	}
+	if d := DefaultParallelism(); !slices.Contains(ps, d) {
+		ps = append(ps, d)
+		slices.Sort(ps)
+	}
+	return ps
+}
+
+func perSecond(n float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return n / d.Seconds()
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBench checks whether Bench walks, stats and hashes all files, with each of the hashers
+func TestBench(t *testing.T) {
+	content := bytes.Repeat([]byte("benchmark "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":        {Data: content},
+		"a/2.txt":        {Data: content},
+		"a/b/3.txt":      {Data: content},
+		"a/b/small.txt":  {Data: []byte("tiny")},
+		"a/vendor/4.txt": {Data: content},
+	})
+	result, err := Bench(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithExcludedFiles(set.NewThreadUnsafeSet("vendor")), WithFileSizeThreshold(1_024)), int64(len(content)))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, result.Entries)
+	assert.Equal(t, 4, result.Files)
+	assert.Equal(t, benchParallelisms(), parallelismsOf(result.Parallelism))
+	assert.Len(t, result.Algorithms, len(Hashers))
+	for _, trial := range append(result.Parallelism, result.Algorithms...) {
+		assert.Equal(t, 1, trial.Files)
+		assert.Equal(t, int64(len(content)), trial.Bytes)
+	}
+	assert.Contains(t, benchParallelisms(), result.RecommendedParallelism())
+	assert.False(t, IsSampled(result.FastestFullHasher()))
+	assert.True(t, IsSampled(result.FastestSampledHasher()))
+}
+
+func parallelismsOf(trials []HashTrial) (ps []int) {
+	for _, t := range trials {
+		ps = append(ps, t.Parallelism)
+	}
+	return ps
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+)
+
+// copyBufferSize is the size of buffers that contents of files are streamed into hashes through
+const copyBufferSize = 64 * bytesutil.KIBI
+
+// Pools of buffers that files are read into, so that hashing millions of files doesn't allocate buffers for each
+var (
+	// sampleBuffers are of thresholdFileSize bytes, which is the size of crucial bytes of files larger than that, and
+	// the most of smaller files (read entirely)
+	sampleBuffers = sync.Pool{New: func() any {
+		buf := make([]byte, thresholdFileSize)
+		return &buf
+	}}
+	// largeSampleBuffers are of maxSampleSize bytes, which crucial bytes of large files are read into (see sampleSize)
+	largeSampleBuffers = sync.Pool{New: func() any {
+		buf := make([]byte, maxSampleSize)
+		return &buf
+	}}
+	copyBuffers = sync.Pool{New: func() any {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	}}
+)
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// CachingHasher is a Hasher that reuses hashes from a digestcache.Store for files that haven't changed since they
+// were last hashed, and records the hashes it computes
+type CachingHasher struct {
+	Hasher
+	Store digestcache.Store
+	// Metrics, if set, count hits and misses of the cache
+	Metrics *ScanMetrics
+	// Logger is told of failures to cache hashes (defaults to fmte.Global)
+	Logger fmte.Logger
+}
+
+// NewCachingHasher wraps hasher, so that it reuses and records hashes in store
+func NewCachingHasher(hasher Hasher, store digestcache.Store) *CachingHasher {
+	return &CachingHasher{Hasher: hasher, Store: store}
+}
+
+// HashFile gets the hash from the cache if it's still valid, computing (and caching) it otherwise
+func (c *CachingHasher) HashFile(ctx context.Context, fsys vfs.FS, path string, info fs.FileInfo) (string, error) {
+	key := digestcache.Key{Algorithm: c.Name(), Path: path, FS: vfs.ID(fsys)}
+	if hash, found, err := digestcache.Lookup(c.Store, key, info); err == nil && found &&
+		!isStaleSample(c.Name(), hash, info.Size()) {
+		if c.Metrics != nil {
+			c.Metrics.CacheHits.Add(1)
+		}
+		return hash, nil
+	}
+	if c.Metrics != nil {
+		c.Metrics.CacheMisses.Add(1)
+	}
+	hash, err := c.Hasher.HashFile(ctx, fsys, path, info)
+	if err != nil {
+		return "", err
+	}
+	if pErr := c.Store.Put(key, digestcache.NewEntry(info, hash)); pErr != nil {
+		logger := c.Logger
+		if logger == nil {
+			logger = fmte.Global
+		}
+		logger.PrintfErr("couldn't cache hash of %s: %+v\n", path, pErr)
+	}
+	return hash, nil
+}
+
+// isCached checks whether the cache has a valid hash of the file of fsys, whose metadata is info
+func (c *CachingHasher) isCached(fsys vfs.FS, path string, info fs.FileInfo) bool {
+	key := digestcache.Key{Algorithm: c.Name(), Path: path, FS: vfs.ID(fsys)}
+	hash, found, err := digestcache.Lookup(c.Store, key, info)
+	return err == nil && found && !isStaleSample(c.Name(), hash, info.Size())
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// cohortFingerprint is a fingerprint of files of a cohort (files of the same extension and size, whose paths are
+// sorted), by their paths and modification times, or false if some of them weren't found while walking
+func (o Options) cohortFingerprint(paths []string) (string, bool) {
+	h := sha256.New()
+	for _, path := range paths {
+		meta, walked := o.walked[path]
+		if !walked {
+			return "", false
+		}
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(meta.Modified.UnixNano())))
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// cohortKey is the key of the marker of the cohort of files of the file system of the scan
+func (o Options) cohortKey(extAndSize entity.FileExtAndSize) digestcache.Key {
+	key := digestcache.CohortKey(extAndSize.FileExtension, extAndSize.FileSize)
+	key.FS = vfs.ID(o.FS)
+	return key
+}
+
+// isKnownUnique checks whether the cache has a marker of the cohort that's still valid, i.e. whether an earlier scan
+// told apart all files of the cohort, and none have been added to it, removed from it or modified since
+func (o Options) isKnownUnique(extAndSize entity.FileExtAndSize, fingerprint string) bool {
+	if o.Cache == nil || fingerprint == "" {
+		return false
+	}
+	entry, found, err := o.Cache.Get(o.cohortKey(extAndSize))
+	return err == nil && found && entry.Hash == fingerprint
+}
+
+// markUnique records in the cache that all files of the cohort were told apart from each other (as of now)
+func (o Options) markUnique(extAndSize entity.FileExtAndSize, fingerprint string) {
+	if o.Cache == nil || fingerprint == "" {
+		return
+	}
+	entry := digestcache.Entry{Size: extAndSize.FileSize, ModifiedTimestamp: time.Now().UnixNano(), Hash: fingerprint}
+	if err := o.Cache.Put(o.cohortKey(extAndSize), entry); err != nil {
+		o.Logger.PrintfErr("couldn't cache that files of size %d are unique: %+v\n", extAndSize.FileSize, err)
+	}
+}
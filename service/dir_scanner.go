@@ -1,58 +1,185 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"io/fs"
 	"path/filepath"
 	"strings"
+	"time"
 
-	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/go-find-duplicates/entity"
-	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/vfs"
 )
 
-// populateFilesFromDirectory scans the given directory and populates the given map with the files
-func populateFilesFromDirectory(dirPathToScan string, exclusions set.Set[string], fileSizeThreshold int64,
-	allFiles entity.FilePathToMeta) (
+// populateFilesFromDirectory scans the given directory and adds the files to the given index. Links (symbolic
+// links, and junctions and other reparse points on Windows) are skipped, unless links is set, by which they're
+// followed. The directory itself is walked even if it's a link, since it's given explicitly. Links and other files
+// that aren't regular files skipped are counted in result.
+func populateFilesFromDirectory(ctx context.Context, opts Options, dirPathToScan string, index *fileIndex,
+	links *linkFollower, result *Result) (
 	sizeOfScannedFiles int64,
 	err error,
 ) {
-	wErr := filepath.WalkDir(dirPathToScan, func(path string, d fs.DirEntry, err error) error {
+	// addFile adds a file that filters accepted, if it's large enough
+	addFile := func(path string, info fs.FileInfo) error {
+		if info.Size() < opts.FileSizeThreshold {
+			return nil
+		}
+		meta := entity.FileMeta{Size: info.Size(), Modified: info.ModTime()}
+		if addErr := index.add(path, meta); addErr != nil {
+			return addErr
+		}
+		opts.Listener.OnFileDiscovered(path, meta)
+		sizeOfScannedFiles += info.Size()
+		return nil
+	}
+	var walkFn fs.WalkDirFunc
+	// Directories are read ahead of walkFn, which is called for one file at a time still
+	walker := vfs.Walker{FS: opts.FS, Workers: opts.WalkWorkers}
+	followLink := func(path string) error {
+		realPath, resolved := vfs.ResolveLinks(opts.FS, path)
+		info, statErr := opts.FS.Stat(path)
+		if !resolved || statErr != nil {
+			opts.Logger.PrintfErr("skipping link \"%s\", which couldn't be followed\n", path)
+			result.SkippedLinks++
+			return nil
+		}
+		if info.IsDir() && links.followDir(realPath) {
+			return walker.WalkLinkedDir(path, walkFn)
+		}
+		if info.Mode().IsRegular() && links.followFile(realPath) {
+			opts.Metrics.FilesWalked.Add(1)
+			if !opts.acceptsFile(path, info) {
+				return nil
+			}
+			return addFile(path, info)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			result.SkippedIrregular++
+		}
+		return nil
+	}
+	walkFn = func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
-			fmte.PrintfErr("skipping \"%s\": %+v\n", path, errors.Unwrap(err))
+			fileErr := &FileError{Path: path, Kind: ErrNotReadable, Err: err}
+			if path == dirPathToScan {
+				return fileErr
+			}
+			opts.Logger.PrintfErr("skipping \"%s\": %+v\n", path, errors.Unwrap(err))
+			opts.Listener.OnError(path, fileErr)
 			return nil
 		}
-		// If the file/directory is in excluded allFiles list, ignore it
-		if exclusions.Contains(d.Name()) {
+		// If the file/directory is in excluded files list, ignore it
+		if opts.isExcluded(d.Name()) {
 			if d.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
-		if _, exists := allFiles[path]; exists {
+		if index.has(path) {
 			return nil
 		}
-		// Ignore dot allFiles (Mac)
+		// Ignore dot files (Mac)
 		if strings.HasPrefix(d.Name(), "._") {
 			return nil
 		}
+		if d.IsDir() && len(opts.FileFilters) > 0 && path != dirPathToScan {
+			if !opts.acceptsFile(path, &entryInfo{DirEntry: d}) {
+				return filepath.SkipDir
+			}
+		}
+		if vfs.IsLink(d.Type()) {
+			if links != nil {
+				return followLink(path)
+			}
+			result.SkippedLinks++
+			if opts.ReportSymlinks {
+				opts.Logger.Printf("skipping link \"%s\"\n", path)
+			}
+			return nil
+		}
 		if d.Type().IsRegular() {
-			info, infoErr := d.Info()
-			if infoErr != nil {
-				fmte.PrintfErr("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
+			opts.Metrics.FilesWalked.Add(1)
+			// Files are statted only once filters (most of which need just their names) accept them
+			entry := &entryInfo{DirEntry: d}
+			if !opts.acceptsFile(path, entry) {
 				return nil
 			}
-			if info.Size() < fileSizeThreshold {
+			info, infoErr := entry.stat()
+			if infoErr != nil {
+				opts.Logger.PrintfErr("couldn't get metadata of \"%s\": %+v\n", path, infoErr)
+				opts.Listener.OnError(path, newFileError(path, ErrNotReadable, infoErr))
 				return nil
 			}
-			allFiles[path] = entity.FileMeta{Size: info.Size(), ModifiedTimestamp: info.ModTime().Unix()}
-			sizeOfScannedFiles += info.Size()
+			return addFile(path, info)
+		}
+		if !d.IsDir() {
+			result.SkippedIrregular++
 		}
 		return nil
-	})
+	}
+	wErr := walker.WalkLinkedDir(dirPathToScan, walkFn)
 	if wErr != nil {
-		return -1, fmt.Errorf("couldn't scan directory %s: %w", dirPathToScan, wErr)
+		return -1, wErr
 	}
 	return sizeOfScannedFiles, nil
 }
+
+// entryInfo is the fs.FileInfo of a fs.DirEntry, by which names and types of files (as read from their directories)
+// are known without statting them. A file is statted only once more of its metadata (such as its size) is needed.
+type entryInfo struct {
+	fs.DirEntry
+	info   fs.FileInfo
+	err    error
+	loaded bool
+}
+
+// stat returns metadata of the file, statting it if it isn't statted yet
+func (e *entryInfo) stat() (fs.FileInfo, error) {
+	if !e.loaded {
+		e.info, e.err = e.DirEntry.Info()
+		e.loaded = true
+	}
+	return e.info, e.err
+}
+
+// statted returns metadata of the file, statting it if needed, or nil if it couldn't be statted
+func (e *entryInfo) statted() fs.FileInfo {
+	info, err := e.stat()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+func (e *entryInfo) Size() int64 {
+	if info := e.statted(); info != nil {
+		return info.Size()
+	}
+	return 0
+}
+
+func (e *entryInfo) Mode() fs.FileMode {
+	if info := e.statted(); info != nil {
+		return info.Mode()
+	}
+	return e.Type()
+}
+
+func (e *entryInfo) ModTime() time.Time {
+	if info := e.statted(); info != nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+func (e *entryInfo) Sys() any {
+	if info := e.statted(); info != nil {
+		return info.Sys()
+	}
+	return nil
+}
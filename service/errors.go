@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Kinds of errors returned by this package, to be checked with errors.Is
+var (
+	// ErrNotReadable indicates that a file or directory couldn't be read
+	ErrNotReadable = errors.New("not readable")
+	// ErrNotRegularFile indicates that a hash was requested for something other than a regular file
+	ErrNotRegularFile = errors.New("not a regular file")
+	// ErrFileVanished indicates that a file no longer exists, even though it was found while scanning
+	ErrFileVanished = errors.New("file vanished")
+	// ErrHashFailed indicates that the hash of a file couldn't be computed
+	ErrHashFailed = errors.New("hash failed")
+	// ErrFileChanged indicates that a file changed (by its size or modification time) while it was being scanned, so
+	// that its hash may not be of its contents anymore
+	ErrFileChanged = errors.New("file changed during the scan")
+)
+
+// FileError records an error of one of the above kinds along with the file that caused it
+type FileError struct {
+	// Path of the file or directory
+	Path string
+	// Kind is one of ErrNotReadable, ErrNotRegularFile, ErrFileVanished, ErrHashFailed or ErrFileChanged
+	Kind error
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (e *FileError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %v", e.Path, e.Kind)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Path, e.Kind, e.Err)
+}
+
+// Is reports whether target is the kind of this error
+func (e *FileError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the underlying error
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// newFileError creates a FileError of the given kind, unless err indicates that the file doesn't exist anymore
+func newFileError(path string, kind error, err error) *FileError {
+	if errors.Is(err, fs.ErrNotExist) {
+		kind = ErrFileVanished
+	}
+	return &FileError{Path: path, Kind: kind, Err: err}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+const (
+	// firstEscalationChunk is the size of the first chunk of files that escalation compares. Each chunk after it is
+	// escalationGrowth times as large as the previous one.
+	firstEscalationChunk = thresholdFileSize
+	escalationGrowth     = 4
+	// maxEscalation is how much of a file escalation compares at most, before files that still collide are hashed
+	// entirely
+	maxEscalation = 16 * bytesutil.MEBI
+)
+
+// escalate splits files that collide by their fast hashes (and have the same size) by comparing chunks of their
+// contents, each larger than the previous one, so that files that differ early aren't hashed entirely by the
+// verifier. Files told apart from all others are resolved: they can't be duplicates of any. The rest are returned in
+// groups of files whose chunks compared are all the same, to be verified by their entire contents.
+//
+// Since the verifier reads all of a file that still collides, chunks compared are at most half of it (and at most
+// maxEscalation), so that the file isn't mostly read twice. Files aren't compared if the strong hash of any of them
+// is known without reading it, nor are files of groups that couldn't be read (so that verification reports errors).
+func escalate(ctx context.Context, opts Options, paths []string, size int64) (groups [][]string, resolved []string) {
+	for _, path := range paths {
+		if strongHashIsKnown(opts, path) {
+			// Verifying costs nothing, at least for some of the files
+			return [][]string{paths}, nil
+		}
+	}
+	limit := min(size/2, maxEscalation)
+	colliding := [][]string{paths}
+	for offset, chunk := int64(0), int64(firstEscalationChunk); offset < limit && len(colliding) > 0; {
+		chunk = min(chunk, limit-offset)
+		var split [][]string
+		for _, group := range colliding {
+			byChunk, err := splitByChunk(opts.FS, group, offset, chunk)
+			if ctx.Err() != nil {
+				return nil, nil
+			}
+			if err != nil {
+				groups = append(groups, group)
+				continue
+			}
+			for _, chunkPaths := range byChunk {
+				if len(chunkPaths) == 1 {
+					resolved = append(resolved, chunkPaths[0])
+				} else {
+					split = append(split, chunkPaths)
+				}
+			}
+		}
+		colliding = split
+		offset += chunk
+		chunk *= escalationGrowth
+	}
+	return append(groups, colliding...), resolved
+}
+
+// splitByChunk splits files by CRC32s of their chunks at offset
+func splitByChunk(fsys vfs.FS, paths []string, offset, size int64) (map[uint32][]string, error) {
+	byChunk := make(map[uint32][]string, len(paths))
+	for _, path := range paths {
+		sum, err := chunkChecksum(fsys, path, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		byChunk[sum] = append(byChunk[sum], path)
+	}
+	return byChunk, nil
+}
+
+// strongHashIsKnown checks whether the verifier's hash of the file is known without reading it: to the file system,
+// or to the cache
+func strongHashIsKnown(opts Options, path string) bool {
+	if _, known := vfs.Checksum(opts.FS, path, opts.Verifier.Name()); known {
+		return true
+	}
+	cachingHasher, isCaching := opts.Verifier.(*CachingHasher)
+	if !isCaching {
+		return false
+	}
+	info, err := opts.fileInfo(path)
+	return err == nil && cachingHasher.isCached(opts.FS, path, info)
+}
+
+// chunkChecksum computes CRC32 of the chunk of the file at offset
+func chunkChecksum(fsys vfs.FS, path string, offset, size int64) (uint32, error) {
+	file, err := vfs.OpenFile(fsys, path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	h := crc32.NewIEEE()
+	if _, err := io.CopyBuffer(h, io.NewSectionReader(file, offset, size), *buf); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
@@ -1,32 +1,69 @@
 package service
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"fmt"
-	"hash"
-	"hash/crc32"
-	"os"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/m-manu/go-find-duplicates/bytesutil"
 	"github.com/m-manu/go-find-duplicates/entity"
-	"github.com/m-manu/go-find-duplicates/utils"
-	"github.com/samber/lo"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/vfs"
 )
 
 const (
 	thresholdFileSize = 16 * bytesutil.KIBI
+	// maxSampleSize is the most crucial bytes read of a file (see sampleSize)
+	maxSampleSize = 4 * bytesutil.MEBI
+	// sampleSizeDivisor is how many times as large as its crucial bytes a large file is
+	sampleSizeDivisor = 1_000
 )
 
-// GetDigest generates entity.FileDigest of the file provided
-func GetDigest(path string, isThorough bool) (entity.FileDigest, error) {
-	info, err := os.Lstat(path)
-	if err != nil {
+// sampleSize is the size of crucial bytes of a file of the size (larger than thresholdFileSize): a thousandth of it,
+// in multiples of thresholdFileSize, between thresholdFileSize and maxSampleSize. That way, multi-GB videos that share
+// headers and trailers (such as those of the same camera) differ in more of what's sampled of them, and so aren't
+// grouped as potential duplicates, while files of up to a few dozen MB are sampled as before.
+func sampleSize(fileSize int64) int64 {
+	size := fileSize / sampleSizeDivisor / thresholdFileSize * thresholdFileSize
+	return min(max(size, thresholdFileSize), maxSampleSize)
+}
+
+// isStaleSample checks whether a hash of a file of the size by the named hasher was computed from fewer crucial bytes
+// than sampleSize sets, by an earlier version of this program (and so can't be compared with those computed now)
+func isStaleSample(algorithm, hash string, fileSize int64) bool {
+	return IsSampled(algorithm) && sampleSize(fileSize) > thresholdFileSize && !strings.HasPrefix(hash, "a")
+}
+
+// GetDigest generates entity.FileDigest of the file provided, using the given hasher.
+// Errors returned, other than those of ctx, are of type *FileError.
+func GetDigest(ctx context.Context, fsys vfs.FS, path string, hasher Hasher) (entity.FileDigest, error) {
+	return getDigest(ctx, fsys, path, hasher, fsys.Lstat)
+}
+
+// getDigest is GetDigest, with metadata of the file got by stat
+func getDigest(ctx context.Context, fsys vfs.FS, path string, hasher Hasher,
+	stat func(string) (fs.FileInfo, error),
+) (entity.FileDigest, error) {
+	if err := ctx.Err(); err != nil {
 		return entity.FileDigest{}, err
 	}
-	h, err := fileHash(path, isThorough)
+	info, err := stat(path)
 	if err != nil {
-		return entity.FileDigest{}, err
+		return entity.FileDigest{}, newFileError(path, ErrNotReadable, err)
+	}
+	if !info.Mode().IsRegular() {
+		return entity.FileDigest{}, newFileError(path, ErrNotRegularFile, nil)
+	}
+	h, err := hashFile(ctx, fsys, path, info, hasher)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return entity.FileDigest{}, ctxErr
+	}
+	if err != nil {
+		return entity.FileDigest{}, newFileError(path, ErrHashFailed, err)
 	}
 
 	return entity.FileDigest{
@@ -36,63 +73,119 @@ func GetDigest(path string, isThorough bool) (entity.FileDigest, error) {
 	}, nil
 }
 
-// fileHash calculates the hash of the file provided.
-// If isThorough is true, then it uses SHA256 of the entire file.
-// Otherwise, it uses CRC32 of "crucial bytes" of the file.
-func fileHash(path string, isThorough bool) (string, error) {
-	fileInfo, statErr := os.Lstat(path)
-	if statErr != nil {
-		return "", fmt.Errorf("couldn't stat: %w", statErr)
+// UpgradeDigest upgrades digest of the file provided with a strong hash by the given hasher, unless it already has one.
+// Errors returned, other than those of ctx, are of type *FileError.
+func UpgradeDigest(ctx context.Context, fsys vfs.FS, path string, digest entity.FileDigest, hasher Hasher) (
+	entity.FileDigest, error,
+) {
+	return upgradeDigest(ctx, fsys, path, digest, hasher, fsys.Lstat)
+}
+
+// upgradeDigest is UpgradeDigest, with metadata of the file got by stat
+func upgradeDigest(ctx context.Context, fsys vfs.FS, path string, digest entity.FileDigest, hasher Hasher,
+	stat func(string) (fs.FileInfo, error),
+) (entity.FileDigest, error) {
+	return digest.Upgrade(hasher.Name(), func() (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		info, err := stat(path)
+		if err != nil {
+			return "", newFileError(path, ErrNotReadable, err)
+		}
+		h, err := hashFile(ctx, fsys, path, info, hasher)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		if err != nil {
+			return "", newFileError(path, ErrHashFailed, err)
+		}
+		return h, nil
+	})
+}
+
+// walkedFile is the fs.FileInfo of a regular file found while walking, as of its entity.FileMeta
+type walkedFile struct {
+	name string
+	meta entity.FileMeta
+}
+
+func (f walkedFile) Name() string       { return f.name }
+func (f walkedFile) Size() int64        { return f.meta.Size }
+func (f walkedFile) Mode() fs.FileMode  { return 0 }
+func (f walkedFile) ModTime() time.Time { return f.meta.Modified }
+func (f walkedFile) IsDir() bool        { return false }
+func (f walkedFile) Sys() any           { return nil }
+
+// fileInfo returns metadata of the file: that found while walking, if it was, so that files are statted once
+func (o Options) fileInfo(path string) (fs.FileInfo, error) {
+	if meta, walked := o.walked[path]; walked {
+		return walkedFile{name: filepath.Base(path), meta: meta}, nil
 	}
-	if !fileInfo.Mode().IsRegular() {
-		return "", fmt.Errorf("can't compute hash of non-regular file")
+	return o.FS.Lstat(path)
+}
+
+// changedSinceWalked checks whether the file found while walking isn't of the size and modification time it was found
+// with anymore (or doesn't exist anymore), returning the error by which it's considered changed
+func (o Options) changedSinceWalked(path string) error {
+	meta, walked := o.walked[path]
+	if !walked {
+		return nil
 	}
-	var prefix string
-	var bytes []byte
-	var fileReadErr error
-	switch {
-	case isThorough:
-		bytes, fileReadErr = os.ReadFile(path)
-	case fileInfo.Size() <= thresholdFileSize:
-		prefix = "f"
-		bytes, fileReadErr = os.ReadFile(path)
-	default:
-		prefix = "s"
-		bytes, fileReadErr = readCrucialBytes(path, fileInfo.Size())
+	info, err := o.FS.Stat(path)
+	if err != nil {
+		return newFileError(path, ErrFileChanged, err)
 	}
-	if fileReadErr != nil {
-		return "", fmt.Errorf("couldn't calculate hash: %w", fileReadErr)
+	if info.Size() != meta.Size || !info.ModTime().Equal(meta.Modified) {
+		return newFileError(path, ErrFileChanged, nil)
 	}
+	return nil
+}
 
-	h := lo.TernaryF(isThorough, sha256.New, func() hash.Hash { return crc32.NewIEEE() })
-
-	if _, err := h.Write(bytes); err != nil {
-		return "", fmt.Errorf("error while computing hash: %w", err)
+// hashFile gets the hash of the file from fsys if it's known there, and computes it otherwise
+func hashFile(ctx context.Context, fsys vfs.FS, path string, info fs.FileInfo, hasher Hasher) (string, error) {
+	if checksum, known := vfs.Checksum(fsys, path, hasher.Name()); known {
+		return checksum, nil
 	}
-	hashBytes := h.Sum(nil)
-	return prefix + hex.EncodeToString(hashBytes), nil
+	return hasher.HashFile(ctx, fsys, path, info)
 }
 
-// readCrucialBytes reads the first few bytes, middle bytes and last few bytes of the file
-func readCrucialBytes(filePath string, fileSize int64) ([]byte, error) {
-	file, err := os.Open(filePath)
+// readCrucialBytes reads the first few bytes, middle bytes and last few bytes of the file into buf, which is of
+// sampleSize bytes: half of it from the start, a quarter from the middle and a quarter from the end
+func readCrucialBytes(fsys vfs.FS, filePath string, fileSize int64, buf []byte) error {
+	file, err := vfs.OpenFile(fsys, filePath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer file.Close()
 
-	firstBytes := make([]byte, thresholdFileSize/2)
-	if _, err := file.ReadAt(firstBytes, 0); err != nil {
-		return nil, fmt.Errorf("couldn't read first few bytes (maybe file is corrupted?): %w", err)
+	size := len(buf)
+	firstBytes := buf[:size/2]
+	middleBytes := buf[size/2 : size*3/4]
+	lastBytes := buf[size*3/4:]
+	// Read at once, where the file system can (see vfs.BatchReaderAt)
+	if err := vfs.ReadAtBatch(file, [][]byte{firstBytes, middleBytes, lastBytes},
+		[]int64{0, fileSize / 2, fileSize - int64(len(lastBytes))}); err != nil {
+		return fmt.Errorf("couldn't read crucial bytes (maybe file is corrupted?): %w", err)
 	}
-	middleBytes := make([]byte, thresholdFileSize/4)
-	if _, err := file.ReadAt(middleBytes, fileSize/2); err != nil {
-		return nil, fmt.Errorf("couldn't read middle bytes (maybe file is corrupted?): %w", err)
+	return nil
+}
+
+// readSmallFile reads all of the file into buf, if it fits there (and into a larger buffer otherwise, if the file
+// has grown since it was found), returning what's read
+func readSmallFile(fsys vfs.FS, filePath string, buf []byte) ([]byte, error) {
+	file, err := fsys.Open(filePath)
+	if err != nil {
+		return nil, err
 	}
-	lastBytes := make([]byte, thresholdFileSize/4)
-	if _, err := file.ReadAt(lastBytes, fileSize-thresholdFileSize/4); err != nil {
-		return nil, fmt.Errorf("couldn't read end bytes (maybe file is corrupted?): %w", err)
+	defer file.Close()
+	n, err := io.ReadFull(file, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:n], nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	bytes := append(append(firstBytes, middleBytes...), lastBytes...)
-	return bytes, nil
+	rest, err := io.ReadAll(file)
+	return append(buf[:n:n], rest...), err
 }
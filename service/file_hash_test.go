@@ -1,11 +1,23 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"testing/fstest"
 
 	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/vfs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,17 +32,244 @@ func TestGetDigest(t *testing.T) {
 		filepath.Join(goRoot, "/src/io/pipe.go"),
 	}
 	for _, path := range paths {
-		digest, err := GetDigest(path, false)
+		digest, err := GetDigest(context.Background(), vfs.Local, path, SampledHasher{})
 		assert.Equal(t, nil, err)
 		assert.Greater(t, digest.FileSize, int64(0))
 		assert.Equal(t, 9, len(digest.FileHash))
 		assert.Greater(t, len(digest.FileExtension), 0)
 	}
 	for _, path := range paths {
-		digest, err := GetDigest(path, true)
+		digest, err := GetDigest(context.Background(), vfs.Local, path, SHA256Hasher{})
 		assert.Equal(t, nil, err)
 		assert.Greater(t, digest.FileSize, int64(0))
 		assert.Equal(t, 64, len(digest.FileHash))
 		assert.Greater(t, len(digest.FileExtension), 0)
 	}
 }
+
+func TestHashers(t *testing.T) {
+	path := filepath.Join(runtime.GOROOT(), "/src/io/io.go")
+	expectedLengths := map[string]int{"sampled": 9, "sampled-crc32c": 9, "crc32": 8, "sha256": 64, "blake3": 64,
+		"md5": 32, "s3etag": 32, "crc32c": 8, "dropbox": 64, "quickxor": 40}
+	for _, name := range HasherNames() {
+		hasher, err := HasherByName(name)
+		assert.Nil(t, err)
+		digest, err := GetDigest(context.Background(), vfs.Local, path, hasher)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedLengths[name], len(digest.FileHash), "hash length of %s", name)
+		again, err := GetDigest(context.Background(), vfs.Local, path, hasher)
+		assert.Nil(t, err)
+		assert.Equal(t, digest, again)
+	}
+	_, err := HasherByName("md4")
+	assert.NotNil(t, err)
+}
+
+// TestSampledHasherBuffers checks whether pooled buffers that files are read into leave nothing of a file read
+// earlier in hashes of those read later, and whether hashing is done without allocating buffers for each file
+func TestSampledHasherBuffers(t *testing.T) {
+	large := bytes.Repeat([]byte("large "), 10_000)
+	small := []byte("small")
+	fsys := vfs.FromFS(fstest.MapFS{"large.txt": {Data: large}, "small.txt": {Data: small}})
+	hash := func(path string) string {
+		digest, err := GetDigest(context.Background(), fsys, path, SampledHasher{})
+		assert.Nil(t, err)
+		return digest.FileHash
+	}
+	assert.Equal(t, "f"+hex.EncodeToString(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(small))),
+		hash("small.txt"))
+	largeHash := hash("large.txt")
+	assert.Equal(t, largeHash, hash("large.txt"))
+	assert.Equal(t, "f"+hex.EncodeToString(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(small))),
+		hash("small.txt"))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for range 100 {
+		hash("large.txt")
+	}
+	runtime.ReadMemStats(&after)
+	assert.Less(t, (after.TotalAlloc-before.TotalAlloc)/100, uint64(thresholdFileSize))
+}
+
+// TestSampledCRC32CHasher checks whether crucial bytes are hashed by CRC32C, and whether it's the default hasher only
+// where CRC32C is computed by instructions of the CPU (so that it may be faster)
+func TestSampledCRC32CHasher(t *testing.T) {
+	small := []byte("small")
+	fsys := vfs.FromFS(fstest.MapFS{"small.txt": {Data: small}})
+	digest, err := GetDigest(context.Background(), fsys, "small.txt", SampledCRC32CHasher{})
+	assert.Nil(t, err)
+	checksum := crc32.Checksum(small, crc32.MakeTable(crc32.Castagnoli))
+	assert.Equal(t, "f"+hex.EncodeToString(binary.BigEndian.AppendUint32(nil, checksum)), digest.FileHash)
+	if !castagnoliAccelerated() {
+		assert.Equal(t, SampledHasher{}, DefaultHasher)
+	}
+	assert.True(t, IsSampled(DefaultHasher.Name()))
+	assert.False(t, IsSampled(CRC32CHasher{}.Name()))
+}
+
+// BenchmarkSampledHashers compares hashers of crucial bytes of large files, either of which may be the default hasher
+func BenchmarkSampledHashers(b *testing.B) {
+	fsys := vfs.FromFS(fstest.MapFS{"large.bin": {Data: bytes.Repeat([]byte("large "), 1_000_000)}})
+	info, err := fsys.Stat("large.bin")
+	assert.Nil(b, err)
+	for _, hasher := range []Hasher{SampledHasher{}, SampledCRC32CHasher{}} {
+		b.Run(hasher.Name(), func(b *testing.B) {
+			for range b.N {
+				_, _ = hasher.HashFile(context.Background(), fsys, "large.bin", info)
+			}
+		})
+	}
+}
+
+func TestSampleSize(t *testing.T) {
+	assert.Equal(t, int64(thresholdFileSize), sampleSize(thresholdFileSize+1))
+	assert.Equal(t, int64(thresholdFileSize), sampleSize(20*bytesutil.MEBI))
+	assert.Equal(t, int64(64*bytesutil.KIBI), sampleSize(70*bytesutil.MEBI))
+	assert.Equal(t, int64(maxSampleSize), sampleSize(50*bytesutil.GIBI))
+}
+
+// TestSampledHasherLargeFiles checks whether more crucial bytes are hashed of large files, so that files that share
+// headers and trailers aren't potential duplicates, and whether hashes of them that were cached by earlier versions
+// (of fewer crucial bytes) aren't used
+func TestSampledHasherLargeFiles(t *testing.T) {
+	video := bytes.Repeat([]byte("frame "), 6_000_000)
+	other := bytes.Clone(video)
+	// Beyond the first half of what was sampled of every file before, but within that of files this large now
+	other[10_000] = '!'
+	fsys := vfs.FromFS(fstest.MapFS{"video.mp4": {Data: video}, "other.mp4": {Data: other}})
+	hash := func(path string, hasher Hasher) string {
+		digest, err := GetDigest(context.Background(), fsys, path, hasher)
+		assert.Nil(t, err)
+		return digest.FileHash
+	}
+	assert.Equal(t, "a", hash("video.mp4", SampledHasher{})[:1])
+	assert.NotEqual(t, hash("video.mp4", SampledHasher{}), hash("other.mp4", SampledHasher{}))
+	store := digestcache.NewMemory()
+	info, err := fsys.Stat("video.mp4")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Put(digestcache.Key{Algorithm: "sampled", Path: "video.mp4", FS: vfs.ID(fsys)},
+		digestcache.NewEntry(info, "s00000000")))
+	assert.Equal(t, hash("video.mp4", SampledHasher{}), hash("video.mp4", NewCachingHasher(SampledHasher{}, store)))
+}
+
+// TestS3ETagHasher checks whether ETags of files uploaded in parts are computed as S3 does
+func TestS3ETagHasher(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 250)
+	fsys := vfs.FromFS(fstest.MapFS{"a.bin": {Data: content}})
+	partMD5 := func(p []byte) []byte {
+		sum := md5.Sum(p)
+		return sum[:]
+	}
+	md5s := md5.Sum(bytes.Join([][]byte{partMD5(content[:1024]), partMD5(content[1024:2048]),
+		partMD5(content[2048:])}, nil))
+	info, _ := fsys.Stat("a.bin")
+	etag, err := S3ETagHasher{PartSize: 1024}.HashFile(context.Background(), fsys, "a.bin", info)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(md5s[:])+"-3", etag)
+	etag, err = S3ETagHasher{}.HashFile(context.Background(), fsys, "a.bin", info)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(partMD5(content)), etag)
+}
+
+// TestDropboxHasher checks whether content hashes are computed as Dropbox does, from SHA-256s of 4 MiB blocks
+func TestDropboxHasher(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 900_000)
+	fsys := vfs.FromFS(fstest.MapFS{"a.bin": {Data: content}, "empty": {}})
+	blockSum := func(p []byte) []byte {
+		sum := sha256.Sum256(p)
+		return sum[:]
+	}
+	expected := sha256.Sum256(bytes.Join([][]byte{blockSum(content[:4*bytesutil.MEBI]),
+		blockSum(content[4*bytesutil.MEBI : 8*bytesutil.MEBI]), blockSum(content[8*bytesutil.MEBI:])}, nil))
+	info, _ := fsys.Stat("a.bin")
+	contentHash, err := DropboxHasher{}.HashFile(context.Background(), fsys, "a.bin", info)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(expected[:]), contentHash)
+	info, _ = fsys.Stat("empty")
+	contentHash, err = DropboxHasher{}.HashFile(context.Background(), fsys, "empty", info)
+	assert.Nil(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", contentHash)
+}
+
+// TestQuickXorHasher checks QuickXorHash against a bit-by-bit implementation of its definition
+func TestQuickXorHasher(t *testing.T) {
+	quickXor := func(content []byte) string {
+		var bits [160]byte
+		for i, b := range content {
+			for j := 0; j < 8; j++ {
+				bits[(i*11+j)%160] ^= (b >> j) & 1
+			}
+		}
+		sum := make([]byte, 20)
+		for i, bit := range bits {
+			sum[i/8] |= bit << (i % 8)
+		}
+		for i := 0; i < 8; i++ {
+			sum[12+i] ^= byte(uint64(len(content)) >> (8 * i))
+		}
+		return hex.EncodeToString(sum)
+	}
+	content := make([]byte, 10_000)
+	for i := range content {
+		content[i] = byte(i*7 + i/13)
+	}
+	fsys := vfs.FromFS(fstest.MapFS{"a.bin": {Data: content}, "J": {Data: []byte("J")}})
+	info, _ := fsys.Stat("a.bin")
+	hash, err := QuickXorHasher{}.HashFile(context.Background(), fsys, "a.bin", info)
+	assert.Nil(t, err)
+	assert.Equal(t, quickXor(content), hash)
+	// Bytes written in parts are hashed the same as those written at once
+	h := &quickXorHash{}
+	for _, part := range [][]byte{content[:1], content[1:170], content[170:333], content[333:]} {
+		_, _ = h.Write(part)
+	}
+	assert.Equal(t, quickXor(content), hex.EncodeToString(h.Sum(nil)))
+	info, _ = fsys.Stat("J")
+	hash, err = QuickXorHasher{}.HashFile(context.Background(), fsys, "J", info)
+	assert.Nil(t, err)
+	expected, _ := base64.StdEncoding.DecodeString("SgAAAAAAAAAAAAAAAQAAAAAAAAA=")
+	assert.Equal(t, hex.EncodeToString(expected), hash)
+}
+
+func TestGetDigestErrors(t *testing.T) {
+	goRoot := runtime.GOROOT()
+	_, err := GetDigest(context.Background(), vfs.Local, filepath.Join(goRoot, "no-such-file.go"), SampledHasher{})
+	assert.ErrorIs(t, err, ErrFileVanished)
+	var fileErr *FileError
+	assert.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, filepath.Join(goRoot, "no-such-file.go"), fileErr.Path)
+	_, err = GetDigest(context.Background(), vfs.Local, filepath.Join(goRoot, "src"), SampledHasher{})
+	assert.ErrorIs(t, err, ErrNotRegularFile)
+	fmte.Off()
+	_, err = FindDuplicates(context.Background(), NewOptions([]string{filepath.Join(goRoot, "no-such-dir")}))
+	assert.ErrorIs(t, err, ErrNotReadable)
+}
+
+func TestCachingHasher(t *testing.T) {
+	path := filepath.Join(runtime.GOROOT(), "/src/io/io.go")
+	store := digestcache.NewMemory()
+	hasher := NewCachingHasher(SHA256Hasher{}, store)
+	expected, err := GetDigest(context.Background(), vfs.Local, path, SHA256Hasher{})
+	assert.Nil(t, err)
+	actual, err := GetDigest(context.Background(), vfs.Local, path, hasher)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+	entry, found, _ := store.Get(digestcache.Key{Algorithm: "sha256", Path: path})
+	assert.True(t, found)
+	assert.Equal(t, expected.FileHash, entry.Hash)
+	// A cached hash is used as long as the file's size and modification time are unchanged
+	assert.Nil(t, store.Put(digestcache.Key{Algorithm: "sha256", Path: path}, digestcache.Entry{
+		Size: entry.Size, ModifiedTimestamp: entry.ModifiedTimestamp, Hash: "cached",
+	}))
+	actual, err = GetDigest(context.Background(), vfs.Local, path, hasher)
+	assert.Nil(t, err)
+	assert.Equal(t, "cached", actual.FileHash)
+	// Hashes of files of the same path of other file systems aren't used
+	store = digestcache.NewMemory()
+	assert.Nil(t, store.Put(digestcache.Key{Algorithm: "sha256", Path: path, FS: "s3://bucket"}, digestcache.Entry{
+		Size: entry.Size, ModifiedTimestamp: entry.ModifiedTimestamp, Hash: "remote",
+	}))
+	actual, err = GetDigest(context.Background(), vfs.Local, path, NewCachingHasher(SHA256Hasher{}, store))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	bolt "go.etcd.io/bbolt"
+)
+
+// spillBatchSize is the number of files written to the database of a fileIndex by a transaction each
+const spillBatchSize = 10_000
+
+// Buckets of the database of a fileIndex: files by their paths, and the same files by their size buckets (see
+// sizeBucket) and then paths, so that files of a shard (see shortlist) are read without reading those of others
+var (
+	filesBucket = []byte("files")
+	sizesBucket = []byte("sizes")
+)
+
+// sizeBuckets is the number of buckets that files spilled to disk are sharded by, by their sizes
+const sizeBuckets = 1 << 16
+
+// sizeBucket is the bucket of a file of the size. Sizes are spread across buckets by Fibonacci hashing, since sizes
+// of files are far from evenly distributed.
+func sizeBucket(size int64) uint16 {
+	return uint16((uint64(size) * 0x9E3779B97F4A7C15) >> 48)
+}
+
+// fileIndex is the index of files found while walking, by their paths. Files are kept in memory until there are more
+// of them than spillAfter (if that's set): they're then moved to a temporary database on disk, as are more files
+// found after, so that scans of very many files don't need memory for all of them. Files spilled to disk are then
+// shortlisted (and hashed) by shards of their sizes, each of about spillAfter files, so that memory for grouping them
+// is bounded too.
+type fileIndex struct {
+	spillAfter int
+	// memory are files not moved to the database (yet)
+	memory entity.FilePathToMeta
+	// db is the database files are spilled to (nil until they are)
+	db    *bolt.DB
+	count int
+}
+
+func newFileIndex(spillAfter int) *fileIndex {
+	size := 10_000
+	if spillAfter > 0 {
+		size = min(size, spillAfter+1)
+	}
+	return &fileIndex{spillAfter: spillAfter, memory: make(entity.FilePathToMeta, size)}
+}
+
+// add adds a file that isn't in the index yet
+func (x *fileIndex) add(path string, meta entity.FileMeta) error {
+	x.memory[path] = meta
+	x.count++
+	if x.spillAfter > 0 && len(x.memory) > x.spillAfter {
+		return x.spill()
+	}
+	return nil
+}
+
+// has checks whether the file is in the index
+func (x *fileIndex) has(path string) bool {
+	if _, exists := x.memory[path]; exists {
+		return true
+	}
+	if x.db == nil {
+		return false
+	}
+	exists := false
+	_ = x.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(filesBucket).Get([]byte(path)) != nil
+		return nil
+	})
+	return exists
+}
+
+// spilled checks whether files are spilled to disk, in which case memory has only some of them
+func (x *fileIndex) spilled() bool {
+	return x.db != nil
+}
+
+// spill moves files in memory to the database, creating it if it's not created yet
+func (x *fileIndex) spill() error {
+	if x.db == nil {
+		f, err := os.CreateTemp("", "go-find-duplicates-files-*.db")
+		if err != nil {
+			return fmt.Errorf("couldn't spill index of files to disk: %w", err)
+		}
+		_ = f.Close()
+		db, err := bolt.Open(f.Name(), 0o600, &bolt.Options{NoSync: true, NoFreelistSync: true})
+		if err == nil {
+			err = db.Update(func(tx *bolt.Tx) error {
+				if _, bErr := tx.CreateBucket(filesBucket); bErr != nil {
+					return bErr
+				}
+				_, bErr := tx.CreateBucket(sizesBucket)
+				return bErr
+			})
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return fmt.Errorf("couldn't spill index of files to disk: %w", err)
+		}
+		x.db = db
+	}
+	paths := make([]string, 0, len(x.memory))
+	for path := range x.memory {
+		paths = append(paths, path)
+	}
+	for low := 0; low < len(paths); low += spillBatchSize {
+		err := x.db.Update(func(tx *bolt.Tx) error {
+			files, sizes := tx.Bucket(filesBucket), tx.Bucket(sizesBucket)
+			for _, path := range paths[low:min(low+spillBatchSize, len(paths))] {
+				meta := x.memory[path]
+				if err := files.Put([]byte(path), encodeFileMeta(meta)); err != nil {
+					return err
+				}
+				if err := sizes.Put(sizeKey(path, meta.Size), encodeFileMeta(meta)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't spill index of files to disk: %w", err)
+		}
+	}
+	x.memory = make(entity.FilePathToMeta, len(x.memory))
+	return nil
+}
+
+// shards is the number of shards that files are shortlisted by: 1 unless they're spilled to disk, and as many as
+// make shards of spillAfter files each otherwise
+func (x *fileIndex) shards() int {
+	if x.db == nil {
+		return 1
+	}
+	return min((x.count+x.spillAfter-1)/x.spillAfter, sizeBuckets)
+}
+
+// forEach calls fn with every file of the shard of the index (of shards as many as x.shards), i.e. of files of the
+// size buckets of the shard. All files in memory are of the only shard if files aren't spilled to disk.
+func (x *fileIndex) forEach(shard, shards int, fn func(path string, meta entity.FileMeta)) error {
+	if x.db == nil {
+		for path, meta := range x.memory {
+			fn(path, meta)
+		}
+		return nil
+	}
+	low, high := shard*sizeBuckets/shards, (shard+1)*sizeBuckets/shards
+	for path, meta := range x.memory {
+		if bucket := int(sizeBucket(meta.Size)); bucket >= low && bucket < high {
+			fn(path, meta)
+		}
+	}
+	return x.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(sizesBucket).Cursor()
+		start := binary.BigEndian.AppendUint16(nil, uint16(low))
+		for k, v := c.Seek(start); k != nil && int(binary.BigEndian.Uint16(k)) < high; k, v = c.Next() {
+			fn(string(k[2:]), decodeFileMeta(v))
+		}
+		return nil
+	})
+}
+
+// shortlist identifies files of the shard (see forEach) that may have duplicates, like identifyShortList, returning
+// them along with their metadata. Unlike identifyShortList, it doesn't need all files in memory: it counts files of
+// each extension and size of the shard first, and then lists only files of those that are in the shortlist.
+func (x *fileIndex) shortlist(keepUnique func(entity.FileExtAndSize) bool, shard, shards int,
+) (entity.FileExtAndSizeToFiles, entity.FilePathToMeta, error) {
+	counts := map[entity.FileExtAndSize]int{}
+	err := x.forEach(shard, shards, func(path string, meta entity.FileMeta) {
+		counts[entity.FileExtAndSize{FileExtension: utils.GetFileExt(path), FileSize: meta.Size}]++
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	shortlist := make(entity.FileExtAndSizeToFiles)
+	files := make(entity.FilePathToMeta)
+	err = x.forEach(shard, shards, func(path string, meta entity.FileMeta) {
+		fileExtAndSize := entity.FileExtAndSize{FileExtension: utils.GetFileExt(path), FileSize: meta.Size}
+		if counts[fileExtAndSize] > 1 || keepUnique(fileExtAndSize) {
+			shortlist[fileExtAndSize] = append(shortlist[fileExtAndSize], path)
+			files[path] = meta
+		}
+	})
+	// Sorted, as by identifyShortList
+	for _, paths := range shortlist {
+		slices.Sort(paths)
+	}
+	return shortlist, files, err
+}
+
+// close removes the database, if files were spilled to one
+func (x *fileIndex) close() {
+	if x.db != nil {
+		path := x.db.Path()
+		_ = x.db.Close()
+		_ = os.Remove(path)
+	}
+}
+
+// sizeKey is the key of the file in sizesBucket: its size bucket, and then its path
+func sizeKey(path string, size int64) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, sizeBucket(size)), path...)
+}
+
+// encodeFileMeta encodes the size of the file, and then its modification time as by time.Time.MarshalBinary (which
+// keeps its offset from UTC, and nanoseconds)
+func encodeFileMeta(meta entity.FileMeta) []byte {
+	b := binary.BigEndian.AppendUint64(nil, uint64(meta.Size))
+	modified, err := meta.Modified.MarshalBinary()
+	if err != nil {
+		// Offsets of times of files are of whole minutes, but for those of some historical zones
+		modified, _ = meta.Modified.UTC().MarshalBinary()
+	}
+	return append(b, modified...)
+}
+
+func decodeFileMeta(b []byte) entity.FileMeta {
+	meta := entity.FileMeta{Size: int64(binary.BigEndian.Uint64(b))}
+	_ = meta.Modified.UnmarshalBinary(b[8:])
+	return meta
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+)
+
+// FileFilter decides whether a file or directory found while scanning is to be considered. Returning false for
+// a directory skips the directory entirely. Filters are called before any file is hashed, and before files are
+// statted: names and types of files (info.Name and info.IsDir) are known without statting them, so filters that
+// need nothing else spare stats of files they leave out.
+type FileFilter func(path string, info fs.FileInfo) bool
+
+// GroupFilter decides whether a group of duplicates is to be reported
+type GroupFilter func(group entity.DuplicateGroup) bool
+
+// WithFileFilter adds a filter for files and directories found while scanning
+func WithFileFilter(filter FileFilter) Option {
+	return func(o *Options) { o.FileFilters = append(slices.Clip(o.FileFilters), filter) }
+}
+
+// WithGroupFilter adds a filter for groups of duplicates found
+func WithGroupFilter(filter GroupFilter) Option {
+	return func(o *Options) { o.GroupFilters = append(slices.Clip(o.GroupFilters), filter) }
+}
+
+// ExtensionFilter is a FileFilter that considers only files with one of the extensions (such as "jpg" or ".jpg",
+// matched case-insensitively and as normalized), and all directories
+func ExtensionFilter(extensions ...string) FileFilter {
+	accepted := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		accepted[utils.GetFileExt("."+strings.TrimPrefix(ext, "."))] = true
+	}
+	return func(path string, info fs.FileInfo) bool {
+		return info.IsDir() || accepted[utils.GetFileExt(path)]
+	}
+}
+
+// isExcluded checks whether a file or directory of the name is excluded by ExcludedFiles, as normalized (see
+// withDefaults)
+func (o Options) isExcluded(name string) bool {
+	name = utils.NormalizeName(name)
+	if o.ExcludedFiles.Contains(name) {
+		return true
+	}
+	for _, pattern := range o.excludedPatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) acceptsFile(path string, info fs.FileInfo) bool {
+	for _, filter := range o.FileFilters {
+		if !filter(path, info) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o Options) acceptsGroup(group entity.DuplicateGroup) bool {
+	for _, filter := range o.GroupFilters {
+		if !filter(group) {
+			return false
+		}
+	}
+	return true
+}
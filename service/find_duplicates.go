@@ -1,133 +1,675 @@
 package service
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/go-find-duplicates/bytesutil"
 	"github.com/m-manu/go-find-duplicates/entity"
 	"github.com/m-manu/go-find-duplicates/fmte"
-	"github.com/m-manu/go-find-duplicates/utils"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/vfs"
 )
 
-// FindDuplicates finds duplicate files in a given set of directories and matching criteria
-func FindDuplicates(directories []string, excludedFiles set.Set[string], fileSizeThreshold int64, parallelism int,
-	isThorough bool) (
-	duplicates *entity.DigestToFiles, duplicateTotalCount int64, savingsSize int64,
-	allFiles entity.FilePathToMeta, err error,
-) {
-	fmte.Printf("Scanning %d directories...\n", len(directories))
-	allFiles = make(entity.FilePathToMeta, 10_000)
+// Result is the outcome of a scan for duplicates
+type Result struct {
+	// Duplicates are groups of files that are duplicates of each other
+	Duplicates *entity.DigestToFiles
+	// DuplicateTotalCount is the number of files that can be removed
+	DuplicateTotalCount int64
+	// SavingsSize is the total size of files that can be removed
+	SavingsSize int64
+	// AllFiles are all files that were considered, or only those that may have duplicates if files were spilled to
+	// disk (see Options.SpillAfter)
+	AllFiles entity.FilePathToMeta
+	// FileCount is the number of files that were considered
+	FileCount int
+	// Unstable are files that changed (by their sizes or modification times) while they were being hashed, which
+	// aren't in Duplicates or Digests, by their paths, sorted
+	Unstable []string
+	// Vanished is the number of files found while walking that didn't exist anymore by the time they were to be
+	// hashed, and so were skipped
+	Vanished int
+	// SkippedLinks is the number of links found while scanning that weren't followed (see Options.FollowSymlinks)
+	SkippedLinks int
+	// SkippedIrregular is the number of files found while scanning that were skipped since they aren't regular files
+	// (e.g. FIFOs, sockets and devices), nor directories or links
+	SkippedIrregular int
+	// Digests are digests of files that were hashed, i.e. files that had potential duplicates (or all files, if
+	// Options.HashAllFiles is set), except those that an earlier scan told apart (see ScanMetrics.FilesKnownUnique)
+	Digests map[string]entity.FileDigest
+	// ExternalMatches are paths of files in Options.ExternalDigests that have same contents as files of the scan,
+	// by paths of the latter
+	ExternalMatches map[string][]string
+	// Phases are how long phases of the scan took
+	Phases Phases
+}
+
+// Phases are how long phases of a scan took
+type Phases struct {
+	// Walk is the time taken to walk through directories
+	Walk time.Duration
+	// Group is the time taken to group files by their extensions and sizes, to identify potential duplicates
+	Group time.Duration
+	// Hash is the time taken to hash potential duplicates, and to group (and verify) them by their digests
+	Hash time.Duration
+}
+
+// FindDuplicates finds duplicate files in a given set of directories and matching criteria.
+// It doesn't depend on any package-level mutable state, so multiple scans can run concurrently in one process.
+// If ctx is cancelled mid-scan, the duplicates confirmed so far are returned along with ctx.Err().
+// An unreadable directory results in an error that matches ErrNotReadable.
+func FindDuplicates(ctx context.Context, opts Options) (result Result, err error) {
+	opts = opts.withDefaults()
+	startedAt := time.Now()
+	defer func() {
+		if err == nil {
+			opts.Metrics.observeScan(time.Since(startedAt), result)
+		}
+	}()
+	var external *externalIndex
+	if opts.ExternalDigests != nil {
+		if opts.ExternalDigests.Algorithm != opts.Hasher.Name() {
+			err = fmt.Errorf("external digests were computed by %s hash, not %s", opts.ExternalDigests.Algorithm,
+				opts.Hasher.Name())
+			return
+		}
+		external = newExternalIndex(opts.ExternalDigests)
+	}
+	// Requests of remote storage are cancelled along with the scan
+	opts.FS = vfs.WithContext(opts.FS, ctx)
+	if opts.MaxOpenFiles > 0 {
+		opts.FS = vfs.LimitOpenFiles(opts.FS, opts.MaxOpenFiles)
+	}
+	opts.Hasher = opts.wrapHasher(opts.Hasher)
+	if opts.Verifier != nil {
+		opts.Verifier = opts.wrapHasher(opts.Verifier)
+	}
+	opts.Directories = distinctDirectories(opts)
+	opts.Logger.Printf("Scanning %d directories...\n", len(opts.Directories))
+	index := newFileIndex(opts.SpillAfter)
+	defer index.close()
+	result.AllFiles = index.memory
 	var totalSize int64
-	for _, dirPath := range directories {
-		size, pErr := populateFilesFromDirectory(dirPath, excludedFiles, fileSizeThreshold, allFiles)
+	var links *linkFollower
+	if opts.FollowSymlinks {
+		links = newLinkFollower(opts.FS, opts.Directories)
+	}
+	phaseStartedAt := time.Now()
+	for _, dirPath := range opts.Directories {
+		size, pErr := populateFilesFromDirectory(ctx, opts, dirPath, index, links, &result)
+		result.FileCount = index.count
+		if index.spilled() {
+			// Files spilled to disk are listed once potential duplicates among them are identified
+			result.AllFiles = nil
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
 		if pErr != nil {
-			err = fmt.Errorf("error while scaning directory %s: %w", dirPath, pErr)
+			err = fmt.Errorf("error while scanning directory %s: %w", dirPath, pErr)
 			return
 		}
 		totalSize += size
 	}
-	fmte.Printf("Done. Found %d files of total size %s.\n", len(allFiles), bytesutil.BinaryFormat(totalSize))
-	if len(allFiles) == 0 {
-		return
+	result.Phases.Walk = time.Since(phaseStartedAt)
+	opts.Logger.Printf("Done. Found %d files of total size %s.\n", result.FileCount, bytesutil.BinaryFormat(totalSize))
+	if result.SkippedLinks > 0 || result.SkippedIrregular > 0 {
+		opts.Logger.Printf("Skipped %d links and %d FIFOs, sockets and devices.\n", result.SkippedLinks,
+			result.SkippedIrregular)
 	}
-	fmte.Printf("Finding potential duplicates... \n")
-	shortlist := identifyShortList(allFiles)
-	if len(shortlist) == 0 {
+	if result.FileCount == 0 {
 		return
 	}
-	fmte.Printf("Completed. Found %d files that may have one or more duplicates!\n", len(shortlist))
-	if isThorough {
-		fmte.Printf("Thoroughly scanning for duplicates... \n")
+	opts.Logger.Printf("Finding potential duplicates... \n")
+	phaseStartedAt = time.Now()
+	keepUnique := func(extAndSize entity.FileExtAndSize) bool {
+		return opts.HashAllFiles || external.hasSize(extAndSize)
+	}
+	opts.keepUnique = keepUnique
+	var candidates int
+	if index.spilled() {
+		if candidates, err = hashShards(ctx, opts, index, &result, phaseStartedAt); err != nil {
+			err = fmt.Errorf("couldn't read index of files spilled to disk: %w", err)
+			return
+		}
 	} else {
-		fmte.Printf("Scanning for duplicates... \n")
+		candidates = hashShortlist(ctx, opts, identifyShortList(result.AllFiles, keepUnique), &result, phaseStartedAt)
+	}
+	// Files of unique sizes can't have duplicates, so they aren't hashed at all
+	opts.Metrics.FilesOfUniqueSize.Add(int64(result.FileCount - candidates))
+	slices.Sort(result.Unstable)
+	if candidates == 0 {
+		return
+	}
+	if external != nil {
+		result.ExternalMatches = external.match(result.Digests)
+	}
+	if ctx.Err() != nil {
+		opts.Logger.Printf("Scan cancelled.\n")
+		err = ctx.Err()
+		return
+	}
+	opts.Logger.Printf("Scan completed.\n")
+	return
+}
+
+// hashShortlist hashes files of the shortlist (of all files, which are in memory), adding groups of duplicates found
+// and digests of files hashed to result, and the time taken since groupingStartedAt to its phases. It returns the
+// number of files of the shortlist.
+func hashShortlist(ctx context.Context, opts Options, shortlist entity.FileExtAndSizeToFiles, result *Result,
+	groupingStartedAt time.Time,
+) (candidates int) {
+	candidates, shortlistSize := shortlistSizes(shortlist)
+	result.Phases.Group += time.Since(groupingStartedAt)
+	if candidates == 0 {
+		return 0
+	}
+	opts.Logger.Printf("Completed. Found %d files that may have one or more duplicates!\n", candidates)
+	// Files are hashed by their metadata found while walking, rather than by statting them again
+	opts.walked = result.AllFiles
+	opts.Logger.Printf("Scanning for duplicates (using %s hash)... \n", opts.Hasher.Name())
+	hashingStartedAt := time.Now()
+	// Progress is by bytes hashed, rather than by files, since hashing large files takes much longer
+	var processedSize int64
+	stop := reportProgress(opts.Logger, func() float64 {
+		return sizeRatio(atomic.LoadInt64(&processedSize), shortlistSize)
+	})
+	hashed := hashShard(ctx, opts, newThrottle(opts), shortlist, &processedSize)
+	stop()
+	result.add(hashed, nil)
+	result.Phases.Hash += time.Since(hashingStartedAt)
+	return candidates
+}
+
+// shardsInFlight is the most shards of files spilled to disk that are hashed at a time (see hashShards)
+const shardsInFlight = 2
+
+// hashShards shortlists and hashes files spilled to disk (see fileIndex) by shards of their sizes, adding groups of
+// duplicates found, digests of files hashed and files shortlisted to result, and the time taken since
+// groupingStartedAt to its phases. Shards are shortlisted one after another, while as many as shardsInFlight of those
+// shortlisted already are hashed, so that workers done with files of a shard go on with those of the next rather than
+// waiting for the largest files of the shard to be hashed. Shortlists of at most shardsInFlight+1 shards (of about
+// Options.SpillAfter files each) are in memory at a time, and workers of all shards take turns hashing, so that no
+// more of them hash at a time than Options.Parallelism. It returns the number of files shortlisted.
+func hashShards(ctx context.Context, opts Options, index *fileIndex, result *Result, groupingStartedAt time.Time,
+) (candidates int, err error) {
+	shards := index.shards()
+	opts.Logger.Printf("Finding them in %d shards of files by their sizes...\n", shards)
+	opts.Logger.Printf("Scanning for duplicates (using %s hash)... \n", opts.Hasher.Name())
+	hashingStartedAt := time.Now()
+	t := newThrottle(opts)
+	if t == nil {
+		t = &throttle{hashing: make(chan struct{}, opts.Parallelism)}
 	}
-	var processedCount int32
+	// Progress is by shards hashed, and by bytes hashed of shards being hashed. Sizes of shards are -1 until they're
+	// shortlisted.
+	processedSizes, shardSizes := make([]int64, shards), make([]int64, shards)
+	for shard := range shardSizes {
+		shardSizes[shard] = -1
+	}
+	stop := reportProgress(opts.Logger, func() float64 {
+		var hashed float64
+		for shard := range shards {
+			if size := atomic.LoadInt64(&shardSizes[shard]); size >= 0 {
+				hashed += sizeRatio(atomic.LoadInt64(&processedSizes[shard]), size)
+			}
+		}
+		return hashed / float64(shards)
+	})
+	type shortlisted struct {
+		shard     int
+		shortlist entity.FileExtAndSizeToFiles
+		files     entity.FilePathToMeta
+	}
+	queue := make(chan shortlisted)
+	go func() {
+		defer close(queue)
+		startedAt := groupingStartedAt
+		for shard := 0; shard < shards && ctx.Err() == nil; shard++ {
+			shortlist, files, sErr := index.shortlist(opts.keepUnique, shard, shards)
+			result.Phases.Group += time.Since(startedAt)
+			if sErr != nil {
+				err = sErr
+				return
+			}
+			n, size := shortlistSizes(shortlist)
+			candidates += n
+			atomic.StoreInt64(&shardSizes[shard], size)
+			if n > 0 {
+				queue <- shortlisted{shard: shard, shortlist: shortlist, files: files}
+			}
+			startedAt = time.Now()
+		}
+	}()
+	var resultMx sync.Mutex
 	var wg sync.WaitGroup
-	wg.Add(2)
-	go func(pc *int32, fc int32) {
-		defer wg.Done()
-		time.Sleep(200 * time.Millisecond)
-		for atomic.LoadInt32(pc) < fc {
-			time.Sleep(2 * time.Second)
-			progress := float64(atomic.LoadInt32(pc)) / float64(fc)
-			fmte.Printf("%2.0f%% processed so far\n", progress*100.0)
-		}
-	}(&processedCount, int32(len(shortlist)))
-	go func(p *int32) {
-		defer wg.Done()
-		duplicates = entity.NewDigestToFiles()
-		computeDigestsAndGroupThem(shortlist, parallelism, p, duplicates, isThorough)
-		for iter := duplicates.Iterator(); iter.HasNext(); {
-			digest, files := iter.Next()
-			numDuplicates := int64(len(files)) - 1
-			duplicateTotalCount += numDuplicates
-			savingsSize += numDuplicates * digest.FileSize
-		}
-	}(&processedCount)
+	wg.Add(shardsInFlight)
+	for range shardsInFlight {
+		go func() {
+			defer wg.Done()
+			for s := range queue {
+				opts := opts
+				opts.walked = s.files
+				hashed := hashShard(ctx, opts, t, s.shortlist, &processedSizes[s.shard])
+				resultMx.Lock()
+				result.add(hashed, s.files)
+				resultMx.Unlock()
+			}
+		}()
+	}
 	wg.Wait()
-	fmte.Printf("Scan completed.\n")
-	return
+	stop()
+	result.Phases.Hash += time.Since(hashingStartedAt)
+	if err == nil && candidates > 0 {
+		opts.Logger.Printf("Completed. Found %d files that may have one or more duplicates!\n", candidates)
+	}
+	return candidates, err
+}
+
+// shortlistSizes returns the number of files of the shortlist, and their total size
+func shortlistSizes(shortlist entity.FileExtAndSizeToFiles) (files int, size int64) {
+	for extAndSize, paths := range shortlist {
+		files += len(paths)
+		size += extAndSize.FileSize * int64(len(paths))
+	}
+	return files, size
+}
+
+// sizeRatio is the ratio of processed to total, which is 1 if total is 0
+func sizeRatio(processed, total int64) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(processed) / float64(total)
 }
 
-func computeDigestsAndGroupThem(shortlist entity.FileExtAndSizeToFiles, parallelism int,
-	processedCount *int32, duplicates *entity.DigestToFiles, isThorough bool,
-) {
+// reportProgress logs progress (from 0 to 1) and the time left, by how long it took so far, every 2 seconds until
+// stop is called
+func reportProgress(logger fmte.Logger, progress func() float64) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		start := time.Now()
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p := progress()
+				if p == 0 {
+					logger.Printf("%2.0f%% processed so far\n", p*100.0)
+					continue
+				}
+				elapsed := time.Since(start)
+				left := time.Duration(float64(elapsed) * (1 - p) / p).Round(time.Second)
+				logger.Printf("%2.0f%% processed so far, about %s left\n", p*100.0, left)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// hashedShard is what hashing a shortlist (see hashShard) found
+type hashedShard struct {
+	duplicates *entity.DigestToFiles
+	digests    map[string]entity.FileDigest
+	left       leftOut
+}
+
+// hashShard hashes files of the shortlist, by workers throttled by t (see computeDigestsAndGroupThem)
+func hashShard(ctx context.Context, opts Options, t *throttle, shortlist entity.FileExtAndSizeToFiles,
+	processedSize *int64,
+) hashedShard {
+	duplicates := entity.NewDigestToFiles()
+	digests, left := computeDigestsAndGroupThem(ctx, opts, t, shortlist, processedSize, duplicates)
+	return hashedShard{duplicates: duplicates, digests: digests, left: left}
+}
+
+// add adds what hashing a shortlist found to r, along with metadata of files of the shortlist (unless they're in r
+// already)
+func (r *Result) add(hashed hashedShard, files entity.FilePathToMeta) {
+	r.Unstable = append(r.Unstable, hashed.left.unstable...)
+	r.Vanished += hashed.left.vanished
+	if r.AllFiles == nil {
+		r.AllFiles = files
+	} else if files != nil {
+		maps.Copy(r.AllFiles, files)
+	}
+	if r.Duplicates == nil {
+		r.Duplicates, r.Digests = hashed.duplicates, hashed.digests
+	} else {
+		// Files of different shards can't be duplicates of each other, since they're of different sizes
+		for digest, files := range hashed.duplicates.All() {
+			for _, path := range files {
+				r.Duplicates.Set(digest, path)
+			}
+		}
+		maps.Copy(r.Digests, hashed.digests)
+	}
+	for digest, files := range hashed.duplicates.All() {
+		numDuplicates := int64(len(files)) - 1
+		r.DuplicateTotalCount += numDuplicates
+		r.SavingsSize += numDuplicates * digest.FileSize
+	}
+}
+
+// externalIndex indexes Options.ExternalDigests for lookups
+type externalIndex struct {
+	byDigest map[entity.FileDigest][]string
+	sizes    map[entity.FileExtAndSize]bool
+	// byHash indexes digests of unknown sizes, by their hashes
+	byHash map[string][]string
+}
+
+func newExternalIndex(index *entity.DigestIndex) *externalIndex {
+	e := &externalIndex{
+		byDigest: make(map[entity.FileDigest][]string, len(index.Digests)),
+		sizes:    make(map[entity.FileExtAndSize]bool, len(index.Digests)),
+		byHash:   make(map[string][]string),
+	}
+	for path, digest := range index.Digests {
+		digest = digest.Fast()
+		if digest.FileSize == entity.UnknownFileSize {
+			e.byHash[digest.FileHash] = append(e.byHash[digest.FileHash], path)
+			continue
+		}
+		e.byDigest[digest] = append(e.byDigest[digest], path)
+		e.sizes[entity.FileExtAndSize{FileExtension: digest.FileExtension, FileSize: digest.FileSize}] = true
+	}
+	return e
+}
+
+// hasSize checks whether there are external files of given extension and size (false if e is nil). If any
+// external file is of unknown size, files of all sizes may match.
+func (e *externalIndex) hasSize(extAndSize entity.FileExtAndSize) bool {
+	return e != nil && (len(e.byHash) > 0 || e.sizes[extAndSize])
+}
+
+// match finds external files with same digests as those given, by paths
+func (e *externalIndex) match(digests map[string]entity.FileDigest) map[string][]string {
+	matches := make(map[string][]string)
+	for path, digest := range digests {
+		paths := slices.Concat(e.byDigest[digest.Fast()], e.byHash[digest.FileHash])
+		if len(paths) > 0 {
+			matches[path] = paths
+		}
+	}
+	return matches
+}
+
+// wrapHasher wraps hasher so that hashing is recorded in metrics, and hashes are reused from cache if there's one
+func (o Options) wrapHasher(hasher Hasher) Hasher {
+	hasher = meteredHasher{Hasher: hasher, metrics: o.Metrics}
+	if o.Cache == nil {
+		return hasher
+	}
+	cachingHasher := NewCachingHasher(hasher, o.Cache)
+	cachingHasher.Metrics = o.Metrics
+	cachingHasher.Logger = o.Logger
+	return cachingHasher
+}
+
+// computeDigestsAndGroupThem hashes files of the shortlist by workers throttled by t, largest files first, so that
+// the heaviest work starts immediately and the long tail of small files fills in at the end (rather than a large file
+// being left to hash alone, once all else is done). Files of each device whose reads are limited are hashed by
+// workers of its own (see throttle.workQueues). Sizes of files hashed are added to processedSize. Digests of files
+// hashed are returned, along with files left out of groups (see groupPotentialDuplicates).
+func computeDigestsAndGroupThem(ctx context.Context, opts Options, t *throttle,
+	shortlist entity.FileExtAndSizeToFiles, processedSize *int64, duplicates *entity.DigestToFiles,
+) (map[string]entity.FileDigest, leftOut) {
 	// Find potential duplicates:
 	slKeys := make([]entity.FileExtAndSize, 0, len(shortlist))
 	for extAndSize := range shortlist {
 		slKeys = append(slKeys, extAndSize)
 	}
+	slices.SortFunc(slKeys, func(a, b entity.FileExtAndSize) int {
+		if a.FileSize != b.FileSize {
+			return cmp.Compare(b.FileSize, a.FileSize)
+		}
+		return cmp.Compare(len(shortlist[b]), len(shortlist[a]))
+	})
+	digests := make(map[string]entity.FileDigest, len(slKeys)*2)
+	var left leftOut
+	var digestsMx sync.Mutex
 	var wg sync.WaitGroup
-	wg.Add(parallelism)
-	for i := 0; i < parallelism; i++ {
-		go func(shard int, wg *sync.WaitGroup, count *int32) {
-			defer wg.Done()
-			low := shard * len(slKeys) / parallelism
-			high := (shard + 1) * len(slKeys) / parallelism
-			for _, fileExtAndSize := range slKeys[low:high] {
-				for _, path := range shortlist[fileExtAndSize] {
-					digest, err := GetDigest(path, isThorough)
-					if err != nil {
-						fmte.Printf("error while scanning %s: %+v\n", path, err)
-						continue
+	for _, q := range t.workQueues(opts.Parallelism, slKeys, shortlist) {
+		wg.Add(q.workers)
+		for i := 0; i < q.workers; i++ {
+			go func(wg *sync.WaitGroup, size *int64) {
+				defer wg.Done()
+				opts := opts
+				var w *workerFS
+				if t != nil {
+					w = &workerFS{FS: opts.FS, t: t}
+					opts.FS = w
+				}
+				for fileExtAndSize, ok := q.take(); ok; fileExtAndSize, ok = q.take() {
+					if ctx.Err() != nil {
+						return
+					}
+					bucketDigests, bucketLeft := groupPotentialDuplicates(ctx, opts, fileExtAndSize,
+						shortlist[fileExtAndSize], duplicates)
+					w.idle()
+					digestsMx.Lock()
+					for path, digest := range bucketDigests {
+						digests[path] = digest
 					}
-					duplicates.Set(digest, path)
+					left.unstable = append(left.unstable, bucketLeft.unstable...)
+					left.vanished += bucketLeft.vanished
+					digestsMx.Unlock()
+					atomic.AddInt64(size, fileExtAndSize.FileSize*int64(len(shortlist[fileExtAndSize])))
 				}
-				atomic.AddInt32(count, 1)
-			}
-		}(i, &wg, processedCount)
+			}(&wg, processedSize)
+		}
 	}
 	wg.Wait()
-	// Remove non-duplicates
-	var duplicateKeys []entity.FileDigest
-	for iter := duplicates.Iterator(); iter.HasNext(); {
-		digest, files := iter.Next()
-		if len(files) <= 1 {
-			duplicateKeys = append(duplicateKeys, *digest)
+	return digests, left
+}
+
+// leftOut are files of potential duplicates left out of groups, since they changed or vanished while being hashed
+type leftOut struct {
+	// unstable are files that changed
+	unstable []string
+	// vanished is the number of files that don't exist anymore
+	vanished int
+}
+
+// vanished checks whether err is of a file that doesn't exist anymore (as files of live directories may not, by the
+// time they're hashed), counting it in left if it is
+func (o Options) vanished(err error, left *leftOut) bool {
+	if !errors.Is(err, ErrFileVanished) {
+		return false
+	}
+	left.vanished++
+	o.Metrics.FilesVanished.Add(1)
+	return true
+}
+
+// groupPotentialDuplicates computes digests of files that have same extension and size, and records the groups
+// of duplicates among them. Since the files of a group can't be anywhere else, the groups recorded are final.
+// Digests of all files hashed are returned, by their paths, along with files left out since they changed or vanished
+// while they were hashed. Files that vanished aren't errors, and so aren't logged.
+//
+// Once files that couldn't be hashed leave at most one other file, it can't have duplicates, and so it isn't hashed
+// (unless opts.keepUnique says files of that extension and size are to be hashed anyway). Likewise, files that an
+// earlier scan told apart from each other aren't hashed at all, as long as the cache says none of them have changed
+// since (see isKnownUnique).
+//
+// Files are statted again just before their digests are committed: those no longer of the size and modification time
+// they were found with are left out, rather than grouped by hashes that may be of what they were.
+func groupPotentialDuplicates(ctx context.Context, opts Options, extAndSize entity.FileExtAndSize, paths []string,
+	duplicates *entity.DigestToFiles,
+) (map[string]entity.FileDigest, leftOut) {
+	var left leftOut
+	digestToPaths := make(map[entity.FileDigest][]string, len(paths))
+	resolvable := opts.keepUnique == nil || !opts.keepUnique(extAndSize)
+	var fingerprint string
+	if resolvable && opts.Cache != nil {
+		fingerprint, _ = opts.cohortFingerprint(paths)
+		if opts.isKnownUnique(extAndSize, fingerprint) {
+			opts.Metrics.FilesKnownUnique.Add(int64(len(paths)))
+			return nil, left
+		}
+	}
+	failed := 0
+	for i, path := range paths {
+		if resolvable && len(paths)-failed <= 1 {
+			opts.Metrics.FilesResolvedEarly.Add(int64(len(paths) - i))
+			break
+		}
+		digest, err := getDigest(ctx, opts.FS, path, opts.Hasher, opts.fileInfo)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			failed++
+			if !opts.vanished(err, &left) {
+				opts.Logger.PrintfErr("error while scanning %s: %+v\n", path, err)
+				opts.Listener.OnError(path, err)
+			}
+			continue
 		}
+		opts.Listener.OnFileHashed(path, digest)
+		digestToPaths[digest] = append(digestToPaths[digest], path)
 	}
-	for _, key := range duplicateKeys {
-		duplicates.Remove(key)
+	digests := make(map[string]entity.FileDigest, len(paths))
+	if opts.Verifier != nil {
+		digestToPaths = verifyPotentialDuplicates(ctx, opts, digestToPaths, digests, &left)
 	}
-	return
+	for path := range digests {
+		if opts.isUnstable(path, &left) {
+			delete(digests, path)
+		}
+	}
+	unique := true
+	for digest, dPaths := range digestToPaths {
+		dPaths = slices.DeleteFunc(dPaths, func(path string) bool {
+			return opts.isUnstable(path, &left)
+		})
+		for _, path := range dPaths {
+			digests[path] = digest
+		}
+		if len(dPaths) > 1 {
+			unique = false
+		}
+		if len(dPaths) <= 1 || !opts.acceptsGroup(entity.DuplicateGroup{Digest: digest, Paths: dPaths}) {
+			continue
+		}
+		for _, path := range dPaths {
+			duplicates.Set(digest, path)
+		}
+		opts.Metrics.GroupsFound.Add(1)
+		opts.Listener.OnGroupFound(digest, dPaths)
+	}
+	// Files are told apart only if all of them were hashed (or resolved) without errors
+	if unique && len(digests) == len(paths) && ctx.Err() == nil {
+		opts.markUnique(extAndSize, fingerprint)
+	}
+	return digests, left
+}
+
+// isUnstable checks whether the file changed (or vanished) since it was found while walking (see changedSinceWalked),
+// recording it in left (and logging it, if it changed) if it did
+func (o Options) isUnstable(path string, left *leftOut) bool {
+	err := o.changedSinceWalked(path)
+	if err == nil {
+		return false
+	}
+	if o.vanished(err, left) {
+		return true
+	}
+	left.unstable = append(left.unstable, path)
+	o.Logger.PrintfErr("skipping \"%s\", which changed during the scan\n", path)
+	o.Listener.OnError(path, err)
+	o.Metrics.FilesChanged.Add(1)
+	return true
+}
+
+// verifyPotentialDuplicates regroups files of every group of potential duplicates by their upgraded digests. Files
+// that escalation (see escalate) tells apart from all others of their groups aren't upgraded, and are recorded in
+// resolved with their fast digests, as is the last file of a group whose others all couldn't be upgraded.
+func verifyPotentialDuplicates(ctx context.Context, opts Options, digestToPaths map[entity.FileDigest][]string,
+	resolved map[string]entity.FileDigest, left *leftOut,
+) map[entity.FileDigest][]string {
+	verified := make(map[entity.FileDigest][]string, len(digestToPaths))
+	for digest, paths := range digestToPaths {
+		if len(paths) <= 1 {
+			verified[digest] = paths
+			continue
+		}
+		if opts.Verifier.Name() == opts.Hasher.Name() {
+			// Hash of the fast pass is as strong as that of verification, so it's reused
+			digest.StrongAlgorithm, digest.StrongHash = opts.Verifier.Name(), digest.FileHash
+			verified[digest] = paths
+			continue
+		}
+		groups, resolvedPaths := escalate(ctx, opts, paths, digest.FileSize)
+		if ctx.Err() != nil {
+			return verified
+		}
+		for _, path := range resolvedPaths {
+			resolved[path] = digest
+		}
+		opts.Metrics.FilesResolvedEarly.Add(int64(len(resolvedPaths)))
+		for _, group := range groups {
+			failed := 0
+			for i, path := range group {
+				if i == len(group)-1 && failed == i {
+					// None of the others are left to be a duplicate of it
+					resolved[path] = digest
+					opts.Metrics.FilesResolvedEarly.Add(1)
+					break
+				}
+				upgraded, err := upgradeDigest(ctx, opts.FS, path, digest, opts.Verifier, opts.fileInfo)
+				if ctx.Err() != nil {
+					return verified
+				}
+				if err != nil {
+					failed++
+					if !opts.vanished(err, left) {
+						opts.Logger.PrintfErr("error while verifying %s: %+v\n", path, err)
+						opts.Listener.OnError(path, err)
+					}
+					continue
+				}
+				verified[upgraded] = append(verified[upgraded], path)
+			}
+		}
+	}
+	return verified
 }
 
-// identifyShortList identifies the files that may have duplicates
-func identifyShortList(filesAndMeta entity.FilePathToMeta) (shortlist entity.FileExtAndSizeToFiles) {
+// identifyShortList identifies the files that may have duplicates. Files whose extension and size are unique are
+// kept too, if keepUnique says so.
+func identifyShortList(filesAndMeta entity.FilePathToMeta, keepUnique func(entity.FileExtAndSize) bool,
+) (shortlist entity.FileExtAndSizeToFiles) {
 	shortlist = make(entity.FileExtAndSizeToFiles, len(filesAndMeta))
 	// Group the files that have same extension and same size
 	for path, meta := range filesAndMeta {
 		fileExtAndSize := entity.FileExtAndSize{FileExtension: utils.GetFileExt(path), FileSize: meta.Size}
 		shortlist[fileExtAndSize] = append(shortlist[fileExtAndSize], path)
 	}
-	// Remove non-duplicates
+	// Remove non-duplicates, and sort the rest, so that files of a group are hashed in the same order by every scan
 	for fileExtAndSize, paths := range shortlist {
-		if len(paths) <= 1 {
+		if len(paths) <= 1 && !keepUnique(fileExtAndSize) {
 			delete(shortlist, fileExtAndSize)
+		} else {
+			slices.Sort(paths)
 		}
 	}
 	return shortlist
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+)
+
+// FindDuplicatesStream is like FindDuplicates, except that every group of duplicates is sent on the returned channel
+// as soon as it's confirmed, rather than after the entire scan. Both channels are closed once the scan ends, and at
+// most one error is sent on the error channel. Callers that stop reading groups early must cancel ctx.
+func FindDuplicatesStream(ctx context.Context, opts Options) (<-chan entity.DuplicateGroup, <-chan error) {
+	groups := make(chan entity.DuplicateGroup)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(groups)
+		opts = opts.withDefaults()
+		opts.Listener = &streamingListener{ctx: ctx, groups: groups, ProgressListener: opts.Listener}
+		if _, err := FindDuplicates(ctx, opts); err != nil {
+			errs <- err
+		}
+	}()
+	return groups, errs
+}
+
+// streamingListener forwards groups found to a channel, and all notifications to the wrapped listener
+type streamingListener struct {
+	ProgressListener
+	ctx    context.Context
+	groups chan<- entity.DuplicateGroup
+}
+
+func (s *streamingListener) OnGroupFound(digest entity.FileDigest, paths []string) {
+	s.ProgressListener.OnGroupFound(digest, paths)
+	sortedPaths := append([]string(nil), paths...)
+	sort.Strings(sortedPaths)
+	select {
+	case s.groups <- entity.DuplicateGroup{Digest: digest, Paths: sortedPaths}:
+	case <-s.ctx.Done():
+	}
+}
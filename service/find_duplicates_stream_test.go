@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFindDuplicatesStream checks whether FindDuplicatesStream emits the same duplicates as FindDuplicates
+func TestFindDuplicatesStream(t *testing.T) {
+	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+	directories := []string{filepath.Join(runtime.GOROOT(), "src")}
+	fmte.Off()
+	opts := NewOptions(directories, WithExcludedFiles(exclusions), WithFileSizeThreshold(4_196))
+	result, err := FindDuplicates(context.Background(), opts)
+	assert.Nil(t, err)
+	groups, errs := FindDuplicatesStream(context.Background(), opts)
+	streamedFiles := set.NewThreadUnsafeSet[string]()
+	numGroups := 0
+	for group := range groups {
+		numGroups++
+		assert.Greater(t, len(group.Paths), 1)
+		for _, path := range group.Paths {
+			streamedFiles.Add(path)
+		}
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, result.Duplicates.Size(), numGroups)
+	assert.True(t, extractFiles(result.Duplicates).Equal(streamedFiles))
+}
@@ -1,14 +1,29 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	set "github.com/deckarep/golang-set/v2"
 	"github.com/m-manu/go-find-duplicates/entity"
 	"github.com/m-manu/go-find-duplicates/fmte"
-	"github.com/m-manu/go-find-duplicates/utils"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/vfs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,12 +42,12 @@ func TestFindDuplicates(t *testing.T) {
 	}
 	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
 	fmte.Off()
-	duplicates, duplicateCount, savingsSize, _, err := FindDuplicates(directories, exclusions,
-		4_196, 2, false)
+	result, err := FindDuplicates(context.Background(), NewOptions(directories, WithExcludedFiles(exclusions),
+		WithFileSizeThreshold(4_196), WithParallelism(2)))
 	assert.Nil(t, err)
-	assert.GreaterOrEqual(t, duplicates.Size(), 0)
-	assert.GreaterOrEqual(t, duplicateCount, int64(0))
-	assert.GreaterOrEqual(t, savingsSize, int64(0))
+	assert.GreaterOrEqual(t, result.Duplicates.Size(), 0)
+	assert.GreaterOrEqual(t, result.DuplicateTotalCount, int64(0))
+	assert.GreaterOrEqual(t, result.SavingsSize, int64(0))
 }
 
 // TestNonThoroughVsNot checks whether FindDuplicates with 'thorough mode' on and off returns the same results
@@ -40,26 +55,782 @@ func TestNonThoroughVsNot(t *testing.T) {
 	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
 	goRoot := []string{runtime.GOROOT()}
 	fmte.Off()
-	duplicatesExpected, duplicateCountExpected, savingsSizeExpected, _, tErr := FindDuplicates(goRoot, exclusions,
-		4_196, 2, false)
+	expected, tErr := FindDuplicates(context.Background(), NewOptions(goRoot, WithExcludedFiles(exclusions),
+		WithFileSizeThreshold(4_196), WithParallelism(2), WithHasher(SampledHasher{})))
 	assert.Nil(t, tErr, "error while scanning for duplicates in GOROOT directory")
-	duplicatesActual, duplicateCountActual, savingsSizeActual, _, ntErr := FindDuplicates(goRoot, exclusions,
-		4_196, 5, true)
+	actual, ntErr := FindDuplicates(context.Background(), NewOptions(goRoot, WithExcludedFiles(exclusions),
+		WithFileSizeThreshold(4_196), WithParallelism(5), WithHasher(SHA256Hasher{})))
 	assert.Nil(t, ntErr, "error while thoroughly scanning for duplicates in GOROOT directory")
-	actualDuplicateFilePaths := extractFiles(duplicatesActual)
-	expectedDuplicateFilePaths := extractFiles(duplicatesExpected)
+	actualDuplicateFilePaths := extractFiles(actual.Duplicates)
+	expectedDuplicateFilePaths := extractFiles(expected.Duplicates)
 	assert.True(t, actualDuplicateFilePaths.Equal(expectedDuplicateFilePaths), "Duplicate files differed between thorough and non-thorough modes")
-	assert.Equal(t, duplicateCountExpected, duplicateCountActual, "Number of duplicates differed between thorough and non-thorough modes")
-	assert.Equal(t, savingsSizeExpected, savingsSizeActual, "Savings expected differed between thorough and non-thorough modes")
+	assert.Equal(t, expected.DuplicateTotalCount, actual.DuplicateTotalCount, "Number of duplicates differed between thorough and non-thorough modes")
+	assert.Equal(t, expected.SavingsSize, actual.SavingsSize, "Savings expected differed between thorough and non-thorough modes")
+}
+
+// TestFindDuplicatesOnFS checks whether FindDuplicates finds exactly the expected duplicates on an in-memory file system
+func TestFindDuplicatesOnFS(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	other := bytes.Repeat([]byte("different "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":          {Data: content},
+		"a/2.txt":          {Data: content},
+		"b/3.txt":          {Data: content},
+		"b/4.txt":          {Data: other},
+		"b/5.dat":          {Data: content},
+		"b/vendor/6.txt":   {Data: content},
+		"b/small/7.txt":    {Data: []byte("tiny")},
+		"b/small/8.txt":    {Data: []byte("tiny")},
+		"a/._resource.txt": {Data: content},
+	})
+	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+	fmte.Off()
+	for _, hasher := range Hashers {
+		result, err := FindDuplicates(context.Background(), NewOptions([]string{"a", "b"}, WithFS(fsys),
+			WithExcludedFiles(exclusions), WithFileSizeThreshold(1_024), WithHasher(hasher)))
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(result.AllFiles))
+		assert.Equal(t, 1, result.Duplicates.Size())
+		assert.Equal(t, int64(2), result.DuplicateTotalCount)
+		assert.Equal(t, 2*int64(len(content)), result.SavingsSize)
+		assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.txt", "a/2.txt", "b/3.txt")))
+	}
+}
+
+// TestFindDuplicatesExcludedPatterns checks whether glob patterns of exclusions exclude files and directories
+func TestFindDuplicatesExcludedPatterns(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":         {Data: content},
+		"a/2.txt":         {Data: content},
+		"a/3.tmp":         {Data: content},
+		"a/cache-1/4.txt": {Data: content},
+		"a/cache/5.txt":   {Data: content},
+		"a/[x]/6.txt":     {Data: content},
+	})
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithExcludedFiles(set.NewThreadUnsafeSet("*.tmp", "cache-?", `\[x]`, "cache")), WithFileSizeThreshold(1_024)))
+	assert.Nil(t, err)
+	assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.txt", "a/2.txt")))
+}
+
+// TestFindDuplicatesNormalizedNames checks whether names composed differently (as by macOS, of "é" as "e" followed by
+// a combining accent) are the same for grouping files by their extensions and for exclusions
+func TestFindDuplicatesNormalizedNames(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.caf\u00e9":               {Data: content},
+		"a/2.cafe\u0301":              {Data: content},
+		"a/re\u0301sume\u0301s/3.txt": {Data: content},
+		"a/4.txt":                     {Data: content},
+	})
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithExcludedFiles(set.NewThreadUnsafeSet("r\u00e9sum\u00e9s")), WithFileSizeThreshold(1_024)))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(result.AllFiles))
+	assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.caf\u00e9", "a/2.cafe\u0301")))
+}
+
+// TestFindDuplicatesVerifier checks whether files whose sampled hashes collide are told apart by verification, which
+// hashes entirely only those that still collide once early chunks are compared
+func TestFindDuplicatesVerifier(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 6_000)
+	altered := bytes.Clone(content)
+	altered[20_000] = '!'
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+		"a/3.txt": {Data: altered},
+	})
+	fmte.Off()
+	unverified, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), unverified.DuplicateTotalCount)
+
+	for _, verifier := range []Hasher{SHA256Hasher{}, BLAKE3Hasher{}} {
+		m := NewScanMetrics(nil)
+		verified, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+			WithVerifier(verifier), WithMetrics(m)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), verified.DuplicateTotalCount)
+		assert.True(t, extractFiles(verified.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.txt", "a/2.txt")))
+		digest := verified.Digests["a/1.txt"]
+		assert.Equal(t, verifier.Name(), digest.StrongAlgorithm)
+		assert.Equal(t, unverified.Digests["a/1.txt"], digest.Fast())
+		// a/3.txt differs within the chunks compared, so it's neither hashed entirely nor upgraded
+		assert.Equal(t, int64(1), m.FilesResolvedEarly.Value())
+		assert.Equal(t, int64(5), m.FilesHashed.Value())
+		assert.Equal(t, unverified.Digests["a/3.txt"], verified.Digests["a/3.txt"])
+	}
+}
+
+// TestScanMetrics checks whether metrics are updated by scans, including hits and misses of the cache
+// TestFindDuplicatesAcrossHosts checks whether digests exported by one scan find files with same contents in another,
+// even if they're unique within it
+func TestFindDuplicatesAcrossHosts(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	fmte.Off()
+	exported, err := FindDuplicates(context.Background(), NewOptions([]string{"nas"}, WithHashAllFiles(true),
+		WithFS(vfs.FromFS(fstest.MapFS{
+			"nas/1.txt": {Data: content},
+			"nas/2.txt": {Data: bytes.Repeat([]byte("different "), 3_000)},
+			"nas/3.txt": {Data: bytes.Repeat([]byte("unique "), 3_000)},
+		}))))
+	assert.Nil(t, err)
+	assert.Len(t, exported.Digests, 3)
+	assert.Equal(t, 0, exported.Duplicates.Size())
+	index := &entity.DigestIndex{Algorithm: DefaultHasher.Name(), Digests: exported.Digests}
+
+	laptop := vfs.FromFS(fstest.MapFS{
+		"laptop/a.txt": {Data: content},
+		"laptop/b.txt": {Data: bytes.Repeat([]byte("changed!! "), 3_000)},
+		"laptop/c.dat": {Data: content},
+	})
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"laptop"}, WithFS(laptop),
+		WithExternalDigests(index)))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"laptop/a.txt": {"nas/1.txt"}}, result.ExternalMatches)
+	_, err = FindDuplicates(context.Background(), NewOptions([]string{"laptop"}, WithFS(laptop),
+		WithExternalDigests(index), WithHasher(SHA256Hasher{})))
+	assert.ErrorContains(t, err, "external digests were computed by sampled hash")
+}
+
+// TestFindDuplicatesOfChecksums checks whether digests of checksum manifests, which have no sizes, match files by
+// their hashes alone
+func TestFindDuplicatesOfChecksums(t *testing.T) {
+	content := bytes.Repeat([]byte("archived "), 3_000)
+	sum := sha256.Sum256(content)
+	index := &entity.DigestIndex{Algorithm: SHA256Hasher{}.Name(), Digests: map[string]entity.FileDigest{
+		"archive/x.txt": {FileHash: hex.EncodeToString(sum[:]), FileSize: entity.UnknownFileSize},
+		"archive/y.txt": {FileHash: strings.Repeat("0", 64), FileSize: entity.UnknownFileSize},
+	}}
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"laptop"}, WithHasher(SHA256Hasher{}),
+		WithFS(vfs.FromFS(fstest.MapFS{
+			"laptop/a.txt": {Data: content},
+			"laptop/b.dat": {Data: content},
+			"laptop/c.txt": {Data: bytes.Repeat([]byte("changed! "), 3_000)},
+		})), WithExternalDigests(index)))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"laptop/a.txt": {"archive/x.txt"}, "laptop/b.dat": {"archive/x.txt"}},
+		result.ExternalMatches)
+}
+
+func TestScanMetrics(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":     {Data: content},
+		"a/2.txt":     {Data: content},
+		"a/3.txt":     {Data: bytes.Repeat([]byte("different "), 3_000)},
+		"a/4.txt":     {Data: bytes.Repeat([]byte("unique "), 3_000)},
+		"a/small.txt": {Data: []byte("tiny")},
+	})
+	fmte.Off()
+	m := NewScanMetrics(nil)
+	opts := NewOptions([]string{"a"}, WithFS(fsys), WithFileSizeThreshold(1_024), WithMetrics(m),
+		WithCache(digestcache.NewMemory()))
+	for i := 0; i < 2; i++ {
+		_, err := FindDuplicates(context.Background(), opts)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int64(10), m.FilesWalked.Value())
+	assert.Equal(t, int64(2), m.FilesOfUniqueSize.Value())
+	assert.Equal(t, int64(3), m.FilesHashed.Value())
+	assert.Equal(t, 3*int64(len(content)), m.BytesHashed.Value())
+	assert.Equal(t, int64(3), m.HashLatency.Snapshot().Count)
+	assert.Equal(t, int64(3), m.CacheMisses.Value())
+	assert.Equal(t, int64(3), m.CacheHits.Value())
+	assert.Equal(t, 0.5, m.CacheHitRatio())
+	assert.Equal(t, int64(2), m.GroupsFound.Value())
+	assert.Equal(t, int64(0), m.HashErrors.Value())
+	assert.Equal(t, int64(2), m.ScanDuration.Snapshot().Count)
+	assert.Equal(t, int64(2), m.DuplicatesFound.Value())
+	assert.Equal(t, int64(len(content)), m.ReclaimableBytes.Value())
+}
+
+// TestFindDuplicatesLogger checks whether messages of a scan go to the logger given
+func TestFindDuplicatesLogger(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+	})
+	var out, errOut bytes.Buffer
+	fmte.Off()
+	_, err := FindDuplicates(context.Background(), NewOptions([]string{"a", "missing"}, WithFS(fsys),
+		WithFileSizeThreshold(1_024), WithLogger(fmte.NewLogger(&out, &errOut))))
+	assert.ErrorIs(t, err, ErrNotReadable)
+	assert.Contains(t, out.String(), "Scanning 2 directories...")
+
+	out.Reset()
+	_, err = FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithFileSizeThreshold(1_024), WithLogger(fmte.NewLogger(&out, &errOut))))
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "Scan completed.")
+}
+
+// TestFindDuplicatesFilters checks whether file and group filters are honored
+func TestFindDuplicatesFilters(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	other := bytes.Repeat([]byte("different "), 3_000)
+	fsys := vfs.FromFS(fstest.MapFS{
+		"a/1.txt":         {Data: content},
+		"a/2.txt":         {Data: content},
+		"a/active/3.txt":  {Data: content},
+		"b/4.txt":         {Data: other},
+		"b/5.txt":         {Data: other},
+		"b/6.txt":         {Data: other},
+		"b/7.txt":         {Data: other},
+		"b/active/8.txt":  {Data: other},
+		"b/keep/9.txt":    {Data: other},
+		"b/keep/10.other": {Data: content},
+	})
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a", "b"}, WithFS(fsys),
+		WithFileSizeThreshold(1_024),
+		WithFileFilter(func(path string, info fs.FileInfo) bool {
+			return !(info.IsDir() && info.Name() == "active")
+		}),
+		WithFileFilter(func(path string, info fs.FileInfo) bool {
+			return info.IsDir() || filepath.Ext(path) == ".txt"
+		}),
+		WithGroupFilter(func(group entity.DuplicateGroup) bool {
+			return len(group.Paths) <= 3
+		}),
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(result.AllFiles))
+	assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.txt", "a/2.txt")))
+}
+
+func TestExtensionFilter(t *testing.T) {
+	fsys := fstest.MapFS{
+		"photos/1.JPG":  {},
+		"photos/2.jpeg": {},
+		"photos/3.txt":  {},
+		"photos/4":      {},
+	}
+	filter := ExtensionFilter("jpg", ".jpeg")
+	for name, expected := range map[string]bool{"photos": true, "photos/1.JPG": true, "photos/2.jpeg": true,
+		"photos/3.txt": false, "photos/4": false} {
+		info, err := fs.Stat(fsys, name)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, filter(name, info), name)
+	}
+}
+
+// TestConcurrentScans checks whether multiple scans running concurrently in one process get the same results as
+// a scan running alone
+func TestConcurrentScans(t *testing.T) {
+	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+	fmte.Off()
+	opts := NewOptions([]string{filepath.Join(runtime.GOROOT(), "src")}, WithExcludedFiles(exclusions),
+		WithFileSizeThreshold(4_196), WithParallelism(2))
+	expected, err := FindDuplicates(context.Background(), opts)
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	results := make([]Result, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fmte.Off()
+			results[i], _ = FindDuplicates(context.Background(), opts)
+		}(i)
+	}
+	wg.Wait()
+	for _, actual := range results {
+		assert.Equal(t, expected.DuplicateTotalCount, actual.DuplicateTotalCount)
+		assert.True(t, extractFiles(expected.Duplicates).Equal(extractFiles(actual.Duplicates)))
+	}
+}
+
+// TestFindDuplicatesCancelled checks whether FindDuplicates stops and reports the cancellation when ctx is done
+func TestFindDuplicatesCancelled(t *testing.T) {
+	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fmte.Off()
+	_, err := FindDuplicates(ctx, NewOptions([]string{runtime.GOROOT()}, WithExcludedFiles(exclusions)))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+type countingListener struct {
+	NoOpProgressListener
+	mx         sync.Mutex
+	discovered int
+	hashed     int
+	groups     int
+}
+
+func (c *countingListener) OnFileDiscovered(string, entity.FileMeta) {
+	c.mx.Lock()
+	c.discovered++
+	c.mx.Unlock()
+}
+
+func (c *countingListener) OnFileHashed(string, entity.FileDigest) {
+	c.mx.Lock()
+	c.hashed++
+	c.mx.Unlock()
+}
+
+func (c *countingListener) OnGroupFound(entity.FileDigest, []string) {
+	c.mx.Lock()
+	c.groups++
+	c.mx.Unlock()
+}
+
+// TestProgressListener checks whether the listener passed to FindDuplicates is notified consistently with the results
+func TestProgressListener(t *testing.T) {
+	exclusions, _ := utils.LineSeparatedStrToMap(exclusionsStr)
+	listener := &countingListener{}
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{filepath.Join(runtime.GOROOT(), "src")},
+		WithExcludedFiles(exclusions), WithListener(listener)))
+	assert.Nil(t, err)
+	assert.Equal(t, len(result.AllFiles), listener.discovered)
+	assert.LessOrEqual(t, listener.hashed, listener.discovered)
+	assert.Equal(t, result.Duplicates.Size(), listener.groups)
+}
+
+// orderListener records sizes of files in the order they're hashed
+type orderListener struct {
+	NoOpProgressListener
+	mx    sync.Mutex
+	sizes []int64
+}
+
+func (o *orderListener) OnFileHashed(_ string, digest entity.FileDigest) {
+	o.mx.Lock()
+	o.sizes = append(o.sizes, digest.FileSize)
+	o.mx.Unlock()
+}
+
+// TestFindDuplicatesLargestFirst checks whether files are hashed in descending order of their sizes
+func TestFindDuplicatesLargestFirst(t *testing.T) {
+	files := fstest.MapFS{}
+	for i, size := range []int{3_000, 90_000, 500, 20_000, 7_000} {
+		content := bytes.Repeat([]byte{byte('a' + i)}, size)
+		files[fmt.Sprintf("a/%d-1.txt", i)] = &fstest.MapFile{Data: content}
+		files[fmt.Sprintf("a/%d-2.txt", i)] = &fstest.MapFile{Data: content}
+	}
+	listener := &orderListener{}
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(vfs.FromFS(files)),
+		WithFileSizeThreshold(1), WithParallelism(1), WithListener(listener)))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, result.Duplicates.Size())
+	assert.Equal(t, []int64{90_000, 90_000, 20_000, 20_000, 7_000, 7_000, 3_000, 3_000, 500, 500}, listener.sizes)
+}
+
+// TestFindDuplicatesSkipsNonRegular checks whether links (unless they're followed) and other files that aren't regular
+// files are skipped, and counted
+func TestFindDuplicatesSkipsNonRegular(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 200)
+	files := fstest.MapFS{
+		"a/1.txt":  {Data: content},
+		"a/2.txt":  {Data: content},
+		"a/3.txt":  {Data: []byte("a/1.txt"), Mode: fs.ModeSymlink},
+		"a/fifo":   {Mode: fs.ModeNamedPipe},
+		"a/socket": {Mode: fs.ModeSocket},
+	}
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(vfs.FromFS(files)),
+		WithFileSizeThreshold(1), WithReportSymlinks(true)))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.FileCount)
+	assert.Equal(t, 1, result.SkippedLinks)
+	assert.Equal(t, 2, result.SkippedIrregular)
+	assert.Equal(t, int64(1), result.DuplicateTotalCount)
+}
+
+// changingFS is a vfs.FS whose files of changed are of another modification time (than found while walking) once
+// they're statted
+type changingFS struct {
+	vfs.FS
+	changed map[string]bool
+}
+
+func (c changingFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := c.FS.Stat(name)
+	if err != nil || !c.changed[name] {
+		return info, err
+	}
+	return changedInfo{info}, nil
+}
+
+type changedInfo struct {
+	fs.FileInfo
+}
+
+func (i changedInfo) ModTime() time.Time {
+	return i.FileInfo.ModTime().Add(time.Second)
+}
+
+// TestFindDuplicatesUnstable checks whether files that changed while they were hashed are left out of groups
+func TestFindDuplicatesUnstable(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 200)
+	files := fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+		"a/3.txt": {Data: content},
+		"a/4.dat": {Data: content},
+		"a/5.dat": {Data: content},
+	}
+	fmte.Off()
+	fsys := changingFS{FS: vfs.FromFS(files), changed: map[string]bool{"a/3.txt": true, "a/5.dat": true}}
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithFileSizeThreshold(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/3.txt", "a/5.dat"}, result.Unstable)
+	assert.True(t, set.NewThreadUnsafeSet("a/1.txt", "a/2.txt").Equal(extractFiles(result.Duplicates)))
+	assert.Equal(t, int64(1), result.DuplicateTotalCount)
+	assert.NotContains(t, result.Digests, "a/3.txt")
+	assert.NotContains(t, result.Digests, "a/5.dat")
+}
+
+// TestFindDuplicatesSpillAfter checks whether spilling files to disk finds the same duplicates as keeping all files
+// in memory, with only potential duplicates in Result.AllFiles, and whether potential duplicates of all shards are
+// logged once
+func TestFindDuplicatesSpillAfter(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	other := bytes.Repeat([]byte("different "), 4_000)
+	files := fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"b/2.txt": {Data: content},
+		"b/3.dat": {Data: content},
+		"a/4.txt": {Data: other},
+		"b/5.txt": {Data: other},
+	}
+	for i := range 7 {
+		files[fmt.Sprintf("a/unique-%d.txt", i)] = &fstest.MapFile{Data: bytes.Repeat([]byte("u"), 2_000+i)}
+	}
+	fmte.Off()
+	expected, err := FindDuplicates(context.Background(), NewOptions([]string{"a", "b"}, WithFS(vfs.FromFS(files)),
+		WithFileSizeThreshold(1_024)))
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	actual, err := FindDuplicates(context.Background(), NewOptions([]string{"a", "b"}, WithFS(vfs.FromFS(files)),
+		WithFileSizeThreshold(1_024), WithSpillAfter(2), WithLogger(fmte.NewLogger(&out, io.Discard))))
+	assert.Nil(t, err)
+	assert.Equal(t, 12, expected.FileCount)
+	assert.Equal(t, 12, actual.FileCount)
+	assert.Len(t, expected.AllFiles, 12)
+	assert.Equal(t, entity.FilePathToMeta{
+		"a/1.txt": expected.AllFiles["a/1.txt"],
+		"b/2.txt": expected.AllFiles["b/2.txt"],
+		"a/4.txt": expected.AllFiles["a/4.txt"],
+		"b/5.txt": expected.AllFiles["b/5.txt"],
+	}, actual.AllFiles)
+	assert.True(t, extractFiles(actual.Duplicates).Equal(extractFiles(expected.Duplicates)))
+	assert.Equal(t, expected.SavingsSize, actual.SavingsSize)
+	assert.Equal(t, expected.DuplicateTotalCount, actual.DuplicateTotalCount)
+	assert.Equal(t, 1, strings.Count(out.String(), "Completed."))
+	assert.Contains(t, out.String(), "Completed. Found 4 files that may have one or more duplicates!")
+}
+
+func TestFileIndexShards(t *testing.T) {
+	index := newFileIndex(10)
+	defer index.close()
+	for i := range 100 {
+		assert.Nil(t, index.add(fmt.Sprintf("%d/a.txt", i), entity.FileMeta{Size: int64(1_000 + i%25)}))
+	}
+	assert.True(t, index.spilled())
+	assert.Equal(t, 10, index.shards())
+	seen := map[string]bool{}
+	groups := 0
+	for shard := range index.shards() {
+		count := 0
+		assert.Nil(t, index.forEach(shard, index.shards(), func(path string, _ entity.FileMeta) {
+			assert.False(t, seen[path])
+			seen[path] = true
+			count++
+		}))
+		assert.Less(t, count, 100)
+		shortlist, files, err := index.shortlist(func(entity.FileExtAndSize) bool { return false }, shard,
+			index.shards())
+		assert.Nil(t, err)
+		for _, paths := range shortlist {
+			assert.Len(t, paths, 4)
+		}
+		assert.Len(t, files, 4*len(shortlist))
+		groups += len(shortlist)
+	}
+	assert.Len(t, seen, 100)
+	assert.Equal(t, 25, groups)
+}
+
+// statCountingFS is a vfs.FS that counts files statted
+type statCountingFS struct {
+	vfs.FS
+	stats atomic.Int64
+}
+
+func (c *statCountingFS) Stat(name string) (fs.FileInfo, error) {
+	c.stats.Add(1)
+	return c.FS.Stat(name)
+}
+
+func (c *statCountingFS) Lstat(name string) (fs.FileInfo, error) {
+	c.stats.Add(1)
+	return c.FS.Lstat(name)
+}
+
+// TestFindDuplicatesStatsOnce checks whether files are hashed (and verified) by their metadata found while walking,
+// rather than by statting them again, and are statted once more only to check that they haven't changed since
+func TestFindDuplicatesStatsOnce(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 6_000)
+	altered := bytes.Clone(content)
+	altered[20_000] = '!'
+	fsys := &statCountingFS{FS: vfs.FromFS(fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+		"a/3.txt": {Data: altered},
+	})}
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithFileSizeThreshold(1_024), WithVerifier(SHA256Hasher{})))
+	assert.Nil(t, err)
+	assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.txt", "a/2.txt")))
+	// The directory scanned is statted by walking, and files hashed once their digests are committed
+	assert.Equal(t, int64(4), fsys.stats.Load())
+}
+
+// entryCountingFS is a vfs.FS that counts files statted through entries of directories read
+type entryCountingFS struct {
+	vfs.FS
+	stats atomic.Int64
+}
+
+func (c *entryCountingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := c.FS.ReadDir(name)
+	for i, entry := range entries {
+		entries[i] = countingEntry{DirEntry: entry, stats: &c.stats}
+	}
+	return entries, err
+}
+
+type countingEntry struct {
+	fs.DirEntry
+	stats *atomic.Int64
+}
+
+func (e countingEntry) Info() (fs.FileInfo, error) {
+	e.stats.Add(1)
+	return e.DirEntry.Info()
+}
+
+// TestFindDuplicatesStatsFilteredOut checks whether files and directories that filters leave out by their names
+// aren't statted
+func TestFindDuplicatesStatsFilteredOut(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	fsys := &entryCountingFS{FS: vfs.FromFS(fstest.MapFS{
+		"a/1.jpg":       {Data: content},
+		"a/2.jpg":       {Data: content},
+		"a/3.txt":       {Data: content},
+		"a/4.txt":       {Data: content},
+		"a/skip/5.jpg":  {Data: content},
+		"a/other/6.txt": {Data: content},
+	})}
+	skipDir := func(path string, info fs.FileInfo) bool { return !info.IsDir() || info.Name() != "skip" }
+	fmte.Off()
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(fsys),
+		WithFileSizeThreshold(1_024), WithFileFilter(ExtensionFilter("jpg")), WithFileFilter(skipDir)))
+	assert.Nil(t, err)
+	assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.jpg", "a/2.jpg")))
+	assert.Equal(t, int64(2), fsys.stats.Load())
 }
 
 func extractFiles(duplicatesExpected *entity.DigestToFiles) set.Set[string] {
 	expectedDuplicatesFiles := set.NewThreadUnsafeSet[string]()
-	for iter := duplicatesExpected.Iterator(); iter.HasNext(); {
-		_, paths := iter.Next()
+	for _, paths := range duplicatesExpected.All() {
 		for _, path := range paths {
 			expectedDuplicatesFiles.Add(path)
 		}
 	}
 	return expectedDuplicatesFiles
 }
+
+// TestFindDuplicatesFollowSymlinks checks whether links are skipped unless they're followed, and whether files are
+// found once when they are
+func TestFindDuplicatesFollowSymlinks(t *testing.T) {
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	scanned, outside := filepath.Join(root, "scanned"), filepath.Join(root, "outside")
+	for _, path := range []string{filepath.Join(scanned, "1.txt"), filepath.Join(scanned, "2.txt"),
+		filepath.Join(outside, "3.txt")} {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, content, 0o644))
+	}
+	for link, target := range map[string]string{
+		"1-link.txt": "1.txt",
+		"outside":    filepath.Join("..", "outside"),
+		"outside-2":  outside,
+		"loop":       ".",
+	} {
+		if err := os.Symlink(target, filepath.Join(scanned, link)); err != nil {
+			t.Skipf("can't create symbolic links: %v", err)
+		}
+	}
+	fmte.Off()
+	for followSymlinks, expected := range map[bool][]string{
+		false: {"1.txt", "2.txt"},
+		true:  {"1.txt", "2.txt", filepath.Join("outside", "3.txt")},
+	} {
+		result, err := FindDuplicates(context.Background(), NewOptions([]string{scanned},
+			WithFileSizeThreshold(1_024), WithFollowSymlinks(followSymlinks)))
+		assert.Nil(t, err)
+		var found []string
+		for path := range result.AllFiles {
+			rel, _ := filepath.Rel(scanned, path)
+			found = append(found, rel)
+		}
+		assert.ElementsMatch(t, expected, found, "following symbolic links: %v", followSymlinks)
+		assert.Equal(t, int64(len(expected)-1), result.DuplicateTotalCount)
+	}
+}
+
+// TestFindDuplicatesOverlappingDirectories checks whether directories that are in (or are, through links) others
+// scanned are skipped, so that files aren't found as duplicates of themselves
+func TestFindDuplicatesOverlappingDirectories(t *testing.T) {
+	fmte.Off()
+	files := vfs.FromFS(fstest.MapFS{"a/b/1.txt": {Data: []byte("one")}, "c/2.txt": {Data: []byte("two")}})
+	assert.Equal(t, []string{"a", "c"}, distinctDirectories(NewOptions([]string{"a/b", "a", "c", "a", "a/b"},
+		WithFS(files))))
+
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("duplicate "), 3_000)
+	scanned := filepath.Join(root, "scanned")
+	assert.Nil(t, os.MkdirAll(filepath.Join(scanned, "sub"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(scanned, "sub", "1.txt"), content, 0o644))
+	if err := os.Symlink(filepath.Join("scanned", "sub"), filepath.Join(root, "link")); err != nil {
+		t.Skipf("can't create symbolic links: %v", err)
+	}
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{filepath.Join(root, "link"), scanned},
+		WithFileSizeThreshold(1_024)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.FileCount)
+	assert.Equal(t, int64(0), result.DuplicateTotalCount)
+}
+
+// unopenableFS is a vfs.FS of which a file can be opened only so many times, failing with err (or a permission
+// error, if that's nil) after
+type unopenableFS struct {
+	vfs.FS
+	name  string
+	after int64
+	err   error
+	opens atomic.Int64
+}
+
+func (u *unopenableFS) Open(name string) (fs.File, error) {
+	if name == u.name && u.opens.Add(1) > u.after {
+		err := u.err
+		if err == nil {
+			err = fs.ErrPermission
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return u.FS.Open(name)
+}
+
+// TestFindDuplicatesResolvedByFailures checks whether a file that's left without others of its size by files that
+// couldn't be hashed isn't hashed either (unless digests of all files are wanted), nor verified if it's left without
+// others by files that couldn't be verified
+func TestFindDuplicatesResolvedByFailures(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 6_000)
+	files := vfs.FromFS(fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+	})
+	fmte.Off()
+	m := NewScanMetrics(nil)
+	result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"},
+		WithFS(&unopenableFS{FS: files, name: "a/1.txt"}), WithFileSizeThreshold(1_024), WithMetrics(m)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.DuplicateTotalCount)
+	assert.NotContains(t, result.Digests, "a/2.txt")
+	assert.Equal(t, int64(1), m.FilesResolvedEarly.Value())
+
+	result, err = FindDuplicates(context.Background(), NewOptions([]string{"a"},
+		WithFS(&unopenableFS{FS: files, name: "a/1.txt"}), WithFileSizeThreshold(1_024), WithHashAllFiles(true)))
+	assert.Nil(t, err)
+	assert.Contains(t, result.Digests, "a/2.txt")
+
+	// a/1.txt is hashed by its crucial bytes, but can't be compared by escalation, nor hashed entirely
+	m = NewScanMetrics(nil)
+	result, err = FindDuplicates(context.Background(), NewOptions([]string{"a"},
+		WithFS(&unopenableFS{FS: files, name: "a/1.txt", after: 1}), WithFileSizeThreshold(1_024), WithMetrics(m),
+		WithVerifier(SHA256Hasher{})))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.DuplicateTotalCount)
+	assert.Equal(t, int64(1), m.FilesResolvedEarly.Value())
+	assert.Empty(t, result.Digests["a/2.txt"].StrongHash)
+}
+
+// errorCountingListener counts errors that scans notify of
+type errorCountingListener struct {
+	NoOpProgressListener
+	errors atomic.Int64
+}
+
+func (l *errorCountingListener) OnError(string, error) {
+	l.errors.Add(1)
+}
+
+// TestFindDuplicatesVanished checks whether files deleted between walking and hashing (or verifying) them are
+// skipped, and counted, rather than reported as errors
+func TestFindDuplicatesVanished(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 6_000)
+	files := vfs.FromFS(fstest.MapFS{
+		"a/1.txt": {Data: content},
+		"a/2.txt": {Data: content},
+		"a/3.txt": {Data: content},
+	})
+	fmte.Off()
+	for _, after := range []int64{0, 1} {
+		m := NewScanMetrics(nil)
+		listener := &errorCountingListener{}
+		result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"},
+			WithFS(&unopenableFS{FS: files, name: "a/3.txt", after: after, err: fs.ErrNotExist}),
+			WithFileSizeThreshold(1_024), WithMetrics(m), WithListener(listener), WithVerifier(SHA256Hasher{})))
+		assert.Nil(t, err)
+		assert.True(t, extractFiles(result.Duplicates).Equal(set.NewThreadUnsafeSet("a/1.txt", "a/2.txt")))
+		assert.Equal(t, 1, result.Vanished)
+		assert.Equal(t, int64(1), m.FilesVanished.Value())
+		assert.Equal(t, int64(0), m.HashErrors.Value())
+		assert.Equal(t, int64(0), listener.errors.Load())
+	}
+}
+
+// TestFindDuplicatesKnownUnique checks whether files that a scan told apart from all others of the same extension and
+// size aren't hashed again by later scans, until another file of the same extension and size is found
+func TestFindDuplicatesKnownUnique(t *testing.T) {
+	files := fstest.MapFS{
+		"a/1.txt": {Data: bytes.Repeat([]byte("one "), 5_000)},
+		"a/2.txt": {Data: bytes.Repeat([]byte("two "), 5_000)},
+	}
+	store := digestcache.NewMemory()
+	fmte.Off()
+	scan := func() *ScanMetrics {
+		m := NewScanMetrics(nil)
+		result, err := FindDuplicates(context.Background(), NewOptions([]string{"a"}, WithFS(vfs.FromFS(files)),
+			WithFileSizeThreshold(1_024), WithCache(store), WithMetrics(m)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), result.DuplicateTotalCount)
+		return m
+	}
+	m := scan()
+	assert.Equal(t, int64(2), m.CacheMisses.Value())
+	assert.Equal(t, int64(0), m.FilesKnownUnique.Value())
+	m = scan()
+	assert.Equal(t, int64(0), m.CacheHits.Value()+m.CacheMisses.Value())
+	assert.Equal(t, int64(2), m.FilesKnownUnique.Value())
+	files["a/3.txt"] = &fstest.MapFile{Data: bytes.Repeat([]byte("3rd "), 5_000)}
+	m = scan()
+	assert.Equal(t, int64(2), m.CacheHits.Value())
+	assert.Equal(t, int64(0), m.FilesKnownUnique.Value())
+}
@@ -0,0 +1,471 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"math"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/blake3"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"golang.org/x/sys/cpu"
+)
+
+// Hasher computes hash of a file's contents
+type Hasher interface {
+	// Name is a short name that uniquely identifies the hashing algorithm
+	Name() string
+	// HashFile computes the hash of the regular file at path in fsys, whose metadata is info. It's not called for
+	// files whose checksums by the algorithm are known to fsys (see vfs.Checksummer).
+	HashFile(ctx context.Context, fsys vfs.FS, path string, info fs.FileInfo) (string, error)
+}
+
+// Built-in Hasher implementations, by name
+var Hashers = map[string]Hasher{
+	SampledHasher{}.Name():       SampledHasher{},
+	SampledCRC32CHasher{}.Name(): SampledCRC32CHasher{},
+	CRC32Hasher{}.Name():         CRC32Hasher{},
+	SHA256Hasher{}.Name():        SHA256Hasher{},
+	BLAKE3Hasher{}.Name():        BLAKE3Hasher{},
+	MD5Hasher{}.Name():           MD5Hasher{},
+	S3ETagHasher{}.Name():        S3ETagHasher{},
+	CRC32CHasher{}.Name():        CRC32CHasher{},
+	DropboxHasher{}.Name():       DropboxHasher{},
+	QuickXorHasher{}.Name():      QuickXorHasher{},
+}
+
+// DefaultHasher is the hasher used when none is specified: SampledCRC32CHasher if it's faster than SampledHasher on
+// this machine (see castagnoliFaster), and SampledHasher otherwise
+var DefaultHasher = defaultHasher()
+
+func defaultHasher() Hasher {
+	if castagnoliFaster() {
+		return SampledCRC32CHasher{}
+	}
+	return SampledHasher{}
+}
+
+// castagnoliFaster checks whether CRC32C of crucial bytes is computed faster than CRC32 on this machine, by timing
+// both (which takes well under a millisecond). CRC32C is faster where the CPU computes it by instructions of its own
+// (SSE 4.2 on amd64, and CRC32 on arm64), unless CRC32 is computed by wide carry-less multiplication (as by AVX-512 on
+// recent amd64 CPUs). It must be faster by a fifth, so that machines where both are about as fast keep hashes by CRC32
+// (such as those in caches of earlier scans), rather than flip between them from run to run.
+func castagnoliFaster() bool {
+	if !castagnoliAccelerated() {
+		return false
+	}
+	buf := make([]byte, thresholdFileSize)
+	return 5*timeChecksum(buf, castagnoliTable) < 4*timeChecksum(buf, crc32.IEEETable)
+}
+
+// castagnoliAccelerated checks whether CRC32C is computed by instructions of the CPU, which hash/crc32 uses if
+// they're there
+func castagnoliAccelerated() bool {
+	switch runtime.GOARCH {
+	case "amd64":
+		return cpu.X86.HasSSE42
+	case "arm64":
+		return cpu.ARM64.HasCRC32
+	default:
+		return false
+	}
+}
+
+// timeChecksum is the least time, of a few trials, taken to compute checksums of buf by the table a few times
+func timeChecksum(buf []byte, table *crc32.Table) time.Duration {
+	least := time.Duration(math.MaxInt64)
+	for range 5 {
+		start := time.Now()
+		for range 8 {
+			crc32.Checksum(buf, table)
+		}
+		least = min(least, time.Since(start))
+	}
+	return least
+}
+
+// castagnoliTable is the table of CRC32C
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// IsSampled checks whether the named hasher hashes crucial bytes of files only, rather than entire file contents (and
+// so can't verify duplicates)
+func IsSampled(name string) bool {
+	return name == SampledHasher{}.Name() || name == SampledCRC32CHasher{}.Name()
+}
+
+// HasherByName returns the built-in Hasher with the given name
+func HasherByName(name string) (Hasher, error) {
+	hasher, exists := Hashers[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown hashing algorithm %q", name)
+	}
+	return hasher, nil
+}
+
+// HasherNames returns names of built-in hashers, sorted
+func HasherNames() []string {
+	names := make([]string, 0, len(Hashers))
+	for name := range Hashers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SampledHasher uses CRC32 of "crucial bytes" of the file, which is very fast even for huge files.
+// Files that are small enough are hashed entirely.
+type SampledHasher struct{}
+
+// Name returns "sampled"
+func (SampledHasher) Name() string {
+	return "sampled"
+}
+
+// HashFile computes CRC32 of the file's crucial bytes
+func (SampledHasher) HashFile(_ context.Context, fsys vfs.FS, path string, info fs.FileInfo) (string, error) {
+	return hashCrucialBytes(fsys, path, info, crc32.IEEETable)
+}
+
+// SampledCRC32CHasher is like SampledHasher, but uses CRC32 (Castagnoli polynomial), which is faster on many CPUs
+// that compute it by instructions of their own (see DefaultHasher)
+type SampledCRC32CHasher struct{}
+
+// Name returns "sampled-crc32c"
+func (SampledCRC32CHasher) Name() string {
+	return "sampled-crc32c"
+}
+
+// HashFile computes CRC32C of the file's crucial bytes
+func (SampledCRC32CHasher) HashFile(_ context.Context, fsys vfs.FS, path string, info fs.FileInfo) (string, error) {
+	return hashCrucialBytes(fsys, path, info, castagnoliTable)
+}
+
+// hashCrucialBytes computes CRC32 by the table of crucial bytes of the file (or of all of it, if it's small enough).
+// Hashes are prefixed by how the file was read: "f" if entirely, "s" if by crucial bytes of thresholdFileSize, and "a"
+// if by more of them, as sampleSize sets for large files.
+func hashCrucialBytes(fsys vfs.FS, path string, info fs.FileInfo, table *crc32.Table) (string, error) {
+	buf := sampleBuffers.Get().(*[]byte)
+	defer sampleBuffers.Put(buf)
+	var prefix string
+	var bytes []byte
+	var fileReadErr error
+	if size := sampleSize(info.Size()); info.Size() <= thresholdFileSize {
+		prefix = "f"
+		bytes, fileReadErr = readSmallFile(fsys, path, *buf)
+	} else if size == thresholdFileSize {
+		prefix = "s"
+		bytes, fileReadErr = *buf, readCrucialBytes(fsys, path, info.Size(), *buf)
+	} else {
+		large := largeSampleBuffers.Get().(*[]byte)
+		defer largeSampleBuffers.Put(large)
+		prefix = "a"
+		bytes = (*large)[:size]
+		fileReadErr = readCrucialBytes(fsys, path, info.Size(), bytes)
+	}
+	if fileReadErr != nil {
+		return "", fmt.Errorf("couldn't calculate hash: %w", fileReadErr)
+	}
+	return prefix + hex.EncodeToString(binary.BigEndian.AppendUint32(nil, crc32.Checksum(bytes, table))), nil
+}
+
+// CRC32Hasher uses CRC32 of entire file contents
+type CRC32Hasher struct{}
+
+// Name returns "crc32"
+func (CRC32Hasher) Name() string {
+	return "crc32"
+}
+
+// HashFile computes CRC32 of the entire file
+func (CRC32Hasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, crc32.NewIEEE())
+}
+
+// CRC32CHasher uses CRC32 (Castagnoli polynomial) of entire file contents, which is what Google Cloud Storage keeps
+// in metadata of objects
+type CRC32CHasher struct{}
+
+// Name returns "crc32c"
+func (CRC32CHasher) Name() string {
+	return "crc32c"
+}
+
+// HashFile computes CRC32C of the entire file
+func (CRC32CHasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, crc32.New(castagnoliTable))
+}
+
+// SHA256Hasher uses SHA-256 of entire file contents
+type SHA256Hasher struct{}
+
+// Name returns "sha256"
+func (SHA256Hasher) Name() string {
+	return "sha256"
+}
+
+// HashFile computes SHA-256 of the entire file
+func (SHA256Hasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, sha256.New())
+}
+
+// BLAKE3Hasher uses BLAKE3 of entire file contents
+type BLAKE3Hasher struct{}
+
+// Name returns "blake3"
+func (BLAKE3Hasher) Name() string {
+	return "blake3"
+}
+
+// HashFile computes BLAKE3 of the entire file
+func (BLAKE3Hasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, blake3.New())
+}
+
+// MD5Hasher uses MD5 of entire file contents. It isn't collision-resistant, but it's what many cloud storage
+// services keep in metadata of files, and so files there needn't be read.
+type MD5Hasher struct{}
+
+// Name returns "md5"
+func (MD5Hasher) Name() string {
+	return "md5"
+}
+
+// HashFile computes MD5 of the entire file
+func (MD5Hasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, md5.New())
+}
+
+// DefaultS3PartSize is the part size of multipart uploads of common S3 clients (such as AWS CLI)
+const DefaultS3PartSize = 8 * bytesutil.MEBI
+
+// S3ETagHasher computes the ETag that Amazon S3 (or compatible storage) has for an object with the file's contents:
+// MD5 for files smaller than PartSize, and MD5 of MD5s of parts followed by number of parts for larger ones (as
+// uploaded in multiple parts). Objects in S3 aren't read, since their ETags are known. Objects uploaded in parts of
+// a size other than PartSize have different ETags, and so aren't found to be duplicates of files with same
+// contents.
+type S3ETagHasher struct {
+	// PartSize is the size of parts of multipart uploads (defaults to DefaultS3PartSize)
+	PartSize int64
+}
+
+// Name returns "s3etag"
+func (S3ETagHasher) Name() string {
+	return "s3etag"
+}
+
+// HashFile computes S3 ETag of the entire file
+func (h S3ETagHasher) HashFile(ctx context.Context, fsys vfs.FS, path string, info fs.FileInfo) (string, error) {
+	partSize := h.PartSize
+	if partSize <= 0 {
+		partSize = DefaultS3PartSize
+	}
+	if info.Size() < partSize {
+		return streamHash(ctx, fsys, path, md5.New())
+	}
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("couldn't calculate hash: %w", err)
+	}
+	defer file.Close()
+	r := &contextReader{ctx: ctx, r: file}
+	md5s := md5.New()
+	parts := 0
+	for {
+		part := md5.New()
+		n, err := io.CopyN(part, r, partSize)
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("error while computing hash: %w", err)
+		}
+		if n == 0 && parts > 0 {
+			break
+		}
+		md5s.Write(part.Sum(nil))
+		parts++
+		if n < partSize {
+			break
+		}
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(md5s.Sum(nil)), parts), nil
+}
+
+// dropboxBlockSize is the size of blocks of Dropbox content hashes
+const dropboxBlockSize = 4 * bytesutil.MEBI
+
+// DropboxHasher computes the content hash that Dropbox has for a file with the file's contents: SHA-256 of
+// SHA-256s of 4 MiB blocks of the file. Files in Dropbox aren't read, since their content hashes are known.
+//
+// See: https://www.dropbox.com/developers/reference/content-hash
+type DropboxHasher struct{}
+
+// Name returns "dropbox"
+func (DropboxHasher) Name() string {
+	return "dropbox"
+}
+
+// HashFile computes the Dropbox content hash of the entire file
+func (DropboxHasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, &dropboxContentHash{block: sha256.New()})
+}
+
+// dropboxContentHash is the hash.Hash of DropboxHasher
+type dropboxContentHash struct {
+	// blockSums are SHA-256s of complete blocks, concatenated
+	blockSums []byte
+	block     hash.Hash
+	// n is the number of bytes written to block
+	n int64
+}
+
+func (d *dropboxContentHash) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		chunk := min(int64(len(p)), dropboxBlockSize-d.n)
+		d.block.Write(p[:chunk])
+		d.n += chunk
+		p = p[chunk:]
+		if d.n == dropboxBlockSize {
+			d.blockSums = d.block.Sum(d.blockSums)
+			d.block.Reset()
+			d.n = 0
+		}
+	}
+	return written, nil
+}
+
+func (d *dropboxContentHash) Sum(b []byte) []byte {
+	blockSums := d.blockSums
+	if d.n > 0 {
+		blockSums = d.block.Sum(append([]byte(nil), blockSums...))
+	}
+	sum := sha256.Sum256(blockSums)
+	return append(b, sum[:]...)
+}
+
+func (d *dropboxContentHash) Reset() {
+	d.blockSums, d.n = d.blockSums[:0], 0
+	d.block.Reset()
+}
+
+func (d *dropboxContentHash) Size() int {
+	return sha256.Size
+}
+
+func (d *dropboxContentHash) BlockSize() int {
+	return sha256.BlockSize
+}
+
+// QuickXorHasher computes QuickXorHash, which OneDrive and SharePoint have for files: bytes of the file are XORed
+// into a 160-bit register, each one 11 bits further than the previous one (wrapping around), and the size of the
+// file is XORed into the last 64 bits. Files in OneDrive aren't read, since their hashes are known. Hashes are in
+// hex, rather than base64 as in OneDrive.
+//
+// See: https://learn.microsoft.com/en-us/onedrive/developer/code-snippets/quickxorhash
+type QuickXorHasher struct{}
+
+// Name returns "quickxor"
+func (QuickXorHasher) Name() string {
+	return "quickxor"
+}
+
+// HashFile computes QuickXorHash of the entire file
+func (QuickXorHasher) HashFile(ctx context.Context, fsys vfs.FS, path string, _ fs.FileInfo) (string, error) {
+	return streamHash(ctx, fsys, path, &quickXorHash{})
+}
+
+// Parameters of QuickXorHash
+const (
+	quickXorWidth = 160
+	quickXorShift = 11
+)
+
+// quickXorHash is the hash.Hash of QuickXorHasher. The register is in three cells, of which the last one has only
+// 32 bits (bits above them are ignored).
+type quickXorHash struct {
+	cells [3]uint64
+	// shift is the offset of the bit that the next byte is XORed at
+	shift  int
+	length uint64
+}
+
+func (q *quickXorHash) Write(p []byte) (int, error) {
+	for _, b := range p {
+		cell, offset := q.shift/64, q.shift%64
+		cellBits := 64
+		if cell == len(q.cells)-1 {
+			cellBits = quickXorWidth % 64
+		}
+		q.cells[cell] ^= uint64(b) << offset
+		if offset > cellBits-8 {
+			q.cells[(cell+1)%len(q.cells)] ^= uint64(b) >> (cellBits - offset)
+		}
+		q.shift = (q.shift + quickXorShift) % quickXorWidth
+	}
+	q.length += uint64(len(p))
+	return len(p), nil
+}
+
+func (q *quickXorHash) Sum(b []byte) []byte {
+	sum := make([]byte, 24)
+	for i, cell := range q.cells {
+		binary.LittleEndian.PutUint64(sum[i*8:], cell)
+	}
+	sum = sum[:quickXorWidth/8]
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], q.length)
+	for i, l := range length {
+		sum[len(sum)-len(length)+i] ^= l
+	}
+	return append(b, sum...)
+}
+
+func (q *quickXorHash) Reset() {
+	*q = quickXorHash{}
+}
+
+func (q *quickXorHash) Size() int {
+	return quickXorWidth / 8
+}
+
+func (q *quickXorHash) BlockSize() int {
+	return 64
+}
+
+// streamHash computes hash of the entire file, streaming its contents so that a large file doesn't need to fit
+// in memory and the computation can be abandoned as soon as ctx is cancelled
+func streamHash(ctx context.Context, fsys vfs.FS, path string, h hash.Hash) (string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("couldn't calculate hash: %w", err)
+	}
+	defer file.Close()
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	if _, err := io.CopyBuffer(h, &contextReader{ctx: ctx, r: file}, *buf); err != nil {
+		return "", fmt.Errorf("error while computing hash: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contextReader is an io.Reader that stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// linkFollower decides which links found while scanning are followed (see Options.FollowSymlinks), so that no
+// file is found twice (through a link, and directly or through another link), and links to directories that
+// contain them don't loop. Real paths are normalized (see utils.NormalizeName), so that paths of the same file
+// through volumes that compose names differently are the same.
+type linkFollower struct {
+	// dirs are real paths of directories walked: those scanned, and those that links found lead to
+	dirs []string
+	// files are real paths of files that links found lead to
+	files map[string]bool
+}
+
+// newLinkFollower creates a linkFollower for a scan of directories
+func newLinkFollower(fsys vfs.FS, directories []string) *linkFollower {
+	l := &linkFollower{files: map[string]bool{}}
+	for _, dir := range directories {
+		if realPath, ok := vfs.ResolveLinks(fsys, dir); ok {
+			l.dirs = append(l.dirs, utils.NormalizeName(realPath))
+		}
+	}
+	return l
+}
+
+// isWalked checks whether the file or directory at realPath is in (or is) a directory walked
+func (l *linkFollower) isWalked(realPath string) bool {
+	for _, dir := range l.dirs {
+		if realPath == dir || vfs.IsIn(dir, realPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// followDir checks whether the directory that a link leads to (at realPath) is to be walked, recording it as
+// walked if it is
+func (l *linkFollower) followDir(realPath string) bool {
+	realPath = utils.NormalizeName(realPath)
+	if l.isWalked(realPath) {
+		return false
+	}
+	l.dirs = append(l.dirs, realPath)
+	return true
+}
+
+// followFile checks whether the file that a link leads to (at realPath) is to be considered, recording it if
+// it is
+func (l *linkFollower) followFile(realPath string) bool {
+	realPath = utils.NormalizeName(realPath)
+	if l.files[realPath] || l.isWalked(realPath) {
+		return false
+	}
+	l.files[realPath] = true
+	return true
+}
+
+// distinctDirectories returns directories of opts without those that are in (or are) others of them, by their real
+// paths (as normalized), logging those left out. Files of overlapping directories would otherwise be walked twice, and
+// be found as duplicates of themselves through a link to a directory scanned anyway.
+func distinctDirectories(opts Options) []string {
+	realPaths := make([]string, len(opts.Directories))
+	for i, dir := range opts.Directories {
+		realPaths[i] = utils.NormalizeName(dir)
+		if realPath, resolved := vfs.ResolveLinks(opts.FS, dir); resolved {
+			realPaths[i] = utils.NormalizeName(realPath)
+		}
+	}
+	distinct := make([]string, 0, len(opts.Directories))
+	for i, dir := range opts.Directories {
+		// Directories are of the outermost ones, and of the first of those that are the same
+		j := slices.IndexFunc(realPaths, func(other string) bool { return vfs.IsIn(other, realPaths[i]) })
+		if j >= 0 {
+			opts.Logger.Printf("Skipping %s, which is in %s, scanned anyway\n", dir, opts.Directories[j])
+			continue
+		}
+		if j = slices.Index(realPaths, realPaths[i]); j < i {
+			opts.Logger.Printf("Skipping %s, which is %s, scanned anyway\n", dir, opts.Directories[j])
+			continue
+		}
+		distinct = append(distinct, dir)
+	}
+	return distinct
+}
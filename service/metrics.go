@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/pkg/metrics"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// ScanMetrics are counters and histograms of scans. Multiple scans can share the same ScanMetrics, in which case
+// the values accumulate across scans.
+type ScanMetrics struct {
+	FilesWalked *metrics.Counter
+	FilesHashed *metrics.Counter
+	BytesHashed *metrics.Counter
+	HashErrors  *metrics.Counter
+	HashLatency *metrics.Histogram
+	CacheHits   *metrics.Counter
+	CacheMisses *metrics.Counter
+	GroupsFound *metrics.Counter
+
+	// FilesOfUniqueSize are files that weren't hashed, since no other file has the same extension and size
+	FilesOfUniqueSize *metrics.Counter
+	// FilesResolvedEarly are potential duplicates that verification told apart from others without hashing them
+	// entirely, or that were left without others by files that couldn't be hashed
+	FilesResolvedEarly *metrics.Counter
+	// FilesKnownUnique are potential duplicates that weren't hashed, since an earlier scan told them apart from all
+	// others of the same extension and size, and none of those have changed since (as the cache says)
+	FilesKnownUnique *metrics.Counter
+	// FilesChanged are potential duplicates left out of groups, since they changed while they were being hashed
+	FilesChanged *metrics.Counter
+	// FilesVanished are potential duplicates skipped, since they were deleted between walking and hashing
+	FilesVanished *metrics.Counter
+	// ScanDuration, DuplicatesFound and ReclaimableBytes are updated once a scan completes
+	ScanDuration    *metrics.Histogram
+	DuplicatesFound *metrics.Counter
+	// ReclaimableBytes is the space that removing duplicates found by the latest scan would save
+	ReclaimableBytes *metrics.Gauge
+}
+
+// hashLatencyBounds are upper bounds, in seconds, of buckets of hash latency
+var hashLatencyBounds = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60}
+
+// scanDurationBounds are upper bounds, in seconds, of buckets of durations of scans
+var scanDurationBounds = []float64{1, 10, 30, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600}
+
+// NewScanMetrics creates ScanMetrics registered in registry (which may be nil, if they needn't be exposed)
+func NewScanMetrics(registry *metrics.Registry) *ScanMetrics {
+	return &ScanMetrics{
+		FilesWalked: registry.NewCounter("finddup_files_walked_total",
+			"Number of files considered while walking through directories"),
+		FilesHashed: registry.NewCounter("finddup_files_hashed_total", "Number of files hashed"),
+		BytesHashed: registry.NewCounter("finddup_bytes_hashed_total", "Total size of files hashed, in bytes"),
+		HashErrors:  registry.NewCounter("finddup_hash_errors_total", "Number of files that couldn't be hashed"),
+		HashLatency: registry.NewHistogram("finddup_hash_duration_seconds", "Time taken to hash a file",
+			hashLatencyBounds),
+		CacheHits: registry.NewCounter("finddup_cache_hits_total",
+			"Number of hashes found in the cache and still valid"),
+		CacheMisses: registry.NewCounter("finddup_cache_misses_total",
+			"Number of hashes not found in the cache, or found stale"),
+		GroupsFound: registry.NewCounter("finddup_groups_found_total", "Number of groups of duplicates found"),
+		FilesOfUniqueSize: registry.NewCounter("finddup_files_unique_size_total",
+			"Number of files not hashed, since no other file has the same extension and size"),
+		FilesResolvedEarly: registry.NewCounter("finddup_files_resolved_early_total",
+			"Number of potential duplicates told apart from others by verification (or left without others by files "+
+				"that couldn't be hashed), without hashing them entirely"),
+		FilesKnownUnique: registry.NewCounter("finddup_files_known_unique_total",
+			"Number of potential duplicates not hashed, since an earlier scan told them apart from all others of the "+
+				"same extension and size"),
+		FilesChanged: registry.NewCounter("finddup_files_changed_total",
+			"Number of potential duplicates left out of groups, since they changed while they were being hashed"),
+		FilesVanished: registry.NewCounter("finddup_files_vanished_total",
+			"Number of potential duplicates skipped, since they were deleted between walking and hashing"),
+		ScanDuration: registry.NewHistogram("finddup_scan_duration_seconds", "Time taken by a scan to complete",
+			scanDurationBounds),
+		DuplicatesFound: registry.NewCounter("finddup_duplicates_found_total",
+			"Number of duplicates found (all files of groups except one each)"),
+		ReclaimableBytes: registry.NewGauge("finddup_reclaimable_bytes",
+			"Space that removing duplicates found by the latest scan would save, in bytes"),
+	}
+}
+
+// observeScan records a scan that completed
+func (m *ScanMetrics) observeScan(duration time.Duration, result Result) {
+	m.ScanDuration.Observe(duration.Seconds())
+	m.DuplicatesFound.Add(result.DuplicateTotalCount)
+	m.ReclaimableBytes.Set(result.SavingsSize)
+}
+
+// CacheHitRatio is the fraction of lookups of the cache that found valid hashes (0 if there were no lookups)
+func (m *ScanMetrics) CacheHitRatio() float64 {
+	hits, misses := m.CacheHits.Value(), m.CacheMisses.Value()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// meteredHasher is a Hasher that records hashing in ScanMetrics
+type meteredHasher struct {
+	Hasher
+	metrics *ScanMetrics
+}
+
+func (m meteredHasher) HashFile(ctx context.Context, fsys vfs.FS, path string, info fs.FileInfo) (string, error) {
+	start := time.Now()
+	hash, err := m.Hasher.HashFile(ctx, fsys, path, info)
+	if err != nil {
+		// Files that vanished are counted as such (see FilesVanished), rather than as errors
+		if !errors.Is(err, fs.ErrNotExist) {
+			m.metrics.HashErrors.Add(1)
+		}
+		return hash, err
+	}
+	m.metrics.HashLatency.Observe(time.Since(start).Seconds())
+	m.metrics.FilesHashed.Add(1)
+	m.metrics.BytesHashed.Add(info.Size())
+	return hash, nil
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"runtime"
+	"strings"
+
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/m-manu/go-find-duplicates/bytesutil"
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/utils"
+	"github.com/m-manu/go-find-duplicates/pkg/digestcache"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// DefaultFileSizeThreshold is the default minimum size of files considered for finding duplicates
+const DefaultFileSizeThreshold = 4 * bytesutil.KIBI
+
+// DefaultWalkWorkers is the default number of directories read at once while walking
+const DefaultWalkWorkers = 8
+
+// Options are the criteria for finding duplicates. Use NewOptions to create Options with sensible defaults.
+// Zero values of fields of Options are replaced by defaults.
+type Options struct {
+	// FS is the file system the directories are on (defaults to the local file system)
+	FS vfs.FS
+	// Directories to be scanned for duplicates
+	Directories []string
+	// ExcludedFiles are names of files and directories to be ignored while scanning, or glob patterns of names
+	// (as of path.Match, e.g. *.tmp)
+	ExcludedFiles set.Set[string]
+	// FileSizeThreshold is the minimum size of files to consider
+	FileSizeThreshold int64
+	// Parallelism is the number of files hashed concurrently (defaults to number of cores minus 1)
+	Parallelism int
+	// IOWorkers, if set, is the number of files read concurrently, independently of Parallelism: fewer for disks
+	// that are slow to seek, more for network storage that's slow to respond (defaults to reading every file that's
+	// hashed as soon as it's hashed)
+	IOWorkers int
+	// IOWorkersByDevice, if set (and IOWorkers isn't), decides how many files are read concurrently from the device
+	// that a directory of Directories is on (such as 2 for a hard disk drive, but many more for an NVMe drive). It
+	// returns an ID of the device, so that directories on the same device share its reads, and the number of files
+	// read from it at a time (0 if reading its files isn't to be limited).
+	IOWorkersByDevice func(dir string) (device string, workers int)
+	// WalkWorkers is the number of directories read at once while walking (defaults to DefaultWalkWorkers)
+	WalkWorkers int
+	// Hasher hashes contents of potential duplicates (defaults to DefaultHasher)
+	Hasher Hasher
+	// Verifier, if set, verifies every group of duplicates found by upgrading digests of its files with strong hashes
+	// (see entity.FileDigest.Upgrade), so that files whose fast hashes collide aren't reported as duplicates
+	Verifier Hasher
+	// Listener is notified of progress of the scan
+	Listener ProgressListener
+	// Cache, if set, is used to reuse hashes of files that haven't changed since an earlier scan
+	Cache digestcache.Store
+	// FileFilters decide which files and directories found while scanning are considered
+	FileFilters []FileFilter
+	// GroupFilters decide which groups of duplicates are reported
+	GroupFilters []GroupFilter
+	// Metrics, if set, are updated as the scan progresses (defaults to ScanMetrics that aren't exposed)
+	Metrics *ScanMetrics
+	// Logger is where messages about progress and errors of the scan go (defaults to fmte.Global)
+	Logger fmte.Logger
+	// HashAllFiles, if set, hashes all files rather than only potential duplicates, so that Result.Digests has
+	// digests of all files (e.g. to export them as an entity.DigestIndex)
+	HashAllFiles bool
+	// ExternalDigests, if set, are digests of files elsewhere (e.g. exported on another host). Files with same
+	// digests as any of them are reported in Result.ExternalMatches. They must be by the algorithm of Hasher.
+	// Digests with entity.UnknownFileSize (e.g. of checksum manifests) match files by their hashes alone.
+	ExternalDigests *entity.DigestIndex
+	// FollowSymlinks, if set, follows symbolic links (and junctions and other reparse points, such as those of
+	// OneDrive, on Windows) found while scanning, which are skipped otherwise. Files that links lead to are found once,
+	// and not at all if they're in directories scanned anyway.
+	FollowSymlinks bool
+	// ReportSymlinks, if set (and FollowSymlinks isn't), logs every link skipped while scanning, rather than only
+	// counting them (see Result.SkippedLinks)
+	ReportSymlinks bool
+	// SpillAfter, if set, is the most files whose paths and metadata are kept in memory while scanning: files found
+	// beyond it are moved to a temporary database on disk, so that scans of very many files need less memory. Once
+	// files are spilled, Result.AllFiles has only those that may have duplicates, and they're grouped (and hashed) by
+	// shards of about SpillAfter files each, by their sizes, of which a few are in memory at a time.
+	SpillAfter int
+	// MaxOpenFiles is the most files (and directories being read) of FS that are open at once, so that scans of
+	// high Parallelism and WalkWorkers don't fail by "too many open files" (defaults to vfs.DefaultOpenFilesLimit,
+	// which is by RLIMIT_NOFILE where there's one, and unlimited if there isn't)
+	MaxOpenFiles int
+
+	// excludedPatterns are those of ExcludedFiles that are glob patterns
+	excludedPatterns []string
+	// walked are files found while walking, whose metadata is used while hashing rather than statting them again
+	walked entity.FilePathToMeta
+	// keepUnique decides whether files of an extension and size are hashed even if none of them can have duplicates
+	// (such as when Result.Digests are to have digests of all files)
+	keepUnique func(entity.FileExtAndSize) bool
+}
+
+// Option customizes Options
+type Option func(*Options)
+
+// NewOptions creates Options to find duplicates in given directories, customized by opts
+func NewOptions(directories []string, opts ...Option) Options {
+	o := Options{
+		Directories:       directories,
+		FileSizeThreshold: DefaultFileSizeThreshold,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.withDefaults()
+}
+
+// WithFS sets the file system the directories are on
+func WithFS(fsys vfs.FS) Option {
+	return func(o *Options) { o.FS = fsys }
+}
+
+// WithExcludedFiles sets names of files and directories to be ignored while scanning
+func WithExcludedFiles(excludedFiles set.Set[string]) Option {
+	return func(o *Options) { o.ExcludedFiles = excludedFiles }
+}
+
+// WithFileSizeThreshold sets the minimum size of files to consider
+func WithFileSizeThreshold(fileSizeThreshold int64) Option {
+	return func(o *Options) { o.FileSizeThreshold = fileSizeThreshold }
+}
+
+// WithParallelism sets the number of files hashed concurrently
+func WithParallelism(parallelism int) Option {
+	return func(o *Options) { o.Parallelism = parallelism }
+}
+
+// WithIOWorkers sets the number of files read concurrently
+func WithIOWorkers(ioWorkers int) Option {
+	return func(o *Options) { o.IOWorkers = ioWorkers }
+}
+
+// WithIOWorkersByDevice sets how many files are read concurrently from the device that a directory is on
+func WithIOWorkersByDevice(ioWorkersByDevice func(dir string) (device string, workers int)) Option {
+	return func(o *Options) { o.IOWorkersByDevice = ioWorkersByDevice }
+}
+
+// WithWalkWorkers sets the number of directories read at once while walking
+func WithWalkWorkers(walkWorkers int) Option {
+	return func(o *Options) { o.WalkWorkers = walkWorkers }
+}
+
+// WithHasher sets the Hasher for contents of potential duplicates
+func WithHasher(hasher Hasher) Option {
+	return func(o *Options) { o.Hasher = hasher }
+}
+
+// WithVerifier sets the Hasher that verifies groups of duplicates found
+func WithVerifier(verifier Hasher) Option {
+	return func(o *Options) { o.Verifier = verifier }
+}
+
+// WithListener sets the listener to be notified of progress of the scan
+func WithListener(listener ProgressListener) Option {
+	return func(o *Options) { o.Listener = listener }
+}
+
+// WithCache sets the store in which hashes are cached across scans
+func WithCache(cache digestcache.Store) Option {
+	return func(o *Options) { o.Cache = cache }
+}
+
+// WithMetrics sets the metrics updated as the scan progresses
+func WithMetrics(m *ScanMetrics) Option {
+	return func(o *Options) { o.Metrics = m }
+}
+
+// WithLogger sets where messages about progress and errors of the scan go
+func WithLogger(logger fmte.Logger) Option {
+	return func(o *Options) { o.Logger = logger }
+}
+
+// WithHashAllFiles sets whether all files are hashed, rather than only potential duplicates
+func WithHashAllFiles(hashAllFiles bool) Option {
+	return func(o *Options) { o.HashAllFiles = hashAllFiles }
+}
+
+// WithExternalDigests sets digests of files elsewhere, which files of the scan are matched with
+func WithExternalDigests(index *entity.DigestIndex) Option {
+	return func(o *Options) { o.ExternalDigests = index }
+}
+
+// WithFollowSymlinks sets whether links found while scanning are followed
+func WithFollowSymlinks(followSymlinks bool) Option {
+	return func(o *Options) { o.FollowSymlinks = followSymlinks }
+}
+
+// WithReportSymlinks sets whether links skipped while scanning are logged
+func WithReportSymlinks(reportSymlinks bool) Option {
+	return func(o *Options) { o.ReportSymlinks = reportSymlinks }
+}
+
+// WithSpillAfter sets the most files kept in memory while scanning, beyond which they're spilled to disk
+func WithSpillAfter(spillAfter int) Option {
+	return func(o *Options) { o.SpillAfter = spillAfter }
+}
+
+// WithMaxOpenFiles sets the most files of the file system that are open at once
+func WithMaxOpenFiles(maxOpenFiles int) Option {
+	return func(o *Options) { o.MaxOpenFiles = maxOpenFiles }
+}
+
+// DefaultParallelism is number of cores minus 1, so that the machine remains responsive during a scan. Cores are
+// those that Go code may run on at once (as per runtime.GOMAXPROCS), which may be fewer than those of the machine.
+func DefaultParallelism() int {
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		return n - 1
+	}
+	return 1
+}
+
+func (o Options) withDefaults() Options {
+	if o.FS == nil {
+		o.FS = vfs.Local
+	}
+	// Names are normalized, so that names excluded match those of files however either is composed
+	excluded := set.NewThreadUnsafeSet[string]()
+	if o.ExcludedFiles != nil {
+		for name := range o.ExcludedFiles.Iter() {
+			excluded.Add(utils.NormalizeName(name))
+		}
+	}
+	o.ExcludedFiles = excluded
+	o.excludedPatterns = nil
+	for name := range o.ExcludedFiles.Iter() {
+		if strings.ContainsAny(name, `*?[\`) {
+			o.excludedPatterns = append(o.excludedPatterns, name)
+		}
+	}
+	if o.Parallelism <= 0 {
+		o.Parallelism = DefaultParallelism()
+	}
+	if o.WalkWorkers <= 0 {
+		o.WalkWorkers = DefaultWalkWorkers
+	}
+	if o.MaxOpenFiles <= 0 {
+		o.MaxOpenFiles = vfs.DefaultOpenFilesLimit()
+	}
+	if o.Hasher == nil {
+		o.Hasher = DefaultHasher
+	}
+	if o.Listener == nil {
+		o.Listener = NoOpProgressListener{}
+	}
+	if o.Metrics == nil {
+		o.Metrics = NewScanMetrics(nil)
+	}
+	if o.Logger == nil {
+		o.Logger = fmte.Global
+	}
+	return o
+}
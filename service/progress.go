@@ -0,0 +1,32 @@
+package service
+
+import "github.com/m-manu/go-find-duplicates/entity"
+
+// ProgressListener receives real-time notifications of a scan's progress.
+// Methods may be called concurrently from multiple goroutines, so implementations must be goroutine-safe.
+type ProgressListener interface {
+	// OnFileDiscovered is called for every file found while scanning directories
+	OnFileDiscovered(path string, meta entity.FileMeta)
+	// OnFileHashed is called once digest of a potential duplicate is computed
+	OnFileHashed(path string, digest entity.FileDigest)
+	// OnGroupFound is called once a group of duplicates is confirmed
+	OnGroupFound(digest entity.FileDigest, paths []string)
+	// OnError is called for a file that had to be skipped because of an error, which is a *FileError
+	OnError(path string, err error)
+}
+
+// NoOpProgressListener is a ProgressListener that ignores all notifications.
+// Embed it to implement only the methods you are interested in.
+type NoOpProgressListener struct{}
+
+// OnFileDiscovered does nothing
+func (NoOpProgressListener) OnFileDiscovered(string, entity.FileMeta) {}
+
+// OnFileHashed does nothing
+func (NoOpProgressListener) OnFileHashed(string, entity.FileDigest) {}
+
+// OnGroupFound does nothing
+func (NoOpProgressListener) OnGroupFound(entity.FileDigest, []string) {}
+
+// OnError does nothing
+func (NoOpProgressListener) OnError(string, error) {}
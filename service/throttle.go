@@ -0,0 +1,208 @@
+package service
+
+import (
+	"io/fs"
+	"sync/atomic"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+// throttle limits how many workers read files at a time (from all devices, or from each device that directories
+// are on), and how many hash what they've read at a time. A worker is either reading, hashing or idle, and so never
+// waits for one while it holds the other.
+type throttle struct {
+	// reading are turns to read files of all devices, as limited by Options.IOWorkers (nil if unlimited)
+	reading chan struct{}
+	hashing chan struct{}
+	// devices are directories of the scan with turns to read from their devices (nil if unlimited)
+	devices []deviceTurns
+}
+
+type deviceTurns struct {
+	dir     string
+	reading chan struct{}
+}
+
+// newThrottle creates a throttle of the scan of opts, or returns nil if reading isn't to be limited
+func newThrottle(opts Options) *throttle {
+	t := &throttle{hashing: make(chan struct{}, opts.Parallelism)}
+	if opts.IOWorkers > 0 {
+		t.reading = make(chan struct{}, opts.IOWorkers)
+	} else if opts.IOWorkersByDevice != nil {
+		byDevice := map[string]chan struct{}{}
+		for _, dir := range opts.Directories {
+			device, workers := opts.IOWorkersByDevice(dir)
+			if byDevice[device] == nil && workers > 0 {
+				byDevice[device] = make(chan struct{}, workers)
+			}
+			// Directories whose devices aren't limited are kept too, in case they're in others that are
+			t.devices = append(t.devices, deviceTurns{dir: dir, reading: byDevice[device]})
+		}
+	}
+	for _, d := range t.devices {
+		if d.reading != nil {
+			return t
+		}
+	}
+	if t.reading == nil {
+		return nil
+	}
+	return t
+}
+
+// workQueue is a queue of groups of files to hash (each of files of the same extension and size), and the number of
+// workers that take from it
+type workQueue struct {
+	keys    []entity.FileExtAndSize
+	workers int
+	// next is the index in keys of the next group to be taken by any of the workers
+	next atomic.Int64
+}
+
+// take takes the next group from the queue, if there's any left
+func (q *workQueue) take() (entity.FileExtAndSize, bool) {
+	k := q.next.Add(1) - 1
+	if k >= int64(len(q.keys)) {
+		return entity.FileExtAndSize{}, false
+	}
+	return q.keys[k], true
+}
+
+// workQueues splits keys of the shortlist (keeping their order) into queues by the turns to read their files from,
+// so that every device whose reads are limited has a queue of its own, with as many workers as it has turns. That
+// way, workers waiting for turns of a slow device (such as a hard disk drive) don't keep files of faster ones (such
+// as an NVMe drive) waiting. A group of files is queued for the device of its first file. Files whose reads aren't
+// limited are queued together, with as many workers as parallelism.
+func (t *throttle) workQueues(parallelism int, keys []entity.FileExtAndSize, shortlist entity.FileExtAndSizeToFiles,
+) []*workQueue {
+	if t == nil {
+		return []*workQueue{{keys: keys, workers: parallelism}}
+	}
+	byTurns := map[chan struct{}]*workQueue{}
+	var queues []*workQueue
+	for _, key := range keys {
+		turns := t.turnsToRead(shortlist[key][0])
+		q := byTurns[turns]
+		if q == nil {
+			q = &workQueue{workers: parallelism}
+			if turns != nil {
+				q.workers = cap(turns)
+			}
+			byTurns[turns] = q
+			queues = append(queues, q)
+		}
+		q.keys = append(q.keys, key)
+	}
+	return queues
+}
+
+// turnsToRead returns turns to read the named file from, or nil if reading it isn't limited
+func (t *throttle) turnsToRead(name string) chan struct{} {
+	reading, deepest := t.reading, ""
+	for _, d := range t.devices {
+		// Of directories that are in others, the deepest one is the directory of name
+		if (name == d.dir || vfs.IsIn(d.dir, name)) && len(d.dir) > len(deepest) {
+			reading, deepest = d.reading, d.dir
+		}
+	}
+	return reading
+}
+
+// workerFS is the file system as a worker of a throttle sees it: reading (of files, and of their metadata) waits
+// for a turn to read, and whatever the worker does in between waits for a turn to hash. It's not safe for
+// concurrent use, so every worker has one of its own.
+type workerFS struct {
+	vfs.FS
+	t *throttle
+	// isHashing is whether the worker has a turn to hash
+	isHashing bool
+}
+
+// startReading waits for a turn to read the named file, returning the turns it's of (nil if reading it isn't
+// limited)
+func (w *workerFS) startReading(name string) chan struct{} {
+	w.idle()
+	reading := w.t.turnsToRead(name)
+	if reading != nil {
+		reading <- struct{}{}
+	}
+	return reading
+}
+
+func (w *workerFS) stopReading(reading chan struct{}) {
+	if reading != nil {
+		<-reading
+	}
+	w.t.hashing <- struct{}{}
+	w.isHashing = true
+}
+
+// idle gives up the turn to hash of the worker (if it's throttled at all, i.e. w isn't nil), once it's done with
+// files for a while
+func (w *workerFS) idle() {
+	if w != nil && w.isHashing {
+		<-w.t.hashing
+		w.isHashing = false
+	}
+}
+
+func (w *workerFS) Open(name string) (fs.File, error) {
+	defer w.stopReading(w.startReading(name))
+	f, err := w.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rf, isRandomAccess := vfs.RandomAccess(f); isRandomAccess {
+		return &workerRandomAccessFile{workerFile: workerFile{File: f, name: name, w: w}, ra: rf}, nil
+	}
+	return &workerFile{File: f, name: name, w: w}, nil
+}
+
+func (w *workerFS) Stat(name string) (fs.FileInfo, error) {
+	defer w.stopReading(w.startReading(name))
+	return w.FS.Stat(name)
+}
+
+func (w *workerFS) Lstat(name string) (fs.FileInfo, error) {
+	defer w.stopReading(w.startReading(name))
+	return w.FS.Lstat(name)
+}
+
+// Checksum returns checksums that the file system knows (see vfs.Checksummer)
+func (w *workerFS) Checksum(name, algorithm string) (string, bool) {
+	return vfs.Checksum(w.FS, name, algorithm)
+}
+
+// ID is that of the file system (see vfs.Identifier)
+func (w *workerFS) ID() string {
+	return vfs.ID(w.FS)
+}
+
+// workerFile is a file opened by a workerFS
+type workerFile struct {
+	fs.File
+	name string
+	w    *workerFS
+}
+
+func (f *workerFile) Read(p []byte) (int, error) {
+	defer f.w.stopReading(f.w.startReading(f.name))
+	return f.File.Read(p)
+}
+
+// workerRandomAccessFile is a file opened by a workerFS that supports random access
+type workerRandomAccessFile struct {
+	workerFile
+	ra vfs.File
+}
+
+func (f *workerRandomAccessFile) ReadAt(p []byte, off int64) (int, error) {
+	defer f.w.stopReading(f.w.startReading(f.name))
+	return f.ra.ReadAt(p, off)
+}
+
+func (f *workerRandomAccessFile) ReadAtBatch(bufs [][]byte, offsets []int64) error {
+	defer f.w.stopReading(f.w.startReading(f.name))
+	return vfs.ReadAtBatch(f.ra, bufs, offsets)
+}
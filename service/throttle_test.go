@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/entity"
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowFS is a file system whose reads of files are slow, and which records how many of them ran at most at a time
+type slowFS struct {
+	vfs.FS
+	reading, maxReading atomic.Int32
+}
+
+func (s *slowFS) Open(name string) (fs.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &slowFile{File: f, fsys: s}, nil
+}
+
+type slowFile struct {
+	fs.File
+	fsys *slowFS
+}
+
+func (f *slowFile) Read(p []byte) (int, error) {
+	reading := f.fsys.reading.Add(1)
+	defer f.fsys.reading.Add(-1)
+	for maxReading := f.fsys.maxReading.Load(); reading > maxReading; maxReading = f.fsys.maxReading.Load() {
+		f.fsys.maxReading.CompareAndSwap(maxReading, reading)
+	}
+	time.Sleep(time.Millisecond)
+	return f.File.Read(p)
+}
+
+// TestIOWorkers checks whether reads of files are limited to IOWorkers at a time, without changing what's found
+func TestIOWorkers(t *testing.T) {
+	files := fstest.MapFS{}
+	for i := range 32 {
+		content := bytes.Repeat([]byte{byte(i)}, 1_024+i)
+		files[fmt.Sprintf("a/%d.txt", i)] = &fstest.MapFile{Data: content}
+		files[fmt.Sprintf("b/%d.txt", i)] = &fstest.MapFile{Data: content}
+	}
+	fmte.Off()
+	find := func(opts ...Option) (Result, int32) {
+		fsys := &slowFS{FS: vfs.FromFS(files)}
+		result, err := FindDuplicates(context.Background(), NewOptions([]string{"a", "b"},
+			append(opts, WithFS(fsys), WithFileSizeThreshold(1_024), WithHasher(SHA256Hasher{}))...))
+		assert.Nil(t, err)
+		return result, fsys.maxReading.Load()
+	}
+	unthrottled, maxReading := find(WithParallelism(8))
+	assert.Equal(t, 32, unthrottled.Duplicates.Size())
+	assert.Greater(t, maxReading, int32(2))
+	for _, ioWorkers := range []int{1, 2, 16} {
+		result, maxReading := find(WithParallelism(8), WithIOWorkers(ioWorkers))
+		assert.LessOrEqual(t, maxReading, int32(ioWorkers))
+		assert.Equal(t, extractFiles(unthrottled.Duplicates), extractFiles(result.Duplicates))
+	}
+	// Directories on the same device share its reads
+	result, maxReading := find(WithParallelism(8), WithIOWorkersByDevice(func(string) (string, int) {
+		return "disk", 2
+	}))
+	assert.LessOrEqual(t, maxReading, int32(2))
+	assert.Equal(t, extractFiles(unthrottled.Duplicates), extractFiles(result.Duplicates))
+	result, maxReading = find(WithParallelism(1), WithIOWorkersByDevice(func(dir string) (string, int) {
+		return dir, 3
+	}))
+	assert.LessOrEqual(t, maxReading, int32(6))
+	assert.Equal(t, extractFiles(unthrottled.Duplicates), extractFiles(result.Duplicates))
+}
+
+// TestThrottleWorkQueues checks whether files are queued by devices they're on, each with workers of its own
+func TestThrottleWorkQueues(t *testing.T) {
+	opts := NewOptions([]string{"/hdd/photos", "/hdd/music", "/nvme", "/nvme/ssd"}, WithParallelism(4),
+		WithIOWorkersByDevice(func(dir string) (string, int) {
+			switch dir {
+			case "/nvme":
+				return "nvme", 32
+			case "/nvme/ssd":
+				return "ssd", 0
+			default:
+				return "hdd", 2
+			}
+		}))
+	th := newThrottle(opts)
+	assert.Equal(t, 2, cap(th.turnsToRead("/hdd/music/1.mp3")))
+	assert.Equal(t, 32, cap(th.turnsToRead("/nvme/1.txt")))
+	assert.Nil(t, th.turnsToRead("/nvme/ssd/1.txt"))
+	assert.Nil(t, th.turnsToRead("/usb/1.txt"))
+	mp4 := entity.FileExtAndSize{FileExtension: "mp4", FileSize: 3}
+	mp3 := entity.FileExtAndSize{FileExtension: "mp3", FileSize: 2}
+	jpg := entity.FileExtAndSize{FileExtension: "jpg", FileSize: 2}
+	txt := entity.FileExtAndSize{FileExtension: "txt", FileSize: 1}
+	shortlist := entity.FileExtAndSizeToFiles{
+		mp4: {"/nvme/1.mp4", "/hdd/photos/1.mp4"},
+		mp3: {"/hdd/music/1.mp3", "/hdd/photos/1.mp3"},
+		jpg: {"/hdd/photos/1.jpg", "/hdd/photos/2.jpg"},
+		txt: {"/nvme/ssd/1.txt", "/nvme/ssd/2.txt"},
+	}
+	keys := []entity.FileExtAndSize{mp4, mp3, jpg, txt}
+	queues := th.workQueues(4, keys, shortlist)
+	assert.Len(t, queues, 3)
+	assert.Equal(t, []entity.FileExtAndSize{mp4}, queues[0].keys)
+	assert.Equal(t, 32, queues[0].workers)
+	assert.Equal(t, []entity.FileExtAndSize{mp3, jpg}, queues[1].keys)
+	assert.Equal(t, 2, queues[1].workers)
+	assert.Equal(t, []entity.FileExtAndSize{txt}, queues[2].keys)
+	assert.Equal(t, 4, queues[2].workers)
+	assert.Nil(t, newThrottle(NewOptions([]string{"/hdd"}, WithParallelism(4))))
+	queues = newThrottle(NewOptions([]string{"/hdd"}, WithParallelism(4), WithIOWorkers(16))).workQueues(4, keys,
+		shortlist)
+	assert.Len(t, queues, 1)
+	assert.Equal(t, 16, queues[0].workers)
+}
@@ -0,0 +1,303 @@
+// Package azblob is a vfs.FS backend for containers of Azure Blob Storage, through URLs of the form
+// az://container/prefix. Content-MD5 of blobs is exposed as checksum, so that blobs needn't be downloaded to be
+// hashed by service.MD5Hasher. (Blobs uploaded in blocks without Content-MD5 are read to be hashed.)
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/azblob"
+package azblob
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("az", func(u *url.URL) (vfs.FS, error) {
+		cfg, err := ConfigFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(cfg)
+	})
+}
+
+// checksumMD5 is the name of the checksum algorithm known for blobs (same as name of a hasher of package service)
+const checksumMD5 = "md5"
+
+// Config is the configuration of a container
+type Config struct {
+	Account   string
+	Container string
+	// Endpoint is the URL of the Blob service (defaults to https://<Account>.blob.core.windows.net). For emulators
+	// such as Azurite, it includes the account, e.g. http://127.0.0.1:10000/devstoreaccount1.
+	Endpoint string
+	// AccountKey (base64-encoded) authorizes requests with Shared Key
+	AccountKey string
+	// SASToken (query string of a shared access signature) authorizes requests, if AccountKey isn't set. Requests
+	// are anonymous if neither is set, e.g. for public containers.
+	SASToken string
+	// HTTPClient makes requests (defaults to objectstore.DefaultHTTPClient)
+	HTTPClient *http.Client
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// ConfigFromURL creates Config for a URL of the form az://container/prefix?account=..., taking values not in the
+// URL from environment variables AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT, AZURE_STORAGE_KEY and
+// AZURE_STORAGE_SAS_TOKEN, as Azure CLI does
+func ConfigFromURL(u *url.URL) (Config, error) {
+	cfg := Config{
+		Container:  u.Host,
+		Account:    getenv("AZURE_STORAGE_ACCOUNT"),
+		AccountKey: getenv("AZURE_STORAGE_KEY"),
+		SASToken:   getenv("AZURE_STORAGE_SAS_TOKEN"),
+	}
+	if cs := getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+		if err := cfg.parseConnectionString(cs); err != nil {
+			return cfg, err
+		}
+	}
+	if account := u.Query().Get("account"); account != "" {
+		cfg.Account = account
+	}
+	if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+		cfg.Endpoint = endpoint
+	}
+	return cfg, nil
+}
+
+// parseConnectionString sets fields of cfg from a connection string of a storage account, such as
+// "DefaultEndpointsProtocol=https;AccountName=...;AccountKey=...;EndpointSuffix=core.windows.net"
+func (cfg *Config) parseConnectionString(cs string) error {
+	protocol, suffix := "https", "core.windows.net"
+	for _, part := range strings.Split(cs, ";") {
+		name, value, found := strings.Cut(part, "=")
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		if !found {
+			return fmt.Errorf("invalid connection string: %q isn't of the form name=value", part)
+		}
+		switch name {
+		case "DefaultEndpointsProtocol":
+			protocol = value
+		case "EndpointSuffix":
+			suffix = value
+		case "AccountName":
+			cfg.Account = value
+		case "AccountKey":
+			cfg.AccountKey = value
+		case "SharedAccessSignature":
+			cfg.SASToken = value
+		case "BlobEndpoint":
+			cfg.Endpoint = value
+		}
+	}
+	if cfg.Endpoint == "" && cfg.Account != "" {
+		cfg.Endpoint = protocol + "://" + cfg.Account + ".blob." + suffix
+	}
+	return nil
+}
+
+// client is an objectstore.Client of a container, using the REST API of the Blob service
+//
+// See: https://learn.microsoft.com/rest/api/storageservices/blob-service-rest-api
+type client struct {
+	cfg  Config
+	key  []byte
+	sas  url.Values
+	http *http.Client
+}
+
+// New creates a file system of a container. Names in it are names of blobs, with "/" separating directories.
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Account == "" {
+		return nil, errors.New("storage account is missing (set environment variable AZURE_STORAGE_ACCOUNT)")
+	}
+	if cfg.Container == "" {
+		return nil, errors.New("container name is missing")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://" + cfg.Account + ".blob.core.windows.net"
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	c := &client{cfg: cfg, http: cfg.HTTPClient}
+	if c.http == nil {
+		c.http = objectstore.DefaultHTTPClient
+	}
+	if cfg.AccountKey != "" {
+		if c.key, err = base64.StdEncoding.DecodeString(cfg.AccountKey); err != nil {
+			return nil, fmt.Errorf("invalid account key: %w", err)
+		}
+	} else if cfg.SASToken != "" {
+		if c.sas, err = url.ParseQuery(strings.TrimPrefix(cfg.SASToken, "?")); err != nil {
+			return nil, fmt.Errorf("invalid SAS token: %w", err)
+		}
+	}
+	return objectstore.New(c), nil
+}
+
+// properties are properties of a blob
+type properties struct {
+	LastModified  string `xml:"Last-Modified"`
+	ContentLength int64  `xml:"Content-Length"`
+	ContentMD5    string `xml:"Content-MD5"`
+}
+
+type listResult struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string     `xml:"Name"`
+			Properties properties `xml:"Properties"`
+		} `xml:"Blob"`
+		BlobPrefix []struct {
+			Name string `xml:"Name"`
+		} `xml:"BlobPrefix"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// toObject converts properties of a blob, converting its base64-encoded Content-MD5 to hexadecimal, as
+// service.MD5Hasher has it
+func (p properties) toObject(name string) objectstore.Object {
+	o := objectstore.Object{Key: name, Size: p.ContentLength, Checksums: map[string]string{}}
+	o.ModTime, _ = http.ParseTime(p.LastModified)
+	if md5, err := base64.StdEncoding.DecodeString(p.ContentMD5); err == nil && len(md5) == 16 {
+		o.Checksums[checksumMD5] = hex.EncodeToString(md5)
+	}
+	return o
+}
+
+// do sends a request for the blob named k (or for the container, if k is empty)
+func (c *client) do(ctx context.Context, method, k string, query url.Values, header http.Header) (*http.Response, error) {
+	u := c.cfg.Endpoint + "/" + url.PathEscape(c.cfg.Container)
+	if k != "" {
+		u += "/" + strings.ReplaceAll(url.PathEscape(k), "%2F", "/")
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	for name, values := range c.sas {
+		query[name] = values
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Ms-Version", apiVersion)
+	if c.key != nil {
+		sign(req, c.cfg.Account, c.key, time.Now())
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError converts an unsuccessful response to an error
+func responseError(resp *http.Response) error {
+	return objectstore.ResponseError(resp, func(body []byte) string {
+		er := errorResponse{Code: resp.Header.Get("X-Ms-Error-Code")}
+		_ = xml.Unmarshal(body, &er)
+		if message := strings.TrimSpace(er.Message); message != "" {
+			return er.Code + ": " + message
+		}
+		return er.Code
+	})
+}
+
+// ID identifies the container by its URL
+func (c *client) ID() string {
+	return c.cfg.Endpoint + "/" + c.cfg.Container
+}
+
+func (c *client) List(ctx context.Context, prefix string, limit int, fn func([]objectstore.Object, []string) bool) error {
+	query := url.Values{"restype": {"container"}, "comp": {"list"}, "delimiter": {"/"}, "prefix": {prefix}}
+	if limit > 0 {
+		query.Set("maxresults", strconv.Itoa(limit))
+	}
+	for {
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't parse listing: %w", err)
+		}
+		objects := make([]objectstore.Object, 0, len(result.Blobs.Blob))
+		for _, b := range result.Blobs.Blob {
+			objects = append(objects, b.Properties.toObject(b.Name))
+		}
+		prefixes := make([]string, 0, len(result.Blobs.BlobPrefix))
+		for _, p := range result.Blobs.BlobPrefix {
+			prefixes = append(prefixes, p.Name)
+		}
+		if !fn(objects, prefixes) || result.NextMarker == "" {
+			return nil
+		}
+		query.Set("marker", result.NextMarker)
+	}
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	resp, err := c.do(ctx, http.MethodHead, k, nil, nil)
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	_ = resp.Body.Close()
+	return properties{
+		LastModified:  resp.Header.Get("Last-Modified"),
+		ContentLength: resp.ContentLength,
+		ContentMD5:    resp.Header.Get("Content-MD5"),
+	}.toObject(k), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rng := objectstore.RangeHeader(offset, length); rng != "" {
+		header.Set("X-Ms-Range", rng)
+	}
+	resp, err := c.do(ctx, http.MethodGet, k, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.RangeBody(resp, offset, length)
+}
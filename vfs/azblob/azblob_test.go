@@ -0,0 +1,222 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/m-manu/go-find-duplicates/vfs/vfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAccount = "devstoreaccount1"
+	testKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+func TestStringToSign(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet,
+		"http://127.0.0.1:10000/devstoreaccount1/photos?restype=container&comp=list&prefix=2023%2F", nil)
+	req.Header.Set("X-Ms-Version", apiVersion)
+	req.Header.Set("X-Ms-Date", "Tue, 14 Nov 2023 22:13:20 GMT")
+	assert.Equal(t, "GET\n\n\n\n\n\n\n\n\n\n\n\n"+
+		"x-ms-date:Tue, 14 Nov 2023 22:13:20 GMT\nx-ms-version:2021-08-06\n"+
+		"/devstoreaccount1/devstoreaccount1/photos\ncomp:list\nprefix:2023/\nrestype:container",
+		stringToSign(req, testAccount))
+}
+
+// fakeAzure serves a container of blobs, like Azurite does
+type fakeAzure struct {
+	container string
+	blobs     map[string][]byte
+	noMD5     map[string]bool
+	downloads int
+}
+
+func (s *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, _ := base64.StdEncoding.DecodeString(testKey)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign(r, testAccount)))
+	if r.Header.Get("Authorization") != "SharedKey "+testAccount+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		w.Header().Set("X-Ms-Error-Code", "AuthenticationFailed")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	rest, found := strings.CutPrefix(r.URL.Path, "/"+testAccount+"/"+s.container)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if rest == "" {
+		s.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("marker"))
+		return
+	}
+	k := strings.TrimPrefix(rest, "/")
+	data, exists := s.blobs[k]
+	if !exists {
+		w.Header().Set("X-Ms-Error-Code", "BlobNotFound")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	p := s.properties(k)
+	w.Header().Set("Last-Modified", p.LastModified)
+	if p.ContentMD5 != "" {
+		w.Header().Set("Content-MD5", p.ContentMD5)
+	}
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		return
+	}
+	s.downloads++
+	if rng := r.Header.Get("X-Ms-Range"); rng != "" {
+		var start, end int
+		_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[start : end+1])
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func (s *fakeAzure) properties(k string) properties {
+	p := properties{
+		LastModified:  time.Unix(1_700_000_000, 0).UTC().Format(http.TimeFormat),
+		ContentLength: int64(len(s.blobs[k])),
+	}
+	if !s.noMD5[k] {
+		sum := md5.Sum(s.blobs[k])
+		p.ContentMD5 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return p
+}
+
+// list lists one blob or prefix per page, to exercise pagination
+func (s *fakeAzure) list(w http.ResponseWriter, prefix, marker string) {
+	names := map[string]bool{}
+	for k := range s.blobs {
+		if rest, found := strings.CutPrefix(k, prefix); found {
+			if dir, _, isDir := strings.Cut(rest, "/"); isDir {
+				names[prefix+dir+"/"] = true
+			} else {
+				names[k] = false
+			}
+		}
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	i, _ := strconv.Atoi(marker)
+	var result listResult
+	if i+1 < len(sorted) {
+		result.NextMarker = strconv.Itoa(i + 1)
+	}
+	if i < len(sorted) {
+		if name := sorted[i]; names[name] {
+			result.Blobs.BlobPrefix = append(result.Blobs.BlobPrefix, struct {
+				Name string `xml:"Name"`
+			}{name})
+		} else {
+			result.Blobs.Blob = append(result.Blobs.Blob, struct {
+				Name       string     `xml:"Name"`
+				Properties properties `xml:"Properties"`
+			}{name, s.properties(name)})
+		}
+	}
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"EnumerationResults"`
+		listResult
+	}{listResult: result})
+}
+
+func newTestFS(t *testing.T, s *fakeAzure) vfs.FS {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	fsys, err := New(Config{Account: testAccount, Container: s.container, Endpoint: server.URL + "/" + testAccount,
+		AccountKey: testKey})
+	assert.Nil(t, err)
+	return fsys
+}
+
+// TestFS checks whether blobs can be listed, looked up and read (see vfstest.Run), and whether their MD5s are known
+func TestFS(t *testing.T) {
+	files := vfstest.Files()
+	files["big.mp4"] = []byte("in blocks")
+	s := &fakeAzure{container: "photos", blobs: maps.Clone(files), noMD5: map[string]bool{"big.mp4": true}}
+	fsys := newTestFS(t, s)
+	vfstest.Run(t, fsys, files)
+
+	info, err := fsys.Stat("Photos/a b.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1_700_000_000), info.ModTime().Unix())
+	_, known := vfs.Checksum(fsys, "readme.txt", "md5")
+	assert.True(t, known)
+	_, known = vfs.Checksum(fsys, "big.mp4", "md5")
+	assert.False(t, known)
+}
+
+// TestFindDuplicatesAcrossAzureAndLocal checks whether duplicates are found between a container and a local
+// directory, downloading only blobs without Content-MD5
+func TestFindDuplicatesAcrossAzureAndLocal(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	s := &fakeAzure{container: "backup", blobs: map[string][]byte{
+		"photos/a.jpg": content,
+		"photos/b.jpg": bytes.Repeat([]byte("different "), 1_000),
+		"photos/c.jpg": content,
+	}, noMD5: map[string]bool{"photos/c.jpg": true}}
+	fsys := newTestFS(t, s)
+	local := t.TempDir()
+	assert.Nil(t, os.WriteFile(local+"/a.jpg", content, 0o644))
+	mux := vfs.NewMux(vfs.Local)
+	mux.Mount("az://backup", fsys)
+	fmte.Off()
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(
+		[]string{local, "az://backup/photos"}, service.WithFS(mux), service.WithHasher(service.MD5Hasher{})))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.DuplicateTotalCount)
+	for _, paths := range result.Duplicates.All() {
+		assert.ElementsMatch(t, []string{local + "/a.jpg", "az://backup/photos/a.jpg", "az://backup/photos/c.jpg"},
+			paths)
+	}
+	assert.Equal(t, 1, s.downloads)
+}
+
+func TestConfigFromURL(t *testing.T) {
+	defer func(old func(string) string) { getenv = old }(getenv)
+	getenv = func(name string) string {
+		if name == "AZURE_STORAGE_CONNECTION_STRING" {
+			return "DefaultEndpointsProtocol=https;AccountName=acct;AccountKey=a2V5;EndpointSuffix=core.windows.net"
+		}
+		return ""
+	}
+	u, _ := url.Parse("az://backup/photos")
+	cfg, err := ConfigFromURL(u)
+	assert.Nil(t, err)
+	assert.Equal(t, Config{Account: "acct", Container: "backup", Endpoint: "https://acct.blob.core.windows.net",
+		AccountKey: "a2V5"}, cfg)
+
+	getenv = func(string) string { return "" }
+	cfg, err = ConfigFromURL(u)
+	assert.Nil(t, err)
+	_, err = New(cfg)
+	assert.ErrorContains(t, err, "AZURE_STORAGE_ACCOUNT")
+}
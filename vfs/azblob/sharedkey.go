@@ -0,0 +1,58 @@
+package azblob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiVersion is the version of the Blob service REST API that requests are made with
+const apiVersion = "2021-08-06"
+
+// signedHeaders are the standard headers in the string to sign, in order
+var signedHeaders = []string{"Content-Encoding", "Content-Language", "Content-Length", "Content-MD5", "Content-Type",
+	"Date", "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"}
+
+// sign authorizes req (which has no body) with Shared Key of the storage account.
+//
+// See: https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key
+func sign(req *http.Request, account string, key []byte, now time.Time) {
+	req.Header.Set("X-Ms-Date", now.UTC().Format(http.TimeFormat))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign(req, account)))
+	req.Header.Set("Authorization", "SharedKey "+account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func stringToSign(req *http.Request, account string) string {
+	lines := []string{req.Method}
+	for _, name := range signedHeaders {
+		lines = append(lines, req.Header.Get(name))
+	}
+
+	var msHeaders []string
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(strings.Join(values, ",")))
+		}
+	}
+	sort.Strings(msHeaders)
+	lines = append(lines, msHeaders...)
+
+	resource := "/" + account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+	return strings.Join(append(lines, resource), "\n")
+}
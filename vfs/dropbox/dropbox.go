@@ -0,0 +1,358 @@
+// Package dropbox is a vfs.FS backend for Dropbox, through URLs of the form dropbox://root/path (or
+// dropbox://<namespace ID>/path, for team spaces and shared folders). Content hashes that Dropbox keeps for files
+// are exposed, so that files needn't be downloaded to be hashed by service.DropboxHasher.
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/dropbox"
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("dropbox", func(u *url.URL) (vfs.FS, error) {
+		cfg, err := ConfigFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(cfg)
+	})
+}
+
+// Endpoints of the Dropbox API, for metadata and contents of files
+const (
+	DefaultAPIEndpoint     = "https://api.dropboxapi.com"
+	DefaultContentEndpoint = "https://content.dropboxapi.com"
+)
+
+// Home is the namespace of files of the user whose token is used
+const Home = "root"
+
+// Config is the configuration of a Dropbox account
+type Config struct {
+	// Namespace is Home, or the ID of a namespace (such as that of a team space)
+	Namespace string
+	// AccessToken authorizes requests. Alternatively, RefreshToken (with AppKey, and AppSecret unless the token was
+	// got through PKCE) gets access tokens as they expire.
+	AccessToken  string
+	RefreshToken string
+	AppKey       string
+	AppSecret    string
+	// APIEndpoint and ContentEndpoint are URLs of the API (default to DefaultAPIEndpoint and
+	// DefaultContentEndpoint)
+	APIEndpoint     string
+	ContentEndpoint string
+	// HTTPClient makes requests (defaults to objectstore.DefaultHTTPClient)
+	HTTPClient *http.Client
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// ConfigFromURL creates Config for a URL of the form dropbox://root/path, taking credentials from environment
+// variables DROPBOX_ACCESS_TOKEN, or DROPBOX_REFRESH_TOKEN with DROPBOX_APP_KEY and DROPBOX_APP_SECRET. Tokens need
+// scopes files.metadata.read and files.content.read.
+func ConfigFromURL(u *url.URL) (Config, error) {
+	cfg := Config{
+		Namespace:    u.Host,
+		AccessToken:  getenv("DROPBOX_ACCESS_TOKEN"),
+		RefreshToken: getenv("DROPBOX_REFRESH_TOKEN"),
+		AppKey:       getenv("DROPBOX_APP_KEY"),
+		AppSecret:    getenv("DROPBOX_APP_SECRET"),
+	}
+	if cfg.AccessToken == "" && cfg.RefreshToken == "" {
+		return cfg, errors.New("DROPBOX_ACCESS_TOKEN (or DROPBOX_REFRESH_TOKEN) is needed to access Dropbox")
+	}
+	return cfg, nil
+}
+
+// client is an objectstore.Client of a Dropbox namespace, in which keys are paths of files and "objects" are files
+//
+// See: https://www.dropbox.com/developers/documentation/http/documentation
+type client struct {
+	cfg     Config
+	http    *http.Client
+	mx      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// New creates a file system of a Dropbox namespace
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Namespace == "" {
+		return nil, errors.New("namespace is missing (it's \"root\" for the user's own files)")
+	}
+	if cfg.RefreshToken != "" && cfg.AppKey == "" {
+		return nil, errors.New("app key is needed to refresh access tokens")
+	}
+	if cfg.APIEndpoint == "" {
+		cfg.APIEndpoint = DefaultAPIEndpoint
+	}
+	if cfg.ContentEndpoint == "" {
+		cfg.ContentEndpoint = DefaultContentEndpoint
+	}
+	cfg.APIEndpoint = strings.TrimSuffix(cfg.APIEndpoint, "/")
+	cfg.ContentEndpoint = strings.TrimSuffix(cfg.ContentEndpoint, "/")
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = objectstore.DefaultHTTPClient
+	}
+	return objectstore.New(&client{cfg: cfg, http: httpClient}), nil
+}
+
+// metadata is metadata of a file or folder, as the Dropbox API has it
+type metadata struct {
+	Tag            string    `json:".tag"`
+	Name           string    `json:"name"`
+	Size           int64     `json:"size"`
+	ServerModified time.Time `json:"server_modified"`
+	ContentHash    string    `json:"content_hash"`
+}
+
+type listResult struct {
+	Entries []metadata `json:"entries"`
+	Cursor  string     `json:"cursor"`
+	HasMore bool       `json:"has_more"`
+}
+
+type errorResponse struct {
+	ErrorSummary string `json:"error_summary"`
+}
+
+func (m metadata) toObject(k string) objectstore.Object {
+	checksums := map[string]string{}
+	if m.ContentHash != "" {
+		checksums["dropbox"] = m.ContentHash
+	}
+	return objectstore.Object{Key: k, Size: m.Size, ModTime: m.ServerModified, Checksums: checksums,
+		IsDir: m.Tag == "folder"}
+}
+
+// apiPath converts key k to a path of the API, which is "" for the root
+func apiPath(k string) string {
+	if k == "" {
+		return ""
+	}
+	return "/" + k
+}
+
+// accessToken returns the access token, getting a new one if it's refreshed and has expired
+func (c *client) accessToken(ctx context.Context) (string, error) {
+	if c.cfg.RefreshToken == "" {
+		return c.cfg.AccessToken, nil
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {c.cfg.RefreshToken},
+		"client_id": {c.cfg.AppKey}}
+	if c.cfg.AppSecret != "" {
+		form.Set("client_secret", c.cfg.AppSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.APIEndpoint+"/oauth2/token",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't refresh access token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tr struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&tr)
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return "", fmt.Errorf("couldn't refresh access token: %s %s", resp.Status, tr.ErrorDescription)
+	}
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+	c.token, c.expires = tr.AccessToken, time.Now().Add(lifetime-time.Minute)
+	return c.token, nil
+}
+
+// rpc sends a request to endpoint p of the API, with arguments arg in the body
+func (c *client) rpc(ctx context.Context, p string, arg any) (*http.Response, error) {
+	body, err := json.Marshal(arg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.APIEndpoint+"/2/"+p,
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+// download sends a request to download the file at key k, in the range of rng (if it isn't empty). Arguments of
+// endpoints of contents are in header Dropbox-API-Arg rather than the body.
+func (c *client) download(ctx context.Context, k, rng string) (*http.Response, error) {
+	arg, err := json.Marshal(map[string]string{"path": apiPath(k)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.cfg.ContentEndpoint+"/2/files/download", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Dropbox-API-Arg", asciiJSON(arg))
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	return c.do(req)
+}
+
+// do authorizes and sends a request
+func (c *client) do(req *http.Request) (*http.Response, error) {
+	if c.cfg.Namespace != Home {
+		pathRoot, _ := json.Marshal(map[string]string{".tag": "namespace_id", "namespace_id": c.cfg.Namespace})
+		req.Header.Set("Dropbox-API-Path-Root", string(pathRoot))
+	}
+	token, err := c.accessToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// asciiJSON escapes characters of JSON that aren't ASCII, as header Dropbox-API-Arg needs
+func asciiJSON(data []byte) string {
+	var sb strings.Builder
+	for _, r := range string(data) {
+		switch {
+		case r < utf8.RuneSelf:
+			sb.WriteRune(r)
+		case r > 0xffff:
+			r -= 0x10000
+			fmt.Fprintf(&sb, `\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+		default:
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		}
+	}
+	return sb.String()
+}
+
+// responseError converts an unsuccessful response to an error. Errors of endpoints (status 409) have summaries
+// such as "path/not_found/..".
+func responseError(resp *http.Response) error {
+	var summary string
+	err := objectstore.ResponseError(resp, func(body []byte) string {
+		var er errorResponse
+		summary = strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &er) == nil && er.ErrorSummary != "" {
+			summary = er.ErrorSummary
+		}
+		return summary
+	})
+	if resp.StatusCode == http.StatusConflict && strings.Contains(summary, "/not_found/") {
+		return fmt.Errorf("%s: %w", summary, fs.ErrNotExist)
+	}
+	return err
+}
+
+// decode decodes the JSON body of a response
+func decode(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("couldn't parse response of Dropbox: %w", err)
+	}
+	return nil
+}
+
+// ID identifies the namespace
+func (c *client) ID() string {
+	return "dropbox://" + c.cfg.Namespace
+}
+
+func (c *client) List(ctx context.Context, prefix string, limit int, fn func([]objectstore.Object, []string) bool) error {
+	dir := strings.TrimSuffix(prefix, "/")
+	arg := map[string]any{"path": apiPath(dir)}
+	if limit > 0 {
+		arg["limit"] = limit
+	}
+	resp, err := c.rpc(ctx, "files/list_folder", arg)
+	for {
+		if err != nil {
+			return err
+		}
+		var result listResult
+		if err := decode(resp, &result); err != nil {
+			return err
+		}
+		var objects []objectstore.Object
+		var prefixes []string
+		for _, m := range result.Entries {
+			switch m.Tag {
+			case "folder":
+				prefixes = append(prefixes, prefix+m.Name+"/")
+			case "file":
+				objects = append(objects, m.toObject(prefix+m.Name))
+			}
+		}
+		if !fn(objects, prefixes) || !result.HasMore {
+			return nil
+		}
+		resp, err = c.rpc(ctx, "files/list_folder/continue", map[string]string{"cursor": result.Cursor})
+	}
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	if k == "" {
+		// Metadata of the root can't be got, but it's known to be a folder
+		return objectstore.Object{}, fs.ErrNotExist
+	}
+	resp, err := c.rpc(ctx, "files/get_metadata", map[string]string{"path": apiPath(k)})
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	var m metadata
+	if err := decode(resp, &m); err != nil {
+		return objectstore.Object{}, err
+	}
+	return m.toObject(k), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := c.download(ctx, k, objectstore.RangeHeader(offset, length))
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.RangeBody(resp, offset, length)
+}
@@ -0,0 +1,229 @@
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/m-manu/go-find-duplicates/vfs/vfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDropbox serves files through the Dropbox API, by paths. Listings have one entry per page.
+type fakeDropbox struct {
+	files     map[string][]byte
+	token     string
+	mx        sync.Mutex
+	downloads int
+}
+
+func (s *fakeDropbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/oauth2/token" {
+		_ = r.ParseForm()
+		if r.Form.Get("refresh_token") != "refresh" || r.Form.Get("client_id") != "app" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":"invalid_grant","error_description":"refresh token is malformed"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"access_token":"`+s.token+`","token_type":"bearer","expires_in":14400}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"error_summary":"invalid_access_token/.."}`)
+		return
+	}
+	var arg struct {
+		Path   string `json:"path"`
+		Cursor string `json:"cursor"`
+	}
+	if r.URL.Path == "/2/files/download" {
+		header := r.Header.Get("Dropbox-API-Arg")
+		for i := 0; i < len(header); i++ {
+			if header[i] >= 0x80 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		_ = json.Unmarshal([]byte(header), &arg)
+	} else {
+		_ = json.NewDecoder(r.Body).Decode(&arg)
+	}
+	name := strings.TrimPrefix(arg.Path, "/")
+	content, isFile := s.files[name]
+	switch r.URL.Path {
+	case "/2/files/list_folder", "/2/files/list_folder/continue":
+		page := 0
+		if arg.Cursor != "" {
+			name, page = s.cursor(arg.Cursor)
+		}
+		entries := s.entries(name)
+		if entries == nil {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"error_summary":"path/not_found/..","error":{".tag":"path"}}`)
+			return
+		}
+		result := listResult{Entries: entries[page : page+1], Cursor: name + "|" + strconv.Itoa(page+1),
+			HasMore: page+1 < len(entries)}
+		_ = json.NewEncoder(w).Encode(result)
+	case "/2/files/get_metadata":
+		if !isFile {
+			if s.entries(name) == nil {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = io.WriteString(w, `{"error_summary":"path/not_found/.","error":{".tag":"path"}}`)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(metadata{Tag: "folder", Name: name[strings.LastIndex(name, "/")+1:]})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(fileMetadata(name, content))
+	case "/2/files/download":
+		if !isFile {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"error_summary":"path/not_found/.."}`)
+			return
+		}
+		s.mx.Lock()
+		s.downloads++
+		s.mx.Unlock()
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[start : end+1])
+			return
+		}
+		_, _ = w.Write(content)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *fakeDropbox) cursor(cursor string) (string, int) {
+	name, page, _ := strings.Cut(cursor, "|")
+	n, _ := strconv.Atoi(page)
+	return name, n
+}
+
+// entries returns entries of the folder at name, or nil if there's no such folder
+func (s *fakeDropbox) entries(dir string) []metadata {
+	folders := map[string]bool{}
+	var entries []metadata
+	for k, content := range s.files {
+		rest, found := strings.CutPrefix(k, dir+"/")
+		if dir == "" {
+			rest, found = k, true
+		}
+		if !found {
+			continue
+		}
+		if child, _, isDir := strings.Cut(rest, "/"); isDir {
+			if !folders[child] {
+				folders[child] = true
+				entries = append(entries, metadata{Tag: "folder", Name: child})
+			}
+		} else {
+			entries = append(entries, fileMetadata(k, content))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// fileMetadata has the content hash of a file smaller than a block, i.e. SHA-256 of its SHA-256
+func fileMetadata(name string, content []byte) metadata {
+	blockSum := sha256.Sum256(content)
+	contentHash := sha256.Sum256(blockSum[:])
+	return metadata{Tag: "file", Name: name[strings.LastIndex(name, "/")+1:], Size: int64(len(content)),
+		ServerModified: time.Unix(1_700_000_000, 0).UTC(), ContentHash: hex.EncodeToString(contentHash[:])}
+}
+
+func newTestFS(t *testing.T, s *fakeDropbox, cfg Config) vfs.FS {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	cfg.Namespace, cfg.APIEndpoint, cfg.ContentEndpoint = Home, server.URL, server.URL
+	fsys, err := New(cfg)
+	assert.Nil(t, err)
+	return fsys
+}
+
+// TestFS checks whether folders can be listed, and files looked up and read (see vfstest.Run), and whether access
+// tokens are got through refresh tokens
+func TestFS(t *testing.T) {
+	files := vfstest.Files()
+	files["Photos/café.jpg"] = []byte("0123456789")
+	s := &fakeDropbox{token: "token", files: maps.Clone(files)}
+	fsys := newTestFS(t, s, Config{AccessToken: "token"})
+	vfstest.Run(t, fsys, files)
+	_, known := vfs.Checksum(fsys, "readme.txt", "dropbox")
+	assert.True(t, known)
+
+	// Access tokens are got through refresh tokens
+	fsys = newTestFS(t, s, Config{RefreshToken: "refresh", AppKey: "app"})
+	_, err := fsys.Stat("readme.txt")
+	assert.Nil(t, err)
+	fsys = newTestFS(t, s, Config{RefreshToken: "revoked", AppKey: "app"})
+	_, err = fsys.Stat("readme.txt")
+	assert.ErrorContains(t, err, "refresh token is malformed")
+	fsys = newTestFS(t, s, Config{AccessToken: "expired"})
+	_, err = fsys.ReadDir(".")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
+
+// TestFindDuplicatesAcrossDropboxAndLocal checks whether duplicates are found between Dropbox and a local
+// directory, without downloading files
+func TestFindDuplicatesAcrossDropboxAndLocal(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	s := &fakeDropbox{token: "token", files: map[string][]byte{
+		"Photos/a.jpg":      content,
+		"Photos/b.jpg":      bytes.Repeat([]byte("different "), 1_000),
+		"Photos/2023/c.jpg": content,
+	}}
+	fsys := newTestFS(t, s, Config{AccessToken: "token"})
+	local := t.TempDir()
+	assert.Nil(t, os.WriteFile(local+"/a.jpg", content, 0o644))
+	mux := vfs.NewMux(vfs.Local)
+	mux.Mount("dropbox://root", fsys)
+	fmte.Off()
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(
+		[]string{local, "dropbox://root/Photos"}, service.WithFS(mux), service.WithHasher(service.DropboxHasher{})))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.DuplicateTotalCount)
+	for _, paths := range result.Duplicates.All() {
+		assert.ElementsMatch(t, []string{local + "/a.jpg", "dropbox://root/Photos/a.jpg",
+			"dropbox://root/Photos/2023/c.jpg"}, paths)
+	}
+	assert.Equal(t, 0, s.downloads)
+}
+
+func TestConfigFromURL(t *testing.T) {
+	defer func(old func(string) string) { getenv = old }(getenv)
+	env := map[string]string{}
+	getenv = func(name string) string { return env[name] }
+	u, _ := url.Parse("dropbox://root/Photos")
+	_, err := ConfigFromURL(u)
+	assert.NotNil(t, err)
+	env = map[string]string{"DROPBOX_REFRESH_TOKEN": "refresh", "DROPBOX_APP_KEY": "app"}
+	cfg, err := ConfigFromURL(u)
+	assert.Nil(t, err)
+	assert.Equal(t, Config{Namespace: Home, RefreshToken: "refresh", AppKey: "app"}, cfg)
+}
@@ -0,0 +1,176 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// conn is a control connection of an FTP session, which runs one command at a time
+type conn struct {
+	cfg  *Config
+	raw  net.Conn
+	text *textproto.Conn
+	// tlsConfig is of the control connection (and data connections, which resume its TLS session), if it's FTPS
+	tlsConfig *tls.Config
+}
+
+// dial connects to the server and logs in
+func dial(ctx context.Context, cfg *Config) (*conn, error) {
+	dialer := net.Dialer{Timeout: cfg.Timeout}
+	raw, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{cfg: cfg, raw: raw, text: textproto.NewConn(raw)}
+	if err := c.login(); err != nil {
+		_ = c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *conn) login() error {
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return responseError(err)
+	}
+	if c.cfg.TLS {
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			return fmt.Errorf("server doesn't support FTPS: %w", err)
+		}
+		c.tlsConfig = c.cfg.TLSConfig.Clone()
+		if c.tlsConfig == nil {
+			c.tlsConfig = &tls.Config{}
+		}
+		if c.tlsConfig.ServerName == "" {
+			c.tlsConfig.ServerName, _, _ = net.SplitHostPort(c.cfg.Addr)
+		}
+		// Servers commonly require data connections to resume the TLS session of the control connection
+		c.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+		tlsConn := tls.Client(c.raw, c.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.raw, c.text = tlsConn, textproto.NewConn(tlsConn)
+	}
+	code, _, err := c.cmd(0, "USER %s", c.cfg.Username)
+	if err == nil && code == 331 {
+		code, _, err = c.cmd(0, "PASS %s", c.cfg.Password)
+	}
+	if err != nil {
+		return err
+	}
+	if code != 230 && code != 202 {
+		return fmt.Errorf("couldn't log in as %s: %w", c.cfg.Username, fs.ErrPermission)
+	}
+	if c.cfg.TLS {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+	}
+	_, _, err = c.cmd(2, "TYPE I")
+	return err
+}
+
+// cmd sends a command and reads its response, which must have a code starting with expect (unless it's 0, in which
+// case only I/O errors are returned)
+func (c *conn) cmd(expect int, format string, args ...any) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	code, msg, err := c.text.ReadResponse(expect)
+	return code, msg, responseError(err)
+}
+
+// responseError converts an error response of the server to errors that fs.ErrNotExist and fs.ErrPermission match
+func responseError(err error) error {
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) {
+		return err
+	}
+	switch protoErr.Code {
+	case 550, 450:
+		return fmt.Errorf("%s: %w", protoErr.Msg, fs.ErrNotExist)
+	case 530, 532:
+		return fmt.Errorf("%s: %w", protoErr.Msg, fs.ErrPermission)
+	default:
+		return err
+	}
+}
+
+// openData runs a command that transfers data (such as RETR) over a new passive data connection
+func (c *conn) openData(format string, args ...any) (net.Conn, error) {
+	addr, err := c.passive()
+	if err != nil {
+		return nil, err
+	}
+	data, err := net.DialTimeout("tcp", addr, c.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.cmd(1, format, args...); err != nil {
+		_ = data.Close()
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		data = tls.Client(data, c.tlsConfig)
+	}
+	return data, nil
+}
+
+// passive gets the address of a data connection, through EPSV or (for servers that don't support it) PASV. The
+// host of the control connection is used, since servers behind NAT often send their private addresses.
+func (c *conn) passive() (string, error) {
+	host, _, _ := net.SplitHostPort(c.raw.RemoteAddr().String())
+	code, msg, err := c.cmd(0, "EPSV")
+	if err != nil {
+		return "", err
+	}
+	if code == 229 {
+		// 229 Entering Extended Passive Mode (|||port|)
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start >= 0 && end > start+4 {
+			return net.JoinHostPort(host, msg[start+4:end]), nil
+		}
+		return "", fmt.Errorf("couldn't parse EPSV response %q", msg)
+	}
+	_, msg, err = c.cmd(2, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("couldn't parse PASV response %q", msg)
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return "", fmt.Errorf("couldn't parse PASV response %q", msg)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("couldn't parse PASV response %q", msg)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p1<<8|p2)), nil
+}
+
+// endData reads the response of the server once a transfer is complete
+func (c *conn) endData() error {
+	_, _, err := c.text.ReadResponse(2)
+	return responseError(err)
+}
+
+func (c *conn) close() error {
+	_ = c.text.PrintfLine("QUIT")
+	return c.raw.Close()
+}
@@ -0,0 +1,245 @@
+// Package gcs is a vfs.FS backend for buckets of Google Cloud Storage, through URLs of the form gs://bucket/prefix.
+// MD5 and CRC32C checksums that Cloud Storage keeps are exposed, so that objects needn't be downloaded to be hashed
+// by service.MD5Hasher or service.CRC32CHasher. (Composite objects have no MD5, and so are read to be hashed by
+// service.MD5Hasher.)
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/gcs"
+package gcs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/googleauth"
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("gs", func(u *url.URL) (vfs.FS, error) {
+		cfg, err := ConfigFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(cfg)
+	})
+}
+
+// DefaultEndpoint is the endpoint of Cloud Storage
+const DefaultEndpoint = "https://storage.googleapis.com"
+
+// scopeReadOnly is the OAuth scope needed to list and read objects
+const scopeReadOnly = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// Names of checksum algorithms known for objects (same as names of the hashers of package service)
+const (
+	checksumMD5    = "md5"
+	checksumCRC32C = "crc32c"
+)
+
+// Config is the configuration of a bucket
+type Config struct {
+	Bucket string
+	// Endpoint is the URL of Cloud Storage, or of an emulator of it (defaults to DefaultEndpoint)
+	Endpoint string
+	// TokenSource authorizes requests (requests are anonymous if this is nil, e.g. for public buckets)
+	TokenSource googleauth.TokenSource
+	// HTTPClient makes requests (defaults to objectstore.DefaultHTTPClient)
+	HTTPClient *http.Client
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// ConfigFromURL creates Config for a URL of the form gs://bucket/prefix?endpoint=..., finding credentials as
+// Google Cloud SDKs do. As with those, environment variable STORAGE_EMULATOR_HOST points to an emulator, with
+// which requests are anonymous.
+func ConfigFromURL(u *url.URL) (Config, error) {
+	cfg := Config{Bucket: u.Host, Endpoint: u.Query().Get("endpoint")}
+	if emulator := getenv("STORAGE_EMULATOR_HOST"); cfg.Endpoint == "" && emulator != "" {
+		if !strings.Contains(emulator, "://") {
+			emulator = "http://" + emulator
+		}
+		cfg.Endpoint = emulator
+		return cfg, nil
+	}
+	var err error
+	cfg.TokenSource, err = googleauth.FromEnv(nil, scopeReadOnly)
+	return cfg, err
+}
+
+// client is an objectstore.Client of a bucket, using the JSON API of Cloud Storage
+//
+// See: https://cloud.google.com/storage/docs/json_api/v1/objects
+type client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// New creates a file system of a bucket. Names in it are names of objects, with "/" separating directories.
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket name is missing")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = objectstore.DefaultHTTPClient
+	}
+	return objectstore.New(&client{cfg: cfg, http: httpClient}), nil
+}
+
+// object is metadata of an object, as the JSON API has it
+type object struct {
+	Name    string    `json:"name"`
+	Size    string    `json:"size"`
+	Updated time.Time `json:"updated"`
+	MD5Hash string    `json:"md5Hash"`
+	CRC32C  string    `json:"crc32c"`
+}
+
+type listResult struct {
+	Items         []object `json:"items"`
+	Prefixes      []string `json:"prefixes"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// toObject converts metadata of an object, converting its base64-encoded checksums to hexadecimal, as hashers
+// of package service have them
+func (o object) toObject() objectstore.Object {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	checksums := map[string]string{}
+	if md5, err := base64.StdEncoding.DecodeString(o.MD5Hash); err == nil && len(md5) == 16 {
+		checksums[checksumMD5] = hex.EncodeToString(md5)
+	}
+	if crc, err := base64.StdEncoding.DecodeString(o.CRC32C); err == nil && len(crc) == 4 {
+		checksums[checksumCRC32C] = hex.EncodeToString(crc)
+	}
+	return objectstore.Object{Key: o.Name, Size: size, ModTime: o.Updated, Checksums: checksums}
+}
+
+// get sends a GET request for the object named k (or for the listing of objects, if k is empty)
+func (c *client) get(ctx context.Context, k string, query url.Values, header http.Header) (*http.Response, error) {
+	u := c.cfg.Endpoint + "/storage/v1/b/" + url.PathEscape(c.cfg.Bucket) + "/o"
+	if k != "" {
+		u += "/" + url.PathEscape(k)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.cfg.TokenSource != nil {
+		token, tErr := c.cfg.TokenSource.Token(req.Context())
+		if tErr != nil {
+			return nil, tErr
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError converts an unsuccessful response to an error
+func responseError(resp *http.Response) error {
+	return objectstore.ResponseError(resp, func(body []byte) string {
+		var er errorResponse
+		_ = json.Unmarshal(body, &er)
+		return er.Error.Message
+	})
+}
+
+// ID identifies the bucket by its name and the endpoint (which is that of emulators, if they're used)
+func (c *client) ID() string {
+	return c.cfg.Endpoint + "/" + c.cfg.Bucket
+}
+
+func (c *client) List(ctx context.Context, prefix string, limit int, fn func([]objectstore.Object, []string) bool) error {
+	query := url.Values{"delimiter": {"/"}, "prefix": {prefix},
+		"fields": {"items(name,size,updated,md5Hash,crc32c),prefixes,nextPageToken"}}
+	if limit > 0 {
+		query.Set("maxResults", strconv.Itoa(limit))
+	}
+	for {
+		resp, err := c.get(ctx, "", query, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't parse listing: %w", err)
+		}
+		objects := make([]objectstore.Object, 0, len(result.Items))
+		for _, o := range result.Items {
+			objects = append(objects, o.toObject())
+		}
+		if !fn(objects, result.Prefixes) || result.NextPageToken == "" {
+			return nil
+		}
+		query.Set("pageToken", result.NextPageToken)
+	}
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	resp, err := c.get(ctx, k, nil, nil)
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	defer resp.Body.Close()
+	var o object
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return objectstore.Object{}, fmt.Errorf("couldn't parse metadata: %w", err)
+	}
+	return o.toObject(), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rng := objectstore.RangeHeader(offset, length); rng != "" {
+		header.Set("Range", rng)
+	}
+	resp, err := c.get(ctx, k, url.Values{"alt": {"media"}}, header)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.RangeBody(resp, offset, length)
+}
@@ -0,0 +1,184 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/googleauth"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/m-manu/go-find-duplicates/vfs/vfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGCS serves a bucket of objects through the JSON API, like an emulator of Cloud Storage does
+type fakeGCS struct {
+	bucket    string
+	objects   map[string][]byte
+	composite map[string]bool
+	downloads int
+}
+
+func (s *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	rest, found := strings.CutPrefix(r.URL.EscapedPath(), "/storage/v1/b/"+s.bucket+"/o")
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if rest == "" {
+		s.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("pageToken"))
+		return
+	}
+	k, _ := url.PathUnescape(strings.TrimPrefix(rest, "/"))
+	data, exists := s.objects[k]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":{"code":404,"message":"No such object: `+s.bucket+"/"+k+`"}}`)
+		return
+	}
+	if r.URL.Query().Get("alt") != "media" {
+		_ = json.NewEncoder(w).Encode(s.metadata(k))
+		return
+	}
+	s.downloads++
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end int
+		_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[start : end+1])
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func (s *fakeGCS) metadata(k string) object {
+	data := s.objects[k]
+	crc := binary.BigEndian.AppendUint32(nil, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	o := object{Name: k, Size: strconv.Itoa(len(data)), CRC32C: base64.StdEncoding.EncodeToString(crc)}
+	if !s.composite[k] {
+		sum := md5.Sum(data)
+		o.MD5Hash = base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return o
+}
+
+// list lists one object or prefix per page, to exercise pagination
+func (s *fakeGCS) list(w http.ResponseWriter, prefix, token string) {
+	names := map[string]bool{}
+	for k := range s.objects {
+		if rest, found := strings.CutPrefix(k, prefix); found {
+			if dir, _, isDir := strings.Cut(rest, "/"); isDir {
+				names[prefix+dir+"/"] = true
+			} else {
+				names[k] = false
+			}
+		}
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	i, _ := strconv.Atoi(token)
+	var result listResult
+	if i+1 < len(sorted) {
+		result.NextPageToken = strconv.Itoa(i + 1)
+	}
+	if i < len(sorted) {
+		if name := sorted[i]; names[name] {
+			result.Prefixes = append(result.Prefixes, name)
+		} else {
+			result.Items = append(result.Items, s.metadata(name))
+		}
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func newTestFS(t *testing.T, s *fakeGCS) vfs.FS {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	fsys, err := New(Config{Bucket: s.bucket, Endpoint: server.URL, TokenSource: googleauth.StaticToken("token")})
+	assert.Nil(t, err)
+	return fsys
+}
+
+// TestFS checks whether objects can be listed, looked up and read (see vfstest.Run), and whether their checksums are
+// known: CRC32Cs of all objects, and MD5s of those that aren't composite
+func TestFS(t *testing.T) {
+	files := vfstest.Files()
+	files["big.mp4"] = []byte("composed")
+	s := &fakeGCS{bucket: "photos", objects: maps.Clone(files), composite: map[string]bool{"big.mp4": true}}
+	fsys := newTestFS(t, s)
+	vfstest.Run(t, fsys, files)
+
+	_, known := vfs.Checksum(fsys, "readme.txt", "md5")
+	assert.True(t, known)
+	_, known = vfs.Checksum(fsys, "big.mp4", "md5")
+	assert.False(t, known)
+	_, known = vfs.Checksum(fsys, "big.mp4", "crc32c")
+	assert.True(t, known)
+}
+
+// TestFindDuplicatesAcrossGCSAndLocal checks whether duplicates are found between a bucket and a local directory,
+// downloading only objects whose checksums by the hasher aren't known
+func TestFindDuplicatesAcrossGCSAndLocal(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	s := &fakeGCS{bucket: "backup", objects: map[string][]byte{
+		"photos/a.jpg": content,
+		"photos/b.jpg": bytes.Repeat([]byte("different "), 1_000),
+		"photos/c.jpg": content,
+	}, composite: map[string]bool{"photos/c.jpg": true}}
+	fsys := newTestFS(t, s)
+	local := t.TempDir()
+	assert.Nil(t, os.WriteFile(local+"/a.jpg", content, 0o644))
+	mux := vfs.NewMux(vfs.Local)
+	mux.Mount("gs://backup", fsys)
+	fmte.Off()
+	for hasher, downloads := range map[service.Hasher]int{service.CRC32CHasher{}: 0, service.MD5Hasher{}: 1} {
+		s.downloads = 0
+		result, err := service.FindDuplicates(context.Background(), service.NewOptions(
+			[]string{local, "gs://backup/photos"}, service.WithFS(mux), service.WithHasher(hasher)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), result.DuplicateTotalCount, hasher.Name())
+		for _, paths := range result.Duplicates.All() {
+			assert.ElementsMatch(t, []string{local + "/a.jpg", "gs://backup/photos/a.jpg",
+				"gs://backup/photos/c.jpg"}, paths)
+		}
+		assert.Equal(t, downloads, s.downloads, hasher.Name())
+	}
+}
+
+func TestConfigFromURL(t *testing.T) {
+	defer func(old func(string) string) { getenv = old }(getenv)
+	getenv = func(name string) string {
+		if name == "STORAGE_EMULATOR_HOST" {
+			return "localhost:4443"
+		}
+		return ""
+	}
+	u, _ := url.Parse("gs://bucket/prefix")
+	cfg, err := ConfigFromURL(u)
+	assert.Nil(t, err)
+	assert.Equal(t, Config{Bucket: "bucket", Endpoint: "http://localhost:4443"}, cfg)
+}
@@ -0,0 +1,325 @@
+// Package gdrive is a vfs.FS backend for Google Drive, through URLs of the form gdrive://root/path for My Drive
+// (or gdrive://<id of shared drive>/path for shared drives). MD5 and SHA-256 checksums that Drive keeps for files
+// are exposed, so that files needn't be downloaded to be hashed by service.MD5Hasher or service.SHA256Hasher.
+// Google Docs, Sheets and such have no contents of their own, and so are skipped.
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/gdrive"
+package gdrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/googleauth"
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("gdrive", func(u *url.URL) (vfs.FS, error) {
+		cfg, err := ConfigFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(cfg)
+	})
+}
+
+// DefaultEndpoint is the endpoint of the Drive API
+const DefaultEndpoint = "https://www.googleapis.com"
+
+// MyDrive is the drive of the user whose credentials are used
+const MyDrive = "root"
+
+const (
+	scopeReadOnly  = "https://www.googleapis.com/auth/drive.readonly"
+	mimeTypeFolder = "application/vnd.google-apps.folder"
+	// mimeTypesOfGoogle is the prefix of MIME types of Google Docs, Sheets, folders and such
+	mimeTypesOfGoogle = "application/vnd.google-apps."
+)
+
+// Config is the configuration of a drive
+type Config struct {
+	// Drive is MyDrive, or the ID of a shared drive
+	Drive string
+	// Endpoint is the URL of the Drive API (defaults to DefaultEndpoint)
+	Endpoint string
+	// TokenSource authorizes requests
+	TokenSource googleauth.TokenSource
+	// HTTPClient makes requests (defaults to objectstore.DefaultHTTPClient)
+	HTTPClient *http.Client
+}
+
+// ConfigFromURL creates Config for a URL of the form gdrive://root/path, finding credentials as Google Cloud SDKs
+// do. Credentials must have scope drive.readonly (e.g. those of "gcloud auth application-default login
+// --scopes=https://www.googleapis.com/auth/drive.readonly,https://www.googleapis.com/auth/cloud-platform").
+func ConfigFromURL(u *url.URL) (Config, error) {
+	cfg := Config{Drive: u.Host, Endpoint: u.Query().Get("endpoint")}
+	if strings.EqualFold(cfg.Drive, "my-drive") {
+		cfg.Drive = MyDrive
+	}
+	var err error
+	if cfg.TokenSource, err = googleauth.FromEnv(nil, scopeReadOnly); err == nil && cfg.TokenSource == nil {
+		err = errors.New("no Google credentials were found, which are needed to access Google Drive")
+	}
+	return cfg, err
+}
+
+// client is an objectstore.Client of a drive, in which keys are paths of files. Drive identifies files by IDs,
+// which are remembered for paths as folders are listed.
+//
+// See: https://developers.google.com/drive/api/reference/rest/v3/files
+type client struct {
+	cfg  Config
+	http *http.Client
+	mx   sync.Mutex
+	ids  map[string]string
+}
+
+// New creates a file system of a drive. Names in it are paths of files, with "/" separating folders. Files of the
+// same name in a folder (which Drive allows) get their IDs appended to their names, before their extensions.
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Drive == "" {
+		return nil, errors.New("drive is missing (it's \"root\" for My Drive)")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = objectstore.DefaultHTTPClient
+	}
+	return objectstore.New(&client{cfg: cfg, http: httpClient, ids: map[string]string{"": cfg.Drive}}), nil
+}
+
+// file is metadata of a file, as the Drive API has it
+type file struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	MimeType       string    `json:"mimeType"`
+	Size           string    `json:"size"`
+	ModifiedTime   time.Time `json:"modifiedTime"`
+	MD5Checksum    string    `json:"md5Checksum"`
+	SHA256Checksum string    `json:"sha256Checksum"`
+}
+
+const fileFields = "id,name,mimeType,size,modifiedTime,md5Checksum,sha256Checksum"
+
+type listResult struct {
+	Files         []file `json:"files"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (f file) toObject(k string) objectstore.Object {
+	size, _ := strconv.ParseInt(f.Size, 10, 64)
+	checksums := map[string]string{}
+	if f.MD5Checksum != "" {
+		checksums["md5"] = f.MD5Checksum
+	}
+	if f.SHA256Checksum != "" {
+		checksums["sha256"] = f.SHA256Checksum
+	}
+	return objectstore.Object{Key: k, Size: size, ModTime: f.ModifiedTime, Checksums: checksums,
+		IsDir: f.MimeType == mimeTypeFolder}
+}
+
+// get sends a GET request to the Drive API
+func (c *client) get(ctx context.Context, p string, query url.Values, header http.Header) (*http.Response, error) {
+	if c.cfg.Drive != MyDrive {
+		query.Set("supportsAllDrives", "true")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.cfg.Endpoint+"/drive/v3/"+p+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.cfg.TokenSource != nil {
+		token, tErr := c.cfg.TokenSource.Token(req.Context())
+		if tErr != nil {
+			return nil, tErr
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError converts an unsuccessful response to an error
+func responseError(resp *http.Response) error {
+	return objectstore.ResponseError(resp, func(body []byte) string {
+		var er errorResponse
+		_ = json.Unmarshal(body, &er)
+		return er.Error.Message
+	})
+}
+
+// query finds files in the folder of given ID, optionally of given name
+func (c *client) query(ctx context.Context, folderID, name string, fn func([]file)) error {
+	q := "'" + escape(folderID) + "' in parents and trashed = false"
+	if name != "" {
+		q += " and name = '" + escape(name) + "'"
+	}
+	query := url.Values{"q": {q}, "pageSize": {"1000"}, "fields": {"nextPageToken,files(" + fileFields + ")"}}
+	if c.cfg.Drive != MyDrive {
+		query.Set("corpora", "drive")
+		query.Set("driveId", c.cfg.Drive)
+		query.Set("includeItemsFromAllDrives", "true")
+	}
+	for {
+		resp, err := c.get(ctx, "files", query, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't parse listing: %w", err)
+		}
+		fn(result.Files)
+		if result.NextPageToken == "" {
+			return nil
+		}
+		query.Set("pageToken", result.NextPageToken)
+	}
+}
+
+// escape escapes a value to be quoted in a query
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
+
+// id finds the ID of the file at key k, looking up each folder in its path that hasn't been listed
+func (c *client) id(ctx context.Context, k string) (string, error) {
+	c.mx.Lock()
+	id, known := c.ids[k]
+	c.mx.Unlock()
+	if known {
+		return id, nil
+	}
+	dir, name := path.Split(k)
+	dir = strings.TrimSuffix(dir, "/")
+	folderID, err := c.id(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	err = c.query(ctx, folderID, name, func(files []file) {
+		if len(files) > 0 && id == "" {
+			id = files[0].ID
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fs.ErrNotExist
+	}
+	c.mx.Lock()
+	c.ids[k] = id
+	c.mx.Unlock()
+	return id, nil
+}
+
+// ID identifies the drive
+func (c *client) ID() string {
+	return "gdrive://" + c.cfg.Drive
+}
+
+func (c *client) List(ctx context.Context, prefix string, _ int, fn func([]objectstore.Object, []string) bool) error {
+	dir := strings.TrimSuffix(prefix, "/")
+	folderID, err := c.id(ctx, dir)
+	if err != nil {
+		return err
+	}
+	var all []file
+	if err := c.query(ctx, folderID, "", func(files []file) { all = append(all, files...) }); err != nil {
+		return err
+	}
+	var objects []objectstore.Object
+	var prefixes []string
+	names := map[string]bool{}
+	c.mx.Lock()
+	for _, f := range all {
+		if f.MimeType != mimeTypeFolder && strings.HasPrefix(f.MimeType, mimeTypesOfGoogle) {
+			continue
+		}
+		name := f.Name
+		if names[name] {
+			ext := path.Ext(name)
+			name = strings.TrimSuffix(name, ext) + " (" + f.ID + ")" + ext
+		}
+		names[name] = true
+		k := path.Join(dir, name)
+		c.ids[k] = f.ID
+		if f.MimeType == mimeTypeFolder {
+			prefixes = append(prefixes, k+"/")
+		} else {
+			objects = append(objects, f.toObject(k))
+		}
+	}
+	c.mx.Unlock()
+	fn(objects, prefixes)
+	return nil
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	id, err := c.id(ctx, k)
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	resp, err := c.get(ctx, "files/"+url.PathEscape(id), url.Values{"fields": {fileFields}}, nil)
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	defer resp.Body.Close()
+	var f file
+	if err := json.NewDecoder(resp.Body).Decode(&f); err != nil {
+		return objectstore.Object{}, fmt.Errorf("couldn't parse metadata: %w", err)
+	}
+	return f.toObject(k), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	id, err := c.id(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if rng := objectstore.RangeHeader(offset, length); rng != "" {
+		header.Set("Range", rng)
+	}
+	resp, err := c.get(ctx, "files/"+url.PathEscape(id), url.Values{"alt": {"media"}}, header)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.RangeBody(resp, offset, length)
+}
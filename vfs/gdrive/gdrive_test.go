@@ -0,0 +1,226 @@
+package gdrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/internal/googleauth"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/m-manu/go-find-duplicates/vfs/vfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFile is a file of fakeDrive. Folders have no content.
+type fakeFile struct {
+	parent, name, mimeType string
+	content                []byte
+}
+
+// fakeDrive serves files through the Drive API, by IDs. Listings have one file per page.
+type fakeDrive struct {
+	files     map[string]fakeFile
+	mx        sync.Mutex
+	downloads int
+}
+
+var queryPattern = regexp.MustCompile(`^'([^']+)' in parents and trashed = false(?: and name = '((?:[^'\\]|\\.)*)')?$`)
+
+func (s *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/drive/v3/files" {
+		m := queryPattern.FindStringSubmatch(r.URL.Query().Get("q"))
+		if m == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var matches []file
+		for _, id := range s.sortedIDs() {
+			f := s.files[id]
+			if f.parent == m[1] && (m[2] == "" || f.name == strings.ReplaceAll(m[2], `\'`, `'`)) {
+				matches = append(matches, s.metadata(id))
+			}
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		var result listResult
+		if page < len(matches) {
+			result.Files = matches[page : page+1]
+		}
+		if page+1 < len(matches) {
+			result.NextPageToken = strconv.Itoa(page + 1)
+		}
+		_ = json.NewEncoder(w).Encode(result)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+	f, exists := s.files[id]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":{"code":404,"message":"File not found: `+id+`."}}`)
+		return
+	}
+	if r.URL.Query().Get("alt") != "media" {
+		_ = json.NewEncoder(w).Encode(s.metadata(id))
+		return
+	}
+	s.mx.Lock()
+	s.downloads++
+	s.mx.Unlock()
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end int
+		_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(f.content[start : end+1])
+		return
+	}
+	_, _ = w.Write(f.content)
+}
+
+func (s *fakeDrive) sortedIDs() []string {
+	var ids []string
+	for id := range s.files {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *fakeDrive) metadata(id string) file {
+	f := s.files[id]
+	m := file{ID: id, Name: f.name, MimeType: f.mimeType, ModifiedTime: time.Unix(1_700_000_000, 0).UTC()}
+	if m.MimeType == "" {
+		sum := md5.Sum(f.content)
+		m.MimeType, m.Size, m.MD5Checksum = "image/jpeg", strconv.Itoa(len(f.content)), hex.EncodeToString(sum[:])
+	}
+	return m
+}
+
+func newTestFS(t *testing.T, s *fakeDrive) vfs.FS {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	fsys, err := New(Config{Drive: MyDrive, Endpoint: server.URL, TokenSource: googleauth.StaticToken("token")})
+	assert.Nil(t, err)
+	return fsys
+}
+
+// fakeFiles returns files of fakeDrive of files by their paths, with folders of their directories, by IDs f1, f2, …
+func fakeFiles(files map[string][]byte) map[string]fakeFile {
+	fake := map[string]fakeFile{}
+	folders := map[string]string{".": "root"}
+	var folder func(dir string) string
+	folder = func(dir string) string {
+		if id, exists := folders[dir]; exists {
+			return id
+		}
+		parent := folder(path.Dir(dir))
+		id := fmt.Sprintf("f%d", len(fake)+1)
+		fake[id], folders[dir] = fakeFile{parent: parent, name: path.Base(dir), mimeType: mimeTypeFolder}, id
+		return id
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		parent := folder(path.Dir(name))
+		fake[fmt.Sprintf("f%d", len(fake)+1)] = fakeFile{parent: parent, name: path.Base(name), content: files[name]}
+	}
+	return fake
+}
+
+// TestFS checks whether folders can be listed, and files looked up by paths and read (see vfstest.Run), including
+// files of the same names and Google Docs, which can't be downloaded as they are
+func TestFS(t *testing.T) {
+	files := vfstest.Files()
+	s := &fakeDrive{files: fakeFiles(files)}
+	s.files["u1"] = fakeFile{parent: "root", name: "Uploads", mimeType: mimeTypeFolder}
+	s.files["u2"] = fakeFile{parent: "u1", name: "O'Brien.jpg", content: []byte("0123456789")}
+	s.files["u3"] = fakeFile{parent: "u1", name: "O'Brien.jpg", content: []byte("uploaded again")}
+	s.files["u4"] = fakeFile{parent: "root", name: "Notes", mimeType: "application/vnd.google-apps.document"}
+	fsys := newTestFS(t, s)
+	files["Uploads/O'Brien.jpg"] = []byte("0123456789")
+	files["Uploads/O'Brien (u3).jpg"] = []byte("uploaded again")
+	vfstest.Run(t, fsys, files)
+
+	entries, err := fsys.ReadDir(".")
+	assert.Nil(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.NotContains(t, names, "Notes")
+	entries, err = fsys.ReadDir("Uploads")
+	assert.Nil(t, err)
+	names = nil
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"O'Brien.jpg", "O'Brien (u3).jpg"}, names)
+
+	// Looking up a path that wasn't listed finds its folders by names
+	fsys = newTestFS(t, s)
+	info, err := fsys.Stat("Uploads/O'Brien.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), info.Size())
+	_, known := vfs.Checksum(fsys, "Uploads/O'Brien.jpg", "md5")
+	assert.True(t, known)
+}
+
+// TestFindDuplicatesAcrossDriveAndLocal checks whether duplicates are found within Drive and between Drive and a
+// local directory, without downloading files
+func TestFindDuplicatesAcrossDriveAndLocal(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	s := &fakeDrive{files: map[string]fakeFile{
+		"f1": {parent: "root", name: "Photos", mimeType: mimeTypeFolder},
+		"f2": {parent: "f1", name: "a.jpg", content: content},
+		"f3": {parent: "f1", name: "a.jpg", content: content},
+		"f4": {parent: "f1", name: "b.jpg", content: bytes.Repeat([]byte("different "), 1_000)},
+	}}
+	fsys := newTestFS(t, s)
+	local := t.TempDir()
+	assert.Nil(t, os.WriteFile(local+"/a.jpg", content, 0o644))
+	mux := vfs.NewMux(vfs.Local)
+	mux.Mount("gdrive://root", fsys)
+	fmte.Off()
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(
+		[]string{local, "gdrive://root/Photos"}, service.WithFS(mux), service.WithHasher(service.MD5Hasher{})))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.DuplicateTotalCount)
+	for _, paths := range result.Duplicates.All() {
+		assert.ElementsMatch(t, []string{local + "/a.jpg", "gdrive://root/Photos/a.jpg",
+			"gdrive://root/Photos/a (f3).jpg"}, paths)
+	}
+	assert.Equal(t, 0, s.downloads)
+}
+
+func TestConfigFromURL(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+	u, _ := url.Parse("gdrive://my-drive/Photos")
+	cfg, err := ConfigFromURL(u)
+	assert.Nil(t, err)
+	assert.Equal(t, MyDrive, cfg.Drive)
+	assert.NotNil(t, cfg.TokenSource)
+	u, _ = url.Parse("gdrive://0ABcDeFgHiJkLUk9PVA/Photos")
+	cfg, err = ConfigFromURL(u)
+	assert.Nil(t, err)
+	assert.Equal(t, "0ABcDeFgHiJkLUk9PVA", cfg.Drive)
+}
@@ -0,0 +1,111 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+)
+
+// reservedOpenFiles are as many descriptors as are left, of the limit of the process, for files opened other than
+// by a file system limited by DefaultOpenFilesLimit (such as of caches, reports and connections)
+const reservedOpenFiles = 64
+
+// DefaultOpenFilesLimit is the most files that file systems of this process should have open at once: those that
+// the process may open (by RLIMIT_NOFILE, where there's one), less some that are left for other files. It's 0 if
+// there's no such limit.
+func DefaultOpenFilesLimit() int {
+	n := openFilesLimit()
+	if n <= 0 {
+		return 0
+	}
+	if n <= 2*reservedOpenFiles {
+		return max(1, n/2)
+	}
+	return n - reservedOpenFiles
+}
+
+// LimitOpenFiles returns fsys, of which at most n files (and directories being read) are open at once: opening more
+// waits until others are closed. That way, scans that read very many files concurrently don't fail by "too many open
+// files".
+func LimitOpenFiles(fsys FS, n int) FS {
+	return &limitedFS{FS: fsys, open: make(chan struct{}, n)}
+}
+
+type limitedFS struct {
+	FS
+	// open are turns to have a file open, one per file that's open
+	open chan struct{}
+}
+
+func (l *limitedFS) Open(name string) (fs.File, error) {
+	l.open <- struct{}{}
+	f, err := l.FS.Open(name)
+	if err != nil {
+		<-l.open
+		return nil, err
+	}
+	lf := &limitedFile{File: f, open: l.open}
+	if rf, isRandomAccess := RandomAccess(f); isRandomAccess {
+		return &limitedRandomAccessFile{limitedFile: lf, ra: rf}, nil
+	}
+	return lf, nil
+}
+
+func (l *limitedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	l.open <- struct{}{}
+	defer func() { <-l.open }()
+	return l.FS.ReadDir(name)
+}
+
+// WithContext returns l, of operations of the file system cancelled once ctx is done (see ContextFS). The limit of
+// files open is shared with l.
+func (l *limitedFS) WithContext(ctx context.Context) FS {
+	return &limitedFS{FS: WithContext(l.FS, ctx), open: l.open}
+}
+
+// Checksum returns checksums that the file system knows (see Checksummer)
+func (l *limitedFS) Checksum(name, algorithm string) (string, bool) {
+	return Checksum(l.FS, name, algorithm)
+}
+
+// ID is that of the file system (see Identifier)
+func (l *limitedFS) ID() string {
+	return ID(l.FS)
+}
+
+// ResolveLinks resolves links as the file system does (see LinkResolver)
+func (l *limitedFS) ResolveLinks(name string) (string, error) {
+	r, ok := l.FS.(LinkResolver)
+	if !ok {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: errors.ErrUnsupported}
+	}
+	return r.ResolveLinks(name)
+}
+
+// limitedFile is a file opened by a limitedFS, which gives up its turn once it's closed
+type limitedFile struct {
+	fs.File
+	open   chan struct{}
+	closed sync.Once
+}
+
+func (f *limitedFile) Close() error {
+	err := f.File.Close()
+	f.closed.Do(func() { <-f.open })
+	return err
+}
+
+// limitedRandomAccessFile is a file opened by a limitedFS that supports random access
+type limitedRandomAccessFile struct {
+	*limitedFile
+	ra File
+}
+
+func (f *limitedRandomAccessFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.ra.ReadAt(p, off)
+}
+
+func (f *limitedRandomAccessFile) ReadAtBatch(bufs [][]byte, offsets []int64) error {
+	return ReadAtBatch(f.ra, bufs, offsets)
+}
@@ -0,0 +1,75 @@
+package vfs
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openCountingFS is an FS that records the most files open at once
+type openCountingFS struct {
+	FS
+	open, most atomic.Int64
+}
+
+func (c *openCountingFS) Open(name string) (fs.File, error) {
+	f, err := OpenFile(c.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	n := c.open.Add(1)
+	for most := c.most.Load(); n > most && !c.most.CompareAndSwap(most, n); most = c.most.Load() {
+	}
+	// Files are kept open for a while, so that others are opened meanwhile
+	time.Sleep(time.Millisecond)
+	return &countedFile{File: f, open: &c.open}, nil
+}
+
+type countedFile struct {
+	File
+	open *atomic.Int64
+}
+
+func (f *countedFile) Close() error {
+	f.open.Add(-1)
+	return f.File.Close()
+}
+
+func TestLimitOpenFiles(t *testing.T) {
+	files := fstest.MapFS{}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("%d.txt", i)] = &fstest.MapFile{Data: []byte("contents")}
+	}
+	counting := &openCountingFS{FS: FromFS(files)}
+	fsys := LimitOpenFiles(counting, 3)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := OpenFile(fsys, fmt.Sprintf("%d.txt", i))
+			if !assert.Nil(t, err) {
+				return
+			}
+			buf := make([]byte, 5)
+			_, err = f.ReadAt(buf, 3)
+			assert.Nil(t, err)
+			assert.Equal(t, "tents", string(buf))
+			assert.Nil(t, f.Close())
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, counting.most.Load(), int64(3))
+	assert.Equal(t, int64(0), counting.open.Load())
+	_, err := fsys.Open("missing.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	entries, err := fsys.ReadDir(".")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 20)
+}
@@ -0,0 +1,133 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LinkResolver is implemented by file systems that have symbolic links (and, on Windows, junctions and other
+// reparse points, such as those of OneDrive), which can be resolved to the paths that they lead to
+type LinkResolver interface {
+	// ResolveLinks returns the real path of the named file, which goes through no links
+	ResolveLinks(name string) (string, error)
+}
+
+// ResolveLinks returns the real path of the named file, if links of fsys can be resolved
+func ResolveLinks(fsys FS, name string) (string, bool) {
+	if r, ok := fsys.(LinkResolver); ok {
+		if realPath, err := r.ResolveLinks(name); err == nil {
+			return realPath, true
+		}
+	}
+	return "", false
+}
+
+// IsLink checks whether a file of the mode may be a link. Besides symbolic links, that's irregular files, as which
+// junctions (mount points) and other reparse points are reported on Windows.
+func IsLink(mode fs.FileMode) bool {
+	return mode&(fs.ModeSymlink|fs.ModeIrregular) != 0
+}
+
+// WalkLinkedDir is like WalkDir, but follows root if it's a link (so that root is walked as the directory that it
+// leads to), rather than calling fn with root only
+func WalkLinkedDir(fsys FS, root string, fn fs.WalkDirFunc) error {
+	info, err := fsys.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// maxLinkHops is how many links are resolved for a path before it's taken to be in a loop of links
+const maxLinkHops = 255
+
+var errTooManyLinks = errors.New("too many links")
+
+// ResolveLinks resolves links of every element of the named path. Unlike filepath.EvalSymlinks, it resolves
+// junctions that aren't symbolic links, too.
+func (localFS) ResolveLinks(name string) (string, error) {
+	// Not made absolute by filepath.Abs, which cleans ".." away lexically too
+	abs := name
+	if !filepath.IsAbs(name) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		abs = wd + string(filepath.Separator) + name
+	}
+	volume := filepath.VolumeName(abs)
+	resolved := volume + string(filepath.Separator)
+	rest := abs[len(resolved):]
+	for hops := 0; rest != ""; {
+		var elem string
+		elem, rest = cutElem(rest)
+		if elem == "" || elem == "." {
+			continue
+		}
+		if elem == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		path := filepath.Join(resolved, elem)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		if !IsLink(info.Mode()) {
+			resolved = path
+			continue
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			if info.Mode()&fs.ModeSymlink == 0 {
+				// An irregular file that isn't a link, such as a file deduplicated by Windows
+				resolved = path
+				continue
+			}
+			return "", err
+		}
+		if hops++; hops > maxLinkHops {
+			return "", &fs.PathError{Op: "resolve", Path: name, Err: errTooManyLinks}
+		}
+		if filepath.IsAbs(target) {
+			resolved = filepath.VolumeName(target) + string(filepath.Separator)
+			target = target[len(resolved):]
+		}
+		if rest != "" {
+			// Not joined by filepath.Join either
+			target += string(filepath.Separator) + rest
+		}
+		rest = target
+	}
+	return resolved, nil
+}
+
+// cutElem cuts the first element of a relative path from the rest of it
+func cutElem(path string) (elem, rest string) {
+	for i := 0; i < len(path); i++ {
+		if os.IsPathSeparator(path[i]) {
+			return path[:i], path[i+1:]
+		}
+	}
+	return path, ""
+}
+
+// ResolveLinks returns the real path of the named file, if the file system it's routed to has links
+func (m *Mux) ResolveLinks(name string) (string, error) {
+	fsys, rel := m.route(name)
+	if fsys == nil {
+		return "", m.notMounted("resolve", name)
+	}
+	r, ok := fsys.(LinkResolver)
+	if !ok {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: errors.ErrUnsupported}
+	}
+	return r.ResolveLinks(rel)
+}
@@ -0,0 +1,45 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLinks(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "a", "b", "1.txt"), nil, 0o644))
+	if err := os.Symlink(filepath.Join("a", "b"), filepath.Join(root, "link")); err != nil {
+		t.Skipf("can't create symbolic links: %v", err)
+	}
+	assert.Nil(t, os.Symlink(filepath.Join("..", "link", "1.txt"), filepath.Join(root, "a", "1-link.txt")))
+	assert.Nil(t, os.Symlink("loop", filepath.Join(root, "loop")))
+
+	realPath, ok := ResolveLinks(Local, filepath.Join(root, "a", "1-link.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(root, "a", "b", "1.txt"), realPath)
+	// ".." after a link is of the directory that it leads to
+	sep := string(filepath.Separator)
+	realPath, ok = ResolveLinks(Local, filepath.Join(root, "link")+sep+".."+sep+"b")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(root, "a", "b"), realPath)
+	_, ok = ResolveLinks(Local, filepath.Join(root, "loop"))
+	assert.False(t, ok)
+	_, ok = ResolveLinks(FromFS(os.DirFS(root)), "link")
+	assert.False(t, ok)
+
+	info, err := Local.Lstat(filepath.Join(root, "link"))
+	assert.Nil(t, err)
+	assert.True(t, IsLink(info.Mode()))
+	var walked []string
+	assert.Nil(t, WalkLinkedDir(Local, filepath.Join(root, "link"), func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, filepath.Base(path))
+		return err
+	}))
+	assert.Equal(t, []string{"link", "1.txt"}, walked)
+}
@@ -0,0 +1,232 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Opener opens the file system of a backend (such as a bucket of cloud storage) identified by scheme and host of u.
+// Names the returned FS gets are slash-separated paths within it, with "." being its root.
+type Opener func(u *url.URL) (FS, error)
+
+var (
+	backendsMx sync.RWMutex
+	backends   = map[string]Opener{}
+)
+
+// RegisterBackend makes the backend of a URL scheme (e.g. "s3") available to Mux.OpenURL. It's meant to be called
+// from init functions of packages of backends.
+func RegisterBackend(scheme string, opener Opener) {
+	backendsMx.Lock()
+	defer backendsMx.Unlock()
+	backends[strings.ToLower(scheme)] = opener
+}
+
+// BackendSchemes returns URL schemes of backends registered, sorted
+func BackendSchemes() []string {
+	backendsMx.RLock()
+	defer backendsMx.RUnlock()
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsURL checks whether name is a URL such as s3://bucket/prefix, rather than a path of the local file system
+func IsURL(name string) bool {
+	i := strings.Index(name, "://")
+	if i < 2 {
+		return false
+	}
+	for _, r := range name[:i] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Join joins a name to a directory. Unlike filepath.Join, it keeps "scheme://" of URLs intact.
+func Join(dir, name string) string {
+	if IsURL(dir) {
+		i := strings.Index(dir, "://") + len("://")
+		return dir[:i] + path.Join(dir[i:], name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// Dir returns the directory of name. Unlike filepath.Dir, it keeps "scheme://" of URLs intact.
+func Dir(name string) string {
+	if IsURL(name) {
+		start := strings.Index(name, "://") + len("://")
+		if i := strings.LastIndexByte(name[start:], '/'); i >= 0 {
+			return name[:start+i]
+		}
+		return name
+	}
+	return filepath.Dir(name)
+}
+
+// Rel returns name as a slash-separated path relative to dir, which is a directory it's in
+func Rel(dir, name string) string {
+	rel := strings.TrimPrefix(name, dir)
+	if IsURL(name) {
+		return strings.TrimPrefix(rel, "/")
+	}
+	return filepath.ToSlash(strings.TrimPrefix(rel, string(filepath.Separator)))
+}
+
+// IsIn checks whether name is in directory dir (at any depth)
+func IsIn(dir, name string) bool {
+	if len(name) <= len(dir) || !strings.HasPrefix(name, dir) {
+		return false
+	}
+	isSeparator := func(c byte) bool { return c == '/' || c == filepath.Separator }
+	return isSeparator(dir[len(dir)-1]) || isSeparator(name[len(dir)])
+}
+
+// Mux is an FS that routes names that are URLs to file systems of backends mounted, and all other names to a
+// fallback FS. This lets local directories and remote storage be scanned together.
+type Mux struct {
+	fallback FS
+	// ctx is that of operations on file systems mounted, if it's bound (see WithContext)
+	ctx context.Context
+	// mounts are shared by Muxes bound to other contexts
+	mounts *mounts
+}
+
+type mounts struct {
+	mx sync.RWMutex
+	m  map[string]FS
+}
+
+// NewMux creates a Mux that routes names that aren't URLs of file systems mounted to fallback
+func NewMux(fallback FS) *Mux {
+	return &Mux{fallback: fallback, mounts: &mounts{m: map[string]FS{}}}
+}
+
+// Mount routes names under prefix (of the form scheme://host) to fsys, which gets names relative to prefix
+func (m *Mux) Mount(prefix string, fsys FS) {
+	m.mounts.mx.Lock()
+	defer m.mounts.mx.Unlock()
+	m.mounts.m[strings.TrimSuffix(prefix, "/")] = fsys
+}
+
+// WithContext returns m, of operations on file systems mounted (and on the fallback) cancelled once ctx is done, as
+// far as they support that (see ContextFS). File systems mounted later are shared with m.
+func (m *Mux) WithContext(ctx context.Context) FS {
+	return &Mux{fallback: WithContext(m.fallback, ctx), ctx: ctx, mounts: m.mounts}
+}
+
+// OpenURL mounts the file system of the backend registered for scheme of rawURL (unless one is already mounted for
+// its scheme and host), and returns the name through which the URL is accessed in m
+func (m *Mux) OpenURL(rawURL string) (name string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	backendsMx.RLock()
+	opener, exists := backends[scheme]
+	backendsMx.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("unsupported URL scheme %q (supported: %s)", u.Scheme,
+			strings.Join(BackendSchemes(), ", "))
+	}
+	prefix := scheme + "://" + u.Host
+	m.mounts.mx.RLock()
+	_, mounted := m.mounts.m[prefix]
+	m.mounts.mx.RUnlock()
+	if !mounted {
+		fsys, oErr := opener(u)
+		if oErr != nil {
+			return "", fmt.Errorf("couldn't open %s: %w", u.Redacted(), oErr)
+		}
+		m.Mount(prefix, fsys)
+	}
+	if p := strings.Trim(path.Clean("/"+u.Path), "/"); p != "" {
+		return prefix + "/" + p, nil
+	}
+	return prefix, nil
+}
+
+// route finds the file system and the name within it, of name
+func (m *Mux) route(name string) (FS, string) {
+	if !IsURL(name) {
+		return m.fallback, name
+	}
+	i := strings.Index(name, "://") + len("://")
+	prefix, rest, _ := strings.Cut(name[i:], "/")
+	m.mounts.mx.RLock()
+	fsys, exists := m.mounts.m[strings.ToLower(name[:i])+prefix]
+	m.mounts.mx.RUnlock()
+	if !exists {
+		return nil, name
+	}
+	if m.ctx != nil {
+		fsys = WithContext(fsys, m.ctx)
+	}
+	if rest = strings.Trim(rest, "/"); rest == "" {
+		rest = "."
+	}
+	return fsys, rest
+}
+
+func (m *Mux) notMounted(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("no file system is mounted for it: %w", fs.ErrNotExist)}
+}
+
+func (m *Mux) Open(name string) (fs.File, error) {
+	fsys, rel := m.route(name)
+	if fsys == nil {
+		return nil, m.notMounted("open", name)
+	}
+	return fsys.Open(rel)
+}
+
+func (m *Mux) Stat(name string) (fs.FileInfo, error) {
+	fsys, rel := m.route(name)
+	if fsys == nil {
+		return nil, m.notMounted("stat", name)
+	}
+	return fsys.Stat(rel)
+}
+
+func (m *Mux) Lstat(name string) (fs.FileInfo, error) {
+	fsys, rel := m.route(name)
+	if fsys == nil {
+		return nil, m.notMounted("lstat", name)
+	}
+	return fsys.Lstat(rel)
+}
+
+func (m *Mux) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, rel := m.route(name)
+	if fsys == nil {
+		return nil, m.notMounted("readdir", name)
+	}
+	return fsys.ReadDir(rel)
+}
+
+// Checksum returns the checksum of the named file, if the file system it's routed to knows it
+func (m *Mux) Checksum(name, algorithm string) (string, bool) {
+	fsys, rel := m.route(name)
+	if fsys == nil {
+		return "", false
+	}
+	return Checksum(fsys, rel, algorithm)
+}
+
+// ID is that of the fallback, as names routed to file systems mounted are URLs, which tell their files apart already
+func (m *Mux) ID() string {
+	return ID(m.fallback)
+}
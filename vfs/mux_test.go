@@ -0,0 +1,34 @@
+package vfs
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaths(t *testing.T) {
+	assert.Equal(t, "s3://bucket/repo", Dir("s3://bucket/repo/README.md"))
+	assert.Equal(t, "s3://bucket", Dir("s3://bucket"))
+	assert.Equal(t, "src/main.go", Rel("s3://bucket/repo", "s3://bucket/repo/src/main.go"))
+	assert.Equal(t, "src/main.go", Rel(filepath.Join("/", "repo"), filepath.Join("/", "repo", "src", "main.go")))
+}
+
+func TestIsIn(t *testing.T) {
+	root := filepath.Join("/", "photos")
+	assert.True(t, IsIn(root, filepath.Join(root, "2020", "1.jpg")))
+	assert.False(t, IsIn(root, root))
+	assert.False(t, IsIn(root, root+"-old"))
+	assert.True(t, IsIn(string(filepath.Separator), root))
+	assert.True(t, IsIn("s3://bucket/photos", "s3://bucket/photos/1.jpg"))
+}
+
+// TestID checks whether file systems are identified, through wrappers of them
+func TestID(t *testing.T) {
+	assert.Equal(t, "", ID(Local))
+	assert.Equal(t, "", ID(NewMux(Local)))
+	assert.Equal(t, "", ID(LimitOpenFiles(Local, 4)))
+	assert.Equal(t, "fstest.MapFS", ID(FromFS(fstest.MapFS{})))
+	assert.Equal(t, "fstest.MapFS", ID(NewMux(LimitOpenFiles(FromFS(fstest.MapFS{}), 4))))
+}
@@ -0,0 +1,333 @@
+// Package onedrive is a vfs.FS backend for OneDrive and SharePoint document libraries, through the Microsoft Graph
+// API and URLs of the form onedrive://me/path for the user's own OneDrive (or onedrive://<drive ID>/path for other
+// drives). QuickXorHashes and SHA-256s that OneDrive keeps for files are exposed, so that files needn't be
+// downloaded to be hashed by service.QuickXorHasher (or service.SHA256Hasher).
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/onedrive"
+package onedrive
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("onedrive", func(u *url.URL) (vfs.FS, error) {
+		cfg, err := ConfigFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return New(cfg)
+	})
+}
+
+// Endpoints of Microsoft Graph and Microsoft Entra ID
+const (
+	DefaultEndpoint      = "https://graph.microsoft.com/v1.0"
+	DefaultLoginEndpoint = "https://login.microsoftonline.com"
+)
+
+// MyDrive is the drive of the user whose token is used
+const MyDrive = "me"
+
+// Config is the configuration of a drive
+type Config struct {
+	// Drive is MyDrive, or the ID of a drive (such as a document library of a SharePoint site)
+	Drive string
+	// AccessToken authorizes requests. Alternatively, ClientSecret of app ClientID of tenant TenantID gets access
+	// tokens as they expire (and Drive can't be MyDrive, since there's no user).
+	AccessToken  string
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// Endpoint and LoginEndpoint are URLs of the APIs (default to DefaultEndpoint and DefaultLoginEndpoint)
+	Endpoint      string
+	LoginEndpoint string
+	// HTTPClient makes requests (defaults to objectstore.DefaultHTTPClient)
+	HTTPClient *http.Client
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// ConfigFromURL creates Config for a URL of the form onedrive://me/path, taking credentials from environment
+// variable ONEDRIVE_ACCESS_TOKEN (e.g. from "az account get-access-token --resource-type ms-graph"), or
+// AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET of an app with permission Files.Read.All.
+func ConfigFromURL(u *url.URL) (Config, error) {
+	cfg := Config{
+		Drive:        u.Host,
+		AccessToken:  getenv("ONEDRIVE_ACCESS_TOKEN"),
+		TenantID:     getenv("AZURE_TENANT_ID"),
+		ClientID:     getenv("AZURE_CLIENT_ID"),
+		ClientSecret: getenv("AZURE_CLIENT_SECRET"),
+	}
+	if cfg.AccessToken == "" && cfg.ClientSecret == "" {
+		return cfg, errors.New("ONEDRIVE_ACCESS_TOKEN (or AZURE_CLIENT_SECRET of an app) is needed to access OneDrive")
+	}
+	return cfg, nil
+}
+
+// client is an objectstore.Client of a drive, in which keys are paths of files and "objects" are files
+//
+// See: https://learn.microsoft.com/en-us/graph/api/resources/driveitem
+type client struct {
+	cfg     Config
+	http    *http.Client
+	drive   string
+	mx      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// New creates a file system of a drive
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Drive == "" {
+		return nil, errors.New("drive is missing (it's \"me\" for the user's own OneDrive)")
+	}
+	if cfg.AccessToken == "" && (cfg.TenantID == "" || cfg.ClientID == "") {
+		return nil, errors.New("tenant ID and client ID are needed to get access tokens")
+	}
+	if cfg.AccessToken == "" && cfg.Drive == MyDrive {
+		return nil, errors.New("ID of a drive is needed, since an app has no drive of its own")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	if cfg.LoginEndpoint == "" {
+		cfg.LoginEndpoint = DefaultLoginEndpoint
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	cfg.LoginEndpoint = strings.TrimSuffix(cfg.LoginEndpoint, "/")
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = objectstore.DefaultHTTPClient
+	}
+	drive := cfg.Endpoint + "/me/drive"
+	if cfg.Drive != MyDrive {
+		drive = cfg.Endpoint + "/drives/" + url.PathEscape(cfg.Drive)
+	}
+	return objectstore.New(&client{cfg: cfg, http: httpClient, drive: drive}), nil
+}
+
+// item is metadata of a file or folder, as Microsoft Graph has it. Items that are neither (such as OneNote
+// notebooks) have neither File nor Folder.
+type item struct {
+	Name                 string    `json:"name"`
+	Size                 int64     `json:"size"`
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+	File                 *struct {
+		Hashes struct {
+			QuickXorHash string `json:"quickXorHash"`
+			SHA256Hash   string `json:"sha256Hash"`
+		} `json:"hashes"`
+	} `json:"file"`
+	Folder *struct{} `json:"folder"`
+}
+
+const itemFields = "name,size,lastModifiedDateTime,file,folder"
+
+type listResult struct {
+	Value    []item `json:"value"`
+	NextLink string `json:"@odata.nextLink"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (it item) toObject(k string) objectstore.Object {
+	checksums := map[string]string{}
+	if it.File != nil {
+		if quickXor, err := base64.StdEncoding.DecodeString(it.File.Hashes.QuickXorHash); err == nil &&
+			len(quickXor) > 0 {
+			checksums["quickxor"] = hex.EncodeToString(quickXor)
+		}
+		if it.File.Hashes.SHA256Hash != "" {
+			checksums["sha256"] = strings.ToLower(it.File.Hashes.SHA256Hash)
+		}
+	}
+	return objectstore.Object{Key: k, Size: it.Size, ModTime: it.LastModifiedDateTime, Checksums: checksums,
+		IsDir: it.Folder != nil}
+}
+
+// itemURL is the URL of the item at key k, followed by suffix (such as "/children")
+func (c *client) itemURL(k, suffix string) string {
+	if k == "" {
+		return c.drive + "/root" + suffix
+	}
+	segments := strings.Split(k, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	// Path-based addressing needs a colon after the path, if anything follows it
+	return c.drive + "/root:/" + strings.Join(segments, "/") + ":" + suffix
+}
+
+// accessToken returns the access token, getting a new one of the app if it has expired
+func (c *client) accessToken(ctx context.Context) (string, error) {
+	if c.cfg.AccessToken != "" {
+		return c.cfg.AccessToken, nil
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {c.cfg.ClientID},
+		"client_secret": {c.cfg.ClientSecret}, "scope": {"https://graph.microsoft.com/.default"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.cfg.LoginEndpoint+"/"+url.PathEscape(c.cfg.TenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tr struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&tr)
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return "", fmt.Errorf("couldn't get access token: %s %s", resp.Status, tr.ErrorDescription)
+	}
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+	c.token, c.expires = tr.AccessToken, time.Now().Add(lifetime-time.Minute)
+	return c.token, nil
+}
+
+// get sends a GET request for URL u. Downloads are redirected to URLs that need no authorization, and keep header
+// Range.
+func (c *client) get(ctx context.Context, u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError converts an unsuccessful response to an error
+func responseError(resp *http.Response) error {
+	return objectstore.ResponseError(resp, func(body []byte) string {
+		var er errorResponse
+		_ = json.Unmarshal(body, &er)
+		return er.Error.Message
+	})
+}
+
+// decode decodes the JSON body of a response
+func decode(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("couldn't parse response of Microsoft Graph: %w", err)
+	}
+	return nil
+}
+
+// ID identifies the drive
+func (c *client) ID() string {
+	return "onedrive://" + c.cfg.Drive
+}
+
+func (c *client) List(ctx context.Context, prefix string, limit int, fn func([]objectstore.Object, []string) bool) error {
+	query := url.Values{"$select": {itemFields}, "$top": {"1000"}}
+	if limit > 0 {
+		query.Set("$top", strconv.Itoa(min(limit, 1000)))
+	}
+	next := c.itemURL(strings.TrimSuffix(prefix, "/"), "/children") + "?" + query.Encode()
+	for next != "" {
+		resp, err := c.get(ctx, next, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		if err := decode(resp, &result); err != nil {
+			return err
+		}
+		var objects []objectstore.Object
+		var prefixes []string
+		for _, it := range result.Value {
+			switch {
+			case it.Folder != nil:
+				prefixes = append(prefixes, prefix+it.Name+"/")
+			case it.File != nil:
+				objects = append(objects, it.toObject(prefix+it.Name))
+			}
+		}
+		if !fn(objects, prefixes) {
+			return nil
+		}
+		next = result.NextLink
+	}
+	return nil
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	resp, err := c.get(ctx, c.itemURL(k, "")+"?"+url.Values{"$select": {itemFields}}.Encode(), nil)
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	var it item
+	if err := decode(resp, &it); err != nil {
+		return objectstore.Object{}, err
+	}
+	if it.File == nil && it.Folder == nil {
+		return objectstore.Object{}, fmt.Errorf("%q is neither a file nor a folder: %w", k, fs.ErrNotExist)
+	}
+	return it.toObject(k), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rng := objectstore.RangeHeader(offset, length); rng != "" {
+		header.Set("Range", rng)
+	}
+	resp, err := c.get(ctx, c.itemURL(k, "/content"), header)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.RangeBody(resp, offset, length)
+}
@@ -0,0 +1,276 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/m-manu/go-find-duplicates/vfs/vfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGraph serves files of drive "me" (and of drive "b!library") through Microsoft Graph. Listings have one item
+// per page, and downloads are redirected. Files whose names end with ".one" are OneNote notebooks.
+type fakeGraph struct {
+	files     map[string][]byte
+	url       string
+	mx        sync.Mutex
+	downloads int
+}
+
+func (s *fakeGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/tenant/oauth2/v2.0/token" {
+		_ = r.ParseForm()
+		if r.Form.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"error":"invalid_client","error_description":"Invalid client secret provided."}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"access_token":"token","token_type":"Bearer","expires_in":3599}`)
+		return
+	}
+	if name, isDownload := strings.CutPrefix(r.URL.Path, "/download/"); isDownload {
+		s.mx.Lock()
+		s.downloads++
+		s.mx.Unlock()
+		content := s.files[name]
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			_, _ = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[start : end+1])
+			return
+		}
+		_, _ = w.Write(content)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		s.fail(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Access token has expired.")
+		return
+	}
+	rest, found := strings.CutPrefix(r.URL.Path, "/v1.0/me/drive/root")
+	if !found {
+		rest, found = strings.CutPrefix(r.URL.Path, "/v1.0/drives/b!library/root")
+	}
+	if !found {
+		s.fail(w, http.StatusBadRequest, "invalidRequest", "Invalid request")
+		return
+	}
+	name, suffix := "", rest
+	if p, isPath := strings.CutPrefix(rest, ":/"); isPath {
+		name, suffix, _ = strings.Cut(p, ":")
+	}
+	content, isFile := s.files[name]
+	children := s.children(name)
+	if !isFile && children == nil {
+		s.fail(w, http.StatusNotFound, "itemNotFound", "The resource could not be found.")
+		return
+	}
+	switch suffix {
+	case "":
+		_ = json.NewEncoder(w).Encode(s.item(name, content, isFile))
+	case "/children":
+		page, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+		result := map[string]any{"value": children[page : page+1]}
+		if page+1 < len(children) {
+			query := r.URL.Query()
+			query.Set("$skiptoken", strconv.Itoa(page+1))
+			result["@odata.nextLink"] = s.url + r.URL.Path + "?" + query.Encode()
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	case "/content":
+		http.Redirect(w, r, s.url+"/download/"+url.PathEscape(name), http.StatusFound)
+	}
+}
+
+func (s *fakeGraph) fail(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `{"error":{"code":%q,"message":%q}}`, code, message)
+}
+
+func (s *fakeGraph) item(name string, content []byte, isFile bool) map[string]any {
+	it := map[string]any{"name": name[strings.LastIndex(name, "/")+1:], "lastModifiedDateTime": "2023-11-14T22:13:20Z"}
+	switch {
+	case strings.HasSuffix(name, ".one"):
+		it["package"] = map[string]any{"type": "oneNote"}
+	case isFile:
+		h := &quickXor{}
+		_, _ = h.Write(content)
+		it["size"] = len(content)
+		it["file"] = map[string]any{"mimeType": "image/jpeg", "hashes": map[string]any{
+			"quickXorHash": base64.StdEncoding.EncodeToString(h.sum(len(content)))}}
+	default:
+		it["folder"] = map[string]any{"childCount": len(s.children(name))}
+	}
+	return it
+}
+
+// children returns items in the folder at name, or nil if there's no such folder
+func (s *fakeGraph) children(dir string) []map[string]any {
+	folders := map[string]bool{}
+	var names []string
+	for k := range s.files {
+		rest, found := strings.CutPrefix(k, dir+"/")
+		if dir == "" {
+			rest, found = k, true
+		}
+		if !found {
+			continue
+		}
+		child, _, isDir := strings.Cut(rest, "/")
+		if !isDir || !folders[child] {
+			folders[child] = isDir
+			names = append(names, strings.TrimPrefix(dir+"/"+child, "/"))
+		}
+	}
+	sort.Strings(names)
+	var children []map[string]any
+	for _, name := range names {
+		content, isFile := s.files[name]
+		children = append(children, s.item(name, content, isFile))
+	}
+	return children
+}
+
+// quickXor is QuickXorHash as the reference implementation computes it, of contents written at once
+type quickXor struct {
+	cells [3]uint64
+	shift int
+}
+
+func (q *quickXor) Write(p []byte) (int, error) {
+	for i := 0; i < min(len(p), 160); i++ {
+		cell, offset := q.shift/64, q.shift%64
+		bits := 64
+		if cell == 2 {
+			bits = 32
+		}
+		var xored byte
+		for j := i; j < len(p); j += 160 {
+			xored ^= p[j]
+		}
+		q.cells[cell] ^= uint64(xored) << offset
+		if offset > bits-8 {
+			q.cells[(cell+1)%3] ^= uint64(xored) >> (bits - offset)
+		}
+		q.shift = (q.shift + 11) % 160
+	}
+	q.shift = 0
+	return len(p), nil
+}
+
+func (q *quickXor) sum(length int) []byte {
+	sum := make([]byte, 24)
+	for i, cell := range q.cells {
+		for j := 0; j < 8; j++ {
+			sum[i*8+j] = byte(cell >> (8 * j))
+		}
+	}
+	for j := 0; j < 8; j++ {
+		sum[12+j] ^= byte(uint64(length) >> (8 * j))
+	}
+	return sum[:20]
+}
+
+func newTestFS(t *testing.T, s *fakeGraph, cfg Config) vfs.FS {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	s.url = server.URL
+	cfg.Endpoint, cfg.LoginEndpoint = server.URL+"/v1.0", server.URL
+	fsys, err := New(cfg)
+	assert.Nil(t, err)
+	return fsys
+}
+
+// TestFS checks whether folders can be listed, and files looked up and read (see vfstest.Run), and whether apps get
+// access tokens
+func TestFS(t *testing.T) {
+	files := vfstest.Files()
+	files["Photos/a b#1.jpg"] = []byte("0123456789")
+	s := &fakeGraph{files: maps.Clone(files)}
+	s.files["Notebooks/Work.one"] = nil
+	fsys := newTestFS(t, s, Config{Drive: MyDrive, AccessToken: "token"})
+	vfstest.Run(t, fsys, files)
+
+	// Notebooks of OneNote, which are packages rather than files, are left out
+	entries, err := fsys.ReadDir("Notebooks")
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	info, err := fsys.Stat("Photos/a b#1.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC), info.ModTime())
+	_, known := vfs.Checksum(fsys, "readme.txt", "quickxor")
+	assert.True(t, known)
+
+	// Apps get access tokens with their secrets
+	fsys = newTestFS(t, s, Config{Drive: "b!library", TenantID: "tenant", ClientID: "app", ClientSecret: "secret"})
+	_, err = fsys.Stat("readme.txt")
+	assert.Nil(t, err)
+	fsys = newTestFS(t, s, Config{Drive: "b!library", TenantID: "tenant", ClientID: "app", ClientSecret: "wrong"})
+	_, err = fsys.Stat("readme.txt")
+	assert.ErrorContains(t, err, "Invalid client secret provided")
+	fsys = newTestFS(t, s, Config{Drive: MyDrive, AccessToken: "expired"})
+	_, err = fsys.ReadDir(".")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
+
+// TestFindDuplicatesAcrossOneDriveAndLocal checks whether duplicates are found between OneDrive and a local
+// directory, without downloading files (and so whether service.QuickXorHasher agrees with OneDrive)
+func TestFindDuplicatesAcrossOneDriveAndLocal(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	s := &fakeGraph{files: map[string][]byte{
+		"Photos/a.jpg":      content,
+		"Photos/b.jpg":      bytes.Repeat([]byte("different "), 1_000),
+		"Photos/2023/c.jpg": content,
+	}}
+	fsys := newTestFS(t, s, Config{Drive: MyDrive, AccessToken: "token"})
+	local := t.TempDir()
+	assert.Nil(t, os.WriteFile(local+"/a.jpg", content, 0o644))
+	mux := vfs.NewMux(vfs.Local)
+	mux.Mount("onedrive://me", fsys)
+	fmte.Off()
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(
+		[]string{local, "onedrive://me/Photos"}, service.WithFS(mux), service.WithHasher(service.QuickXorHasher{})))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.DuplicateTotalCount)
+	for _, paths := range result.Duplicates.All() {
+		assert.ElementsMatch(t, []string{local + "/a.jpg", "onedrive://me/Photos/a.jpg",
+			"onedrive://me/Photos/2023/c.jpg"}, paths)
+	}
+	assert.Equal(t, 0, s.downloads)
+}
+
+func TestConfigFromURL(t *testing.T) {
+	defer func(old func(string) string) { getenv = old }(getenv)
+	env := map[string]string{}
+	getenv = func(name string) string { return env[name] }
+	u, _ := url.Parse("onedrive://me/Photos")
+	_, err := ConfigFromURL(u)
+	assert.NotNil(t, err)
+	env = map[string]string{"AZURE_TENANT_ID": "tenant", "AZURE_CLIENT_ID": "app", "AZURE_CLIENT_SECRET": "secret"}
+	u, _ = url.Parse("onedrive://b!library/Shared Documents")
+	cfg, err := ConfigFromURL(u)
+	assert.Nil(t, err)
+	assert.Equal(t, Config{Drive: "b!library", TenantID: "tenant", ClientID: "app", ClientSecret: "secret"}, cfg)
+	cfg.Drive = MyDrive
+	_, err = New(cfg)
+	assert.ErrorContains(t, err, "ID of a drive is needed")
+}
@@ -0,0 +1,240 @@
+// Package rclone is a vfs.FS backend for remotes configured in rclone (Google Drive, Dropbox, Mega, Backblaze B2
+// and dozens of others), through URLs of the form rclone://remote/path for what rclone calls remote:path. It runs
+// the rclone executable, which must be installed. Hashes that remotes have for files are exposed as checksums, so
+// that files needn't be downloaded to be hashed by a hasher of the same algorithm (e.g. service.MD5Hasher).
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/rclone"
+package rclone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("rclone", func(u *url.URL) (vfs.FS, error) {
+		return New(ConfigFromURL(u))
+	})
+}
+
+// hashNames maps names of hashes of rclone to names of hashers of package service
+var hashNames = map[string]string{"md5": "md5", "sha256": "sha256", "crc32": "crc32", "dropbox": "dropbox",
+	"quickxor": "quickxor"}
+
+// Exit codes of rclone for files and directories that don't exist
+//
+// See: https://rclone.org/docs/#exit-code
+const (
+	exitDirNotFound  = 3
+	exitFileNotFound = 4
+)
+
+// Config is the configuration of a remote
+type Config struct {
+	// Remote is the name of a remote in the configuration file of rclone
+	Remote string
+	// Executable is the path of rclone (defaults to "rclone", which is looked up in PATH)
+	Executable string
+	// Args are passed to every run of rclone, before those of the command (e.g. "--config", "path")
+	Args []string
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// ConfigFromURL creates Config for a URL of the form rclone://remote/path. Environment variable RCLONE_EXECUTABLE
+// can be the path of rclone, if it isn't in PATH. (rclone itself takes RCLONE_CONFIG and such from the
+// environment.)
+func ConfigFromURL(u *url.URL) Config {
+	return Config{Remote: u.Host, Executable: getenv("RCLONE_EXECUTABLE")}
+}
+
+// client is an objectstore.Client of a remote, in which keys are paths within the remote and "objects" are files
+type client struct {
+	cfg Config
+}
+
+// New creates a file system of a remote
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Remote == "" {
+		return nil, errors.New("name of remote is missing")
+	}
+	if cfg.Executable == "" {
+		cfg.Executable = "rclone"
+	}
+	if _, err := exec.LookPath(cfg.Executable); err != nil {
+		return nil, fmt.Errorf("rclone needs to be installed (see https://rclone.org/install/): %w", err)
+	}
+	return objectstore.New(&client{cfg: cfg}), nil
+}
+
+// entry is an entry of output of "rclone lsjson"
+type entry struct {
+	Name    string            `json:"Name"`
+	Size    int64             `json:"Size"`
+	ModTime time.Time         `json:"ModTime"`
+	IsDir   bool              `json:"IsDir"`
+	Hashes  map[string]string `json:"Hashes"`
+}
+
+func (e entry) toObject(k string) objectstore.Object {
+	checksums := map[string]string{}
+	for name, value := range e.Hashes {
+		if hasher, known := hashNames[name]; known && value != "" {
+			checksums[hasher] = strings.ToLower(value)
+		}
+	}
+	return objectstore.Object{Key: k, Size: e.Size, ModTime: e.ModTime, IsDir: e.IsDir, Checksums: checksums}
+}
+
+// command creates a run of rclone with args, on the file or directory at key k
+func (c *client) command(ctx context.Context, k string, args ...string) *exec.Cmd {
+	args = append(append(append([]string(nil), c.cfg.Args...), args...), c.cfg.Remote+":"+k)
+	return exec.CommandContext(ctx, c.cfg.Executable, args...)
+}
+
+// run runs rclone with args on the file or directory at key k, and returns its output
+func (c *client) run(ctx context.Context, k string, args ...string) ([]byte, error) {
+	cmd := c.command(ctx, k, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, runError(err, stderr.String())
+	}
+	return out, nil
+}
+
+// runError converts an error of running rclone to errors that fs.ErrNotExist matches, if that's why it failed
+func runError(err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	msg := strings.TrimSpace(stderr)
+	if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+		msg = msg[i+1:]
+	}
+	switch exitErr.ExitCode() {
+	case exitDirNotFound, exitFileNotFound:
+		return fmt.Errorf("rclone: %s: %w", msg, fs.ErrNotExist)
+	default:
+		return fmt.Errorf("rclone failed (exit code %d): %s", exitErr.ExitCode(), msg)
+	}
+}
+
+// ID identifies the remote
+func (c *client) ID() string {
+	return "rclone://" + c.cfg.Remote
+}
+
+func (c *client) List(ctx context.Context, prefix string, _ int, fn func([]objectstore.Object, []string) bool) error {
+	out, err := c.run(ctx, strings.TrimSuffix(prefix, "/"), "lsjson", "--hash", "--no-mimetype")
+	if err != nil {
+		return err
+	}
+	var entries []entry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return fmt.Errorf("couldn't parse output of rclone: %w", err)
+	}
+	var objects []objectstore.Object
+	var prefixes []string
+	for _, e := range entries {
+		if e.IsDir {
+			prefixes = append(prefixes, prefix+e.Name+"/")
+		} else {
+			objects = append(objects, e.toObject(prefix+e.Name))
+		}
+	}
+	fn(objects, prefixes)
+	return nil
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	out, err := c.run(ctx, k, "lsjson", "--stat", "--hash", "--no-mimetype")
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	var e entry
+	if err := json.Unmarshal(out, &e); err != nil {
+		return objectstore.Object{}, fmt.Errorf("couldn't parse output of rclone: %w", err)
+	}
+	return e.toObject(k), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	args := []string{"cat"}
+	if offset > 0 {
+		args = append(args, "--offset", strconv.FormatInt(offset, 10))
+	}
+	if length >= 0 {
+		args = append(args, "--count", strconv.FormatInt(length, 10))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := c.command(ctx, k, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &catReader{ReadCloser: stdout, cmd: cmd, cancel: cancel, stderr: &stderr}, nil
+}
+
+// catReader is the output of "rclone cat". Errors of rclone are returned once the output ends, and by every read
+// after it, as the output is closed by then.
+type catReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stderr *bytes.Buffer
+	done   bool
+	err    error
+}
+
+func (r *catReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.done, r.err = true, io.EOF
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			r.err = runError(waitErr, r.stderr.String())
+		}
+		r.cancel()
+		return n, r.err
+	}
+	return n, err
+}
+
+// Close stops rclone, if it's still running
+func (r *catReader) Close() error {
+	if !r.done {
+		r.done, r.err = true, fs.ErrClosed
+		r.cancel()
+		_ = r.cmd.Wait()
+	}
+	return nil
+}
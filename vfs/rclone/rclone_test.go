@@ -0,0 +1,160 @@
+package rclone
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/m-manu/go-find-duplicates/fmte"
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/m-manu/go-find-duplicates/vfs/vfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain makes the test binary act as rclone when environment variable FAKE_RCLONE_ROOT is set, serving the
+// directory it names as remote "fake"
+func TestMain(m *testing.M) {
+	if root := os.Getenv("FAKE_RCLONE_ROOT"); root != "" {
+		os.Exit(fakeRclone(root, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeRclone implements commands lsjson and cat, with the exit codes of rclone. Files with ".nohash" in their names
+// have no MD5.
+func fakeRclone(root string, args []string) int {
+	remote, p, _ := strings.Cut(args[len(args)-1], ":")
+	if remote != "fake" {
+		fmt.Fprintf(os.Stderr, "didn't find section in config file (%q)\n", remote)
+		return 1
+	}
+	name := filepath.Join(root, filepath.FromSlash(p))
+	info, err := os.Stat(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR : %s: object not found\n", p)
+		return exitFileNotFound
+	}
+	flags := map[string]string{}
+	for i := 1; i < len(args)-1; i++ {
+		if i+1 < len(args)-1 && (args[i] == "--offset" || args[i] == "--count") {
+			flags[args[i]] = args[i+1]
+			i++
+		} else {
+			flags[args[i]] = ""
+		}
+	}
+	switch args[0] {
+	case "lsjson":
+		if _, stat := flags["--stat"]; stat {
+			_ = json.NewEncoder(os.Stdout).Encode(fakeEntry(name, info))
+			return 0
+		}
+		if !info.IsDir() {
+			return exitDirNotFound
+		}
+		dirEntries, _ := os.ReadDir(name)
+		entries := []entry{}
+		for _, de := range dirEntries {
+			childInfo, _ := de.Info()
+			entries = append(entries, fakeEntry(filepath.Join(name, de.Name()), childInfo))
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(entries)
+	case "cat":
+		data, _ := os.ReadFile(name)
+		offset, _ := strconv.Atoi(flags["--offset"])
+		data = data[offset:]
+		if count, set := flags["--count"]; set {
+			n, _ := strconv.Atoi(count)
+			data = data[:n]
+		}
+		_, _ = os.Stdout.Write(data)
+	}
+	return 0
+}
+
+func fakeEntry(name string, info fs.FileInfo) entry {
+	e := entry{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime(), IsDir: info.IsDir()}
+	if !info.IsDir() && !strings.Contains(name, ".nohash") {
+		data, _ := os.ReadFile(name)
+		sum := md5.Sum(data)
+		e.Hashes = map[string]string{"md5": hex.EncodeToString(sum[:]), "sha1": "ignored"}
+	}
+	if info.IsDir() {
+		e.Size = -1
+	}
+	return e
+}
+
+func newTestFS(t *testing.T, files map[string][]byte) vfs.FS {
+	root := t.TempDir()
+	for name, data := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(root, name), data, 0o644))
+	}
+	t.Setenv("FAKE_RCLONE_ROOT", root)
+	executable, err := os.Executable()
+	assert.Nil(t, err)
+	fsys, err := New(Config{Remote: "fake", Executable: executable})
+	assert.Nil(t, err)
+	return fsys
+}
+
+// TestFS checks whether directories of a remote can be listed, and files looked up and read (see vfstest.Run)
+func TestFS(t *testing.T) {
+	files := vfstest.Files()
+	files["Other/x.nohash"] = []byte("x")
+	fsys := newTestFS(t, files)
+	vfstest.Run(t, fsys, files)
+
+	_, known := vfs.Checksum(fsys, "readme.txt", "md5")
+	assert.True(t, known)
+	_, known = vfs.Checksum(fsys, "Other/x.nohash", "md5")
+	assert.False(t, known)
+
+	executable, _ := os.Executable()
+	fsys, _ = New(Config{Remote: "unknown", Executable: executable})
+	_, err := fsys.ReadDir(".")
+	assert.ErrorContains(t, err, "didn't find section in config file")
+	_, err = New(Config{Remote: "fake", Executable: filepath.Join(t.TempDir(), "rclone")})
+	assert.ErrorContains(t, err, "rclone needs to be installed")
+}
+
+// TestFindDuplicatesAcrossRemoteAndLocal checks whether duplicates are found between a remote and a local
+// directory
+func TestFindDuplicatesAcrossRemoteAndLocal(t *testing.T) {
+	content := bytes.Repeat([]byte("duplicate "), 1_000)
+	fsys := newTestFS(t, map[string][]byte{
+		"Photos/a.jpg":        content,
+		"Photos/b.jpg":        bytes.Repeat([]byte("different "), 1_000),
+		"Photos/c.nohash.jpg": content,
+	})
+	local := t.TempDir()
+	assert.Nil(t, os.WriteFile(local+"/a.jpg", content, 0o644))
+	mux := vfs.NewMux(vfs.Local)
+	mux.Mount("rclone://fake", fsys)
+	fmte.Off()
+	result, err := service.FindDuplicates(context.Background(), service.NewOptions(
+		[]string{local, "rclone://fake/Photos"}, service.WithFS(mux), service.WithHasher(service.MD5Hasher{})))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.DuplicateTotalCount)
+	for _, paths := range result.Duplicates.All() {
+		assert.ElementsMatch(t, []string{local + "/a.jpg", "rclone://fake/Photos/a.jpg",
+			"rclone://fake/Photos/c.nohash.jpg"}, paths)
+	}
+}
+
+func TestConfigFromURL(t *testing.T) {
+	u, _ := url.Parse("rclone://my_drive/Photos/2023")
+	assert.Equal(t, "my_drive", ConfigFromURL(u).Remote)
+}
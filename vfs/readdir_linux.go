@@ -0,0 +1,111 @@
+//go:build linux
+
+package vfs
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readDirBufferSize is the size of the buffer that entries of a directory are read into by a system call each. It's
+// larger than that of os.ReadDir, so that directories of very many entries are read by fewer system calls.
+const readDirBufferSize = 64 * 1024
+
+// Offsets of fields of struct linux_dirent64, as in getdents(2)
+const (
+	direntReclen = 16
+	direntType   = 18
+	direntName   = 19
+)
+
+// readDir reads the named directory by getdents(2), returning its entries sorted by name. Types of entries are
+// those of the directory (d_type), so that entries aren't statted, unless the file system doesn't report them.
+func readDir(name string) ([]fs.DirEntry, error) {
+	fd, err := unix.Open(name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer unix.Close(fd)
+	buf := make([]byte, readDirBufferSize)
+	var entries []fs.DirEntry
+	for {
+		n, err := unix.Getdents(fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return entries, &fs.PathError{Op: "readdirent", Path: name, Err: err}
+		}
+		if n <= 0 {
+			break
+		}
+		for b := buf[:n]; len(b) > direntName; {
+			reclen := int(binary.NativeEndian.Uint16(b[direntReclen:]))
+			if reclen <= direntName || reclen > len(b) {
+				break
+			}
+			entryName := string(b[direntName:reclen])
+			if i := strings.IndexByte(entryName, 0); i >= 0 {
+				entryName = entryName[:i]
+			}
+			typ := b[direntType]
+			b = b[reclen:]
+			if entryName == "." || entryName == ".." {
+				continue
+			}
+			entry := &dirEntry{dir: name, name: entryName}
+			if mode, known := direntModes[typ]; known {
+				entry.typ = mode
+			} else {
+				info, err := os.Lstat(entry.path())
+				if err != nil {
+					// Removed since being read, as os.ReadDir takes it
+					continue
+				}
+				entry.typ, entry.info = info.Mode().Type(), info
+			}
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// direntModes are types of files of d_type, other than DT_UNKNOWN
+var direntModes = map[uint8]fs.FileMode{
+	unix.DT_REG:  0,
+	unix.DT_DIR:  fs.ModeDir,
+	unix.DT_LNK:  fs.ModeSymlink,
+	unix.DT_FIFO: fs.ModeNamedPipe,
+	unix.DT_SOCK: fs.ModeSocket,
+	unix.DT_CHR:  fs.ModeDevice | fs.ModeCharDevice,
+	unix.DT_BLK:  fs.ModeDevice,
+}
+
+// dirEntry is an entry of a directory read by readDir, which is statted by Info
+type dirEntry struct {
+	dir, name string
+	typ       fs.FileMode
+	info      fs.FileInfo
+}
+
+func (e *dirEntry) path() string {
+	return filepath.Join(e.dir, e.name)
+}
+
+func (e *dirEntry) Name() string      { return e.name }
+func (e *dirEntry) IsDir() bool       { return e.typ.IsDir() }
+func (e *dirEntry) Type() fs.FileMode { return e.typ }
+func (e *dirEntry) String() string    { return fs.FormatDirEntry(e) }
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.info != nil {
+		return e.info, nil
+	}
+	return os.Lstat(e.path())
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+
+package vfs
+
+import (
+	"io/fs"
+	"os"
+)
+
+// readDir reads the named directory, returning its entries sorted by name
+func readDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
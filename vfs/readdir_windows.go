@@ -0,0 +1,148 @@
+//go:build windows
+
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Arguments of FindFirstFileExW, as in fileapi.h
+const (
+	// findExInfoBasic is FindExInfoBasic, by which short names of files aren't looked up
+	findExInfoBasic = 1
+	// findExSearchNameMatch is FindExSearchNameMatch
+	findExSearchNameMatch = 0
+	// findFirstExLargeFetch is FIND_FIRST_EX_LARGE_FETCH, by which entries are read by larger buffers
+	findFirstExLargeFetch = 2
+)
+
+var procFindFirstFileExW = windows.NewLazySystemDLL("kernel32.dll").NewProc("FindFirstFileExW")
+
+// findData is WIN32_FIND_DATAW, as FindFirstFileExW writes it
+type findData struct {
+	FileAttributes    uint32
+	CreationTime      windows.Filetime
+	LastAccessTime    windows.Filetime
+	LastWriteTime     windows.Filetime
+	FileSizeHigh      uint32
+	FileSizeLow       uint32
+	Reserved0         uint32
+	Reserved1         uint32
+	FileName          [windows.MAX_PATH]uint16
+	AlternateFileName [14]uint16
+}
+
+// readDir reads the named directory by FindFirstFileExW, returning its entries sorted by name. Sizes and times of
+// files are those of the directory, so that entries aren't statted (except for reparse points, such as links, whose
+// types only os.Lstat tells). Like those of dir, they may lag behind those of files still being written to. It falls
+// back to os.ReadDir where FindFirstFileExW fails, such as for long paths.
+func readDir(name string) ([]fs.DirEntry, error) {
+	pattern, err := windows.UTF16PtrFromString(filepath.Join(name, "*"))
+	if err != nil {
+		return os.ReadDir(name)
+	}
+	var data findData
+	r, _, err := procFindFirstFileExW.Call(uintptr(unsafe.Pointer(pattern)), findExInfoBasic,
+		uintptr(unsafe.Pointer(&data)), findExSearchNameMatch, 0, findFirstExLargeFetch)
+	handle := windows.Handle(r)
+	if handle == windows.InvalidHandle {
+		return os.ReadDir(name)
+	}
+	defer windows.FindClose(handle)
+	var entries []fs.DirEntry
+	add := func(entryName string, data syscall.Win32FileAttributeData) {
+		if entryName == "." || entryName == ".." {
+			return
+		}
+		entry := &dirEntry{dir: name, name: entryName}
+		attributes := data.FileAttributes
+		if attributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+			info, err := os.Lstat(entry.path())
+			if err != nil {
+				return
+			}
+			entry.info = info
+		} else {
+			mode := fs.FileMode(0o666)
+			if attributes&windows.FILE_ATTRIBUTE_READONLY != 0 {
+				mode = 0o444
+			}
+			if attributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0 {
+				mode |= fs.ModeDir | 0o111
+			}
+			entry.info = &findInfo{name: entryName, size: int64(data.FileSizeHigh)<<32 | int64(data.FileSizeLow),
+				mode: mode, modTime: time.Unix(0, data.LastWriteTime.Nanoseconds()), sys: data}
+		}
+		entries = append(entries, entry)
+	}
+	add(windows.UTF16ToString(data.FileName[:]), attributeData(data.FileAttributes, data.CreationTime,
+		data.LastAccessTime, data.LastWriteTime, data.FileSizeHigh, data.FileSizeLow))
+	for {
+		var next windows.Win32finddata
+		if err := windows.FindNextFile(handle, &next); err != nil {
+			if errors.Is(err, windows.ERROR_NO_MORE_FILES) {
+				break
+			}
+			return entries, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		add(windows.UTF16ToString(next.FileName[:]), attributeData(next.FileAttributes, next.CreationTime,
+			next.LastAccessTime, next.LastWriteTime, next.FileSizeHigh, next.FileSizeLow))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// attributeData is the syscall.Win32FileAttributeData of a file found, which os.Lstat would return by Sys
+func attributeData(attributes uint32, created, accessed, written windows.Filetime, sizeHigh, sizeLow uint32,
+) syscall.Win32FileAttributeData {
+	return syscall.Win32FileAttributeData{
+		FileAttributes: attributes,
+		CreationTime:   syscall.Filetime(created),
+		LastAccessTime: syscall.Filetime(accessed),
+		LastWriteTime:  syscall.Filetime(written),
+		FileSizeHigh:   sizeHigh,
+		FileSizeLow:    sizeLow,
+	}
+}
+
+// dirEntry is an entry of a directory read by readDir, whose metadata is known from reading it
+type dirEntry struct {
+	dir, name string
+	info      fs.FileInfo
+}
+
+func (e *dirEntry) path() string {
+	return filepath.Join(e.dir, e.name)
+}
+
+func (e *dirEntry) Name() string               { return e.name }
+func (e *dirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e *dirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e *dirEntry) String() string             { return fs.FormatDirEntry(e) }
+func (e *dirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// findInfo is the fs.FileInfo of a file found by FindFirstFileExW
+type findInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     syscall.Win32FileAttributeData
+}
+
+func (f *findInfo) Name() string       { return f.name }
+func (f *findInfo) Size() int64        { return f.size }
+func (f *findInfo) Mode() fs.FileMode  { return f.mode }
+func (f *findInfo) ModTime() time.Time { return f.modTime }
+func (f *findInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f *findInfo) Sys() any           { return &f.sys }
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package vfs
+
+// openFilesLimit is 0, since the process has no limit of files open that's known (on Windows, handles are limited
+// only by memory)
+func openFilesLimit() int {
+	return 0
+}
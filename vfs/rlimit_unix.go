@@ -0,0 +1,19 @@
+//go:build unix
+
+package vfs
+
+import (
+	"math"
+
+	"golang.org/x/sys/unix"
+)
+
+// openFilesLimit is the (soft) limit of files the process may have open, or 0 if there's none. The Go runtime raises
+// it to the hard limit at startup, where it can.
+func openFilesLimit() int {
+	var r unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &r); err != nil || uint64(r.Cur) > math.MaxInt32 {
+		return 0
+	}
+	return int(r.Cur)
+}
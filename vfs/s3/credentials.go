@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials are AWS credentials
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is needed only for temporary credentials
+	SessionToken string
+}
+
+// getenv is os.Getenv, replaceable in tests
+var getenv = os.Getenv
+
+// CredentialsFromEnv gets credentials from environment variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN or, if those aren't set, from the profile named by AWS_PROFILE (or "default") in the shared
+// credentials file of AWS CLI
+func CredentialsFromEnv() Credentials {
+	c := Credentials{
+		AccessKeyID:     getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.AccessKeyID != "" {
+		return c
+	}
+	credentialsFile := getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return c
+		}
+		credentialsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := firstNonEmpty(getenv("AWS_PROFILE"), "default")
+	c, _ = readCredentialsFile(credentialsFile, profile)
+	return c
+}
+
+// readCredentialsFile reads credentials of a profile in a shared credentials file, which is in INI format
+func readCredentialsFile(path, profile string) (c Credentials, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	inProfile := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !inProfile || !found {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case "aws_access_key_id":
+			c.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			c.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			c.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	return c, scanner.Err()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
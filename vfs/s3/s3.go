@@ -0,0 +1,274 @@
+// Package s3 is a vfs.FS backend for buckets of Amazon S3 and compatible storage (such as MinIO), through URLs of
+// the form s3://bucket/prefix. ETags of objects are exposed as checksums, so that objects needn't be downloaded to
+// be hashed by service.S3ETagHasher (or, for objects not uploaded in parts, service.MD5Hasher).
+//
+// Importing this package registers the backend:
+//
+//	import _ "github.com/m-manu/go-find-duplicates/vfs/s3"
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-manu/go-find-duplicates/internal/objectstore"
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func init() {
+	vfs.RegisterBackend("s3", func(u *url.URL) (vfs.FS, error) {
+		return New(ConfigFromURL(u))
+	})
+}
+
+// Names of checksum algorithms known for objects (same as names of the hashers of package service)
+const (
+	checksumMD5  = "md5"
+	checksumETag = "s3etag"
+)
+
+// Config is the configuration of a bucket
+type Config struct {
+	Bucket string
+	// Region of the bucket (defaults to us-east-1). Requests are redirected to the right region if this is wrong.
+	Region string
+	// Endpoint is the URL of S3-compatible storage (defaults to that of Amazon S3 in Region)
+	Endpoint string
+	// PathStyle addresses the bucket in the path of URLs rather than in the host name. This is needed by most
+	// S3-compatible storage and is used by default when Endpoint is set.
+	PathStyle bool
+	// Credentials sign requests (requests are anonymous if these are empty, e.g. for public buckets)
+	Credentials Credentials
+	// HTTPClient makes requests (defaults to objectstore.DefaultHTTPClient)
+	HTTPClient *http.Client
+}
+
+// ConfigFromURL creates Config for a URL of the form s3://bucket/prefix?region=...&endpoint=..., taking values not
+// in the URL from the environment, as AWS CLI does
+func ConfigFromURL(u *url.URL) Config {
+	query := u.Query()
+	cfg := Config{
+		Bucket: u.Host,
+		Region: firstNonEmpty(query.Get("region"), getenv("AWS_REGION"), getenv("AWS_DEFAULT_REGION")),
+		Endpoint: firstNonEmpty(query.Get("endpoint"), getenv("AWS_ENDPOINT_URL_S3"),
+			getenv("AWS_ENDPOINT_URL")),
+		Credentials: CredentialsFromEnv(),
+	}
+	cfg.PathStyle = cfg.Endpoint != "" || query.Get("path_style") == "true"
+	return cfg
+}
+
+// client is an objectstore.Client of a bucket
+type client struct {
+	cfg         Config
+	http        *http.Client
+	awsEndpoint bool
+	mx          sync.RWMutex
+	endpoint    *url.URL
+	region      string
+}
+
+// New creates a file system of a bucket. Names in it are keys of objects, with "/" separating directories.
+func New(cfg Config) (vfs.FS, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket name is missing")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	awsEndpoint := cfg.Endpoint == ""
+	if awsEndpoint {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+		// Names with dots don't match certificates of virtual-hosted buckets
+		cfg.PathStyle = cfg.PathStyle || strings.Contains(cfg.Bucket, ".")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = objectstore.DefaultHTTPClient
+	}
+	return objectstore.New(&client{
+		cfg:         cfg,
+		http:        httpClient,
+		awsEndpoint: awsEndpoint,
+		endpoint:    endpoint,
+		region:      cfg.Region,
+	}), nil
+}
+
+// object is metadata of an object in a listing
+type object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+type listResult struct {
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+	Contents              []object `xml:"Contents"`
+	CommonPrefixes        []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// toObject converts metadata of an object, exposing its ETag as checksum of algorithm "s3etag", and also of "md5"
+// when it's the MD5 of the object (i.e. the object wasn't uploaded in parts)
+func (o object) toObject() objectstore.Object {
+	etag := strings.ToLower(strings.Trim(o.ETag, `"`))
+	checksums := map[string]string{checksumETag: etag}
+	if len(etag) == 32 && !strings.Contains(etag, "-") {
+		checksums[checksumMD5] = etag
+	}
+	return objectstore.Object{Key: o.Key, Size: o.Size, ModTime: o.LastModified, Checksums: checksums}
+}
+
+// do sends a request for the object of key k (or for the bucket, if k is empty), following redirects to the
+// right region
+func (c *client) do(ctx context.Context, method, k string, query url.Values, header http.Header) (*http.Response,
+	error,
+) {
+	for attempt := 0; ; attempt++ {
+		c.mx.RLock()
+		region, u := c.region, *c.endpoint
+		c.mx.RUnlock()
+		base := strings.TrimSuffix(u.Path, "/")
+		if c.cfg.PathStyle {
+			base += "/" + c.cfg.Bucket
+		} else {
+			u.Host = c.cfg.Bucket + "." + u.Host
+		}
+		u.Path, u.RawPath = base+"/"+k, uriEncode(base, false)+"/"+uriEncode(k, false)
+		if k == "" && c.cfg.PathStyle {
+			u.Path, u.RawPath = base, uriEncode(base, false)
+		}
+		u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if c.cfg.Credentials.AccessKeyID != "" {
+			c.cfg.Credentials.sign(req, region, time.Now())
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		bucketRegion := resp.Header.Get("X-Amz-Bucket-Region")
+		if attempt == 0 && bucketRegion != "" && bucketRegion != region &&
+			(resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusBadRequest) {
+			_ = resp.Body.Close()
+			c.mx.Lock()
+			c.region = bucketRegion
+			if c.awsEndpoint {
+				c.endpoint = &url.URL{Scheme: "https", Host: "s3." + bucketRegion + ".amazonaws.com"}
+			}
+			c.mx.Unlock()
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// responseError converts an unsuccessful response to an error
+func responseError(resp *http.Response) error {
+	return objectstore.ResponseError(resp, func(body []byte) string {
+		var er errorResponse
+		if xml.Unmarshal(body, &er) != nil || er.Code == "" {
+			return ""
+		}
+		return er.Code + ": " + er.Message
+	})
+}
+
+// ID identifies the bucket by its name (and the endpoint, of storage other than AWS)
+func (c *client) ID() string {
+	if c.awsEndpoint {
+		return "s3://" + c.cfg.Bucket
+	}
+	return strings.TrimSuffix(c.cfg.Endpoint, "/") + "/" + c.cfg.Bucket
+}
+
+func (c *client) List(ctx context.Context, prefix string, limit int, fn func([]objectstore.Object, []string) bool) error {
+	query := url.Values{"list-type": {"2"}, "delimiter": {"/"}, "prefix": {prefix}}
+	if limit > 0 {
+		query.Set("max-keys", strconv.Itoa(limit))
+	}
+	for {
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return responseError(resp)
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't parse listing: %w", err)
+		}
+		objects := make([]objectstore.Object, 0, len(result.Contents))
+		for _, o := range result.Contents {
+			objects = append(objects, o.toObject())
+		}
+		prefixes := make([]string, 0, len(result.CommonPrefixes))
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !fn(objects, prefixes) || !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (c *client) Head(ctx context.Context, k string) (objectstore.Object, error) {
+	resp, err := c.do(ctx, http.MethodHead, k, nil, nil)
+	if err != nil {
+		return objectstore.Object{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return objectstore.Object{}, responseError(resp)
+	}
+	_ = resp.Body.Close()
+	o := object{Key: k, ETag: resp.Header.Get("ETag"), Size: resp.ContentLength}
+	o.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return o.toObject(), nil
+}
+
+func (c *client) Read(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rng := objectstore.RangeHeader(offset, length); rng != "" {
+		header.Set("Range", rng)
+	}
+	resp, err := c.do(ctx, http.MethodGet, k, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, responseError(resp)
+	}
+	return objectstore.RangeBody(resp, offset, length)
+}
@@ -0,0 +1,812 @@
+package smb
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"slices"
+	"time"
+)
+
+// Commands of SMB2
+const (
+	cmdNegotiate      = 0x0000
+	cmdSessionSetup   = 0x0001
+	cmdTreeConnect    = 0x0003
+	cmdCreate         = 0x0005
+	cmdClose          = 0x0006
+	cmdRead           = 0x0008
+	cmdQueryDirectory = 0x000e
+)
+
+// Statuses of responses (NTSTATUS)
+const (
+	statusSuccess                = 0x00000000
+	statusPending                = 0x00000103
+	statusNoMoreFiles            = 0x80000006
+	statusNoSuchFile             = 0xc000000f
+	statusEndOfFile              = 0xc0000011
+	statusMoreProcessingRequired = 0xc0000016
+	statusAccessDenied           = 0xc0000022
+	statusObjectNameInvalid      = 0xc0000033
+	statusObjectNameNotFound     = 0xc0000034
+	statusObjectPathNotFound     = 0xc000003a
+	statusSharingViolation       = 0xc0000043
+	statusLogonFailure           = 0xc000006d
+	statusAccountRestriction     = 0xc000006e
+	statusPasswordExpired        = 0xc0000071
+	statusAccountDisabled        = 0xc0000072
+	statusBadNetworkName         = 0xc00000cc
+	statusAccountLockedOut       = 0xc0000234
+)
+
+// Flags of headers
+const (
+	flagResponse = 0x00000001
+	flagAsync    = 0x00000002
+	flagSigned   = 0x00000008
+)
+
+const (
+	headerSize = 64
+	// creditSize is the size of payloads a credit pays for
+	creditSize = 64 * 1024
+	// maxCredits is the number of credits requested to be kept, so that reads of large payloads can be paid for
+	maxCredits = 64
+	// maxReadSize is the maximum size of reads, whatever servers allow
+	maxReadSize = 1024 * 1024
+)
+
+// dialects of SMB2 offered to servers: 2.0.2, 2.1, 3.0, 3.0.2 and 3.1.1
+var dialects = []uint16{0x0202, 0x0210, 0x0300, 0x0302, 0x0311}
+
+const (
+	dialect21  = 0x0210
+	dialect30  = 0x0300
+	dialect311 = 0x0311
+)
+
+// Negotiate contexts of dialect 3.1.1
+const (
+	contextPreauthIntegrity = 0x0001
+	contextEncryption       = 0x0002
+	hashSHA512              = 0x0001
+)
+
+const (
+	securitySigningEnabled  = 0x0001
+	securitySigningRequired = 0x0002
+	capLargeMTU             = 0x00000004
+	capEncryption           = 0x00000040
+	sessionGuest            = 0x0001
+	sessionNull             = 0x0002
+	sessionEncryptData      = 0x0004
+	shareTypeDisk           = 0x01
+	shareEncryptData        = 0x00008000
+)
+
+// Of files
+const (
+	// accessRead is FILE_READ_DATA, FILE_READ_EA, FILE_READ_ATTRIBUTES, READ_CONTROL and SYNCHRONIZE
+	accessRead = 0x00120089
+	// shareAll lets others read, write and delete files opened
+	shareAll           = 0x00000007
+	dispositionOpen    = 0x00000001
+	optionDirectory    = 0x00000001
+	optionNonDirectory = 0x00000040
+	attrDirectory      = 0x00000010
+	attrReparsePoint   = 0x00000400
+	// classDirectory is FileDirectoryInformation, of entries of directories
+	classDirectory = 0x01
+	restartScans   = 0x01
+)
+
+var (
+	errMalformed    = errors.New("malformed SMB2 message")
+	errBadSignature = errors.New("signature of SMB2 message is invalid")
+	errEncryption   = errors.New("server requires encryption of SMB3, but no cipher of it was negotiated")
+	errUnencrypted  = errors.New("response of SMB3 message isn't encrypted, though its request was")
+)
+
+// statusError is the status of a response of a request that failed
+type statusError uint32
+
+var statusNames = map[statusError]string{
+	statusNoSuchFile:         "STATUS_NO_SUCH_FILE",
+	statusAccessDenied:       "STATUS_ACCESS_DENIED",
+	statusObjectNameInvalid:  "STATUS_OBJECT_NAME_INVALID",
+	statusObjectNameNotFound: "STATUS_OBJECT_NAME_NOT_FOUND",
+	statusObjectPathNotFound: "STATUS_OBJECT_PATH_NOT_FOUND",
+	statusSharingViolation:   "STATUS_SHARING_VIOLATION",
+	statusLogonFailure:       "STATUS_LOGON_FAILURE",
+	statusAccountRestriction: "STATUS_ACCOUNT_RESTRICTION",
+	statusPasswordExpired:    "STATUS_PASSWORD_EXPIRED",
+	statusAccountDisabled:    "STATUS_ACCOUNT_DISABLED",
+	statusBadNetworkName:     "STATUS_BAD_NETWORK_NAME",
+	statusAccountLockedOut:   "STATUS_ACCOUNT_LOCKED_OUT",
+}
+
+func (e statusError) Error() string {
+	if name, known := statusNames[e]; known {
+		return name
+	}
+	return fmt.Sprintf("NTSTATUS 0x%08x", uint32(e))
+}
+
+// Is lets statuses of names that aren't found match fs.ErrNotExist, and those of access denied (or of logons that
+// failed) match fs.ErrPermission
+func (e statusError) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return slices.Contains([]statusError{statusNoSuchFile, statusObjectNameInvalid, statusObjectNameNotFound,
+			statusObjectPathNotFound, statusBadNetworkName}, e)
+	case fs.ErrPermission:
+		return slices.Contains([]statusError{statusAccessDenied, statusLogonFailure, statusAccountRestriction,
+			statusPasswordExpired, statusAccountDisabled, statusAccountLockedOut}, e)
+	}
+	return false
+}
+
+// conn is a connection to a server, of a session of a user, which runs one request at a time
+type conn struct {
+	cfg       *Config
+	raw       net.Conn
+	r         *bufio.Reader
+	dialect   uint16
+	messageID uint64
+	credits   int
+	sessionID uint64
+	// signingKey signs messages, if the server requires them to be signed
+	signingKey      []byte
+	signingRequired bool
+	// preauthHash is the hash of preauthentication integrity of dialect 3.1.1, of messages negotiating the dialect
+	// and setting up the session, which keys are derived of
+	preauthHash []byte
+	// cipher is the cipher of encryption negotiated (0 if the server doesn't support encryption)
+	cipher uint16
+	// encrypter and decrypter encrypt messages of the client and decrypt those of the server, once the session is
+	// set up (nil if there's no cipher, or the login is anonymous)
+	encrypter, decrypter cipher.AEAD
+	// encrypting is whether messages are encrypted, since the session or a share requires them to be
+	encrypting  bool
+	largeMTU    bool
+	maxRead     int
+	maxTransact int
+	// trees are IDs of shares connected, by their names
+	trees map[string]uint32
+}
+
+// dial connects to the server and sets up a session of the user
+func dial(ctx context.Context, cfg *Config) (*conn, error) {
+	dialer := net.Dialer{Timeout: cfg.Timeout}
+	raw, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{cfg: cfg, raw: raw, r: bufio.NewReader(raw), credits: 1, preauthHash: make([]byte, sha512.Size),
+		trees: map[string]uint32{}}
+	// Servers that don't respond to setting up sessions are given up on
+	_ = raw.SetDeadline(time.Now().Add(cfg.Timeout))
+	if err = c.negotiate(); err == nil {
+		err = c.sessionSetup()
+	}
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+	_ = raw.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// negotiate negotiates the dialect, and offers negotiate contexts of preauthentication integrity (of SHA-512) and of
+// encryption (of ciphers) for dialect 3.1.1
+func (c *conn) negotiate() error {
+	body := make([]byte, 36, 36+2*len(dialects))
+	binary.LittleEndian.PutUint16(body, 36)
+	binary.LittleEndian.PutUint16(body[2:], uint16(len(dialects)))
+	binary.LittleEndian.PutUint16(body[4:], securitySigningEnabled)
+	binary.LittleEndian.PutUint32(body[8:], capLargeMTU|capEncryption)
+	// Client GUID
+	_, _ = rand.Read(body[12:28])
+	for _, d := range dialects {
+		body = binary.LittleEndian.AppendUint16(body, d)
+	}
+	salt := make([]byte, 32)
+	_, _ = rand.Read(salt)
+	preauth := binary.LittleEndian.AppendUint16(nil, 1)
+	preauth = binary.LittleEndian.AppendUint16(preauth, uint16(len(salt)))
+	preauth = append(binary.LittleEndian.AppendUint16(preauth, hashSHA512), salt...)
+	encryption := binary.LittleEndian.AppendUint16(nil, uint16(len(ciphers)))
+	for _, id := range ciphers {
+		encryption = binary.LittleEndian.AppendUint16(encryption, id)
+	}
+	binary.LittleEndian.PutUint32(body[28:], uint32(headerSize+align8(len(body))))
+	binary.LittleEndian.PutUint16(body[32:], 2)
+	body = appendContext(appendContext(body, contextPreauthIntegrity, preauth), contextEncryption, encryption)
+	resp, err := c.call(cmdNegotiate, 0, body, 1)
+	if err != nil {
+		return err
+	}
+	b := resp[headerSize:]
+	if len(b) < 64 {
+		return errMalformed
+	}
+	if c.dialect = binary.LittleEndian.Uint16(b[4:]); !slices.Contains(dialects, c.dialect) {
+		return fmt.Errorf("server chose dialect 0x%04x, which isn't supported", c.dialect)
+	}
+	switch {
+	case c.dialect == dialect311:
+		if err = c.negotiateContexts(resp); err != nil {
+			return err
+		}
+	case c.dialect >= dialect30 && binary.LittleEndian.Uint32(b[24:])&capEncryption != 0:
+		c.cipher = cipherAES128CCM
+	}
+	c.signingRequired = binary.LittleEndian.Uint16(b[2:])&securitySigningRequired != 0
+	c.largeMTU = c.dialect >= dialect21 && binary.LittleEndian.Uint32(b[24:])&capLargeMTU != 0
+	c.maxTransact = int(min(binary.LittleEndian.Uint32(b[28:]), creditSize))
+	c.maxRead = int(min(binary.LittleEndian.Uint32(b[32:]), maxReadSize))
+	if !c.largeMTU {
+		c.maxRead = min(c.maxRead, creditSize)
+	}
+	return nil
+}
+
+// negotiateContexts checks negotiate contexts of a response of negotiation of dialect 3.1.1: preauthentication
+// integrity must be of SHA-512, and the cipher chosen (if any) must be one offered
+func (c *conn) negotiateContexts(resp []byte) error {
+	b := resp[headerSize:]
+	n, offset := int(binary.LittleEndian.Uint16(b[6:])), int(binary.LittleEndian.Uint32(b[60:]))
+	isPreauth := false
+	for range n {
+		if offset+8 > len(resp) {
+			return errMalformed
+		}
+		id, length := binary.LittleEndian.Uint16(resp[offset:]), int(binary.LittleEndian.Uint16(resp[offset+2:]))
+		if offset+8+length > len(resp) {
+			return errMalformed
+		}
+		data := resp[offset+8 : offset+8+length]
+		switch id {
+		case contextPreauthIntegrity:
+			if len(data) < 6 || binary.LittleEndian.Uint16(data) != 1 ||
+				binary.LittleEndian.Uint16(data[4:]) != hashSHA512 {
+				return errors.New("server chose a hash of preauthentication integrity other than SHA-512")
+			}
+			isPreauth = true
+		case contextEncryption:
+			if len(data) < 4 || binary.LittleEndian.Uint16(data) != 1 {
+				return errMalformed
+			}
+			if id := binary.LittleEndian.Uint16(data[2:]); slices.Contains(ciphers, id) {
+				c.cipher = id
+			}
+		}
+		offset += align8(8 + length)
+	}
+	if !isPreauth {
+		return errors.New("server chose dialect 3.1.1 without preauthentication integrity")
+	}
+	return nil
+}
+
+// appendContext appends a negotiate context of data to body (of a request or response of negotiation), aligned to
+// 8 bytes
+func appendContext(body []byte, id uint16, data []byte) []byte {
+	body = append(body, make([]byte, align8(len(body))-len(body))...)
+	body = binary.LittleEndian.AppendUint16(body, id)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(data)))
+	return append(append(body, 0, 0, 0, 0), data...)
+}
+
+// align8 rounds n up to a multiple of 8
+func align8(n int) int {
+	return (n + 7) / 8 * 8
+}
+
+// sessionSetup authenticates the user through NTLMv2 (or anonymously, if there's no user name)
+func (c *conn) sessionSetup() error {
+	resp, err := c.call(cmdSessionSetup, 0, sessionSetupBody(spnegoInit(ntlmNegotiate())), 1,
+		statusMoreProcessingRequired)
+	if err != nil {
+		return err
+	}
+	c.sessionID = binary.LittleEndian.Uint64(resp[40:])
+	buffer, err := securityBuffer(resp)
+	if err != nil {
+		return err
+	}
+	token, err := spnegoToken(buffer)
+	if err != nil {
+		return err
+	}
+	challenge, err := parseNTLMChallenge(token)
+	if err != nil {
+		return err
+	}
+	clientChallenge, exportedKey := make([]byte, 8), make([]byte, 16)
+	_, _ = rand.Read(clientChallenge)
+	_, _ = rand.Read(exportedKey)
+	auth, sessionKey := ntlmAuthenticate(c.cfg, challenge, clientChallenge, filetime(time.Now()), exportedKey)
+	if resp, err = c.call(cmdSessionSetup, 0, sessionSetupBody(spnegoResponse(auth)), 1); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("couldn't log in as %s: %w", c.cfg.Username, err)
+		}
+		return err
+	}
+	if len(resp) < headerSize+8 {
+		return errMalformed
+	}
+	flags := binary.LittleEndian.Uint16(resp[headerSize+2:])
+	if flags&(sessionGuest|sessionNull) != 0 {
+		sessionKey = nil
+	}
+	signingKey := sessionKey
+	if sessionKey != nil && c.dialect >= dialect30 {
+		var clientKey, serverKey []byte
+		signingKey, clientKey, serverKey = sessionKeys(c.dialect, sessionKey, c.preauthHash)
+		if c.cipher != 0 {
+			c.encrypter, c.decrypter = newAEAD(c.cipher, clientKey), newAEAD(c.cipher, serverKey)
+		}
+	}
+	if sessionKey != nil && c.dialect == dialect311 {
+		// Servers sign the response whatever they require, so that messages hashed (of negotiation too) are
+		// known to be those of the server
+		c.signingKey = signingKey
+		isSigned := binary.LittleEndian.Uint32(resp[16:])&flagSigned != 0 && hmac.Equal(resp[48:64], c.sign(resp))
+		c.signingKey = nil
+		if !isSigned {
+			return errBadSignature
+		}
+	}
+	if c.signingRequired && sessionKey != nil {
+		c.signingKey = signingKey
+	}
+	if flags&sessionEncryptData != 0 {
+		if c.encrypter == nil {
+			return errEncryption
+		}
+		c.encrypting = true
+	}
+	return nil
+}
+
+func sessionSetupBody(token []byte) []byte {
+	body := make([]byte, 24, 24+len(token))
+	binary.LittleEndian.PutUint16(body, 25)
+	body[3] = securitySigningEnabled
+	binary.LittleEndian.PutUint16(body[12:], headerSize+24)
+	binary.LittleEndian.PutUint16(body[14:], uint16(len(token)))
+	return append(body, token...)
+}
+
+// securityBuffer returns the security buffer of a response of a session setup
+func securityBuffer(resp []byte) ([]byte, error) {
+	if len(resp) < headerSize+8 {
+		return nil, errMalformed
+	}
+	offset := int(binary.LittleEndian.Uint16(resp[headerSize+4:]))
+	n := int(binary.LittleEndian.Uint16(resp[headerSize+6:]))
+	if offset+n > len(resp) {
+		return nil, errMalformed
+	}
+	return resp[offset : offset+n], nil
+}
+
+// tree returns the ID of the share, connecting to it if it isn't yet
+func (c *conn) tree(share string) (uint32, error) {
+	if id, connected := c.trees[share]; connected {
+		return id, nil
+	}
+	host, _, _ := net.SplitHostPort(c.cfg.Addr)
+	path := encodeString(`\\` + host + `\` + share)
+	body := make([]byte, 8, 8+len(path))
+	binary.LittleEndian.PutUint16(body, 9)
+	binary.LittleEndian.PutUint16(body[4:], headerSize+8)
+	binary.LittleEndian.PutUint16(body[6:], uint16(len(path)))
+	resp, err := c.call(cmdTreeConnect, 0, append(body, path...), 1)
+	if err != nil {
+		return 0, err
+	}
+	b := resp[headerSize:]
+	if len(b) < 16 {
+		return 0, errMalformed
+	}
+	if b[2] != shareTypeDisk {
+		return 0, fmt.Errorf("%s isn't a share of files", share)
+	}
+	if binary.LittleEndian.Uint32(b[4:])&shareEncryptData != 0 {
+		if c.encrypter == nil {
+			return 0, errEncryption
+		}
+		// Messages of other shares are encrypted too, which servers accept
+		c.encrypting = true
+	}
+	id := binary.LittleEndian.Uint32(resp[36:])
+	c.trees[share] = id
+	return id, nil
+}
+
+// entry is metadata of a file or directory
+type entry struct {
+	name       string
+	size       int64
+	modTime    time.Time
+	attributes uint32
+}
+
+func (e entry) isDir() bool {
+	return e.attributes&attrDirectory != 0
+}
+
+// fileID is the handle of a file opened
+type fileID [16]byte
+
+// create opens name (with "\" separators, relative to the root of the share) of tree, with options of files (such as
+// optionDirectory), returning the handle and metadata of the file
+func (c *conn) create(tree uint32, name string, options uint32) (fileID, entry, error) {
+	path := encodeString(name)
+	body := make([]byte, 56, 57+len(path))
+	binary.LittleEndian.PutUint16(body, 57)
+	// Impersonation
+	binary.LittleEndian.PutUint32(body[4:], 2)
+	binary.LittleEndian.PutUint32(body[24:], accessRead)
+	binary.LittleEndian.PutUint32(body[32:], shareAll)
+	binary.LittleEndian.PutUint32(body[36:], dispositionOpen)
+	binary.LittleEndian.PutUint32(body[40:], options)
+	binary.LittleEndian.PutUint16(body[44:], headerSize+56)
+	binary.LittleEndian.PutUint16(body[46:], uint16(len(path)))
+	body = append(body, path...)
+	if len(path) == 0 {
+		// The buffer has a byte even if the name (of the root) is empty
+		body = append(body, 0)
+	}
+	resp, err := c.call(cmdCreate, tree, body, 1)
+	if err != nil {
+		return fileID{}, entry{}, err
+	}
+	b := resp[headerSize:]
+	if len(b) < 80 {
+		return fileID{}, entry{}, errMalformed
+	}
+	e := entry{size: int64(binary.LittleEndian.Uint64(b[48:])),
+		modTime: fromFiletime(binary.LittleEndian.Uint64(b[24:])), attributes: binary.LittleEndian.Uint32(b[56:])}
+	return fileID(b[64:80]), e, nil
+}
+
+// closeFile closes a file opened
+func (c *conn) closeFile(tree uint32, id fileID) error {
+	body := make([]byte, 24)
+	binary.LittleEndian.PutUint16(body, 24)
+	copy(body[8:], id[:])
+	_, err := c.call(cmdClose, tree, body, 1)
+	return err
+}
+
+// stat gets metadata of name of share
+func (c *conn) stat(share, name string) (entry, error) {
+	tree, err := c.tree(share)
+	if err != nil {
+		return entry{}, err
+	}
+	id, e, err := c.create(tree, name, 0)
+	if err != nil {
+		return entry{}, err
+	}
+	return e, c.closeFile(tree, id)
+}
+
+// list lists entries of the directory name of share (other than "." and "..")
+func (c *conn) list(share, name string) ([]entry, error) {
+	tree, err := c.tree(share)
+	if err != nil {
+		return nil, err
+	}
+	id, _, err := c.create(tree, name, optionDirectory)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.queryDirectory(tree, id)
+	if closeErr := c.closeFile(tree, id); err == nil {
+		err = closeErr
+	}
+	return entries, err
+}
+
+func (c *conn) queryDirectory(tree uint32, id fileID) ([]entry, error) {
+	pattern := encodeString("*")
+	var entries []entry
+	for flags := byte(restartScans); ; flags = 0 {
+		body := make([]byte, 32, 32+len(pattern))
+		binary.LittleEndian.PutUint16(body, 33)
+		body[2], body[3] = classDirectory, flags
+		copy(body[8:], id[:])
+		binary.LittleEndian.PutUint16(body[24:], headerSize+32)
+		binary.LittleEndian.PutUint16(body[26:], uint16(len(pattern)))
+		binary.LittleEndian.PutUint32(body[28:], uint32(c.maxTransact))
+		resp, err := c.call(cmdQueryDirectory, tree, append(body, pattern...), 1, statusNoMoreFiles)
+		if err != nil {
+			return nil, err
+		}
+		if status(resp) == statusNoMoreFiles {
+			return entries, nil
+		}
+		buffer, err := outputBuffer(resp)
+		if err != nil {
+			return nil, err
+		}
+		// Entries of FileDirectoryInformation
+		for len(buffer) > 0 {
+			if len(buffer) < 64 {
+				return nil, errMalformed
+			}
+			next, n := int(binary.LittleEndian.Uint32(buffer)), int(binary.LittleEndian.Uint32(buffer[60:]))
+			if 64+n > len(buffer) || next > len(buffer) {
+				return nil, errMalformed
+			}
+			if name := decodeString(buffer[64 : 64+n]); name != "." && name != ".." {
+				entries = append(entries, entry{name: name, size: int64(binary.LittleEndian.Uint64(buffer[40:])),
+					modTime:    fromFiletime(binary.LittleEndian.Uint64(buffer[24:])),
+					attributes: binary.LittleEndian.Uint32(buffer[56:])})
+			}
+			if next == 0 {
+				break
+			}
+			buffer = buffer[next:]
+		}
+	}
+}
+
+// outputBuffer returns the output buffer of a response of a query
+func outputBuffer(resp []byte) ([]byte, error) {
+	if len(resp) < headerSize+8 {
+		return nil, errMalformed
+	}
+	offset := int(binary.LittleEndian.Uint16(resp[headerSize+2:]))
+	n := int(binary.LittleEndian.Uint32(resp[headerSize+4:]))
+	if offset+n > len(resp) {
+		return nil, errMalformed
+	}
+	return resp[offset : offset+n], nil
+}
+
+// read reads up to n bytes of a file at offset, as many as a request can. It fails with io.EOF at the end of the
+// file.
+func (c *conn) read(tree uint32, id fileID, offset int64, n int) ([]byte, error) {
+	n = min(n, c.maxRead)
+	charge := 1
+	if c.largeMTU {
+		n = min(n, max(c.credits, 1)*creditSize)
+		charge = (n-1)/creditSize + 1
+	}
+	body := make([]byte, 49)
+	binary.LittleEndian.PutUint16(body, 49)
+	body[2] = headerSize + 16
+	binary.LittleEndian.PutUint32(body[4:], uint32(n))
+	binary.LittleEndian.PutUint64(body[8:], uint64(offset))
+	copy(body[16:], id[:])
+	resp, err := c.call(cmdRead, tree, body, charge, statusEndOfFile)
+	if err != nil {
+		return nil, err
+	}
+	if status(resp) == statusEndOfFile {
+		return nil, io.EOF
+	}
+	if len(resp) < headerSize+16 {
+		return nil, errMalformed
+	}
+	dataOffset := int(resp[headerSize+2])
+	length := int(binary.LittleEndian.Uint32(resp[headerSize+4:]))
+	if dataOffset+length > len(resp) || length > n {
+		return nil, errMalformed
+	}
+	if length == 0 {
+		return nil, io.EOF
+	}
+	return resp[dataOffset : dataOffset+length], nil
+}
+
+func status(resp []byte) uint32 {
+	return binary.LittleEndian.Uint32(resp[8:])
+}
+
+// call sends a request of a command (to tree, unless 0) whose payload is paid for by charge credits, and returns
+// the response. Statuses other than success fail with statusError, unless they're ok.
+func (c *conn) call(command uint16, tree uint32, body []byte, charge int, ok ...uint32) ([]byte, error) {
+	msg := make([]byte, headerSize, headerSize+len(body))
+	copy(msg, "\xfeSMB")
+	binary.LittleEndian.PutUint16(msg[4:], headerSize)
+	if c.dialect >= dialect21 {
+		binary.LittleEndian.PutUint16(msg[6:], uint16(charge))
+	}
+	binary.LittleEndian.PutUint16(msg[12:], command)
+	binary.LittleEndian.PutUint16(msg[14:], uint16(max(charge, maxCredits-c.credits+charge)))
+	id := c.messageID
+	binary.LittleEndian.PutUint64(msg[24:], id)
+	binary.LittleEndian.PutUint32(msg[36:], tree)
+	binary.LittleEndian.PutUint64(msg[40:], c.sessionID)
+	msg = append(msg, body...)
+	isPreauth := command == cmdNegotiate || command == cmdSessionSetup
+	if isPreauth {
+		c.preauth(msg)
+	}
+	encrypting := c.encrypting
+	switch {
+	case encrypting:
+		// Encrypted messages aren't signed, as encryption authenticates them
+		msg = encrypt(c.encrypter, c.sessionID, msg)
+	case c.signingKey != nil:
+		binary.LittleEndian.PutUint32(msg[16:], flagSigned)
+		copy(msg[48:], c.sign(msg))
+	}
+	c.messageID += uint64(charge)
+	c.credits -= charge
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	if _, err := c.raw.Write(append(frame, msg...)); err != nil {
+		return nil, err
+	}
+	for {
+		resp, encrypted, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint64(resp[24:]) != id {
+			// Such as notifications of breaks of oplocks, which aren't requested
+			continue
+		}
+		if encrypting && !encrypted {
+			return nil, errUnencrypted
+		}
+		c.credits += int(binary.LittleEndian.Uint16(resp[14:]))
+		flags := binary.LittleEndian.Uint32(resp[16:])
+		s := status(resp)
+		if s == statusPending && flags&flagAsync != 0 {
+			// An interim response, of a request that takes long
+			continue
+		}
+		if c.signingKey != nil && !encrypted && (flags&flagSigned == 0 || !hmac.Equal(resp[48:64], c.sign(resp))) {
+			return nil, errBadSignature
+		}
+		// Final responses of session setups aren't hashed, as keys are derived before them
+		if command == cmdNegotiate || command == cmdSessionSetup && s == statusMoreProcessingRequired {
+			c.preauth(resp)
+		}
+		if s != statusSuccess && !slices.Contains(ok, s) {
+			return nil, statusError(s)
+		}
+		return resp, nil
+	}
+}
+
+// preauth adds a message of negotiation or of setting up the session to the hash of preauthentication integrity
+func (c *conn) preauth(msg []byte) {
+	h := sha512.New()
+	h.Write(c.preauthHash)
+	h.Write(msg)
+	c.preauthHash = h.Sum(nil)
+}
+
+// receive receives a message of the server, decrypting it if it's encrypted
+func (c *conn) receive() (msg []byte, encrypted bool, err error) {
+	var frame [4]byte
+	if _, err = io.ReadFull(c.r, frame[:]); err != nil {
+		return nil, false, err
+	}
+	n := int(binary.BigEndian.Uint32(frame[:]))
+	if frame[0] != 0 || n < headerSize {
+		return nil, false, errMalformed
+	}
+	msg = make([]byte, n)
+	if _, err = io.ReadFull(c.r, msg); err != nil {
+		return nil, false, err
+	}
+	switch string(msg[:4]) {
+	case "\xfeSMB":
+	case "\xfdSMB":
+		if msg, err = decrypt(c.decrypter, c.sessionID, msg); err != nil {
+			return nil, false, err
+		}
+		encrypted = true
+	default:
+		return nil, false, errMalformed
+	}
+	if binary.LittleEndian.Uint32(msg[16:])&flagResponse == 0 {
+		return nil, false, errMalformed
+	}
+	return msg, encrypted, nil
+}
+
+// sign returns the signature of a message (whose signature is ignored): HMAC-SHA256 for dialects of SMB 2, and
+// AES-CMAC for those of SMB 3
+func (c *conn) sign(msg []byte) []byte {
+	var signature [16]byte
+	copy(signature[:], msg[48:64])
+	clear(msg[48:64])
+	defer copy(msg[48:64], signature[:])
+	if c.dialect >= dialect30 {
+		return cmac(c.signingKey, msg)
+	}
+	h := hmac.New(sha256.New, c.signingKey)
+	h.Write(msg)
+	return h.Sum(nil)[:16]
+}
+
+// kdf derives a key of 16 bytes of SMB 3 (SP800-108 in counter mode, of HMAC-SHA256)
+func kdf(key []byte, label, context string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write([]byte(label))
+	h.Write([]byte{0})
+	h.Write([]byte(context))
+	h.Write([]byte{0, 0, 0, 128})
+	return h.Sum(nil)[:16]
+}
+
+// cmac returns the AES-CMAC of msg (RFC 4493)
+func cmac(key, msg []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	var k1, k2 [16]byte
+	block.Encrypt(k1[:], k1[:])
+	k1 = double(k1)
+	k2 = double(k1)
+	n := max((len(msg)+15)/16, 1)
+	var last [16]byte
+	if rest := msg[16*(n-1):]; len(rest) == 16 {
+		xorBytes(last[:], rest, k1[:])
+	} else {
+		copy(last[:], rest)
+		last[len(rest)] = 0x80
+		xorBytes(last[:], last[:], k2[:])
+	}
+	var x [16]byte
+	for i := 0; i < n-1; i++ {
+		xorBytes(x[:], x[:], msg[16*i:16*i+16])
+		block.Encrypt(x[:], x[:])
+	}
+	xorBytes(x[:], x[:], last[:])
+	block.Encrypt(x[:], x[:])
+	return x[:]
+}
+
+// double doubles a subkey of CMAC, in GF(2^128)
+func double(b [16]byte) [16]byte {
+	var d [16]byte
+	for i := range 15 {
+		d[i] = b[i]<<1 | b[i+1]>>7
+	}
+	d[15] = b[15] << 1
+	if b[0]&0x80 != 0 {
+		d[15] ^= 0x87
+	}
+	return d
+}
+
+// xorBytes sets dst to a XOR b
+func xorBytes(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+// filetime converts t to a FILETIME, of 100 nanoseconds since 1601
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func fromFiletime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (int64(ft)-116444736000000000)*100)
+}
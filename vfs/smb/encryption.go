@@ -0,0 +1,172 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// Ciphers of encryption of SMB 3
+const (
+	cipherAES128CCM = 0x0001
+	cipherAES128GCM = 0x0002
+)
+
+// ciphers are the ciphers offered to servers of dialect 3.1.1, by preference
+var ciphers = []uint16{cipherAES128GCM, cipherAES128CCM}
+
+// transformHeaderSize is the size of headers of encrypted messages, which precede what's encrypted
+const transformHeaderSize = 52
+
+var errDecryption = errors.New("encrypted SMB3 message couldn't be decrypted")
+
+// sessionKeys derives the keys of signing and of encryption (of messages of clients, and of servers) of a session of
+// SMB 3 from its session key, and of the hash of preauthentication integrity of dialect 3.1.1
+func sessionKeys(dialect uint16, sessionKey, preauthHash []byte) (signingKey, clientKey, serverKey []byte) {
+	if dialect == dialect311 {
+		return kdf(sessionKey, "SMBSigningKey\x00", string(preauthHash)),
+			kdf(sessionKey, "SMBC2SCipherKey\x00", string(preauthHash)),
+			kdf(sessionKey, "SMBS2CCipherKey\x00", string(preauthHash))
+	}
+	return kdf(sessionKey, "SMB2AESCMAC\x00", "SmbSign\x00"), kdf(sessionKey, "SMB2AESCCM\x00", "ServerIn \x00"),
+		kdf(sessionKey, "SMB2AESCCM\x00", "ServerOut\x00")
+}
+
+// newAEAD returns the AEAD of the cipher of a key
+func newAEAD(cipherID uint16, key []byte) cipher.AEAD {
+	block, _ := aes.NewCipher(key)
+	if cipherID == cipherAES128GCM {
+		aead, _ := cipher.NewGCM(block)
+		return aead
+	}
+	return &ccm{block: block, nonceSize: 11, tagSize: 16}
+}
+
+// encrypt returns msg encrypted by aead, preceded by its transform header, of a session
+func encrypt(aead cipher.AEAD, sessionID uint64, msg []byte) []byte {
+	header := make([]byte, transformHeaderSize, transformHeaderSize+len(msg)+aead.Overhead())
+	copy(header, "\xfdSMB")
+	nonce := header[20 : 20+aead.NonceSize()]
+	_, _ = rand.Read(nonce)
+	binary.LittleEndian.PutUint32(header[36:], uint32(len(msg)))
+	// Encrypted
+	binary.LittleEndian.PutUint16(header[42:], 0x0001)
+	binary.LittleEndian.PutUint64(header[44:], sessionID)
+	// The signature of the header is the tag that Seal appends
+	sealed := aead.Seal(header, nonce, msg, header[20:transformHeaderSize])
+	n := len(sealed) - aead.Overhead()
+	copy(sealed[4:20], sealed[n:])
+	return sealed[:n]
+}
+
+// decrypt returns the message encrypted by aead of msg, which has a transform header, of a session
+func decrypt(aead cipher.AEAD, sessionID uint64, msg []byte) ([]byte, error) {
+	if aead == nil {
+		return nil, errEncryption
+	}
+	if len(msg) < transformHeaderSize || binary.LittleEndian.Uint64(msg[44:]) != sessionID {
+		return nil, errMalformed
+	}
+	sealed := append(bytes.Clone(msg[transformHeaderSize:]), msg[4:20]...)
+	plain, err := aead.Open(sealed[:0], msg[20:20+aead.NonceSize()], sealed, msg[20:transformHeaderSize])
+	if err != nil {
+		return nil, errDecryption
+	}
+	if len(plain) != int(binary.LittleEndian.Uint32(msg[36:])) || len(plain) < headerSize ||
+		string(plain[:4]) != "\xfeSMB" {
+		return nil, errMalformed
+	}
+	return plain, nil
+}
+
+// ccm is the AEAD of AES-CCM (RFC 3610), which the standard library doesn't have
+type ccm struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+}
+
+func (c *ccm) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *ccm) Overhead() int {
+	return c.tagSize
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	tag := c.mac(nonce, plaintext, additionalData)
+	n := len(dst)
+	dst = append(dst, plaintext...)
+	c.ctr(nonce, dst[n:])
+	return append(dst, tag...)
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < c.tagSize {
+		return nil, errDecryption
+	}
+	tag := ciphertext[len(ciphertext)-c.tagSize:]
+	// ciphertext may be overwritten by dst, as of cipher.AEAD
+	tag = bytes.Clone(tag)
+	n := len(dst)
+	dst = append(dst, ciphertext[:len(ciphertext)-c.tagSize]...)
+	c.ctr(nonce, dst[n:])
+	if subtle.ConstantTimeCompare(tag, c.mac(nonce, dst[n:], additionalData)) != 1 {
+		clear(dst[n:])
+		return nil, errDecryption
+	}
+	return dst, nil
+}
+
+// counterBlock returns a block of flags, the nonce and the counter (in the bytes left), as blocks of counter mode
+// and the first block of the CBC-MAC are
+func (c *ccm) counterBlock(flags byte, nonce []byte, counter uint64) [16]byte {
+	var b [16]byte
+	b[0] = flags | byte(14-c.nonceSize)
+	copy(b[1:], nonce)
+	for i := 15; i > c.nonceSize; i-- {
+		b[i] = byte(counter)
+		counter >>= 8
+	}
+	return b
+}
+
+// ctr encrypts (or decrypts) b in place, in counter mode, of counters starting at 1
+func (c *ccm) ctr(nonce, b []byte) {
+	var stream [16]byte
+	for i := 0; i < len(b); i += 16 {
+		counter := c.counterBlock(0, nonce, uint64(i/16+1))
+		c.block.Encrypt(stream[:], counter[:])
+		xorBytes(b[i:min(i+16, len(b))], b[i:min(i+16, len(b))], stream[:])
+	}
+}
+
+// mac returns the tag of plaintext and additionalData: their CBC-MAC, encrypted by the counter block of 0
+func (c *ccm) mac(nonce, plaintext, additionalData []byte) []byte {
+	flags := byte(c.tagSize-2) / 2 << 3
+	if len(additionalData) > 0 {
+		flags |= 0x40
+	}
+	x := c.counterBlock(flags, nonce, uint64(len(plaintext)))
+	c.block.Encrypt(x[:], x[:])
+	cbc := func(b []byte) {
+		for ; len(b) > 0; b = b[min(16, len(b)):] {
+			xorBytes(x[:min(16, len(b))], x[:min(16, len(b))], b)
+			c.block.Encrypt(x[:], x[:])
+		}
+	}
+	if len(additionalData) > 0 {
+		// Lengths of additional data are of 2 bytes, as they're shorter than 0xff00 bytes
+		cbc(append(binary.BigEndian.AppendUint16(nil, uint16(len(additionalData))), additionalData...))
+	}
+	cbc(plaintext)
+	s0 := c.counterBlock(0, nonce, 0)
+	c.block.Encrypt(s0[:], s0[:])
+	xorBytes(x[:c.tagSize], x[:c.tagSize], s0[:])
+	return bytes.Clone(x[:c.tagSize])
+}
@@ -0,0 +1,292 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strings"
+	"unicode/utf16"
+)
+
+// Flags of NTLM messages
+const (
+	ntlmUnicode          = 0x00000001
+	ntlmRequestTarget    = 0x00000004
+	ntlmSign             = 0x00000010
+	ntlmNTLM             = 0x00000200
+	ntlmAnonymous        = 0x00000800
+	ntlmAlwaysSign       = 0x00008000
+	ntlmExtendedSecurity = 0x00080000
+	ntlmTargetInfo       = 0x00800000
+	ntlm128              = 0x20000000
+	ntlmKeyExchange      = 0x40000000
+	ntlm56               = 0x80000000
+)
+
+// ntlmFlags are the flags of NTLM negotiated by clients
+const ntlmFlags = ntlmUnicode | ntlmRequestTarget | ntlmSign | ntlmNTLM | ntlmAlwaysSign | ntlmExtendedSecurity |
+	ntlmTargetInfo | ntlm128 | ntlmKeyExchange | ntlm56
+
+// avTimestamp is the ID of the attribute of the target info of the time of the server
+const avTimestamp = 7
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+var errInvalidChallenge = errors.New("invalid NTLM challenge")
+
+// ntlmNegotiate returns the NEGOTIATE message of NTLM that starts authentication
+func ntlmNegotiate() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmFlags)
+	return msg
+}
+
+// ntlmChallenge is the CHALLENGE message of NTLM of a server
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (ntlmChallenge, error) {
+	if len(msg) < 48 || !bytes.HasPrefix(msg, ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return ntlmChallenge{}, errInvalidChallenge
+	}
+	n, offset := int(binary.LittleEndian.Uint16(msg[40:])), int(binary.LittleEndian.Uint32(msg[44:]))
+	if offset+n > len(msg) {
+		return ntlmChallenge{}, errInvalidChallenge
+	}
+	return ntlmChallenge{flags: binary.LittleEndian.Uint32(msg[20:]), serverChallenge: msg[24:32],
+		targetInfo: msg[offset : offset+n]}, nil
+}
+
+// timestamp returns the time of the server of its target info, if it's there
+func (c ntlmChallenge) timestamp() (uint64, bool) {
+	for info := c.targetInfo; len(info) >= 4; {
+		id, n := binary.LittleEndian.Uint16(info), int(binary.LittleEndian.Uint16(info[2:]))
+		if id == 0 || 4+n > len(info) {
+			break
+		}
+		if id == avTimestamp && n == 8 {
+			return binary.LittleEndian.Uint64(info[4:]), true
+		}
+		info = info[4+n:]
+	}
+	return 0, false
+}
+
+// ntlmAuthenticate returns the AUTHENTICATE message of NTLMv2 that answers challenge, of clientChallenge (8 random
+// bytes) and of time (that of the server, if challenge has it), and the session key, which is exportedKey (16 random
+// bytes) if key exchange was negotiated. Users without names log in anonymously, without a session key.
+func ntlmAuthenticate(cfg *Config, challenge ntlmChallenge, clientChallenge []byte, time uint64,
+	exportedKey []byte,
+) (msg, sessionKey []byte) {
+	flags := challenge.flags & ntlmFlags
+	var lmResponse, ntResponse, encryptedKey []byte
+	if cfg.Username == "" {
+		flags |= ntlmAnonymous
+		lmResponse = []byte{0}
+	} else {
+		if t, known := challenge.timestamp(); known {
+			time = t
+		}
+		key := ntowfv2(cfg.Username, cfg.Password, cfg.Domain)
+		temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+		temp = binary.LittleEndian.AppendUint64(temp, time)
+		temp = append(append(temp, clientChallenge...), 0, 0, 0, 0)
+		temp = append(append(temp, challenge.targetInfo...), 0, 0, 0, 0)
+		ntProof := hmacMD5(key, challenge.serverChallenge, temp)
+		ntResponse = append(ntProof, temp...)
+		// LMv2 responses are left out, as servers that send their times expect
+		lmResponse = make([]byte, 24)
+		sessionKey = hmacMD5(key, ntProof)
+		if flags&ntlmKeyExchange != 0 {
+			cipher, _ := rc4.NewCipher(sessionKey)
+			encryptedKey = make([]byte, len(exportedKey))
+			cipher.XORKeyStream(encryptedKey, exportedKey)
+			sessionKey = exportedKey
+		}
+	}
+	msg = make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	for i, field := range [][]byte{lmResponse, ntResponse, encodeString(cfg.Domain), encodeString(cfg.Username),
+		nil, encryptedKey} {
+		binary.LittleEndian.PutUint16(msg[12+8*i:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[14+8*i:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[16+8*i:], uint32(len(msg)))
+		msg = append(msg, field...)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], flags)
+	return msg, sessionKey
+}
+
+// ntowfv2 returns the key of NTLMv2 responses of a user
+func ntowfv2(user, password, domain string) []byte {
+	hash := md4(encodeString(password))
+	return hmacMD5(hash[:], encodeString(strings.ToUpper(user)+domain))
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// encodeString encodes s in UTF-16LE, as strings of SMB and NTLM are
+func encodeString(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// decodeString decodes a string of UTF-16LE
+func decodeString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// md4 returns the MD4 digest of data (RFC 1320), which NTLM hashes passwords with
+func md4(data []byte) [16]byte {
+	s := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	msg := append(append([]byte{}, data...), 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+	var x [16]uint32
+	for ; len(msg) > 0; msg = msg[64:] {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[4*i:])
+		}
+		a, b, c, d := s[0], s[1], s[2], s[3]
+		for _, i := range [4]int{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+(b&c|^b&d)+x[i], 3)
+			d = bits.RotateLeft32(d+(a&b|^a&c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+(d&a|^d&b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+(c&d|^c&a)+x[i+3], 19)
+		}
+		for _, i := range [4]int{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+(b&c|b&d|c&d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+(a&b|a&c|b&c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+(d&a|d&b|a&b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+(c&d|c&a|d&a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range [4]int{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+(b^c^d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+(a^b^c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+(d^a^b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+(c^d^a)+x[i+12]+0x6ed9eba1, 15)
+		}
+		s[0], s[1], s[2], s[3] = s[0]+a, s[1]+b, s[2]+c, s[3]+d
+	}
+	var digest [16]byte
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(digest[4*i:], v)
+	}
+	return digest
+}
+
+// OIDs of SPNEGO and of NTLM, in DER
+var (
+	spnegoOID = []byte{0x06, 0x06, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x02}
+	ntlmOID   = []byte{0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x02, 0x02, 0x0a}
+)
+
+var errInvalidToken = errors.New("invalid SPNEGO token")
+
+// spnegoInit wraps the first token of NTLM in a NegTokenInit of SPNEGO, as servers expect security buffers of
+// session setups to be
+func spnegoInit(token []byte) []byte {
+	return der(0x60, spnegoOID, der(0xa0, der(0x30, der(0xa0, der(0x30, ntlmOID)), der(0xa2, der(0x04, token)))))
+}
+
+// spnegoResponse wraps a token of NTLM in a NegTokenResp of SPNEGO
+func spnegoResponse(token []byte) []byte {
+	return der(0xa1, der(0x30, der(0xa2, der(0x04, token))))
+}
+
+// spnegoToken returns the token of NTLM of a NegTokenResp of SPNEGO (or the token itself, of servers that send bare
+// ones)
+func spnegoToken(b []byte) ([]byte, error) {
+	if bytes.HasPrefix(b, ntlmSignature) {
+		return b, nil
+	}
+	tag, b, _, err := readDER(b)
+	if err != nil || tag != 0xa1 {
+		return nil, errInvalidToken
+	}
+	if tag, b, _, err = readDER(b); err != nil || tag != 0x30 {
+		return nil, errInvalidToken
+	}
+	for len(b) > 0 {
+		var field []byte
+		if tag, field, b, err = readDER(b); err != nil {
+			return nil, err
+		}
+		if tag == 0xa2 {
+			if tag, field, _, err = readDER(field); err != nil || tag != 0x04 {
+				return nil, errInvalidToken
+			}
+			return field, nil
+		}
+	}
+	return nil, errInvalidToken
+}
+
+// der encodes a value of DER of tag, of the concatenation of contents
+func der(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+	b := []byte{tag}
+	switch {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n < 0x100:
+		b = append(b, 0x81, byte(n))
+	default:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	}
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// readDER reads a value of DER, returning its tag and contents, and what follows it
+func readDER(b []byte) (tag byte, contents, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errInvalidToken
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n >= 0x80 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || size > len(b) {
+			return 0, nil, nil, errInvalidToken
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if n > len(b) {
+		return 0, nil, nil, errInvalidToken
+	}
+	return tag, b[:n], b[n:], nil
+}
@@ -0,0 +1,77 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/m-manu/go-find-duplicates/internal/uring"
+)
+
+// uringEntries is the number of entries of rings of NewIOURingFS, which is the most chunks a file reads at once
+const uringEntries = 8
+
+// NewIOURingFS returns the local file system, of which files read chunks in batches through io_uring (on Linux 5.6
+// onwards), so that reading many chunks takes a system call rather than one each. It returns an error wrapping
+// errors.ErrUnsupported if io_uring isn't available.
+func NewIOURingFS() (FS, error) {
+	pool, err := uring.NewPool(uringEntries)
+	if err != nil {
+		return nil, errUnsupported(err)
+	}
+	return uringFS{pool: pool}, nil
+}
+
+// errUnsupported makes err (of package uring) wrap errors.ErrUnsupported too, if it's of io_uring being unsupported
+func errUnsupported(err error) error {
+	if errors.Is(err, uring.ErrUnsupported) {
+		return fmt.Errorf("%w: %w", errors.ErrUnsupported, err)
+	}
+	return err
+}
+
+type uringFS struct {
+	localFS
+	pool *uring.Pool
+}
+
+func (u uringFS) Open(name string) (fs.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &uringFile{File: f, pool: u.pool}, nil
+}
+
+// uringFile is a file of NewIOURingFS
+type uringFile struct {
+	*os.File
+	pool *uring.Pool
+}
+
+// ReadAtBatch reads into each of bufs at the offset of the same index, by a ring of the pool (so that they're read at
+// once) if there are few enough of them
+func (f *uringFile) ReadAtBatch(bufs [][]byte, offsets []int64) error {
+	if len(bufs) > uringEntries {
+		return ReadAtBatch(f.File, bufs, offsets)
+	}
+	r, err := f.pool.Get()
+	if err != nil {
+		return ReadAtBatch(f.File, bufs, offsets)
+	}
+	counts, err := r.ReadAt(f.Fd(), bufs, offsets)
+	f.pool.Put(r)
+	if err != nil {
+		return &fs.PathError{Op: "read", Path: f.Name(), Err: err}
+	}
+	for i, n := range counts {
+		if n < len(bufs[i]) {
+			// Reads of io_uring (like read(2)) may be short, whereas ReadAt reads all it's asked for, or fails
+			if _, err := f.ReadAt(bufs[i][n:], offsets[i]+int64(n)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
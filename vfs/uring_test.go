@@ -0,0 +1,33 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAtBatch(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1_000)
+	path := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(path, content, 0o644))
+	fileSystems := []FS{Local}
+	if uringFS, err := NewIOURingFS(); err == nil {
+		fileSystems = append(fileSystems, uringFS)
+	} else {
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+	}
+	for _, fsys := range fileSystems {
+		f, err := OpenFile(fsys, path)
+		assert.Nil(t, err)
+		bufs := [][]byte{make([]byte, 4), make([]byte, 3), make([]byte, 10)}
+		assert.Nil(t, ReadAtBatch(f, bufs, []int64{0, 5_005, 9_990}))
+		assert.Equal(t, []string{"0123", "567", "0123456789"}, []string{string(bufs[0]), string(bufs[1]),
+			string(bufs[2])})
+		assert.NotNil(t, ReadAtBatch(f, [][]byte{make([]byte, 20)}, []int64{9_990}))
+		assert.Nil(t, f.Close())
+	}
+}
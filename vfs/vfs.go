@@ -0,0 +1,197 @@
+// Package vfs is the filesystem abstraction the scanning engine operates on, so that local directories, archives,
+// remote storage and in-memory test fixtures can all be scanned the same way.
+package vfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS is a read-only file system. Unlike fs.FS, names are native paths (e.g. absolute paths of the local file system)
+// rather than slash-separated unrooted paths.
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	// Lstat is like Stat, but doesn't follow a symbolic link
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// File is an open file that supports random access
+type File interface {
+	fs.File
+	io.ReaderAt
+}
+
+// Checksummer is implemented by file systems that know checksums of files without reading them, such as cloud
+// storage that keeps them in metadata of objects
+type Checksummer interface {
+	// Checksum returns the checksum of the named file by the algorithm (e.g. "md5"), or false if it isn't known
+	Checksum(name, algorithm string) (string, bool)
+}
+
+// Checksum returns the checksum of the named file by the algorithm, if fsys knows it without reading the file
+func Checksum(fsys FS, name, algorithm string) (string, bool) {
+	if c, ok := fsys.(Checksummer); ok {
+		return c.Checksum(name, algorithm)
+	}
+	return "", false
+}
+
+// ContextFS is implemented by file systems of which operations can be cancelled, such as those of remote storage
+type ContextFS interface {
+	// WithContext returns the file system, of operations cancelled once ctx is done
+	WithContext(ctx context.Context) FS
+}
+
+// WithContext returns fsys of operations cancelled once ctx is done, if fsys supports that (see ContextFS), and
+// fsys itself otherwise
+func WithContext(fsys FS, ctx context.Context) FS {
+	if c, ok := fsys.(ContextFS); ok {
+		return c.WithContext(ctx)
+	}
+	return fsys
+}
+
+// Identifier is implemented by file systems other than the local one, to tell their files apart from files of the
+// same names of other file systems (such as in caches of hashes)
+type Identifier interface {
+	// ID returns an identifier of the file system that persists across runs, e.g. "s3://bucket"
+	ID() string
+}
+
+// ID returns the identifier of fsys (see Identifier): empty for the local file system, and the name of the type of
+// fsys for file systems that aren't Identifiers
+func ID(fsys FS) string {
+	if i, ok := fsys.(Identifier); ok {
+		return i.ID()
+	}
+	return fmt.Sprintf("%T", fsys)
+}
+
+// ErrNoRandomAccess is returned by OpenFile for files that can't be read at arbitrary offsets
+var ErrNoRandomAccess = errors.New("file doesn't support random access")
+
+// OpenFile opens the named file for random access
+func OpenFile(fsys FS, name string) (File, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	rf, isRandomAccess := RandomAccess(f)
+	if !isRandomAccess {
+		_ = f.Close()
+		return nil, fmt.Errorf("couldn't open %s: %w", name, ErrNoRandomAccess)
+	}
+	return rf, nil
+}
+
+// RandomAccess returns f as a File, if it supports random access (by io.ReaderAt, or by io.Seeker)
+func RandomAccess(f fs.File) (File, bool) {
+	switch rf := f.(type) {
+	case File:
+		return rf, true
+	case io.ReadSeeker:
+		return &seekingFile{File: f, rs: rf}, true
+	default:
+		return nil, false
+	}
+}
+
+// BatchReaderAt is implemented by files that read many chunks at once faster than by ReadAt each, such as files of
+// NewIOURingFS
+type BatchReaderAt interface {
+	// ReadAtBatch reads into each of bufs at the offset of the same index, as ReadAt would
+	ReadAtBatch(bufs [][]byte, offsets []int64) error
+}
+
+// ReadAtBatch reads into each of bufs from f at the offset of the same index: at once, if f is a BatchReaderAt
+func ReadAtBatch(f File, bufs [][]byte, offsets []int64) error {
+	if b, ok := f.(BatchReaderAt); ok {
+		return b.ReadAtBatch(bufs, offsets)
+	}
+	for i, buf := range bufs {
+		if _, err := f.ReadAt(buf, offsets[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seekingFile implements io.ReaderAt for a file that is an io.Seeker. It's not safe for concurrent use.
+type seekingFile struct {
+	fs.File
+	rs io.ReadSeeker
+}
+
+func (s *seekingFile) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s.rs, p)
+}
+
+// Local is the local file system
+var Local FS = localFS{}
+
+type localFS struct{}
+
+func (localFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (localFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// ReadDir reads the named directory by fewer system calls than os.ReadDir, where readDir can
+func (localFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return readDir(name)
+}
+
+// ID is empty, as names of the local file system need no identifier to be told apart (see Identifier)
+func (localFS) ID() string {
+	return ""
+}
+
+// FromFS adapts an fs.FS (such as fstest.MapFS or an embed.FS) to FS. Since fs.FS has no notion of symbolic links,
+// Lstat of the returned FS is the same as Stat.
+func FromFS(fsys fs.FS) FS {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) Open(name string) (fs.File, error) {
+	return f.fsys.Open(filepath.ToSlash(name))
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, filepath.ToSlash(name))
+}
+
+func (f ioFS) Lstat(name string) (fs.FileInfo, error) {
+	return f.Stat(name)
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, filepath.ToSlash(name))
+}
+
+// ID returns the identifier of the fs.FS, if it's an Identifier, and the name of its type otherwise
+func (f ioFS) ID() string {
+	if i, ok := f.fsys.(Identifier); ok {
+		return i.ID()
+	}
+	return fmt.Sprintf("%T", f.fsys)
+}
@@ -0,0 +1,175 @@
+// Package vfstest checks implementations of vfs.FS (of remote storage, say), as testing/fstest does those of fs.FS,
+// so that tests of backends are left with what's specific to their protocols
+package vfstest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/m-manu/go-find-duplicates/service"
+	"github.com/m-manu/go-find-duplicates/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// Files returns the files that backends are checked with, by their names: of a name with a space, in a nested
+// directory, and at the root. Tests of backends add files of their own to them.
+func Files() map[string][]byte {
+	return map[string][]byte{
+		"Photos/a b.jpg":  []byte("0123456789"),
+		"Photos/nested/c": []byte("nested"),
+		"readme.txt":      []byte("hello"),
+	}
+}
+
+// Run checks whether fsys, whose names are slash-separated paths without a leading slash (as those of remote storage
+// are), has files, of their contents. fsys is checked by testing/fstest.TestFS too, which lists every directory of it,
+// and looks up and reads every file of it (in small reads, and at offsets). Checksums of files that fsys knows (see
+// vfs.Checksum) must be those that the hashers of their algorithms compute.
+func Run(t *testing.T, fsys vfs.FS, files map[string][]byte) {
+	t.Helper()
+	names := slices.Sorted(maps.Keys(files))
+	if err := fstest.TestFS(ioFS{fsys}, names...); err != nil {
+		t.Error(err)
+	}
+	for _, name := range names {
+		info, err := fsys.Stat(name)
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+		assert.True(t, info.Mode().IsRegular(), name)
+		assert.Equal(t, int64(len(files[name])), info.Size(), name)
+		f, err := vfs.OpenFile(fsys, name)
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+		data, err := io.ReadAll(f)
+		assert.Nil(t, err, name)
+		assert.Equal(t, string(files[name]), string(data), name)
+		assert.Nil(t, f.Close(), name)
+		checkChecksums(t, fsys, name, files[name])
+	}
+	for _, name := range []string{"missing", sibling(names[0], "missing")} {
+		_, err := fsys.Stat(name)
+		assert.True(t, errors.Is(err, fs.ErrNotExist), "%s: %v", name, err)
+	}
+}
+
+// checkChecksums checks whether checksums of the file of name that fsys knows are those that the hashers of their
+// algorithms compute of its contents
+func checkChecksums(t *testing.T, fsys vfs.FS, name string, content []byte) {
+	t.Helper()
+	local := vfs.FromFS(fstest.MapFS{"file": {Data: content}})
+	info, err := local.Stat("file")
+	assert.Nil(t, err)
+	for _, algorithm := range service.HasherNames() {
+		checksum, known := vfs.Checksum(fsys, name, algorithm)
+		if !known {
+			continue
+		}
+		hasher, err := service.HasherByName(algorithm)
+		assert.Nil(t, err)
+		hash, err := hasher.HashFile(context.Background(), local, "file", info)
+		assert.Nil(t, err)
+		assert.Equal(t, hash, checksum, "%s checksum of %s", algorithm, name)
+	}
+}
+
+// sibling returns the name of base in the directory of name
+func sibling(name, base string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[:i+1] + base
+	}
+	return base
+}
+
+// ioFS is a vfs.FS as an fs.FS that testing/fstest.TestFS can check. Scans list directories by ReadDir of their
+// file systems, rather than by opening them, so directories are opened as files that list them by it. Entries are
+// sorted, as fs.ReadDirFS has them, and invalid names (see fs.ValidPath) are rejected.
+type ioFS struct {
+	fsys vfs.FS
+}
+
+func (f ioFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := f.fsys.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dir{fsys: f, name: name, info: info}, nil
+	}
+	return f.fsys.Open(name)
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.fsys.Stat(name)
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := f.fsys.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// dir is a directory opened by ioFS
+type dir struct {
+	fsys    ioFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return append([]fs.DirEntry{}, entries...), nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
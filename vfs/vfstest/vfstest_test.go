@@ -0,0 +1,16 @@
+package vfstest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/m-manu/go-find-duplicates/vfs"
+)
+
+func TestRun(t *testing.T) {
+	files := fstest.MapFS{}
+	for name, content := range Files() {
+		files[name] = &fstest.MapFile{Data: content}
+	}
+	Run(t, vfs.FromFS(files), Files())
+}
@@ -0,0 +1,158 @@
+package vfs
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or directory in the tree, including root.
+// It behaves the same way as filepath.WalkDir, except that it operates on fsys.
+func WalkDir(fsys FS, root string, fn fs.WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDir(fsys FS, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		// Second call, to report ReadDir error
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := walkDir(fsys, Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Walker walks file trees like WalkLinkedDir does, but reads directories ahead of fn, as many at once as Workers
+// (which suits file trees of very many files, such as of node_modules, that take longer to enumerate than to scan).
+// fn is still called for one file or directory at a time, but for all entries of a directory before those of its
+// subdirectories (rather than in depth-first order). Only directories that fn doesn't skip are read, so directories
+// that are skipped (by returning filepath.SkipDir) aren't read at all.
+type Walker struct {
+	FS FS
+	// Workers is the number of directories read at once (one, if it isn't set)
+	Workers int
+}
+
+// dirRead is a read of the entries of a directory, which may be ahead of the walk, by another goroutine
+type dirRead struct {
+	done    chan struct{}
+	entries []fs.DirEntry
+	err     error
+}
+
+// walkAhead is the most directories read ahead of the walk, by each directory of it, per worker
+const walkAhead = 4
+
+// WalkLinkedDir walks the file tree rooted at root, following root if it's a link, calling fn for each file or
+// directory in the tree, including root
+func (w Walker) WalkLinkedDir(root string, fn fs.WalkDirFunc) error {
+	info, err := w.FS.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		d := fs.FileInfoToDirEntry(info)
+		if err = fn(root, d, nil); err == nil && d.IsDir() {
+			var sem chan struct{}
+			if w.Workers > 1 {
+				sem = make(chan struct{}, w.Workers)
+			}
+			err = w.walkEntries(root, d, w.read(root, sem), sem, fn)
+		}
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// read reads the directory: in another goroutine, if there are workers (sem)
+func (w Walker) read(path string, sem chan struct{}) *dirRead {
+	r := &dirRead{done: make(chan struct{})}
+	if sem == nil {
+		r.entries, r.err = w.FS.ReadDir(path)
+		close(r.done)
+		return r
+	}
+	go func() {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		r.entries, r.err = w.FS.ReadDir(path)
+		close(r.done)
+	}()
+	return r
+}
+
+// walkEntries calls fn for entries of the directory at path (of read r), and then walks its subdirectories that fn
+// doesn't skip, reading them ahead
+func (w Walker) walkEntries(path string, d fs.DirEntry, r *dirRead, sem chan struct{}, fn fs.WalkDirFunc) error {
+	<-r.done
+	if r.err != nil {
+		// Second call, to report ReadDir error
+		if err := fn(path, d, r.err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	var dirs []string
+	var dirEntries []fs.DirEntry
+	for _, entry := range r.entries {
+		entryPath := Join(path, entry.Name())
+		err := fn(entryPath, entry, nil)
+		if err == filepath.SkipDir {
+			if entry.IsDir() {
+				continue
+			}
+			// As of WalkDir, skipping a file skips the rest of its directory
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, entryPath)
+			dirEntries = append(dirEntries, entry)
+		}
+	}
+	ahead := max(1, cap(sem)*walkAhead)
+	reads := make([]*dirRead, len(dirs))
+	for i := range dirs {
+		for j := i; j < min(i+ahead, len(dirs)); j++ {
+			if reads[j] == nil {
+				reads[j] = w.read(dirs[j], sem)
+			}
+		}
+		if err := w.walkEntries(dirs[i], dirEntries[i], reads[i], sem, fn); err != nil {
+			return err
+		}
+		reads[i] = nil
+	}
+	return nil
+}
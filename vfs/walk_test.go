@@ -0,0 +1,79 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readDirCountingFS is an FS that records directories read
+type readDirCountingFS struct {
+	FS
+	mx   sync.Mutex
+	read []string
+}
+
+func (c *readDirCountingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.mx.Lock()
+	c.read = append(c.read, name)
+	c.mx.Unlock()
+	return c.FS.ReadDir(name)
+}
+
+func TestWalkerWalkLinkedDir(t *testing.T) {
+	files := fstest.MapFS{
+		"a/1.txt":        {},
+		"a/b/2.txt":      {},
+		"a/b/c/3.txt":    {},
+		"a/d/4.txt":      {},
+		"a/skip/5.txt":   {},
+		"a/skip/e/6.txt": {},
+	}
+	for _, workers := range []int{0, 1, 4} {
+		fsys := &readDirCountingFS{FS: FromFS(files)}
+		var walked []string
+		err := Walker{FS: fsys, Workers: workers}.WalkLinkedDir("a", func(path string, d fs.DirEntry, err error) error {
+			assert.Nil(t, err)
+			if d.IsDir() && d.Name() == "skip" {
+				return filepath.SkipDir
+			}
+			walked = append(walked, filepath.ToSlash(path))
+			return nil
+		})
+		assert.Nil(t, err)
+		// Entries of a directory come before those of its subdirectories
+		assert.Equal(t, []string{"a", "a/1.txt", "a/b", "a/d", "a/b/2.txt", "a/b/c", "a/b/c/3.txt", "a/d/4.txt"},
+			walked)
+		assert.ElementsMatch(t, []string{"a", "a/b", "a/b/c", "a/d"}, fsys.read)
+	}
+}
+
+func TestLocalReadDir(t *testing.T) {
+	root := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "dir"), 0o755))
+	for _, name := range []string{"b.txt", "a.txt", "c"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0o644))
+	}
+	expected, err := os.ReadDir(root)
+	assert.Nil(t, err)
+	actual, err := Local.ReadDir(root)
+	assert.Nil(t, err)
+	assert.Equal(t, len(expected), len(actual))
+	for i, entry := range actual {
+		assert.Equal(t, expected[i].Name(), entry.Name())
+		assert.Equal(t, expected[i].Type(), entry.Type())
+		info, err := entry.Info()
+		assert.Nil(t, err)
+		expectedInfo, _ := expected[i].Info()
+		assert.Equal(t, expectedInfo.Size(), info.Size())
+		assert.Equal(t, expectedInfo.Mode(), info.Mode())
+		assert.True(t, expectedInfo.ModTime().Equal(info.ModTime()))
+	}
+	_, err = Local.ReadDir(filepath.Join(root, "no-such-dir"))
+	assert.True(t, os.IsNotExist(err))
+}